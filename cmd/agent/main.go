@@ -10,6 +10,9 @@ import (
 	"github.com/holygeek00/lite-sdwan/pkg/logging"
 )
 
+// Version 构建时通过 -ldflags "-X main.Version=..." 注入
+var Version = "dev"
+
 func main() {
 	configPath := flag.String("config", "config/agent_config.yaml", "Path to config file")
 	flag.Parse()
@@ -31,6 +34,7 @@ func main() {
 
 	logger.Info("Starting SD-WAN Agent",
 		logging.F("agent_id", cfg.AgentID),
+		logging.F("version", Version),
 		logging.F("controller_url", cfg.Controller.URL),
 		logging.F("peer_count", len(cfg.Network.PeerIPs)),
 		logging.F("log_level", cfg.Logging.Level),
@@ -44,6 +48,7 @@ func main() {
 		)
 		os.Exit(1)
 	}
+	a.SetVersion(Version)
 
 	a.Run()
 }
@@ -2,16 +2,24 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/holygeek00/lite-sdwan/internal/controller"
 	"github.com/holygeek00/lite-sdwan/pkg/config"
 	"github.com/holygeek00/lite-sdwan/pkg/logging"
 )
 
+// shutdownTimeout 收到 SIGINT/SIGTERM 并经过 server.shutdown_delay 后，等待进行中的请求完成的最长时间
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	configPath := flag.String("config", "config/controller_config.yaml", "Path to config file")
+	importPath := flag.String("import", "", "YAML topology file to load at startup (see GET /api/v1/topology/export)")
 	flag.Parse()
 
 	// 加载配置
@@ -38,11 +46,68 @@ func main() {
 	)
 
 	// 创建并启动服务器
-	server := controller.NewServer(cfg)
-	if err := server.Run(); err != nil {
+	server, err := controller.NewServer(cfg)
+	if err != nil {
+		logger.Error("Failed to create server",
+			logging.F("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+	server.SetConfigPath(*configPath)
+	if *importPath != "" {
+		if _, err := server.ImportTopologyFile(*importPath); err != nil {
+			logger.Error("Failed to import topology",
+				logging.F("error", err.Error()),
+				logging.F("path", *importPath),
+			)
+			server.Shutdown()
+			os.Exit(1)
+		}
+	}
+	go reloadOnSIGHUP(server, logger)
+
+	stopCh := make(chan os.Signal, 1)
+	signal.Notify(stopCh, syscall.SIGINT, syscall.SIGTERM)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- server.Run() }()
+
+	select {
+	case err := <-errCh:
 		logger.Error("Server error",
 			logging.F("error", err.Error()),
 		)
+		server.Shutdown()
 		os.Exit(1)
+	case sig := <-stopCh:
+		logger.Info("Received signal, shutting down", logging.F("signal", sig.String()))
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownDelay+shutdownTimeout)
+		defer cancel()
+		if err := server.Stop(ctx); err != nil {
+			logger.Error("Graceful shutdown incomplete",
+				logging.F("error", err.Error()),
+			)
+		}
+		if err := <-errCh; err != nil {
+			logger.Error("Server error",
+				logging.F("error", err.Error()),
+			)
+		}
+		logger.Info("Controller stopped")
+	}
+}
+
+// reloadOnSIGHUP 收到 SIGHUP 时重新加载配置
+func reloadOnSIGHUP(server *controller.Server, logger logging.Logger) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+
+	for range sigCh {
+		logger.Info("Received SIGHUP, reloading config")
+		changes, err := server.Reload("sighup")
+		if err != nil {
+			continue
+		}
+		logger.Info("Config reload complete", logging.F("changed_fields", len(changes)))
 	}
 }
@@ -17,17 +17,34 @@ import (
 // Agent SD-WAN Agent 主程序
 type Agent struct {
 	cfg      *config.AgentConfig
-	prober   *Prober
-	executor *Executor
+	prober   Prober
+	executor RouteExecutor
 	client   *RetryClient
+	failover *failoverTable
+	health   *HealthServer   // 未配置 health.port 时为 nil
+	twamp    *TWAMPReflector // 未配置 twamp.reflector_port 时为 nil
+	steering *Steerer        // 未配置 steering.rules 时为 nil
+	shaper   *Shaper
+	audit    *RouteAudit
 	logger   logging.Logger
 
 	mu        sync.Mutex
 	running   bool
 	stopCh    chan struct{}
+	pushCh    chan struct{} // 请求在上报周期之外立即发送一次遥测
 	wg        sync.WaitGroup
 	inflight  int64 // 正在进行的请求数
 	acceptNew int32 // 是否接受新的探测结果 (1=接受, 0=不接受)
+
+	routeVersion  uint64 // 已应用的路由集版本，0 表示需要完整同步
+	changeVersion uint64 // 正在应用或最近应用的路由集版本，记入路由变更审计
+	sequence      uint64 // 最近一次遥测的序号，以启动时间初始化，重启后仍然递增
+
+	syncSuccesses uint64 // 路由同步（拉取或推送）成功次数
+	syncFailures  uint64 // 路由同步失败次数，包括拉取失败和应用失败
+
+	version  string                // 随遥测上报的软件版本
+	metadata *models.AgentMetadata // 启动时收集的机器信息
 }
 
 // NewAgent 创建新的 Agent
@@ -37,22 +54,43 @@ func NewAgent(cfg *config.AgentConfig) (*Agent, error) {
 
 // NewAgentWithLogger 创建新的 Agent，使用指定的 Logger
 func NewAgentWithLogger(cfg *config.AgentConfig, logger logging.Logger) (*Agent, error) {
+	return NewAgentWithProber(cfg, nil, logger)
+}
+
+// NewAgentWithProber 创建新的 Agent，使用指定的链路测量引擎
+// prober 为 nil 时按 probe 配置创建 ActiveProber；传入的实现由调用方自行配置，Agent 只负责启停
+func NewAgentWithProber(cfg *config.AgentConfig, prober Prober, logger logging.Logger) (*Agent, error) {
+	return NewAgentWithExecutor(cfg, prober, nil, logger)
+}
+
+// NewAgentWithExecutor 创建新的 Agent，使用指定的链路测量引擎和路由执行器
+// executor 为 nil 时按 network 配置创建操作内核路由表的 Executor；传入的实现由调用方自行配置，退出时由 Agent 关闭
+func NewAgentWithExecutor(cfg *config.AgentConfig, prober Prober, executor RouteExecutor, logger logging.Logger) (*Agent, error) {
 	if logger == nil {
 		logger = logging.NewJSONLoggerFromString(cfg.Logging.Level, nil)
 	}
 
-	executor, err := NewExecutorWithLogger(cfg.Network.WGInterface, cfg.Network.Subnet, logger)
+	if executor == nil {
+		e, err := newExecutorFromConfig(cfg, logger)
+		if err != nil {
+			return nil, err
+		}
+		executor = e
+	}
+
+	steering, err := NewSteerer(cfg, logger)
 	if err != nil {
 		return nil, err
 	}
 
-	prober := NewProberWithLogger(
-		cfg.Network.PeerIPs,
-		cfg.Probe.Interval,
-		cfg.Probe.Timeout,
-		cfg.Probe.WindowSize,
-		logger,
-	)
+	if prober == nil {
+		prober = newActiveProberFromConfig(cfg, logger)
+	}
+
+	audit, err := NewRouteAudit(cfg.RouteAudit.Size, cfg.RouteAudit.File, logger)
+	if err != nil {
+		return nil, err
+	}
 
 	client := NewRetryClientWithLogger(
 		cfg.Controller.URL,
@@ -61,16 +99,130 @@ func NewAgentWithLogger(cfg *config.AgentConfig, logger logging.Logger) (*Agent,
 		cfg.Sync.RetryBackoff,
 		logger,
 	)
+	client.client.SetCompression(cfg.Controller.Gzip)
+	client.client.SetProtobuf(cfg.Controller.Encoding == config.EncodingProtobuf)
+	client.client.SetTenant(cfg.TenantID)
 
-	return &Agent{
+	a := &Agent{
 		cfg:       cfg,
 		prober:    prober,
 		executor:  executor,
+		steering:  steering,
+		shaper:    NewShaper(cfg, logger),
+		audit:     audit,
 		client:    client,
+		failover:  newFailoverTable(),
 		logger:    logger,
 		stopCh:    make(chan struct{}),
+		pushCh:    make(chan struct{}, 1),
 		acceptNew: 1, // 默认接受新的探测结果
-	}, nil
+		sequence:  uint64(time.Now().UnixNano()),
+	}
+	// 链路中断时立即上报，让 Controller 尽快绕开
+	prober.OnLinkDown(func(string) { a.requestTelemetry() })
+	// 传入的执行器实现 OnRouteChange 时同样记录路由变更
+	if notifier, ok := executor.(interface{ OnRouteChange(func(RouteChange)) }); ok {
+		notifier.OnRouteChange(func(c RouteChange) {
+			c.Version = atomic.LoadUint64(&a.changeVersion)
+			a.audit.Record(c)
+		})
+	}
+	if cfg.Health.Port > 0 {
+		a.health = NewHealthServer(a, cfg.Health.Port)
+		a.health.SetTLS(cfg.Health.TLSCert, cfg.Health.TLSKey)
+	}
+	if cfg.TWAMP.ReflectorPort > 0 {
+		a.twamp = NewTWAMPReflector(cfg.TWAMP.ReflectorPort, logger)
+	}
+	return a, nil
+}
+
+// newExecutorFromConfig 按 network 配置创建路由执行器
+func newExecutorFromConfig(cfg *config.AgentConfig, logger logging.Logger) (*Executor, error) {
+	executor, err := NewExecutorWithLogger(cfg.Network.WGInterface, cfg.Network.Subnet, logger)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Network.Subnet6 != "" {
+		if err := executor.AddSubnet(cfg.Network.Subnet6); err != nil {
+			return nil, err
+		}
+	}
+	for _, prefix := range cfg.Network.RoutedPrefixes {
+		if err := executor.AddRoutedPrefix(prefix); err != nil {
+			return nil, err
+		}
+	}
+	executor.SetMaxRelayDepth(cfg.Network.MaxRelayDepth)
+	executor.SetRouteTable(cfg.Network.RouteTable, cfg.Network.RulePriority)
+	executor.SetRouteMetric(cfg.Network.RouteMetric)
+	executor.SetRouteProtocol(uint8(cfg.Network.RouteProtocol))
+	if err := executor.SetRouteBackend(cfg.Network.RouteBackend); err != nil {
+		return nil, err
+	}
+	return executor, nil
+}
+
+// newActiveProberFromConfig 按 probe 和 network 配置创建主动探测器
+func newActiveProberFromConfig(cfg *config.AgentConfig, logger logging.Logger) *ActiveProber {
+	prober := NewActiveProberWithLogger(
+		cfg.Network.PeerAddrs(),
+		cfg.Probe.Interval,
+		cfg.Probe.Timeout,
+		cfg.Probe.WindowSize,
+		logger,
+	)
+	prober.SetCount(cfg.Probe.Count, cfg.Probe.PacketInterval)
+	prober.SetSmoothing(cfg.Probe.Smoothing, cfg.Probe.EWMAAlpha)
+	prober.SetJitter(cfg.Probe.Jitter)
+	prober.SetDownThreshold(cfg.Probe.DownAfter)
+	prober.SetBudget(cfg.Probe.MaxPacketsPerSec, cfg.Probe.MaxBytesPerSec)
+	prober.SetAdaptiveInterval(cfg.Probe.MinInterval, cfg.Probe.MaxInterval)
+	usesICMP := cfg.Probe.Type == config.ProbeTypeICMP
+	for _, peer := range cfg.Network.PeerIPs {
+		prober.SetPeerOptions(peer.IP, PeerOptions{
+			Interval:  peer.Interval,
+			Timeout:   peer.Timeout,
+			ProbeType: peer.Type,
+		})
+		usesICMP = usesICMP || peer.Type == config.ProbeTypeICMP
+	}
+	if usesICMP {
+		mode := resolveICMPMode(cfg.Probe.ICMPMode, cfg.Probe.Timeout, logger)
+		prober.SetPrivileged(mode == config.ICMPModePrivileged)
+		prober.SetSystemEcho(mode == config.ICMPModeSystem)
+	}
+	prober.SetProbeType(cfg.Probe.Type, cfg.Probe.TCPPort)
+	prober.SetHTTPProbe(cfg.Probe.HTTPPort, cfg.Probe.HTTPS)
+	prober.SetTWAMPPort(cfg.Probe.TWAMPPort)
+	prober.SetSource(cfg.Probe.SourceIP, cfg.Probe.Interface)
+	return prober
+}
+
+// resolveICMPMode 解析 probe.icmp_mode，auto 时检测本机可用的套接字
+// 检测失败时仍使用原始套接字，探测时会记录具体的权限错误；当前平台没有系统 API 时 system 按 auto 处理
+func resolveICMPMode(mode string, timeout time.Duration, logger logging.Logger) string {
+	if mode == config.ICMPModeSystem && !systemEchoSupported {
+		logger.Warn("System ICMP echo API is only available on windows, detecting ICMP socket instead")
+		mode = config.ICMPModeAuto
+	}
+	if mode != config.ICMPModeAuto && mode != "" {
+		return mode
+	}
+	detected, err := DetectICMPMode(timeout)
+	if err != nil {
+		logger.Warn("No usable ICMP socket, run as root or set net.ipv4.ping_group_range",
+			logging.F("error", err.Error()),
+		)
+		return config.ICMPModePrivileged
+	}
+	logger.Info("ICMP probe mode detected", logging.F("icmp_mode", detected))
+	return detected
+}
+
+// SetVersion 设置随遥测上报的软件版本，需在 Start 之前调用
+func (a *Agent) SetVersion(version string) {
+	a.version = version
 }
 
 // Start 启动 Agent
@@ -84,6 +236,38 @@ func (a *Agent) Start() {
 	a.mu.Unlock()
 
 	a.logger.Info("Agent starting", logging.F("agent_id", a.cfg.AgentID))
+	a.metadata = collectMetadata(a.cfg, a.version, a.logger)
+
+	// 启动健康检查服务，对端的 http 探测依赖它
+	if a.health != nil {
+		_ = a.health.Start()
+		a.logger.Info("Health server started", logging.F("port", a.cfg.Health.Port))
+	}
+
+	// 启动 TWAMP-light 反射方，对端的 twamp 探测依赖它
+	if a.twamp != nil {
+		if err := a.twamp.Start(); err != nil {
+			a.logger.Error("Failed to start TWAMP reflector", logging.F("error", err.Error()))
+			a.twamp = nil
+		} else {
+			a.logger.Info("TWAMP reflector started", logging.F("port", a.cfg.TWAMP.ReflectorPort))
+		}
+	}
+
+	// 上次进程异常退出时遗留的路由按协议号识别并清理，之后的路由同步重新安装
+	a.purgeStaleRoutes()
+
+	// 使用专用路由表时先添加 ip rule，否则安装的中继路由不生效
+	if err := a.executor.InstallRule(); err != nil {
+		a.logger.Error("Failed to install routing rule", logging.F("error", err.Error()))
+	}
+
+	// 按端口、协议或 DSCP 把流量引入流量类别路由表
+	if a.steering != nil {
+		if err := a.steering.Install(); err != nil {
+			a.logger.Error("Failed to install traffic steering", logging.F("error", err.Error()))
+		}
+	}
 
 	// 启动探测器
 	a.prober.Start()
@@ -96,6 +280,28 @@ func (a *Agent) Start() {
 	a.wg.Add(1)
 	go a.syncLoop()
 
+	// 主中继失效时本地切换到备份下一跳
+	a.wg.Add(1)
+	go a.failoverLoop()
+
+	// 订阅 Controller 路由推送
+	if a.cfg.Sync.Mode == config.SyncModeStream {
+		a.wg.Add(1)
+		go a.streamLoop()
+	}
+
+	// 从 Controller 拉取对等节点
+	if a.cfg.Network.DiscoverPeers {
+		a.wg.Add(1)
+		go a.peerLoop()
+	}
+
+	// 采集底层路径
+	if a.cfg.Traceroute.Interval > 0 {
+		a.wg.Add(1)
+		go a.tracerouteLoop()
+	}
+
 	a.logger.Info("Agent started", logging.F("agent_id", a.cfg.AgentID))
 }
 
@@ -110,6 +316,76 @@ func (a *Agent) telemetryLoop() {
 		select {
 		case <-ticker.C:
 			a.sendTelemetry()
+		case <-a.pushCh:
+			a.sendTelemetry()
+		case <-a.stopCh:
+			return
+		}
+	}
+}
+
+// peerLoop 定期从 Controller 拉取对等节点列表，立即执行一次
+func (a *Agent) peerLoop() {
+	defer a.wg.Done()
+
+	a.refreshPeers()
+	ticker := time.NewTicker(a.cfg.Network.PeerRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.refreshPeers()
+		case <-a.stopCh:
+			return
+		}
+	}
+}
+
+// refreshPeers 将 Controller 返回的对等节点与 peer_ips 合并后更新探测目标
+// 拉取失败时保留当前的探测目标
+func (a *Agent) refreshPeers() {
+	discovered, err := a.client.client.GetPeers(a.cfg.AgentID)
+	if err != nil {
+		a.logger.Warn("Failed to get peers", logging.F("error", err.Error()))
+		return
+	}
+
+	peers := a.cfg.Network.PeerAddrs()
+	for _, ip := range discovered {
+		if ip != a.cfg.AgentID {
+			peers = append(peers, ip)
+		}
+	}
+	added, removed := a.prober.SetPeers(peers)
+	if len(added) > 0 || len(removed) > 0 {
+		a.logger.Info("Peer list updated",
+			logging.F("added", added),
+			logging.F("removed", removed),
+			logging.F("peer_count", len(a.prober.Peers())),
+		)
+	}
+}
+
+// requestTelemetry 请求立即发送一次遥测，已有未处理的请求时合并
+func (a *Agent) requestTelemetry() {
+	select {
+	case a.pushCh <- struct{}{}:
+	default:
+	}
+}
+
+// failoverLoop 按探测间隔检查主中继可达性
+func (a *Agent) failoverLoop() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.cfg.Probe.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.checkFailover()
 		case <-a.stopCh:
 			return
 		}
@@ -123,11 +399,21 @@ func (a *Agent) sendTelemetry() {
 		a.logger.Debug("No metrics to send")
 		return
 	}
+	for i := range metrics {
+		metrics[i].BandwidthMbps = a.cfg.Network.LinkBandwidth[metrics[i].TargetIP]
+	}
+	if a.cfg.Network.ReportHandshake {
+		a.applyHandshakes(metrics)
+	}
 
 	req := &models.TelemetryRequest{
-		AgentID:   a.cfg.AgentID,
-		Timestamp: time.Now().Unix(),
-		Metrics:   metrics,
+		AgentID:           a.cfg.AgentID,
+		TenantID:          a.cfg.TenantID,
+		Timestamp:         time.Now().Unix(),
+		Metrics:           metrics,
+		ReportIntervalSec: int64(a.cfg.Sync.Interval.Seconds()),
+		Metadata:          a.metadata,
+		Sequence:          atomic.AddUint64(&a.sequence, 1),
 	}
 
 	err := a.client.SendTelemetryWithRetry(req)
@@ -143,6 +429,49 @@ func (a *Agent) sendTelemetry() {
 	}
 }
 
+// applyHandshakes 为每条链路附上 WireGuard 握手间隔，读取失败时不附加
+func (a *Agent) applyHandshakes(metrics []models.Metric) {
+	dev, err := readWireGuardDevice(a.cfg.Network.WGInterface)
+	if err != nil {
+		a.logger.Warn("Failed to read WireGuard handshakes",
+			logging.F("interface", a.cfg.Network.WGInterface),
+			logging.F("error", err.Error()),
+		)
+		return
+	}
+	targets := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		targets = append(targets, m.TargetIP)
+	}
+	setHandshakeAges(metrics, handshakeAges(dev.peers, targets, time.Now()), a.cfg.Network.HandshakeTimeout)
+}
+
+// setHandshakeAges 写入握手间隔，从未握手的链路改为设置 HandshakeNever；
+// timeout 大于 0 时握手间隔超过 timeout 或从未握手的链路改为不可达
+func setHandshakeAges(metrics []models.Metric, ages map[string]int64, timeout time.Duration) {
+	for i := range metrics {
+		age, ok := ages[metrics[i].TargetIP]
+		if !ok {
+			continue
+		}
+		never := age == neverHandshakeAge
+		// 按秒比较，从未握手的 neverHandshakeAge 换算成 Duration 会溢出
+		if timeout > 0 && age > int64(timeout/time.Second) {
+			metrics[i] = models.Metric{
+				TargetIP:      metrics[i].TargetIP,
+				RTTMs:         nil,
+				LossRate:      1.0,
+				BandwidthMbps: metrics[i].BandwidthMbps,
+			}
+		}
+		if never {
+			metrics[i].HandshakeNever = true
+		} else {
+			metrics[i].HandshakeAgeSec = &age
+		}
+	}
+}
+
 // syncLoop 路由同步循环
 func (a *Agent) syncLoop() {
 	defer a.wg.Done()
@@ -171,12 +500,13 @@ func (a *Agent) syncRoutes() {
 		return
 	}
 
-	routes, err := a.client.GetRoutesWithRetry(a.cfg.AgentID)
+	routes, err := a.client.GetRoutesWithRetry(a.cfg.AgentID, atomic.LoadUint64(&a.routeVersion))
 	if err != nil {
 		a.logger.Error("Failed to get routes",
 			logging.F("error", err.Error()),
 			logging.F("agent_id", a.cfg.AgentID),
 		)
+		atomic.AddUint64(&a.syncFailures, 1)
 
 		if a.client.ShouldEnterFallback() {
 			a.enterFallback()
@@ -184,6 +514,7 @@ func (a *Agent) syncRoutes() {
 		return
 	}
 
+	atomic.StoreUint64(&a.changeVersion, routes.Version)
 	if len(routes.Routes) > 0 {
 		a.logger.Info("Received routes from controller",
 			logging.F("route_count", len(routes.Routes)),
@@ -193,20 +524,117 @@ func (a *Agent) syncRoutes() {
 			a.logger.Error("Failed to sync routes",
 				logging.F("error", syncErr.Error()),
 			)
+			atomic.AddUint64(&a.syncFailures, 1)
+			return // 保留旧版本，下次重新拉取
+		}
+		a.failover.record(routes.Routes)
+	}
+	a.syncClassRoutes(routes.Classes)
+	a.syncShaping(routes.Shaping)
+	atomic.StoreUint64(&a.routeVersion, routes.Version)
+	atomic.AddUint64(&a.syncSuccesses, 1)
+}
+
+// syncClassRoutes 将各流量类别的路由表安装到 network.class_tables 配置的内核路由表
+func (a *Agent) syncClassRoutes(classes []models.ClassRoutes) {
+	for _, class := range classes {
+		table, ok := a.cfg.Network.ClassTables[class.Class]
+		if !ok {
+			continue
+		}
+		if err := a.executor.SyncClassRoutes(table, class.Routes); err != nil {
+			a.logger.Error("Failed to sync class routes",
+				logging.F("class", class.Class),
+				logging.F("table", table),
+				logging.F("error", err.Error()),
+			)
 		}
 	}
 }
 
+// syncShaping 应用路由策略中的出口整形参数，按当前生效的路由把目的地归入下一跳的 tc 类别
+func (a *Agent) syncShaping(shaping []models.NextHopShaping) {
+	if len(shaping) == 0 && !a.shaper.Active() {
+		return
+	}
+	routes, err := a.executor.GetCurrentRoutes()
+	if err != nil {
+		a.logger.Error("Failed to list routes for egress shaping", logging.F("error", err.Error()))
+		return
+	}
+	if err := a.shaper.Update(shaping, routes); err != nil {
+		a.logger.Error("Failed to apply egress shaping", logging.F("error", err.Error()))
+	}
+}
+
+// refreshShaping 路由在定期同步之外变化（推送、fallback）后重建整形过滤器
+func (a *Agent) refreshShaping() {
+	if !a.shaper.Active() {
+		return
+	}
+	routes, err := a.executor.GetCurrentRoutes()
+	if err != nil {
+		a.logger.Error("Failed to list routes for egress shaping", logging.F("error", err.Error()))
+		return
+	}
+	if err := a.shaper.Refresh(routes); err != nil {
+		a.logger.Error("Failed to refresh egress shaping", logging.F("error", err.Error()))
+	}
+}
+
+// streamLoop 路由推送订阅循环，收到推送后立即应用路由
+func (a *Agent) streamLoop() {
+	defer a.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-a.stopCh
+		cancel()
+	}()
+
+	_ = a.client.SubscribeRoutes(ctx, a.cfg.AgentID, a.applyPushedRoutes)
+}
+
+// applyPushedRoutes 应用 Controller 推送的路由
+func (a *Agent) applyPushedRoutes(routes *models.RouteResponse) {
+	if a.client.IsInFallback() || len(routes.Routes) == 0 {
+		return
+	}
+
+	a.logger.Info("Received pushed routes from controller",
+		logging.F("route_count", len(routes.Routes)),
+		logging.F("agent_id", a.cfg.AgentID),
+	)
+	atomic.StoreUint64(&a.changeVersion, routes.Version)
+	if syncErr := a.executor.SyncRoutes(routes.Routes); syncErr != nil {
+		a.logger.Error("Failed to sync routes",
+			logging.F("error", syncErr.Error()),
+		)
+		atomic.AddUint64(&a.syncFailures, 1)
+		return
+	}
+	a.failover.record(routes.Routes)
+	a.refreshShaping()
+	atomic.AddUint64(&a.syncSuccesses, 1)
+}
+
 // enterFallback 进入 fallback 模式
 func (a *Agent) enterFallback() {
 	a.client.EnterFallback()
 	a.logger.Warn("Entering fallback mode, flushing routes")
 
+	// 路由被清空，恢复后需要完整同步
+	atomic.StoreUint64(&a.routeVersion, 0)
+	a.failover.reset()
+
 	if flushErr := a.executor.FlushRoutes(); flushErr != nil {
 		a.logger.Error("Failed to flush routes",
 			logging.F("error", flushErr.Error()),
 		)
 	}
+	a.refreshShaping()
 }
 
 // Stop 停止 Agent
@@ -223,6 +651,9 @@ func (a *Agent) Stop() {
 
 	// 停止探测器
 	a.prober.Stop()
+	if a.twamp != nil {
+		a.twamp.Stop()
+	}
 
 	// 停止协程
 	close(a.stopCh)
@@ -269,11 +700,55 @@ func (a *Agent) Shutdown(ctx context.Context) error {
 		)
 		// 继续执行其他清理任务，不返回错误
 	}
+	a.executor.Close()
+	if a.steering != nil {
+		if err := a.steering.Remove(); err != nil {
+			a.logger.Warn("Traffic steering cleanup encountered errors",
+				logging.F("error", err.Error()),
+			)
+		}
+	}
+	if err := a.shaper.Remove(); err != nil {
+		a.logger.Warn("Egress shaping cleanup encountered errors",
+			logging.F("error", err.Error()),
+		)
+	}
+	if err := a.audit.Close(); err != nil {
+		a.logger.Warn("Failed to close route audit log", logging.F("error", err.Error()))
+	}
+
+	// 6. 停止健康检查服务和 TWAMP 反射方
+	if a.health != nil {
+		if err := a.health.Stop(ctx); err != nil {
+			a.logger.Warn("Failed to stop health server", logging.F("error", err.Error()))
+		}
+	}
+	if a.twamp != nil {
+		a.twamp.Stop()
+	}
 
 	a.logger.Info("Agent shutdown complete", logging.F("agent_id", a.cfg.AgentID))
 	return nil
 }
 
+// purgeStaleRoutes 清理上次运行遗留的、带有本 Agent 协议号的路由
+func (a *Agent) purgeStaleRoutes() {
+	tables := make([]int, 0, len(a.cfg.Network.ClassTables))
+	for _, table := range a.cfg.Network.ClassTables {
+		tables = append(tables, table)
+	}
+
+	cleaned, errs := a.executor.PurgeStaleRoutes(tables)
+	for _, err := range errs {
+		a.logger.Error("Stale route cleanup error", logging.F("error", err.Error()))
+	}
+	if cleaned > 0 {
+		a.logger.Warn("Removed routes left by a previous run",
+			logging.F("cleaned_count", cleaned),
+		)
+	}
+}
+
 // cleanupRoutes 清理由 Agent 添加的所有路由
 func (a *Agent) cleanupRoutes() error {
 	a.logger.Info("Cleaning up managed routes")
@@ -379,6 +854,14 @@ func (a *Agent) GetHealthStatus() *models.DetailedHealthResponse {
 	proberHealth := models.NewComponentHealth(models.HealthStatusHealthy)
 	if a.prober != nil {
 		proberHealth.Details["running"] = a.prober.IsRunning()
+		proberHealth.Details["type"] = a.prober.ProbeType()
+		if active, ok := a.prober.(*ActiveProber); ok {
+			if active.ProbeType() == config.ProbeTypeICMP {
+				proberHealth.Details["icmp_privileged"] = active.Privileged()
+				proberHealth.Details["icmp_system_echo"] = active.SystemEcho()
+			}
+			proberHealth.Details["budget_stretch"] = active.BudgetStretch()
+		}
 		proberHealth.Details["success_rate"] = a.prober.GetSuccessRate()
 		if lastProbe := a.prober.GetLastProbeTime(); lastProbe != nil {
 			proberHealth.Details["last_probe_time"] = lastProbe.Format(time.RFC3339)
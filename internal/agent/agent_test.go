@@ -0,0 +1,275 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// fakeProber 返回固定指标的测量引擎
+type fakeProber struct {
+	peers   []string
+	running bool
+	onDown  []func(string)
+}
+
+func (f *fakeProber) Start()          { f.running = true }
+func (f *fakeProber) Stop()           { f.running = false }
+func (f *fakeProber) IsRunning() bool { return f.running }
+func (f *fakeProber) Peers() []string { return f.peers }
+func (f *fakeProber) SetPeers(peerIPs []string) (added, removed []string) {
+	f.peers = peerIPs
+	return peerIPs, nil
+}
+func (f *fakeProber) GetMetrics() []models.Metric {
+	return []models.Metric{{TargetIP: "10.254.0.2", RTTMs: ptrFloat64(12)}}
+}
+func (f *fakeProber) GetRawMetrics() []models.Metric    { return f.GetMetrics() }
+func (f *fakeProber) GetHistory() []PeerHistory         { return nil }
+func (f *fakeProber) GetSuccessRate() float64           { return 1 }
+func (f *fakeProber) GetLastProbeTime() *time.Time      { return nil }
+func (f *fakeProber) ProbeType() string                 { return "fake" }
+func (f *fakeProber) OnLinkDown(fn func(target string)) { f.onDown = append(f.onDown, fn) }
+
+// fakeExecutor 只在内存中记录路由的执行器
+type fakeExecutor struct {
+	routes  map[string]string
+	flushed int
+	fail    map[string]bool // 应用时返回错误的目标网段
+}
+
+func newFakeExecutor() *fakeExecutor { return &fakeExecutor{routes: make(map[string]string)} }
+
+func (f *fakeExecutor) InstallRule() error { return nil }
+func (f *fakeExecutor) SyncRoutes(desired []models.RouteConfig) error {
+	var errs []error
+	for _, route := range desired {
+		if err := f.ApplyRoute(route); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+func (f *fakeExecutor) ApplyRoute(route models.RouteConfig) error {
+	if f.fail[route.DstCIDR] {
+		return fmt.Errorf("apply %s: injected failure", route.DstCIDR)
+	}
+	if route.NextHop == "direct" {
+		delete(f.routes, route.DstCIDR)
+	} else {
+		f.routes[route.DstCIDR] = route.NextHop
+	}
+	return nil
+}
+func (f *fakeExecutor) SyncClassRoutes(int, []models.RouteConfig) error { return nil }
+func (f *fakeExecutor) FlushRoutes() error {
+	f.flushed++
+	f.routes = make(map[string]string)
+	return nil
+}
+func (f *fakeExecutor) GetCurrentRoutes() ([]CurrentRoute, error) {
+	var routes []CurrentRoute
+	for dst, hop := range f.routes {
+		routes = append(routes, CurrentRoute{Destination: dst, NextHop: hop})
+	}
+	return routes, nil
+}
+func (f *fakeExecutor) ManagedRouteCount() int                { return len(f.routes) }
+func (f *fakeExecutor) PurgeStaleRoutes([]int) (int, []error) { return 0, nil }
+func (f *fakeExecutor) CleanupManagedRoutes() (int, []error)  { return len(f.routes), nil }
+func (f *fakeExecutor) Close()                                {}
+
+// newTestAgent 创建使用 fakeProber 的 Agent，Controller 地址不可达
+// 单次同步失败不会进入 fallback，以免测试清理本机 WireGuard 网卡上的路由
+func newTestAgent(t *testing.T, fake *fakeProber) *Agent {
+	t.Helper()
+	cfg := &config.AgentConfig{
+		AgentID:    "10.254.0.1",
+		Controller: config.ControllerClient{URL: "http://127.0.0.1:1", Timeout: time.Second},
+		Sync:       config.SyncConfig{Interval: time.Minute, RetryAttempts: 2, RetryBackoff: []int{0}},
+		Network:    config.NetworkConfig{WGInterface: "wg0", Subnet: "10.254.0.0/24"},
+	}
+	a, err := NewAgentWithProber(cfg, fake, logging.NewNopLogger())
+	if err != nil {
+		t.Fatalf("NewAgentWithProber() error = %v", err)
+	}
+	return a
+}
+
+func TestNewAgentWithProber(t *testing.T) {
+	fake := &fakeProber{peers: []string{"10.254.0.2"}}
+	a := newTestAgent(t, fake)
+
+	health := a.GetHealthStatus()
+	if got := health.Components["prober"].Details["type"]; got != "fake" {
+		t.Errorf("prober type in health = %v, want fake", got)
+	}
+
+	// 链路中断回调请求一次额外的遥测上报
+	if len(fake.onDown) != 1 {
+		t.Fatalf("link down hooks = %d, want 1", len(fake.onDown))
+	}
+	fake.onDown[0]("10.254.0.2")
+	select {
+	case <-a.pushCh:
+	default:
+		t.Error("link down did not request a telemetry push")
+	}
+}
+
+func TestNewAgentWithExecutor(t *testing.T) {
+	cfg := &config.AgentConfig{
+		AgentID:    "10.254.0.1",
+		Controller: config.ControllerClient{URL: "http://127.0.0.1:1", Timeout: time.Second},
+		Sync:       config.SyncConfig{Interval: time.Minute, RetryAttempts: 2, RetryBackoff: []int{0}},
+		Network:    config.NetworkConfig{WGInterface: "wg0", Subnet: "10.254.0.0/24"},
+	}
+	executor := newFakeExecutor()
+	a, err := NewAgentWithExecutor(cfg, &fakeProber{}, executor, logging.NewNopLogger())
+	if err != nil {
+		t.Fatalf("NewAgentWithExecutor() error = %v", err)
+	}
+
+	a.applyPushedRoutes(&models.RouteResponse{Routes: []models.RouteConfig{
+		{DstCIDR: "10.254.0.3/32", NextHop: "10.254.0.2"},
+	}})
+	if got := executor.routes["10.254.0.3/32"]; got != "10.254.0.2" {
+		t.Errorf("pushed route next hop = %q, want 10.254.0.2", got)
+	}
+
+	// 使用模拟执行器时可以放心进入 fallback，不会清理本机路由
+	a.enterFallback()
+	if executor.flushed != 1 || len(executor.routes) != 0 {
+		t.Errorf("after fallback: flushed = %d, routes = %v", executor.flushed, executor.routes)
+	}
+}
+
+func TestSyncRoutesKeepsVersionOnFailure(t *testing.T) {
+	var since []string
+	controller := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since = append(since, r.URL.Query().Get("since"))
+		_ = json.NewEncoder(w).Encode(models.RouteResponse{Version: 5, Routes: []models.RouteConfig{
+			{DstCIDR: "10.254.0.3/32", NextHop: "10.254.0.2"},
+			{DstCIDR: "10.254.0.4/32", NextHop: "10.254.0.2"},
+		}})
+	}))
+	defer controller.Close()
+
+	cfg := &config.AgentConfig{
+		AgentID:    "10.254.0.1",
+		Controller: config.ControllerClient{URL: controller.URL, Timeout: time.Second},
+		Sync:       config.SyncConfig{Interval: time.Minute, RetryAttempts: 1, RetryBackoff: []int{0}},
+		Network:    config.NetworkConfig{WGInterface: "wg0", Subnet: "10.254.0.0/24"},
+	}
+	executor := newFakeExecutor()
+	executor.fail = map[string]bool{"10.254.0.4/32": true}
+	a, err := NewAgentWithExecutor(cfg, &fakeProber{}, executor, logging.NewNopLogger())
+	if err != nil {
+		t.Fatalf("NewAgentWithExecutor() error = %v", err)
+	}
+
+	a.syncRoutes()
+	if got := executor.routes["10.254.0.3/32"]; got != "10.254.0.2" {
+		t.Errorf("healthy route next hop = %q, want 10.254.0.2", got)
+	}
+	if a.routeVersion != 0 || a.syncFailures != 1 {
+		t.Errorf("after failed sync: routeVersion = %d, syncFailures = %d", a.routeVersion, a.syncFailures)
+	}
+
+	// 失败的路由恢复后，下次同步仍从旧版本拉取完整路由集
+	executor.fail = nil
+	a.syncRoutes()
+	if executor.routes["10.254.0.4/32"] != "10.254.0.2" || a.routeVersion != 5 {
+		t.Errorf("after retry: routes = %v, routeVersion = %d", executor.routes, a.routeVersion)
+	}
+	if len(since) != 2 || since[0] != "0" || since[1] != "0" {
+		t.Errorf("since = %v, want [0 0]", since)
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	a := newTestAgent(t, &fakeProber{peers: []string{"10.254.0.2"}})
+	a.SetVersion("1.2.3")
+	// Controller 不可达，本次同步计为失败
+	a.syncRoutes()
+
+	w := httptest.NewRecorder()
+	NewHealthServer(a, 0).handleMetrics(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != prometheusContentType {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	for _, line := range []string{
+		`sdwan_agent_info{agent_id="10.254.0.1",tenant_id="",version="1.2.3"} 1`,
+		`sdwan_agent_route_syncs_total{result="success"} 0`,
+		`sdwan_agent_route_syncs_total{result="failure"} 1`,
+		`sdwan_agent_fallback 0`,
+		`sdwan_agent_applied_routes 0`,
+		`sdwan_agent_probe_rtt_seconds{target="10.254.0.2"} 0.012`,
+		`sdwan_agent_probe_loss_ratio{target="10.254.0.2"} 0`,
+	} {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Errorf("metrics missing %q:\n%s", line, w.Body.String())
+		}
+	}
+}
+
+func TestResolveICMPMode(t *testing.T) {
+	logger := logging.NewNopLogger()
+
+	// 显式配置的模式不做检测
+	for _, mode := range []string{config.ICMPModePrivileged, config.ICMPModeUnprivileged} {
+		if got := resolveICMPMode(mode, 100*time.Millisecond, logger); got != mode {
+			t.Errorf("resolveICMPMode(%q) = %q, want %q", mode, got, mode)
+		}
+	}
+
+	// auto 的结果取决于运行环境的权限，检测失败时回退到原始套接字，只检查结果是可用的模式
+	want := map[string]bool{config.ICMPModePrivileged: true, config.ICMPModeUnprivileged: true}
+	if systemEchoSupported {
+		want[config.ICMPModeSystem] = true
+	}
+	for _, mode := range []string{config.ICMPModeAuto, ""} {
+		if got := resolveICMPMode(mode, 100*time.Millisecond, logger); !want[got] {
+			t.Errorf("resolveICMPMode(%q) = %q, want a detected mode", mode, got)
+		}
+	}
+	if !systemEchoSupported {
+		if got := resolveICMPMode(config.ICMPModeSystem, 100*time.Millisecond, logger); !want[got] {
+			t.Errorf("resolveICMPMode(system) = %q, want a socket mode on this platform", got)
+		}
+	}
+}
+
+func TestNewProberICMPMode(t *testing.T) {
+	cfg := &config.AgentConfig{
+		Probe: config.ProbeConfig{
+			Type:       config.ProbeTypeICMP,
+			ICMPMode:   config.ICMPModeUnprivileged,
+			Interval:   time.Second,
+			Timeout:    time.Second,
+			WindowSize: 3,
+		},
+		Network: config.NetworkConfig{PeerIPs: []config.PeerConfig{{IP: "10.254.0.2"}}},
+	}
+	prober := newActiveProberFromConfig(cfg, logging.NewNopLogger())
+	if prober.Privileged() {
+		t.Error("icmp_mode unprivileged should disable raw sockets")
+	}
+
+	cfg.Probe.ICMPMode = config.ICMPModePrivileged
+	if prober := newActiveProberFromConfig(cfg, logging.NewNopLogger()); !prober.Privileged() {
+		t.Error("icmp_mode privileged should use raw sockets")
+	}
+}
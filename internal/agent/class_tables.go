@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// GenerateClassAddCommand 生成在流量类别路由表中添加/替换路由的命令，nextHop 为 direct 时直接经 WireGuard 接口发送，
+// 为 blackhole 时丢弃流量。dst 为 CIDR 或单个地址（主机路由）
+func (e *Executor) GenerateClassAddCommand(table int, dst, nextHop string) []string {
+	if nextHop == "blackhole" {
+		return e.withProtocol([]string{"ip", "route", "replace", "blackhole", routeDst(dst), "table", strconv.Itoa(table)})
+	}
+	args := []string{"ip", "route", "replace", routeDst(dst)}
+	if nextHop != "direct" {
+		args = append(args, "via", nextHop)
+	}
+	return e.withProtocol(append(args, "dev", e.wgInterface, "table", strconv.Itoa(table)))
+}
+
+// GenerateClassDelCommand 生成从流量类别路由表中删除路由的命令，dst 为 CIDR 或单个地址（主机路由）
+func (e *Executor) GenerateClassDelCommand(table int, dst string) []string {
+	return []string{
+		"ip", "route", "del",
+		routeDst(dst),
+		"dev", e.wgInterface,
+		"table", strconv.Itoa(table),
+	}
+}
+
+// GenerateClassBlackholeDelCommand 生成从流量类别路由表中删除黑洞路由的命令
+func (e *Executor) GenerateClassBlackholeDelCommand(table int, dst string) []string {
+	return []string{"ip", "route", "del", "blackhole", routeDst(dst), "table", strconv.Itoa(table)}
+}
+
+// GenerateFlushTableCommand 生成清空流量类别路由表的命令，只涉及 IPv4 路由
+func (e *Executor) GenerateFlushTableCommand(table int) []string {
+	return []string{"ip", "route", "flush", "table", strconv.Itoa(table)}
+}
+
+// GenerateFlushTable6Command 生成清空流量类别路由表中 IPv6 路由的命令
+func (e *Executor) GenerateFlushTable6Command(table int) []string {
+	return []string{"ip", "-6", "route", "flush", "table", strconv.Itoa(table)}
+}
+
+// flushTableLocked 按允许的子网涉及的地址族清空路由表 table，表中没有某个地址族的路由不算错误，调用方需持有 e.mu
+func (e *Executor) flushTableLocked(table int) error {
+	for _, v6 := range e.families() {
+		args := e.GenerateFlushTableCommand(table)
+		if v6 {
+			args = e.GenerateFlushTable6Command(table)
+		}
+		if err := e.runRouteCommand(args); err != nil && !errors.Is(err, errRouteNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncClassRoutes 将流量类别的完整路由快照同步到内核路由表 table
+// 快照中没有的目的地从表中删除，查找回落到后续 ip rule（通常是主路由表）
+func (e *Executor) SyncClassRoutes(table int, desired []models.RouteConfig) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	current := e.classRoutes[table]
+	if current == nil {
+		current = make(map[string]string)
+		e.classRoutes[table] = current
+	}
+
+	var failed int
+	wanted := make(map[string]bool, len(desired))
+	for _, route := range desired {
+		dst, err := e.checkDst(route.DstCIDR)
+		if err == nil && route.NextHop != "direct" && route.NextHop != "blackhole" {
+			err = e.checkNextHop(route.NextHop, dst)
+		}
+		if err != nil {
+			e.logger.Error("Class route outside allowed subnet",
+				logging.F("table", table),
+				logging.F("dst_cidr", route.DstCIDR),
+				logging.F("next_hop", route.NextHop),
+				logging.F("error", err.Error()),
+			)
+			failed++
+			continue
+		}
+		if err := e.checkRelays(route); err != nil {
+			e.logger.Error("Class route rejected",
+				logging.F("table", table),
+				logging.F("dst_cidr", route.DstCIDR),
+				logging.F("error", err.Error()),
+			)
+			failed++
+			continue
+		}
+		wanted[route.DstCIDR] = true
+		if current[route.DstCIDR] == route.NextHop {
+			continue
+		}
+		e.changeReason = route.Reason
+
+		args := e.GenerateClassAddCommand(table, dst.String(), route.NextHop)
+		e.logger.Info("Adding class route",
+			logging.F("command", strings.Join(args, " ")),
+			logging.F("table", table),
+			logging.F("dst_cidr", dst.String()),
+			logging.F("next_hop", route.NextHop),
+		)
+		if err := e.runRouteCommand(args); err != nil {
+			e.logger.Error("Failed to apply class route",
+				logging.F("table", table),
+				logging.F("dst_cidr", route.DstCIDR),
+				logging.F("error", err.Error()),
+			)
+			failed++
+			continue
+		}
+		current[route.DstCIDR] = route.NextHop
+	}
+
+	e.changeReason = changeReasonClassSync
+	for dst := range current {
+		if wanted[dst] {
+			continue
+		}
+		args := e.GenerateClassDelCommand(table, dst)
+		if current[dst] == "blackhole" {
+			args = e.GenerateClassBlackholeDelCommand(table, dst)
+		}
+		e.logger.Info("Removing class route",
+			logging.F("command", strings.Join(args, " ")),
+			logging.F("table", table),
+		)
+		if err := e.runRouteCommand(args); err != nil && !errors.Is(err, errRouteNotFound) {
+			e.logger.Error("Failed to remove class route",
+				logging.F("table", table),
+				logging.F("dst_cidr", dst),
+				logging.F("error", err.Error()),
+			)
+			failed++
+			continue
+		}
+		delete(current, dst)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d class route(s) in table %d failed to sync", failed, table)
+	}
+	return nil
+}
+
+// flushClassTablesLocked 清空所有由 Agent 管理的流量类别路由表，调用方需持有 e.mu
+func (e *Executor) flushClassTablesLocked() {
+	for table := range e.classRoutes {
+		if err := e.flushTableLocked(table); err != nil {
+			e.logger.Error("Failed to flush class table",
+				logging.F("table", table),
+				logging.F("error", err.Error()),
+			)
+			continue
+		}
+		e.logger.Info("Flushed class table", logging.F("table", table))
+	}
+	e.classRoutes = make(map[int]map[string]string)
+}
@@ -1,23 +1,34 @@
 package agent
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/holygeek00/lite-sdwan/pkg/logging"
 	"github.com/holygeek00/lite-sdwan/pkg/models"
 )
 
+// maxStreamEventSize 路由推送流中单个事件的最大字节数
+const maxStreamEventSize = 1 << 20
+
 // Client Controller HTTP 客户端
 type Client struct {
-	baseURL    string
-	httpClient *http.Client
-	timeout    time.Duration
+	baseURL      string
+	httpClient   *http.Client
+	streamClient *http.Client // 长连接专用，不设置整体超时
+	timeout      time.Duration
+	compress     bool // 使用 gzip 压缩请求体
+	protobuf     bool // 使用 API v2 的 protobuf 编码
+	tenantID     string
 }
 
 // NewClient 创建新的客户端
@@ -27,26 +38,72 @@ func NewClient(baseURL string, timeout time.Duration) *Client {
 		httpClient: &http.Client{
 			Timeout: timeout,
 		},
-		timeout: timeout,
+		streamClient: &http.Client{},
+		timeout:      timeout,
+	}
+}
+
+// SetCompression 设置是否使用 gzip 压缩请求体
+// 响应体压缩由 net/http 自动协商和解压
+func (c *Client) SetCompression(enabled bool) {
+	c.compress = enabled
+}
+
+// SetProtobuf 设置是否通过 API v2 使用 protobuf 编码遥测和路由
+func (c *Client) SetProtobuf(enabled bool) {
+	c.protobuf = enabled
+}
+
+// SetTenant 设置路由查询和推送流所属的租户，为空表示默认租户
+func (c *Client) SetTenant(tenantID string) {
+	c.tenantID = tenantID
+}
+
+// routesQuery 构造路由接口的查询参数
+func (c *Client) routesQuery(agentID string) string {
+	q := url.Values{}
+	q.Set("agent_id", agentID)
+	if c.tenantID != "" {
+		q.Set("tenant_id", c.tenantID)
 	}
+	return q.Encode()
 }
 
 // SendTelemetry 发送遥测数据
 func (c *Client) SendTelemetry(req *models.TelemetryRequest) error {
-	data, err := json.Marshal(req)
-	if err != nil {
-		return fmt.Errorf("failed to marshal telemetry: %w", err)
+	apiPath, contentType := "/api/v1/telemetry", "application/json"
+	var data []byte
+	var err error
+	if c.protobuf {
+		apiPath, contentType = "/api/v2/telemetry", models.ContentTypeProtobuf
+		data = req.MarshalProto()
+	} else {
+		data, err = json.Marshal(req)
+		if err != nil {
+			return fmt.Errorf("failed to marshal telemetry: %w", err)
+		}
+	}
+
+	if c.compress {
+		data, err = gzipBytes(data)
+		if err != nil {
+			return fmt.Errorf("failed to compress telemetry: %w", err)
+		}
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
 
-	url := c.baseURL + "/api/v1/telemetry"
+	url := c.baseURL + apiPath
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
+	requestID := setRequestID(httpReq)
+	httpReq.Header.Set("Content-Type", contentType)
+	if c.compress {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
@@ -57,24 +114,116 @@ func (c *Client) SendTelemetry(req *models.TelemetryRequest) error {
 	if resp.StatusCode != http.StatusOK {
 		body, readErr := io.ReadAll(resp.Body)
 		if readErr != nil {
-			return fmt.Errorf("telemetry request failed with status %d", resp.StatusCode)
+			return fmt.Errorf("telemetry request %s failed with status %d", requestID, resp.StatusCode)
 		}
-		return fmt.Errorf("telemetry request failed with status %d: %s", resp.StatusCode, string(body))
+		return fmt.Errorf("telemetry request %s failed with status %d: %s", requestID, resp.StatusCode, string(body))
 	}
 
 	return nil
 }
 
-// GetRoutes 获取路由配置
-func (c *Client) GetRoutes(agentID string) (*models.RouteResponse, error) {
+// setRequestID 为请求生成关联 ID 并写入请求头，Controller 会把它记录到对应的日志中
+func setRequestID(req *http.Request) string {
+	id := models.NewRequestID()
+	req.Header.Set(models.RequestIDHeader, id)
+	return id
+}
+
+// gzipBytes 使用 gzip 压缩数据
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ReportPaths 上报底层路径数据，不重试，下一个采集周期会再次上报
+func (c *Client) ReportPaths(report *models.PathReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal path report: %w", err)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
 
-	url := fmt.Sprintf("%s/api/v1/routes?agent_id=%s", c.baseURL, agentID)
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v1/paths", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	requestID := setRequestID(httpReq)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to report paths: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body) //nolint:errcheck
+		return fmt.Errorf("path report %s failed with status %d: %s", requestID, resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// GetPeers 获取同租户其他 Agent 的隧道地址，不重试，下一个拉取周期会再次请求
+// 租户尚不存在（还没有任何 Agent 上报过遥测）时返回空列表
+func (c *Client) GetPeers(agentID string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/v1/peers?"+c.routesQuery(agentID), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	requestID := setRequestID(httpReq)
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get peers: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return []string{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body) //nolint:errcheck
+		return nil, fmt.Errorf("peers request %s failed with status %d: %s", requestID, resp.StatusCode, string(body))
+	}
+
+	var peers models.PeersResponse
+	if err := json.NewDecoder(resp.Body).Decode(&peers); err != nil {
+		return nil, fmt.Errorf("failed to decode peers: %w", err)
+	}
+	return peers.Peers, nil
+}
+
+// GetRoutes 增量获取路由：只返回版本号大于 since 的路由
+// since 为 0 时返回完整路由集；没有变化时返回空路由列表，Version 保持不变
+func (c *Client) GetRoutes(agentID string, since uint64) (*models.RouteResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	version := "v1"
+	if c.protobuf {
+		version = "v2"
+	}
+	endpoint := fmt.Sprintf("%s/api/%s/routes?%s&since=%d", c.baseURL, version, c.routesQuery(agentID), since)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	requestID := setRequestID(httpReq)
+	if c.protobuf {
+		httpReq.Header.Set("Accept", models.ContentTypeProtobuf)
+	}
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
@@ -85,16 +234,34 @@ func (c *Client) GetRoutes(agentID string) (*models.RouteResponse, error) {
 	if resp.StatusCode == http.StatusNotFound {
 		return nil, models.ErrAgentNotFound
 	}
+	if resp.StatusCode == http.StatusGone {
+		return nil, models.ErrAgentStale
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		return &models.RouteResponse{Routes: []models.RouteConfig{}, Version: since}, nil
+	}
 
 	if resp.StatusCode != http.StatusOK {
 		body, readErr := io.ReadAll(resp.Body)
 		if readErr != nil {
-			return nil, fmt.Errorf("routes request failed with status %d", resp.StatusCode)
+			return nil, fmt.Errorf("routes request %s failed with status %d", requestID, resp.StatusCode)
 		}
-		return nil, fmt.Errorf("routes request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("routes request %s failed with status %d: %s", requestID, resp.StatusCode, string(body))
 	}
 
 	var routes models.RouteResponse
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), models.ContentTypeProtobuf) {
+		data, readErr := io.ReadAll(resp.Body)
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to read routes: %w", readErr)
+		}
+		if err := routes.UnmarshalProto(data); err != nil {
+			return nil, fmt.Errorf("failed to decode routes: %w", err)
+		}
+		return &routes, nil
+	}
+
 	if err := json.NewDecoder(resp.Body).Decode(&routes); err != nil {
 		return nil, fmt.Errorf("failed to decode routes: %w", err)
 	}
@@ -102,6 +269,76 @@ func (c *Client) GetRoutes(agentID string) (*models.RouteResponse, error) {
 	return &routes, nil
 }
 
+// StreamRoutes 订阅 Controller 的路由推送流（Server-Sent Events）
+// 每收到一次路由更新调用 onRoutes，直到连接断开或 ctx 被取消
+func (c *Client) StreamRoutes(ctx context.Context, agentID string, onRoutes func(*models.RouteResponse)) error {
+	endpoint := fmt.Sprintf("%s/api/v1/routes/stream?%s", c.baseURL, c.routesQuery(agentID))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	requestID := setRequestID(httpReq)
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.streamClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to open route stream: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return models.ErrAgentNotFound
+	}
+	if resp.StatusCode == http.StatusGone {
+		return models.ErrAgentStale
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("route stream request %s failed with status %d", requestID, resp.StatusCode)
+	}
+
+	return readRouteEvents(resp.Body, onRoutes)
+}
+
+// readRouteEvents 解析 SSE 流，将 "routes" 事件解码后交给 onRoutes
+func readRouteEvents(r io.Reader, onRoutes func(*models.RouteResponse)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamEventSize)
+
+	var event string
+	var data strings.Builder
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			// 空行表示事件结束
+			if event == "routes" && data.Len() > 0 {
+				var routes models.RouteResponse
+				if err := json.Unmarshal([]byte(data.String()), &routes); err != nil {
+					return fmt.Errorf("failed to decode route event: %w", err)
+				}
+				onRoutes(&routes)
+			}
+			event = ""
+			data.Reset()
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("route stream read failed: %w", err)
+	}
+	return io.EOF
+}
+
 // CheckHealth 检查 Controller 健康状态
 func (c *Client) CheckHealth() error {
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
@@ -112,6 +349,7 @@ func (c *Client) CheckHealth() error {
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
+	requestID := setRequestID(httpReq)
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
@@ -120,7 +358,7 @@ func (c *Client) CheckHealth() error {
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+		return fmt.Errorf("health check %s returned status %d", requestID, resp.StatusCode)
 	}
 
 	return nil
@@ -191,7 +429,7 @@ func (rc *RetryClient) SendTelemetryWithRetry(req *models.TelemetryRequest) erro
 }
 
 // GetRoutesWithRetry 带重试的获取路由
-func (rc *RetryClient) GetRoutesWithRetry(agentID string) (*models.RouteResponse, error) {
+func (rc *RetryClient) GetRoutesWithRetry(agentID string, since uint64) (*models.RouteResponse, error) {
 	var lastErr error
 
 	for attempt := 0; attempt <= rc.maxRetries; attempt++ {
@@ -205,7 +443,7 @@ func (rc *RetryClient) GetRoutesWithRetry(agentID string) (*models.RouteResponse
 			time.Sleep(time.Duration(backoff) * time.Second)
 		}
 
-		routes, err := rc.client.GetRoutes(agentID)
+		routes, err := rc.client.GetRoutes(agentID, since)
 		if err == nil {
 			rc.failureCount = 0
 			if rc.inFallback {
@@ -226,6 +464,34 @@ func (rc *RetryClient) GetRoutesWithRetry(agentID string) (*models.RouteResponse
 	return nil, lastErr
 }
 
+// SubscribeRoutes 持续订阅路由推送流，连接断开后按 backoff 重连
+// 阻塞直到 ctx 被取消
+func (rc *RetryClient) SubscribeRoutes(ctx context.Context, agentID string, onRoutes func(*models.RouteResponse)) error {
+	attempt := 0
+	for {
+		err := rc.client.StreamRoutes(ctx, agentID, func(routes *models.RouteResponse) {
+			attempt = 0
+			onRoutes(routes)
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		backoff := rc.backoffSecs[min(attempt, len(rc.backoffSecs)-1)]
+		rc.logger.Warn("Route stream disconnected",
+			logging.F("error", err.Error()),
+			logging.F("backoff_secs", backoff),
+		)
+		attempt++
+
+		select {
+		case <-time.After(time.Duration(backoff) * time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
 // ShouldEnterFallback 检查是否应该进入 fallback 模式
 func (rc *RetryClient) ShouldEnterFallback() bool {
 	return rc.failureCount >= rc.maxRetries && !rc.inFallback
@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+func TestReadRouteEvents(t *testing.T) {
+	stream := strings.Join([]string{
+		"event:routes",
+		`data:{"routes":[{"dst_cidr":"10.254.0.3/32","next_hop":"10.254.0.2","reason":"optimized_path"}]}`,
+		"",
+		"event:ping",
+		`data:{"time":1}`,
+		"",
+		// 多行 data 按换行拼接
+		"event: routes",
+		`data: {"routes":`,
+		`data: []}`,
+		"",
+		"",
+	}, "\n")
+
+	var got []*models.RouteResponse
+	err := readRouteEvents(strings.NewReader(stream), func(r *models.RouteResponse) {
+		got = append(got, r)
+	})
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("readRouteEvents() error = %v, want io.EOF", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Got %d route events, want 2 (ping ignored)", len(got))
+	}
+	if len(got[0].Routes) != 1 || got[0].Routes[0].NextHop != "10.254.0.2" {
+		t.Errorf("First event = %+v", got[0])
+	}
+	if len(got[1].Routes) != 0 {
+		t.Errorf("Second event = %+v, want empty routes", got[1])
+	}
+}
+
+func TestReadRouteEventsInvalidJSON(t *testing.T) {
+	stream := "event:routes\ndata:{not json\n\n"
+	err := readRouteEvents(strings.NewReader(stream), func(*models.RouteResponse) {
+		t.Error("onRoutes should not be called for an invalid event")
+	})
+	if err == nil || errors.Is(err, io.EOF) {
+		t.Errorf("readRouteEvents() error = %v, want decode error", err)
+	}
+}
+
+func TestStreamRoutes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/routes/stream" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Query().Get("agent_id") {
+		case "gone":
+			w.WriteHeader(http.StatusGone)
+			return
+		case "unknown":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Accept") != "text/event-stream" {
+			t.Errorf("Accept = %q, want text/event-stream", r.Header.Get("Accept"))
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "event:routes\ndata:{\"routes\":[{\"dst_cidr\":\"10.254.0.3/32\",\"next_hop\":\"direct\",\"reason\":\"default\"}]}\n\n")
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 0)
+
+	var got []*models.RouteResponse
+	err := client.StreamRoutes(context.Background(), "10.254.0.1", func(r *models.RouteResponse) {
+		got = append(got, r)
+	})
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("StreamRoutes() error = %v, want io.EOF after server closes", err)
+	}
+	if len(got) != 1 || got[0].Routes[0].DstCIDR != "10.254.0.3/32" {
+		t.Errorf("Received %+v, want one route event", got)
+	}
+
+	noop := func(*models.RouteResponse) {}
+	if err := client.StreamRoutes(context.Background(), "unknown", noop); !errors.Is(err, models.ErrAgentNotFound) {
+		t.Errorf("StreamRoutes(unknown) error = %v, want ErrAgentNotFound", err)
+	}
+	if err := client.StreamRoutes(context.Background(), "gone", noop); !errors.Is(err, models.ErrAgentStale) {
+		t.Errorf("StreamRoutes(gone) error = %v, want ErrAgentStale", err)
+	}
+}
@@ -1,10 +1,11 @@
 package agent
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"net"
-	"os/exec"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -16,12 +17,51 @@ import (
 // commandTimeout is the default timeout for route commands
 const commandTimeout = 10 * time.Second
 
+// ErrRelayDepthExceeded 路由经过的中继层数超过 network.max_relay_depth
+var ErrRelayDepthExceeded = errors.New("relay depth exceeds network.max_relay_depth")
+
+// RouteExecutor Agent 使用的路由执行器，负责把 Controller 下发的路由变更落到本机
+// 默认实现是操作内核路由表的 Executor（netlink 或 ip 命令），也可以换成其他平台的实现或测试用的模拟实现
+type RouteExecutor interface {
+	// InstallRule 在安装路由之前准备转发环境，例如把子网引向专用路由表的 ip rule
+	InstallRule() error
+	// SyncRoutes 应用一批路由变更，单条失败不影响其他路由，但会返回错误
+	SyncRoutes(desired []models.RouteConfig) error
+	// ApplyRoute 应用单条路由变更，用于本地故障切换
+	ApplyRoute(route models.RouteConfig) error
+	// SyncClassRoutes 将流量类别的完整路由快照同步到路由表 table
+	SyncClassRoutes(table int, desired []models.RouteConfig) error
+	// FlushRoutes 删除所有中继路由，流量恢复直连，进入 fallback 时调用
+	FlushRoutes() error
+	// GetCurrentRoutes 返回当前生效的、允许的子网内的路由
+	GetCurrentRoutes() ([]CurrentRoute, error)
+	// ManagedRouteCount 返回当前管理的路由数量
+	ManagedRouteCount() int
+	// PurgeStaleRoutes 清理上次运行遗留的路由，启动时调用
+	PurgeStaleRoutes(classTables []int) (int, []error)
+	// CleanupManagedRoutes 删除由 Agent 安装的所有路由，退出时调用，返回删除的数量和遇到的错误
+	CleanupManagedRoutes() (int, []error)
+	// Close 释放执行器持有的资源
+	Close()
+}
+
 // Executor 路由执行器
 type Executor struct {
 	wgInterface   string
-	subnet        *net.IPNet
+	subnets       []*net.IPNet // 允许的隧道子网，双栈时 IPv4 和 IPv6 各一个
+	prefixes      []*net.IPNet // 隧道子网之外允许作为目的地的前缀，例如对端后方的分支子网
 	mu            sync.Mutex
-	managedRoutes map[string]string // dst -> nextHop, 记录由 Agent 管理的路由
+	managedRoutes map[string]string         // dst -> nextHop, 记录由 Agent 管理的路由
+	routeMetrics  map[string]uint32         // dst -> 安装 managedRoutes 中路由时使用的 metric
+	classRoutes   map[int]map[string]string // table -> dst -> nextHop, 流量类别路由表中由 Agent 管理的路由
+	maxRelayDepth int                       // 允许安装的最大中继层数，0 表示不限
+	table         int                       // 中继路由所在的路由表，0 表示主路由表
+	rulePriority  int                       // table 非 0 时把子网引向该表的 ip rule 的优先级
+	metric        uint32                    // 路由未指定 metric 时使用的默认值，0 表示由内核决定
+	protocol      uint8                     // 安装路由时标记的协议号，用于识别 Agent 安装的路由，0 表示不标记
+	backend       routeBackend              // 为 nil 时执行 ip 命令，见 SetRouteBackend
+	onChange      []func(RouteChange)       // 路由变更回调，见 OnRouteChange
+	changeReason  string                    // 当前变更的原因，随 RouteChange 通知回调
 	logger        logging.Logger
 }
 
@@ -43,12 +83,197 @@ func NewExecutorWithLogger(wgInterface, subnet string, logger logging.Logger) (*
 
 	return &Executor{
 		wgInterface:   wgInterface,
-		subnet:        ipNet,
+		subnets:       []*net.IPNet{ipNet},
 		managedRoutes: make(map[string]string),
+		routeMetrics:  make(map[string]uint32),
+		classRoutes:   make(map[int]map[string]string),
 		logger:        logger,
 	}, nil
 }
 
+// AddSubnet 增加一个允许的子网，用于双栈部署中 IPv4 子网之外的 IPv6 子网（或反之）
+func (e *Executor) AddSubnet(subnet string) error {
+	_, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return fmt.Errorf("invalid subnet: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.subnets = append(e.subnets, ipNet)
+	return nil
+}
+
+// AddRoutedPrefix 增加一个允许作为路由目的地的前缀，例如某个 Agent 后方的分支子网
+// 前缀本身不能作为下一跳，下一跳始终必须在隧道子网内
+func (e *Executor) AddRoutedPrefix(prefix string) error {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return fmt.Errorf("invalid routed prefix: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.prefixes = append(e.prefixes, ipNet)
+	return nil
+}
+
+// subnetString 返回允许的子网列表，用于错误信息
+func (e *Executor) subnetString() string {
+	names := make([]string, len(e.subnets))
+	for i, subnet := range e.subnets {
+		names[i] = subnet.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// families 返回允许的子网涉及的地址族，IPv6 为 true
+func (e *Executor) families() []bool {
+	var v4, v6 bool
+	for _, subnet := range e.subnets {
+		if subnet.IP.To4() != nil {
+			v4 = true
+		} else {
+			v6 = true
+		}
+	}
+	var families []bool
+	if v4 {
+		families = append(families, false)
+	}
+	if v6 {
+		families = append(families, true)
+	}
+	return families
+}
+
+// SetMaxRelayDepth 设置允许安装的最大中继层数，0 表示不限
+// 本机只能安装到第一个中继的路由，更深的路径依赖后续中继各自的路由，部署不允许时用此限制显式拒绝
+func (e *Executor) SetMaxRelayDepth(depth int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.maxRelayDepth = depth
+}
+
+// SetRouteTable 设置中继路由安装到的路由表及对应 ip rule 的优先级，table 为 0 表示主路由表
+// 需在安装路由之前调用；使用专用路由表时由 InstallRule 添加规则，表中没有的目的地回落到主路由表
+func (e *Executor) SetRouteTable(table, priority int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.table = table
+	e.rulePriority = priority
+}
+
+// SetRouteMetric 设置中继路由的默认 metric，RouteConfig.Metric 非 0 时以其为准
+// 内核按目的地和 metric 区分路由：同一目的地的静态路由或 DHCP 路由 metric 不同时不会被替换，按 metric 决定优先级
+func (e *Executor) SetRouteMetric(metric uint32) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.metric = metric
+}
+
+// routeMetric 返回安装路由时使用的 metric，调用方需持有 e.mu
+func (e *Executor) routeMetric(route models.RouteConfig) uint32 {
+	if route.Metric != 0 {
+		return route.Metric
+	}
+	return e.metric
+}
+
+// withMetric 在 metric 非 0 时给 ip route 命令加上 metric 参数
+// ip 命令要求 nexthop 之后只能是下一跳的参数，多路径路由的 metric 插在第一个 nexthop 之前
+func withMetric(args []string, metric uint32) []string {
+	if metric == 0 {
+		return args
+	}
+	opt := []string{"metric", strconv.FormatUint(uint64(metric), 10)}
+	if i := slices.Index(args, "nexthop"); i >= 0 {
+		return slices.Insert(args, i, opt...)
+	}
+	return append(args, opt...)
+}
+
+// SetRouteProtocol 设置安装路由时标记的协议号（ip route 的 proto），0 表示不标记（内核记为 boot）
+// 内核中带有该协议号的路由都由 Agent 安装，进程异常退出后重启时据此清理遗留的路由，见 PurgeStaleRoutes
+func (e *Executor) SetRouteProtocol(protocol uint8) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.protocol = protocol
+}
+
+// withProtocol 在设置了协议号时给 ip route 命令追加 proto 参数，多路径路由需在追加 nexthop 之前调用
+func (e *Executor) withProtocol(args []string) []string {
+	if e.protocol == 0 {
+		return args
+	}
+	return append(args, "proto", strconv.Itoa(int(e.protocol)))
+}
+
+// withTable 在使用专用路由表时给 ip route 命令追加 table 参数
+func (e *Executor) withTable(args []string) []string {
+	if e.table == 0 {
+		return args
+	}
+	return append(args, "table", strconv.Itoa(e.table))
+}
+
+// GenerateRuleCommand 生成添加或删除（op 为 add 或 del）把子网引向专用路由表的 ip rule 命令
+// 与 ip route 不同，ip rule 不根据地址推断地址族，IPv6 子网需要 -6
+func (e *Executor) GenerateRuleCommand(op string, subnet *net.IPNet) []string {
+	args := []string{"ip", "rule", op}
+	if subnet.IP.To4() == nil {
+		args = []string{"ip", "-6", "rule", op}
+	}
+	return append(args,
+		"to", subnet.String(),
+		"lookup", strconv.Itoa(e.table),
+		"priority", strconv.Itoa(e.rulePriority),
+	)
+}
+
+// ruleDsts 返回需要引向专用路由表的前缀：隧道子网和 routed_prefixes
+func (e *Executor) ruleDsts() []*net.IPNet {
+	return append(append([]*net.IPNet(nil), e.subnets...), e.prefixes...)
+}
+
+// InstallRule 为每个允许的子网和前缀添加引向专用路由表的 ip rule，使用主路由表时不做任何事
+// 先删除相同的规则，Agent 重启或多次调用时不会留下重复的规则
+func (e *Executor) InstallRule() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.table == 0 {
+		return nil
+	}
+	for _, subnet := range e.ruleDsts() {
+		if err := e.runRouteCommand(e.GenerateRuleCommand("del", subnet)); err != nil && !errors.Is(err, errRouteNotFound) {
+			return err
+		}
+		args := e.GenerateRuleCommand("add", subnet)
+		e.logger.Info("Adding routing rule", logging.F("command", strings.Join(args, " ")))
+		if err := e.runRouteCommand(args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRelays 检查路由的中继列表：第一个中继必须是下一跳，层数不超过 maxRelayDepth，调用方需持有 e.mu
+func (e *Executor) checkRelays(route models.RouteConfig) error {
+	relays := route.Relays()
+	if len(relays) == 0 {
+		return nil
+	}
+	if relays[0] != route.NextHop {
+		return fmt.Errorf("path %s does not start with next_hop %s", strings.Join(route.Path, " -> "), route.NextHop)
+	}
+	if e.maxRelayDepth > 0 && len(relays) > e.maxRelayDepth {
+		return fmt.Errorf("%w: %d relays (%s), limit %d", ErrRelayDepthExceeded,
+			len(relays), strings.Join(relays, ", "), e.maxRelayDepth)
+	}
+	return nil
+}
+
 // CurrentRoute 当前路由信息
 type CurrentRoute struct {
 	Destination string
@@ -60,227 +285,376 @@ func (e *Executor) GetCurrentRoutes() ([]CurrentRoute, error) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, "ip", "route", "show", "table", "main")
-	output, err := cmd.Output()
+	current, err := e.listAllRoutes(e.table)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get routes: %w", err)
+		return nil, err
 	}
 
 	routes := make([]CurrentRoute, 0)
-	lines := strings.Split(string(output), "\n")
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
+	for _, r := range current {
+		// 只处理 WireGuard 接口上（或黑洞）、允许的子网内的路由
+		if (r.dev != e.wgInterface && !r.blackhole) || !e.isInSubnet(r.dst) {
 			continue
 		}
-
-		// 只处理 WireGuard 接口的路由
-		if !strings.Contains(line, e.wgInterface) {
+		if r.blackhole {
+			routes = append(routes, CurrentRoute{Destination: r.dst, NextHop: "blackhole"})
 			continue
 		}
+		routes = append(routes, CurrentRoute{Destination: r.dst, NextHop: r.via})
+	}
 
-		parts := strings.Fields(line)
-		if len(parts) < 1 {
-			continue
-		}
+	return routes, nil
+}
 
-		dst := parts[0]
+// isInSubnet 检查内核路由的目的地（ip route show 的格式）是否完整落在允许的子网或前缀内
+func (e *Executor) isInSubnet(dst string) bool {
+	ipNet, err := parseRouteDst(dst)
+	if err != nil {
+		return false
+	}
+	return e.allowedDst(ipNet)
+}
 
-		// 检查是否在允许的子网内
-		if !e.isInSubnet(dst) {
-			continue
+// allowedDst 检查目的地前缀是否完整落在某个允许的子网或前缀内
+func (e *Executor) allowedDst(dst *net.IPNet) bool {
+	for _, list := range [][]*net.IPNet{e.subnets, e.prefixes} {
+		for _, outer := range list {
+			if containsPrefix(outer, dst) {
+				return true
+			}
 		}
+	}
+	return false
+}
 
-		route := CurrentRoute{Destination: dst}
+// containsPrefix 检查 inner 是否是 outer 本身或其子前缀
+func containsPrefix(outer, inner *net.IPNet) bool {
+	outerOnes, outerBits := outer.Mask.Size()
+	innerOnes, innerBits := inner.Mask.Size()
+	return outerBits == innerBits && outerOnes <= innerOnes && outer.Contains(inner.IP)
+}
 
-		// 查找 via 关键字
-		for i, p := range parts {
-			if p == "via" && i+1 < len(parts) {
-				route.NextHop = parts[i+1]
-				break
-			}
-		}
+// parseDstCIDR 解析路由目的地：任意前缀长度的 CIDR，或单个地址（视为主机路由）
+// 拒绝主机位不为 0 的 CIDR（例如 10.20.0.5/24），避免与 ip route 对前缀的归一化不一致
+func parseDstCIDR(dstCIDR string) (*net.IPNet, error) {
+	dst, err := parseRouteDst(dstCIDR)
+	if err != nil {
+		return nil, err
+	}
+	if ip, _, _ := net.ParseCIDR(dstCIDR); ip != nil && !ip.Equal(dst.IP) {
+		return nil, fmt.Errorf("destination %s has host bits set, expected %s", dstCIDR, dst)
+	}
+	return dst, nil
+}
 
-		routes = append(routes, route)
+// checkDst 解析路由目的地并检查其完整落在允许的子网或前缀内
+func (e *Executor) checkDst(dstCIDR string) (*net.IPNet, error) {
+	dst, err := parseDstCIDR(dstCIDR)
+	if err != nil {
+		return nil, err
+	}
+	if !e.allowedDst(dst) {
+		return nil, fmt.Errorf("destination %s is not in allowed subnet %s", dstCIDR, e.allowedString())
 	}
+	return dst, nil
+}
 
-	return routes, nil
+// checkNextHop 检查下一跳在隧道子网内，且与目的地属于同一地址族
+func (e *Executor) checkNextHop(nextHop string, dst *net.IPNet) error {
+	if !e.ValidateIP(nextHop) {
+		return fmt.Errorf("next_hop %s is not in allowed subnet %s", nextHop, e.subnetString())
+	}
+	if (net.ParseIP(nextHop).To4() == nil) != (dst.IP.To4() == nil) {
+		return fmt.Errorf("next_hop %s and destination %s are in different address families", nextHop, dst)
+	}
+	return nil
 }
 
-// isInSubnet 检查 IP 是否在允许的子网内
-func (e *Executor) isInSubnet(dst string) bool {
-	// 移除 CIDR 后缀
-	ip := strings.Split(dst, "/")[0]
-	parsedIP := net.ParseIP(ip)
-	if parsedIP == nil {
-		return false
+// allowedString 返回允许的子网和前缀列表，用于错误信息
+func (e *Executor) allowedString() string {
+	names := e.subnetString()
+	for _, prefix := range e.prefixes {
+		names += ", " + prefix.String()
 	}
-	return e.subnet.Contains(parsedIP)
+	return names
 }
 
-// ValidateIP 验证 IP 是否在允许的子网内
+// ValidateIP 验证 IP 是否在允许的子网内，IPv4 地址只匹配 IPv4 子网，IPv6 地址只匹配 IPv6 子网
 func (e *Executor) ValidateIP(ip string) bool {
 	parsedIP := net.ParseIP(ip)
 	if parsedIP == nil {
 		return false
 	}
-	return e.subnet.Contains(parsedIP)
+	for _, subnet := range e.subnets {
+		if subnet.Contains(parsedIP) {
+			return true
+		}
+	}
+	return false
+}
+
+// routeDst 返回 ip route 命令中的目的地：单个地址补全为主机路由前缀，CIDR 原样返回
+func routeDst(dst string) string {
+	if strings.Contains(dst, "/") {
+		return dst
+	}
+	return models.HostCIDR(dst)
 }
 
-// GenerateAddCommand 生成添加/替换路由的命令
-func (e *Executor) GenerateAddCommand(dstIP, nextHop string) []string {
-	return []string{
+// hostAddr 返回主机路由目的地（IPv4 /32 或 IPv6 /128）中的地址，其他前缀原样返回
+func hostAddr(dstCIDR string) string {
+	ip, ipNet, err := net.ParseCIDR(dstCIDR)
+	if err != nil {
+		return dstCIDR
+	}
+	if ones, bits := ipNet.Mask.Size(); ones != bits {
+		return dstCIDR
+	}
+	return ip.String()
+}
+
+// GenerateAddCommand 生成添加/替换路由的命令，dst 为 CIDR 或单个地址（主机路由）
+func (e *Executor) GenerateAddCommand(dst, nextHop string) []string {
+	return e.withProtocol(e.withTable([]string{
 		"ip", "route", "replace",
-		dstIP + "/32",
+		routeDst(dst),
 		"via", nextHop,
 		"dev", e.wgInterface,
+	}))
+}
+
+// GenerateMultipathCommand 生成添加/替换多路径（ECMP）路由的命令，weights 为空表示等权
+func (e *Executor) GenerateMultipathCommand(dst string, nextHops []string, weights []int) []string {
+	args := e.withProtocol(e.withTable([]string{"ip", "route", "replace", routeDst(dst)}))
+	for i, hop := range nextHops {
+		weight := 1
+		if i < len(weights) && weights[i] > 0 {
+			weight = weights[i]
+		}
+		args = append(args, "nexthop", "via", hop, "dev", e.wgInterface, "weight", strconv.Itoa(weight))
+	}
+	return args
+}
+
+// checkNextHops 检查 ECMP 下一跳集合：第一个为 NextHop、没有重复，权重与下一跳一一对应且在 1-256 之间
+func (e *Executor) checkNextHops(route models.RouteConfig, dst *net.IPNet) error {
+	if route.NextHops[0] != route.NextHop {
+		return fmt.Errorf("next_hops %v does not start with next_hop %s", route.NextHops, route.NextHop)
+	}
+	seen := make(map[string]bool, len(route.NextHops))
+	for _, hop := range route.NextHops {
+		if seen[hop] {
+			return fmt.Errorf("duplicate next hop %s in next_hops", hop)
+		}
+		seen[hop] = true
+		if err := e.checkNextHop(hop, dst); err != nil {
+			return err
+		}
+	}
+	if len(route.Weights) != 0 && len(route.Weights) != len(route.NextHops) {
+		return fmt.Errorf("%d weights for %d next hops", len(route.Weights), len(route.NextHops))
+	}
+	for _, w := range route.Weights {
+		if w < 1 || w > 256 {
+			return fmt.Errorf("weight %d out of range [1, 256]", w)
+		}
+	}
+	return nil
+}
+
+// GenerateBlackholeCommand 生成添加/替换黑洞路由的命令，dst 为 CIDR 或单个地址（主机路由）
+func (e *Executor) GenerateBlackholeCommand(dst string) []string {
+	return e.withProtocol(e.withTable([]string{"ip", "route", "replace", "blackhole", routeDst(dst)}))
+}
+
+// GenerateBlackholeDelCommand 生成删除黑洞路由的命令，黑洞路由没有出接口，按类型匹配
+func (e *Executor) GenerateBlackholeDelCommand(dst string) []string {
+	return e.withTable([]string{"ip", "route", "del", "blackhole", routeDst(dst)})
+}
+
+// managedDelCommand 按 managedRoutes 中记录的下一跳生成删除 dstCIDR 路由的命令（不含 metric），调用方需持有 e.mu
+func (e *Executor) managedDelCommand(dstCIDR string) []string {
+	if e.managedRoutes[dstCIDR] == "blackhole" {
+		return e.GenerateBlackholeDelCommand(dstCIDR)
 	}
+	return e.GenerateDelCommand(dstCIDR)
 }
 
-// GenerateDelCommand 生成删除路由的命令
-func (e *Executor) GenerateDelCommand(dstIP string) []string {
-	return []string{
+// replaceMetricLocked metric 变化时 replace 会新增一条路由而不是替换原来的，先删除按旧 metric 安装的路由，调用方需持有 e.mu
+func (e *Executor) replaceMetricLocked(dstCIDR string, metric uint32) error {
+	installed, ok := e.routeMetrics[dstCIDR]
+	if !ok || installed == metric {
+		return nil
+	}
+	args := withMetric(e.managedDelCommand(dstCIDR), installed)
+	if err := e.runRouteCommand(args); err != nil && !errors.Is(err, errRouteNotFound) {
+		return err
+	}
+	delete(e.managedRoutes, dstCIDR)
+	delete(e.routeMetrics, dstCIDR)
+	return nil
+}
+
+// GenerateDelCommand 生成删除路由的命令，dst 为 CIDR 或单个地址（主机路由）
+func (e *Executor) GenerateDelCommand(dst string) []string {
+	return e.withTable([]string{
 		"ip", "route", "del",
-		dstIP + "/32",
+		routeDst(dst),
 		"dev", e.wgInterface,
-	}
+	})
 }
 
 // ApplyRoute 应用单条路由
 func (e *Executor) ApplyRoute(route models.RouteConfig) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	e.changeReason = route.Reason
 
-	// 提取目标 IP
-	dstIP := strings.TrimSuffix(route.DstCIDR, "/32")
-
-	// 安全检查
-	if !e.ValidateIP(dstIP) {
-		return fmt.Errorf("IP %s is not in allowed subnet %s", dstIP, e.subnet.String())
+	// 安全检查：目的地可以是任意前缀，但必须完整落在允许的子网或前缀内
+	dst, err := e.checkDst(route.DstCIDR)
+	if err != nil {
+		return err
 	}
 
 	var args []string
-	if route.NextHop == "direct" {
-		// 删除中继路由，恢复直连
-		args = e.GenerateDelCommand(dstIP)
+	metric := e.routeMetric(route)
+	switch route.NextHop {
+	case "direct":
+		// 删除中继路由或黑洞路由，恢复直连；按安装时的 metric 删除，不影响同一目的地的其他路由
+		if installed, ok := e.routeMetrics[route.DstCIDR]; ok {
+			metric = installed
+		}
+		args = withMetric(e.managedDelCommand(route.DstCIDR), metric)
 		e.logger.Info("Removing relay route",
 			logging.F("command", strings.Join(args, " ")),
-			logging.F("dst_ip", dstIP),
+			logging.F("dst_cidr", dst.String()),
 		)
-	} else {
+	case "blackhole":
+		// 丢弃发往目的地的流量，而不是走已失效的直连路径等到超时
+		if err := e.replaceMetricLocked(route.DstCIDR, metric); err != nil {
+			return err
+		}
+		args = withMetric(e.GenerateBlackholeCommand(dst.String()), metric)
+		e.logger.Info("Adding blackhole route",
+			logging.F("command", strings.Join(args, " ")),
+			logging.F("dst_cidr", dst.String()),
+			logging.F("reason", route.Reason),
+		)
+	default:
 		// 添加/替换中继路由
-		if !e.ValidateIP(route.NextHop) {
-			return fmt.Errorf("next_hop %s is not in allowed subnet %s", route.NextHop, e.subnet.String())
+		if err := e.checkNextHop(route.NextHop, dst); err != nil {
+			return err
+		}
+		multipath := len(route.NextHops) > 1
+		if multipath {
+			if err := e.checkNextHops(route, dst); err != nil {
+				return err
+			}
+		}
+		if err := e.checkRelays(route); err != nil {
+			return err
+		}
+		if err := e.replaceMetricLocked(route.DstCIDR, metric); err != nil {
+			return err
+		}
+		if multipath {
+			args = withMetric(e.GenerateMultipathCommand(dst.String(), route.NextHops, route.Weights), metric)
+		} else {
+			args = withMetric(e.GenerateAddCommand(dst.String(), route.NextHop), metric)
 		}
-		args = e.GenerateAddCommand(dstIP, route.NextHop)
 		e.logger.Info("Adding relay route",
 			logging.F("command", strings.Join(args, " ")),
-			logging.F("dst_ip", dstIP),
+			logging.F("dst_cidr", dst.String()),
 			logging.F("next_hop", route.NextHop),
+			logging.F("metric", metric),
+			logging.F("path", strings.Join(route.Path, " -> ")),
+			logging.F("cost_ms", route.CostMs),
 		)
 	}
 
-	// #nosec G204 - args are validated above via ValidateIP
-	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, args[0], args[1:]...) //nolint:gosec
-	output, err := cmd.CombinedOutput()
-	if err != nil {
+	if err := e.runRouteCommand(args); err != nil {
 		// 删除不存在的路由不算错误
-		if route.NextHop == "direct" && strings.Contains(string(output), "No such process") {
+		if route.NextHop == "direct" && errors.Is(err, errRouteNotFound) {
 			// 从 managedRoutes 中移除
 			delete(e.managedRoutes, route.DstCIDR)
+			delete(e.routeMetrics, route.DstCIDR)
 			return nil
 		}
-		return fmt.Errorf("route command failed: %s, output: %s", err, string(output))
+		return err
 	}
 
 	// 更新 managedRoutes
 	if route.NextHop == "direct" {
 		delete(e.managedRoutes, route.DstCIDR)
+		delete(e.routeMetrics, route.DstCIDR)
 	} else {
 		e.managedRoutes[route.DstCIDR] = route.NextHop
+		e.routeMetrics[route.DstCIDR] = metric
 	}
 
 	return nil
 }
 
-// SyncRoutes 同步路由配置
+// SyncRoutes 同步路由配置，单条失败时继续处理其他路由，返回所有失败路由的合并错误
 func (e *Executor) SyncRoutes(desired []models.RouteConfig) error {
+	var errs []error
 	for _, route := range desired {
 		if err := e.ApplyRoute(route); err != nil {
 			e.logger.Error("Failed to apply route",
 				logging.F("dst_cidr", route.DstCIDR),
 				logging.F("error", err.Error()),
 			)
-			// 继续处理其他路由
+			errs = append(errs, fmt.Errorf("route %s: %w", route.DstCIDR, err))
 		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 // FlushRoutes 清空所有动态添加的路由
 func (e *Executor) FlushRoutes() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	e.changeReason = changeReasonFallback
 
 	e.logger.Info("Flushing all dynamic routes",
 		logging.F("interface", e.wgInterface),
 	)
 
 	// 获取当前路由
-	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, "ip", "route", "show", "table", "main")
-	output, err := cmd.Output()
+	current, err := e.listAllRoutes(e.table)
 	if err != nil {
-		return fmt.Errorf("failed to get routes: %w", err)
+		return err
 	}
 
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-
-		// 只处理有 via 的路由（中继路由）
-		if !strings.Contains(line, e.wgInterface) || !strings.Contains(line, "via") {
-			continue
-		}
-
-		parts := strings.Fields(line)
-		if len(parts) < 1 {
+	for _, r := range current {
+		// 只处理有 via 的路由（中继路由）和黑洞路由，fallback 期间流量恢复直连
+		var args []string
+		switch {
+		case !e.isInSubnet(r.dst):
 			continue
-		}
-
-		dst := parts[0]
-		if !e.isInSubnet(dst) {
+		case r.blackhole:
+			args = e.GenerateBlackholeDelCommand(r.dst)
+		case r.dev == e.wgInterface && r.via != "":
+			args = e.withTable([]string{"ip", "route", "del", r.dst, "dev", e.wgInterface})
+		default:
 			continue
 		}
 
 		// 删除路由
-		delCtx, delCancel := context.WithTimeout(context.Background(), commandTimeout)
-		delCmd := exec.CommandContext(delCtx, "ip", "route", "del", dst, "dev", e.wgInterface) //nolint:gosec
-		if delErr := delCmd.Run(); delErr != nil {
+		args = withMetric(args, r.metric)
+		if delErr := e.runRouteCommand(args); delErr != nil {
 			e.logger.Error("Failed to delete route",
-				logging.F("dst", dst),
+				logging.F("dst", r.dst),
 				logging.F("error", delErr.Error()),
 			)
 		} else {
 			e.logger.Info("Deleted route",
-				logging.F("dst", dst),
+				logging.F("dst", r.dst),
 			)
 		}
-		delCancel()
 	}
 
+	e.flushClassTablesLocked()
 	return nil
 }
 
@@ -345,38 +719,108 @@ func (e *Executor) GetManagedRoutes() map[string]string {
 func (e *Executor) CleanupManagedRoutes() (int, []error) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	e.changeReason = changeReasonShutdown
 
-	var errors []error
+	var errs []error
 	cleaned := 0
 
 	for dst := range e.managedRoutes {
-		dstIP := strings.TrimSuffix(dst, "/32")
-		args := e.GenerateDelCommand(dstIP)
+		args := withMetric(e.managedDelCommand(dst), e.routeMetrics[dst])
 
 		e.logger.Info("Cleaning up managed route",
 			logging.F("command", strings.Join(args, " ")),
 			logging.F("dst", dst),
 		)
 
-		// #nosec G204 - args are generated internally
-		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
-		cmd := exec.CommandContext(ctx, args[0], args[1:]...) //nolint:gosec
-		output, err := cmd.CombinedOutput()
-		cancel()
-		if err != nil {
-			// 路由不存在不算错误
-			if !strings.Contains(string(output), "No such process") {
-				errors = append(errors, fmt.Errorf("failed to delete route %s: %s, output: %s", dst, err, string(output)))
-				continue
-			}
+		// 路由不存在不算错误
+		if err := e.runRouteCommand(args); err != nil && !errors.Is(err, errRouteNotFound) {
+			errs = append(errs, fmt.Errorf("failed to delete route %s: %w", dst, err))
+			continue
 		}
 		cleaned++
 	}
 
 	// 清空 managedRoutes
 	e.managedRoutes = make(map[string]string)
+	e.routeMetrics = make(map[string]uint32)
+
+	// 内存中没有记录、但带有本 Agent 协议号的路由（例如 metric 变化时未能删除的旧路由）
+	purged, purgeErrs := e.purgeOwnedRoutesLocked(e.table)
+	cleaned += purged
+	errs = append(errs, purgeErrs...)
 
-	return cleaned, errors
+	for table, routes := range e.classRoutes {
+		cleaned += len(routes)
+		if err := e.flushTableLocked(table); err != nil {
+			errs = append(errs, fmt.Errorf("failed to flush table %d: %w", table, err))
+		}
+	}
+	e.classRoutes = make(map[int]map[string]string)
+
+	if e.table != 0 {
+		for _, subnet := range e.ruleDsts() {
+			if err := e.runRouteCommand(e.GenerateRuleCommand("del", subnet)); err != nil && !errors.Is(err, errRouteNotFound) {
+				errs = append(errs, fmt.Errorf("failed to remove routing rule for %s: %w", subnet, err))
+			}
+		}
+	}
+
+	return cleaned, errs
+}
+
+// PurgeStaleRoutes 删除中继路由表和流量类别路由表 classTables 中带有本 Agent 协议号的路由
+// 用于启动时清理上次进程异常退出（未执行 CleanupManagedRoutes）遗留的路由，未设置协议号时无法识别，不做任何事
+func (e *Executor) PurgeStaleRoutes(classTables []int) (int, []error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.changeReason = changeReasonStale
+
+	cleaned, errs := e.purgeOwnedRoutesLocked(e.table)
+	for _, table := range classTables {
+		purged, purgeErrs := e.purgeOwnedRoutesLocked(table)
+		cleaned += purged
+		errs = append(errs, purgeErrs...)
+	}
+	return cleaned, errs
+}
+
+// purgeOwnedRoutesLocked 删除路由表 table 中带有本 Agent 协议号的路由，删除时同样指定协议号，不会误删其他来源的同名路由
+// 调用方需持有 e.mu
+func (e *Executor) purgeOwnedRoutesLocked(table int) (int, []error) {
+	if e.protocol == 0 {
+		return 0, nil
+	}
+	current, err := e.listAllRoutes(table)
+	if err != nil {
+		return 0, []error{err}
+	}
+
+	var errs []error
+	cleaned := 0
+	for _, r := range current {
+		if r.protocol != e.protocol || r.dst == "default" {
+			continue
+		}
+		args := []string{"ip", "route", "del", r.dst}
+		if r.blackhole {
+			args = []string{"ip", "route", "del", "blackhole", r.dst}
+		}
+		if table != 0 {
+			args = append(args, "table", strconv.Itoa(table))
+		}
+		args = withMetric(e.withProtocol(args), r.metric)
+
+		e.logger.Info("Purging stale route",
+			logging.F("command", strings.Join(args, " ")),
+			logging.F("dst", r.dst),
+		)
+		if err := e.runRouteCommand(args); err != nil && !errors.Is(err, errRouteNotFound) {
+			errs = append(errs, fmt.Errorf("failed to delete stale route %s: %w", r.dst, err))
+			continue
+		}
+		cleaned++
+	}
+	return cleaned, errs
 }
 
 // ManagedRouteCount 返回当前管理的路由数量
@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
@@ -34,6 +35,219 @@ func TestValidateIP(t *testing.T) {
 	}
 }
 
+func TestValidateIPv6(t *testing.T) {
+	executor, err := NewExecutor("wg0", "10.254.0.0/24")
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	if executor.ValidateIP("fd00:254::3") {
+		t.Error("ValidateIP(fd00:254::3) = true before adding an IPv6 subnet")
+	}
+	if err := executor.AddSubnet("fd00:254::/64"); err != nil {
+		t.Fatalf("AddSubnet: %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.254.0.3", true},
+		{"fd00:254::3", true},
+		{"fd00:254::ffff:1", true},
+		{"fd00:255::3", false},
+		{"fe80::1", false},
+	}
+	for _, tt := range tests {
+		if got := executor.ValidateIP(tt.ip); got != tt.want {
+			t.Errorf("ValidateIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+
+	if got := executor.families(); len(got) != 2 || got[0] || !got[1] {
+		t.Errorf("families() = %v, want [false true]", got)
+	}
+}
+
+func TestHostAddr(t *testing.T) {
+	tests := map[string]string{
+		"10.254.0.3/32":     "10.254.0.3",
+		"fd00:254::3/128":   "fd00:254::3",
+		"fd00:254:0::3/128": "fd00:254::3",
+		"10.254.0.3":        "10.254.0.3",
+		"10.254.0.0/24":     "10.254.0.0/24",
+		"fd00:254::/32":     "fd00:254::/32",
+		"fd00:254::/64":     "fd00:254::/64",
+	}
+	for in, want := range tests {
+		if got := hostAddr(in); got != want {
+			t.Errorf("hostAddr(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestApplyRouteIPv6Checks(t *testing.T) {
+	executor, _ := NewExecutor("wg0", "fd00:254::/64")
+
+	// 以下路由都在执行任何命令之前被拒绝
+	for _, route := range []models.RouteConfig{
+		{DstCIDR: "fd00:255::3/128", NextHop: "fd00:254::2"},
+		{DstCIDR: "fd00::/16", NextHop: "fd00:254::2"},
+		{DstCIDR: "fd00:254::3/128", NextHop: "fd00:255::2"},
+		{DstCIDR: "10.254.0.3/32", NextHop: "fd00:254::2"},
+	} {
+		if err := executor.ApplyRoute(route); err == nil {
+			t.Errorf("ApplyRoute(%+v) returned no error", route)
+		}
+	}
+
+	_ = executor.AddSubnet("10.254.0.0/24")
+	mixed := models.RouteConfig{DstCIDR: "fd00:254::3/128", NextHop: "10.254.0.2"}
+	if err := executor.ApplyRoute(mixed); err == nil || !strings.Contains(err.Error(), "address families") {
+		t.Errorf("ApplyRoute(mixed families) error = %v", err)
+	}
+}
+
+func TestCheckDstPrefixes(t *testing.T) {
+	executor, _ := NewExecutor("wg0", "10.254.0.0/24")
+	if err := executor.AddRoutedPrefix("10.20.0.0/16"); err != nil {
+		t.Fatalf("AddRoutedPrefix: %v", err)
+	}
+
+	tests := []struct {
+		dst  string
+		want string // 空字符串表示应被拒绝
+	}{
+		{"10.254.0.3/32", "10.254.0.3/32"},
+		{"10.254.0.3", "10.254.0.3/32"},
+		{"10.254.0.0/25", "10.254.0.0/25"},
+		{"10.254.0.0/24", "10.254.0.0/24"},
+		{"10.20.0.0/24", "10.20.0.0/24"},
+		{"10.20.0.0/16", "10.20.0.0/16"},
+		// 比允许的前缀更大
+		{"10.254.0.0/23", ""},
+		{"10.0.0.0/8", ""},
+		{"0.0.0.0/0", ""},
+		// 主机位不为 0
+		{"10.20.0.5/24", ""},
+		{"10.21.0.0/24", ""},
+		{"invalid", ""},
+	}
+	for _, tt := range tests {
+		dst, err := executor.checkDst(tt.dst)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("checkDst(%s) = %s, want error", tt.dst, dst)
+			}
+			continue
+		}
+		if err != nil || dst.String() != tt.want {
+			t.Errorf("checkDst(%s) = %v, %v, want %s", tt.dst, dst, err, tt.want)
+		}
+	}
+
+	// 前缀内的地址不能作为下一跳
+	dst, _ := executor.checkDst("10.20.1.0/24")
+	if err := executor.checkNextHop("10.20.0.1", dst); err == nil {
+		t.Error("checkNextHop(10.20.0.1) accepted an address outside the tunnel subnet")
+	}
+	if err := executor.checkNextHop("10.254.0.2", dst); err != nil {
+		t.Errorf("checkNextHop(10.254.0.2) = %v", err)
+	}
+}
+
+func TestGeneratePrefixCommands(t *testing.T) {
+	executor, _ := NewExecutor("wg0", "10.254.0.0/24")
+	_ = executor.AddRoutedPrefix("10.20.0.0/16")
+	executor.SetRouteTable(200, 1000)
+
+	if got := strings.Join(executor.GenerateAddCommand("10.20.0.0/24", "10.254.0.2"), " "); got != "ip route replace 10.20.0.0/24 via 10.254.0.2 dev wg0 table 200" {
+		t.Errorf("add command = %q", got)
+	}
+	if got := strings.Join(executor.GenerateClassDelCommand(100, "10.20.0.0/24"), " "); got != "ip route del 10.20.0.0/24 dev wg0 table 100" {
+		t.Errorf("class del command = %q", got)
+	}
+	// 隧道子网和路由前缀各一条 ip rule
+	if got := executor.ruleDsts(); len(got) != 2 || got[1].String() != "10.20.0.0/16" {
+		t.Errorf("ruleDsts() = %v", got)
+	}
+}
+
+func TestGenerateMultipathCommand(t *testing.T) {
+	executor, _ := NewExecutor("wg0", "10.254.0.0/24")
+
+	args := executor.GenerateMultipathCommand("10.254.0.4", []string{"10.254.0.2", "10.254.0.3"}, nil)
+	want := "ip route replace 10.254.0.4/32 nexthop via 10.254.0.2 dev wg0 weight 1 nexthop via 10.254.0.3 dev wg0 weight 1"
+	if got := strings.Join(args, " "); got != want {
+		t.Errorf("equal weights = %q, want %q", got, want)
+	}
+
+	// table 和 metric 必须在 nexthop 之前
+	executor.SetRouteTable(200, 1000)
+	args = withMetric(executor.GenerateMultipathCommand("10.254.0.4", []string{"10.254.0.2", "10.254.0.3"}, []int{3, 1}), 50)
+	want = "ip route replace 10.254.0.4/32 table 200 metric 50 nexthop via 10.254.0.2 dev wg0 weight 3 nexthop via 10.254.0.3 dev wg0 weight 1"
+	if got := strings.Join(args, " "); got != want {
+		t.Errorf("weighted = %q, want %q", got, want)
+	}
+}
+
+func TestApplyRouteMultipathChecks(t *testing.T) {
+	executor, _ := NewExecutor("wg0", "10.254.0.0/24")
+
+	// 以下路由都在执行任何命令之前被拒绝
+	for _, route := range []models.RouteConfig{
+		{DstCIDR: "10.254.0.4/32", NextHop: "10.254.0.2", NextHops: []string{"10.254.0.3", "10.254.0.2"}},
+		{DstCIDR: "10.254.0.4/32", NextHop: "10.254.0.2", NextHops: []string{"10.254.0.2", "10.254.0.2"}},
+		{DstCIDR: "10.254.0.4/32", NextHop: "10.254.0.2", NextHops: []string{"10.254.0.2", "192.168.1.1"}},
+		{DstCIDR: "10.254.0.4/32", NextHop: "10.254.0.2", NextHops: []string{"10.254.0.2", "10.254.0.3"}, Weights: []int{1}},
+		{DstCIDR: "10.254.0.4/32", NextHop: "10.254.0.2", NextHops: []string{"10.254.0.2", "10.254.0.3"}, Weights: []int{1, 300}},
+	} {
+		if err := executor.ApplyRoute(route); err == nil {
+			t.Errorf("ApplyRoute(%+v) returned no error", route)
+		}
+	}
+}
+
+// TestApplyECMPRoute Controller 下发的等价多路径路由按 next_hops 顺序安装所有下一跳，
+// next_hops 中混入直连时整条路由被拒绝
+func TestApplyECMPRoute(t *testing.T) {
+	executor, _ := NewExecutor("wg0", "10.254.0.0/24")
+	backend := &fakeRouteBackend{}
+	executor.backend = backend
+
+	ecmp := models.RouteConfig{
+		DstCIDR:  "10.254.0.4/32",
+		NextHop:  "10.254.0.2",
+		NextHops: []string{"10.254.0.2", "10.254.0.3"},
+		Reason:   "optimized_path",
+	}
+	if err := executor.SyncRoutes([]models.RouteConfig{ecmp}); err != nil {
+		t.Fatalf("SyncRoutes(%+v) error = %v", ecmp, err)
+	}
+	if len(backend.applied) != 1 {
+		t.Fatalf("applied = %+v, want 1 request", backend.applied)
+	}
+	req := backend.applied[0]
+	var vias []string
+	for _, nh := range req.nexthops {
+		vias = append(vias, nh.via.String())
+	}
+	if req.dst == nil || req.dst.String() != "10.254.0.4/32" || strings.Join(vias, ",") != "10.254.0.2,10.254.0.3" {
+		t.Errorf("applied %v via %v, want 10.254.0.4/32 via [10.254.0.2 10.254.0.3]", req.dst, vias)
+	}
+
+	withDirect := models.RouteConfig{
+		DstCIDR:  "10.254.0.5/32",
+		NextHop:  "10.254.0.2",
+		NextHops: []string{"10.254.0.2", "direct"},
+	}
+	if err := executor.ApplyRoute(withDirect); err == nil {
+		t.Errorf("ApplyRoute(%+v) returned no error", withDirect)
+	}
+	if len(backend.applied) != 1 {
+		t.Errorf("route with direct next hop reached the backend: %+v", backend.applied[1:])
+	}
+}
+
 func TestGenerateAddCommand(t *testing.T) {
 	executor, _ := NewExecutor("wg0", "10.254.0.0/24")
 
@@ -70,6 +284,33 @@ func TestGenerateDelCommand(t *testing.T) {
 	}
 }
 
+func TestGenerateCommandsIPv6(t *testing.T) {
+	executor, _ := NewExecutor("wg0", "fd00:254::/64")
+	executor.SetRouteTable(200, 1000)
+
+	tests := []struct {
+		name string
+		cmd  []string
+		want string
+	}{
+		{"add", executor.GenerateAddCommand("fd00:254::3", "fd00:254::2"),
+			"ip route replace fd00:254::3/128 via fd00:254::2 dev wg0 table 200"},
+		{"delete", executor.GenerateDelCommand("fd00:254::3"),
+			"ip route del fd00:254::3/128 dev wg0 table 200"},
+		{"class add", executor.GenerateClassAddCommand(100, "fd00:254::3", "direct"),
+			"ip route replace fd00:254::3/128 dev wg0 table 100"},
+		{"flush", executor.GenerateFlushTable6Command(100),
+			"ip -6 route flush table 100"},
+		{"rule", executor.GenerateRuleCommand("add", executor.subnets[0]),
+			"ip -6 rule add to fd00:254::/64 lookup 200 priority 1000"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(tt.cmd, " "); got != tt.want {
+			t.Errorf("%s command = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
 func TestCalculateDiff(t *testing.T) {
 	current := []CurrentRoute{
 		{Destination: "10.254.0.2/32", NextHop: "10.254.0.1"},
@@ -126,3 +367,135 @@ func TestNewExecutorInvalidSubnet(t *testing.T) {
 		t.Errorf("Error should mention invalid subnet: %v", err)
 	}
 }
+
+func TestGenerateClassCommands(t *testing.T) {
+	executor, _ := NewExecutor("wg0", "10.254.0.0/24")
+
+	tests := []struct {
+		name string
+		cmd  []string
+		want string
+	}{
+		{"relay", executor.GenerateClassAddCommand(100, "10.254.0.3", "10.254.0.2"),
+			"ip route replace 10.254.0.3/32 via 10.254.0.2 dev wg0 table 100"},
+		{"direct", executor.GenerateClassAddCommand(100, "10.254.0.3", "direct"),
+			"ip route replace 10.254.0.3/32 dev wg0 table 100"},
+		{"delete", executor.GenerateClassDelCommand(100, "10.254.0.3"),
+			"ip route del 10.254.0.3/32 dev wg0 table 100"},
+		{"blackhole", executor.GenerateClassAddCommand(100, "10.254.0.3", "blackhole"),
+			"ip route replace blackhole 10.254.0.3/32 table 100"},
+		{"delete blackhole", executor.GenerateClassBlackholeDelCommand(100, "10.254.0.3"),
+			"ip route del blackhole 10.254.0.3/32 table 100"},
+		{"flush", executor.GenerateFlushTableCommand(100), "ip route flush table 100"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(tt.cmd, " "); got != tt.want {
+			t.Errorf("%s command = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateCommandsWithRouteTable(t *testing.T) {
+	executor, _ := NewExecutor("wg0", "10.254.0.0/24")
+	// 主路由表时不需要 ip rule
+	if err := executor.InstallRule(); err != nil {
+		t.Errorf("InstallRule() with main table = %v", err)
+	}
+
+	executor.SetRouteTable(200, 1000)
+	tests := []struct {
+		name string
+		cmd  []string
+		want string
+	}{
+		{"add", executor.GenerateAddCommand("10.254.0.3", "10.254.0.2"),
+			"ip route replace 10.254.0.3/32 via 10.254.0.2 dev wg0 table 200"},
+		{"delete", executor.GenerateDelCommand("10.254.0.3"),
+			"ip route del 10.254.0.3/32 dev wg0 table 200"},
+		{"blackhole", executor.GenerateBlackholeCommand("10.254.0.3"),
+			"ip route replace blackhole 10.254.0.3/32 table 200"},
+		{"delete blackhole", executor.GenerateBlackholeDelCommand("10.254.0.3"),
+			"ip route del blackhole 10.254.0.3/32 table 200"},
+		{"rule", executor.GenerateRuleCommand("add", executor.subnets[0]),
+			"ip rule add to 10.254.0.0/24 lookup 200 priority 1000"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(tt.cmd, " "); got != tt.want {
+			t.Errorf("%s command = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateCommandsWithRouteProtocol(t *testing.T) {
+	executor, _ := NewExecutor("wg0", "10.254.0.0/24")
+	executor.SetRouteProtocol(157)
+
+	tests := []struct {
+		name string
+		cmd  []string
+		want string
+	}{
+		{"add", withMetric(executor.GenerateAddCommand("10.254.0.3", "10.254.0.2"), 50),
+			"ip route replace 10.254.0.3/32 via 10.254.0.2 dev wg0 proto 157 metric 50"},
+		{"multipath", executor.GenerateMultipathCommand("10.254.0.4", []string{"10.254.0.2", "10.254.0.3"}, nil),
+			"ip route replace 10.254.0.4/32 proto 157 nexthop via 10.254.0.2 dev wg0 weight 1 nexthop via 10.254.0.3 dev wg0 weight 1"},
+		{"blackhole", executor.GenerateBlackholeCommand("10.254.0.3"),
+			"ip route replace blackhole 10.254.0.3/32 proto 157"},
+		{"class add", executor.GenerateClassAddCommand(100, "10.254.0.3", "direct"),
+			"ip route replace 10.254.0.3/32 dev wg0 table 100 proto 157"},
+		// 删除按目的地和 metric 匹配，不需要协议号
+		{"delete", executor.GenerateDelCommand("10.254.0.3"),
+			"ip route del 10.254.0.3/32 dev wg0"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(tt.cmd, " "); got != tt.want {
+			t.Errorf("%s command = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyRouteRelayDepth(t *testing.T) {
+	executor, _ := NewExecutor("wg0", "10.254.0.0/24")
+	executor.SetMaxRelayDepth(1)
+
+	// 两层中继超过限制，在执行任何命令之前被拒绝
+	deep := models.RouteConfig{
+		DstCIDR: "10.254.0.4/32",
+		NextHop: "10.254.0.2",
+		Path:    []string{"10.254.0.1", "10.254.0.2", "10.254.0.3", "10.254.0.4"},
+	}
+	if err := executor.ApplyRoute(deep); !errors.Is(err, ErrRelayDepthExceeded) {
+		t.Errorf("ApplyRoute(deep) error = %v, want ErrRelayDepthExceeded", err)
+	}
+
+	mismatch := models.RouteConfig{
+		DstCIDR: "10.254.0.4/32",
+		NextHop: "10.254.0.3",
+		Path:    []string{"10.254.0.1", "10.254.0.2", "10.254.0.4"},
+	}
+	if err := executor.ApplyRoute(mismatch); err == nil {
+		t.Error("ApplyRoute(mismatch) error = nil, want path mismatch error")
+	}
+	if executor.ManagedRouteCount() != 0 {
+		t.Errorf("ManagedRouteCount() = %d, want 0", executor.ManagedRouteCount())
+	}
+}
+
+func TestSyncRoutesReportsFailures(t *testing.T) {
+	executor, _ := NewExecutor("wg0", "10.254.0.0/24")
+	backend := &fakeRouteBackend{}
+	executor.backend = backend
+
+	err := executor.SyncRoutes([]models.RouteConfig{
+		{DstCIDR: "10.254.0.3/32", NextHop: "10.254.0.2"},
+		{DstCIDR: "192.168.1.0/24", NextHop: "10.254.0.2"},
+		{DstCIDR: "10.254.0.4/32", NextHop: "10.254.0.2"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "192.168.1.0/24") {
+		t.Errorf("SyncRoutes() error = %v, want failure for 192.168.1.0/24", err)
+	}
+	// 失败的路由不影响其他路由的安装
+	if len(backend.applied) != 2 || executor.ManagedRouteCount() != 2 {
+		t.Errorf("applied = %d, managed = %d, want 2", len(backend.applied), executor.ManagedRouteCount())
+	}
+}
@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// failoverTable 记录 Controller 下发的路由及本地故障切换状态
+// 主中继探测超时时立即切换到备份下一跳，不必等待 Controller 重新计算
+type failoverTable struct {
+	mu        sync.Mutex
+	routes    map[string]models.RouteConfig // dst_cidr -> Controller 下发的路由
+	overrides map[string]string             // dst_cidr -> 本地切换后使用的下一跳
+}
+
+// newFailoverTable 创建故障切换表
+func newFailoverTable() *failoverTable {
+	return &failoverTable{
+		routes:    make(map[string]models.RouteConfig),
+		overrides: make(map[string]string),
+	}
+}
+
+// record 记录 Controller 下发的路由，Controller 的新决策覆盖本地切换状态
+func (t *failoverTable) record(routes []models.RouteConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, r := range routes {
+		t.routes[r.DstCIDR] = r
+		delete(t.overrides, r.DstCIDR)
+	}
+}
+
+// reset 清空全部状态（路由被清空时调用）
+func (t *failoverTable) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.routes = make(map[string]models.RouteConfig)
+	t.overrides = make(map[string]string)
+}
+
+// evaluate 根据对等节点可达性计算需要变更的路由，并更新切换状态
+// reachable 返回节点最近一次探测是否成功，第二个返回值为 false 表示尚无探测结果
+func (t *failoverTable) evaluate(reachable func(ip string) (up, known bool)) []models.RouteConfig {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	hopUp := func(hop, dst string) bool {
+		if hop == "direct" {
+			hop = dst
+		}
+		up, known := reachable(hop)
+		return up && known
+	}
+	hopDown := func(hop, dst string) bool {
+		if hop == "direct" {
+			hop = dst
+		}
+		up, known := reachable(hop)
+		return known && !up
+	}
+
+	var changes []models.RouteConfig
+	for dst, route := range t.routes {
+		if len(route.Backups) == 0 {
+			continue
+		}
+		target := hostAddr(dst)
+
+		current, failedOver := t.overrides[dst]
+		if !failedOver {
+			current = route.NextHop
+		}
+
+		// 已切换且主下一跳恢复：切回 Controller 的决策
+		if failedOver && hopUp(route.NextHop, target) {
+			delete(t.overrides, dst)
+			changes = append(changes, route)
+			continue
+		}
+		if !hopDown(current, target) {
+			continue
+		}
+
+		for _, backup := range route.Backups {
+			if backup == current || !hopUp(backup, target) {
+				continue
+			}
+			t.overrides[dst] = backup
+			changes = append(changes, models.RouteConfig{
+				DstCIDR: dst,
+				NextHop: backup,
+				Reason:  "local_failover",
+				Metric:  route.Metric,
+			})
+			break
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].DstCIDR < changes[j].DstCIDR
+	})
+	return changes
+}
+
+// checkFailover 按最近一次探测结果执行本地故障切换
+func (a *Agent) checkFailover() {
+	if a.client.IsInFallback() {
+		return
+	}
+
+	latest := make(map[string]bool)
+	for _, m := range a.prober.GetRawMetrics() {
+		latest[m.TargetIP] = m.RTTMs != nil
+	}
+	changes := a.failover.evaluate(func(ip string) (bool, bool) {
+		up, known := latest[ip]
+		return up, known
+	})
+
+	for _, route := range changes {
+		a.logger.Warn("Local route failover",
+			logging.F("dst_cidr", route.DstCIDR),
+			logging.F("next_hop", route.NextHop),
+			logging.F("reason", route.Reason),
+		)
+		if err := a.executor.ApplyRoute(route); err != nil {
+			a.logger.Error("Failed to apply failover route",
+				logging.F("dst_cidr", route.DstCIDR),
+				logging.F("error", err.Error()),
+			)
+		}
+	}
+}
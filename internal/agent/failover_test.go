@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+func TestFailoverTableEvaluate(t *testing.T) {
+	table := newFailoverTable()
+	table.record([]models.RouteConfig{
+		{DstCIDR: "10.254.0.4/32", NextHop: "10.254.0.2", Reason: "optimized_path", Backups: []string{"10.254.0.3", "direct"}},
+		{DstCIDR: "10.254.0.5/32", NextHop: "10.254.0.2", Reason: "optimized_path"},
+	})
+
+	state := map[string]bool{
+		"10.254.0.2": true,
+		"10.254.0.3": true,
+		"10.254.0.4": true,
+	}
+	reachable := func(ip string) (bool, bool) {
+		up, known := state[ip]
+		return up, known
+	}
+
+	if changes := table.evaluate(reachable); len(changes) != 0 {
+		t.Fatalf("all peers up: changes = %+v, want none", changes)
+	}
+
+	// 主中继探测失败，切换到第一个可达的备份；没有备份的路由保持不变
+	state["10.254.0.2"] = false
+	changes := table.evaluate(reachable)
+	if len(changes) != 1 || changes[0].NextHop != "10.254.0.3" || changes[0].Reason != "local_failover" {
+		t.Fatalf("primary down: changes = %+v, want failover to 10.254.0.3", changes)
+	}
+	if changes := table.evaluate(reachable); len(changes) != 0 {
+		t.Errorf("repeated evaluate: changes = %+v, want none", changes)
+	}
+
+	// 当前备份也失效，继续切换到下一个备份
+	state["10.254.0.3"] = false
+	changes = table.evaluate(reachable)
+	if len(changes) != 1 || changes[0].NextHop != "direct" {
+		t.Fatalf("backup down: changes = %+v, want failover to direct", changes)
+	}
+
+	// 主中继恢复，切回 Controller 下发的路由
+	state["10.254.0.2"] = true
+	changes = table.evaluate(reachable)
+	if len(changes) != 1 || changes[0].NextHop != "10.254.0.2" || changes[0].Reason != "optimized_path" {
+		t.Fatalf("primary recovered: changes = %+v, want restore to 10.254.0.2", changes)
+	}
+}
+
+func TestFailoverTableUnknownReachability(t *testing.T) {
+	table := newFailoverTable()
+	table.record([]models.RouteConfig{
+		{DstCIDR: "10.254.0.4/32", NextHop: "10.254.0.2", Backups: []string{"10.254.0.3"}},
+	})
+
+	// 尚无探测结果时不切换
+	changes := table.evaluate(func(string) (bool, bool) { return false, false })
+	if len(changes) != 0 {
+		t.Errorf("unknown reachability: changes = %+v, want none", changes)
+	}
+}
@@ -6,14 +6,33 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 )
 
+// pingPath 对端 http 探测访问的路径
+const pingPath = "/ping"
+
+// ProbesResponse /debug/probes 的响应
+type ProbesResponse struct {
+	AgentID string        `json:"agent_id"`
+	Peers   []PeerHistory `json:"peers"`
+}
+
+// RouteChangesResponse /debug/route-changes 的响应
+type RouteChangesResponse struct {
+	AgentID string        `json:"agent_id"`
+	Changes []RouteChange `json:"changes"`
+}
+
 // HealthServer Agent 健康检查 HTTP 服务器
 type HealthServer struct {
 	agent  *Agent
 	server *http.Server
 	port   int
+
+	tlsCert string
+	tlsKey  string
 }
 
 // NewHealthServer 创建健康检查服务器
@@ -25,6 +44,10 @@ func NewHealthServer(agent *Agent, port int) *HealthServer {
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", hs.handleHealth)
+	mux.HandleFunc(pingPath, handlePing)
+	mux.HandleFunc("/debug/probes", hs.handleProbes)
+	mux.HandleFunc("/debug/route-changes", hs.handleRouteChanges)
+	mux.HandleFunc("/metrics", hs.handleMetrics)
 
 	hs.server = &http.Server{
 		Addr:         fmt.Sprintf(":%d", port),
@@ -36,10 +59,22 @@ func NewHealthServer(agent *Agent, port int) *HealthServer {
 	return hs
 }
 
+// SetTLS 以 HTTPS 提供服务，需在 Start 之前调用
+func (hs *HealthServer) SetTLS(certFile, keyFile string) {
+	hs.tlsCert = certFile
+	hs.tlsKey = keyFile
+}
+
 // Start 启动健康检查服务器
 func (hs *HealthServer) Start() error {
 	go func() {
-		if err := hs.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if hs.tlsCert != "" {
+			err = hs.server.ListenAndServeTLS(hs.tlsCert, hs.tlsKey)
+		} else {
+			err = hs.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			// 记录错误但不阻塞
 			fmt.Printf("Health server error: %v\n", err)
 		}
@@ -71,3 +106,57 @@ func (hs *HealthServer) handleHealth(w http.ResponseWriter, r *http.Request) {
 
 	_ = json.NewEncoder(w).Encode(resp)
 }
+
+// handleProbes 返回各对端滑动窗口中的原始测量结果，现场排查时无需访问 Controller
+func (hs *HealthServer) handleProbes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ProbesResponse{
+		AgentID: hs.agent.cfg.AgentID,
+		Peers:   hs.agent.prober.GetHistory(),
+	})
+}
+
+// handleRouteChanges 返回最近的路由变更，按时间先后排列
+// since（RFC 3339 时间）只返回该时间之后的变更，limit 只返回最近的若干条
+func (hs *HealthServer) handleRouteChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid since, expected RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+	var limit int
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(RouteChangesResponse{
+		AgentID: hs.agent.cfg.AgentID,
+		Changes: hs.agent.audit.Entries(since, limit),
+	})
+}
+
+// handlePing 供对端 http 探测使用的最小响应，不做任何计算以免放大 CPU 竞争之外的延迟
+func handlePing(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte("pong"))
+}
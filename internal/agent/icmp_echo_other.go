@@ -0,0 +1,20 @@
+//go:build !windows
+
+package agent
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// systemEchoSupported 当前平台是否提供系统的 ICMP Echo API
+const systemEchoSupported = false
+
+// errSystemEchoUnsupported 只有 Windows 提供 IcmpSendEcho
+var errSystemEchoUnsupported = errors.New("system ICMP echo API is only supported on windows")
+
+// icmpEcho 非 Windows 平台的占位实现，总是失败，icmp 探测使用原始套接字或 UDP ICMP 套接字
+func icmpEcho(net.IP, net.IP, time.Duration) (time.Duration, error) {
+	return 0, errSystemEchoUnsupported
+}
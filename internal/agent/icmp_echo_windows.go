@@ -0,0 +1,112 @@
+//go:build windows
+
+package agent
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// systemEchoSupported 当前平台是否提供系统的 ICMP Echo API
+const systemEchoSupported = true
+
+// iphlpapi.dll 中的 ICMP Echo API，ping.exe 同样使用这些函数，不需要管理员权限
+var (
+	iphlpapi            = syscall.NewLazyDLL("iphlpapi.dll")
+	procIcmpCreateFile  = iphlpapi.NewProc("IcmpCreateFile")
+	procIcmp6CreateFile = iphlpapi.NewProc("Icmp6CreateFile")
+	procIcmpCloseHandle = iphlpapi.NewProc("IcmpCloseHandle")
+	procIcmpSendEcho2Ex = iphlpapi.NewProc("IcmpSendEcho2Ex")
+	procIcmp6SendEcho2  = iphlpapi.NewProc("Icmp6SendEcho2")
+)
+
+// icmpEchoData Echo 请求携带的数据，与 ping.exe 默认的 32 字节相同
+var icmpEchoData = []byte("abcdefghijklmnopqrstuvwabcdefghi")
+
+// icmpReplyBufferSize 接收应答的缓冲区大小，需容纳应答结构、回显的数据和 8 字节的 ICMP 错误信息
+const icmpReplyBufferSize = 256
+
+// icmpEcho 通过系统 API 向 target 发送一个 ICMP Echo 请求并等待应答，source 非 nil 时作为源地址
+// RTT 按调用前后的时间计算，精度高于 API 返回的毫秒值
+func icmpEcho(target, source net.IP, timeout time.Duration) (time.Duration, error) {
+	if target4 := target.To4(); target4 != nil {
+		return icmpEcho4(target4, source, timeout)
+	}
+	return icmpEcho6(target, source, timeout)
+}
+
+// icmpEcho4 使用 IcmpSendEcho2Ex 发送 IPv4 Echo 请求
+func icmpEcho4(target, source net.IP, timeout time.Duration) (time.Duration, error) {
+	h, _, err := procIcmpCreateFile.Call()
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		return 0, fmt.Errorf("IcmpCreateFile failed: %w", err)
+	}
+	defer procIcmpCloseHandle.Call(h) //nolint:errcheck
+
+	// IPAddr 按网络字节序存放，以本机字节序读出后原样传递
+	var src uint32
+	if s := source.To4(); s != nil {
+		src = binary.NativeEndian.Uint32(s)
+	}
+	dst := binary.NativeEndian.Uint32(target)
+	reply := make([]byte, icmpReplyBufferSize)
+
+	start := time.Now()
+	n, _, err := procIcmpSendEcho2Ex.Call(h, 0, 0, 0,
+		uintptr(src), uintptr(dst),
+		uintptr(unsafe.Pointer(&icmpEchoData[0])), uintptr(len(icmpEchoData)), 0,
+		uintptr(unsafe.Pointer(&reply[0])), uintptr(len(reply)),
+		uintptr(timeout.Milliseconds()))
+	rtt := time.Since(start)
+	if n == 0 {
+		return 0, fmt.Errorf("IcmpSendEcho2Ex failed: %w", err)
+	}
+	// ICMP_ECHO_REPLY 的 Status 位于 Address 之后，非 0 表示收到的是目的不可达、超时等错误报文
+	if status := binary.NativeEndian.Uint32(reply[4:8]); status != 0 {
+		return 0, fmt.Errorf("ICMP echo status %d", status)
+	}
+	return rtt, nil
+}
+
+// icmpEcho6 使用 Icmp6SendEcho2 发送 IPv6 Echo 请求
+func icmpEcho6(target, source net.IP, timeout time.Duration) (time.Duration, error) {
+	h, _, err := procIcmp6CreateFile.Call()
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		return 0, fmt.Errorf("Icmp6CreateFile failed: %w", err)
+	}
+	defer procIcmpCloseHandle.Call(h) //nolint:errcheck
+
+	src := sockaddrInet6(source)
+	dst := sockaddrInet6(target)
+	reply := make([]byte, icmpReplyBufferSize)
+
+	start := time.Now()
+	n, _, err := procIcmp6SendEcho2.Call(h, 0, 0, 0,
+		uintptr(unsafe.Pointer(&src[0])), uintptr(unsafe.Pointer(&dst[0])),
+		uintptr(unsafe.Pointer(&icmpEchoData[0])), uintptr(len(icmpEchoData)), 0,
+		uintptr(unsafe.Pointer(&reply[0])), uintptr(len(reply)),
+		uintptr(timeout.Milliseconds()))
+	rtt := time.Since(start)
+	if n == 0 {
+		return 0, fmt.Errorf("Icmp6SendEcho2 failed: %w", err)
+	}
+	// ICMPV6_ECHO_REPLY 以 26 字节的 IPV6_ADDRESS_EX 开头，Status 按 4 字节对齐位于偏移 28
+	if status := binary.NativeEndian.Uint32(reply[28:32]); status != 0 {
+		return 0, fmt.Errorf("ICMP echo status %d", status)
+	}
+	return rtt, nil
+}
+
+// sockaddrInet6 构造 sockaddr_in6，ip 为 nil 时为未指定地址（由系统选择源地址）
+func sockaddrInet6(ip net.IP) [28]byte {
+	var sa [28]byte
+	binary.NativeEndian.PutUint16(sa[0:2], syscall.AF_INET6)
+	if ip16 := ip.To16(); ip16 != nil && ip.To4() == nil {
+		copy(sa[8:24], ip16)
+	}
+	return sa
+}
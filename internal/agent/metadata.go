@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// collectMetadata 收集随遥测上报的机器信息，单项获取失败时留空
+func collectMetadata(cfg *config.AgentConfig, version string, logger logging.Logger) *models.AgentMetadata {
+	meta := &models.AgentMetadata{
+		Version:  version,
+		Endpoint: cfg.Network.Endpoint,
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		meta.Hostname = hostname
+	} else {
+		logger.Debug("Failed to read hostname", logging.F("error", err.Error()))
+	}
+
+	if ip, err := interfaceIP(cfg.Network.WGInterface); err == nil {
+		meta.TunnelIP = ip
+	} else {
+		logger.Debug("Failed to read tunnel address",
+			logging.F("interface", cfg.Network.WGInterface),
+			logging.F("error", err.Error()),
+		)
+	}
+
+	if dev, err := readWireGuardDevice(cfg.Network.WGInterface); err == nil {
+		meta.PublicKey = dev.publicKey
+	} else {
+		logger.Debug("Failed to read WireGuard public key",
+			logging.F("interface", cfg.Network.WGInterface),
+			logging.F("error", err.Error()),
+		)
+	}
+
+	return meta
+}
+
+// interfaceIP 返回接口的第一个 IPv4 地址，没有 IPv4 地址时返回第一个全局 IPv6 地址
+func interfaceIP(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+	var v6 string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP.String(), nil
+		}
+		if v6 == "" && ipNet.IP.IsGlobalUnicast() {
+			v6 = ipNet.IP.String()
+		}
+	}
+	if v6 != "" {
+		return v6, nil
+	}
+	return "", fmt.Errorf("no IP address on %s", name)
+}
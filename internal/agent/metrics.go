@@ -0,0 +1,91 @@
+// Package agent 实现 SD-WAN Agent 功能
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// prometheusContentType Prometheus 文本格式的 Content-Type
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// prometheusLabelEscaper 按文本格式规范转义标签值中的反斜杠、双引号和换行
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeProbeMetrics 输出各对端的链路指标，与上报 Controller 的值相同（已平滑）
+// 不可达的对端不输出 RTT 和抖动，只输出丢包率
+func (a *Agent) writeProbeMetrics(buf *bytes.Buffer) {
+	metrics := a.prober.GetMetrics()
+
+	gauges := []struct {
+		name, help string
+		value      func(models.Metric) (float64, bool)
+	}{
+		{"sdwan_agent_probe_rtt_seconds", "Smoothed round trip time to the peer.", func(m models.Metric) (float64, bool) {
+			if m.RTTMs == nil {
+				return 0, false
+			}
+			return *m.RTTMs / 1000, true
+		}},
+		{"sdwan_agent_probe_loss_ratio", "Smoothed packet loss to the peer, from 0 to 1.", func(m models.Metric) (float64, bool) {
+			return m.LossRate, true
+		}},
+		{"sdwan_agent_probe_jitter_seconds", "RTT standard deviation over the probe window.", func(m models.Metric) (float64, bool) {
+			return m.JitterMs / 1000, m.RTTMs != nil
+		}},
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		for _, m := range metrics {
+			if v, ok := g.value(m); ok {
+				fmt.Fprintf(buf, "%s{target=\"%s\"} %g\n", g.name, prometheusLabelEscaper.Replace(m.TargetIP), v)
+			}
+		}
+	}
+}
+
+// handleMetrics 以 Prometheus 文本格式输出 Agent 指标
+func (hs *HealthServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	a := hs.agent
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# HELP sdwan_agent_info Agent identity, always 1.\n# TYPE sdwan_agent_info gauge\n")
+	fmt.Fprintf(&buf, "sdwan_agent_info{agent_id=\"%s\",tenant_id=\"%s\",version=\"%s\"} 1\n",
+		prometheusLabelEscaper.Replace(a.cfg.AgentID),
+		prometheusLabelEscaper.Replace(a.cfg.TenantID),
+		prometheusLabelEscaper.Replace(a.version),
+	)
+
+	fmt.Fprintf(&buf, "# HELP sdwan_agent_route_syncs_total Route syncs from polling or pushes, by result.\n# TYPE sdwan_agent_route_syncs_total counter\n")
+	fmt.Fprintf(&buf, "sdwan_agent_route_syncs_total{result=\"success\"} %d\n", atomic.LoadUint64(&a.syncSuccesses))
+	fmt.Fprintf(&buf, "sdwan_agent_route_syncs_total{result=\"failure\"} %d\n", atomic.LoadUint64(&a.syncFailures))
+
+	var fallback float64
+	if a.client.IsInFallback() {
+		fallback = 1
+	}
+	gauges := []struct {
+		name, help string
+		value      float64
+	}{
+		{"sdwan_agent_fallback", "1 while the agent is in fallback mode with routes flushed.", fallback},
+		{"sdwan_agent_applied_routes", "Routes currently installed by the agent.", float64(a.executor.ManagedRouteCount())},
+		{"sdwan_agent_probe_success_ratio", "Share of successful measurements in the probe windows.", a.prober.GetSuccessRate()},
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", g.name, g.help, g.name, g.name, g.value)
+	}
+	a.writeProbeMetrics(&buf)
+
+	w.Header().Set("Content-Type", prometheusContentType)
+	_, _ = w.Write(buf.Bytes())
+}
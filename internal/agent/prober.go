@@ -2,29 +2,139 @@
 package agent
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	probing "github.com/go-ping/ping"
 
+	"github.com/holygeek00/lite-sdwan/pkg/config"
 	"github.com/holygeek00/lite-sdwan/pkg/logging"
 	"github.com/holygeek00/lite-sdwan/pkg/models"
 )
 
-// Prober 链路探测器
-type Prober struct {
-	peerIPs    []string
+// Prober Agent 使用的链路测量引擎
+// 默认实现是主动发包的 ActiveProber，也可以换成被动测量、TWAMP 或测试用的模拟实现
+type Prober interface {
+	// Start 启动测量，重复调用无效
+	Start()
+	// Stop 停止测量
+	Stop()
+	IsRunning() bool
+	// Peers 返回当前的测量目标
+	Peers() []string
+	// SetPeers 在运行期间替换测量目标，返回新增和移除的目标
+	SetPeers(peerIPs []string) (added, removed []string)
+	// GetMetrics 返回每个目标平滑后的指标，用于上报
+	GetMetrics() []models.Metric
+	// GetRawMetrics 返回每个目标最近一次的测量结果，用于本地故障切换
+	GetRawMetrics() []models.Metric
+	// GetHistory 返回每个目标最近的原始测量结果，用于现场排查
+	GetHistory() []PeerHistory
+	GetSuccessRate() float64
+	// GetLastProbeTime 返回最近一次测量的时间，尚未测量时为 nil
+	GetLastProbeTime() *time.Time
+	// ProbeType 返回测量方式，用于健康检查
+	ProbeType() string
+	// OnLinkDown 注册链路中断回调，Agent 据此在上报周期之外立即上报
+	OnLinkDown(fn func(target string))
+}
+
+// ActiveProber 主动发送 ICMP、TCP 或 HTTP 探测包的链路探测器
+type ActiveProber struct {
+	peerIPs    []string // 由 mu 保护，运行期间可以通过 SetPeers 替换
 	interval   time.Duration
 	timeout    time.Duration
 	windowSize int
-	logger     logging.Logger
+	// minInterval/maxInterval 自适应探测周期的上下限，相等时固定按 interval 探测
+	minInterval time.Duration
+	maxInterval time.Duration
+	count       int           // 每轮对每个对端发送的探测包数
+	packetGap   time.Duration // 同一轮内相邻探测包的间隔
+	probeType   string        // 探测方式，见 config.ProbeType*
+	ewmaAlpha   float64       // 大于 0 时上报的 RTT、丢包率使用 EWMA 而不是窗口平均
+	jitter      time.Duration // 每个节拍额外等待的随机时间上限
+	downAfter   int           // 连续失败该轮数后立即判定链路中断，0 表示不判定
+	// maxPPS/maxBPS 所有对端合计的探测流量上限（包/秒、字节/秒），0 表示不限
+	maxPPS     float64
+	maxBPS     float64
+	privileged bool   // icmp 探测使用原始套接字
+	systemEcho bool   // icmp 探测使用系统的 ICMP Echo API，优先于 privileged
+	tcpPort    int    // tcp 探测连接的对端端口
+	twampPort  int    // twamp 探测发往的对端反射端口
+	twampSeq   uint32 // twamp 测试包序号
+	httpURL    string // http 探测的 URL 模板，%s 为对端地址
+	// sourceIP/sourceIface 探测包的源地址或取源地址的网卡，都为空时由内核按路由选择
+	sourceIP    net.IP
+	sourceIface string
+	httpClient  *http.Client
+	logger      logging.Logger
+
+	peerOpts map[string]PeerOptions // target_ip -> 单独配置的探测参数
+
+	mu       sync.RWMutex
+	hooks    []func(target string, m Measurement)
+	onDown   []func(target string)
+	buffers  map[string]*SlidingWindow // target_ip -> measurements
+	schedule map[string]*peerSchedule  // target_ip -> 探测进度
+	stretch  float64                   // 为满足流量上限，各对端探测周期当前被拉长的倍数，1 表示未拉长
+	running  bool
+	stopCh   chan struct{}
+}
+
+// PeerOptions 单个对端的探测参数，零值字段使用全局配置
+type PeerOptions struct {
+	Interval  time.Duration
+	Timeout   time.Duration
+	ProbeType string
+}
+
+// peerProbe 单个对端生效的探测参数
+type peerProbe struct {
+	interval    time.Duration
+	minInterval time.Duration
+	maxInterval time.Duration
+	timeout     time.Duration
+	probeType   string
+}
 
-	mu      sync.RWMutex
-	buffers map[string]*SlidingWindow // target_ip -> measurements
-	running bool
-	stopCh  chan struct{}
+// peerSchedule 单个对端的探测进度
+type peerSchedule struct {
+	interval time.Duration // 当前探测周期
+	next     time.Time     // 下一次探测的时间
+	failures int           // 连续不可达的轮数
 }
 
+// probeCost 每个探测包一次往返的估算流量，两个方向合计并包含 IP 和传输层头
+type probeCost struct {
+	packets int
+	bytes   int
+}
+
+// probeCosts 各探测方式的估算流量
+var probeCosts = map[string]probeCost{
+	config.ProbeTypeICMP:  {packets: 2, bytes: 104}, // 24 字节载荷的 Echo 请求和应答
+	config.ProbeTypeTCP:   {packets: 5, bytes: 300}, // 三次握手加关闭
+	config.ProbeTypeHTTP:  {packets: 4, bytes: 500}, // 复用连接上的请求、响应及确认
+	config.ProbeTypeTWAMP: {packets: 2, bytes: 138}, // 41 字节的测试包及其反射
+}
+
+// adaptiveRTTChange RTT 相对窗口平均值的变化超过该比例时视为链路不稳定
+const adaptiveRTTChange = 0.2
+
 // SlidingWindow 滑动窗口缓冲区
 type SlidingWindow struct {
 	data     []Measurement
@@ -86,40 +196,632 @@ func (sw *SlidingWindow) GetAverage() (avgRTT *float64, avgLoss float64) {
 	return avgRTT, avgLoss
 }
 
+// GetEWMA 按时间先后对窗口内样本做指数加权移动平均，alpha 为最新样本的权重
+// RTT 只使用成功样本，以最早的成功样本为初值；丢包率使用全部样本
+func (sw *SlidingWindow) GetEWMA(alpha float64) (rtt *float64, loss float64) {
+	if sw.count == 0 {
+		return nil, 0
+	}
+
+	for i, m := range sw.Snapshot() {
+		if i == 0 {
+			loss = m.LossRate
+		} else {
+			loss = alpha*m.LossRate + (1-alpha)*loss
+		}
+		if m.RTTMs == nil {
+			continue
+		}
+		if rtt == nil {
+			v := *m.RTTMs
+			rtt = &v
+		} else {
+			*rtt = alpha**m.RTTMs + (1-alpha)**rtt
+		}
+	}
+	return rtt, loss
+}
+
+// Snapshot 按时间先后返回窗口内的全部样本
+func (sw *SlidingWindow) Snapshot() []Measurement {
+	// 窗口未满时最早的样本在 0，已满时在 position
+	start := 0
+	if sw.count == sw.maxSize {
+		start = sw.position
+	}
+	result := make([]Measurement, 0, sw.count)
+	for i := 0; i < sw.count; i++ {
+		result = append(result, sw.data[(start+i)%sw.maxSize])
+	}
+	return result
+}
+
+// GetJitter 获取抖动：窗口内成功测量 RTT 的标准差
+// 成功样本少于 2 个时返回 0
+func (sw *SlidingWindow) GetJitter() float64 {
+	var rtts []float64
+	for i := 0; i < sw.count; i++ {
+		if m := sw.data[i]; m.RTTMs != nil {
+			rtts = append(rtts, *m.RTTMs)
+		}
+	}
+	if len(rtts) < 2 {
+		return 0
+	}
+
+	var sum float64
+	for _, rtt := range rtts {
+		sum += rtt
+	}
+	mean := sum / float64(len(rtts))
+
+	var variance float64
+	for _, rtt := range rtts {
+		variance += (rtt - mean) * (rtt - mean)
+	}
+	return math.Sqrt(variance / float64(len(rtts)))
+}
+
+// GetPercentiles 获取窗口内成功测量 RTT 的 p50/p95/p99（最近秩法）
+// 没有成功样本时 ok 为 false
+func (sw *SlidingWindow) GetPercentiles() (p50, p95, p99 float64, ok bool) {
+	var rtts []float64
+	for i := 0; i < sw.count; i++ {
+		if m := sw.data[i]; m.RTTMs != nil {
+			rtts = append(rtts, *m.RTTMs)
+		}
+	}
+	if len(rtts) == 0 {
+		return 0, 0, 0, false
+	}
+	sort.Float64s(rtts)
+	return percentile(rtts, 0.50), percentile(rtts, 0.95), percentile(rtts, 0.99), true
+}
+
+// percentile 按最近秩法返回已排序样本的 p 分位数（0 < p <= 1）
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
 // Len 返回当前数据量
 func (sw *SlidingWindow) Len() int {
 	return sw.count
 }
 
-// NewProber 创建新的探测器
-func NewProber(peerIPs []string, interval, timeout time.Duration, windowSize int) *Prober {
-	return NewProberWithLogger(peerIPs, interval, timeout, windowSize, nil)
+// NewActiveProber 创建新的主动探测器
+func NewActiveProber(peerIPs []string, interval, timeout time.Duration, windowSize int) *ActiveProber {
+	return NewActiveProberWithLogger(peerIPs, interval, timeout, windowSize, nil)
 }
 
-// NewProberWithLogger 创建新的探测器，使用指定的 Logger
-func NewProberWithLogger(peerIPs []string, interval, timeout time.Duration, windowSize int, logger logging.Logger) *Prober {
+// NewActiveProberWithLogger 创建新的主动探测器，使用指定的 Logger
+func NewActiveProberWithLogger(peerIPs []string, interval, timeout time.Duration, windowSize int, logger logging.Logger) *ActiveProber {
 	if logger == nil {
 		logger = logging.NewNopLogger()
 	}
 
 	buffers := make(map[string]*SlidingWindow)
+	schedule := make(map[string]*peerSchedule)
 	for _, ip := range peerIPs {
 		buffers[ip] = NewSlidingWindow(windowSize)
+		schedule[ip] = &peerSchedule{interval: interval}
 	}
 
-	return &Prober{
-		peerIPs:    peerIPs,
-		interval:   interval,
-		timeout:    timeout,
-		windowSize: windowSize,
-		buffers:    buffers,
-		logger:     logger,
-		stopCh:     make(chan struct{}),
+	return &ActiveProber{
+		peerIPs:     peerIPs,
+		interval:    interval,
+		minInterval: interval,
+		maxInterval: interval,
+		timeout:     timeout,
+		windowSize:  windowSize,
+		count:       1,
+		stretch:     1,
+		probeType:   config.ProbeTypeICMP,
+		privileged:  true,
+		peerOpts:    make(map[string]PeerOptions),
+		buffers:     buffers,
+		schedule:    schedule,
+		logger:      logger,
+		stopCh:      make(chan struct{}),
 	}
 }
 
-// ProbeOnce 执行一次探测
-func (p *Prober) ProbeOnce(targetIP string) Measurement {
+// OnMeasurement 注册探测结果回调，每轮探测得到结果并写入滑动窗口后调用
+//
+// 回调在探测协程中同步调用，不持有探测器的锁，可以读取探测器的指标；
+// 回调阻塞会推迟后续对端的探测，耗时的处理应交给其他协程。
+func (p *ActiveProber) OnMeasurement(fn func(target string, m Measurement)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hooks = append(p.hooks, fn)
+}
+
+// SetDownThreshold 设置连续失败多少轮后判定链路中断，0 表示不判定，需在 Start 之前调用
+// 判定中断后该对端上报为不可达（不再使用窗口平均），直到再次探测成功
+func (p *ActiveProber) SetDownThreshold(failures int) {
+	if failures < 0 {
+		failures = 0
+	}
+	p.downAfter = failures
+}
+
+// OnLinkDown 注册链路中断回调，对端连续失败达到阈值时调用一次，恢复后再次达到阈值时再调用
+// 回调的调用方式与 OnMeasurement 相同
+func (p *ActiveProber) OnLinkDown(fn func(target string)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onDown = append(p.onDown, fn)
+}
+
+// isDown 判断对端是否已因连续失败被判定中断，调用方需持有锁
+func (p *ActiveProber) isDown(ip string) bool {
+	sched, ok := p.schedule[ip]
+	return ok && p.downAfter > 0 && sched.failures >= p.downAfter
+}
+
+// Peers 返回当前的探测目标
+func (p *ActiveProber) Peers() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]string(nil), p.peerIPs...)
+}
+
+// SetPeers 替换探测目标，可以在运行期间调用
+// 保留的对端沿用已有的滑动窗口和探测进度，新增的对端在下一拍立即探测，移除的对端丢弃其数据；
+// 返回新增和移除的对端
+func (p *ActiveProber) SetPeers(peerIPs []string) (added, removed []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keep := make(map[string]bool, len(peerIPs))
+	peers := make([]string, 0, len(peerIPs))
+	for _, ip := range peerIPs {
+		if keep[ip] {
+			continue
+		}
+		keep[ip] = true
+		peers = append(peers, ip)
+		if _, ok := p.buffers[ip]; !ok {
+			p.buffers[ip] = NewSlidingWindow(p.windowSize)
+			p.schedule[ip] = &peerSchedule{interval: p.probeFor(ip).interval}
+			added = append(added, ip)
+		}
+	}
+	for _, ip := range p.peerIPs {
+		if !keep[ip] {
+			delete(p.buffers, ip)
+			delete(p.schedule, ip)
+			removed = append(removed, ip)
+		}
+	}
+	p.peerIPs = peers
+	return added, removed
+}
+
+// SetProbeType 设置探测方式，tcpPort 为 tcp 探测连接的对端端口，需在 Start 之前调用
+func (p *ActiveProber) SetProbeType(probeType string, tcpPort int) {
+	p.probeType = probeType
+	p.tcpPort = tcpPort
+}
+
+// SetTWAMPPort 设置 twamp 探测发往的对端 TWAMP-light 反射端口，需在 Start 之前调用
+func (p *ActiveProber) SetTWAMPPort(port int) {
+	p.twampPort = port
+}
+
+// SetPeerOptions 为单个对端设置探测参数，需在 SetAdaptiveInterval 之后、Start 之前调用
+func (p *ActiveProber) SetPeerOptions(ip string, opts PeerOptions) {
+	p.peerOpts[ip] = opts
+	if sched, ok := p.schedule[ip]; ok {
+		sched.interval = p.probeFor(ip).interval
+	}
+}
+
+// probeFor 返回对端生效的探测参数
+// 单独配置了周期的对端，自适应范围扩展到包含该周期；全局未启用自适应时固定按该周期探测
+func (p *ActiveProber) probeFor(ip string) peerProbe {
+	probe := peerProbe{
+		interval:    p.interval,
+		minInterval: p.minInterval,
+		maxInterval: p.maxInterval,
+		timeout:     p.timeout,
+		probeType:   p.probeType,
+	}
+	opts, ok := p.peerOpts[ip]
+	if !ok {
+		return probe
+	}
+	if opts.Interval > 0 {
+		probe.interval = opts.Interval
+		if p.minInterval == p.maxInterval {
+			probe.minInterval, probe.maxInterval = opts.Interval, opts.Interval
+		} else {
+			if opts.Interval < probe.minInterval {
+				probe.minInterval = opts.Interval
+			}
+			if opts.Interval > probe.maxInterval {
+				probe.maxInterval = opts.Interval
+			}
+		}
+	}
+	if opts.Timeout > 0 {
+		probe.timeout = opts.Timeout
+	}
+	if opts.ProbeType != "" {
+		probe.probeType = opts.ProbeType
+	}
+	return probe
+}
+
+// SetAdaptiveInterval 设置自适应探测周期的上下限，需在 Start 之前调用
+// 劣化或抖动的链路立即缩短到 min，连续稳定的链路逐次加倍直到 max
+func (p *ActiveProber) SetAdaptiveInterval(min, max time.Duration) {
+	if min <= 0 || min > p.interval {
+		min = p.interval
+	}
+	if max < p.interval {
+		max = p.interval
+	}
+	p.minInterval = min
+	p.maxInterval = max
+}
+
+// SetSmoothing 设置上报指标的平滑方式，需在 Start 之前调用
+// ewma 对链路突然劣化反应更快，alpha 越大越偏重最新样本；其他取值使用窗口平均
+func (p *ActiveProber) SetSmoothing(mode string, alpha float64) {
+	p.ewmaAlpha = 0
+	if mode == config.SmoothingEWMA && alpha > 0 && alpha <= 1 {
+		p.ewmaAlpha = alpha
+	}
+}
+
+// smoothed 按配置的平滑方式返回窗口的 RTT 和丢包率
+func (p *ActiveProber) smoothed(sw *SlidingWindow) (*float64, float64) {
+	if p.ewmaAlpha > 0 {
+		return sw.GetEWMA(p.ewmaAlpha)
+	}
+	return sw.GetAverage()
+}
+
+// SetBudget 设置所有对端合计的探测流量上限，0 表示不限，需在 Start 之前调用
+// 按各探测方式的估算流量计算，超出时所有对端的探测周期按同一倍数拉长，适用于按流量计费的 LTE 备份链路
+func (p *ActiveProber) SetBudget(packetsPerSec, bytesPerSec float64) {
+	p.maxPPS = math.Max(packetsPerSec, 0)
+	p.maxBPS = math.Max(bytesPerSec, 0)
+}
+
+// budgetStretch 按当前各对端的探测周期估算总流量，返回满足流量上限需要拉长的倍数，调用方需持有锁
+func (p *ActiveProber) budgetStretch() float64 {
+	if p.maxPPS <= 0 && p.maxBPS <= 0 {
+		return 1
+	}
+	var pps, bps float64
+	for _, ip := range p.peerIPs {
+		probe := p.probeFor(ip)
+		rounds := 1 / p.schedule[ip].interval.Seconds()
+		cost := probeCosts[probe.probeType]
+		pps += float64(p.count*cost.packets) * rounds
+		bps += float64(p.count*cost.bytes) * rounds
+	}
+	stretch := 1.0
+	if p.maxPPS > 0 && pps > p.maxPPS {
+		stretch = pps / p.maxPPS
+	}
+	if p.maxBPS > 0 && bps/p.maxBPS > stretch {
+		stretch = bps / p.maxBPS
+	}
+	return stretch
+}
+
+// BudgetStretch 返回为满足流量上限，探测周期当前被拉长的倍数
+func (p *ActiveProber) BudgetStretch() float64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.stretch
+}
+
+// SetJitter 设置探测节拍的随机抖动，需在 Start 之前调用
+// 首轮探测推迟 [0, jitter)，之后每个节拍额外等待 [0, jitter)，使周期相同的大量 Agent 错开探测和上报
+func (p *ActiveProber) SetJitter(jitter time.Duration) {
+	if jitter < 0 {
+		jitter = 0
+	}
+	p.jitter = jitter
+}
+
+// randomJitter 返回 [0, jitter) 内的随机时间，未设置抖动时为 0
+func (p *ActiveProber) randomJitter() time.Duration {
+	if p.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(p.jitter))) // #nosec G404 -- scheduling jitter only
+}
+
+// SetCount 设置每轮发送的探测包数及包间隔，需在 Start 之前调用
+func (p *ActiveProber) SetCount(count int, packetInterval time.Duration) {
+	if count < 1 {
+		count = 1
+	}
+	p.count = count
+	p.packetGap = packetInterval
+}
+
+// SetHTTPProbe 设置 http 探测访问的对端健康检查端口，需在 Start 之前调用
+// 对端以隧道地址访问，证书无法按主机名校验，而探测只关心时延，因此 HTTPS 不校验证书
+func (p *ActiveProber) SetHTTPProbe(port int, useTLS bool) {
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	p.httpURL = scheme + "://%s" + pingPath
+	if port > 0 {
+		p.httpURL = scheme + "://%s:" + strconv.Itoa(port) + pingPath
+	}
+	p.httpClient = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				host, _, err := net.SplitHostPort(addr)
+				if err != nil {
+					return nil, err
+				}
+				d, err := p.dialer(network, host, 0)
+				if err != nil {
+					return nil, err
+				}
+				return d.DialContext(ctx, network, addr)
+			},
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: true}, // #nosec G402 -- only latency is measured
+			MaxIdleConnsPerHost: 1,
+		},
+	}
+}
+
+// SetSource 设置探测包的源地址，需在 Start 之前调用，sourceIP 优先于 iface
+// iface 非空时每次探测按对端的地址族取该网卡上的地址，网卡地址变化（如 DHCP 续租）后自动跟随
+func (p *ActiveProber) SetSource(sourceIP, iface string) {
+	p.sourceIP = net.ParseIP(sourceIP)
+	p.sourceIface = iface
+}
+
+// sourceFor 返回探测 targetIP 使用的源地址，未设置源地址时返回 nil
+// 按网卡取地址时跳过 IPv6 链路本地地址，它们只能访问同一链路上的对端
+func (p *ActiveProber) sourceFor(targetIP string) (net.IP, error) {
+	if p.sourceIP != nil || p.sourceIface == "" {
+		return p.sourceIP, nil
+	}
+
+	ifi, err := net.InterfaceByName(p.sourceIface)
+	if err != nil {
+		return nil, fmt.Errorf("probe interface %s: %w", p.sourceIface, err)
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("probe interface %s: %w", p.sourceIface, err)
+	}
+	target := net.ParseIP(targetIP)
+	wantV4 := target == nil || target.To4() != nil
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || (ipNet.IP.To4() != nil) != wantV4 || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		return ipNet.IP, nil
+	}
+	family := "IPv6"
+	if wantV4 {
+		family = "IPv4"
+	}
+	return nil, fmt.Errorf("probe interface %s has no %s address", p.sourceIface, family)
+}
+
+// dialer 返回探测 targetIP 使用的 Dialer，设置了源地址时绑定到该地址
+func (p *ActiveProber) dialer(network, targetIP string, timeout time.Duration) (*net.Dialer, error) {
+	d := &net.Dialer{Timeout: timeout}
+	src, err := p.sourceFor(targetIP)
+	if err != nil || src == nil {
+		return d, err
+	}
+	if strings.HasPrefix(network, "udp") {
+		d.LocalAddr = &net.UDPAddr{IP: src}
+	} else {
+		d.LocalAddr = &net.TCPAddr{IP: src}
+	}
+	return d, nil
+}
+
+// SetPrivileged 设置 icmp 探测是否使用原始套接字，需在 Start 之前调用
+// false 时使用无特权的 UDP ICMP 套接字（Linux 需要 net.ipv4.ping_group_range 包含运行用户的组）
+func (p *ActiveProber) SetPrivileged(privileged bool) {
+	p.privileged = privileged
+}
+
+// Privileged 返回 icmp 探测是否使用原始套接字
+func (p *ActiveProber) Privileged() bool {
+	return p.privileged
+}
+
+// SetSystemEcho 设置 icmp 探测是否使用系统的 ICMP Echo API（Windows 的 IcmpSendEcho2），需在 Start 之前调用
+// Windows 上原始套接字需要管理员权限且接收不可靠，也没有 UDP ICMP 套接字，系统 API 由 iphlpapi.dll 代为收发
+func (p *ActiveProber) SetSystemEcho(enabled bool) {
+	p.systemEcho = enabled
+}
+
+// SystemEcho 返回 icmp 探测是否使用系统的 ICMP Echo API
+func (p *ActiveProber) SystemEcho() bool {
+	return p.systemEcho
+}
+
+// DetectICMPMode 向本机回环地址各 ping 一次，返回可用的 icmp 探测模式
+// Windows 上优先使用系统 API，其他平台优先使用原始套接字；都不可用时返回错误
+func DetectICMPMode(timeout time.Duration) (string, error) {
+	if systemEchoSupported {
+		if _, err := icmpEcho(net.IPv4(127, 0, 0, 1), nil, timeout); err == nil {
+			return config.ICMPModeSystem, nil
+		}
+	}
+	var lastErr error
+	for _, mode := range []string{config.ICMPModePrivileged, config.ICMPModeUnprivileged} {
+		pinger, err := probing.NewPinger("127.0.0.1")
+		if err != nil {
+			return "", err
+		}
+		pinger.Count = 1
+		pinger.Timeout = timeout
+		pinger.SetPrivileged(mode == config.ICMPModePrivileged)
+		if lastErr = pinger.Run(); lastErr == nil {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("no usable ICMP socket: %w", lastErr)
+}
+
+// ProbeType 返回探测方式
+func (p *ActiveProber) ProbeType() string {
+	return p.probeType
+}
+
+// ProbeOnce 按对端的探测方式执行一轮探测，发送 count 个探测包并汇总为一个测量结果
+func (p *ActiveProber) ProbeOnce(targetIP string) Measurement {
+	cfg := p.probeFor(targetIP)
+	var probe func(string, time.Duration) Measurement
+	switch cfg.probeType {
+	case config.ProbeTypeTCP:
+		probe = p.probeTCP
+	case config.ProbeTypeHTTP:
+		probe = p.probeHTTP
+	case config.ProbeTypeTWAMP:
+		probe = p.probeTWAMP
+	default:
+		if !p.systemEcho {
+			// go-ping 自行按间隔发送多个包并统计
+			return p.probeICMP(targetIP, cfg.timeout)
+		}
+		probe = p.probeSystemEcho
+	}
+
+	samples := make([]Measurement, 0, p.count)
+	for i := 0; i < p.count; i++ {
+		if i > 0 {
+			time.Sleep(p.packetGap)
+		}
+		samples = append(samples, probe(targetIP, cfg.timeout))
+	}
+	return aggregateMeasurements(samples)
+}
+
+// aggregateMeasurements 汇总一轮内的多次测量：RTT 取成功样本的平均值，丢包率为失败样本的比例
+func aggregateMeasurements(samples []Measurement) Measurement {
+	if len(samples) == 1 {
+		return samples[0]
+	}
+
+	var rttSum float64
+	var received int
+	for _, m := range samples {
+		if m.RTTMs != nil {
+			rttSum += *m.RTTMs
+			received++
+		}
+	}
+
+	result := Measurement{LossRate: 1.0, Time: time.Now()}
+	if received > 0 {
+		avg := rttSum / float64(received)
+		result.RTTMs = &avg
+		result.LossRate = float64(len(samples)-received) / float64(len(samples))
+	}
+	return result
+}
+
+// probeHTTP 请求对端健康检查服务的 /ping，以发出请求到收到响应首字节的时间作为 RTT
+// 连接在探测之间复用，因此结果不含建连耗时，但包含对端进程的调度延迟；
+// 对端返回任何 HTTP 响应都视为可达
+func (p *ActiveProber) probeHTTP(targetIP string, timeout time.Duration) Measurement {
+	host := targetIP
+	if ip := net.ParseIP(targetIP); ip != nil && ip.To4() == nil {
+		host = "[" + targetIP + "]"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(p.httpURL, host), nil)
+	if err != nil {
+		return Measurement{RTTMs: nil, LossRate: 1.0, Time: time.Now()}
+	}
+
+	var wrote, firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		WroteRequest:         func(httptrace.WroteRequestInfo) { wrote = time.Now() },
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}
+	resp, err := p.httpClient.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		p.logger.Debug("HTTP probe failed",
+			logging.F("target_ip", targetIP),
+			logging.F("error", err.Error()),
+		)
+		return Measurement{RTTMs: nil, LossRate: 1.0, Time: time.Now()}
+	}
+	// 读完响应体以便连接复用
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	rttMs := float64(firstByte.Sub(wrote).Microseconds()) / 1000.0
+	return Measurement{RTTMs: &rttMs, LossRate: 0, Time: time.Now()}
+}
+
+// probeTCP 以 TCP 连接建立耗时作为 RTT
+// 对端回复 SYN-ACK 或 RST 都只需一个往返，因此端口未监听（连接被拒绝）同样视为可达
+func (p *ActiveProber) probeTCP(targetIP string, timeout time.Duration) Measurement {
+	d, err := p.dialer("tcp", targetIP, timeout)
+	var conn net.Conn
+	start := time.Now()
+	if err == nil {
+		conn, err = d.Dial("tcp", net.JoinHostPort(targetIP, strconv.Itoa(p.tcpPort)))
+	}
+	elapsed := time.Since(start)
+	if err == nil {
+		_ = conn.Close()
+	} else if !errors.Is(err, syscall.ECONNREFUSED) {
+		p.logger.Debug("TCP probe failed",
+			logging.F("target_ip", targetIP),
+			logging.F("port", p.tcpPort),
+			logging.F("error", err.Error()),
+		)
+		return Measurement{RTTMs: nil, LossRate: 1.0, Time: time.Now()}
+	}
+
+	rttMs := float64(elapsed.Microseconds()) / 1000.0
+	return Measurement{RTTMs: &rttMs, LossRate: 0, Time: time.Now()}
+}
+
+// probeSystemEcho 通过系统的 ICMP Echo API 发送一个 ICMP Echo 请求
+func (p *ActiveProber) probeSystemEcho(targetIP string, timeout time.Duration) Measurement {
+	var rtt time.Duration
+	src, err := p.sourceFor(targetIP)
+	if err == nil {
+		if target := net.ParseIP(targetIP); target != nil {
+			rtt, err = icmpEcho(target, src, timeout)
+		} else {
+			err = fmt.Errorf("invalid target address %q", targetIP)
+		}
+	}
+	if err != nil {
+		p.logger.Debug("ICMP echo failed",
+			logging.F("target_ip", targetIP),
+			logging.F("error", err.Error()),
+		)
+		return Measurement{RTTMs: nil, LossRate: 1.0, Time: time.Now()}
+	}
+
+	rttMs := float64(rtt.Microseconds()) / 1000.0
+	return Measurement{RTTMs: &rttMs, LossRate: 0, Time: time.Now()}
+}
+
+// probeICMP 发送一个 ICMP Echo 请求
+func (p *ActiveProber) probeICMP(targetIP string, timeout time.Duration) Measurement {
 	pinger, err := probing.NewPinger(targetIP)
 	if err != nil {
 		p.logger.Error("Failed to create pinger",
@@ -129,9 +831,22 @@ func (p *Prober) ProbeOnce(targetIP string) Measurement {
 		return Measurement{RTTMs: nil, LossRate: 1.0, Time: time.Now()}
 	}
 
-	pinger.Count = 1
-	pinger.Timeout = p.timeout
-	pinger.SetPrivileged(true) // 需要 root 权限
+	pinger.Count = p.count
+	pinger.Interval = p.packetGap
+	// timeout 是单个包的等待时间，整轮的截止时间需要加上发送其余包所需的时间
+	pinger.Timeout = timeout + time.Duration(p.count-1)*p.packetGap
+	pinger.SetPrivileged(p.privileged)
+	src, err := p.sourceFor(targetIP)
+	if err != nil {
+		p.logger.Error("Failed to resolve probe source address",
+			logging.F("target_ip", targetIP),
+			logging.F("error", err.Error()),
+		)
+		return Measurement{RTTMs: nil, LossRate: 1.0, Time: time.Now()}
+	}
+	if src != nil {
+		pinger.Source = src.String()
+	}
 
 	err = pinger.Run()
 	if err != nil {
@@ -150,7 +865,8 @@ func (p *Prober) ProbeOnce(targetIP string) Measurement {
 	if stats.PacketsRecv > 0 {
 		rttMs := float64(stats.AvgRtt.Microseconds()) / 1000.0
 		rtt = &rttMs
-		lossRate = float64(stats.PacketsSent-stats.PacketsRecv) / float64(stats.PacketsSent)
+		// 截止时间到达时可能还有包未发出，按计划发送的包数计算
+		lossRate = float64(p.count-stats.PacketsRecv) / float64(p.count)
 	} else {
 		lossRate = 1.0
 	}
@@ -159,7 +875,7 @@ func (p *Prober) ProbeOnce(targetIP string) Measurement {
 }
 
 // Start 启动探测循环
-func (p *Prober) Start() {
+func (p *ActiveProber) Start() {
 	p.mu.Lock()
 	if p.running {
 		p.mu.Unlock()
@@ -171,35 +887,96 @@ func (p *Prober) Start() {
 	go p.run()
 }
 
-// run 探测循环
-func (p *Prober) run() {
-	ticker := time.NewTicker(p.interval)
-	defer ticker.Stop()
-
-	// 立即执行一次
-	p.probeAll()
+// run 探测循环，以所有对端中最短的周期为节拍，每拍只探测到期的对端
+// 设置了抖动时每个节拍的间隔在 [tick, tick+jitter) 内随机，首轮在 [0, jitter) 内随机
+func (p *ActiveProber) run() {
+	timer := time.NewTimer(p.randomJitter())
+	defer timer.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
-			p.probeAll()
+		case now := <-timer.C:
+			p.probeAll(now)
+			timer.Reset(p.tick() + p.randomJitter())
 		case <-p.stopCh:
 			return
 		}
 	}
 }
 
-// probeAll 探测所有对等节点
-func (p *Prober) probeAll() {
-	for _, ip := range p.peerIPs {
+// tick 返回探测循环的节拍
+func (p *ActiveProber) tick() time.Duration {
+	tick := p.minInterval
+	for _, ip := range p.Peers() {
+		if probe := p.probeFor(ip); probe.minInterval < tick {
+			tick = probe.minInterval
+		}
+	}
+	return tick
+}
+
+// probeAll 探测所有在 now 之前到期的对等节点
+func (p *ActiveProber) probeAll(now time.Time) {
+	// 到期时间按节拍计算，留出半个节拍的余量，避免因探测耗时错过本拍
+	deadline := now.Add(p.tick() / 2)
+
+	p.mu.Lock()
+	stretch, prevStretch := p.budgetStretch(), p.stretch
+	p.stretch = stretch
+	p.mu.Unlock()
+	// 只在开始或停止拉长时记录，自适应周期变化引起的倍数波动不记录
+	if (stretch > 1) != (prevStretch > 1) {
+		p.logger.Info("Probe intervals adjusted to fit traffic budget",
+			logging.F("stretch", stretch),
+		)
+	}
+
+	for _, ip := range p.Peers() {
+		p.mu.RLock()
+		sched, ok := p.schedule[ip]
+		due := ok && !sched.next.After(deadline)
+		p.mu.RUnlock()
+		if !due {
+			continue
+		}
+
 		m := p.ProbeOnce(ip)
 
+		// 探测期间对端可能已被 SetPeers 移除
 		p.mu.Lock()
-		if sw, ok := p.buffers[ip]; ok {
+		sw, tracked := p.buffers[ip]
+		wentDown := false
+		if tracked {
+			sched := p.schedule[ip]
+			prevRTT, _ := p.smoothed(sw)
+			sched.interval = p.probeFor(ip).nextInterval(sched.interval, m, prevRTT)
+			sched.next = now.Add(time.Duration(float64(sched.interval) * stretch))
 			sw.Add(m)
+			if m.RTTMs == nil {
+				sched.failures++
+				wentDown = sched.failures == p.downAfter
+			} else {
+				sched.failures = 0
+			}
 		}
+		hooks, onDown := p.hooks, p.onDown
 		p.mu.Unlock()
 
+		if tracked {
+			for _, fn := range hooks {
+				fn(ip, m)
+			}
+		}
+		if wentDown {
+			p.logger.Warn("Link down after consecutive probe failures",
+				logging.F("target_ip", ip),
+				logging.F("failures", p.downAfter),
+			)
+			for _, fn := range onDown {
+				fn(ip)
+			}
+		}
+
 		if m.RTTMs != nil {
 			p.logger.Debug("Probe result",
 				logging.F("target_ip", ip),
@@ -214,8 +991,28 @@ func (p *Prober) probeAll() {
 	}
 }
 
+// nextInterval 根据本轮结果计算对端的下一个探测周期
+// 有丢包、不可达或 RTT 相对窗口平均值变化明显时缩短到最短周期，否则加倍直到最长周期
+func (c peerProbe) nextInterval(current time.Duration, m Measurement, prevRTT *float64) time.Duration {
+	if c.minInterval == c.maxInterval {
+		return c.interval
+	}
+	unstable := m.RTTMs == nil || m.LossRate > 0
+	if !unstable && prevRTT != nil && *prevRTT > 0 {
+		unstable = math.Abs(*m.RTTMs-*prevRTT) / *prevRTT > adaptiveRTTChange
+	}
+	if unstable {
+		return c.minInterval
+	}
+	next := current * 2
+	if next > c.maxInterval {
+		next = c.maxInterval
+	}
+	return next
+}
+
 // Stop 停止探测
-func (p *Prober) Stop() {
+func (p *ActiveProber) Stop() {
 	p.mu.Lock()
 	if !p.running {
 		p.mu.Unlock()
@@ -227,28 +1024,38 @@ func (p *Prober) Stop() {
 	close(p.stopCh)
 }
 
-// GetMetrics 获取当前指标（使用移动平均）
-func (p *Prober) GetMetrics() []models.Metric {
+// GetMetrics 获取当前指标（使用移动平均，平滑方式见 SetSmoothing）
+func (p *ActiveProber) GetMetrics() []models.Metric {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
 	metrics := make([]models.Metric, 0, len(p.peerIPs))
 	for _, ip := range p.peerIPs {
+		if p.isDown(ip) {
+			metrics = append(metrics, models.Metric{TargetIP: ip, RTTMs: nil, LossRate: 1.0})
+			continue
+		}
+
 		sw := p.buffers[ip]
-		avgRTT, avgLoss := sw.GetAverage()
+		avgRTT, avgLoss := p.smoothed(sw)
 
-		metrics = append(metrics, models.Metric{
+		metric := models.Metric{
 			TargetIP: ip,
 			RTTMs:    avgRTT,
 			LossRate: avgLoss,
-		})
+			JitterMs: sw.GetJitter(),
+		}
+		if p50, p95, p99, ok := sw.GetPercentiles(); ok {
+			metric.RTTP50Ms, metric.RTTP95Ms, metric.RTTP99Ms = p50, p95, p99
+		}
+		metrics = append(metrics, metric)
 	}
 
 	return metrics
 }
 
 // GetRawMetrics 获取原始指标（最新一次测量）
-func (p *Prober) GetRawMetrics() []models.Metric {
+func (p *ActiveProber) GetRawMetrics() []models.Metric {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
@@ -273,8 +1080,53 @@ func (p *Prober) GetRawMetrics() []models.Metric {
 	return metrics
 }
 
+// PeerHistory 单个对端滑动窗口中的原始测量结果，供现场排查使用
+type PeerHistory struct {
+	Target              string        `json:"target"`
+	ProbeType           string        `json:"probe_type"`
+	IntervalMs          int64         `json:"interval_ms"` // 当前探测周期，自适应时随链路状态变化
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	Down                bool          `json:"down"` // 已因连续失败被判定中断
+	Measurements        []ProbeRecord `json:"measurements"`
+}
+
+// ProbeRecord 一轮探测的结果，rtt_ms 为空表示本轮全部丢失
+type ProbeRecord struct {
+	Time     string   `json:"time"`
+	RTTMs    *float64 `json:"rtt_ms"`
+	LossRate float64  `json:"loss_rate"`
+}
+
+// GetHistory 返回每个对端滑动窗口中的测量结果，按对端顺序排列，测量结果按时间先后排列
+func (p *ActiveProber) GetHistory() []PeerHistory {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result := make([]PeerHistory, 0, len(p.peerIPs))
+	for _, ip := range p.peerIPs {
+		sched := p.schedule[ip]
+		h := PeerHistory{
+			Target:              ip,
+			ProbeType:           p.probeFor(ip).probeType,
+			IntervalMs:          sched.interval.Milliseconds(),
+			ConsecutiveFailures: sched.failures,
+			Down:                p.isDown(ip),
+			Measurements:        []ProbeRecord{},
+		}
+		for _, m := range p.buffers[ip].Snapshot() {
+			h.Measurements = append(h.Measurements, ProbeRecord{
+				Time:     m.Time.Format(time.RFC3339Nano),
+				RTTMs:    m.RTTMs,
+				LossRate: m.LossRate,
+			})
+		}
+		result = append(result, h)
+	}
+	return result
+}
+
 // GetLastProbeTime 获取最后探测时间
-func (p *Prober) GetLastProbeTime() *time.Time {
+func (p *ActiveProber) GetLastProbeTime() *time.Time {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
@@ -294,7 +1146,7 @@ func (p *Prober) GetLastProbeTime() *time.Time {
 }
 
 // GetSuccessRate 获取探测成功率
-func (p *Prober) GetSuccessRate() float64 {
+func (p *ActiveProber) GetSuccessRate() float64 {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
@@ -317,7 +1169,7 @@ func (p *Prober) GetSuccessRate() float64 {
 }
 
 // IsRunning 检查探测器是否运行中
-func (p *Prober) IsRunning() bool {
+func (p *ActiveProber) IsRunning() bool {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 	return p.running
@@ -1,7 +1,13 @@
 package agent
 
 import (
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
 )
 
 func TestSlidingWindow(t *testing.T) {
@@ -57,6 +63,22 @@ func TestSlidingWindowAverage(t *testing.T) {
 	}
 }
 
+func TestSlidingWindowJitter(t *testing.T) {
+	sw := NewSlidingWindow(5)
+
+	sw.Add(Measurement{RTTMs: ptrFloat64(10.0)})
+	if jitter := sw.GetJitter(); jitter != 0 {
+		t.Errorf("jitter with one sample = %v, want 0", jitter)
+	}
+
+	sw.Add(Measurement{RTTMs: ptrFloat64(30.0)})
+	sw.Add(Measurement{RTTMs: nil, LossRate: 1.0})
+	// 超时样本不参与计算：{10, 30} 的标准差为 10
+	if jitter := sw.GetJitter(); jitter != 10.0 {
+		t.Errorf("jitter = %v, want 10", jitter)
+	}
+}
+
 func TestSlidingWindowWithTimeout(t *testing.T) {
 	sw := NewSlidingWindow(3)
 
@@ -138,3 +160,479 @@ func TestSlidingWindowOverflow(t *testing.T) {
 func ptrFloat64(v float64) *float64 {
 	return &v
 }
+
+func TestSlidingWindowPercentiles(t *testing.T) {
+	sw := NewSlidingWindow(20)
+	if _, _, _, ok := sw.GetPercentiles(); ok {
+		t.Error("Empty window should have no percentiles")
+	}
+
+	// 1..19 ms 加一次超时，超时不参与分位数
+	for i := 19; i >= 1; i-- {
+		sw.Add(Measurement{RTTMs: ptrFloat64(float64(i)), LossRate: 0.0})
+	}
+	sw.Add(Measurement{RTTMs: nil, LossRate: 1.0})
+
+	p50, p95, p99, ok := sw.GetPercentiles()
+	if !ok {
+		t.Fatal("Expected percentiles")
+	}
+	if p50 != 10 || p95 != 19 || p99 != 19 {
+		t.Errorf("Percentiles = %v/%v/%v, want 10/19/19", p50, p95, p99)
+	}
+}
+
+func TestSlidingWindowEWMA(t *testing.T) {
+	sw := NewSlidingWindow(3)
+	if rtt, _ := sw.GetEWMA(0.5); rtt != nil {
+		t.Error("Empty window should have no EWMA RTT")
+	}
+
+	// 窗口已满并回绕：按时间先后为 20、超时、40
+	sw.Add(Measurement{RTTMs: ptrFloat64(10.0), LossRate: 0.0})
+	sw.Add(Measurement{RTTMs: ptrFloat64(20.0), LossRate: 0.0})
+	sw.Add(Measurement{RTTMs: nil, LossRate: 1.0})
+	sw.Add(Measurement{RTTMs: ptrFloat64(40.0), LossRate: 0.0})
+
+	rtt, loss := sw.GetEWMA(0.75)
+	if rtt == nil || *rtt != 35.0 {
+		t.Errorf("EWMA RTT = %v, want 35", rtt)
+	}
+	// 0 → 0.75×1 + 0.25×0 = 0.75 → 0.75×0 + 0.25×0.75 = 0.1875
+	if loss != 0.1875 {
+		t.Errorf("EWMA loss = %v, want 0.1875", loss)
+	}
+
+	// 最新样本权重更大，因此比窗口平均更快反映劣化
+	avg, _ := sw.GetAverage()
+	if *rtt <= *avg {
+		t.Errorf("EWMA RTT %v should exceed average %v after a rise", *rtt, *avg)
+	}
+}
+
+func TestSetPeers(t *testing.T) {
+	p := NewActiveProber([]string{"10.254.0.2", "10.254.0.3"}, time.Second, time.Second, 3)
+	p.buffers["10.254.0.2"].Add(Measurement{RTTMs: ptrFloat64(10.0)})
+
+	added, removed := p.SetPeers([]string{"10.254.0.2", "10.254.0.4", "10.254.0.4"})
+	if len(added) != 1 || added[0] != "10.254.0.4" {
+		t.Errorf("added = %v, want [10.254.0.4]", added)
+	}
+	if len(removed) != 1 || removed[0] != "10.254.0.3" {
+		t.Errorf("removed = %v, want [10.254.0.3]", removed)
+	}
+	if peers := p.Peers(); len(peers) != 2 {
+		t.Errorf("peers = %v, want 2 entries", peers)
+	}
+
+	// 保留的对端沿用已有数据，新增的对端没有数据
+	metrics := p.GetMetrics()
+	if len(metrics) != 2 || metrics[0].RTTMs == nil || metrics[1].RTTMs != nil {
+		t.Errorf("metrics after SetPeers = %+v", metrics)
+	}
+}
+
+func TestOnMeasurement(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	p := NewActiveProber([]string{"127.0.0.1"}, time.Second, time.Second, 3)
+	p.SetProbeType("tcp", ln.Addr().(*net.TCPAddr).Port)
+
+	var got []string
+	p.OnMeasurement(func(target string, m Measurement) {
+		// 回调时结果已写入滑动窗口
+		if p.buffers[target].Len() != 1 || m.RTTMs == nil {
+			t.Errorf("hook called before measurement was stored: %+v", m)
+		}
+		got = append(got, target)
+	})
+	p.probeAll(time.Now())
+
+	if len(got) != 1 || got[0] != "127.0.0.1" {
+		t.Errorf("hook targets = %v, want [127.0.0.1]", got)
+	}
+}
+
+func TestRandomJitter(t *testing.T) {
+	p := NewActiveProber([]string{"10.254.0.2"}, time.Second, time.Second, 3)
+	if j := p.randomJitter(); j != 0 {
+		t.Errorf("randomJitter() without jitter = %v, want 0", j)
+	}
+
+	p.SetJitter(100 * time.Millisecond)
+	for i := 0; i < 100; i++ {
+		if j := p.randomJitter(); j < 0 || j >= 100*time.Millisecond {
+			t.Fatalf("randomJitter() = %v, want within [0, 100ms)", j)
+		}
+	}
+}
+
+func TestBudgetStretch(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	// 两个对端每秒各一次 tcp 探测，估算 10 包/秒、600 字节/秒
+	p := NewActiveProber([]string{"127.0.0.1", "127.0.0.2"}, time.Second, time.Second, 10)
+	p.SetProbeType(config.ProbeTypeTCP, ln.Addr().(*net.TCPAddr).Port)
+	if s := p.budgetStretch(); s != 1 {
+		t.Errorf("stretch without budget = %v, want 1", s)
+	}
+
+	p.SetBudget(20, 0)
+	if s := p.budgetStretch(); s != 1 {
+		t.Errorf("stretch within budget = %v, want 1", s)
+	}
+
+	// 字节上限更严格时以字节为准
+	p.SetBudget(5, 200)
+	if s := p.budgetStretch(); s != 3 {
+		t.Errorf("stretch = %v, want 3", s)
+	}
+
+	now := time.Now()
+	p.probeAll(now)
+	if s := p.BudgetStretch(); s != 3 {
+		t.Errorf("BudgetStretch() = %v, want 3", s)
+	}
+	if next := p.schedule["127.0.0.1"].next; !next.Equal(now.Add(3 * time.Second)) {
+		t.Errorf("next probe = %v, want %v", next.Sub(now), 3*time.Second)
+	}
+}
+
+func TestLinkDownAfterConsecutiveFailures(t *testing.T) {
+	// http 探测已关闭的端口，每轮都失败
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	_ = ln.Close()
+
+	p := NewActiveProber([]string{"127.0.0.1"}, time.Second, time.Second, 10)
+	p.SetProbeType("http", 0)
+	p.SetHTTPProbe(port, false)
+	p.SetDownThreshold(3)
+	p.buffers["127.0.0.1"].Add(Measurement{RTTMs: ptrFloat64(10.0)})
+
+	var downs int
+	p.OnLinkDown(func(string) { downs++ })
+
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		if i == 2 {
+			// 窗口平均仍然可达
+			if m := p.GetMetrics()[0]; m.RTTMs == nil {
+				t.Fatalf("metric before threshold = %+v, want reachable", m)
+			}
+		}
+		p.probeAll(now.Add(time.Duration(i) * time.Second))
+	}
+
+	if downs != 1 {
+		t.Errorf("link down callbacks = %d, want 1", downs)
+	}
+	if m := p.GetMetrics()[0]; m.RTTMs != nil || m.LossRate != 1.0 {
+		t.Errorf("metric after threshold = %+v, want unreachable", m)
+	}
+}
+
+func TestGetHistory(t *testing.T) {
+	p := NewActiveProber([]string{"10.254.0.2", "10.254.0.3"}, time.Second, time.Second, 2)
+	base := time.Now()
+	for i, rtt := range []*float64{ptrFloat64(10), nil, ptrFloat64(30)} {
+		m := Measurement{RTTMs: rtt, Time: base.Add(time.Duration(i) * time.Second)}
+		if rtt == nil {
+			m.LossRate = 1.0
+		}
+		p.buffers["10.254.0.2"].Add(m)
+	}
+
+	history := p.GetHistory()
+	if len(history) != 2 || history[0].Target != "10.254.0.2" || len(history[1].Measurements) != 0 {
+		t.Fatalf("history = %+v", history)
+	}
+	// 窗口只保留最近两轮，按时间先后排列
+	got := history[0].Measurements
+	if len(got) != 2 || got[0].RTTMs != nil || got[1].RTTMs == nil || *got[1].RTTMs != 30 {
+		t.Errorf("measurements = %+v, want [timeout, 30ms]", got)
+	}
+	if history[0].IntervalMs != 1000 || history[0].ProbeType != "icmp" {
+		t.Errorf("history[0] = %+v", history[0])
+	}
+}
+
+func TestProbeTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	p := NewActiveProber([]string{"127.0.0.1"}, time.Second, time.Second, 3)
+	p.SetProbeType(config.ProbeTypeTCP, port)
+	if m := p.ProbeOnce("127.0.0.1"); m.RTTMs == nil || m.LossRate != 0 {
+		t.Errorf("probe of listening port = %+v, want RTT", m)
+	}
+
+	// 连接被拒绝说明对端可达，同样记录 RTT
+	_ = ln.Close()
+	if m := p.ProbeOnce("127.0.0.1"); m.RTTMs == nil || m.LossRate != 0 {
+		t.Errorf("probe of closed port = %+v, want RTT", m)
+	}
+}
+
+func TestProbeHTTP(t *testing.T) {
+	for _, useTLS := range []bool{false, true} {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(handlePing))
+		if useTLS {
+			srv.StartTLS()
+		} else {
+			srv.Start()
+		}
+		port := srv.Listener.Addr().(*net.TCPAddr).Port
+
+		p := NewActiveProber([]string{"127.0.0.1"}, time.Second, time.Second, 3)
+		p.SetProbeType(config.ProbeTypeHTTP, 0)
+		p.SetHTTPProbe(port, useTLS)
+		if m := p.ProbeOnce("127.0.0.1"); m.RTTMs == nil || m.LossRate != 0 {
+			t.Errorf("https=%v: probe = %+v, want RTT", useTLS, m)
+		}
+
+		// 对端服务不可用时记为丢包
+		srv.Close()
+		if m := p.ProbeOnce("127.0.0.1"); m.RTTMs != nil || m.LossRate != 1 {
+			t.Errorf("https=%v: probe of stopped server = %+v, want loss", useTLS, m)
+		}
+	}
+}
+
+func TestAggregateMeasurements(t *testing.T) {
+	rtt := func(v float64) *float64 { return &v }
+	samples := []Measurement{
+		{RTTMs: rtt(10), LossRate: 0},
+		{RTTMs: nil, LossRate: 1},
+		{RTTMs: rtt(20), LossRate: 0},
+		{RTTMs: rtt(30), LossRate: 0},
+	}
+	m := aggregateMeasurements(samples)
+	if m.RTTMs == nil || *m.RTTMs != 20 {
+		t.Errorf("RTT = %v, want 20", m.RTTMs)
+	}
+	if m.LossRate != 0.25 {
+		t.Errorf("LossRate = %v, want 0.25", m.LossRate)
+	}
+
+	m = aggregateMeasurements([]Measurement{{LossRate: 1}, {LossRate: 1}})
+	if m.RTTMs != nil || m.LossRate != 1 {
+		t.Errorf("all lost = %+v, want RTT nil and loss 1", m)
+	}
+}
+
+func TestProbeTCPCount(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	p := NewActiveProber([]string{"127.0.0.1"}, time.Second, time.Second, 3)
+	p.SetCount(3, time.Millisecond)
+	p.SetProbeType(config.ProbeTypeTCP, ln.Addr().(*net.TCPAddr).Port)
+	if m := p.ProbeOnce("127.0.0.1"); m.RTTMs == nil || m.LossRate != 0 {
+		t.Errorf("probe = %+v, want RTT and no loss", m)
+	}
+}
+
+func TestProbeSystemEcho(t *testing.T) {
+	p := NewActiveProber([]string{"127.0.0.1"}, time.Second, time.Second, 3)
+	p.SetCount(2, time.Millisecond)
+	p.SetSystemEcho(true)
+	m := p.ProbeOnce("127.0.0.1")
+	// 只有 Windows 提供系统的 ICMP Echo API，其他平台每个探测包都失败
+	if systemEchoSupported && (m.RTTMs == nil || m.LossRate != 0) {
+		t.Errorf("probe = %+v, want RTT and no loss", m)
+	}
+	if !systemEchoSupported && (m.RTTMs != nil || m.LossRate != 1) {
+		t.Errorf("probe = %+v, want total loss", m)
+	}
+}
+
+func TestNextInterval(t *testing.T) {
+	rtt := func(v float64) *float64 { return &v }
+	p := NewActiveProber([]string{"10.254.0.2"}, 4*time.Second, time.Second, 3)
+	p.SetAdaptiveInterval(time.Second, 16*time.Second)
+
+	stable := Measurement{RTTMs: rtt(10)}
+	if got := p.probeFor("10.254.0.2").nextInterval(4*time.Second, stable, rtt(10.5)); got != 8*time.Second {
+		t.Errorf("stable link: got %v, want 8s", got)
+	}
+	if got := p.probeFor("10.254.0.2").nextInterval(16*time.Second, stable, rtt(10)); got != 16*time.Second {
+		t.Errorf("stable link at max: got %v, want 16s", got)
+	}
+	if got := p.probeFor("10.254.0.2").nextInterval(16*time.Second, Measurement{RTTMs: rtt(10), LossRate: 0.1}, rtt(10)); got != time.Second {
+		t.Errorf("lossy link: got %v, want 1s", got)
+	}
+	if got := p.probeFor("10.254.0.2").nextInterval(16*time.Second, Measurement{LossRate: 1}, rtt(10)); got != time.Second {
+		t.Errorf("unreachable link: got %v, want 1s", got)
+	}
+	if got := p.probeFor("10.254.0.2").nextInterval(16*time.Second, Measurement{RTTMs: rtt(30)}, rtt(10)); got != time.Second {
+		t.Errorf("flapping link: got %v, want 1s", got)
+	}
+
+	// 未配置上下限时固定周期
+	fixed := NewActiveProber([]string{"10.254.0.2"}, 4*time.Second, time.Second, 3)
+	if got := fixed.probeFor("10.254.0.2").nextInterval(4*time.Second, Measurement{LossRate: 1}, nil); got != 4*time.Second {
+		t.Errorf("fixed interval: got %v, want 4s", got)
+	}
+}
+
+func TestProbeAllSkipsPeersNotDue(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	p := NewActiveProber([]string{"127.0.0.1"}, 4*time.Second, time.Second, 10)
+	p.SetAdaptiveInterval(time.Second, 16*time.Second)
+	p.SetProbeType(config.ProbeTypeTCP, ln.Addr().(*net.TCPAddr).Port)
+
+	now := time.Now()
+	p.probeAll(now)
+	p.probeAll(now.Add(time.Second)) // 稳定链路周期已延长，本拍不探测
+	if n := p.buffers["127.0.0.1"].count; n != 1 {
+		t.Errorf("samples = %d, want 1", n)
+	}
+	p.probeAll(now.Add(8 * time.Second))
+	if n := p.buffers["127.0.0.1"].count; n != 2 {
+		t.Errorf("samples = %d, want 2", n)
+	}
+}
+
+func TestPeerOptions(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	p := NewActiveProber([]string{"127.0.0.1", "10.254.0.3"}, 5*time.Second, time.Second, 3)
+	p.SetProbeType(config.ProbeTypeICMP, ln.Addr().(*net.TCPAddr).Port)
+	p.SetPeerOptions("127.0.0.1", PeerOptions{ProbeType: config.ProbeTypeTCP})
+	p.SetPeerOptions("10.254.0.3", PeerOptions{Interval: 30 * time.Second, Timeout: 5 * time.Second})
+
+	// 单独配置的探测方式生效
+	if m := p.ProbeOnce("127.0.0.1"); m.RTTMs == nil {
+		t.Errorf("tcp override probe = %+v, want RTT", m)
+	}
+
+	// 未启用自适应时固定按单独配置的周期探测，节拍取最短周期
+	slow := p.probeFor("10.254.0.3")
+	if slow.interval != 30*time.Second || slow.minInterval != 30*time.Second || slow.timeout != 5*time.Second {
+		t.Errorf("probeFor = %+v", slow)
+	}
+	if got := p.tick(); got != 5*time.Second {
+		t.Errorf("tick = %v, want 5s", got)
+	}
+	if got := p.schedule["10.254.0.3"].interval; got != 30*time.Second {
+		t.Errorf("initial interval = %v, want 30s", got)
+	}
+}
+
+func TestProbeIPv6(t *testing.T) {
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	p := NewActiveProber([]string{"::1"}, time.Second, time.Second, 3)
+	p.SetProbeType(config.ProbeTypeTCP, port)
+	if m := p.ProbeOnce("::1"); m.RTTMs == nil {
+		t.Errorf("tcp probe = %+v, want RTT", m)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(handlePing))
+	srv.Listener.Close()
+	srv.Listener = ln
+	srv.Start()
+	defer srv.Close()
+	p.SetProbeType(config.ProbeTypeHTTP, 0)
+	p.SetHTTPProbe(port, false)
+	if m := p.ProbeOnce("::1"); m.RTTMs == nil {
+		t.Errorf("http probe = %+v, want RTT", m)
+	}
+}
+
+func TestSourceFor(t *testing.T) {
+	p := NewActiveProber([]string{"127.0.0.1"}, time.Second, time.Second, 3)
+	if src, err := p.sourceFor("127.0.0.1"); err != nil || src != nil {
+		t.Errorf("sourceFor() without source = %v, %v, want nil", src, err)
+	}
+
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("loopback interface unavailable: %v", err)
+	}
+	p.SetSource("", lo.Name)
+	if src, err := p.sourceFor("127.0.0.1"); err != nil || !src.IsLoopback() || src.To4() == nil {
+		t.Errorf("sourceFor() from %s = %v, %v, want IPv4 loopback", lo.Name, src, err)
+	}
+
+	p.SetSource("", "sdwan-missing0")
+	if _, err := p.sourceFor("127.0.0.1"); err == nil {
+		t.Error("sourceFor() from missing interface returned no error")
+	}
+	if m := p.ProbeOnce("127.0.0.1"); m.RTTMs != nil {
+		t.Errorf("probe from missing interface = %+v, want failure", m)
+	}
+}
+
+func TestProbeTCPSourceIP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	remote := make(chan net.Addr, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		remote <- conn.RemoteAddr()
+		_ = conn.Close()
+	}()
+
+	// Linux 上整个 127.0.0.0/8 都属于回环网卡，可以作为源地址
+	p := NewActiveProber([]string{"127.0.0.1"}, time.Second, time.Second, 3)
+	p.SetProbeType(config.ProbeTypeTCP, ln.Addr().(*net.TCPAddr).Port)
+	p.SetSource("127.0.0.2", "")
+	if m := p.ProbeOnce("127.0.0.1"); m.RTTMs == nil {
+		t.Skipf("cannot bind to 127.0.0.2: %+v", m)
+	}
+	if addr := <-remote; !addr.(*net.TCPAddr).IP.Equal(net.ParseIP("127.0.0.2")) {
+		t.Errorf("source address = %v, want 127.0.0.2", addr)
+	}
+}
+
+func TestProberPrivileged(t *testing.T) {
+	p := NewActiveProber([]string{"10.254.0.2"}, time.Second, time.Second, 3)
+	if !p.Privileged() {
+		t.Error("icmp probes should use raw sockets by default")
+	}
+
+	p.SetPrivileged(false)
+	if p.Privileged() {
+		t.Error("SetPrivileged(false) should switch to unprivileged UDP ICMP sockets")
+	}
+}
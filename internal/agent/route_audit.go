@@ -0,0 +1,291 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+)
+
+// 路由变更的动作
+const (
+	RouteChangeInstall = "install" // 新增或替换路由
+	RouteChangeDelete  = "delete"
+	RouteChangeFlush   = "flush" // 清空整个路由表
+)
+
+// 不是由 Controller 下发的路由引起的变更原因，Controller 下发的路由使用路由自身的 reason
+const (
+	changeReasonFallback  = "fallback"    // Controller 不可达，清空中继路由恢复直连
+	changeReasonShutdown  = "shutdown"    // Agent 退出时删除安装的路由
+	changeReasonStale     = "stale_route" // 启动时清理上次运行遗留的路由
+	changeReasonClassSync = "class_sync"  // 流量类别的路由快照中不再包含该目的地
+)
+
+// defaultRouteAuditSize route_audit.size 未设置时内存中保留的变更条数
+const defaultRouteAuditSize = 1000
+
+// RouteChange 一次成功的路由变更
+type RouteChange struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`             // 见 RouteChange* 常量
+	DstCIDR string    `json:"dst_cidr,omitempty"` // 清空路由表时为空
+	NextHop string    `json:"next_hop,omitempty"` // 下一跳，黑洞路由为 blackhole，ECMP 路由为逗号分隔的全部下一跳；删除时为空
+	Table   int       `json:"table,omitempty"`    // 0 表示主路由表
+	Reason  string    `json:"reason,omitempty"`
+	Version uint64    `json:"version,omitempty"` // 变更时正在应用（或最近应用）的 Controller 路由集版本
+	Command string    `json:"command"`           // 等价的 ip 命令
+}
+
+// RouteAudit 路由变更审计日志：内存中保留最近 size 条变更，由健康检查服务的 /debug/route-changes 查询
+// 设置文件时同时以 JSON Lines 追加写入，启动时从文件恢复最近的变更，重启后仍能回答"谁在什么时候改了路由表"；
+// 文件超过 2*size 行时按内存中的记录重写，大小不会无限增长
+type RouteAudit struct {
+	mu      sync.Mutex
+	size    int
+	entries []RouteChange // 按时间先后排列，最多 size 条
+	path    string
+	file    *os.File // 未设置文件时为 nil
+	lines   int      // 文件中的行数
+	logger  logging.Logger
+}
+
+// NewRouteAudit 创建路由变更审计日志，size 不大于 0 时使用默认值，path 为空时只保存在内存中
+func NewRouteAudit(size int, path string, logger logging.Logger) (*RouteAudit, error) {
+	if logger == nil {
+		logger = logging.NewNopLogger()
+	}
+	if size <= 0 {
+		size = defaultRouteAuditSize
+	}
+	a := &RouteAudit{size: size, path: path, logger: logger}
+	if path == "" {
+		return a, nil
+	}
+
+	if err := a.load(); err != nil {
+		return nil, err
+	}
+	if err := a.rewrite(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// load 读取文件中已有的变更，只保留最后 size 条；无法解析的行被跳过
+func (a *RouteAudit) load() error {
+	f, err := os.Open(a.path) // #nosec G304 -- audit path is trusted config
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open route audit log: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var skipped int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var c RouteChange
+		if err := json.Unmarshal([]byte(line), &c); err != nil {
+			skipped++
+			continue
+		}
+		a.appendLocked(c)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read route audit log: %w", err)
+	}
+	if skipped > 0 {
+		a.logger.Warn("Skipped malformed route audit entries",
+			logging.F("path", a.path),
+			logging.F("skipped", skipped),
+		)
+	}
+	return nil
+}
+
+// rewrite 以内存中的变更原子替换文件，并重新打开文件用于追加，调用方需持有 a.mu（或尚未共享）
+func (a *RouteAudit) rewrite() error {
+	if a.file != nil {
+		_ = a.file.Close()
+		a.file = nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(a.path), filepath.Base(a.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create route audit log: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	w := bufio.NewWriter(tmp)
+	for _, c := range a.entries {
+		data, err := json.Marshal(c)
+		if err != nil {
+			_ = tmp.Close()
+			return err
+		}
+		_, _ = w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write route audit log: %w", err)
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write route audit log: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close route audit log: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), a.path); err != nil {
+		return fmt.Errorf("failed to replace route audit log: %w", err)
+	}
+
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_WRONLY, 0o600) // #nosec G304 -- audit path is trusted config
+	if err != nil {
+		return fmt.Errorf("failed to open route audit log: %w", err)
+	}
+	a.file = f
+	a.lines = len(a.entries)
+	return nil
+}
+
+// appendLocked 追加一条变更，超过 size 条时丢弃最早的，调用方需持有 a.mu
+func (a *RouteAudit) appendLocked(c RouteChange) {
+	if len(a.entries) == a.size {
+		copy(a.entries, a.entries[1:])
+		a.entries = a.entries[:a.size-1]
+	}
+	a.entries = append(a.entries, c)
+}
+
+// Record 记录一次路由变更；写文件失败只记录日志，内存中的记录不受影响
+func (a *RouteAudit) Record(c RouteChange) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.appendLocked(c)
+	if a.file == nil {
+		if a.path != "" {
+			// 上次重写失败，文件已关闭
+			a.writeFailed(a.rewrite())
+		}
+		return
+	}
+
+	if a.lines >= 2*a.size {
+		a.writeFailed(a.rewrite())
+		return
+	}
+	data, err := json.Marshal(c)
+	if err == nil {
+		_, err = a.file.Write(append(data, '\n'))
+	}
+	if a.writeFailed(err) {
+		return
+	}
+	a.lines++
+}
+
+// writeFailed 记录写文件失败，err 为 nil 时返回 false
+func (a *RouteAudit) writeFailed(err error) bool {
+	if err == nil {
+		return false
+	}
+	a.logger.Error("Failed to write route audit log",
+		logging.F("path", a.path),
+		logging.F("error", err.Error()),
+	)
+	return true
+}
+
+// Entries 返回时间晚于 since 的变更，按时间先后排列；limit 大于 0 时只返回最近的 limit 条
+func (a *RouteAudit) Entries(since time.Time, limit int) []RouteChange {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	start := len(a.entries)
+	for start > 0 && a.entries[start-1].Time.After(since) {
+		start--
+	}
+	if limit > 0 && len(a.entries)-start > limit {
+		start = len(a.entries) - limit
+	}
+	return append([]RouteChange{}, a.entries[start:]...)
+}
+
+// Close 关闭审计日志文件，之后的变更只保存在内存中
+func (a *RouteAudit) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	a.path = ""
+	return err
+}
+
+// OnRouteChange 注册路由变更回调，每条路由命令成功执行后调用，需在安装路由之前调用
+// 回调在持有执行器锁时同步调用，不能再调用执行器的方法；规则变更和删除不存在的路由不触发回调
+func (e *Executor) OnRouteChange(fn func(RouteChange)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onChange = append(e.onChange, fn)
+}
+
+// notifyChangeLocked 把成功执行的路由命令转换为 RouteChange 并通知回调，调用方需持有 e.mu
+func (e *Executor) notifyChangeLocked(args []string) {
+	if len(e.onChange) == 0 {
+		return
+	}
+	req, err := parseRouteArgs(args)
+	if err != nil || req.rule {
+		return
+	}
+
+	change := RouteChange{
+		Time:    time.Now(),
+		Table:   req.table,
+		Reason:  e.changeReason,
+		Command: strings.Join(args, " "),
+	}
+	switch req.op {
+	case "replace":
+		change.Action = RouteChangeInstall
+	case "del":
+		change.Action = RouteChangeDelete
+	default:
+		change.Action = RouteChangeFlush
+	}
+	if req.dst != nil {
+		change.DstCIDR = req.dst.String()
+	}
+	switch {
+	case req.blackhole && req.op == "replace":
+		change.NextHop = "blackhole"
+	case req.via != nil:
+		change.NextHop = req.via.String()
+	case len(req.nexthops) > 0:
+		hops := make([]string, len(req.nexthops))
+		for i, nh := range req.nexthops {
+			hops[i] = nh.via.String()
+		}
+		change.NextHop = strings.Join(hops, ",")
+	}
+	for _, fn := range e.onChange {
+		fn(change)
+	}
+}
@@ -0,0 +1,174 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// fakeRouteBackend 只记录请求、不修改系统路由表的路由后端
+type fakeRouteBackend struct {
+	applied []routeRequest
+}
+
+func (f *fakeRouteBackend) apply(req routeRequest) error {
+	f.applied = append(f.applied, req)
+	return nil
+}
+func (f *fakeRouteBackend) list(int, bool) ([]kernelRoute, error) { return nil, nil }
+func (f *fakeRouteBackend) close() error                          { return nil }
+
+func TestRouteAuditBounded(t *testing.T) {
+	audit, err := NewRouteAudit(3, "", nil)
+	if err != nil {
+		t.Fatalf("NewRouteAudit() error = %v", err)
+	}
+	base := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		audit.Record(RouteChange{Time: base.Add(time.Duration(i) * time.Minute), Action: RouteChangeInstall, Version: uint64(i)})
+	}
+
+	versions := func(changes []RouteChange) []uint64 {
+		var v []uint64
+		for _, c := range changes {
+			v = append(v, c.Version)
+		}
+		return v
+	}
+	if got := versions(audit.Entries(time.Time{}, 0)); len(got) != 3 || got[0] != 2 || got[2] != 4 {
+		t.Errorf("Entries() versions = %v, want [2 3 4]", got)
+	}
+	if got := versions(audit.Entries(base.Add(3*time.Minute), 0)); len(got) != 1 || got[0] != 4 {
+		t.Errorf("Entries(since) versions = %v, want [4]", got)
+	}
+	if got := versions(audit.Entries(time.Time{}, 2)); len(got) != 2 || got[0] != 3 {
+		t.Errorf("Entries(limit 2) versions = %v, want [3 4]", got)
+	}
+}
+
+func TestRouteAuditFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "route_audit.jsonl")
+	audit, err := NewRouteAudit(2, path, nil)
+	if err != nil {
+		t.Fatalf("NewRouteAudit() error = %v", err)
+	}
+	for i := 1; i <= 4; i++ {
+		audit.Record(RouteChange{Time: time.Now(), Action: RouteChangeInstall, Version: uint64(i)})
+	}
+	if lines := countLines(t, path); lines != 4 {
+		t.Errorf("file lines = %d, want 4", lines)
+	}
+	// 文件达到 2*size 行后按内存中的记录重写
+	audit.Record(RouteChange{Time: time.Now(), Action: RouteChangeDelete, Version: 5})
+	if lines := countLines(t, path); lines != 2 {
+		t.Errorf("file lines after compaction = %d, want 2", lines)
+	}
+	if err := audit.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// 重启后从文件恢复最近的变更
+	restored, err := NewRouteAudit(2, path, nil)
+	if err != nil {
+		t.Fatalf("NewRouteAudit() reopen error = %v", err)
+	}
+	defer restored.Close()
+	got := restored.Entries(time.Time{}, 0)
+	if len(got) != 2 || got[0].Version != 4 || got[1].Version != 5 || got[1].Action != RouteChangeDelete {
+		t.Errorf("restored entries = %+v, want versions 4 and 5", got)
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+func TestExecutorRouteChanges(t *testing.T) {
+	e, _ := NewExecutor("wg0", "10.254.0.0/24")
+	e.backend = &fakeRouteBackend{}
+	var changes []RouteChange
+	e.OnRouteChange(func(c RouteChange) { changes = append(changes, c) })
+
+	_ = e.ApplyRoute(models.RouteConfig{DstCIDR: "10.254.0.3/32", NextHop: "10.254.0.2", Reason: "optimized_path"})
+	_ = e.ApplyRoute(models.RouteConfig{DstCIDR: "10.254.0.4/32", NextHop: "10.254.0.2",
+		NextHops: []string{"10.254.0.2", "10.254.0.5"}, Reason: "optimized_path"})
+	_ = e.ApplyRoute(models.RouteConfig{DstCIDR: "10.254.0.6/32", NextHop: "blackhole", Reason: "unreachable"})
+	_, _ = e.CleanupManagedRoutes()
+
+	want := []struct{ action, dst, hop, reason string }{
+		{RouteChangeInstall, "10.254.0.3/32", "10.254.0.2", "optimized_path"},
+		{RouteChangeInstall, "10.254.0.4/32", "10.254.0.2,10.254.0.5", "optimized_path"},
+		{RouteChangeInstall, "10.254.0.6/32", "blackhole", "unreachable"},
+		{RouteChangeDelete, "", "", changeReasonShutdown},
+		{RouteChangeDelete, "", "", changeReasonShutdown},
+		{RouteChangeDelete, "", "", changeReasonShutdown},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %+v, want %d", changes, len(want))
+	}
+	for i, w := range want {
+		c := changes[i]
+		if c.Action != w.action || (w.dst != "" && c.DstCIDR != w.dst) || c.NextHop != w.hop || c.Reason != w.reason {
+			t.Errorf("change %d = %+v, want %+v", i, c, w)
+		}
+	}
+	if got := changes[0].Command; got != "ip route replace 10.254.0.3/32 via 10.254.0.2 dev wg0" {
+		t.Errorf("command = %q", got)
+	}
+}
+
+func TestHandleRouteChanges(t *testing.T) {
+	cfg := &config.AgentConfig{
+		AgentID:    "10.254.0.1",
+		Controller: config.ControllerClient{URL: "http://127.0.0.1:1", Timeout: time.Second},
+		Sync:       config.SyncConfig{Interval: time.Minute, RetryAttempts: 2, RetryBackoff: []int{0}},
+		Network:    config.NetworkConfig{WGInterface: "wg0", Subnet: "10.254.0.0/24"},
+	}
+	executor, _ := NewExecutor("wg0", "10.254.0.0/24")
+	executor.backend = &fakeRouteBackend{}
+	a, err := NewAgentWithExecutor(cfg, &fakeProber{}, executor, logging.NewNopLogger())
+	if err != nil {
+		t.Fatalf("NewAgentWithExecutor() error = %v", err)
+	}
+
+	a.applyPushedRoutes(&models.RouteResponse{Version: 7, Routes: []models.RouteConfig{
+		{DstCIDR: "10.254.0.3/32", NextHop: "10.254.0.2", Reason: "optimized_path"},
+	}})
+
+	hs := NewHealthServer(a, 0)
+	w := httptest.NewRecorder()
+	hs.handleRouteChanges(w, httptest.NewRequest(http.MethodGet, "/debug/route-changes?limit=10", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var resp RouteChangesResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Changes) != 1 {
+		t.Fatalf("changes = %+v, want 1", resp.Changes)
+	}
+	if c := resp.Changes[0]; c.Version != 7 || c.DstCIDR != "10.254.0.3/32" || c.Reason != "optimized_path" {
+		t.Errorf("change = %+v, want version 7 for 10.254.0.3/32", c)
+	}
+
+	w = httptest.NewRecorder()
+	hs.handleRouteChanges(w, httptest.NewRequest(http.MethodGet, "/debug/route-changes?since=02:00", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid since: status = %d, want 400", w.Code)
+	}
+}
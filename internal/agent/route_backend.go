@@ -0,0 +1,436 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+)
+
+// errRouteNotFound 要删除的路由或规则不存在，对应 ip 命令的 "No such process" 和 "No such file or directory"
+// 路由表中从未有过该地址族的路由时 ip 命令报告 "FIB table does not exist"，同样视为不存在
+var errRouteNotFound = errors.New("route not found")
+
+// ipTableMissing ip 命令操作不存在的路由表时的错误信息
+const ipTableMissing = "FIB table does not exist"
+
+// routeRequest 一条路由或策略路由规则的变更，由 Generate*Command 生成的 ip 命令参数解析而来
+// 日志和 iproute2 后端都使用 ip 命令的形式，netlink 后端据此构造等价的请求
+type routeRequest struct {
+	rule      bool   // ip rule 而不是 ip route
+	blackhole bool   // 黑洞路由：丢弃发往目的地的流量，没有下一跳和出接口
+	v6        bool   // ip -6，flush 时只清空 IPv6 路由；其他操作的地址族由目的地决定
+	op        string // 路由为 replace、del 或 flush，规则为 add 或 del
+	dst       *net.IPNet
+	via       net.IP
+	dev       string
+	table     int    // 0 表示主路由表
+	priority  int    // 规则优先级
+	metric    uint32 // 路由 metric，0 表示由内核决定
+	protocol  uint8  // 路由协议号，0 表示新增时使用 boot、删除时不按协议号匹配
+	nexthops  []routeNexthop
+}
+
+// routeNexthop 多路径路由（ECMP）中的一个下一跳
+type routeNexthop struct {
+	via    net.IP
+	dev    string
+	weight int // 1-256，0 表示未指定（等同于 1）
+}
+
+// parseRouteArgs 解析 ip [-4|-6] route replace|del|flush 和 ip rule add|del 命令参数
+// 多路径路由的每个下一跳以 nexthop 开头，其后的 via、dev、weight 属于该下一跳
+func parseRouteArgs(args []string) (routeRequest, error) {
+	var req routeRequest
+	if len(args) > 1 && (args[1] == "-4" || args[1] == "-6") {
+		req.v6 = args[1] == "-6"
+		args = append([]string{args[0]}, args[2:]...)
+	}
+	if len(args) < 3 || args[0] != "ip" || (args[1] != "route" && args[1] != "rule") {
+		return req, fmt.Errorf("not an ip route or ip rule command: %s", strings.Join(args, " "))
+	}
+	req.rule = args[1] == "rule"
+	req.op = args[2]
+	rest := args[3:]
+	switch {
+	case req.rule && (req.op == "add" || req.op == "del"):
+	case !req.rule && (req.op == "replace" || req.op == "del"):
+		if len(rest) > 0 && rest[0] == "blackhole" {
+			req.blackhole = true
+			rest = rest[1:]
+		}
+		if len(rest) == 0 {
+			return req, fmt.Errorf("missing destination: %s", strings.Join(args, " "))
+		}
+		dst, err := parseRouteDst(rest[0])
+		if err != nil {
+			return req, err
+		}
+		req.dst = dst
+		rest = rest[1:]
+	case !req.rule && req.op == "flush":
+	default:
+		return req, fmt.Errorf("unsupported %s operation %q", args[1], req.op)
+	}
+
+	for len(rest) > 0 {
+		if rest[0] == "nexthop" && !req.rule {
+			req.nexthops = append(req.nexthops, routeNexthop{})
+			rest = rest[1:]
+			continue
+		}
+		if len(rest) < 2 {
+			return req, fmt.Errorf("missing value for %q: %s", rest[0], strings.Join(args, " "))
+		}
+		key, value := rest[0], rest[1]
+		rest = rest[2:]
+		var nh *routeNexthop
+		if len(req.nexthops) > 0 {
+			nh = &req.nexthops[len(req.nexthops)-1]
+		}
+		switch {
+		case key == "via" && nh != nil:
+			if nh.via = net.ParseIP(value); nh.via == nil {
+				return req, fmt.Errorf("invalid gateway %q", value)
+			}
+			continue
+		case key == "dev" && nh != nil:
+			nh.dev = value
+			continue
+		case key == "weight" && nh != nil:
+			weight, err := strconv.Atoi(value)
+			if err != nil || weight < 1 || weight > 256 {
+				return req, fmt.Errorf("invalid weight %q", value)
+			}
+			nh.weight = weight
+			continue
+		case nh != nil:
+			return req, fmt.Errorf("unsupported nexthop option %q", key)
+		}
+		switch key {
+		case "via":
+			if req.via = net.ParseIP(value); req.via == nil {
+				return req, fmt.Errorf("invalid gateway %q", value)
+			}
+		case "dev":
+			req.dev = value
+		case "to":
+			dst, err := parseRouteDst(value)
+			if err != nil {
+				return req, err
+			}
+			req.dst = dst
+		case "table", "lookup":
+			if value == "main" {
+				continue
+			}
+			table, err := strconv.Atoi(value)
+			if err != nil || table <= 0 {
+				return req, fmt.Errorf("invalid table %q", value)
+			}
+			req.table = table
+		case "priority":
+			priority, err := strconv.Atoi(value)
+			if err != nil || priority < 0 {
+				return req, fmt.Errorf("invalid priority %q", value)
+			}
+			req.priority = priority
+		case "metric":
+			metric, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return req, fmt.Errorf("invalid metric %q", value)
+			}
+			req.metric = uint32(metric)
+		case "proto":
+			// 只接受数字，名称需要查 /etc/iproute2/rt_protos，Agent 生成的命令总是使用数字
+			protocol, err := strconv.ParseUint(value, 10, 8)
+			if err != nil || protocol == 0 {
+				return req, fmt.Errorf("invalid protocol %q", value)
+			}
+			req.protocol = uint8(protocol)
+		default:
+			return req, fmt.Errorf("unsupported route option %q", key)
+		}
+	}
+	if req.rule && req.dst == nil {
+		return req, fmt.Errorf("missing destination: %s", strings.Join(args, " "))
+	}
+	if req.blackhole && (req.via != nil || req.dev != "" || len(req.nexthops) > 0) {
+		return req, fmt.Errorf("blackhole route with a next hop: %s", strings.Join(args, " "))
+	}
+	return req, nil
+}
+
+// parseRouteDst 解析 CIDR 或单个地址，单个地址视为主机路由
+func parseRouteDst(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, dst, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid destination %q: %w", s, err)
+		}
+		return dst, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid destination %q", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// formatRouteDst 按 ip route show 的习惯格式化目的地：主机路由不带前缀长度
+func formatRouteDst(dst *net.IPNet) string {
+	if ones, bits := dst.Mask.Size(); ones == bits {
+		return dst.IP.String()
+	}
+	return dst.String()
+}
+
+// kernelRoute 内核路由表中的一条路由
+type kernelRoute struct {
+	dst       string // 格式与 ip route show 相同，默认路由为 default
+	via       string // 空字符串表示直连
+	dev       string
+	metric    uint32 // 0 表示未设置（IPv4 的默认值）
+	protocol  uint8  // 协议号，与 netlink 返回的值相同
+	blackhole bool
+}
+
+// ipRouteTypes ip route show 输出中单播路由之外的路由类型前缀，除 blackhole 外都不由 Agent 管理
+var ipRouteTypes = map[string]bool{
+	"blackhole": true, "unreachable": true, "prohibit": true, "throw": true,
+	"local": true, "broadcast": true, "anycast": true, "multicast": true, "nat": true,
+}
+
+// ipRouteProtocols ip route show 按名称显示的内核保留协议号，其他协议只有在 rt_protos 中命名时才显示名称
+// 协议为 boot 时不显示 proto 字段
+var ipRouteProtocols = map[string]uint8{"redirect": 1, "kernel": 2, "boot": 3, "static": 4}
+
+// parseIPRouteShow 解析 ip route show 或 ip -6 route show 的输出，例如：
+//
+//	10.254.0.3 via 10.254.0.2 dev wg0 proto boot
+//	10.254.0.0/24 dev wg0 proto kernel scope link src 10.254.0.1
+//	fd00:254::3 via fd00:254::2 dev wg0 proto boot metric 1024 pref medium
+//
+// 黑洞路由以 blackhole 开头（blackhole 10.254.0.5 proto boot），其他非单播类型的路由被忽略。
+// 多路径路由的下一跳在随后缩进的 nexthop 行中，via 和 dev 取第一个下一跳：
+//
+//	10.254.0.4 proto boot
+//		nexthop via 10.254.0.2 dev wg0 weight 1
+//		nexthop via 10.254.0.3 dev wg0 weight 1
+func parseIPRouteShow(output string) []kernelRoute {
+	var routes []kernelRoute
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
+		if parts[0] == "nexthop" {
+			if n := len(routes); n > 0 && routes[n-1].via == "" && routes[n-1].dev == "" {
+				for i := 1; i+1 < len(parts); i++ {
+					switch parts[i] {
+					case "via":
+						routes[n-1].via = parts[i+1]
+					case "dev":
+						routes[n-1].dev = parts[i+1]
+					}
+				}
+			}
+			continue
+		}
+		var blackhole bool
+		if ipRouteTypes[parts[0]] {
+			if parts[0] != "blackhole" || len(parts) < 2 {
+				continue
+			}
+			blackhole = true
+			parts = parts[1:]
+		}
+		route := kernelRoute{dst: parts[0], protocol: ipRouteProtocols["boot"], blackhole: blackhole}
+		for i := 1; i+1 < len(parts); i++ {
+			switch parts[i] {
+			case "via":
+				route.via = parts[i+1]
+			case "dev":
+				route.dev = parts[i+1]
+			case "metric":
+				if metric, err := strconv.ParseUint(parts[i+1], 10, 32); err == nil {
+					route.metric = uint32(metric)
+				}
+			case "proto":
+				if protocol, ok := ipRouteProtocols[parts[i+1]]; ok {
+					route.protocol = protocol
+				} else if protocol, err := strconv.ParseUint(parts[i+1], 10, 8); err == nil {
+					route.protocol = uint8(protocol)
+				}
+			}
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// routeBackend 不经 ip 命令、直接操作系统路由表的后端，请求由 Generate*Command 生成的 ip 命令参数解析而来
+type routeBackend interface {
+	apply(req routeRequest) error
+	list(table int, v6 bool) ([]kernelRoute, error)
+	close() error
+}
+
+// SetRouteBackend 选择安装路由的方式，见 config.RouteBackend* 常量
+// auto 时 Linux 使用 netlink（无法打开套接字时使用 ip 命令），macOS 和 FreeBSD 使用 route 命令，Windows 使用 netsh；
+// 指定 netlink、route 或 netsh 而当前平台不支持时返回错误
+func (e *Executor) SetRouteBackend(backend string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.closeBackendLocked()
+	switch backend {
+	case config.RouteBackendIPRoute2:
+		e.logger.Info("Using ip commands for routes")
+		return nil
+	case config.RouteBackendBSDRoute:
+		r, err := newBSDRouter()
+		if err != nil {
+			return err
+		}
+		e.backend = r
+		e.logger.Info("Using route commands for routes")
+		return nil
+	case config.RouteBackendNetsh:
+		r, err := newNetshRouter()
+		if err != nil {
+			return err
+		}
+		e.backend = r
+		e.logger.Info("Using netsh for routes")
+		return nil
+	}
+
+	if backend == config.RouteBackendAuto {
+		if r, err := newBSDRouter(); err == nil {
+			e.backend = r
+			e.logger.Info("Using route commands for routes")
+			return nil
+		}
+		if r, err := newNetshRouter(); err == nil {
+			e.backend = r
+			e.logger.Info("Using netsh for routes")
+			return nil
+		}
+	}
+	nl, err := newNetlinkRouter()
+	if err != nil {
+		if backend == config.RouteBackendNetlink {
+			return err
+		}
+		e.logger.Warn("Netlink unavailable, falling back to ip commands for routes",
+			logging.F("error", err.Error()),
+		)
+		return nil
+	}
+	e.backend = nl
+	e.logger.Info("Using netlink for routes")
+	return nil
+}
+
+// Close 释放路由后端持有的资源（netlink 套接字），之后的路由操作使用 ip 命令
+func (e *Executor) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closeBackendLocked()
+}
+
+// closeBackendLocked 关闭路由后端，调用方需持有 e.mu
+func (e *Executor) closeBackendLocked() {
+	if e.backend != nil {
+		_ = e.backend.close()
+		e.backend = nil
+	}
+}
+
+// listAllRoutes 返回路由表 table 中允许的子网涉及的各地址族的路由，调用方需持有 e.mu
+func (e *Executor) listAllRoutes(table int) ([]kernelRoute, error) {
+	var routes []kernelRoute
+	for _, v6 := range e.families() {
+		current, err := e.listRoutes(table, v6)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, current...)
+	}
+	return routes, nil
+}
+
+// listRoutes 返回路由表 table（0 表示主路由表）中的 IPv4 或 IPv6 路由，调用方需持有 e.mu
+func (e *Executor) listRoutes(table int, v6 bool) ([]kernelRoute, error) {
+	if e.backend != nil {
+		return e.backend.list(table, v6)
+	}
+
+	name := "main"
+	if table != 0 {
+		name = strconv.Itoa(table)
+	}
+	family := "-4"
+	if v6 {
+		family = "-6"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "ip", family, "route", "show", "table", name).Output() //nolint:gosec
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && strings.Contains(string(exitErr.Stderr), ipTableMissing) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get routes: %w", err)
+	}
+	return parseIPRouteShow(string(output)), nil
+}
+
+// runRouteCommand 执行 ip route 或 ip rule 命令描述的变更，成功后通知路由变更回调，调用方需持有 e.mu
+// 删除不存在的路由或规则时返回的错误包装 errRouteNotFound
+func (e *Executor) runRouteCommand(args []string) error {
+	if err := e.execRouteCommand(args); err != nil {
+		return err
+	}
+	e.notifyChangeLocked(args)
+	return nil
+}
+
+// execRouteCommand 执行路由命令，使用其他路由后端时转换为等价的请求
+func (e *Executor) execRouteCommand(args []string) error {
+	if e.backend != nil {
+		req, err := parseRouteArgs(args)
+		if err != nil {
+			return err
+		}
+		if err := e.backend.apply(req); err != nil {
+			return fmt.Errorf("%s failed: %w", strings.Join(args, " "), err)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	// #nosec G204 - args are generated internally from validated IPs
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) //nolint:gosec
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if strings.Contains(string(output), "No such process") || strings.Contains(string(output), "No such file or directory") ||
+			strings.Contains(string(output), ipTableMissing) {
+			return fmt.Errorf("%w: %s", errRouteNotFound, strings.TrimSpace(string(output)))
+		}
+		return fmt.Errorf("route command failed: %s, output: %s", err, string(output))
+	}
+	return nil
+}
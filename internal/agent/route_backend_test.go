@@ -0,0 +1,153 @@
+package agent
+
+import "testing"
+
+func TestParseRouteArgs(t *testing.T) {
+	e, _ := NewExecutor("wg0", "10.254.0.0/24")
+
+	req, err := parseRouteArgs(e.GenerateAddCommand("10.254.0.3", "10.254.0.2"))
+	if err != nil {
+		t.Fatalf("parse add: %v", err)
+	}
+	if req.op != "replace" || req.dst.String() != "10.254.0.3/32" || req.via.String() != "10.254.0.2" ||
+		req.dev != "wg0" || req.table != 0 {
+		t.Errorf("add = %+v", req)
+	}
+
+	req, err = parseRouteArgs(e.GenerateClassDelCommand(100, "10.254.0.3"))
+	if err != nil {
+		t.Fatalf("parse class del: %v", err)
+	}
+	if req.op != "del" || req.via != nil || req.table != 100 {
+		t.Errorf("class del = %+v", req)
+	}
+
+	req, err = parseRouteArgs(e.GenerateFlushTableCommand(100))
+	if err != nil || req.op != "flush" || req.dst != nil || req.table != 100 {
+		t.Errorf("flush = %+v, %v", req, err)
+	}
+
+	// ip route show 输出的主机路由不带前缀长度
+	req, err = parseRouteArgs([]string{"ip", "route", "del", "10.254.0.3", "dev", "wg0"})
+	if err != nil || req.dst.String() != "10.254.0.3/32" {
+		t.Errorf("del without prefix = %+v, %v", req, err)
+	}
+
+	e.SetRouteTable(200, 1000)
+	req, err = parseRouteArgs(e.GenerateRuleCommand("add", e.subnets[0]))
+	if err != nil {
+		t.Fatalf("parse rule: %v", err)
+	}
+	if !req.rule || req.op != "add" || req.dst.String() != "10.254.0.0/24" || req.table != 200 || req.priority != 1000 {
+		t.Errorf("rule = %+v", req)
+	}
+
+	req, err = parseRouteArgs(e.GenerateAddCommand("fd00:254::3", "fd00:254::2"))
+	if err != nil || req.dst.String() != "fd00:254::3/128" || req.via.String() != "fd00:254::2" {
+		t.Errorf("add ipv6 = %+v, %v", req, err)
+	}
+	req, err = parseRouteArgs(e.GenerateFlushTable6Command(100))
+	if err != nil || req.op != "flush" || !req.v6 || req.table != 100 {
+		t.Errorf("flush ipv6 = %+v, %v", req, err)
+	}
+
+	req, err = parseRouteArgs(withMetric(e.GenerateDelCommand("10.254.0.3"), 50))
+	if err != nil || req.op != "del" || req.metric != 50 {
+		t.Errorf("del with metric = %+v, %v", req, err)
+	}
+
+	req, err = parseRouteArgs(withMetric(e.GenerateMultipathCommand("10.254.0.4", []string{"10.254.0.2", "10.254.0.3"}, []int{3, 1}), 50))
+	if err != nil {
+		t.Fatalf("parse multipath: %v", err)
+	}
+	if req.via != nil || req.metric != 50 || len(req.nexthops) != 2 ||
+		req.nexthops[0].via.String() != "10.254.0.2" || req.nexthops[0].dev != "wg0" || req.nexthops[0].weight != 3 ||
+		req.nexthops[1].via.String() != "10.254.0.3" || req.nexthops[1].weight != 1 {
+		t.Errorf("multipath = %+v", req)
+	}
+
+	req, err = parseRouteArgs(withMetric(e.GenerateBlackholeCommand("10.254.0.5"), 50))
+	if err != nil || !req.blackhole || req.op != "replace" || req.dst.String() != "10.254.0.5/32" ||
+		req.via != nil || req.dev != "" || req.metric != 50 {
+		t.Errorf("blackhole = %+v, %v", req, err)
+	}
+
+	e.SetRouteProtocol(157)
+	req, err = parseRouteArgs(e.GenerateAddCommand("10.254.0.3", "10.254.0.2"))
+	if err != nil || req.protocol != 157 || req.via.String() != "10.254.0.2" {
+		t.Errorf("add with protocol = %+v, %v", req, err)
+	}
+	e.SetRouteProtocol(0)
+
+	for _, args := range [][]string{
+		{"ip", "rule", "add"},
+		{"ip", "route", "del", "10.254.0.3/32", "proto", "0"},
+		{"ip", "route", "replace", "blackhole"},
+		{"ip", "route", "replace", "blackhole", "10.254.0.5/32", "via", "10.254.0.2"},
+		{"ip", "route", "del", "blackhole", "10.254.0.5/32", "dev", "wg0"},
+		{"ip", "rule", "flush"},
+		{"ip", "route", "add", "10.254.0.3/32"},
+		{"ip", "route", "replace"},
+		{"ip", "route", "replace", "not-an-ip"},
+		{"ip", "route", "replace", "10.254.0.3/32", "via"},
+		{"ip", "route", "replace", "10.254.0.3/32", "metric", "-1"},
+		{"ip", "route", "replace", "10.254.0.3/32", "proto", "static"},
+		{"ip", "route", "flush", "table", "-1"},
+		{"ip", "route", "replace", "10.254.0.4/32", "nexthop", "via", "10.254.0.2", "weight", "0"},
+		{"ip", "route", "replace", "10.254.0.4/32", "nexthop", "via", "10.254.0.2", "table", "100"},
+		{"ip", "route", "replace", "10.254.0.4/32", "weight", "1"},
+	} {
+		if _, err := parseRouteArgs(args); err == nil {
+			t.Errorf("parseRouteArgs(%v) returned no error", args)
+		}
+	}
+}
+
+func TestParseIPRouteShow(t *testing.T) {
+	routes := parseIPRouteShow(`default via 192.168.1.1 dev eth0
+10.254.0.0/24 dev wg0 proto kernel scope link src 10.254.0.1
+10.254.0.3 via 10.254.0.2 dev wg0 proto boot
+fd00:254::3 via fd00:254::2 dev wg0 proto boot metric 1024 pref medium
+10.20.0.0/24 via 10.254.0.2 dev wg0 proto 157 metric 50
+10.254.0.4 proto boot
+	nexthop via 10.254.0.2 dev wg0 weight 3
+	nexthop via 10.254.0.3 dev wg0 weight 1
+blackhole 10.254.0.5 proto boot metric 50
+unreachable 10.254.0.6 proto boot
+blackhole fd00:254::5 dev lo proto boot metric 1024 pref medium
+`)
+	want := []kernelRoute{
+		{dst: "default", via: "192.168.1.1", dev: "eth0", protocol: 3},
+		{dst: "10.254.0.0/24", dev: "wg0", protocol: 2},
+		{dst: "10.254.0.3", via: "10.254.0.2", dev: "wg0", protocol: 3},
+		{dst: "fd00:254::3", via: "fd00:254::2", dev: "wg0", metric: 1024, protocol: 3},
+		{dst: "10.20.0.0/24", via: "10.254.0.2", dev: "wg0", metric: 50, protocol: 157},
+		{dst: "10.254.0.4", via: "10.254.0.2", dev: "wg0", protocol: 3},
+		{dst: "10.254.0.5", metric: 50, protocol: 3, blackhole: true},
+		{dst: "fd00:254::5", dev: "lo", metric: 1024, protocol: 3, blackhole: true},
+	}
+	if len(routes) != len(want) {
+		t.Fatalf("routes = %+v, want %+v", routes, want)
+	}
+	for i := range want {
+		if routes[i] != want[i] {
+			t.Errorf("routes[%d] = %+v, want %+v", i, routes[i], want[i])
+		}
+	}
+}
+
+func TestSetRouteBackend(t *testing.T) {
+	e, _ := NewExecutor("wg0", "10.254.0.0/24")
+	defer e.Close()
+
+	if err := e.SetRouteBackend("iproute2"); err != nil || e.backend != nil {
+		t.Errorf("iproute2 backend: backend = %v, err = %v", e.backend, err)
+	}
+	// auto 在 netlink 不可用时回退到 ip 命令，不返回错误
+	if err := e.SetRouteBackend("auto"); err != nil {
+		t.Errorf("auto backend: %v", err)
+	}
+	if err := e.SetRouteBackend("netlink"); err != nil && e.backend != nil {
+		t.Errorf("failed netlink backend left a socket open")
+	}
+}
@@ -0,0 +1,229 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+var (
+	// errBSDRouteUnsupported 只有 macOS 和 FreeBSD 提供 BSD 的 route 命令
+	errBSDRouteUnsupported = errors.New("route backend is only supported on darwin and freebsd")
+	// errBSDRouteExists route add 的目的地已有路由
+	errBSDRouteExists = errors.New("route already exists")
+)
+
+// bsdRouter 通过 BSD 的 route 命令修改路由、netstat -rn 读取路由表，用于 macOS 和 FreeBSD
+// 这些平台没有 Linux 的策略路由、路由 metric 和协议号：只支持主路由表，metric 和协议号被忽略，
+// 多路径路由只安装第一个下一跳，启动时也无法按协议号识别上次遗留的路由
+type bsdRouter struct{}
+
+// newBSDRouter 在 macOS 和 FreeBSD 上创建 route 命令后端，其他平台返回错误
+func newBSDRouter() (*bsdRouter, error) {
+	if runtime.GOOS != "darwin" && runtime.GOOS != "freebsd" {
+		return nil, errBSDRouteUnsupported
+	}
+	return &bsdRouter{}, nil
+}
+
+// close route 命令后端不持有资源
+func (b *bsdRouter) close() error { return nil }
+
+// apply 执行一条路由变更；replace 先 add，路由已存在时删除后重新添加
+// route change 不能在单播和黑洞路由之间切换，因此不使用 change
+func (b *bsdRouter) apply(req routeRequest) error {
+	switch {
+	case req.rule:
+		return errors.New("route backend does not support policy routing rules")
+	case req.table != 0:
+		return fmt.Errorf("route backend does not support routing table %d", req.table)
+	}
+
+	switch req.op {
+	case "replace":
+		err := runBSDRoute(bsdRouteCommand("add", req))
+		if !errors.Is(err, errBSDRouteExists) {
+			return err
+		}
+		if err := runBSDRoute(bsdRouteCommand("delete", req)); err != nil && !errors.Is(err, errRouteNotFound) {
+			return err
+		}
+		return runBSDRoute(bsdRouteCommand("add", req))
+	case "del":
+		return runBSDRoute(bsdRouteCommand("delete", req))
+	default:
+		return fmt.Errorf("route backend does not support route operation %q", req.op)
+	}
+}
+
+// list 读取 netstat -rn 输出的 IPv4 或 IPv6（v6 为 true）路由表
+func (b *bsdRouter) list(table int, v6 bool) ([]kernelRoute, error) {
+	if table != 0 {
+		return nil, fmt.Errorf("route backend does not support routing table %d", table)
+	}
+	family := "inet"
+	if v6 {
+		family = "inet6"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "netstat", "-rn", "-f", family).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get routes: %w", err)
+	}
+	return parseNetstatRoutes(string(output)), nil
+}
+
+// bsdRouteCommand 生成与路由请求等价的 route add 或 route delete 命令，例如：
+//
+//	route -n add -inet -host 10.254.0.3 10.254.0.2
+//	route -n add -inet6 -net fd00:254:1::/64 fd00:254::2
+//	route -n add -inet -host 10.254.0.5 127.0.0.1 -blackhole
+//	route -n delete -inet -host 10.254.0.3
+//
+// 黑洞路由的网关必须是环回地址；没有网关时以 -interface 指定出接口
+func bsdRouteCommand(op string, req routeRequest) []string {
+	family := "-inet"
+	if req.dst.IP.To4() == nil {
+		family = "-inet6"
+	}
+	args := []string{"route", "-n", op, family}
+	if ones, bits := req.dst.Mask.Size(); ones == bits {
+		args = append(args, "-host", req.dst.IP.String())
+	} else {
+		args = append(args, "-net", req.dst.String())
+	}
+	if op == "delete" {
+		return args
+	}
+
+	via := req.via
+	if via == nil && len(req.nexthops) > 0 {
+		via = req.nexthops[0].via
+	}
+	switch {
+	case req.blackhole && family == "-inet":
+		return append(args, "127.0.0.1", "-blackhole")
+	case req.blackhole:
+		return append(args, "::1", "-blackhole")
+	case via != nil:
+		return append(args, via.String())
+	default:
+		return append(args, "-interface", req.dev)
+	}
+}
+
+// runBSDRoute 执行 route 命令，路由已存在和不存在分别返回包装 errBSDRouteExists 和 errRouteNotFound 的错误
+func runBSDRoute(args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	// #nosec G204 - args are generated internally from validated IPs
+	output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput() //nolint:gosec
+	if err == nil {
+		return nil
+	}
+	msg := strings.TrimSpace(string(output))
+	switch {
+	case strings.Contains(msg, "File exists") || strings.Contains(msg, "already in table"):
+		return fmt.Errorf("%w: %s", errBSDRouteExists, msg)
+	case strings.Contains(msg, "not in table") || strings.Contains(msg, "has not been found") ||
+		strings.Contains(msg, "No such process"):
+		return fmt.Errorf("%w: %s", errRouteNotFound, msg)
+	}
+	return fmt.Errorf("route command failed: %s, output: %s", err, msg)
+}
+
+// parseNetstatRoutes 解析 netstat -rn -f inet|inet6 的输出，例如 macOS 上：
+//
+//	Routing tables
+//
+//	Internet:
+//	Destination        Gateway            Flags               Netif Expire
+//	default            192.168.1.1        UGScg                 en0
+//	10.254.0.3         10.254.0.2         UGHS                utun3
+//	10.254.1/24        10.254.0.2         UGSc                utun3
+//	10.254.0.5         127.0.0.1          UGHSB                 lo0
+//
+// 按表头定位各列，macOS 和 FreeBSD 的列数不同。目的地格式化为与 ip route show 相同的形式；
+// Flags 中的 G 表示经网关，B 表示黑洞路由；BSD 路由没有协议号和 metric
+func parseNetstatRoutes(output string) []kernelRoute {
+	var routes []kernelRoute
+	gatewayCol, flagsCol, netifCol := -1, -1, -1
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "Destination" {
+			for i, name := range fields {
+				switch name {
+				case "Gateway":
+					gatewayCol = i
+				case "Flags":
+					flagsCol = i
+				case "Netif":
+					netifCol = i
+				}
+			}
+			continue
+		}
+		if gatewayCol < 0 || flagsCol < 0 || netifCol < 0 || len(fields) <= netifCol {
+			continue
+		}
+
+		dst, ok := parseNetstatDst(fields[0])
+		if !ok {
+			continue
+		}
+		flags := fields[flagsCol]
+		route := kernelRoute{dst: dst, dev: fields[netifCol], blackhole: strings.Contains(flags, "B")}
+		if gw := stripZone(fields[gatewayCol]); strings.Contains(flags, "G") && !route.blackhole && net.ParseIP(gw) != nil {
+			route.via = gw
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// parseNetstatDst 把 netstat 中的目的地转换为 ip route show 的格式
+// macOS 省略 IPv4 网络地址末尾的 0（10.254.1/24），IPv6 链路本地地址带有 %网卡 后缀
+func parseNetstatDst(s string) (string, bool) {
+	if s == "default" {
+		return s, true
+	}
+	s = stripZone(s)
+	addr, prefix, hasPrefix := strings.Cut(s, "/")
+	if !strings.Contains(addr, ":") {
+		if !hasPrefix && strings.Count(addr, ".") != 3 {
+			return "", false // 按地址类别推断掩码的网络（例如 127），不由 Agent 管理
+		}
+		for strings.Count(addr, ".") < 3 {
+			addr += ".0"
+		}
+	}
+	if hasPrefix {
+		addr += "/" + prefix
+	}
+	dst, err := parseRouteDst(addr)
+	if err != nil {
+		return "", false
+	}
+	return formatRouteDst(dst), true
+}
+
+// stripZone 去掉 IPv6 地址的 %网卡 后缀，保留前缀长度
+func stripZone(s string) string {
+	i := strings.Index(s, "%")
+	if i < 0 {
+		return s
+	}
+	if j := strings.Index(s[i:], "/"); j >= 0 {
+		return s[:i] + s[i+j:]
+	}
+	return s[:i]
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestBSDRouteCommand(t *testing.T) {
+	e, _ := NewExecutor("wg0", "10.254.0.0/24")
+	_ = e.AddSubnet("fd00:254::/64")
+	e.SetRouteProtocol(157)
+	e.SetRouteMetric(50)
+
+	tests := []struct {
+		op   string
+		args []string
+		want string
+	}{
+		{"add", withMetric(e.GenerateAddCommand("10.254.0.3", "10.254.0.2"), 50),
+			"route -n add -inet -host 10.254.0.3 10.254.0.2"},
+		{"add", e.GenerateAddCommand("fd00:254:1::/64", "fd00:254::2"),
+			"route -n add -inet6 -net fd00:254:1::/64 fd00:254::2"},
+		{"add", e.GenerateMultipathCommand("10.254.0.4", []string{"10.254.0.2", "10.254.0.3"}, nil),
+			"route -n add -inet -host 10.254.0.4 10.254.0.2"},
+		{"add", e.GenerateBlackholeCommand("10.254.0.5"),
+			"route -n add -inet -host 10.254.0.5 127.0.0.1 -blackhole"},
+		{"add", e.GenerateBlackholeCommand("fd00:254::5"),
+			"route -n add -inet6 -host fd00:254::5 ::1 -blackhole"},
+		{"add", []string{"ip", "route", "replace", "10.254.0.6/32", "dev", "wg0"},
+			"route -n add -inet -host 10.254.0.6 -interface wg0"},
+		{"delete", withMetric(e.GenerateDelCommand("10.254.0.3"), 50),
+			"route -n delete -inet -host 10.254.0.3"},
+	}
+	for _, tt := range tests {
+		req, err := parseRouteArgs(tt.args)
+		if err != nil {
+			t.Fatalf("parseRouteArgs(%v) error = %v", tt.args, err)
+		}
+		if got := strings.Join(bsdRouteCommand(tt.op, req), " "); got != tt.want {
+			t.Errorf("bsdRouteCommand(%q, %v) = %q, want %q", tt.op, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestBSDRouterRejectsTables(t *testing.T) {
+	b := &bsdRouter{}
+	for _, args := range [][]string{
+		{"ip", "rule", "add", "to", "10.254.0.0/24", "lookup", "100", "priority", "1000"},
+		{"ip", "route", "replace", "10.254.0.3/32", "via", "10.254.0.2", "dev", "wg0", "table", "100"},
+		{"ip", "route", "flush", "table", "100"},
+	} {
+		req, err := parseRouteArgs(args)
+		if err != nil {
+			t.Fatalf("parseRouteArgs(%v) error = %v", args, err)
+		}
+		if err := b.apply(req); err == nil {
+			t.Errorf("apply(%v) succeeded, want unsupported error", args)
+		}
+	}
+	if _, err := b.list(100, false); err == nil {
+		t.Error("list(100) succeeded, want unsupported error")
+	}
+}
+
+func TestNewBSDRouter(t *testing.T) {
+	_, err := newBSDRouter()
+	if bsd := runtime.GOOS == "darwin" || runtime.GOOS == "freebsd"; bsd != (err == nil) {
+		t.Errorf("newBSDRouter() on %s error = %v", runtime.GOOS, err)
+	}
+}
+
+func TestParseNetstatRoutes(t *testing.T) {
+	darwin := `Routing tables
+
+Internet:
+Destination        Gateway            Flags               Netif Expire
+default            192.168.1.1        UGScg                 en0
+10.254.0.3         10.254.0.2         UGHS                utun3
+10.254.1/24        10.254.0.2         UGSc                utun3
+10.254.0.5         127.0.0.1          UGHSB                 lo0
+10.254/16          link#14            UCS                 utun3
+127                127.0.0.1          UCS                   lo0
+`
+	freebsd := `Routing tables
+
+Internet6:
+Destination                       Gateway                       Flags     Netif Expire
+::/96                             ::1                           UGRS        lo0
+fd00:254::3                       fd00:254::2                   UGHS        wg0
+fd00:254::/64                     link#3                        U           wg0
+fe80::%lo0/64                     link#2                        U           lo0
+`
+	tests := []struct {
+		name   string
+		output string
+		want   []kernelRoute
+	}{
+		{"darwin", darwin, []kernelRoute{
+			{dst: "default", via: "192.168.1.1", dev: "en0"},
+			{dst: "10.254.0.3", via: "10.254.0.2", dev: "utun3"},
+			{dst: "10.254.1.0/24", via: "10.254.0.2", dev: "utun3"},
+			{dst: "10.254.0.5", dev: "lo0", blackhole: true},
+			{dst: "10.254.0.0/16", dev: "utun3"},
+		}},
+		{"freebsd", freebsd, []kernelRoute{
+			{dst: "::/96", via: "::1", dev: "lo0"},
+			{dst: "fd00:254::3", via: "fd00:254::2", dev: "wg0"},
+			{dst: "fd00:254::/64", dev: "wg0"},
+			{dst: "fe80::/64", dev: "lo0"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes := parseNetstatRoutes(tt.output)
+			if len(routes) != len(tt.want) {
+				t.Fatalf("routes = %+v, want %+v", routes, tt.want)
+			}
+			for i := range tt.want {
+				if routes[i] != tt.want[i] {
+					t.Errorf("routes[%d] = %+v, want %+v", i, routes[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
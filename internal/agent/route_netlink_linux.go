@@ -0,0 +1,449 @@
+//go:build linux
+
+package agent
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+)
+
+// netlinkRecvBuffer 单次读取 netlink 响应的缓冲区大小，路由表转储按多个消息分批返回
+const netlinkRecvBuffer = 64 * 1024
+
+// 策略路由规则的属性和动作（linux/fib_rules.h），syscall 包中没有定义
+const (
+	fraDst      = 1  // FRA_DST
+	fraPriority = 6  // FRA_PRIORITY
+	fraTable    = 15 // FRA_TABLE
+	frActToTbl  = 1  // FR_ACT_TO_TBL
+)
+
+// netlinkRouter 通过 rtnetlink 套接字直接操作内核路由表，不依赖 iproute2
+// 请求串行发送，按序号匹配响应；读取 WireGuard 接口时也用它收发 generic netlink 请求
+type netlinkRouter struct {
+	mu  sync.Mutex
+	fd  int
+	seq uint32
+}
+
+// newNetlinkRouter 打开 NETLINK_ROUTE 套接字
+func newNetlinkRouter() (*netlinkRouter, error) {
+	return openNetlink(syscall.NETLINK_ROUTE)
+}
+
+// openNetlink 打开指定协议的 netlink 套接字
+func openNetlink(protocol int) (*netlinkRouter, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, protocol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open netlink socket: %w", err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		_ = syscall.Close(fd)
+		return nil, fmt.Errorf("failed to bind netlink socket: %w", err)
+	}
+	// 内核不应答时不至于永久阻塞
+	tv := syscall.NsecToTimeval(int64(commandTimeout))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		_ = syscall.Close(fd)
+		return nil, fmt.Errorf("failed to set netlink timeout: %w", err)
+	}
+	return &netlinkRouter{fd: fd}, nil
+}
+
+// close 关闭套接字
+func (n *netlinkRouter) close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return syscall.Close(n.fd)
+}
+
+// apply 执行一条路由或规则变更，flush 转储路由表后逐条删除
+func (n *netlinkRouter) apply(req routeRequest) error {
+	if req.rule {
+		if req.op == "add" {
+			return n.rule(syscall.RTM_NEWRULE, syscall.NLM_F_CREATE, req)
+		}
+		return n.rule(syscall.RTM_DELRULE, 0, req)
+	}
+	switch req.op {
+	case "replace":
+		return n.change(syscall.RTM_NEWROUTE, syscall.NLM_F_CREATE|syscall.NLM_F_REPLACE, req)
+	case "del":
+		return n.change(syscall.RTM_DELROUTE, 0, req)
+	case "flush":
+		routes, err := n.list(req.table, req.v6)
+		if err != nil {
+			return err
+		}
+		for _, r := range routes {
+			dst, err := parseRouteDst(r.dst)
+			if err != nil {
+				continue // default 等无法按目的地删除的路由
+			}
+			err = n.change(syscall.RTM_DELROUTE, 0, routeRequest{op: "del", dst: dst, table: req.table})
+			if err != nil && !errors.Is(err, errRouteNotFound) {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported route operation %q", req.op)
+	}
+}
+
+// change 发送 RTM_NEWROUTE 或 RTM_DELROUTE 并等待内核确认
+// 字段取值与 ip route replace/del 相同：新增路由的协议默认为 boot，没有网关时作用域为 link
+func (n *netlinkRouter) change(msgType uint16, flags int, req routeRequest) error {
+	family, dst := routeFamily(req.dst.IP)
+	ones, _ := req.dst.Mask.Size()
+	rtm := syscall.RtMsg{
+		Family:  family,
+		Dst_len: uint8(ones),
+		Table:   routeTableByte(req.table),
+		Scope:   syscall.RT_SCOPE_NOWHERE,
+	}
+	switch {
+	case msgType == syscall.RTM_DELROUTE:
+		// 删除时按类型匹配黑洞路由
+		if req.blackhole {
+			rtm.Type = syscall.RTN_BLACKHOLE
+		}
+	case req.blackhole:
+		// 与 ip route replace blackhole 相同：作用域为 universe
+		rtm.Protocol = syscall.RTPROT_BOOT
+		rtm.Type = syscall.RTN_BLACKHOLE
+		rtm.Scope = syscall.RT_SCOPE_UNIVERSE
+	default:
+		rtm.Protocol = syscall.RTPROT_BOOT
+		rtm.Type = syscall.RTN_UNICAST
+		rtm.Scope = syscall.RT_SCOPE_LINK
+		if req.via != nil || len(req.nexthops) > 0 {
+			rtm.Scope = syscall.RT_SCOPE_UNIVERSE
+		}
+	}
+
+	// 删除时协议号为 0 表示不按协议号匹配
+	if req.protocol != 0 {
+		rtm.Protocol = req.protocol
+	}
+
+	b := newNetlinkMessage(msgType, syscall.NLM_F_REQUEST|syscall.NLM_F_ACK|flags)
+	b.rtMsg(rtm)
+	b.attr(syscall.RTA_DST, dst)
+	if req.via != nil {
+		_, gw := routeFamily(req.via)
+		b.attr(syscall.RTA_GATEWAY, gw)
+	}
+	if req.dev != "" {
+		ifi, err := net.InterfaceByName(req.dev)
+		if err != nil {
+			return err
+		}
+		b.attrUint32(syscall.RTA_OIF, uint32(ifi.Index))
+	}
+	b.attrUint32(syscall.RTA_TABLE, routeTableID(req.table))
+	if req.metric != 0 {
+		b.attrUint32(syscall.RTA_PRIORITY, req.metric)
+	}
+	if len(req.nexthops) > 0 {
+		multipath, err := encodeMultipath(req.nexthops)
+		if err != nil {
+			return err
+		}
+		b.attr(syscall.RTA_MULTIPATH, multipath)
+	}
+
+	_, err := n.request(b)
+	if errors.Is(err, syscall.ESRCH) {
+		return fmt.Errorf("%w: %s", errRouteNotFound, err)
+	}
+	return err
+}
+
+// rule 发送 RTM_NEWRULE 或 RTM_DELRULE 并等待内核确认，规则匹配目的地址并查找路由表 req.table
+func (n *netlinkRouter) rule(msgType uint16, flags int, req routeRequest) error {
+	family, dst := routeFamily(req.dst.IP)
+	ones, _ := req.dst.Mask.Size()
+
+	// fib_rule_hdr 与 rtmsg 的布局相同，Protocol、Scope 对应两个保留字节，Type 对应 action
+	b := newNetlinkMessage(msgType, syscall.NLM_F_REQUEST|syscall.NLM_F_ACK|flags)
+	b.rtMsg(syscall.RtMsg{
+		Family:  family,
+		Dst_len: uint8(ones),
+		Table:   routeTableByte(req.table),
+		Type:    frActToTbl,
+	})
+	b.attr(fraDst, dst)
+	b.attrUint32(fraPriority, uint32(req.priority))
+	b.attrUint32(fraTable, routeTableID(req.table))
+
+	_, err := n.request(b)
+	if errors.Is(err, syscall.ENOENT) {
+		return fmt.Errorf("%w: %s", errRouteNotFound, err)
+	}
+	return err
+}
+
+// list 转储路由表 table（0 表示主路由表）中 IPv4 或 IPv6（v6 为 true）的单播路由
+func (n *netlinkRouter) list(table int, v6 bool) ([]kernelRoute, error) {
+	b := newNetlinkMessage(syscall.RTM_GETROUTE, syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP)
+	family := uint8(syscall.AF_INET)
+	if v6 {
+		family = syscall.AF_INET6
+	}
+	b.rtMsg(syscall.RtMsg{Family: family})
+	msgs, err := n.request(b)
+	if err != nil {
+		return nil, err
+	}
+
+	want := routeTableID(table)
+	names := make(map[uint32]string)
+	var routes []kernelRoute
+	for i := range msgs {
+		m := &msgs[i]
+		if m.Header.Type != syscall.RTM_NEWROUTE || len(m.Data) < syscall.SizeofRtMsg {
+			continue
+		}
+		dstLen, tableID, protocol, rtType := m.Data[1], uint32(m.Data[4]), m.Data[5], m.Data[7]
+		attrs, err := syscall.ParseNetlinkRouteAttr(m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse route: %w", err)
+		}
+
+		route := kernelRoute{dst: "default", protocol: protocol}
+		for _, a := range attrs {
+			switch a.Attr.Type {
+			case syscall.RTA_TABLE:
+				if len(a.Value) >= 4 {
+					tableID = binary.NativeEndian.Uint32(a.Value)
+				}
+			case syscall.RTA_DST:
+				ip := net.IP(a.Value)
+				route.dst = formatRouteDst(&net.IPNet{IP: ip, Mask: net.CIDRMask(int(dstLen), len(ip)*8)})
+			case syscall.RTA_GATEWAY:
+				route.via = net.IP(a.Value).String()
+			case syscall.RTA_OIF:
+				if len(a.Value) >= 4 {
+					route.dev = interfaceName(names, binary.NativeEndian.Uint32(a.Value))
+				}
+			case syscall.RTA_PRIORITY:
+				if len(a.Value) >= 4 {
+					route.metric = binary.NativeEndian.Uint32(a.Value)
+				}
+			case syscall.RTA_MULTIPATH:
+				// 与 ip route show 一致，via 和 dev 取第一个下一跳
+				if ifindex, gw, ok := firstNexthop(a.Value); ok {
+					route.dev = interfaceName(names, ifindex)
+					if gw != nil {
+						route.via = gw.String()
+					}
+				}
+			}
+		}
+		if tableID != want || (rtType != syscall.RTN_UNICAST && rtType != syscall.RTN_BLACKHOLE) {
+			continue
+		}
+		route.blackhole = rtType == syscall.RTN_BLACKHOLE
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// request 发送请求并读取响应，直到收到确认、错误或转储结束
+// 返回转储请求的数据消息，内核返回的错误转换为 syscall.Errno
+func (n *netlinkRouter) request(b *netlinkMessage) ([]syscall.NetlinkMessage, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.seq++
+	seq := n.seq
+	if err := syscall.Sendto(n.fd, b.finish(seq), 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("netlink send failed: %w", err)
+	}
+
+	var result []syscall.NetlinkMessage
+	buf := make([]byte, netlinkRecvBuffer)
+	for {
+		nr, _, err := syscall.Recvfrom(n.fd, buf, 0)
+		if err != nil {
+			return nil, fmt.Errorf("netlink receive failed: %w", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:nr])
+		if err != nil {
+			return nil, fmt.Errorf("invalid netlink response: %w", err)
+		}
+		for _, m := range msgs {
+			// 忽略之前超时的请求迟到的响应
+			if m.Header.Seq != seq {
+				continue
+			}
+			switch m.Header.Type {
+			case syscall.NLMSG_ERROR, syscall.NLMSG_DONE:
+				if len(m.Data) >= 4 {
+					if errno := int32(binary.NativeEndian.Uint32(m.Data)); errno != 0 {
+						return nil, syscall.Errno(-errno)
+					}
+				}
+				return result, nil
+			default:
+				result = append(result, syscall.NetlinkMessage{
+					Header: m.Header,
+					Data:   append([]byte(nil), m.Data...),
+				})
+			}
+		}
+	}
+}
+
+// netlinkMessage 构造中的 netlink 请求
+type netlinkMessage struct {
+	typ   uint16
+	flags uint16
+	data  []byte
+}
+
+// newNetlinkMessage 创建请求，消息头在 finish 时填写
+func newNetlinkMessage(typ uint16, flags int) *netlinkMessage {
+	return &netlinkMessage{typ: typ, flags: uint16(flags)}
+}
+
+// rtMsg 追加路由消息头
+func (b *netlinkMessage) rtMsg(rtm syscall.RtMsg) {
+	b.data = append(b.data,
+		rtm.Family, rtm.Dst_len, rtm.Src_len, rtm.Tos,
+		rtm.Table, rtm.Protocol, rtm.Scope, rtm.Type,
+	)
+	b.data = binary.NativeEndian.AppendUint32(b.data, rtm.Flags)
+}
+
+// attr 追加一个路由属性，按 4 字节对齐
+func (b *netlinkMessage) attr(typ uint16, value []byte) {
+	length := syscall.SizeofRtAttr + len(value)
+	b.data = binary.NativeEndian.AppendUint16(b.data, uint16(length))
+	b.data = binary.NativeEndian.AppendUint16(b.data, typ)
+	b.data = append(b.data, value...)
+	for length%syscall.RTA_ALIGNTO != 0 {
+		b.data = append(b.data, 0)
+		length++
+	}
+}
+
+// attrUint32 追加一个 32 位整数属性
+func (b *netlinkMessage) attrUint32(typ uint16, value uint32) {
+	b.attr(typ, binary.NativeEndian.AppendUint32(nil, value))
+}
+
+// finish 填写消息头并返回完整的消息
+func (b *netlinkMessage) finish(seq uint32) []byte {
+	msg := make([]byte, 0, syscall.SizeofNlMsghdr+len(b.data))
+	msg = binary.NativeEndian.AppendUint32(msg, uint32(syscall.SizeofNlMsghdr+len(b.data)))
+	msg = binary.NativeEndian.AppendUint16(msg, b.typ)
+	msg = binary.NativeEndian.AppendUint16(msg, b.flags)
+	msg = binary.NativeEndian.AppendUint32(msg, seq)
+	msg = binary.NativeEndian.AppendUint32(msg, 0) // 由内核填写发送方端口
+	return append(msg, b.data...)
+}
+
+// encodeMultipath 编码 RTA_MULTIPATH 属性：每个下一跳为 struct rtnexthop 加上 RTA_GATEWAY 属性
+// rtnexthop 中的 hops 字段为权重减一
+func encodeMultipath(nexthops []routeNexthop) ([]byte, error) {
+	nested := &netlinkMessage{}
+	for _, nh := range nexthops {
+		var ifindex int
+		if nh.dev != "" {
+			ifi, err := net.InterfaceByName(nh.dev)
+			if err != nil {
+				return nil, err
+			}
+			ifindex = ifi.Index
+		}
+		weight := nh.weight
+		if weight == 0 {
+			weight = 1
+		}
+
+		start := len(nested.data)
+		nested.data = append(nested.data, make([]byte, syscall.SizeofRtNexthop)...)
+		if nh.via != nil {
+			_, gw := routeFamily(nh.via)
+			nested.attr(syscall.RTA_GATEWAY, gw)
+		}
+		hdr := nested.data[start:]
+		binary.NativeEndian.PutUint16(hdr[0:2], uint16(len(hdr)))
+		hdr[3] = uint8(weight - 1)
+		binary.NativeEndian.PutUint32(hdr[4:8], uint32(ifindex))
+	}
+	return nested.data, nil
+}
+
+// firstNexthop 解析 RTA_MULTIPATH 属性中第一个下一跳的网卡索引和网关
+func firstNexthop(value []byte) (uint32, net.IP, bool) {
+	if len(value) < syscall.SizeofRtNexthop {
+		return 0, nil, false
+	}
+	length := int(binary.NativeEndian.Uint16(value[0:2]))
+	if length < syscall.SizeofRtNexthop || length > len(value) {
+		return 0, nil, false
+	}
+	ifindex := binary.NativeEndian.Uint32(value[4:8])
+
+	attrs := value[syscall.SizeofRtNexthop:length]
+	for len(attrs) >= syscall.SizeofRtAttr {
+		attrLen := int(binary.NativeEndian.Uint16(attrs[0:2]))
+		if attrLen < syscall.SizeofRtAttr || attrLen > len(attrs) {
+			break
+		}
+		if binary.NativeEndian.Uint16(attrs[2:4]) == syscall.RTA_GATEWAY {
+			return ifindex, net.IP(append([]byte(nil), attrs[syscall.SizeofRtAttr:attrLen]...)), true
+		}
+		next := (attrLen + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+		if next > len(attrs) {
+			break
+		}
+		attrs = attrs[next:]
+	}
+	return ifindex, nil, true
+}
+
+// routeFamily 返回地址族及地址的网络字节序表示
+func routeFamily(ip net.IP) (uint8, []byte) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return syscall.AF_INET, ip4
+	}
+	return syscall.AF_INET6, ip.To16()
+}
+
+// routeTableID 将路由表编号（0 表示主路由表）转换为内核中的编号
+func routeTableID(table int) uint32 {
+	if table == 0 {
+		return syscall.RT_TABLE_MAIN
+	}
+	return uint32(table)
+}
+
+// routeTableByte 路由消息头中的表编号，超过 255 的表只能通过 RTA_TABLE 属性指定
+func routeTableByte(table int) uint8 {
+	id := routeTableID(table)
+	if id > 255 {
+		return syscall.RT_TABLE_UNSPEC
+	}
+	return uint8(id)
+}
+
+// interfaceName 按索引查找网卡名，结果缓存在 names 中；网卡已不存在时返回索引
+func interfaceName(names map[uint32]string, index uint32) string {
+	if name, ok := names[index]; ok {
+		return name
+	}
+	name := fmt.Sprintf("if%d", index)
+	if ifi, err := net.InterfaceByIndex(int(index)); err == nil {
+		name = ifi.Name
+	}
+	names[index] = name
+	return name
+}
@@ -0,0 +1,87 @@
+//go:build linux
+
+package agent
+
+import (
+	"net"
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+func TestNetlinkMessage(t *testing.T) {
+	b := newNetlinkMessage(syscall.RTM_NEWROUTE, syscall.NLM_F_REQUEST|syscall.NLM_F_ACK)
+	b.rtMsg(syscall.RtMsg{Family: syscall.AF_INET, Dst_len: 32, Table: syscall.RT_TABLE_MAIN})
+	b.attr(syscall.RTA_DST, net.ParseIP("10.254.0.3").To4())
+	b.attrUint32(syscall.RTA_TABLE, 1000)
+
+	msgs, err := syscall.ParseNetlinkMessage(b.finish(7))
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("ParseNetlinkMessage() = %v, %v", msgs, err)
+	}
+	m := msgs[0]
+	if m.Header.Type != syscall.RTM_NEWROUTE || m.Header.Seq != 7 || m.Data[1] != 32 {
+		t.Errorf("header = %+v, dst_len = %d", m.Header, m.Data[1])
+	}
+	attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+	if err != nil || len(attrs) != 2 {
+		t.Fatalf("ParseNetlinkRouteAttr() = %v, %v", attrs, err)
+	}
+	if ip := net.IP(attrs[0].Value); attrs[0].Attr.Type != syscall.RTA_DST || !ip.Equal(net.ParseIP("10.254.0.3")) {
+		t.Errorf("RTA_DST = %v", ip)
+	}
+	if attrs[1].Attr.Type != syscall.RTA_TABLE || routeTableByte(1000) != syscall.RT_TABLE_UNSPEC {
+		t.Errorf("table attribute = %+v", attrs[1])
+	}
+}
+
+func TestEncodeMultipath(t *testing.T) {
+	value, err := encodeMultipath([]routeNexthop{
+		{via: net.ParseIP("10.254.0.2"), weight: 3},
+		{via: net.ParseIP("10.254.0.3")},
+	})
+	if err != nil {
+		t.Fatalf("encodeMultipath: %v", err)
+	}
+	// 每个下一跳为 8 字节 rtnexthop 加 8 字节 RTA_GATEWAY
+	if len(value) != 32 || value[3] != 2 || value[16+3] != 0 {
+		t.Fatalf("encoded = %v", value)
+	}
+	ifindex, gw, ok := firstNexthop(value)
+	if !ok || ifindex != 0 || !gw.Equal(net.ParseIP("10.254.0.2")) {
+		t.Errorf("firstNexthop() = %d, %v, %v", ifindex, gw, ok)
+	}
+	if _, _, ok := firstNexthop(value[:4]); ok {
+		t.Error("firstNexthop() accepted a truncated attribute")
+	}
+}
+
+func TestNetlinkListRoutes(t *testing.T) {
+	nl, err := newNetlinkRouter()
+	if err != nil {
+		t.Skipf("netlink unavailable: %v", err)
+	}
+	defer nl.close()
+
+	for _, family := range []string{"-4", "-6"} {
+		routes, err := nl.list(0, family == "-6")
+		if err != nil {
+			t.Fatalf("list %s: %v", family, err)
+		}
+
+		// 与 ip route show 的结果一致
+		output, err := exec.Command("ip", family, "route", "show", "table", "main").Output()
+		if err != nil {
+			t.Skipf("ip command unavailable: %v", err)
+		}
+		want := parseIPRouteShow(string(output))
+		if len(routes) != len(want) {
+			t.Fatalf("%s: netlink routes = %+v, ip routes = %+v", family, routes, want)
+		}
+		for i := range want {
+			if routes[i] != want[i] {
+				t.Errorf("%s: routes[%d] = %+v, want %+v", family, i, routes[i], want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package agent
+
+import "errors"
+
+// errNetlinkUnsupported 非 Linux 平台没有 rtnetlink
+var errNetlinkUnsupported = errors.New("netlink is only supported on linux")
+
+// netlinkRouter 非 Linux 平台的占位实现，newNetlinkRouter 总是失败，路由操作使用 route、netsh 或 ip 命令
+type netlinkRouter struct{}
+
+func newNetlinkRouter() (*netlinkRouter, error) {
+	return nil, errNetlinkUnsupported
+}
+
+func (n *netlinkRouter) close() error { return nil }
+
+func (n *netlinkRouter) apply(routeRequest) error { return errNetlinkUnsupported }
+
+func (n *netlinkRouter) list(int, bool) ([]kernelRoute, error) { return nil, errNetlinkUnsupported }
@@ -0,0 +1,258 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// errNetshUnsupported 只有 Windows 提供 netsh
+var errNetshUnsupported = errors.New("netsh backend is only supported on windows")
+
+// netshRouter 通过 netsh interface ipv4|ipv6 修改和读取路由表，用于 Windows
+// Windows 没有策略路由、黑洞路由和路由协议号：只支持主路由表，启动时也无法按协议号识别上次遗留的路由。
+// netsh 的错误信息随系统语言变化，因此先读取路由表再决定 add、set 或 delete，不解析错误信息
+type netshRouter struct{}
+
+// newNetshRouter 在 Windows 上创建 netsh 后端，其他平台返回错误
+func newNetshRouter() (*netshRouter, error) {
+	if runtime.GOOS != "windows" {
+		return nil, errNetshUnsupported
+	}
+	return &netshRouter{}, nil
+}
+
+// close netsh 后端不持有资源
+func (w *netshRouter) close() error { return nil }
+
+// netshHop 一个下一跳对应一条 Windows 路由，via 为 nil 表示直连
+type netshHop struct {
+	via net.IP
+	dev string
+}
+
+// apply 执行一条路由变更
+// replace 先添加或更新期望的下一跳，再删除同一出接口上多余的下一跳，切换期间不会没有路由；
+// 多路径路由的每个下一跳安装为一条同 metric 的路由，由 Windows 等价分担，权重被忽略
+func (w *netshRouter) apply(req routeRequest) error {
+	switch {
+	case req.rule:
+		return errors.New("netsh backend does not support policy routing rules")
+	case req.table != 0:
+		return fmt.Errorf("netsh backend does not support routing table %d", req.table)
+	case req.blackhole:
+		return errors.New("netsh backend does not support blackhole routes")
+	case req.op != "replace" && req.op != "del":
+		return fmt.Errorf("netsh backend does not support route operation %q", req.op)
+	}
+
+	v6 := req.dst.IP.To4() == nil
+	current, err := w.routesTo(req.dst, v6)
+	if err != nil {
+		return err
+	}
+
+	if req.op == "del" {
+		var found bool
+		for _, r := range current {
+			if (req.dev != "" && r.dev != req.dev) || (req.via != nil && r.via != req.via.String()) ||
+				(req.metric != 0 && r.metric != req.metric) {
+				continue
+			}
+			found = true
+			if err := runNetshRoute("delete", req.dst, net.ParseIP(r.via), r.dev, 0); err != nil {
+				return err
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: %s", errRouteNotFound, formatRouteDst(req.dst))
+		}
+		return nil
+	}
+
+	hops := []netshHop{{via: req.via, dev: req.dev}}
+	if len(req.nexthops) > 0 {
+		hops = hops[:0]
+		for _, nh := range req.nexthops {
+			hops = append(hops, netshHop{via: nh.via, dev: nh.dev})
+		}
+	}
+	wanted := make(map[string]bool, len(hops))
+	devs := make(map[string]bool, len(hops))
+	for _, hop := range hops {
+		via := ""
+		if hop.via != nil {
+			via = hop.via.String()
+		}
+		wanted[hop.dev+" "+via] = true
+		devs[hop.dev] = true
+
+		op := "add"
+		for _, r := range current {
+			if r.dev == hop.dev && r.via == via {
+				op = "set"
+				if req.metric == 0 || r.metric == req.metric {
+					op = ""
+				}
+				break
+			}
+		}
+		if op == "" {
+			continue
+		}
+		if err := runNetshRoute(op, req.dst, hop.via, hop.dev, req.metric); err != nil {
+			return err
+		}
+	}
+	for _, r := range current {
+		if !devs[r.dev] || wanted[r.dev+" "+r.via] {
+			continue // 其他接口上的路由不由 Agent 管理
+		}
+		if err := runNetshRoute("delete", req.dst, net.ParseIP(r.via), r.dev, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// routesTo 返回目的地为 dst 的全部路由
+func (w *netshRouter) routesTo(dst *net.IPNet, v6 bool) ([]kernelRoute, error) {
+	routes, err := w.list(0, v6)
+	if err != nil {
+		return nil, err
+	}
+	want := formatRouteDst(dst)
+	var matched []kernelRoute
+	for _, r := range routes {
+		if r.dst == want {
+			matched = append(matched, r)
+		}
+	}
+	return matched, nil
+}
+
+// list 读取 netsh interface ipv4|ipv6 show route 输出的路由表
+func (w *netshRouter) list(table int, v6 bool) ([]kernelRoute, error) {
+	if table != 0 {
+		return nil, fmt.Errorf("netsh backend does not support routing table %d", table)
+	}
+	family := "ipv4"
+	if v6 {
+		family = "ipv6"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "netsh", "interface", family, "show", "route").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get routes: %w", err)
+	}
+	return parseNetshRoutes(string(output), func(index int) string {
+		if ifi, err := net.InterfaceByIndex(index); err == nil {
+			return ifi.Name
+		}
+		return strconv.Itoa(index)
+	}), nil
+}
+
+// netshRouteCommand 生成 netsh 的 add、set 或 delete route 命令，例如：
+//
+//	netsh interface ipv4 add route prefix=10.254.0.3/32 interface=18 nexthop=10.254.0.2 store=active
+//	netsh interface ipv6 set route prefix=fd00:254::3/128 interface=18 nexthop=fd00:254::2 metric=5 store=active
+//	netsh interface ipv4 delete route prefix=10.254.0.3/32 interface=18 nexthop=10.254.0.2 store=active
+//
+// 接口使用编号，避免名称中的空格和非 ASCII 字符；store=active 表示路由不持久化，重启后消失，与 Linux 相同
+func netshRouteCommand(op string, dst *net.IPNet, via net.IP, ifindex int, metric uint32) []string {
+	family := "ipv4"
+	if dst.IP.To4() == nil {
+		family = "ipv6"
+	}
+	args := []string{"netsh", "interface", family, op, "route",
+		"prefix=" + dst.String(), "interface=" + strconv.Itoa(ifindex)}
+	if via != nil && !via.IsUnspecified() {
+		args = append(args, "nexthop="+via.String())
+	}
+	if metric != 0 && op != "delete" {
+		args = append(args, "metric="+strconv.FormatUint(uint64(metric), 10))
+	}
+	return append(args, "store=active")
+}
+
+// runNetshRoute 按接口名称查找编号后执行 netsh 路由命令
+func runNetshRoute(op string, dst *net.IPNet, via net.IP, dev string, metric uint32) error {
+	if dev == "" {
+		return fmt.Errorf("netsh backend requires an interface for %s", dst)
+	}
+	ifindex, err := strconv.Atoi(dev)
+	if err != nil {
+		ifi, err := net.InterfaceByName(dev)
+		if err != nil {
+			return fmt.Errorf("interface %s: %w", dev, err)
+		}
+		ifindex = ifi.Index
+	}
+
+	args := netshRouteCommand(op, dst, via, ifindex, metric)
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	// #nosec G204 - args are generated internally from validated IPs
+	if output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput(); err != nil { //nolint:gosec
+		return fmt.Errorf("netsh command failed: %s, output: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// parseNetshRoutes 解析 netsh interface ipv4|ipv6 show route 的输出，例如：
+//
+//	Publish  Type      Met  Prefix                    Idx  Gateway/Interface Name
+//	-------  --------  ---  ------------------------  ---  ------------------------
+//	No       Manual    0    0.0.0.0/0                   12  192.168.1.1
+//	No       System    256  10.254.0.0/24               18  wg0
+//	No       Manual    0    10.254.0.3/32               18  10.254.0.2
+//
+// 表头和前两列随系统语言变化，因此只按位置解析虚线之后的行；最后一列为网关，直连路由为可能含空格的接口名称。
+// 出接口按 Idx 由 ifname 转换为名称，目的地格式化为与 ip route show 相同的形式
+func parseNetshRoutes(output string, ifname func(int) string) []kernelRoute {
+	var routes []kernelRoute
+	var body bool
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if strings.HasPrefix(fields[0], "---") {
+			body = true
+			continue
+		}
+		if !body || len(fields) < 6 {
+			continue
+		}
+
+		metric, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			continue
+		}
+		index, err := strconv.Atoi(fields[4])
+		if err != nil {
+			continue
+		}
+		dst, err := parseRouteDst(fields[3])
+		if err != nil {
+			continue
+		}
+		route := kernelRoute{dst: formatRouteDst(dst), dev: ifname(index), metric: uint32(metric)}
+		if ones, _ := dst.Mask.Size(); ones == 0 {
+			route.dst = "default"
+		}
+		if gw := net.ParseIP(fields[5]); gw != nil && len(fields) == 6 && !gw.IsUnspecified() {
+			route.via = gw.String()
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"net"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNetshRouteCommand(t *testing.T) {
+	dst4, _ := parseRouteDst("10.254.0.3")
+	dst6, _ := parseRouteDst("fd00:254:1::/64")
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{netshRouteCommand("add", dst4, net.ParseIP("10.254.0.2"), 18, 0),
+			"netsh interface ipv4 add route prefix=10.254.0.3/32 interface=18 nexthop=10.254.0.2 store=active"},
+		{netshRouteCommand("set", dst6, net.ParseIP("fd00:254::2"), 18, 50),
+			"netsh interface ipv6 set route prefix=fd00:254:1::/64 interface=18 nexthop=fd00:254::2 metric=50 store=active"},
+		{netshRouteCommand("add", dst4, nil, 18, 0),
+			"netsh interface ipv4 add route prefix=10.254.0.3/32 interface=18 store=active"},
+		{netshRouteCommand("delete", dst4, net.ParseIP("10.254.0.2"), 18, 50),
+			"netsh interface ipv4 delete route prefix=10.254.0.3/32 interface=18 nexthop=10.254.0.2 store=active"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(tt.args, " "); got != tt.want {
+			t.Errorf("netshRouteCommand() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestNetshRouterRejectsUnsupported(t *testing.T) {
+	w := &netshRouter{}
+	for _, args := range [][]string{
+		{"ip", "rule", "add", "to", "10.254.0.0/24", "lookup", "100", "priority", "1000"},
+		{"ip", "route", "replace", "10.254.0.3/32", "via", "10.254.0.2", "dev", "wg0", "table", "100"},
+		{"ip", "route", "replace", "blackhole", "10.254.0.5/32"},
+		{"ip", "route", "flush", "table", "100"},
+	} {
+		req, err := parseRouteArgs(args)
+		if err != nil {
+			t.Fatalf("parseRouteArgs(%v) error = %v", args, err)
+		}
+		if err := w.apply(req); err == nil {
+			t.Errorf("apply(%v) succeeded, want unsupported error", args)
+		}
+	}
+	if _, err := w.list(100, false); err == nil {
+		t.Error("list(100) succeeded, want unsupported error")
+	}
+}
+
+func TestNewNetshRouter(t *testing.T) {
+	if _, err := newNetshRouter(); (runtime.GOOS == "windows") != (err == nil) {
+		t.Errorf("newNetshRouter() on %s error = %v", runtime.GOOS, err)
+	}
+}
+
+func TestParseNetshRoutes(t *testing.T) {
+	ipv4 := `
+Publish  Type      Met  Prefix                    Idx  Gateway/Interface Name
+-------  --------  ---  ------------------------  ---  ------------------------
+No       Manual    0    0.0.0.0/0                   12  192.168.1.1
+No       System    256  10.254.0.0/24               18  wg0
+No       Manual    0    10.254.0.3/32               18  10.254.0.2
+No       Manual    50   10.254.1.0/24               18  10.254.0.2
+No       System    256  127.0.0.0/8                  1  Loopback Pseudo-Interface 1
+`
+	names := map[int]string{1: "Loopback Pseudo-Interface 1", 12: "Ethernet", 18: "wg0"}
+	ifname := func(index int) string {
+		if name, ok := names[index]; ok {
+			return name
+		}
+		return strconv.Itoa(index)
+	}
+
+	want := []kernelRoute{
+		{dst: "default", via: "192.168.1.1", dev: "Ethernet"},
+		{dst: "10.254.0.0/24", dev: "wg0", metric: 256},
+		{dst: "10.254.0.3", via: "10.254.0.2", dev: "wg0"},
+		{dst: "10.254.1.0/24", via: "10.254.0.2", dev: "wg0", metric: 50},
+		{dst: "127.0.0.0/8", dev: "Loopback Pseudo-Interface 1", metric: 256},
+	}
+	if got := parseNetshRoutes(ipv4, ifname); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNetshRoutes(ipv4) =\n%+v\nwant\n%+v", got, want)
+	}
+
+	// 表头随系统语言变化，只按虚线之后的列位置解析
+	ipv6 := `
+Veröffentl.  Typ       Met  Präfix                    Idx  Gateway/Schnittstellenname
+-----------  --------  ---  ------------------------  ---  ------------------------
+Nein         Manuell   0    fd00:254::3/128             18  fd00:254::2
+Nein         System    256  fe80::/64                   18  wg0
+`
+	want = []kernelRoute{
+		{dst: "fd00:254::3", via: "fd00:254::2", dev: "wg0"},
+		{dst: "fe80::/64", dev: "wg0", metric: 256},
+	}
+	if got := parseNetshRoutes(ipv6, ifname); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNetshRoutes(ipv6) =\n%+v\nwant\n%+v", got, want)
+	}
+}
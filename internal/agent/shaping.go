@@ -0,0 +1,263 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// htb 类别编号：1:1 为根类别，1:2 存放未整形的流量，下一跳的类别从 1:10 开始
+const (
+	shapingRootClass    = 0x1
+	shapingDefaultClass = 0x2
+	shapingFirstClass   = 0x10
+)
+
+// shapingPriorities 整形优先级对应的 htb prio，数值越小越先借用空闲带宽
+var shapingPriorities = map[string]int{
+	models.ShapingPriorityHigh:   0,
+	models.ShapingPriorityNormal: 1,
+	models.ShapingPriorityLow:    2,
+}
+
+// Shaper 按 Controller 下发的出口整形参数在 WireGuard 接口上配置 tc htb 队列
+// 每个整形的下一跳对应一个 htb 类别；WireGuard 接口上报文的目的地址是最终目的地，
+// 因此按当前路由把目的地归入下一跳的类别，u32 过滤器按目的地址分类
+type Shaper struct {
+	dev      string
+	linkRate float64 // 根类别的速率（Mbps）
+
+	mu      sync.Mutex
+	shaping []models.NextHopShaping // 已生效的整形参数，按下一跳排序，为空表示未配置 tc
+	filters []shapingFilter         // 已安装的过滤器
+	logger  logging.Logger
+}
+
+// shapingFilter 把目的地址落在 dst 内的流量归入 htb 类别 1:class
+type shapingFilter struct {
+	dst   *net.IPNet
+	class int
+}
+
+// NewShaper 按 network 和 shaping 配置创建出口整形器，Controller 下发整形参数之前不修改网卡
+func NewShaper(cfg *config.AgentConfig, logger logging.Logger) *Shaper {
+	if logger == nil {
+		logger = logging.NewNopLogger()
+	}
+	return &Shaper{
+		dev:      cfg.Network.WGInterface,
+		linkRate: cfg.Shaping.LinkRateMbps,
+		logger:   logger,
+	}
+}
+
+// shapingClassID 格式化 htb 类别编号，tc 按十六进制解析次编号
+func shapingClassID(class int) string {
+	return fmt.Sprintf("1:%x", class)
+}
+
+// shapingRate 格式化 tc 使用的速率
+func shapingRate(mbps float64) string {
+	return strconv.FormatFloat(mbps, 'f', -1, 64) + "mbit"
+}
+
+// GenerateQdiscCommands 生成在网卡上建立 htb 根队列和各类别的命令
+// 下一跳的类别按 shaping 中的顺序编号；限速的类别速率和上限都为 rate_mbps，不限速的类别可以用满根类别的带宽
+func (s *Shaper) GenerateQdiscCommands(shaping []models.NextHopShaping) [][]string {
+	link := shapingRate(s.linkRate)
+	cmds := [][]string{
+		{"tc", "qdisc", "add", "dev", s.dev, "root", "handle", "1:", "htb", "default", strconv.FormatInt(shapingDefaultClass, 16)},
+		{"tc", "class", "add", "dev", s.dev, "parent", "1:", "classid", shapingClassID(shapingRootClass),
+			"htb", "rate", link, "ceil", link},
+		{"tc", "class", "add", "dev", s.dev, "parent", shapingClassID(shapingRootClass), "classid", shapingClassID(shapingDefaultClass),
+			"htb", "rate", link, "ceil", link, "prio", strconv.Itoa(shapingPriorities[models.ShapingPriorityNormal])},
+	}
+	for i, sh := range shaping {
+		rate := link
+		if sh.RateMbps > 0 {
+			rate = shapingRate(sh.RateMbps)
+		}
+		prio, ok := shapingPriorities[sh.Priority]
+		if !ok {
+			prio = shapingPriorities[models.ShapingPriorityNormal]
+		}
+		cmds = append(cmds, []string{"tc", "class", "add", "dev", s.dev, "parent", shapingClassID(shapingRootClass),
+			"classid", shapingClassID(shapingFirstClass + i),
+			"htb", "rate", rate, "ceil", rate, "prio", strconv.Itoa(prio)})
+	}
+	return cmds
+}
+
+// GenerateFilterCommands 生成按目的地址分类的 u32 过滤器命令
+// IPv4 和 IPv6 的过滤器使用不同的优先级；同一优先级内按添加顺序匹配，filters 应按前缀从长到短排列
+func (s *Shaper) GenerateFilterCommands(filters []shapingFilter) [][]string {
+	cmds := make([][]string, 0, len(filters))
+	for _, f := range filters {
+		protocol, prio, match := "ip", "1", "ip"
+		if f.dst.IP.To4() == nil {
+			protocol, prio, match = "ipv6", "2", "ip6"
+		}
+		cmds = append(cmds, []string{"tc", "filter", "add", "dev", s.dev, "parent", "1:",
+			"protocol", protocol, "prio", prio,
+			"u32", "match", match, "dst", f.dst.String(), "flowid", shapingClassID(f.class)})
+	}
+	return cmds
+}
+
+// classify 按当前路由生成过滤器：发往整形下一跳本身及经它中继的目的地归入该下一跳的类别，
+// 经其他下一跳的路由归入默认类别，避免被包含它的、经整形下一跳的较短前缀误匹配
+func classify(shaping []models.NextHopShaping, routes []CurrentRoute) []shapingFilter {
+	classes := make(map[string]int, len(shaping))
+	var filters []shapingFilter
+	for i, sh := range shaping {
+		ip := net.ParseIP(sh.NextHop)
+		if ip == nil {
+			continue
+		}
+		classes[ip.String()] = shapingFirstClass + i
+		filters = append(filters, shapingFilter{dst: hostNet(ip), class: shapingFirstClass + i})
+	}
+
+	for _, r := range routes {
+		via := net.ParseIP(r.NextHop)
+		if via == nil {
+			continue // 直连和黑洞路由不经过下一跳
+		}
+		dst, err := parseRouteDst(r.Destination)
+		if err != nil {
+			continue
+		}
+		class, ok := classes[via.String()]
+		if !ok {
+			class = shapingDefaultClass
+		}
+		filters = append(filters, shapingFilter{dst: dst, class: class})
+	}
+
+	sort.SliceStable(filters, func(i, j int) bool {
+		oi, _ := filters[i].dst.Mask.Size()
+		oj, _ := filters[j].dst.Mask.Size()
+		if oi != oj {
+			return oi > oj
+		}
+		return filters[i].dst.String() < filters[j].dst.String()
+	})
+	return filters
+}
+
+// hostNet 返回只包含 ip 的前缀
+func hostNet(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// Update 应用 Controller 下发的整形参数，routes 为当前生效的路由
+// 整形参数变化时重建 htb 队列，路由变化时重建过滤器；参数为空时删除队列，恢复内核默认的出口队列
+func (s *Shaper) Update(shaping []models.NextHopShaping, routes []CurrentRoute) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	desired := append([]models.NextHopShaping(nil), shaping...)
+	sort.Slice(desired, func(i, j int) bool { return desired[i].NextHop < desired[j].NextHop })
+
+	if !slices.Equal(desired, s.shaping) {
+		if len(desired) == 0 {
+			err := s.removeLocked()
+			if err == nil {
+				s.logger.Info("Egress shaping removed", logging.F("interface", s.dev))
+			}
+			return err
+		}
+
+		_ = runCommand([]string{"tc", "qdisc", "del", "dev", s.dev, "root"}, "")
+		s.shaping, s.filters = nil, nil
+		for _, args := range s.GenerateQdiscCommands(desired) {
+			if err := runCommand(args, ""); err != nil {
+				return err
+			}
+		}
+		s.shaping = desired
+		s.logger.Info("Egress shaping installed",
+			logging.F("interface", s.dev),
+			logging.F("next_hops", len(desired)),
+		)
+	}
+	if len(s.shaping) == 0 {
+		return nil
+	}
+
+	filters := classify(s.shaping, routes)
+	if equalFilters(filters, s.filters) {
+		return nil
+	}
+	// 删除全部过滤器后重新添加，期间的流量进入默认类别
+	_ = runCommand([]string{"tc", "filter", "del", "dev", s.dev, "parent", "1:"}, "")
+	s.filters = nil
+	for _, args := range s.GenerateFilterCommands(filters) {
+		if err := runCommand(args, ""); err != nil {
+			return err
+		}
+	}
+	s.filters = filters
+	return nil
+}
+
+// Active 返回是否已在网卡上配置整形队列
+func (s *Shaper) Active() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.shaping) > 0
+}
+
+// Refresh 路由变化后按已生效的整形参数重建过滤器
+func (s *Shaper) Refresh(routes []CurrentRoute) error {
+	s.mu.Lock()
+	shaping := s.shaping
+	s.mu.Unlock()
+
+	if len(shaping) == 0 {
+		return nil
+	}
+	return s.Update(shaping, routes)
+}
+
+// Remove 删除 htb 队列及其类别和过滤器，退出时调用
+func (s *Shaper) Remove() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.removeLocked()
+}
+
+// removeLocked 删除根队列，未配置 tc 时不做任何操作
+func (s *Shaper) removeLocked() error {
+	if len(s.shaping) == 0 {
+		return nil
+	}
+	if err := runCommand([]string{"tc", "qdisc", "del", "dev", s.dev, "root"}, ""); err != nil {
+		return err
+	}
+	s.shaping, s.filters = nil, nil
+	return nil
+}
+
+// equalFilters 比较两组过滤器
+func equalFilters(a, b []shapingFilter) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].class != b[i].class || a[i].dst.String() != b[i].dst.String() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+func newTestShaper() *Shaper {
+	return NewShaper(&config.AgentConfig{
+		Network: config.NetworkConfig{WGInterface: "wg0"},
+		Shaping: config.ShapingConfig{LinkRateMbps: 100},
+	}, nil)
+}
+
+func TestGenerateQdiscCommands(t *testing.T) {
+	s := newTestShaper()
+
+	var got []string
+	for _, args := range s.GenerateQdiscCommands([]models.NextHopShaping{
+		{NextHop: "10.254.0.2", RateMbps: 12.5, Priority: models.ShapingPriorityLow},
+		{NextHop: "10.254.0.3", Priority: models.ShapingPriorityHigh},
+	}) {
+		got = append(got, strings.Join(args, " "))
+	}
+	want := []string{
+		"tc qdisc add dev wg0 root handle 1: htb default 2",
+		"tc class add dev wg0 parent 1: classid 1:1 htb rate 100mbit ceil 100mbit",
+		"tc class add dev wg0 parent 1:1 classid 1:2 htb rate 100mbit ceil 100mbit prio 1",
+		"tc class add dev wg0 parent 1:1 classid 1:10 htb rate 12.5mbit ceil 12.5mbit prio 2",
+		"tc class add dev wg0 parent 1:1 classid 1:11 htb rate 100mbit ceil 100mbit prio 0",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("qdisc commands:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestClassifyAndGenerateFilterCommands(t *testing.T) {
+	s := newTestShaper()
+	shaping := []models.NextHopShaping{
+		{NextHop: "10.254.0.2", RateMbps: 20},
+		{NextHop: "fd00:254::2", RateMbps: 20},
+	}
+	routes := []CurrentRoute{
+		{Destination: "10.254.1.0/24", NextHop: "10.254.0.2"},
+		{Destination: "10.254.1.128/25", NextHop: "10.254.0.3"}, // 包含在经整形下一跳的前缀内
+		{Destination: "10.254.0.5", NextHop: "10.254.0.2"},
+		{Destination: "10.254.0.6", NextHop: ""},
+		{Destination: "10.254.0.7", NextHop: "blackhole"},
+		{Destination: "fd00:254::5", NextHop: "fd00:254::2"},
+	}
+
+	var got []string
+	for _, args := range s.GenerateFilterCommands(classify(shaping, routes)) {
+		got = append(got, strings.Join(args, " "))
+	}
+	want := []string{
+		"tc filter add dev wg0 parent 1: protocol ipv6 prio 2 u32 match ip6 dst fd00:254::2/128 flowid 1:11",
+		"tc filter add dev wg0 parent 1: protocol ipv6 prio 2 u32 match ip6 dst fd00:254::5/128 flowid 1:11",
+		"tc filter add dev wg0 parent 1: protocol ip prio 1 u32 match ip dst 10.254.0.2/32 flowid 1:10",
+		"tc filter add dev wg0 parent 1: protocol ip prio 1 u32 match ip dst 10.254.0.5/32 flowid 1:10",
+		"tc filter add dev wg0 parent 1: protocol ip prio 1 u32 match ip dst 10.254.1.128/25 flowid 1:2",
+		"tc filter add dev wg0 parent 1: protocol ip prio 1 u32 match ip dst 10.254.1.0/24 flowid 1:10",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("filter commands:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestShaperWithoutShaping(t *testing.T) {
+	s := newTestShaper()
+	// 未配置整形时不执行任何 tc 命令
+	if err := s.Update(nil, []CurrentRoute{{Destination: "10.254.0.5", NextHop: "10.254.0.2"}}); err != nil {
+		t.Errorf("Update() error = %v", err)
+	}
+	if s.Active() {
+		t.Error("Active() = true without shaping")
+	}
+	if err := s.Remove(); err != nil {
+		t.Errorf("Remove() error = %v", err)
+	}
+}
@@ -0,0 +1,328 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+)
+
+// nftSteeringTable 存放流量引导规则的 nftables 表（inet 族，同时处理 IPv4 和 IPv6）
+const nftSteeringTable = "lite_sdwan"
+
+// iptablesSteeringChain mangle 表中存放流量引导规则的链，由 PREROUTING 和 OUTPUT 跳转
+const iptablesSteeringChain = "LITE_SDWAN"
+
+// Steerer 按 steering 配置给匹配端口、协议或 DSCP 的流量打防火墙标记，
+// 并添加 "fwmark <table> lookup <table>" 的 ip rule，把标记的流量引向流量类别路由表
+// 类别路由表中没有路由的目的地继续按后续规则查找，不影响其他流量
+type Steerer struct {
+	backend  string
+	priority int
+	rules    []steeringRule
+	v6       bool // 隧道子网包含 IPv6，需要 ip -6 rule 和 ip6tables
+	logger   logging.Logger
+}
+
+// steeringRule 解析后的流量引导规则
+type steeringRule struct {
+	mark     int // 流量类别的路由表编号，同时作为防火墙标记
+	protocol string
+	ports    [][2]int // 目的端口范围，单个端口的上下限相同
+	dscp     int      // 0 表示不按 DSCP 匹配
+}
+
+// NewSteerer 按 steering 和 network 配置创建流量引导器，没有配置规则时返回 nil
+func NewSteerer(cfg *config.AgentConfig, logger logging.Logger) (*Steerer, error) {
+	if len(cfg.Steering.Rules) == 0 {
+		return nil, nil
+	}
+	if logger == nil {
+		logger = logging.NewNopLogger()
+	}
+
+	s := &Steerer{
+		backend:  cfg.Steering.Backend,
+		priority: cfg.Steering.RulePriority,
+		logger:   logger,
+	}
+	for _, subnet := range []string{cfg.Network.Subnet, cfg.Network.Subnet6} {
+		if _, ipNet, err := net.ParseCIDR(subnet); err == nil && ipNet.IP.To4() == nil {
+			s.v6 = true
+		}
+	}
+	for i, rule := range cfg.Steering.Rules {
+		table, ok := cfg.Network.ClassTables[rule.Class]
+		if !ok {
+			return nil, fmt.Errorf("steering rule %d: class %q is not in network.class_tables", i, rule.Class)
+		}
+		r := steeringRule{mark: table, protocol: rule.Protocol, dscp: rule.DSCP}
+		for _, port := range rule.Ports {
+			lo, hi, err := config.ParsePortRange(port)
+			if err != nil {
+				return nil, fmt.Errorf("steering rule %d: %w", i, err)
+			}
+			r.ports = append(r.ports, [2]int{lo, hi})
+		}
+		s.rules = append(s.rules, r)
+	}
+	return s, nil
+}
+
+// marks 返回规则用到的全部标记，按数值排序
+func (s *Steerer) marks() []int {
+	seen := make(map[int]bool)
+	var marks []int
+	for _, r := range s.rules {
+		if !seen[r.mark] {
+			seen[r.mark] = true
+			marks = append(marks, r.mark)
+		}
+	}
+	sort.Ints(marks)
+	return marks
+}
+
+// GenerateMarkRuleCommand 生成添加或删除（op 为 add 或 del）把标记为 mark 的流量引向路由表 mark 的 ip rule 命令
+func (s *Steerer) GenerateMarkRuleCommand(op string, mark int, v6 bool) []string {
+	args := []string{"ip", "rule", op}
+	if v6 {
+		args = []string{"ip", "-6", "rule", op}
+	}
+	return append(args,
+		"fwmark", strconv.Itoa(mark),
+		"lookup", strconv.Itoa(mark),
+		"priority", strconv.Itoa(s.priority),
+	)
+}
+
+// GenerateNftScript 生成 nft -f 使用的脚本：重建 inet lite_sdwan 表，在 prerouting（转发的流量）和
+// output（本机发出的流量）上给匹配的流量打标记；开头先声明再删除该表，整个脚本原子生效，重复执行不会叠加规则
+func (s *Steerer) GenerateNftScript() string {
+	var rules []string
+	for _, r := range s.rules {
+		rules = append(rules, s.nftRules(r)...)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "table inet %s\n", nftSteeringTable)
+	fmt.Fprintf(&b, "delete table inet %s\n", nftSteeringTable)
+	fmt.Fprintf(&b, "table inet %s {\n", nftSteeringTable)
+	for _, chain := range []struct{ name, hook string }{
+		{"prerouting", "type filter hook prerouting priority mangle; policy accept;"},
+		// route 类型的链在标记变化后重新查路由，本机发出的流量才会按标记选路
+		{"output", "type route hook output priority mangle; policy accept;"},
+	} {
+		fmt.Fprintf(&b, "\tchain %s {\n\t\t%s\n", chain.name, chain.hook)
+		for _, rule := range rules {
+			fmt.Fprintf(&b, "\t\t%s\n", rule)
+		}
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// nftRules 返回一条引导规则对应的 nftables 规则；按 DSCP 匹配时 IPv4 和 IPv6 各一条
+// 只标记尚未打标记的流量，避免覆盖 WireGuard 等其他程序设置的标记
+func (s *Steerer) nftRules(r steeringRule) []string {
+	var match []string
+	switch {
+	case len(r.ports) == 1:
+		match = append(match, fmt.Sprintf("%s dport %s", r.protocol, nftPort(r.ports[0])))
+	case len(r.ports) > 1:
+		ports := make([]string, len(r.ports))
+		for i, p := range r.ports {
+			ports[i] = nftPort(p)
+		}
+		match = append(match, fmt.Sprintf("%s dport { %s }", r.protocol, strings.Join(ports, ", ")))
+	case r.protocol != "":
+		match = append(match, "meta l4proto "+r.protocol)
+	}
+
+	families := []string{""}
+	if r.dscp != 0 {
+		families = []string{fmt.Sprintf("ip dscp %d", r.dscp)}
+		if s.v6 {
+			families = append(families, fmt.Sprintf("ip6 dscp %d", r.dscp))
+		}
+	}
+
+	rules := make([]string, 0, len(families))
+	for _, family := range families {
+		parts := []string{"meta mark 0"}
+		if family != "" {
+			parts = append(parts, family)
+		}
+		parts = append(parts, match...)
+		parts = append(parts, "meta mark set "+strconv.Itoa(r.mark))
+		rules = append(rules, strings.Join(parts, " "))
+	}
+	return rules
+}
+
+// nftPort 格式化端口或端口范围
+func nftPort(p [2]int) string {
+	if p[0] == p[1] {
+		return strconv.Itoa(p[0])
+	}
+	return fmt.Sprintf("%d-%d", p[0], p[1])
+}
+
+// GenerateIPTablesCommands 生成在 mangle 表中建立 LITE_SDWAN 链并从 PREROUTING、OUTPUT 跳转的命令，v6 时使用 ip6tables
+// 每个端口（范围）一条规则，只标记尚未打标记的流量
+func (s *Steerer) GenerateIPTablesCommands(v6 bool) [][]string {
+	tool := "iptables"
+	if v6 {
+		tool = "ip6tables"
+	}
+	cmds := [][]string{
+		{tool, "-t", "mangle", "-N", iptablesSteeringChain},
+	}
+	for _, r := range s.rules {
+		var dscp []string
+		if r.dscp != 0 {
+			dscp = []string{"-m", "dscp", "--dscp", strconv.Itoa(r.dscp)}
+		}
+		ports := r.ports
+		if len(ports) == 0 {
+			ports = [][2]int{{0, 0}}
+		}
+		for _, p := range ports {
+			args := []string{tool, "-t", "mangle", "-A", iptablesSteeringChain, "-m", "mark", "--mark", "0"}
+			if r.protocol != "" {
+				args = append(args, "-p", r.protocol)
+			}
+			switch {
+			case p[0] == 0:
+			case p[0] == p[1]:
+				args = append(args, "--dport", strconv.Itoa(p[0]))
+			default:
+				args = append(args, "--dport", fmt.Sprintf("%d:%d", p[0], p[1]))
+			}
+			args = append(args, dscp...)
+			cmds = append(cmds, append(args, "-j", "MARK", "--set-mark", strconv.Itoa(r.mark)))
+		}
+	}
+	for _, chain := range []string{"PREROUTING", "OUTPUT"} {
+		cmds = append(cmds, []string{tool, "-t", "mangle", "-I", chain, "-j", iptablesSteeringChain})
+	}
+	return cmds
+}
+
+// GenerateIPTablesCleanupCommands 生成删除跳转并清空、删除 LITE_SDWAN 链的命令
+func (s *Steerer) GenerateIPTablesCleanupCommands(v6 bool) [][]string {
+	tool := "iptables"
+	if v6 {
+		tool = "ip6tables"
+	}
+	return [][]string{
+		{tool, "-t", "mangle", "-D", "PREROUTING", "-j", iptablesSteeringChain},
+		{tool, "-t", "mangle", "-D", "OUTPUT", "-j", iptablesSteeringChain},
+		{tool, "-t", "mangle", "-F", iptablesSteeringChain},
+		{tool, "-t", "mangle", "-X", iptablesSteeringChain},
+	}
+}
+
+// families 返回需要处理的地址族，IPv6 为 true
+func (s *Steerer) families() []bool {
+	if s.v6 {
+		return []bool{false, true}
+	}
+	return []bool{false}
+}
+
+// Install 安装防火墙标记规则和 fwmark ip rule
+// 先删除上次运行遗留的规则和相同的 ip rule，重启不会重复
+func (s *Steerer) Install() error {
+	_ = s.remove(false)
+
+	switch s.backend {
+	case config.SteeringIPTables:
+		for _, v6 := range s.families() {
+			for _, args := range s.GenerateIPTablesCommands(v6) {
+				if err := runCommand(args, ""); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		if err := runCommand([]string{"nft", "-f", "-"}, s.GenerateNftScript()); err != nil {
+			return err
+		}
+	}
+
+	for _, mark := range s.marks() {
+		for _, v6 := range s.families() {
+			args := s.GenerateMarkRuleCommand("add", mark, v6)
+			if err := runCommand(args, ""); err != nil {
+				return err
+			}
+			s.logger.Info("Installed steering rule", logging.F("command", strings.Join(args, " ")))
+		}
+	}
+	s.logger.Info("Traffic steering installed",
+		logging.F("backend", s.backend),
+		logging.F("rules", len(s.rules)),
+	)
+	return nil
+}
+
+// Remove 删除防火墙标记规则和 fwmark ip rule，退出时调用
+func (s *Steerer) Remove() error {
+	return s.remove(true)
+}
+
+// remove 删除所有引导规则，report 为 false 时忽略错误（规则本来就不存在）
+func (s *Steerer) remove(report bool) error {
+	var cmds [][]string
+	for _, mark := range s.marks() {
+		for _, v6 := range s.families() {
+			cmds = append(cmds, s.GenerateMarkRuleCommand("del", mark, v6))
+		}
+	}
+	switch s.backend {
+	case config.SteeringIPTables:
+		for _, v6 := range s.families() {
+			cmds = append(cmds, s.GenerateIPTablesCleanupCommands(v6)...)
+		}
+	default:
+		cmds = append(cmds, []string{"nft", "delete", "table", "inet", nftSteeringTable})
+	}
+
+	var firstErr error
+	for _, args := range cmds {
+		if err := runCommand(args, ""); err != nil && report {
+			s.logger.Warn("Failed to remove steering rule",
+				logging.F("command", strings.Join(args, " ")),
+				logging.F("error", err.Error()),
+			)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// runCommand 执行 nft、iptables、tc 等外部命令，stdin 非空时作为标准输入
+func runCommand(args []string, stdin string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	// #nosec G204 - args are generated internally from validated config
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) //nolint:gosec
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %s, output: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
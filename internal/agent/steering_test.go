@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+)
+
+func newTestSteerer(t *testing.T, backend string) *Steerer {
+	t.Helper()
+	cfg := &config.AgentConfig{
+		Network: config.NetworkConfig{
+			Subnet:      "10.254.0.0/24",
+			Subnet6:     "fd00:254::/64",
+			ClassTables: map[string]int{"realtime": 100, "bulk": 101},
+		},
+		Steering: config.SteeringConfig{
+			Backend:      backend,
+			RulePriority: 900,
+			Rules: []config.SteeringRule{
+				{Class: "realtime", Protocol: "udp", Ports: []string{"5060", "10000-20000"}},
+				{Class: "realtime", DSCP: 46},
+				{Class: "bulk", Protocol: "tcp", Ports: []string{"873"}},
+			},
+		},
+	}
+	s, err := NewSteerer(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewSteerer() error = %v", err)
+	}
+	return s
+}
+
+func TestNewSteererWithoutRules(t *testing.T) {
+	s, err := NewSteerer(&config.AgentConfig{}, nil)
+	if s != nil || err != nil {
+		t.Errorf("NewSteerer() = %v, %v, want nil, nil", s, err)
+	}
+}
+
+func TestGenerateNftScript(t *testing.T) {
+	s := newTestSteerer(t, config.SteeringNftables)
+	script := s.GenerateNftScript()
+
+	for _, line := range []string{
+		"table inet lite_sdwan\ndelete table inet lite_sdwan\ntable inet lite_sdwan {\n",
+		"\t\ttype filter hook prerouting priority mangle; policy accept;\n",
+		"\t\ttype route hook output priority mangle; policy accept;\n",
+		"\t\tmeta mark 0 udp dport { 5060, 10000-20000 } meta mark set 100\n",
+		"\t\tmeta mark 0 ip dscp 46 meta mark set 100\n",
+		"\t\tmeta mark 0 ip6 dscp 46 meta mark set 100\n",
+		"\t\tmeta mark 0 tcp dport 873 meta mark set 101\n",
+	} {
+		if !strings.Contains(script, line) {
+			t.Errorf("nft script missing %q:\n%s", line, script)
+		}
+	}
+	// prerouting 和 output 两条链各有一份规则
+	if n := strings.Count(script, "meta mark set 100"); n != 6 {
+		t.Errorf("realtime rules = %d, want 6:\n%s", n, script)
+	}
+}
+
+func TestGenerateIPTablesCommands(t *testing.T) {
+	s := newTestSteerer(t, config.SteeringIPTables)
+
+	var got []string
+	for _, args := range s.GenerateIPTablesCommands(true) {
+		got = append(got, strings.Join(args, " "))
+	}
+	want := []string{
+		"ip6tables -t mangle -N LITE_SDWAN",
+		"ip6tables -t mangle -A LITE_SDWAN -m mark --mark 0 -p udp --dport 5060 -j MARK --set-mark 100",
+		"ip6tables -t mangle -A LITE_SDWAN -m mark --mark 0 -p udp --dport 10000:20000 -j MARK --set-mark 100",
+		"ip6tables -t mangle -A LITE_SDWAN -m mark --mark 0 -m dscp --dscp 46 -j MARK --set-mark 100",
+		"ip6tables -t mangle -A LITE_SDWAN -m mark --mark 0 -p tcp --dport 873 -j MARK --set-mark 101",
+		"ip6tables -t mangle -I PREROUTING -j LITE_SDWAN",
+		"ip6tables -t mangle -I OUTPUT -j LITE_SDWAN",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("iptables commands:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	cleanup := s.GenerateIPTablesCleanupCommands(false)
+	if got := strings.Join(cleanup[len(cleanup)-1], " "); got != "iptables -t mangle -X LITE_SDWAN" {
+		t.Errorf("last cleanup command = %q", got)
+	}
+}
+
+func TestGenerateMarkRuleCommand(t *testing.T) {
+	s := newTestSteerer(t, config.SteeringNftables)
+	if got := s.marks(); len(got) != 2 || got[0] != 100 || got[1] != 101 {
+		t.Errorf("marks() = %v, want [100 101]", got)
+	}
+	if got := strings.Join(s.GenerateMarkRuleCommand("add", 100, false), " "); got != "ip rule add fwmark 100 lookup 100 priority 900" {
+		t.Errorf("mark rule = %q", got)
+	}
+	if got := strings.Join(s.GenerateMarkRuleCommand("del", 101, true), " "); got != "ip -6 rule del fwmark 101 lookup 101 priority 900" {
+		t.Errorf("mark rule v6 = %q", got)
+	}
+}
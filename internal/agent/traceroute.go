@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// runTraceroute 对 host 执行一次 traceroute，每跳只发一个探测包
+func runTraceroute(host string, maxHops int, timeout time.Duration) ([]models.TracerouteHop, error) {
+	waitSecs := int(timeout.Seconds())
+	if waitSecs < 1 {
+		waitSecs = 1
+	}
+	// 最坏情况下每跳都等满超时
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(maxHops*waitSecs)*time.Second+commandTimeout)
+	defer cancel()
+
+	// #nosec G204 - host comes from the local WireGuard configuration
+	output, err := exec.CommandContext(ctx, "traceroute", "-n", "-q", "1", //nolint:gosec
+		"-w", strconv.Itoa(waitSecs), "-m", strconv.Itoa(maxHops), host).Output()
+	if err != nil {
+		return nil, fmt.Errorf("traceroute to %s failed: %w", host, err)
+	}
+	return parseTraceroute(string(output)), nil
+}
+
+// parseTraceroute 解析 traceroute -n -q 1 的输出，例如：
+//
+//	traceroute to 203.0.113.2 (203.0.113.2), 20 hops max, 60 byte packets
+//	 1  192.168.1.1  0.512 ms
+//	 2  *
+func parseTraceroute(output string) []models.TracerouteHop {
+	var hops []models.TracerouteHop
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		ttl, err := strconv.Atoi(fields[0])
+		if err != nil || ttl <= 0 {
+			continue
+		}
+		hop := models.TracerouteHop{TTL: ttl}
+		if fields[1] != "*" {
+			hop.Address = fields[1]
+			if len(fields) >= 4 && fields[3] == "ms" {
+				if rtt, err := strconv.ParseFloat(fields[2], 64); err == nil {
+					hop.RTTMs = &rtt
+				}
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// tracerouteLoop 定期采集到各对等节点端点的底层路径并上报
+func (a *Agent) tracerouteLoop() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.cfg.Traceroute.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.collectPaths()
+		case <-a.stopCh:
+			return
+		}
+	}
+}
+
+// collectPaths 对每个对等节点的 WireGuard 端点执行 traceroute 并上报 Controller
+func (a *Agent) collectPaths() {
+	dev, err := readWireGuardDevice(a.cfg.Network.WGInterface)
+	if err != nil {
+		a.logger.Warn("Failed to read WireGuard endpoints",
+			logging.F("interface", a.cfg.Network.WGInterface),
+			logging.F("error", err.Error()),
+		)
+		return
+	}
+
+	report := models.PathReport{AgentID: a.cfg.AgentID, TenantID: a.cfg.TenantID}
+	for _, target := range a.prober.Peers() {
+		select {
+		case <-a.stopCh:
+			return
+		default:
+		}
+
+		endpoint, ok := endpointFor(dev.peers, target)
+		if !ok {
+			continue
+		}
+		hops, err := runTraceroute(endpoint, a.cfg.Traceroute.MaxHops, a.cfg.Traceroute.Timeout)
+		if err != nil {
+			a.logger.Warn("Traceroute failed",
+				logging.F("target_ip", target),
+				logging.F("endpoint", endpoint),
+				logging.F("error", err.Error()),
+			)
+			continue
+		}
+		report.Traceroutes = append(report.Traceroutes, models.Traceroute{
+			Target:     target,
+			Endpoint:   endpoint,
+			Hops:       hops,
+			MeasuredAt: time.Now().Unix(),
+		})
+	}
+	if len(report.Traceroutes) == 0 {
+		return
+	}
+
+	if err := a.client.client.ReportPaths(&report); err != nil {
+		a.logger.Warn("Failed to report paths", logging.F("error", err.Error()))
+		return
+	}
+	a.logger.Debug("Paths reported", logging.F("traceroutes", len(report.Traceroutes)))
+}
@@ -0,0 +1,26 @@
+package agent
+
+import (
+	"testing"
+)
+
+func TestParseTraceroute(t *testing.T) {
+	output := `traceroute to 203.0.113.2 (203.0.113.2), 20 hops max, 60 byte packets
+ 1  192.168.1.1  0.512 ms
+ 2  *
+ 3  203.0.113.2  12.250 ms !H
+`
+	hops := parseTraceroute(output)
+	if len(hops) != 3 {
+		t.Fatalf("hops = %+v, want 3", hops)
+	}
+	if hops[0].TTL != 1 || hops[0].Address != "192.168.1.1" || hops[0].RTTMs == nil || *hops[0].RTTMs != 0.512 {
+		t.Errorf("hop 1 = %+v", hops[0])
+	}
+	if hops[1].TTL != 2 || hops[1].Address != "" || hops[1].RTTMs != nil {
+		t.Errorf("hop 2 = %+v, want no reply", hops[1])
+	}
+	if hops[2].Address != "203.0.113.2" || hops[2].RTTMs == nil || *hops[2].RTTMs != 12.25 {
+		t.Errorf("hop 3 = %+v", hops[2])
+	}
+}
@@ -0,0 +1,204 @@
+// Package agent 实现 SD-WAN Agent 功能
+package agent
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+)
+
+// TWAMP-light（RFC 5357 附录 I）非认证模式的测试包格式
+//
+// 发送方：Sequence Number(4) Timestamp(8) Error Estimate(2) Padding
+// 反射方：Sequence Number(4) Timestamp(8) Error Estimate(2) MBZ(2) Receive Timestamp(8)
+//
+//	Sender Sequence Number(4) Sender Timestamp(8) Sender Error Estimate(2) MBZ(2) Sender TTL(1) Padding
+const (
+	twampSenderHeaderLen    = 14
+	twampReflectorHeaderLen = 41
+	// twampErrorEstimate S=1（时钟已同步）、Scale=0、Multiplier=1，与常见实现的默认值一致
+	twampErrorEstimate uint16 = 0x8001
+)
+
+// ntpEpochOffset NTP 纪元（1900 年）与 Unix 纪元之间的秒数
+const ntpEpochOffset = 2208988800
+
+// toNTP 将时间转换为 64 位 NTP 时间戳：高 32 位为秒，低 32 位为秒的小数部分
+func toNTP(t time.Time) uint64 {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return secs<<32 | frac
+}
+
+// fromNTP 将 64 位 NTP 时间戳转换为时间
+func fromNTP(ts uint64) time.Time {
+	secs := int64(ts>>32) - ntpEpochOffset
+	nanos := (ts & 0xffffffff) * uint64(time.Second) >> 32
+	return time.Unix(secs, int64(nanos))
+}
+
+// buildTWAMPReflection 根据发送方的测试包构造反射包，长度与请求相同（至少为反射包头长度）
+// 不读取 IP 头，Sender TTL 固定填 255
+func buildTWAMPReflection(req []byte, seq uint32, received, sent time.Time) ([]byte, error) {
+	if len(req) < twampSenderHeaderLen {
+		return nil, fmt.Errorf("twamp test packet too short: %d bytes", len(req))
+	}
+	size := len(req)
+	if size < twampReflectorHeaderLen {
+		size = twampReflectorHeaderLen
+	}
+	resp := make([]byte, size)
+	binary.BigEndian.PutUint32(resp[0:4], seq)
+	binary.BigEndian.PutUint64(resp[4:12], toNTP(sent))
+	binary.BigEndian.PutUint16(resp[12:14], twampErrorEstimate)
+	binary.BigEndian.PutUint64(resp[16:24], toNTP(received))
+	copy(resp[24:38], req[:twampSenderHeaderLen])
+	resp[40] = 255
+	return resp, nil
+}
+
+// TWAMPReflector TWAMP-light 反射方，把收到的测试包连同收发时间戳送回发送方
+// 对端或第三方路由器以 twamp 方式探测本机时需要启动
+type TWAMPReflector struct {
+	addr   string
+	logger logging.Logger
+	conn   *net.UDPConn
+	seq    uint32
+	wg     sync.WaitGroup
+}
+
+// NewTWAMPReflector 创建反射方，port 为 0 时由系统分配端口（见 Addr）
+func NewTWAMPReflector(port int, logger logging.Logger) *TWAMPReflector {
+	if logger == nil {
+		logger = logging.NewNopLogger()
+	}
+	return &TWAMPReflector{addr: ":" + strconv.Itoa(port), logger: logger}
+}
+
+// Start 监听 UDP 端口并开始反射
+func (r *TWAMPReflector) Start() error {
+	udpAddr, err := net.ResolveUDPAddr("udp", r.addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for twamp: %w", err)
+	}
+	r.conn = conn
+
+	r.wg.Add(1)
+	go r.run()
+	return nil
+}
+
+// Addr 返回实际监听的地址，Start 之后有效
+func (r *TWAMPReflector) Addr() net.Addr {
+	return r.conn.LocalAddr()
+}
+
+// Stop 关闭监听端口并等待反射协程退出
+func (r *TWAMPReflector) Stop() {
+	if r.conn == nil {
+		return
+	}
+	_ = r.conn.Close()
+	r.wg.Wait()
+}
+
+// run 反射循环，连接关闭后退出
+func (r *TWAMPReflector) run() {
+	defer r.wg.Done()
+
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := r.conn.ReadFromUDP(buf)
+		received := time.Now()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			r.logger.Warn("TWAMP reflector read failed", logging.F("error", err.Error()))
+			continue
+		}
+
+		seq := atomic.AddUint32(&r.seq, 1) - 1
+		resp, err := buildTWAMPReflection(buf[:n], seq, received, time.Now())
+		if err != nil {
+			r.logger.Debug("Dropping invalid TWAMP packet",
+				logging.F("from", from.String()),
+				logging.F("error", err.Error()),
+			)
+			continue
+		}
+		if _, err := r.conn.WriteToUDP(resp, from); err != nil {
+			r.logger.Debug("TWAMP reflector write failed",
+				logging.F("to", from.String()),
+				logging.F("error", err.Error()),
+			)
+		}
+	}
+}
+
+// probeTWAMP 向对端的 TWAMP-light 反射方发送一个测试包
+// RTT 扣除反射方的处理时间：(T4 - T1) - (T3 - T2)，两端时钟不需要同步
+func (p *ActiveProber) probeTWAMP(targetIP string, timeout time.Duration) Measurement {
+	fail := func(err error) Measurement {
+		p.logger.Debug("TWAMP probe failed",
+			logging.F("target_ip", targetIP),
+			logging.F("port", p.twampPort),
+			logging.F("error", err.Error()),
+		)
+		return Measurement{RTTMs: nil, LossRate: 1.0, Time: time.Now()}
+	}
+
+	d, err := p.dialer("udp", targetIP, timeout)
+	if err != nil {
+		return fail(err)
+	}
+	conn, err := d.Dial("udp", net.JoinHostPort(targetIP, strconv.Itoa(p.twampPort)))
+	if err != nil {
+		return fail(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	// 发送包填充到反射包头的长度，使两个方向的包大小相同
+	seq := atomic.AddUint32(&p.twampSeq, 1)
+	req := make([]byte, twampReflectorHeaderLen)
+	binary.BigEndian.PutUint32(req[0:4], seq)
+	binary.BigEndian.PutUint16(req[12:14], twampErrorEstimate)
+	t1 := time.Now()
+	binary.BigEndian.PutUint64(req[4:12], toNTP(t1))
+	if _, err := conn.Write(req); err != nil {
+		return fail(err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		t4 := time.Now()
+		if err != nil {
+			return fail(err)
+		}
+		// 忽略超时后迟到的旧回复
+		if n < twampReflectorHeaderLen || binary.BigEndian.Uint32(buf[24:28]) != seq {
+			continue
+		}
+		t2 := fromNTP(binary.BigEndian.Uint64(buf[16:24]))
+		t3 := fromNTP(binary.BigEndian.Uint64(buf[4:12]))
+		rtt := t4.Sub(t1) - t3.Sub(t2)
+		if rtt < 0 {
+			rtt = 0
+		}
+		rttMs := float64(rtt.Microseconds()) / 1000.0
+		return Measurement{RTTMs: &rttMs, LossRate: 0, Time: time.Now()}
+	}
+}
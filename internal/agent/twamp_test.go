@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNTPTimestamp(t *testing.T) {
+	now := time.Unix(1703830000, 123456789)
+	got := fromNTP(toNTP(now))
+	// 小数部分 32 位，精度约 0.23ns
+	if d := got.Sub(now); d < -time.Nanosecond || d > time.Nanosecond {
+		t.Errorf("fromNTP(toNTP(%v)) = %v", now, got)
+	}
+}
+
+func TestBuildTWAMPReflection(t *testing.T) {
+	req := make([]byte, twampSenderHeaderLen)
+	binary.BigEndian.PutUint32(req[0:4], 7)
+	binary.BigEndian.PutUint64(req[4:12], 0x1122334455667788)
+
+	received := time.Unix(1703830000, 0)
+	sent := received.Add(time.Millisecond)
+	resp, err := buildTWAMPReflection(req, 3, received, sent)
+	if err != nil {
+		t.Fatalf("buildTWAMPReflection() error = %v", err)
+	}
+	if len(resp) != twampReflectorHeaderLen {
+		t.Fatalf("len = %d, want %d", len(resp), twampReflectorHeaderLen)
+	}
+	if binary.BigEndian.Uint32(resp[0:4]) != 3 || binary.BigEndian.Uint32(resp[24:28]) != 7 {
+		t.Errorf("sequence numbers = %d/%d, want 3/7", binary.BigEndian.Uint32(resp[0:4]), binary.BigEndian.Uint32(resp[24:28]))
+	}
+	if binary.BigEndian.Uint64(resp[28:36]) != 0x1122334455667788 {
+		t.Error("sender timestamp not echoed")
+	}
+	if !fromNTP(binary.BigEndian.Uint64(resp[16:24])).Equal(received) {
+		t.Error("receive timestamp mismatch")
+	}
+
+	if _, err := buildTWAMPReflection(req[:10], 0, received, sent); err == nil {
+		t.Error("short packet should be rejected")
+	}
+}
+
+func TestProbeTWAMP(t *testing.T) {
+	reflector := NewTWAMPReflector(0, nil)
+	if err := reflector.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer reflector.Stop()
+
+	p := NewActiveProber([]string{"127.0.0.1"}, time.Second, time.Second, 3)
+	p.SetProbeType("twamp", 0)
+	p.SetTWAMPPort(reflector.Addr().(*net.UDPAddr).Port)
+
+	m := p.ProbeOnce("127.0.0.1")
+	if m.RTTMs == nil || m.LossRate != 0 {
+		t.Fatalf("ProbeOnce() = %+v, want reachable", m)
+	}
+
+	// 反射方停止后超时
+	reflector.Stop()
+	p.timeout = 100 * time.Millisecond
+	if m := p.ProbeOnce("127.0.0.1"); m.RTTMs != nil || m.LossRate != 1.0 {
+		t.Errorf("ProbeOnce() after stop = %+v, want loss", m)
+	}
+}
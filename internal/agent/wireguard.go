@@ -0,0 +1,199 @@
+package agent
+
+import (
+	"bufio"
+	"crypto/ecdh"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// wgDevice WireGuard 接口的公钥及对等节点
+type wgDevice struct {
+	publicKey string // base64 编码，与 wg 命令的输出格式相同；接口未设置私钥时为空
+	peers     []wgPeerEndpoint
+}
+
+// wgPeerEndpoint WireGuard 对等节点的 allowed-ips、底层端点及最近一次握手时间
+type wgPeerEndpoint struct {
+	publicKey string // base64 编码
+	allowed   []*net.IPNet
+	endpoint  string    // 端点主机地址，不含端口；从未握手的对等节点没有端点，为空
+	handshake time.Time // 零值表示从未握手
+}
+
+// neverHandshakeAge 从未握手的隧道的握手间隔，按无限长处理
+// 只在 Agent 内部用于超时判断，上报时改为 handshake_never
+const neverHandshakeAge int64 = math.MaxInt64
+
+// wireGuardSocketDir 用户态 WireGuard 实现（wireguard-go、boringtun）创建 UAPI 套接字的目录
+var wireGuardSocketDir = "/var/run/wireguard"
+
+// readWireGuardDevice 读取接口的公钥和对等节点，不依赖 wireguard-tools
+// 先通过内核接口读取（Linux 上为 generic netlink），失败时改用用户态实现的 UAPI 套接字
+func readWireGuardDevice(iface string) (*wgDevice, error) {
+	dev, kernelErr := kernelWireGuardDevice(iface)
+	if kernelErr == nil {
+		return dev, nil
+	}
+	dev, uapiErr := uapiWireGuardDevice(iface)
+	if uapiErr != nil {
+		return nil, fmt.Errorf("failed to read WireGuard device %s: %w", iface, errors.Join(kernelErr, uapiErr))
+	}
+	return dev, nil
+}
+
+// uapiWireGuardDevice 通过 UAPI 套接字读取用户态 WireGuard 接口
+func uapiWireGuardDevice(iface string) (*wgDevice, error) {
+	conn, err := net.DialTimeout("unix", filepath.Join(wireGuardSocketDir, iface+".sock"), commandTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	if err := conn.SetDeadline(time.Now().Add(commandTimeout)); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(conn, "get=1\n\n"); err != nil {
+		return nil, err
+	}
+	return parseUAPI(conn)
+}
+
+// parseUAPI 解析 UAPI get 操作的响应：每行一个 key=value，public_key 开始一个新的对等节点，空行结束
+// 密钥为十六进制，转换为 base64；接口公钥由私钥推导
+func parseUAPI(r io.Reader) (*wgDevice, error) {
+	dev := &wgDevice{}
+	var peer *wgPeerEndpoint
+	var handshakeSec, handshakeNsec int64
+	flush := func() {
+		if peer == nil {
+			return
+		}
+		if handshakeSec != 0 || handshakeNsec != 0 {
+			peer.handshake = time.Unix(handshakeSec, handshakeNsec)
+		}
+		dev.peers = append(dev.peers, *peer)
+		peer, handshakeSec, handshakeNsec = nil, 0, 0
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid UAPI line %q", line)
+		}
+		switch key {
+		case "errno":
+			if value != "0" {
+				return nil, fmt.Errorf("UAPI get failed: errno=%s", value)
+			}
+		case "private_key":
+			pub, err := publicKeyFromPrivate(value)
+			if err != nil {
+				return nil, err
+			}
+			dev.publicKey = pub
+		case "public_key":
+			flush()
+			raw, err := hex.DecodeString(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid peer public key: %w", err)
+			}
+			peer = &wgPeerEndpoint{publicKey: base64.StdEncoding.EncodeToString(raw)}
+		}
+		if peer == nil {
+			continue
+		}
+		switch key {
+		case "endpoint":
+			if host, _, err := net.SplitHostPort(value); err == nil {
+				peer.endpoint = host
+			}
+		case "allowed_ip":
+			if _, ipNet, err := net.ParseCIDR(value); err == nil {
+				peer.allowed = append(peer.allowed, ipNet)
+			}
+		case "last_handshake_time_sec":
+			handshakeSec, _ = strconv.ParseInt(value, 10, 64)
+		case "last_handshake_time_nsec":
+			handshakeNsec, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return dev, nil
+}
+
+// publicKeyFromPrivate 由十六进制的 Curve25519 私钥推导 base64 编码的公钥，全零私钥表示未设置，返回空
+func publicKeyFromPrivate(hexKey string) (string, error) {
+	raw, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid private key: %w", err)
+	}
+	if strings.Trim(hexKey, "0") == "" {
+		return "", nil
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid private key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(priv.PublicKey().Bytes()), nil
+}
+
+// peerFor 返回 allowed-ips 中最长前缀匹配 tunnelIP 的对等节点
+func peerFor(peers []wgPeerEndpoint, tunnelIP string) (wgPeerEndpoint, bool) {
+	ip := net.ParseIP(tunnelIP)
+	if ip == nil {
+		return wgPeerEndpoint{}, false
+	}
+	best, bestLen := wgPeerEndpoint{}, -1
+	for _, peer := range peers {
+		for _, ipNet := range peer.allowed {
+			if ones, _ := ipNet.Mask.Size(); ipNet.Contains(ip) && ones > bestLen {
+				best, bestLen = peer, ones
+			}
+		}
+	}
+	return best, bestLen >= 0
+}
+
+// endpointFor 返回 allowed-ips 中最长前缀匹配 tunnelIP 的对等节点端点，对等节点没有端点时返回 false
+func endpointFor(peers []wgPeerEndpoint, tunnelIP string) (string, bool) {
+	peer, ok := peerFor(peers, tunnelIP)
+	return peer.endpoint, ok && peer.endpoint != ""
+}
+
+// handshakeAges 返回每个对端隧道距最近一次握手的秒数，从未握手时为 neverHandshakeAge；没有匹配的 WireGuard 对等节点时不包含该对端
+func handshakeAges(peers []wgPeerEndpoint, targets []string, now time.Time) map[string]int64 {
+	ages := make(map[string]int64, len(targets))
+	for _, target := range targets {
+		peer, ok := peerFor(peers, target)
+		if !ok {
+			continue
+		}
+		if peer.handshake.IsZero() {
+			ages[target] = neverHandshakeAge
+			continue
+		}
+		age := int64(now.Sub(peer.handshake).Seconds())
+		if age < 0 {
+			age = 0
+		}
+		ages[target] = age
+	}
+	return ages
+}
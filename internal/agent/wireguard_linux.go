@@ -0,0 +1,222 @@
+//go:build linux
+
+package agent
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// generic netlink 控制器及 WireGuard 的命令和属性（linux/genetlink.h、linux/wireguard.h），syscall 包中没有定义
+const (
+	genlIDCtrl            = 0x10 // GENL_ID_CTRL
+	genlHeaderLen         = 4    // struct genlmsghdr
+	ctrlCmdGetFamily      = 3    // CTRL_CMD_GETFAMILY
+	ctrlAttrFamilyID      = 1    // CTRL_ATTR_FAMILY_ID
+	ctrlAttrFamilyName    = 2    // CTRL_ATTR_FAMILY_NAME
+	nlaTypeMask           = 0x3fff
+	wgGenlName            = "wireguard"
+	wgGenlVersion         = 1
+	wgCmdGetDevice        = 0 // WG_CMD_GET_DEVICE
+	wgDeviceAIfname       = 2 // WGDEVICE_A_IFNAME
+	wgDeviceAPublicKey    = 4 // WGDEVICE_A_PUBLIC_KEY
+	wgDeviceAPeers        = 8 // WGDEVICE_A_PEERS
+	wgPeerAPublicKey      = 1 // WGPEER_A_PUBLIC_KEY
+	wgPeerAEndpoint       = 4 // WGPEER_A_ENDPOINT
+	wgPeerALastHandshake  = 6 // WGPEER_A_LAST_HANDSHAKE_TIME
+	wgPeerAAllowedIPs     = 9 // WGPEER_A_ALLOWEDIPS
+	wgAllowedIPAFamily    = 1 // WGALLOWEDIP_A_FAMILY
+	wgAllowedIPAIPAddr    = 2 // WGALLOWEDIP_A_IPADDR
+	wgAllowedIPACidrMask  = 3 // WGALLOWEDIP_A_CIDR_MASK
+	kernelTimespecLen     = 16
+	sockaddrInLen         = 8  // 只需要 family、port、addr
+	sockaddrIn6AddrOffset = 8  // family、port、flowinfo 之后
+	sockaddrIn6Len        = 24 // 只需要到 addr 为止
+)
+
+// kernelWireGuardDevice 通过 generic netlink 读取内核 WireGuard 接口
+// 未加载 wireguard 模块、接口不存在或不是内核实现（如 wireguard-go）时返回错误
+func kernelWireGuardDevice(iface string) (*wgDevice, error) {
+	nl, err := openNetlink(syscall.NETLINK_GENERIC)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = nl.close() }()
+
+	family, err := genlFamilyID(nl, wgGenlName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve generic netlink family %s: %w", wgGenlName, err)
+	}
+
+	// WG_CMD_GET_DEVICE 只支持转储，对等节点较多时内核分多条消息返回
+	b := newNetlinkMessage(family, syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP)
+	b.genlMsg(wgCmdGetDevice, wgGenlVersion)
+	b.attr(wgDeviceAIfname, append([]byte(iface), 0))
+	msgs, err := nl.request(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get WireGuard device %s: %w", iface, err)
+	}
+	return parseWGDeviceMessages(msgs), nil
+}
+
+// genlFamilyID 查询 generic netlink 协议族的编号
+func genlFamilyID(nl *netlinkRouter, name string) (uint16, error) {
+	b := newNetlinkMessage(genlIDCtrl, syscall.NLM_F_REQUEST|syscall.NLM_F_ACK)
+	b.genlMsg(ctrlCmdGetFamily, 1)
+	b.attr(ctrlAttrFamilyName, append([]byte(name), 0))
+	msgs, err := nl.request(b)
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range msgs {
+		if len(m.Data) < genlHeaderLen {
+			continue
+		}
+		for _, a := range netlinkAttrs(m.Data[genlHeaderLen:]) {
+			if a.typ == ctrlAttrFamilyID && len(a.value) >= 2 {
+				return binary.NativeEndian.Uint16(a.value), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no family id in response")
+}
+
+// genlMsg 追加 generic netlink 消息头
+func (b *netlinkMessage) genlMsg(cmd, version uint8) {
+	b.data = append(b.data, cmd, version, 0, 0)
+}
+
+// netlinkAttr 解析出的 netlink 属性，类型已去掉 NLA_F_NESTED 等标志位
+type netlinkAttr struct {
+	typ   uint16
+	value []byte
+}
+
+// netlinkAttrs 解析连续排列的 netlink 属性，遇到截断的属性时停止
+func netlinkAttrs(data []byte) []netlinkAttr {
+	var attrs []netlinkAttr
+	for len(data) >= syscall.SizeofRtAttr {
+		length := int(binary.NativeEndian.Uint16(data[0:2]))
+		if length < syscall.SizeofRtAttr || length > len(data) {
+			break
+		}
+		attrs = append(attrs, netlinkAttr{
+			typ:   binary.NativeEndian.Uint16(data[2:4]) & nlaTypeMask,
+			value: data[syscall.SizeofRtAttr:length],
+		})
+		next := (length + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+		if next > len(data) {
+			break
+		}
+		data = data[next:]
+	}
+	return attrs
+}
+
+// parseWGDeviceMessages 解析 WG_CMD_GET_DEVICE 的转储结果
+// 单个对等节点的 allowed-ips 放不下时内核在下一条消息中以相同公钥继续，合并到同一个对等节点
+func parseWGDeviceMessages(msgs []syscall.NetlinkMessage) *wgDevice {
+	dev := &wgDevice{}
+	for _, m := range msgs {
+		if len(m.Data) < genlHeaderLen {
+			continue
+		}
+		for _, a := range netlinkAttrs(m.Data[genlHeaderLen:]) {
+			switch a.typ {
+			case wgDeviceAPublicKey:
+				dev.publicKey = base64.StdEncoding.EncodeToString(a.value)
+			case wgDeviceAPeers:
+				for _, p := range netlinkAttrs(a.value) {
+					peer := parseWGPeer(p.value)
+					if n := len(dev.peers); n > 0 && peer.publicKey != "" && dev.peers[n-1].publicKey == peer.publicKey {
+						dev.peers[n-1].allowed = append(dev.peers[n-1].allowed, peer.allowed...)
+						continue
+					}
+					dev.peers = append(dev.peers, peer)
+				}
+			}
+		}
+	}
+	return dev
+}
+
+// parseWGPeer 解析一个对等节点的嵌套属性
+func parseWGPeer(data []byte) wgPeerEndpoint {
+	var peer wgPeerEndpoint
+	for _, a := range netlinkAttrs(data) {
+		switch a.typ {
+		case wgPeerAPublicKey:
+			peer.publicKey = base64.StdEncoding.EncodeToString(a.value)
+		case wgPeerAEndpoint:
+			if ip := sockaddrIP(a.value); ip != nil {
+				peer.endpoint = ip.String()
+			}
+		case wgPeerALastHandshake:
+			if len(a.value) >= kernelTimespecLen {
+				sec := int64(binary.NativeEndian.Uint64(a.value[0:8]))
+				nsec := int64(binary.NativeEndian.Uint64(a.value[8:16]))
+				if sec != 0 || nsec != 0 {
+					peer.handshake = time.Unix(sec, nsec)
+				}
+			}
+		case wgPeerAAllowedIPs:
+			for _, ipAttr := range netlinkAttrs(a.value) {
+				if ipNet := parseAllowedIP(ipAttr.value); ipNet != nil {
+					peer.allowed = append(peer.allowed, ipNet)
+				}
+			}
+		}
+	}
+	return peer
+}
+
+// parseAllowedIP 解析一个 allowed-ip 的嵌套属性，地址族与地址长度不符时返回 nil
+func parseAllowedIP(data []byte) *net.IPNet {
+	var family uint16
+	var ip net.IP
+	cidr := -1
+	for _, a := range netlinkAttrs(data) {
+		switch a.typ {
+		case wgAllowedIPAFamily:
+			if len(a.value) >= 2 {
+				family = binary.NativeEndian.Uint16(a.value)
+			}
+		case wgAllowedIPAIPAddr:
+			ip = net.IP(append([]byte(nil), a.value...))
+		case wgAllowedIPACidrMask:
+			if len(a.value) >= 1 {
+				cidr = int(a.value[0])
+			}
+		}
+	}
+	bits := net.IPv4len * 8
+	if family == syscall.AF_INET6 {
+		bits = net.IPv6len * 8
+	}
+	if (family != syscall.AF_INET && family != syscall.AF_INET6) || len(ip)*8 != bits || cidr < 0 || cidr > bits {
+		return nil
+	}
+	return &net.IPNet{IP: ip.Mask(net.CIDRMask(cidr, bits)), Mask: net.CIDRMask(cidr, bits)}
+}
+
+// sockaddrIP 返回 struct sockaddr_in 或 sockaddr_in6 中的地址，其他地址族返回 nil
+func sockaddrIP(data []byte) net.IP {
+	if len(data) < 2 {
+		return nil
+	}
+	switch binary.NativeEndian.Uint16(data[0:2]) {
+	case syscall.AF_INET:
+		if len(data) >= sockaddrInLen {
+			return net.IP(append([]byte(nil), data[4:8]...))
+		}
+	case syscall.AF_INET6:
+		if len(data) >= sockaddrIn6Len {
+			return net.IP(append([]byte(nil), data[sockaddrIn6AddrOffset:sockaddrIn6Len]...))
+		}
+	}
+	return nil
+}
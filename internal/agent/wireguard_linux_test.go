@@ -0,0 +1,133 @@
+//go:build linux
+
+package agent
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// wgTestPeer 编码一个对等节点的嵌套属性
+func wgTestPeer(key byte, endpoint []byte, handshake time.Time, cidrs ...string) []byte {
+	peer := &netlinkMessage{}
+	peer.attr(wgPeerAPublicKey, bytes.Repeat([]byte{key}, 32))
+	if endpoint != nil {
+		peer.attr(wgPeerAEndpoint, endpoint)
+	}
+	ts := make([]byte, kernelTimespecLen)
+	if !handshake.IsZero() {
+		binary.NativeEndian.PutUint64(ts[0:8], uint64(handshake.Unix()))
+		binary.NativeEndian.PutUint64(ts[8:16], uint64(handshake.Nanosecond()))
+	}
+	peer.attr(wgPeerALastHandshake, ts)
+
+	allowed := &netlinkMessage{}
+	for i, cidr := range cidrs {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		family, addr := routeFamily(ipNet.IP)
+		ones, _ := ipNet.Mask.Size()
+		ip := &netlinkMessage{}
+		ip.attr(wgAllowedIPAFamily, binary.NativeEndian.AppendUint16(nil, uint16(family)))
+		ip.attr(wgAllowedIPAIPAddr, addr)
+		ip.attr(wgAllowedIPACidrMask, []byte{uint8(ones)})
+		allowed.attr(uint16(i)|syscall.NLA_F_NESTED, ip.data)
+	}
+	peer.attr(wgPeerAAllowedIPs|syscall.NLA_F_NESTED, allowed.data)
+	return peer.data
+}
+
+// wgTestDeviceMessage 编码一条 WG_CMD_GET_DEVICE 响应
+func wgTestDeviceMessage(t *testing.T, peers ...[]byte) syscall.NetlinkMessage {
+	t.Helper()
+	b := newNetlinkMessage(0x20, syscall.NLM_F_MULTI)
+	b.genlMsg(wgCmdGetDevice, wgGenlVersion)
+	b.attr(wgDeviceAIfname, append([]byte("wg0"), 0))
+	b.attr(wgDeviceAPublicKey, bytes.Repeat([]byte{0x01}, 32))
+	list := &netlinkMessage{}
+	for i, p := range peers {
+		list.attr(uint16(i)|syscall.NLA_F_NESTED, p)
+	}
+	b.attr(wgDeviceAPeers|syscall.NLA_F_NESTED, list.data)
+	msgs, err := syscall.ParseNetlinkMessage(b.finish(1))
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("ParseNetlinkMessage() = %v, %v", msgs, err)
+	}
+	return msgs[0]
+}
+
+func TestParseWGDeviceMessages(t *testing.T) {
+	sin := make([]byte, 16)
+	binary.NativeEndian.PutUint16(sin[0:2], syscall.AF_INET)
+	binary.BigEndian.PutUint16(sin[2:4], 51820)
+	copy(sin[4:8], net.ParseIP("203.0.113.2").To4())
+	sin6 := make([]byte, 28)
+	binary.NativeEndian.PutUint16(sin6[0:2], syscall.AF_INET6)
+	copy(sin6[8:24], net.ParseIP("2001:db8::3"))
+	handshake := time.Unix(1703829940, 0)
+
+	// 第二个对等节点的 allowed-ips 分到下一条消息中，以相同公钥继续
+	dev := parseWGDeviceMessages([]syscall.NetlinkMessage{
+		wgTestDeviceMessage(t,
+			wgTestPeer(0xaa, sin, handshake, "10.254.0.2/32"),
+			wgTestPeer(0xbb, sin6, time.Time{}, "10.254.0.3/32"),
+		),
+		wgTestDeviceMessage(t, wgTestPeer(0xbb, nil, time.Time{}, "10.254.0.0/24", "fd00:254::/64")),
+	})
+
+	if want := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0x01}, 32)); dev.publicKey != want {
+		t.Errorf("publicKey = %q, want %q", dev.publicKey, want)
+	}
+	if len(dev.peers) != 2 {
+		t.Fatalf("peers = %+v, want 2", dev.peers)
+	}
+	if p := dev.peers[0]; p.endpoint != "203.0.113.2" || !p.handshake.Equal(handshake) || len(p.allowed) != 1 {
+		t.Errorf("peer A = %+v", p)
+	}
+	if p := dev.peers[1]; p.endpoint != "2001:db8::3" || !p.handshake.IsZero() || len(p.allowed) != 3 {
+		t.Errorf("peer B = %+v", p)
+	}
+	if endpoint, ok := endpointFor(dev.peers, "10.254.0.9"); !ok || endpoint != "2001:db8::3" {
+		t.Errorf("endpointFor(10.254.0.9) = %q, %v", endpoint, ok)
+	}
+	if _, ok := peerFor(dev.peers, "fd00:254::5"); !ok {
+		t.Error("peerFor(fd00:254::5) found no peer")
+	}
+}
+
+func TestParseAllowedIPRejectsMismatch(t *testing.T) {
+	ip := &netlinkMessage{}
+	ip.attr(wgAllowedIPAFamily, binary.NativeEndian.AppendUint16(nil, syscall.AF_INET6))
+	ip.attr(wgAllowedIPAIPAddr, net.ParseIP("10.254.0.2").To4())
+	ip.attr(wgAllowedIPACidrMask, []byte{32})
+	if ipNet := parseAllowedIP(ip.data); ipNet != nil {
+		t.Errorf("parseAllowedIP(v6 family, v4 address) = %v, want nil", ipNet)
+	}
+}
+
+func TestKernelWireGuardDeviceMissing(t *testing.T) {
+	// 不存在的接口返回错误（未加载 wireguard 模块或没有权限时同样返回错误）
+	if _, err := kernelWireGuardDevice("sdwan-missing0"); err == nil {
+		t.Error("kernelWireGuardDevice(sdwan-missing0) returned no error")
+	}
+}
+
+func TestGenlFamilyID(t *testing.T) {
+	nl, err := openNetlink(syscall.NETLINK_GENERIC)
+	if err != nil {
+		t.Skipf("generic netlink unavailable: %v", err)
+	}
+	defer func() { _ = nl.close() }()
+
+	// 控制器自身的协议族 nlctrl 总是存在，编号固定为 GENL_ID_CTRL
+	if id, err := genlFamilyID(nl, "nlctrl"); err != nil || id != genlIDCtrl {
+		t.Errorf("genlFamilyID(nlctrl) = %d, %v; want %d", id, err, genlIDCtrl)
+	}
+	if _, err := genlFamilyID(nl, "sdwan-missing"); err == nil {
+		t.Error("genlFamilyID(sdwan-missing) returned no error")
+	}
+}
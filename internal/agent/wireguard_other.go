@@ -0,0 +1,12 @@
+//go:build !linux
+
+package agent
+
+import "errors"
+
+// errKernelWireGuardUnsupported 非 Linux 平台只通过 UAPI 套接字读取 WireGuard 接口
+var errKernelWireGuardUnsupported = errors.New("kernel WireGuard interface is only supported on linux")
+
+func kernelWireGuardDevice(string) (*wgDevice, error) {
+	return nil, errKernelWireGuardUnsupported
+}
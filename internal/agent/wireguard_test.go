@@ -0,0 +1,192 @@
+package agent
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// uapiKey 返回以 b 填充的十六进制 32 字节密钥
+func uapiKey(b string) string { return strings.Repeat(b, 64) }
+
+func TestParseUAPI(t *testing.T) {
+	// RFC 7748 6.1 中 Alice 的密钥对
+	uapi := "private_key=77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a\n" +
+		"listen_port=51820\n" +
+		"public_key=" + uapiKey("a") + "\n" +
+		"endpoint=203.0.113.2:51820\n" +
+		"last_handshake_time_sec=1703829940\n" +
+		"last_handshake_time_nsec=500\n" +
+		"allowed_ip=10.254.0.2/32\n" +
+		"public_key=" + uapiKey("b") + "\n" +
+		"endpoint=[2001:db8::3]:51820\n" +
+		"last_handshake_time_sec=0\n" +
+		"last_handshake_time_nsec=0\n" +
+		"allowed_ip=10.254.0.3/32\n" +
+		"allowed_ip=10.254.0.0/24\n" +
+		"errno=0\n\n"
+	dev, err := parseUAPI(strings.NewReader(uapi))
+	if err != nil {
+		t.Fatalf("parseUAPI() error = %v", err)
+	}
+	if dev.publicKey != "hSDwCYkwp1R0i33ctD73Wg2/Og0mOBr066SpjqqbTmo=" {
+		t.Errorf("publicKey = %q", dev.publicKey)
+	}
+	if len(dev.peers) != 2 {
+		t.Fatalf("peers = %+v, want 2", dev.peers)
+	}
+	if p := dev.peers[0]; p.endpoint != "203.0.113.2" || !p.handshake.Equal(time.Unix(1703829940, 500)) || len(p.allowed) != 1 {
+		t.Errorf("peer A = %+v", p)
+	}
+	if p := dev.peers[1]; p.endpoint != "2001:db8::3" || !p.handshake.IsZero() || len(p.allowed) != 2 {
+		t.Errorf("peer B = %+v", p)
+	}
+
+	if _, err := parseUAPI(strings.NewReader("errno=19\n\n")); err == nil {
+		t.Error("parseUAPI(errno=19) returned no error")
+	}
+	// 未设置私钥的接口没有公钥
+	if dev, err := parseUAPI(strings.NewReader("private_key=" + uapiKey("0") + "\nerrno=0\n\n")); err != nil || dev.publicKey != "" {
+		t.Errorf("parseUAPI(zero key) = %+v, %v", dev, err)
+	}
+}
+
+func TestUAPIWireGuardDevice(t *testing.T) {
+	dir, err := os.MkdirTemp("", "wg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	old := wireGuardSocketDir
+	wireGuardSocketDir = dir
+	defer func() { wireGuardSocketDir = old }()
+
+	ln, err := net.Listen("unix", filepath.Join(dir, "wg0.sock"))
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if line, _ := bufio.NewReader(conn).ReadString('\n'); line != "get=1\n" {
+			return
+		}
+		_, _ = conn.Write([]byte("public_key=" + uapiKey("a") + "\nendpoint=203.0.113.2:51820\nallowed_ip=10.254.0.2/32\nerrno=0\n\n"))
+	}()
+
+	dev, err := uapiWireGuardDevice("wg0")
+	if err != nil {
+		t.Fatalf("uapiWireGuardDevice() error = %v", err)
+	}
+	if endpoint, ok := endpointFor(dev.peers, "10.254.0.2"); !ok || endpoint != "203.0.113.2" {
+		t.Errorf("endpointFor() = %q, %v", endpoint, ok)
+	}
+	if _, err := uapiWireGuardDevice("wg1"); err == nil {
+		t.Error("uapiWireGuardDevice(wg1) returned no error for a missing socket")
+	}
+}
+
+func TestEndpointFor(t *testing.T) {
+	peers := []wgPeerEndpoint{
+		{allowed: mustCIDRs(t, "10.254.0.2/32"), endpoint: "203.0.113.2"},
+		{allowed: mustCIDRs(t, "10.254.0.3/32", "10.254.0.0/24"), endpoint: "2001:db8::3"},
+		{allowed: mustCIDRs(t, "10.254.1.4/32")},
+	}
+
+	tests := []struct {
+		tunnelIP string
+		want     string
+		ok       bool
+	}{
+		{"10.254.0.2", "203.0.113.2", true},
+		{"10.254.0.3", "2001:db8::3", true},
+		{"10.254.0.9", "2001:db8::3", true}, // 只匹配第二个对等节点的 /24
+		{"10.254.1.4", "", false},           // 没有端点
+	}
+	for _, tt := range tests {
+		got, ok := endpointFor(peers, tt.tunnelIP)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("endpointFor(%s) = %q, %v; want %q, %v", tt.tunnelIP, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestHandshakeAges(t *testing.T) {
+	now := time.Unix(1703830000, 0)
+	peers := []wgPeerEndpoint{
+		{allowed: mustCIDRs(t, "10.254.0.2/32"), endpoint: "203.0.113.2", handshake: time.Unix(1703829940, 0)},
+		{allowed: mustCIDRs(t, "10.254.0.3/32"), endpoint: "203.0.113.3"},
+		{allowed: mustCIDRs(t, "10.254.0.4/32")},
+	}
+	ages := handshakeAges(peers, []string{"10.254.0.2", "10.254.0.3", "10.254.0.4", "10.254.0.5"}, now)
+
+	// 从未握手的对端（包括没有端点的）按无限长处理，匹配不到对等节点的不包含
+	want := map[string]int64{"10.254.0.2": 60, "10.254.0.3": neverHandshakeAge, "10.254.0.4": neverHandshakeAge}
+	if len(ages) != len(want) {
+		t.Fatalf("ages = %v, want %v", ages, want)
+	}
+	for target, age := range want {
+		if ages[target] != age {
+			t.Errorf("ages[%s] = %d, want %d", target, ages[target], age)
+		}
+	}
+}
+
+func TestSetHandshakeAges(t *testing.T) {
+	metrics := []models.Metric{
+		{TargetIP: "10.254.0.2", RTTMs: ptrFloat64(10), JitterMs: 1},
+		{TargetIP: "10.254.0.3", RTTMs: ptrFloat64(20), JitterMs: 2, BandwidthMbps: 100},
+		{TargetIP: "10.254.0.4", RTTMs: ptrFloat64(30)},
+	}
+	setHandshakeAges(metrics, map[string]int64{"10.254.0.2": 30, "10.254.0.3": 400}, 3*time.Minute)
+
+	if m := metrics[0]; m.RTTMs == nil || m.HandshakeAgeSec == nil || *m.HandshakeAgeSec != 30 || m.HandshakeNever {
+		t.Errorf("fresh handshake: %+v", m)
+	}
+	// 探测成功但隧道握手已过期，上报为不可达
+	if m := metrics[1]; m.RTTMs != nil || m.LossRate != 1.0 || m.JitterMs != 0 || m.BandwidthMbps != 100 || *m.HandshakeAgeSec != 400 {
+		t.Errorf("stale handshake: %+v", m)
+	}
+	if m := metrics[2]; m.RTTMs == nil || m.HandshakeAgeSec != nil {
+		t.Errorf("unknown handshake: %+v", m)
+	}
+}
+
+func TestSetHandshakeAgesNeverHandshaked(t *testing.T) {
+	// 从未握手的链路上报 handshake_never，不上报握手间隔
+	metrics := []models.Metric{{TargetIP: "10.254.0.2", RTTMs: ptrFloat64(10)}}
+	setHandshakeAges(metrics, map[string]int64{"10.254.0.2": neverHandshakeAge}, 3*time.Minute)
+	if m := metrics[0]; m.RTTMs != nil || m.LossRate != 1.0 || !m.HandshakeNever || m.HandshakeAgeSec != nil {
+		t.Errorf("never handshaked with timeout: %+v", m)
+	}
+
+	// 未设置 handshake_timeout 时只上报
+	metrics = []models.Metric{{TargetIP: "10.254.0.2", RTTMs: ptrFloat64(10)}}
+	setHandshakeAges(metrics, map[string]int64{"10.254.0.2": neverHandshakeAge}, 0)
+	if m := metrics[0]; m.RTTMs == nil || !m.HandshakeNever || m.HandshakeAgeSec != nil {
+		t.Errorf("never handshaked without timeout: %+v", m)
+	}
+}
+
+func mustCIDRs(t *testing.T, cidrs ...string) []*net.IPNet {
+	t.Helper()
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("ParseCIDR(%s): %v", cidr, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
@@ -0,0 +1,476 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// adminAuthMiddleware 校验管理 API 的 Bearer Token
+// 未配置 admin.token 时管理 API 被禁用
+func (s *Server) adminAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := s.cfg.Admin.Token
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{
+				Detail: "Admin API is disabled. Set admin.token to enable it.",
+			})
+			return
+		}
+
+		auth := c.GetHeader("Authorization")
+		provided := strings.TrimPrefix(auth, "Bearer ")
+		if provided == auth || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+				Detail: "Invalid or missing admin token",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// adminActor 返回审计日志中的管理操作者标识
+func adminActor(c *gin.Context) string {
+	return "admin@" + c.ClientIP()
+}
+
+// PinListResponse 固定路由列表响应
+type PinListResponse struct {
+	Pins []models.RoutePin `json:"pins"`
+}
+
+// handleListPins 列出所有固定路由
+func (s *Server) handleListPins(c *gin.Context) {
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, PinListResponse{Pins: t.solver.GetPins()})
+}
+
+// handleSetPin 设置或替换一条固定路由
+func (s *Server) handleSetPin(c *gin.Context) {
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	var pin models.RoutePin
+
+	if err := c.ShouldBindJSON(&pin); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: fmt.Sprintf("Invalid JSON: %v", err),
+		})
+		return
+	}
+
+	if err := pin.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: err.Error(),
+		})
+		return
+	}
+
+	pin.CreatedAt = time.Now().Unix()
+	t.solver.SetPin(pin)
+	s.audit.Log(t.id, AuditPinSet, adminActor(c), routeKey(pin.Source, pin.Target), map[string]interface{}{
+		"next_hop": pin.NextHop,
+		"comment":  pin.Comment,
+	})
+
+	s.reqLogger(c).Info("Route pinned",
+		logging.F("source", pin.Source),
+		logging.F("target", pin.Target),
+		logging.F("next_hop", pin.NextHop),
+		logging.F("client_ip", c.ClientIP()),
+	)
+
+	s.refreshRoutes(t, adminActor(c))
+
+	c.JSON(http.StatusOK, pin)
+}
+
+// handleDeletePin 删除一条固定路由
+func (s *Server) handleDeletePin(c *gin.Context) {
+	source := c.Query("source")
+	target := c.Query("target")
+	if source == "" || target == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: "source and target query parameters are required",
+		})
+		return
+	}
+
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	if !t.solver.RemovePin(source, target) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Detail: "Pin not found",
+		})
+		return
+	}
+	s.audit.Log(t.id, AuditPinRemoved, adminActor(c), routeKey(source, target), nil)
+
+	s.reqLogger(c).Info("Route pin removed",
+		logging.F("source", source),
+		logging.F("target", target),
+		logging.F("client_ip", c.ClientIP()),
+	)
+
+	s.refreshRoutes(t, adminActor(c))
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// PolicyListResponse 路由策略列表响应
+type PolicyListResponse struct {
+	Policies []models.RoutePolicy `json:"policies"`
+}
+
+// handleListPolicies 列出所有路由策略
+func (s *Server) handleListPolicies(c *gin.Context) {
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, PolicyListResponse{Policies: t.solver.GetPolicies()})
+}
+
+// handleSetPolicy 设置或替换一个 Agent 的路由策略
+func (s *Server) handleSetPolicy(c *gin.Context) {
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	var policy models.RoutePolicy
+
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: fmt.Sprintf("Invalid JSON: %v", err),
+		})
+		return
+	}
+
+	if err := policy.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: err.Error(),
+		})
+		return
+	}
+
+	policy.UpdatedAt = time.Now().Unix()
+	t.solver.SetPolicy(policy)
+	s.audit.Log(t.id, AuditPolicySet, adminActor(c), policy.AgentID, map[string]interface{}{
+		"avoid_relays":   policy.AvoidRelays,
+		"max_relay_hops": policy.MaxRelayHops,
+		"penalty_factor": policy.PenaltyFactor,
+		"comment":        policy.Comment,
+	})
+
+	s.reqLogger(c).Info("Route policy set",
+		logging.F("agent_id", policy.AgentID),
+		logging.F("client_ip", c.ClientIP()),
+	)
+
+	s.refreshRoutes(t, adminActor(c))
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// handleDeletePolicy 删除一个 Agent 的路由策略
+func (s *Server) handleDeletePolicy(c *gin.Context) {
+	agentID := c.Query("agent_id")
+	if agentID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: "agent_id query parameter is required",
+		})
+		return
+	}
+
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	if !t.solver.RemovePolicy(agentID) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Detail: "Policy not found",
+		})
+		return
+	}
+	s.audit.Log(t.id, AuditPolicyRemoved, adminActor(c), agentID, nil)
+
+	s.reqLogger(c).Info("Route policy removed",
+		logging.F("agent_id", agentID),
+		logging.F("client_ip", c.ClientIP()),
+	)
+
+	s.refreshRoutes(t, adminActor(c))
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// ConstraintListResponse 目的地路由约束列表响应
+type ConstraintListResponse struct {
+	Constraints []models.RouteConstraint `json:"constraints"`
+}
+
+// handleListConstraints 列出所有目的地路由约束
+func (s *Server) handleListConstraints(c *gin.Context) {
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, ConstraintListResponse{Constraints: t.solver.GetConstraints()})
+}
+
+// handleSetConstraint 设置或替换一个目的前缀的路由约束
+func (s *Server) handleSetConstraint(c *gin.Context) {
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	var constraint models.RouteConstraint
+
+	if err := c.ShouldBindJSON(&constraint); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: fmt.Sprintf("Invalid JSON: %v", err),
+		})
+		return
+	}
+
+	if err := constraint.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: err.Error(),
+		})
+		return
+	}
+
+	constraint.DstCIDR = normalizeCIDR(constraint.DstCIDR)
+	constraint.UpdatedAt = time.Now().Unix()
+	t.solver.SetConstraint(constraint)
+	s.audit.Log(t.id, AuditConstraintSet, adminActor(c), constraint.DstCIDR, map[string]interface{}{
+		"avoid_nodes": constraint.AvoidNodes,
+		"max_hops":    constraint.MaxHops,
+		"via":         constraint.Via,
+		"comment":     constraint.Comment,
+	})
+
+	s.reqLogger(c).Info("Route constraint set",
+		logging.F("dst_cidr", constraint.DstCIDR),
+		logging.F("client_ip", c.ClientIP()),
+	)
+
+	s.refreshRoutes(t, adminActor(c))
+
+	c.JSON(http.StatusOK, constraint)
+}
+
+// handleDeleteConstraint 删除一个目的前缀的路由约束
+func (s *Server) handleDeleteConstraint(c *gin.Context) {
+	dstCIDR := c.Query("dst_cidr")
+	if dstCIDR == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: "dst_cidr query parameter is required",
+		})
+		return
+	}
+
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	if !t.solver.RemoveConstraint(dstCIDR) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Detail: "Constraint not found",
+		})
+		return
+	}
+	s.audit.Log(t.id, AuditConstraintRemoved, adminActor(c), normalizeCIDR(dstCIDR), nil)
+
+	s.reqLogger(c).Info("Route constraint removed",
+		logging.F("dst_cidr", dstCIDR),
+		logging.F("client_ip", c.ClientIP()),
+	)
+
+	s.refreshRoutes(t, adminActor(c))
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// LinkListResponse 禁用链路列表响应
+type LinkListResponse struct {
+	Links []models.LinkDisable `json:"links"`
+}
+
+// handleListDisabledLinks 列出所有被禁用的链路
+func (s *Server) handleListDisabledLinks(c *gin.Context) {
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, LinkListResponse{Links: t.solver.GetDisabledLinks()})
+}
+
+// handleDisableLink 管理性禁用一条有向链路
+func (s *Server) handleDisableLink(c *gin.Context) {
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	var link models.LinkDisable
+
+	if err := c.ShouldBindJSON(&link); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: fmt.Sprintf("Invalid JSON: %v", err),
+		})
+		return
+	}
+
+	if err := link.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: err.Error(),
+		})
+		return
+	}
+
+	link.CreatedAt = time.Now().Unix()
+	t.solver.DisableLink(link)
+	t.changes.Record(models.TopologyChange{
+		Type:      ChangeLinkDisabled,
+		AgentID:   link.Source,
+		Target:    link.Target,
+		Actor:     adminActor(c),
+		Reason:    link.Comment,
+		Version:   t.db.Version(),
+		Timestamp: link.CreatedAt,
+	})
+	s.audit.Log(t.id, AuditLinkDisabled, adminActor(c), routeKey(link.Source, link.Target), map[string]interface{}{
+		"comment": link.Comment,
+	})
+
+	s.reqLogger(c).Info("Link disabled",
+		logging.F("source", link.Source),
+		logging.F("target", link.Target),
+		logging.F("client_ip", c.ClientIP()),
+	)
+
+	s.refreshRoutes(t, adminActor(c))
+
+	c.JSON(http.StatusOK, link)
+}
+
+// handleEnableLink 恢复一条被禁用的链路
+func (s *Server) handleEnableLink(c *gin.Context) {
+	source := c.Query("source")
+	target := c.Query("target")
+	if source == "" || target == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: "source and target query parameters are required",
+		})
+		return
+	}
+
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	if !t.solver.EnableLink(source, target) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Detail: "Link is not disabled",
+		})
+		return
+	}
+	t.changes.Record(models.TopologyChange{
+		Type:      ChangeLinkEnabled,
+		AgentID:   source,
+		Target:    target,
+		Actor:     adminActor(c),
+		Version:   t.db.Version(),
+		Timestamp: time.Now().Unix(),
+	})
+	s.audit.Log(t.id, AuditLinkEnabled, adminActor(c), routeKey(source, target), nil)
+
+	s.reqLogger(c).Info("Link enabled",
+		logging.F("source", source),
+		logging.F("target", target),
+		logging.F("client_ip", c.ClientIP()),
+	)
+
+	s.refreshRoutes(t, adminActor(c))
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// CleanResponse 手动清理的结果
+type CleanResponse struct {
+	TenantID    string   `json:"tenant_id,omitempty"`
+	Threshold   string   `json:"threshold,omitempty"` // 本次使用的过期阈值，为空表示按当前过期策略
+	Scanned     int      `json:"scanned"`
+	Removed     []string `json:"removed"`
+	Quarantined int      `json:"quarantined"`
+	DurationMs  float64  `json:"duration_ms"`
+}
+
+// handleClean 立即执行一次陈旧数据清理，threshold 查询参数可临时指定过期阈值
+// 指定阈值时对所有 Agent 生效且不经过隔离期，用于清除已知失效的站点
+func (s *Server) handleClean(c *gin.Context) {
+	var threshold time.Duration
+	if v := c.Query("threshold"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Detail: "threshold must be a positive duration such as 10m",
+			})
+			return
+		}
+		threshold = d
+	}
+
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	run := t.cleaner.CleanNow(threshold, adminActor(c))
+
+	s.reqLogger(c).Info("Manual cleanup",
+		logging.F("tenant_id", t.id),
+		logging.F("threshold", threshold.String()),
+		logging.F("removed_nodes", run.RemovedAgents),
+		logging.F("client_ip", c.ClientIP()),
+	)
+
+	resp := CleanResponse{
+		TenantID:    t.id,
+		Scanned:     run.Scanned,
+		Removed:     run.RemovedAgents,
+		Quarantined: run.Quarantined,
+		DurationMs:  float64(run.Duration.Microseconds()) / 1000.0,
+	}
+	if threshold > 0 {
+		resp.Threshold = threshold.String()
+	}
+	if resp.Removed == nil {
+		resp.Removed = []string{}
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,152 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// routeFetchTracker 记录每个 Agent 最近一次拉取路由的时间
+type routeFetchTracker struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// newRouteFetchTracker 创建路由拉取记录
+func newRouteFetchTracker() *routeFetchTracker {
+	return &routeFetchTracker{last: make(map[string]time.Time)}
+}
+
+// Record 记录一次路由拉取
+func (t *routeFetchTracker) Record(agentID string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last[agentID] = at
+}
+
+// Snapshot 返回所有记录的副本，并清理不在 keep 中的 Agent
+func (t *routeFetchTracker) Snapshot(keep map[string]struct{}) map[string]time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make(map[string]time.Time, len(t.last))
+	for id, at := range t.last {
+		if _, ok := keep[id]; !ok {
+			delete(t.last, id)
+			continue
+		}
+		result[id] = at
+	}
+	return result
+}
+
+// AgentStatus Agent 存活状态
+type AgentStatus struct {
+	AgentID    string `json:"agent_id"`
+	LastSeen   string `json:"last_seen"`
+	AgeSeconds int64  `json:"age_seconds"`
+	Stale      bool   `json:"stale"`
+	ExpiresAt  string `json:"expires_at"` // 未再上报时数据过期的时间
+	// Quarantined 已过期但仍在隔离期内：保留在拓扑中，不再作为中继，RemovesAt 后删除
+	Quarantined    bool   `json:"quarantined,omitempty"`
+	RemovesAt      string `json:"removes_at,omitempty"`
+	Streaming      bool   `json:"streaming"`
+	LastRouteFetch string `json:"last_route_fetch,omitempty"`
+	// RoutesServed 未过期，且正在订阅路由流或在过期阈值内拉取过路由
+	RoutesServed bool `json:"routes_served"`
+	// ReportIntervalSec Agent 声明的上报间隔，0 表示未声明，过期时间按全局 stale_threshold 计算
+	ReportIntervalSec int64 `json:"report_interval_sec,omitempty"`
+}
+
+// AgentListResponse Agent 列表响应
+type AgentListResponse struct {
+	Count  int           `json:"count"`
+	Agents []AgentStatus `json:"agents"`
+	// Removed 最近因过期被清理的 Agent，最近清理的在前
+	Removed []RemovedAgent `json:"removed,omitempty"`
+}
+
+// RemovedAgent 因过期被清理的 Agent
+type RemovedAgent struct {
+	AgentID   string                `json:"agent_id"`
+	LastSeen  string                `json:"last_seen"`
+	RemovedAt string                `json:"removed_at"`
+	Metadata  *models.AgentMetadata `json:"metadata,omitempty"`
+}
+
+// handleListAgents 列出所有 Agent 的存活状态
+func (s *Server) handleListAgents(c *gin.Context) {
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	allData := t.db.GetAll()
+	now := time.Now()
+	policy := t.cleaner.Policy()
+
+	known := make(map[string]struct{}, len(allData))
+	for id := range allData {
+		known[id] = struct{}{}
+	}
+	fetches := t.routeFetches.Snapshot(known)
+
+	streaming := make(map[string]bool)
+	for _, id := range t.streams.SubscribedAgents() {
+		streaming[id] = true
+	}
+
+	agents := make([]AgentStatus, 0, len(allData))
+	for agentID, data := range allData {
+		age := now.Sub(data.Timestamp)
+		threshold := policy.For(data)
+		status := AgentStatus{
+			AgentID:           agentID,
+			LastSeen:          data.Timestamp.Format(time.RFC3339),
+			AgeSeconds:        int64(age.Seconds()),
+			Stale:             age > threshold,
+			ExpiresAt:         data.Timestamp.Add(threshold).Format(time.RFC3339),
+			ReportIntervalSec: int64(data.ReportInterval.Seconds()),
+			Streaming:         streaming[agentID],
+		}
+
+		fetchedRecently := false
+		if at, ok := fetches[agentID]; ok {
+			status.LastRouteFetch = at.Format(time.RFC3339)
+			fetchedRecently = now.Sub(at) <= threshold
+		}
+		status.RoutesServed = !status.Stale && (status.Streaming || fetchedRecently)
+		if policy.Quarantine > 0 {
+			status.Quarantined = status.Stale
+			status.RemovesAt = data.Timestamp.Add(threshold + policy.Quarantine).Format(time.RFC3339)
+		}
+
+		agents = append(agents, status)
+	}
+
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].AgentID < agents[j].AgentID
+	})
+
+	var removed []RemovedAgent
+	for _, tomb := range t.db.Tombstones() {
+		removed = append(removed, RemovedAgent{
+			AgentID:   tomb.AgentID,
+			LastSeen:  tomb.LastSeen.Format(time.RFC3339),
+			RemovedAt: tomb.RemovedAt.Format(time.RFC3339),
+			Metadata:  tomb.Metadata,
+		})
+	}
+
+	c.JSON(http.StatusOK, AgentListResponse{
+		Count:   len(agents),
+		Agents:  agents,
+		Removed: removed,
+	})
+}
@@ -0,0 +1,119 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"math"
+	"sort"
+)
+
+// alternateEpsilon 比较浮点成本时的容差
+const alternateEpsilon = 1e-9
+
+// alternateFinder 为单个源节点查找最优下一跳之外的无环备选下一跳（ECMP 和备份路由）
+// 邻居 N 作为到 T 的备选需满足无环条件 dist(N,T) < dist(N,S) + dist(S,T)（RFC 5286），
+// 即 N 按自己的路由转发时不会把流量送回源节点 S
+type alternateFinder struct {
+	g      *Graph
+	source string
+
+	fromNeighbor map[string]*DijkstraResult // 邻居 -> 最短路径，按需计算
+}
+
+// alternate 一个备选下一跳及经它到达目的地的总成本
+type alternate struct {
+	hop  string
+	cost float64
+}
+
+// newAlternateFinder 创建备选下一跳查找器
+func newAlternateFinder(g *Graph, source string) *alternateFinder {
+	return &alternateFinder{
+		g:            g,
+		source:       source,
+		fromNeighbor: make(map[string]*DijkstraResult),
+	}
+}
+
+// candidates 返回到 target 的所有无环下一跳，按成本升序（成本相同时按名称）
+func (f *alternateFinder) candidates(target string, best float64) []alternate {
+	var result []alternate
+	for neighbor, cost := range f.g.edges[f.source] {
+		if math.IsInf(cost, 1) {
+			continue
+		}
+		if neighbor == target {
+			result = append(result, alternate{hop: "direct", cost: cost})
+			continue
+		}
+
+		dist := f.distances(neighbor)
+		toTarget, ok := dist[target]
+		if !ok || math.IsInf(toTarget, 1) {
+			continue
+		}
+		if toSource, ok := dist[f.source]; ok && toTarget >= toSource+best {
+			continue // 邻居的最短路径经过源节点，会形成环路
+		}
+		result = append(result, alternate{hop: neighbor, cost: cost + toTarget})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].cost != result[j].cost {
+			return result[i].cost < result[j].cost
+		}
+		return result[i].hop < result[j].hop
+	})
+	return result
+}
+
+// equalCostHops 返回成本不超过 best*(1+margin) 的全部下一跳，primary 排在第一位
+// 只有一个下一跳满足条件时返回 nil；直连不能作为多路径路由的下一跳（Agent 只能下发 nexthop via），
+// primary 为直连时不使用 ECMP，直连的等价备选也不计入
+func equalCostHops(cands []alternate, primary string, best, margin float64) []string {
+	if primary == "direct" {
+		return nil
+	}
+	limit := best*(1+margin) + alternateEpsilon
+
+	var others []string
+	for _, c := range cands {
+		if c.hop != primary && c.hop != "direct" && c.cost <= limit {
+			others = append(others, c.hop)
+		}
+	}
+	if len(others) == 0 {
+		return nil
+	}
+	sort.Strings(others)
+	return append([]string{primary}, others...)
+}
+
+// backupHops 返回 primary 和 exclude 之外成本最低的至多 k 个下一跳
+func backupHops(cands []alternate, primary string, exclude []string, k int) []string {
+	skip := make(map[string]bool, len(exclude)+1)
+	skip[primary] = true
+	for _, hop := range exclude {
+		skip[hop] = true
+	}
+
+	var result []string
+	for _, c := range cands {
+		if len(result) >= k {
+			break
+		}
+		if !skip[c.hop] {
+			result = append(result, c.hop)
+		}
+	}
+	return result
+}
+
+// distances 返回邻居到各节点的最短距离
+func (f *alternateFinder) distances(neighbor string) map[string]float64 {
+	result, ok := f.fromNeighbor[neighbor]
+	if !ok {
+		result = f.g.Dijkstra(neighbor)
+		f.fromNeighbor[neighbor] = result
+	}
+	return result.Distances
+}
@@ -1,8 +1,15 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -12,62 +19,269 @@ import (
 	"github.com/holygeek00/lite-sdwan/pkg/models"
 )
 
-// Default cleaner interval
-const defaultCleanerInterval = 60 * time.Second
+// RouteVersionHeader 增量路由查询返回当前路由集版本的响应头
+const RouteVersionHeader = "X-Route-Version"
+
+// routeStreamKeepalive 路由推送流的心跳间隔
+const routeStreamKeepalive = 15 * time.Second
 
 // Server Controller HTTP 服务器
 type Server struct {
-	cfg     *config.ControllerConfig
-	db      *TopologyDB
-	solver  *RouteSolver
-	router  *gin.Engine
-	cleaner *StaleDataCleaner
-	logger  logging.Logger
+	cfg      *config.ControllerConfig
+	db       *TopologyDB
+	solver   *RouteSolver
+	router   *gin.Engine
+	cleaner  *StaleDataCleaner
+	streams  *RouteStreamHub
+	events   *TopologyEventHub
+	audit    *AuditLogger
+	webhooks *WebhookNotifier
+	logger   logging.Logger
+
+	// configPath 配置文件路径，用于运行时重载
+	configPath string
+
+	// replicator 备节点复制器，非 standby 角色时为 nil
+	replicator *Replicator
+
+	// persister 状态持久化器，storage.backend 为 file、bolt、sqlite 以外时为 nil
+	persister *StatePersister
+
+	// shared 共享拓扑同步器，storage.backend 为 redis 以外时为 nil
+	shared *TopologySyncer
+
+	// routeFetches 记录各 Agent 最近一次拉取路由的时间
+	routeFetches *routeFetchTracker
+
+	// tenants 按 tenant_id 划分的拓扑分区，默认租户复用上面的 db、solver 等字段
+	tenantsMu sync.RWMutex
+	tenants   map[string]*tenant
+
+	startedAt    time.Time
+	shuttingDown int32 // 是否已进入关闭流程 (1=是)
+	shutdownOnce sync.Once
+
+	// httpServer Run 启动的 HTTP 服务器，Stop 据此停止接受新请求
+	httpMu     sync.Mutex
+	httpServer *http.Server
+
+	// 限流器，未启用限流时为 nil
+	ipLimiter    *RateLimiter
+	agentLimiter *RateLimiter
 }
 
 // NewServer 创建新的 Controller 服务器
-func NewServer(cfg *config.ControllerConfig) *Server {
+func NewServer(cfg *config.ControllerConfig) (*Server, error) {
 	gin.SetMode(gin.ReleaseMode)
 
 	// 创建 logger
 	logger := logging.NewJSONLoggerFromString(cfg.Logging.Level, nil)
 
+	// 只采信 server.trusted_proxies 中的反向代理转发的 X-Forwarded-For，未配置时按 TCP 对端地址识别客户端，
+	// 伪造的请求头不能绕过按 IP 限流，也不会出现在审计日志中
+	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid server.trusted_proxies: %w", err)
+	}
+
+	// 创建审计日志
+	audit, err := newAuditLoggerFromConfig(cfg.Audit, logger)
+	if err != nil {
+		return nil, err
+	}
+
 	s := &Server{
-		cfg:    cfg,
-		db:     NewTopologyDB(),
-		solver: NewRouteSolver(cfg.Algorithm.PenaltyFactor, cfg.Algorithm.Hysteresis),
-		router: gin.New(),
-		logger: logger,
+		cfg:      cfg,
+		db:       NewTopologyDB(),
+		solver:   NewRouteSolver(cfg.Algorithm.PenaltyFactor, cfg.Algorithm.Hysteresis),
+		router:   router,
+		streams:  NewRouteStreamHub(),
+		events:   NewTopologyEventHub(),
+		audit:    audit,
+		webhooks: NewWebhookNotifier(cfg.Webhook, logger),
+		logger:   logger,
+
+		routeFetches: newRouteFetchTracker(),
+		startedAt:    time.Now(),
 	}
+	s.solver.SetDegradationThreshold(cfg.Algorithm.DegradationThreshold)
+	s.solver.SetJitterWeight(cfg.Algorithm.JitterWeight)
+	s.solver.SetBandwidthPenalty(cfg.Algorithm.BandwidthPenalty, cfg.Algorithm.BandwidthReferenceMbps)
+	s.solver.SetECMPMargin(cfg.Algorithm.ECMPMargin)
+	s.solver.SetBlackholeUnreachable(cfg.Algorithm.BlackholeUnreachable)
+	s.solver.SetBackupPaths(cfg.Algorithm.BackupPaths)
+	s.solver.SetMaxHops(cfg.Algorithm.MaxHops)
+	s.solver.SetLinkReconciliation(cfg.Algorithm.LinkReconciliation)
+	s.solver.SetMinSamples(cfg.Algorithm.MinSamples)
+	s.solver.SetRelayLoadPenalty(cfg.Algorithm.RelayLoadPenalty)
+	s.solver.SetMetricWeights(cfg.Algorithm.Weights)
+	s.solver.SetSLA(cfg.Algorithm.SLA)
+	s.solver.SetTrafficClasses(cfg.Algorithm.TrafficClasses)
+	s.db.SetHistorySize(cfg.Topology.Retention.MaxPoints)
+	s.db.SetLimits(cfg.Topology.MaxAgents, cfg.Topology.MaxMetricsPerAgent)
+	s.db.SetTombstoneTTL(cfg.Topology.TombstoneTTL)
 
 	// 创建并启动陈旧数据清理器
 	s.cleaner = NewStaleDataCleaner(
 		s.db,
 		cfg.Topology.StaleThreshold,
-		defaultCleanerInterval,
+		cfg.Topology.CleanerInterval,
 		logger,
 	)
+	s.cleaner.SetIntervalMultiplier(cfg.Topology.IntervalMultiplier)
+	s.cleaner.SetLinkThreshold(cfg.Topology.LinkStaleThreshold)
+	s.cleaner.SetQuarantine(cfg.Topology.QuarantinePeriod)
+	s.cleaner.SetRetention(cfg.Topology.Retention)
+	s.cleaner.SetRouteHistory(s.solver.GetHistory())
+	s.solver.SetStalePolicy(s.cleaner.Policy())
+	s.cleaner.SetAuditLogger(audit)
+	s.cleaner.SetWebhookNotifier(s.webhooks)
+	s.cleaner.SetEvictHandler(s.evictionHandler(models.DefaultTenantID))
 	s.cleaner.Start()
 
+	s.watchTopology(s.db, models.DefaultTenantID)
+	changes := NewTopologyChangeLog(0)
+	changes.Watch(s.db)
+	paths := NewPathStore()
+	paths.Watch(s.db)
+
+	s.tenants = map[string]*tenant{
+		models.DefaultTenantID: {
+			id:           models.DefaultTenantID,
+			db:           s.db,
+			solver:       s.solver,
+			cleaner:      s.cleaner,
+			streams:      s.streams,
+			routeFetches: s.routeFetches,
+			changes:      changes,
+			paths:        paths,
+		},
+	}
+	s.tenants[models.DefaultTenantID].pusher = s.newRoutePusher(s.tenants[models.DefaultTenantID])
+
+	switch cfg.Storage.Backend {
+	case config.StorageBackendFile, config.StorageBackendBolt, config.StorageBackendSQLite:
+		persister, err := NewStatePersister(s, cfg.Storage, logger)
+		if err != nil {
+			s.Shutdown()
+			return nil, err
+		}
+		if _, err := persister.Load(); err != nil {
+			_ = persister.store.Close()
+			s.Shutdown()
+			return nil, err
+		}
+		s.persister = persister
+		s.persister.Start()
+	case config.StorageBackendRedis:
+		backend := NewRedisTopologyBackend(cfg.Storage.Redis)
+		s.shared = NewTopologySyncer(s, backend, cfg.Storage.Redis.SyncInterval, logger)
+		s.shared.Start()
+	}
+
+	if cfg.Replication.Role == config.ReplicationRoleStandby {
+		s.replicator = NewReplicator(s, cfg.Replication, logger)
+		s.replicator.Start()
+	}
+
+	// per_ip_rps / per_agent_rps 为 0 时关闭对应维度的限流
+	if cfg.RateLimit.Enabled && cfg.RateLimit.PerIPRPS > 0 {
+		s.ipLimiter = NewRateLimiter(cfg.RateLimit.PerIPRPS, cfg.RateLimit.PerIPBurst)
+	}
+	if cfg.RateLimit.Enabled && cfg.RateLimit.PerAgentRPS > 0 {
+		s.agentLimiter = NewRateLimiter(cfg.RateLimit.PerAgentRPS, cfg.RateLimit.PerAgentBurst)
+	}
+
 	s.setupRoutes()
-	return s
+	return s, nil
+}
+
+// newAuditLoggerFromConfig 根据配置创建审计日志输出
+func newAuditLoggerFromConfig(cfg config.AuditConfig, logger logging.Logger) (*AuditLogger, error) {
+	var sinks []AuditSink
+	if cfg.File != "" {
+		sink, err := NewFileAuditSink(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if cfg.URL != "" {
+		sinks = append(sinks, NewHTTPAuditSink(cfg.URL, cfg.Timeout, logger))
+	}
+	return NewAuditLogger(logger, sinks...), nil
 }
 
 // setupRoutes 设置路由
 func (s *Server) setupRoutes() {
 	s.router.Use(gin.Recovery())
+	s.router.Use(s.requestIDMiddleware())
 	s.router.Use(s.loggingMiddleware())
+	if s.cfg.CORS.Enabled() {
+		s.router.Use(corsMiddleware(s.cfg.CORS))
+	}
+	s.router.Use(s.bodyLimitMiddleware())
 
 	// API v1
 	v1 := s.router.Group("/api/v1")
 	{
-		v1.POST("/telemetry", s.handleTelemetry)
-		v1.GET("/routes", s.handleGetRoutes)
-		v1.GET("/topology", s.handleTopology)
+		v1.POST("/telemetry", s.rateLimitMiddleware(), s.handleTelemetry)
+		v1.GET("/routes", s.rateLimitMiddleware(), gzipMiddleware(), s.handleGetRoutes)
+		v1.GET("/routes/stream", s.handleRouteStream)
+		v1.POST("/simulate", s.rateLimitMiddleware(), s.handleSimulate)
+		v1.GET("/routes/history", gzipMiddleware(), s.handleRouteHistory)
+		v1.GET("/topology", gzipMiddleware(), s.handleTopology)
+		v1.GET("/topology/reporters", s.handleReporters)
+		v1.GET("/topology/export", s.handleTopologyExport)
+		v1.GET("/topology/changes", gzipMiddleware(), s.handleTopologyChanges)
+		v1.GET("/stats", s.handleStats)
+		v1.GET("/stats/routes", s.handleRouteStability)
+		v1.GET("/agents", s.handleListAgents)
+		v1.GET("/peers", s.rateLimitMiddleware(), s.handleGetPeers)
+		v1.POST("/paths", s.rateLimitMiddleware(), s.handleReportPaths)
+		v1.GET("/paths", gzipMiddleware(), s.handleGetPaths)
+		v1.GET("/events", s.tenantAuthMiddleware(), s.handleEvents)
+	}
+
+	// API v2：与 v1 语义相同，支持 protobuf 编码
+	v2 := s.router.Group("/api/v2", protobufNegotiationMiddleware())
+	{
+		v2.POST("/telemetry", s.rateLimitMiddleware(), s.handleTelemetry)
+		v2.GET("/routes", s.rateLimitMiddleware(), gzipMiddleware(), s.handleGetRoutes)
+	}
+
+	// 管理 API
+	admin := v1.Group("/admin", s.adminAuthMiddleware())
+	{
+		admin.GET("/pins", s.handleListPins)
+		admin.PUT("/pins", s.handleSetPin)
+		admin.DELETE("/pins", s.handleDeletePin)
+		admin.GET("/policies", s.handleListPolicies)
+		admin.PUT("/policies", s.handleSetPolicy)
+		admin.DELETE("/policies", s.handleDeletePolicy)
+		admin.GET("/constraints", s.handleListConstraints)
+		admin.PUT("/constraints", s.handleSetConstraint)
+		admin.DELETE("/constraints", s.handleDeleteConstraint)
+		admin.GET("/links", s.handleListDisabledLinks)
+		admin.PUT("/links", s.handleDisableLink)
+		admin.DELETE("/links", s.handleEnableLink)
+		admin.POST("/reload", s.handleReload)
+		admin.POST("/clean", s.handleClean)
+		admin.POST("/routes/recompute", s.handleRecompute)
 	}
 
-	// 健康检查
+	// 复制接口：配置了复制 Token 时启用，备节点通过它拉取状态
+	if s.cfg.Replication.Token != "" {
+		v1.GET("/replication/snapshot", s.replicationAuthMiddleware(), gzipMiddleware(), s.handleReplicationSnapshot)
+	}
+
+	// 健康检查：/health 保留详细信息，/healthz 和 /readyz 供编排系统做存活和就绪探测
 	s.router.GET("/health", s.handleHealth)
+	s.router.GET("/healthz", s.handleHealthz)
+	s.router.GET("/readyz", s.handleReadyz)
+
+	// Prometheus 文本格式指标
+	s.router.GET("/metrics", s.handleMetrics)
 }
 
 // loggingMiddleware 返回结构化日志中间件
@@ -79,7 +293,7 @@ func (s *Server) loggingMiddleware() gin.HandlerFunc {
 		c.Next()
 
 		duration := time.Since(start)
-		s.logger.Info("HTTP request",
+		s.reqLogger(c).Info("HTTP request",
 			logging.F("method", c.Request.Method),
 			logging.F("path", path),
 			logging.F("status", c.Writer.Status()),
@@ -93,59 +307,362 @@ func (s *Server) loggingMiddleware() gin.HandlerFunc {
 func (s *Server) handleTelemetry(c *gin.Context) {
 	var req models.TelemetryRequest
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Detail: fmt.Sprintf("Invalid JSON: %v", err),
+	if err := bindTelemetry(c, &req); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			render(c, http.StatusRequestEntityTooLarge, &models.ErrorResponse{
+				Detail: fmt.Sprintf("Request body exceeds %d bytes", maxErr.Limit),
+			})
+			return
+		}
+		render(c, http.StatusBadRequest, &models.ErrorResponse{
+			Detail: fmt.Sprintf("Invalid request body: %v", err),
 		})
 		return
 	}
 
 	if err := req.Validate(); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+		render(c, http.StatusBadRequest, &models.ErrorResponse{
 			Detail: err.Error(),
 		})
 		return
 	}
 
-	// 存储数据
-	s.db.Store(&req)
+	if !s.allowAgent(c, tenantAgentKey(req.TenantID, req.AgentID)) {
+		return
+	}
+	// 接受时间由 Controller 记录，不信任 Agent 提供的值
+	req.ReceivedAtNs = 0
+	t, err := s.tenantFor(req.TenantID)
+	if err != nil {
+		render(c, http.StatusServiceUnavailable, &models.ErrorResponse{
+			Detail: "Tenant limit reached. Raise tenants.max_tenants to accept new tenants.",
+		})
+		return
+	}
+
+	// 存储数据，保留旧数据用于事件比对
+	prev, _ := t.db.Get(req.AgentID)
+	if !t.db.Store(&req) {
+		// 延迟到达的重试请求：数据已被更新的遥测取代，返回成功避免 Agent 继续重试
+		s.reqLogger(c).Info("Ignored out-of-order telemetry",
+			logging.F("agent_id", req.AgentID),
+			logging.F("tenant_id", req.TenantID),
+			logging.F("sequence", req.Sequence),
+		)
+		render(c, http.StatusOK, &models.StatusResponse{Status: "ignored"})
+		return
+	}
+	// 共享存储中保存合并后的完整数据，部分更新不会丢失其他链路
+	if s.shared != nil {
+		if snapshot, ok := t.db.AgentSnapshot(req.AgentID); ok {
+			snapshot.TenantID = req.TenantID
+			s.shared.Publish(&snapshot)
+		}
+	}
+	s.notifyTelemetryEvents(&req, prev)
 
-	s.logger.Info("Received telemetry",
+	s.reqLogger(c).Info("Received telemetry",
 		logging.F("agent_id", req.AgentID),
+		logging.F("tenant_id", req.TenantID),
 		logging.F("metric_count", len(req.Metrics)),
 	)
+	s.audit.Log(req.TenantID, AuditTelemetryAccepted, req.AgentID, req.AgentID, map[string]interface{}{
+		"metric_count": len(req.Metrics),
+		"client_ip":    c.ClientIP(),
+	})
 
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	// 拓扑变化后更新路由：on_telemetry 只在越过劣化阈值时全量重算，
+	// 其余模式有流订阅者时交给后台任务合并推送，不阻塞遥测上报
+	switch {
+	case s.cfg.Algorithm.RecomputeMode != config.RecomputeOnTelemetry:
+		if len(t.streams.SubscribedAgents()) > 0 {
+			t.pusher.Trigger()
+		}
+	case s.telemetryCrossedThreshold(&req, prev):
+		s.recomputeRoutes(t, "telemetry")
+	}
+
+	render(c, http.StatusOK, &models.StatusResponse{Status: "ok"})
+}
+
+// refreshRoutes 策略等变化后刷新路由：缓存模式下全量重算，否则只为流订阅者重算
+func (s *Server) refreshRoutes(t *tenant, actor string) {
+	if s.routeCacheEnabled() {
+		s.recomputeRoutes(t, actor)
+		return
+	}
+	s.pushRouteUpdates(t)
+}
+
+// newRoutePusher 创建租户的后台路由推送任务：on_change 模式刷新缓存（变化随重算推送），
+// 否则只为流订阅者重算
+func (s *Server) newRoutePusher(t *tenant) *routePushWorker {
+	return newRoutePushWorker(routePushDebounce, func() {
+		if s.cfg.Algorithm.RecomputeMode == config.RecomputeOnChange {
+			s.refreshChangedRoutes(t)
+			return
+		}
+		s.pushRouteUpdates(t)
+	})
+}
+
+// pushRouteUpdates 为租户内所有订阅路由流的 Agent 重新计算路由，有变化时推送
+func (s *Server) pushRouteUpdates(t *tenant) {
+	for _, agentID := range t.streams.SubscribedAgents() {
+		if !t.db.Exists(agentID) {
+			continue
+		}
+
+		routes := t.solver.ComputeRoutes(t.db, agentID)
+		if len(routes) == 0 {
+			continue
+		}
+		s.audit.Log(t.id, AuditRoutesComputed, "route_stream", agentID, map[string]interface{}{
+			"route_count": len(routes),
+			"routes":      routes,
+		})
+		s.notifyRouteChanges(t.id, agentID, routes)
+
+		update := models.RouteResponse{Routes: routes, Version: t.solver.RouteVersion(agentID)}
+		if dropped := t.streams.Publish(agentID, update); dropped > 0 {
+			s.logger.Warn("Route stream subscriber too slow, update dropped",
+				logging.F("agent_id", agentID),
+				logging.F("dropped", dropped),
+			)
+		}
+	}
+}
+
+// handleRouteStream 通过 Server-Sent Events 向 Agent 推送路由更新
+func (s *Server) handleRouteStream(c *gin.Context) {
+	agentID := c.Query("agent_id")
+	if agentID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: "agent_id query parameter is required",
+		})
+		return
+	}
+
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	if !t.db.Exists(agentID) {
+		status, resp := unknownAgentResponse(t.db, agentID)
+		c.JSON(status, resp)
+		return
+	}
+
+	ch := t.streams.Subscribe(agentID)
+	if ch == nil {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Detail: "Route stream is shutting down",
+		})
+		return
+	}
+	defer t.streams.Unsubscribe(agentID, ch)
+
+	s.reqLogger(c).Info("Route stream opened", logging.F("agent_id", agentID))
+
+	// 首个事件发送当前完整路由集：先计算一次推进求解器状态，再取全部已下发路由，
+	// 重新连接的 Agent 据此补齐断开期间的变化，而不是只收到本次计算的差异
+	s.notifyRouteChanges(t.id, agentID, t.solver.ComputeRoutes(t.db, agentID))
+	routes, version := t.solver.RoutesSince(agentID, 0)
+	c.SSEvent("routes", models.RouteResponse{Routes: routes, Version: version})
+	c.Writer.Flush()
+
+	keepalive := time.NewTicker(routeStreamKeepalive)
+	defer keepalive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case update, ok := <-ch:
+			if !ok {
+				return false
+			}
+			c.SSEvent("routes", update)
+			return true
+		case <-keepalive.C:
+			c.SSEvent("ping", gin.H{"time": time.Now().Unix()})
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+
+	s.reqLogger(c).Info("Route stream closed", logging.F("agent_id", agentID))
+}
+
+// unknownAgentResponse 拓扑中没有该 Agent 时的响应
+// 因过期被清理、仍有过期记录的 Agent 返回 410，与从未上报过的 Agent（404）区分
+func unknownAgentResponse(db *TopologyDB, agentID string) (int, models.ErrorResponse) {
+	if tomb, ok := db.Tombstone(agentID); ok {
+		return http.StatusGone, models.ErrorResponse{
+			Detail: fmt.Sprintf("Agent known but stale: last telemetry at %s, removed at %s",
+				tomb.LastSeen.UTC().Format(time.RFC3339), tomb.RemovedAt.UTC().Format(time.RFC3339)),
+		}
+	}
+	return http.StatusNotFound, models.ErrorResponse{
+		Detail: "Agent not found. Has it sent telemetry?",
+	}
 }
 
 // handleGetRoutes 处理路由查询
 func (s *Server) handleGetRoutes(c *gin.Context) {
 	agentID := c.Query("agent_id")
 	if agentID == "" {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+		render(c, http.StatusBadRequest, &models.ErrorResponse{
 			Detail: "agent_id query parameter is required",
 		})
 		return
 	}
 
-	if !s.db.Exists(agentID) {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{
-			Detail: "Agent not found. Has it sent telemetry?",
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	if !s.allowAgent(c, tenantAgentKey(t.id, agentID)) {
+		return
+	}
+
+	if !t.db.Exists(agentID) {
+		status, resp := unknownAgentResponse(t.db, agentID)
+		render(c, status, &resp)
+		return
+	}
+
+	// since 为空时保持原有行为：只返回本次计算产生的变化
+	var since *uint64
+	if v := c.Query("since"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			render(c, http.StatusBadRequest, &models.ErrorResponse{
+				Detail: "since must be a non-negative integer",
+			})
+			return
+		}
+		since = &n
+	}
+
+	var routes []models.RouteConfig
+	if s.routeCacheEnabled() {
+		// 缓存模式：返回最近一次重算得到的完整路由集，不在请求路径上运行 Dijkstra
+		s.refreshCachedRoutes(t)
+		routes, _ = t.solver.RoutesSince(agentID, 0)
+	} else {
+		routes = t.solver.ComputeRoutes(t.db, agentID)
+		if routes == nil {
+			routes = []models.RouteConfig{}
+		}
+		s.reqLogger(c).Info("Computed routes",
+			logging.F("agent_id", agentID),
+			logging.F("route_count", len(routes)),
+		)
+		s.audit.Log(t.id, AuditRoutesComputed, agentID, agentID, map[string]interface{}{
+			"route_count": len(routes),
+			"routes":      routes,
 		})
+		s.notifyRouteChanges(t.id, agentID, routes)
+	}
+	t.routeFetches.Record(agentID, time.Now())
+
+	// 流量类别路由和出口整形参数每次返回完整快照，缓存模式下同样取最近一次重算的结果
+	var classes []models.ClassRoutes
+	if s.routeCacheEnabled() {
+		classes = t.cachedClassRoutes(agentID)
+	} else {
+		classes = t.solver.ComputeClassRoutes(t.db, agentID)
+	}
+	var shaping []models.NextHopShaping
+	if policy, ok := t.solver.GetPolicy(agentID); ok {
+		shaping = policy.Shaping
+	}
+
+	if since == nil {
+		render(c, http.StatusOK, &models.RouteResponse{Routes: routes, Classes: classes, Shaping: shaping})
 		return
 	}
 
-	routes := s.solver.ComputeRoutes(s.db, agentID)
-	if routes == nil {
-		routes = []models.RouteConfig{}
+	// 增量模式：返回 since 之后变化的路由，没有变化时返回 304
+	// 配置了流量类别或出口整形时始终返回 200，类别路由表和整形参数随之刷新
+	changed, version := t.solver.RoutesSince(agentID, *since)
+	c.Header(RouteVersionHeader, strconv.FormatUint(version, 10))
+	if len(changed) == 0 && len(classes) == 0 && len(shaping) == 0 {
+		c.Status(http.StatusNotModified)
+		return
 	}
+	render(c, http.StatusOK, &models.RouteResponse{Routes: changed, Version: version, Classes: classes, Shaping: shaping})
+}
 
-	s.logger.Info("Computed routes",
-		logging.F("agent_id", agentID),
-		logging.F("route_count", len(routes)),
-	)
+// RouteHistoryResponse 路由决策历史响应
+type RouteHistoryResponse struct {
+	TenantID string               `json:"tenant_id,omitempty"`
+	Changes  []models.RouteChange `json:"changes"`
+}
 
-	c.JSON(http.StatusOK, models.RouteResponse{Routes: routes})
+// handleRouteHistory 查询路由决策历史，按时间倒序返回
+func (s *Server) handleRouteHistory(c *gin.Context) {
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Detail: "limit must be a non-negative integer",
+			})
+			return
+		}
+		limit = n
+	}
+
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	changes := t.solver.GetHistory().Query(c.Query("agent_id"), limit)
+	c.JSON(http.StatusOK, RouteHistoryResponse{TenantID: t.id, Changes: changes})
+}
+
+// TopologyChangesResponse 拓扑变更日志响应
+type TopologyChangesResponse struct {
+	Changes []models.TopologyChange `json:"changes"`
+}
+
+// handleTopologyChanges 查询租户的拓扑变更日志，按时间倒序返回
+// 可按 agent_id 过滤，since 为 Unix 时间，只返回此后的记录
+func (s *Server) handleTopologyChanges(c *gin.Context) {
+	var limit int
+	var since int64
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Detail: "limit must be a non-negative integer",
+			})
+			return
+		}
+		limit = n
+	}
+	if v := c.Query("since"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Detail: "since must be a non-negative Unix timestamp",
+			})
+			return
+		}
+		since = n
+	}
+
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+	changes := t.changes.Query(c.Query("agent_id"), since, limit)
+	c.JSON(http.StatusOK, TopologyChangesResponse{Changes: changes})
 }
 
 // handleHealth 处理健康检查
@@ -160,11 +677,40 @@ func (s *Server) handleHealth(c *gin.Context) {
 	} else {
 		dbHealth.Details["last_update"] = nil
 	}
+	var nearCapacity []string
+	var evictedAgents, evictedMetrics uint64
+	for _, t := range s.allTenants() {
+		if t.db.NearCapacity() {
+			nearCapacity = append(nearCapacity, t.id)
+		}
+		agents, metrics := t.db.Evictions()
+		evictedAgents += agents
+		evictedMetrics += metrics
+	}
+	_, maxAgents := s.db.Capacity()
+	dbHealth.Details["max_agents"] = maxAgents
+	dbHealth.Details["evicted_agents"] = evictedAgents
+	dbHealth.Details["evicted_metrics"] = evictedMetrics
+	// 接近容量上限时继续服务但报告 degraded，提示扩容或排查伪造的 agent_id
+	if len(nearCapacity) > 0 {
+		dbHealth.Status = models.HealthStatusDegraded
+		dbHealth.Details["near_capacity_tenants"] = nearCapacity
+	}
 	resp.AddComponent("topology_db", dbHealth)
 
 	// Cleaner 状态
 	cleanerHealth := models.NewComponentHealth(models.HealthStatusHealthy)
 	cleanerHealth.Details["cleanup_count"] = s.cleaner.GetCleanupCount()
+	cleanerHealth.Details["runs"] = s.cleaner.RunCount()
+	if run, ok := s.cleaner.LastRun(); ok {
+		cleanerHealth.Details["last_run"] = run.StartedAt.Format(time.RFC3339)
+		cleanerHealth.Details["last_run_duration_ms"] = float64(run.Duration.Microseconds()) / 1000
+		cleanerHealth.Details["last_run_scanned"] = run.Scanned
+		cleanerHealth.Details["last_run_removed"] = run.Removed
+		cleanerHealth.Details["quarantined"] = run.Quarantined
+	} else {
+		cleanerHealth.Details["last_run"] = nil
+	}
 	resp.AddComponent("cleaner", cleanerHealth)
 
 	// 根据整体状态返回 HTTP 状态码
@@ -177,61 +723,244 @@ func (s *Server) handleHealth(c *gin.Context) {
 
 // TopologyNode 拓扑节点信息
 type TopologyNode struct {
-	AgentID     string            `json:"agent_id"`
-	LastSeen    string            `json:"last_seen"`
-	Peers       map[string]Metric `json:"peers"`
+	AgentID   string            `json:"agent_id"`
+	LastSeen  string            `json:"last_seen"`
+	Stale     bool              `json:"stale"`
+	ExpiresAt string            `json:"expires_at"` // 未再上报时数据过期的时间
+	Peers     map[string]Metric `json:"peers"`
+	// Metadata Agent 上报的机器信息（主机名、版本、WireGuard 公钥、隧道地址、公网端点）
+	Metadata *models.AgentMetadata `json:"metadata,omitempty"`
 }
 
 // Metric 指标信息
 type Metric struct {
-	RTT  float64 `json:"rtt_ms"`
-	Loss float64 `json:"loss_rate"`
+	RTT       float64 `json:"rtt_ms"`
+	Loss      float64 `json:"loss_rate"`
+	Jitter    float64 `json:"jitter_ms,omitempty"`
+	Bandwidth float64 `json:"bandwidth_mbps,omitempty"`
+	// Agent 滑动窗口内 RTT 的分位数，Agent 未上报时为 0
+	P50 float64 `json:"rtt_p50_ms,omitempty"`
+	P95 float64 `json:"rtt_p95_ms,omitempty"`
+	P99 float64 `json:"rtt_p99_ms,omitempty"`
+	// HandshakeAgeSec 距最近一次 WireGuard 握手的秒数，Agent 未上报或隧道从未握手时为空
+	HandshakeAgeSec *int64 `json:"handshake_age_sec,omitempty"`
+	// HandshakeNever 隧道从未握手
+	HandshakeNever bool `json:"handshake_never,omitempty"`
+	// RTTStats Controller 保留的最近 RTT 样本的 min/max/p95，没有样本时为空
+	RTTStats *RTTSummary `json:"rtt_stats,omitempty"`
+}
+
+// topologyMetric 将存储的链路数据转换为 API 格式，超时的 RTT 返回 0
+func topologyMetric(m *models.MetricData) Metric {
+	rtt := 0.0
+	if m.RTT != nil {
+		rtt = *m.RTT
+	}
+	return Metric{
+		RTT:       rtt,
+		Loss:      m.Loss,
+		Jitter:    m.Jitter,
+		Bandwidth: m.Bandwidth,
+		P50:       m.P50,
+		P95:       m.P95,
+		P99:       m.P99,
+		RTTStats:  summarizeRTT(m.RTTHistory),
+
+		HandshakeAgeSec: m.HandshakeAgeSec,
+		HandshakeNever:  m.HandshakeNever,
+	}
 }
 
 // TopologyResponse 拓扑响应
 type TopologyResponse struct {
 	NodeCount int            `json:"node_count"`
+	Total     int            `json:"total"`
+	Offset    int            `json:"offset"`
+	Limit     int            `json:"limit,omitempty"`
 	Nodes     []TopologyNode `json:"nodes"`
 }
 
+// topologyFilter 拓扑查询过滤条件
+type topologyFilter struct {
+	agentID string
+	stale   *bool
+	minLoss *float64
+	limit   int
+	offset  int
+}
+
+// parseTopologyFilter 解析拓扑查询参数
+func parseTopologyFilter(c *gin.Context) (*topologyFilter, error) {
+	f := &topologyFilter{agentID: c.Query("agent_id")}
+
+	if v := c.Query("stale"); v != "" {
+		stale, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("stale must be true or false")
+		}
+		f.stale = &stale
+	}
+
+	if v := c.Query("min_loss"); v != "" {
+		minLoss, err := strconv.ParseFloat(v, 64)
+		if err != nil || minLoss < 0 || minLoss > 1 {
+			return nil, fmt.Errorf("min_loss must be a number between 0.0 and 1.0")
+		}
+		f.minLoss = &minLoss
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("limit must be a non-negative integer")
+		}
+		f.limit = limit
+	}
+
+	if v := c.Query("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("offset must be a non-negative integer")
+		}
+		f.offset = offset
+	}
+
+	return f, nil
+}
+
 // handleTopology 处理拓扑查询
+// 支持 agent_id、stale、min_loss 过滤和 limit/offset 分页，结果按 agent_id 排序
 func (s *Server) handleTopology(c *gin.Context) {
-	allData := s.db.GetAll()
-	
+	filter, err := parseTopologyFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: err.Error(),
+		})
+		return
+	}
+
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	allData := t.db.GetAll()
+	now := time.Now()
+	policy := t.cleaner.Policy()
+
 	nodes := make([]TopologyNode, 0, len(allData))
 	for agentID, data := range allData {
+		if filter.agentID != "" && agentID != filter.agentID {
+			continue
+		}
+
+		threshold := policy.For(data)
+		stale := now.Sub(data.Timestamp) > threshold
+		if filter.stale != nil && stale != *filter.stale {
+			continue
+		}
+
 		peers := make(map[string]Metric)
 		for targetIP, metric := range data.Metrics {
-			rtt := 0.0
-			if metric.RTT != nil {
-				rtt = *metric.RTT
-			}
-			peers[targetIP] = Metric{
-				RTT:  rtt,
-				Loss: metric.Loss,
+			if filter.minLoss != nil && metric.Loss < *filter.minLoss {
+				continue
 			}
+			peers[targetIP] = topologyMetric(metric)
+		}
+
+		// min_loss 过滤后没有匹配链路的节点不返回
+		if filter.minLoss != nil && len(peers) == 0 {
+			continue
 		}
-		
+
 		nodes = append(nodes, TopologyNode{
-			AgentID:  agentID,
-			LastSeen: data.Timestamp.Format(time.RFC3339),
-			Peers:    peers,
+			AgentID:   agentID,
+			LastSeen:  data.Timestamp.Format(time.RFC3339),
+			Stale:     stale,
+			ExpiresAt: data.Timestamp.Add(threshold).Format(time.RFC3339),
+			Peers:     peers,
+			Metadata:  data.Metadata,
 		})
 	}
-	
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].AgentID < nodes[j].AgentID
+	})
+
+	total := len(nodes)
+	if filter.offset >= total {
+		nodes = nodes[:0]
+	} else {
+		nodes = nodes[filter.offset:]
+	}
+	if filter.limit > 0 && len(nodes) > filter.limit {
+		nodes = nodes[:filter.limit]
+	}
+
 	c.JSON(http.StatusOK, TopologyResponse{
 		NodeCount: len(nodes),
+		Total:     total,
+		Offset:    filter.offset,
+		Limit:     filter.limit,
 		Nodes:     nodes,
 	})
 }
 
-// Run 启动服务器
+// Run 启动服务器，阻塞直到出错或 Stop 被调用；被 Stop 关闭时返回 nil
 func (s *Server) Run() error {
 	addr := fmt.Sprintf("%s:%d", s.cfg.Server.ListenAddress, s.cfg.Server.Port)
+	tlsCfg := s.cfg.Server.TLS
+	srv := &http.Server{Addr: addr, Handler: s.router}
+
+	s.httpMu.Lock()
+	s.httpServer = srv
+	s.httpMu.Unlock()
+
 	s.logger.Info("Controller starting",
 		logging.F("address", addr),
+		logging.F("tls", tlsCfg.Enabled()),
 	)
-	return s.router.Run(addr)
+	var err error
+	if tlsCfg.Enabled() {
+		err = srv.ListenAndServeTLS(tlsCfg.CertFile, tlsCfg.KeyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Stop 优雅关闭：先让 /readyz 返回 503 并等待 server.shutdown_delay，再停止接受新连接，
+// 结束路由流和事件流订阅，等待进行中的请求在 ctx 内完成，然后执行 Shutdown（持久化后端在其中最后写入一次状态）
+func (s *Server) Stop(ctx context.Context) error {
+	atomic.StoreInt32(&s.shuttingDown, 1)
+	if delay := s.cfg.Server.ShutdownDelay; delay > 0 {
+		s.logger.Info("Draining before shutdown", logging.F("shutdown_delay", delay.String()))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	s.httpMu.Lock()
+	srv := s.httpServer
+	s.httpMu.Unlock()
+
+	var err error
+	if srv != nil {
+		done := make(chan error, 1)
+		go func() { done <- srv.Shutdown(ctx) }()
+		// 长连接的流订阅不会自行结束，关闭广播中心让处理函数返回
+		for _, t := range s.allTenants() {
+			t.streams.Close()
+		}
+		s.events.Close()
+		err = <-done
+	}
+	s.Shutdown()
+	return err
 }
 
 // GetDB 获取拓扑数据库（用于测试）
@@ -244,11 +973,40 @@ func (s *Server) GetSolver() *RouteSolver {
 	return s.solver
 }
 
-// Shutdown 关闭服务器，停止清理器
+// Shutdown 关闭服务器，停止清理器等后台任务，可重复调用
 func (s *Server) Shutdown() {
+	s.shutdownOnce.Do(s.shutdown)
+}
+
+// shutdown 见 Shutdown
+func (s *Server) shutdown() {
+	atomic.StoreInt32(&s.shuttingDown, 1)
 	if s.cleaner != nil {
 		s.cleaner.Stop()
 	}
+	if s.replicator != nil {
+		s.replicator.Stop()
+	}
+	if s.persister != nil {
+		s.persister.Stop()
+	}
+	if s.shared != nil {
+		s.shared.Stop()
+	}
+	for _, t := range s.allTenants() {
+		t.pusher.Stop()
+		if t.id == models.DefaultTenantID {
+			continue
+		}
+		t.cleaner.Stop()
+		t.streams.Close()
+	}
+	s.streams.Close()
+	s.events.Close()
+	s.webhooks.Close()
+	if err := s.audit.Close(); err != nil {
+		s.logger.Error("Failed to close audit log", logging.F("error", err.Error()))
+	}
 }
 
 // GetCleaner 获取清理器（用于测试）
@@ -0,0 +1,1095 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// newTestServer 创建使用默认配置的测试服务器
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	cfg := &config.ControllerConfig{
+		Server:    config.ServerConfig{ListenAddress: "127.0.0.1", Port: 8000},
+		Algorithm: config.AlgorithmConfig{PenaltyFactor: 100, Hysteresis: 0.15, DegradationThreshold: 0.5},
+		Topology: config.TopologyConfig{
+			StaleThreshold:     60 * time.Second,
+			IntervalMultiplier: 3,
+			TombstoneTTL:       time.Hour,
+			Retention:          config.RetentionConfig{MaxPoints: 60},
+		},
+		Tenants: config.TenantsConfig{MaxTenants: 100},
+		Logging: config.LoggingConfig{Level: "ERROR"},
+	}
+	s, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+// doRequest 向测试服务器发送请求并返回响应
+func doRequest(s *Server, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, target, nil)
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandleTopologyFilterAndPagination(t *testing.T) {
+	s := newTestServer(t)
+
+	now := time.Now().Unix()
+	for _, id := range []string{"C", "A", "B"} {
+		s.db.Store(&models.TelemetryRequest{
+			AgentID:   id,
+			Timestamp: now,
+			Metrics: []models.Metric{
+				{TargetIP: "X", RTTMs: ptrFloat64(10), LossRate: 0},
+				{TargetIP: "Y", RTTMs: ptrFloat64(20), LossRate: 0.3},
+			},
+		})
+	}
+	s.db.Store(&models.TelemetryRequest{
+		AgentID:   "D",
+		Timestamp: now - 3600,
+		Metrics:   []models.Metric{{TargetIP: "X", RTTMs: ptrFloat64(10), LossRate: 0}},
+	})
+
+	tests := []struct {
+		name      string
+		query     string
+		wantIDs   []string
+		wantTotal int
+	}{
+		{"all sorted", "", []string{"A", "B", "C", "D"}, 4},
+		{"by agent", "?agent_id=B", []string{"B"}, 1},
+		{"stale only", "?stale=true", []string{"D"}, 1},
+		{"fresh only", "?stale=false", []string{"A", "B", "C"}, 3},
+		{"min loss", "?min_loss=0.2", []string{"A", "B", "C"}, 3},
+		{"paginated", "?limit=2&offset=1", []string{"B", "C"}, 4},
+		{"offset past end", "?offset=10", []string{}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(s, http.MethodGet, "/api/v1/topology"+tt.query)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Status = %d, want 200: %s", w.Code, w.Body.String())
+			}
+
+			var resp TopologyResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if resp.Total != tt.wantTotal {
+				t.Errorf("Total = %d, want %d", resp.Total, tt.wantTotal)
+			}
+			if len(resp.Nodes) != len(tt.wantIDs) {
+				t.Fatalf("Got %d nodes, want %d", len(resp.Nodes), len(tt.wantIDs))
+			}
+			for i, id := range tt.wantIDs {
+				if resp.Nodes[i].AgentID != id {
+					t.Errorf("Node %d = %s, want %s", i, resp.Nodes[i].AgentID, id)
+				}
+			}
+		})
+	}
+
+	// min_loss 只保留满足条件的链路
+	w := doRequest(s, http.MethodGet, "/api/v1/topology?agent_id=A&min_loss=0.2")
+	var resp TopologyResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Nodes) != 1 || len(resp.Nodes[0].Peers) != 1 {
+		t.Errorf("min_loss should keep only lossy peers, got %+v", resp.Nodes)
+	}
+}
+
+func TestHandleTopologyMetadata(t *testing.T) {
+	s := newTestServer(t)
+
+	meta := &models.AgentMetadata{
+		Hostname:  "edge-1",
+		Version:   "1.2.0",
+		PublicKey: "bXlwdWJsaWNrZXk=",
+		TunnelIP:  "10.254.0.1",
+		Endpoint:  "203.0.113.5:51820",
+	}
+	now := time.Now().Unix()
+	postTelemetry(t, s, models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: now - 10,
+		Metrics:   []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(10)}},
+		Metadata:  meta,
+	})
+	// 后续上报未携带机器信息时保留之前的信息
+	postTelemetry(t, s, models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: now,
+		Metrics:   []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(12)}},
+	})
+
+	w := doRequest(s, http.MethodGet, "/api/v1/topology?agent_id=A")
+	var resp TopologyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Nodes) != 1 || !reflect.DeepEqual(resp.Nodes[0].Metadata, meta) {
+		t.Errorf("nodes = %+v, want metadata %+v", resp.Nodes, meta)
+	}
+
+	// 格式错误的机器信息被拒绝
+	body := `{"agent_id":"A","timestamp":1703830000,"metrics":[{"target_ip":"B","rtt_ms":1,"loss_rate":0}],"metadata":{"tunnel_ip":"not-an-ip"}}`
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/telemetry", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid metadata: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestHandleTopologyHandshake(t *testing.T) {
+	s := newTestServer(t)
+	postTelemetry(t, s, models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: time.Now().Unix(),
+		Metrics: []models.Metric{
+			{TargetIP: "B", RTTMs: ptrFloat64(10), HandshakeAgeSec: ptrInt64(30)},
+			{TargetIP: "C", RTTMs: nil, LossRate: 1, HandshakeNever: true},
+		},
+	})
+
+	w := doRequest(s, http.MethodGet, "/api/v1/topology?agent_id=A")
+	var resp struct {
+		Nodes []struct {
+			Peers map[string]map[string]any `json:"peers"`
+		} `json:"nodes"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Nodes) != 1 {
+		t.Fatalf("decode response: %v, body %s", err, w.Body.String())
+	}
+	peers := resp.Nodes[0].Peers
+	if b := peers["B"]; b["handshake_age_sec"] != 30.0 || b["handshake_never"] != nil {
+		t.Errorf("peer B = %v", b)
+	}
+	// 从未握手的链路不返回握手间隔
+	if c := peers["C"]; c["handshake_never"] != true || c["handshake_age_sec"] != nil {
+		t.Errorf("peer C = %v", c)
+	}
+}
+
+func TestHandleReporters(t *testing.T) {
+	s := newTestServer(t)
+
+	now := time.Now().Unix()
+	s.db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: now, Metrics: []models.Metric{
+		{TargetIP: "X", RTTMs: ptrFloat64(30)},
+	}})
+	s.db.Store(&models.TelemetryRequest{AgentID: "B", Timestamp: now, Metrics: []models.Metric{
+		{TargetIP: "X", RTTMs: nil, LossRate: 1},
+	}})
+	s.db.Store(&models.TelemetryRequest{AgentID: "C", Timestamp: now, Metrics: []models.Metric{
+		{TargetIP: "X", RTTMs: ptrFloat64(10)},
+		{TargetIP: "Y", RTTMs: ptrFloat64(5)},
+	}})
+	s.db.Store(&models.TelemetryRequest{AgentID: "D", Timestamp: now, Metrics: []models.Metric{
+		{TargetIP: "Y", RTTMs: ptrFloat64(5)},
+	}})
+
+	w := doRequest(s, http.MethodGet, "/api/v1/topology/reporters?target_ip=X")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp ReportersResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	// 可达的按 RTT 升序在前，不可达的在后
+	var got []string
+	for _, r := range resp.Reporters {
+		got = append(got, r.AgentID)
+	}
+	if resp.Count != 3 || !reflect.DeepEqual(got, []string{"C", "A", "B"}) {
+		t.Errorf("reporters = %v, want [C A B]", got)
+	}
+	if resp.Reporters[2].Reachable {
+		t.Error("B should not be reachable")
+	}
+
+	if w := doRequest(s, http.MethodGet, "/api/v1/topology/reporters"); w.Code != http.StatusBadRequest {
+		t.Errorf("missing target_ip: status = %d, want 400", w.Code)
+	}
+}
+
+func TestStaleAgentTombstone(t *testing.T) {
+	s := newTestServer(t)
+
+	meta := &models.AgentMetadata{Hostname: "edge-1"}
+	s.db.Store(&models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: time.Now().Add(-time.Hour).Unix(),
+		Metrics:   []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(10)}},
+		Metadata:  meta,
+	})
+	if removed := s.db.CleanStale(time.Minute); removed != 1 {
+		t.Fatalf("CleanStale() = %d, want 1", removed)
+	}
+
+	// 过期被清理的 Agent 返回 410，从未上报过的返回 404
+	if w := doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A"); w.Code != http.StatusGone {
+		t.Errorf("stale agent: status = %d, want 410", w.Code)
+	}
+	if w := doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=Z"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown agent: status = %d, want 404", w.Code)
+	}
+
+	w := doRequest(s, http.MethodGet, "/api/v1/agents")
+	var resp AgentListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Count != 0 || len(resp.Removed) != 1 || resp.Removed[0].AgentID != "A" ||
+		!reflect.DeepEqual(resp.Removed[0].Metadata, meta) {
+		t.Errorf("agents = %+v, want A only in removed with its metadata", resp)
+	}
+
+	// 重新上报后记录消失
+	s.db.Store(&models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: time.Now().Unix(),
+		Metrics:   []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(10)}},
+	})
+	if _, ok := s.db.Tombstone("A"); ok {
+		t.Error("tombstone should be cleared after the agent reports again")
+	}
+	if w := doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A"); w.Code != http.StatusOK {
+		t.Errorf("returning agent: status = %d, want 200", w.Code)
+	}
+}
+
+func TestTopologyExportImport(t *testing.T) {
+	s := newTestServer(t)
+
+	now := time.Now().Unix()
+	s.db.Store(&models.TelemetryRequest{AgentID: "B", Timestamp: now, Metrics: []models.Metric{
+		{TargetIP: "A", RTTMs: nil, LossRate: 1},
+	}})
+	s.db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: now, Metadata: &models.AgentMetadata{Hostname: "edge-a"}, Metrics: []models.Metric{
+		{TargetIP: "B", RTTMs: ptrFloat64(12.5), JitterMs: 1.5, BandwidthMbps: 100},
+	}})
+
+	w := doRequest(s, http.MethodGet, "/api/v1/topology/export")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != yamlContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, yamlContentType)
+	}
+	exported := w.Body.Bytes()
+	for _, want := range []string{"agent_id: A", "hostname: edge-a", "target: B", "rtt_ms: 12.5", "loss_rate: 1"} {
+		if !strings.Contains(string(exported), want) {
+			t.Errorf("export missing %q:\n%s", want, exported)
+		}
+	}
+
+	// 导入到另一个 Controller 后再导出，节点和链路保持一致
+	path := filepath.Join(t.TempDir(), "topology.yaml")
+	if err := os.WriteFile(path, exported, 0o600); err != nil {
+		t.Fatalf("failed to write topology: %v", err)
+	}
+	other := newTestServer(t)
+	if n, err := other.ImportTopologyFile(path); err != nil || n != 2 {
+		t.Fatalf("ImportTopologyFile() = (%d, %v), want (2, nil)", n, err)
+	}
+	if !reflect.DeepEqual(exportTopology(other.tenants[""]).Nodes, exportTopology(s.tenants[""]).Nodes) {
+		t.Errorf("imported topology differs from the exported one")
+	}
+
+	// 任一节点无效时不写入任何数据
+	bad := &TopologyExport{TenantID: "lab", Nodes: []ExportNode{
+		{AgentID: "X", Links: []ExportLink{{Target: "Y", RTTMs: ptrFloat64(1)}}},
+		{AgentID: "Y", Links: []ExportLink{{Target: "X", LossRate: 2}}},
+	}}
+	if _, err := other.ImportTopology(bad); err == nil {
+		t.Error("ImportTopology() should reject invalid loss_rate")
+	}
+	if _, ok := other.lookupTenant("lab"); ok {
+		t.Error("failed import should not create the tenant")
+	}
+
+	if err := os.WriteFile(path, []byte("nodes:\n  - agent_id: A\n    link: []\n"), 0o600); err != nil {
+		t.Fatalf("failed to write topology: %v", err)
+	}
+	if _, err := other.ImportTopologyFile(path); err == nil {
+		t.Error("ImportTopologyFile() should reject unknown fields")
+	}
+}
+
+func TestHandleTopologyInvalidQuery(t *testing.T) {
+	s := newTestServer(t)
+
+	for _, q := range []string{"?stale=maybe", "?min_loss=2", "?limit=-1", "?offset=x"} {
+		w := doRequest(s, http.MethodGet, "/api/v1/topology"+q)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Query %s: status = %d, want 400", q, w.Code)
+		}
+	}
+}
+
+func TestAPIv2Protobuf(t *testing.T) {
+	s := newTestServer(t)
+
+	telemetry := &models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: time.Now().Unix(),
+		Metrics:   []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(10), LossRate: 0}},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/telemetry", bytes.NewReader(telemetry.MarshalProto()))
+	req.Header.Set("Content-Type", models.ContentTypeProtobuf)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Telemetry status = %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != models.ContentTypeProtobuf {
+		t.Errorf("Telemetry response Content-Type = %q, want protobuf", ct)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v2/routes?agent_id=A", nil)
+	req.Header.Set("Accept", models.ContentTypeProtobuf)
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	var routes models.RouteResponse
+	if err := routes.UnmarshalProto(w.Body.Bytes()); err != nil {
+		t.Fatalf("Failed to decode protobuf routes: %v", err)
+	}
+	if len(routes.Routes) != 1 || routes.Routes[0].DstCIDR != "B/32" {
+		t.Errorf("Routes = %+v, want one route to B", routes.Routes)
+	}
+
+	// 未请求 protobuf 时回退到 JSON
+	w = doRequest(s, http.MethodGet, "/api/v2/routes?agent_id=A")
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Fallback Content-Type = %q, want JSON", ct)
+	}
+}
+
+func TestHandleStats(t *testing.T) {
+	s := newTestServer(t)
+
+	now := time.Now().Unix()
+	s.db.Store(&models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: now,
+		Metrics: []models.Metric{
+			{TargetIP: "B", RTTMs: ptrFloat64(10), LossRate: 0},
+			{TargetIP: "C", RTTMs: nil, LossRate: 1},
+		},
+	})
+	s.db.Store(&models.TelemetryRequest{
+		AgentID:   "B",
+		Timestamp: now,
+		Metrics: []models.Metric{
+			{TargetIP: "A", RTTMs: ptrFloat64(30), LossRate: 0.2},
+			{TargetIP: "C", RTTMs: ptrFloat64(20), LossRate: 0},
+		},
+	})
+
+	// A 到 C 的直连不通，经由 B 中继；其余路由直连
+	s.solver.ComputeRoutes(s.db, "A")
+	s.solver.ComputeRoutes(s.db, "B")
+
+	history := s.solver.GetHistory()
+	// 首次下发不算抖动
+	history.Record(models.RouteChange{Source: "A", Target: "C", NewNextHop: "direct", Timestamp: now - 60})
+	history.Record(models.RouteChange{Source: "A", Target: "C", OldNextHop: "direct", NewNextHop: "B", Timestamp: now - 30})
+	// 超出时间窗口
+	history.Record(models.RouteChange{Source: "B", Target: "C", OldNextHop: "A", NewNextHop: "direct", Timestamp: now - 7200})
+
+	w := doRequest(s, http.MethodGet, "/api/v1/stats")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	var resp StatsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if resp.AgentCount != 2 {
+		t.Errorf("AgentCount = %d, want 2", resp.AgentCount)
+	}
+	if resp.LinksUp != 3 || resp.LinksDown != 1 {
+		t.Errorf("links up/down = %d/%d, want 3/1", resp.LinksUp, resp.LinksDown)
+	}
+	wantRTT := map[string]float64{"A->B": 10, "B->A": 30, "B->C": 20}
+	if !reflect.DeepEqual(resp.AvgLinkRTTMs, wantRTT) {
+		t.Errorf("AvgLinkRTTMs = %v, want %v", resp.AvgLinkRTTMs, wantRTT)
+	}
+	if resp.DirectRoutes != 3 || resp.RelayedRoutes != 1 {
+		t.Errorf("direct/relayed = %d/%d, want 3/1", resp.DirectRoutes, resp.RelayedRoutes)
+	}
+	if resp.RouteFlaps1h != 1 {
+		t.Errorf("RouteFlaps1h = %d, want 1", resp.RouteFlaps1h)
+	}
+	w = doRequest(s, http.MethodGet, "/metrics")
+	if want := `sdwan_link_avg_rtt_ms{source="B",target="A"} 30`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("metrics missing %q:\n%s", want, w.Body.String())
+	}
+}
+
+func TestStatsAndRouteHistoryPerTenant(t *testing.T) {
+	s := newTestServer(t)
+	now := time.Now().Unix()
+	postTelemetry(t, s, models.TelemetryRequest{AgentID: "A", Timestamp: now, Metrics: []models.Metric{
+		{TargetIP: "B", RTTMs: ptrFloat64(10)},
+	}})
+	postTelemetry(t, s, models.TelemetryRequest{AgentID: "X", TenantID: "acme", Timestamp: now, Metrics: []models.Metric{
+		{TargetIP: "Y", RTTMs: ptrFloat64(10)},
+		{TargetIP: "Z", RTTMs: ptrFloat64(20)},
+	}})
+	acme, _ := s.lookupTenant("acme")
+	acme.solver.GetHistory().Record(models.RouteChange{Source: "X", Target: "Z", NewNextHop: "Y", Timestamp: now})
+
+	var stats StatsResponse
+	w := doRequest(s, http.MethodGet, "/api/v1/stats?tenant_id=acme")
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("stats status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if stats.TenantID != "acme" || stats.AgentCount != 1 || stats.LinksUp != 2 {
+		t.Errorf("acme stats = %+v, want 1 agent with 2 links", stats)
+	}
+	w = doRequest(s, http.MethodGet, "/api/v1/stats")
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil || stats.AgentCount != 1 || stats.LinksUp != 1 {
+		t.Errorf("default tenant stats = %+v, want 1 agent with 1 link", stats)
+	}
+
+	var history RouteHistoryResponse
+	w = doRequest(s, http.MethodGet, "/api/v1/routes/history?tenant_id=acme")
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("history status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if len(history.Changes) != 1 || history.Changes[0].Source != "X" {
+		t.Errorf("acme history = %+v, want the X->Z change", history.Changes)
+	}
+	w = doRequest(s, http.MethodGet, "/api/v1/routes/history")
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil || len(history.Changes) != 0 {
+		t.Errorf("default tenant history = %+v, want none", history.Changes)
+	}
+
+	for _, path := range []string{"/api/v1/stats?tenant_id=missing", "/api/v1/routes/history?tenant_id=missing"} {
+		if w := doRequest(s, http.MethodGet, path); w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestHandleRouteStability(t *testing.T) {
+	s := newTestServer(t)
+
+	now := time.Now()
+	stability := s.solver.GetStability()
+	stability.Record("A", "C", now.Add(-2*time.Hour))
+	stability.Record("A", "C", now.Add(-time.Minute))
+	stability.Record("B", "C", now.Add(-10*time.Minute))
+	stability.Record("B", "C", now.Add(-5*time.Minute))
+	// 超出一天的统计窗口，只计入累计值
+	stability.Record("B", "D", now.Add(-25*time.Hour))
+
+	w := doRequest(s, http.MethodGet, "/api/v1/stats/routes")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	var resp RouteStabilityResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	want := []RouteStabilityEntry{
+		{Source: "B", Target: "C", Changes1h: 2, Changes24h: 2, TotalChanges: 2, LastChange: now.Add(-5 * time.Minute).Unix()},
+		{Source: "A", Target: "C", Changes1h: 1, Changes24h: 2, TotalChanges: 2, LastChange: now.Add(-time.Minute).Unix()},
+		{Source: "B", Target: "D", TotalChanges: 1},
+	}
+	if !reflect.DeepEqual(resp.Routes, want) {
+		t.Errorf("Routes = %+v, want %+v", resp.Routes, want)
+	}
+
+	w = doRequest(s, http.MethodGet, "/api/v1/stats/routes?agent_id=A&limit=1")
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Routes) != 1 || resp.Routes[0].Source != "A" {
+		t.Errorf("filtered Routes = %+v, want only A->C", resp.Routes)
+	}
+
+	w = doRequest(s, http.MethodGet, "/metrics")
+	if w.Code != http.StatusOK {
+		t.Fatalf("metrics status = %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != prometheusContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, prometheusContentType)
+	}
+	for _, line := range []string{
+		`sdwan_route_changes_total{tenant_id="",source="A",target="C"} 2`,
+		`sdwan_route_changes_1h{tenant_id="",source="B",target="C"} 2`,
+		`sdwan_route_changes_24h{tenant_id="",source="B",target="D"} 0`,
+		"# TYPE sdwan_route_changes_total counter",
+		"sdwan_agents 0",
+	} {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Errorf("metrics missing %q:\n%s", line, w.Body.String())
+		}
+	}
+}
+
+func TestHandleListAgents(t *testing.T) {
+	s := newTestServer(t)
+
+	now := time.Now().Unix()
+	for _, id := range []string{"B", "A"} {
+		s.db.Store(&models.TelemetryRequest{AgentID: id, Timestamp: now})
+	}
+	s.db.Store(&models.TelemetryRequest{AgentID: "C", Timestamp: now - 3600})
+
+	// A 拉取过路由，C 虽然拉取过但已过期
+	if w := doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A"); w.Code != http.StatusOK {
+		t.Fatalf("GET /routes status = %d", w.Code)
+	}
+	s.routeFetches.Record("C", time.Now())
+
+	w := doRequest(s, http.MethodGet, "/api/v1/agents")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	var resp AgentListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Count != 3 {
+		t.Fatalf("Count = %d, want 3", resp.Count)
+	}
+
+	want := map[string]struct{ stale, served bool }{
+		"A": {false, true},
+		"B": {false, false},
+		"C": {true, false},
+	}
+	for i, agent := range resp.Agents {
+		if wantID := []string{"A", "B", "C"}[i]; agent.AgentID != wantID {
+			t.Errorf("Agents[%d].AgentID = %s, want %s", i, agent.AgentID, wantID)
+		}
+		exp := want[agent.AgentID]
+		if agent.Stale != exp.stale || agent.RoutesServed != exp.served {
+			t.Errorf("%s: stale=%v served=%v, want stale=%v served=%v",
+				agent.AgentID, agent.Stale, agent.RoutesServed, exp.stale, exp.served)
+		}
+	}
+}
+
+func TestHandleGetRoutesSince(t *testing.T) {
+	s := newTestServer(t)
+
+	now := time.Now().Unix()
+	store := func(id string, metrics ...models.Metric) {
+		s.db.Store(&models.TelemetryRequest{AgentID: id, Timestamp: now, Metrics: metrics})
+	}
+	store("A", models.Metric{TargetIP: "B", RTTMs: ptrFloat64(10)}, models.Metric{TargetIP: "C", RTTMs: ptrFloat64(100)})
+	store("B", models.Metric{TargetIP: "A", RTTMs: ptrFloat64(10)}, models.Metric{TargetIP: "C", RTTMs: ptrFloat64(100)})
+	store("C", models.Metric{TargetIP: "A", RTTMs: ptrFloat64(100)}, models.Metric{TargetIP: "B", RTTMs: ptrFloat64(100)})
+
+	decode := func(w *httptest.ResponseRecorder) models.RouteResponse {
+		t.Helper()
+		var resp models.RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	// 完整路由集
+	w := doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A&since=0")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	full := decode(w)
+	if len(full.Routes) != 2 || full.Version != 1 {
+		t.Fatalf("full = %+v, want 2 routes at version 1", full)
+	}
+
+	// 无变化
+	w = doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A&since=1")
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("status = %d, want 304", w.Code)
+	}
+	if got := w.Header().Get(RouteVersionHeader); got != "1" {
+		t.Errorf("%s = %q, want 1", RouteVersionHeader, got)
+	}
+
+	// A->C 经 B 中继更优，只返回变化的路由
+	store("B", models.Metric{TargetIP: "A", RTTMs: ptrFloat64(10)}, models.Metric{TargetIP: "C", RTTMs: ptrFloat64(10)})
+	w = doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A&since=1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	delta := decode(w)
+	if len(delta.Routes) != 1 || delta.Routes[0].DstCIDR != "C/32" || delta.Routes[0].NextHop != "B" || delta.Version != 2 {
+		t.Errorf("delta = %+v, want C/32 via B at version 2", delta)
+	}
+
+	// 版本号超前（Controller 重启）时返回完整路由集
+	w = doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A&since=99")
+	if resp := decode(w); len(resp.Routes) != 2 {
+		t.Errorf("since beyond current version returned %d routes, want 2", len(resp.Routes))
+	}
+
+	w = doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A&since=abc")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid since status = %d, want 400", w.Code)
+	}
+}
+
+func TestHandleGetRoutesShaping(t *testing.T) {
+	s := newTestServer(t)
+
+	now := time.Now().Unix()
+	s.db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: now, Metrics: []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(10)}}})
+	s.db.Store(&models.TelemetryRequest{AgentID: "B", Timestamp: now, Metrics: []models.Metric{{TargetIP: "A", RTTMs: ptrFloat64(10)}}})
+
+	if w := doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A&since=0"); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A&since=1"); w.Code != http.StatusNotModified {
+		t.Fatalf("status = %d, want 304", w.Code)
+	}
+
+	// 配置了出口整形时增量请求也返回完整的整形参数
+	shaping := []models.NextHopShaping{{NextHop: "10.254.0.2", RateMbps: 50, Priority: models.ShapingPriorityLow}}
+	s.solver.SetPolicy(models.RoutePolicy{AgentID: "A", Shaping: shaping})
+	w := doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A&since=1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	w = doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A&since="+w.Header().Get(RouteVersionHeader))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp models.RouteResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Routes) != 0 || !reflect.DeepEqual(resp.Shaping, shaping) {
+		t.Errorf("resp = %+v, want no routes and shaping %+v", resp, shaping)
+	}
+}
+
+func TestHealthzAndReadyz(t *testing.T) {
+	s := newTestServer(t)
+
+	if w := doRequest(s, http.MethodGet, "/healthz"); w.Code != http.StatusOK {
+		t.Errorf("/healthz status = %d, want 200", w.Code)
+	}
+	if w := doRequest(s, http.MethodGet, "/readyz"); w.Code != http.StatusOK {
+		t.Errorf("/readyz status = %d, want 200, body = %s", w.Code, w.Body.String())
+	}
+
+	// 进入关闭流程后不再就绪，但仍然存活
+	atomic.StoreInt32(&s.shuttingDown, 1)
+	w := doRequest(s, http.MethodGet, "/readyz")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz status after shutdown = %d, want 503", w.Code)
+	}
+	var resp models.DetailedHealthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Components["server"].Status != models.HealthStatusUnhealthy {
+		t.Errorf("server component = %+v, want unhealthy", resp.Components["server"])
+	}
+	if w := doRequest(s, http.MethodGet, "/healthz"); w.Code != http.StatusOK {
+		t.Errorf("/healthz status after shutdown = %d, want 200", w.Code)
+	}
+}
+
+func TestStopMarksNotReadyBeforeClosing(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Server.ShutdownDelay = 200 * time.Millisecond
+
+	done := make(chan error, 1)
+	go func() { done <- s.Stop(context.Background()) }()
+
+	// 等待期间仍处理请求，但 /readyz 已返回 503
+	deadline := time.Now().Add(time.Second)
+	for doRequest(s, http.MethodGet, "/readyz").Code != http.StatusServiceUnavailable {
+		if time.Now().After(deadline) {
+			t.Fatal("/readyz still ready after Stop began")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	select {
+	case <-done:
+		t.Fatal("Stop returned before shutdown_delay elapsed")
+	default:
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+}
+
+func TestReadyzPersistence(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	cfg := *newTestServer(t).cfg
+	cfg.Storage = config.StorageConfig{Backend: config.StorageBackendFile, Path: filepath.Join(dir, "state.json"), FlushInterval: time.Hour}
+	s, err := NewServer(&cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer s.Shutdown()
+
+	if w := doRequest(s, http.MethodGet, "/readyz"); w.Code != http.StatusOK {
+		t.Fatalf("/readyz status = %d, want 200, body = %s", w.Code, w.Body.String())
+	}
+
+	// 状态目录消失后写入失败，实例不再就绪
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	s.db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: time.Now().Unix()})
+	if err := s.persister.Save(); err == nil {
+		t.Fatal("Save() into a removed directory should fail")
+	}
+	w := doRequest(s, http.MethodGet, "/readyz")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("/readyz status = %d, want 503", w.Code)
+	}
+	var resp models.DetailedHealthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Components["persistence"].Status != models.HealthStatusUnhealthy {
+		t.Errorf("persistence component = %+v, want unhealthy", resp.Components["persistence"])
+	}
+
+	// 目录恢复后下一次写入成功，重新就绪
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.persister.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if w := doRequest(s, http.MethodGet, "/readyz"); w.Code != http.StatusOK {
+		t.Errorf("/readyz status after recovery = %d, want 200", w.Code)
+	}
+}
+
+func TestHandleTopologyChanges(t *testing.T) {
+	s := newTestServer(t)
+
+	now := time.Now().Unix()
+	s.db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: now, Metrics: []models.Metric{
+		{TargetIP: "B", RTTMs: ptrFloat64(10)},
+		{TargetIP: "C", RTTMs: ptrFloat64(20)},
+	}})
+	// 只有指标变化的更新不记录
+	s.db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: now, Metrics: []models.Metric{
+		{TargetIP: "B", RTTMs: ptrFloat64(11)},
+		{TargetIP: "C", RTTMs: ptrFloat64(21)},
+	}})
+	s.db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: now, Metrics: []models.Metric{
+		{TargetIP: "B", RTTMs: ptrFloat64(12)},
+		{TargetIP: "D", RTTMs: ptrFloat64(30)},
+	}})
+	s.db.StoreAs(&models.TelemetryRequest{AgentID: "E", Timestamp: now - 600}, ActorImport)
+	s.cleaner.cleanOnce()
+
+	w := doRequest(s, http.MethodGet, "/api/v1/topology/changes")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp TopologyChangesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ typ, agent, actor string }{
+		{ChangeAgentRemoved, "E", ActorCleaner},
+		{ChangeAgentJoined, "E", ActorImport},
+		{ChangeLinksChanged, "A", "A"},
+		{ChangeAgentJoined, "A", "A"},
+	}
+	if len(resp.Changes) != len(want) {
+		t.Fatalf("changes = %+v, want %d entries", resp.Changes, len(want))
+	}
+	for i, w := range want {
+		got := resp.Changes[i]
+		if got.Type != w.typ || got.AgentID != w.agent || got.Actor != w.actor {
+			t.Errorf("changes[%d] = %s/%s/%s, want %s/%s/%s", i, got.Type, got.AgentID, got.Actor, w.typ, w.agent, w.actor)
+		}
+	}
+	if got := resp.Changes[2]; !reflect.DeepEqual(got.AddedLinks, []string{"D"}) || !reflect.DeepEqual(got.RemovedLinks, []string{"C"}) {
+		t.Errorf("links change = +%v -%v, want +[D] -[C]", got.AddedLinks, got.RemovedLinks)
+	}
+	if resp.Changes[0].Reason == "" {
+		t.Error("removal should record the last report time")
+	}
+
+	w = doRequest(s, http.MethodGet, "/api/v1/topology/changes?agent_id=A&limit=1")
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Changes) != 1 || resp.Changes[0].Type != ChangeLinksChanged {
+		t.Errorf("filtered changes = %+v", resp.Changes)
+	}
+
+	if w := doRequest(s, http.MethodGet, "/api/v1/topology/changes?since=x"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid since status = %d, want 400", w.Code)
+	}
+}
+
+func TestCleanerRunStats(t *testing.T) {
+	s := newTestServer(t)
+
+	now := time.Now().Unix()
+	s.db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: now})
+	s.db.Store(&models.TelemetryRequest{AgentID: "B", Timestamp: now - 3600})
+	if _, ok := s.cleaner.LastRun(); ok {
+		t.Fatal("LastRun reported before any run")
+	}
+	s.cleaner.cleanOnce()
+
+	run, ok := s.cleaner.LastRun()
+	if !ok || run.Scanned != 2 || run.Removed != 1 || s.cleaner.RunCount() != 1 {
+		t.Errorf("LastRun = %+v (ok=%v), runs = %d, want 2 scanned, 1 removed, 1 run", run, ok, s.cleaner.RunCount())
+	}
+
+	var health models.DetailedHealthResponse
+	w := doRequest(s, http.MethodGet, "/health")
+	if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	details := health.Components["cleaner"].Details
+	if details["last_run_removed"] != float64(1) || details["runs"] != float64(1) {
+		t.Errorf("cleaner health details = %v", details)
+	}
+
+	w = doRequest(s, http.MethodGet, "/metrics")
+	for _, line := range []string{
+		`sdwan_cleaner_runs_total{tenant_id=""} 1`,
+		`sdwan_cleaner_removed_agents_total{tenant_id=""} 1`,
+		`sdwan_cleaner_last_run_scanned_agents{tenant_id=""} 2`,
+		`sdwan_cleaner_last_run_removed_agents{tenant_id=""} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Errorf("metrics missing %q:\n%s", line, w.Body.String())
+		}
+	}
+}
+
+func TestCleanerInterval(t *testing.T) {
+	if c := NewStaleDataCleaner(NewTopologyDB(), time.Minute, 0, nil); c.Interval() != defaultCleanerInterval {
+		t.Errorf("Interval() with 0 = %v, want default %v", c.Interval(), defaultCleanerInterval)
+	}
+
+	cfg := *newTestServer(t).cfg
+	cfg.Topology.StaleThreshold = 50 * time.Millisecond
+	cfg.Topology.CleanerInterval = 20 * time.Millisecond
+	s, err := NewServer(&cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer s.Shutdown()
+
+	if got := s.cleaner.Interval(); got != cfg.Topology.CleanerInterval {
+		t.Errorf("default tenant cleaner interval = %v, want %v", got, cfg.Topology.CleanerInterval)
+	}
+	acme, err := s.tenantFor("acme")
+	if err != nil {
+		t.Fatalf("tenantFor(acme) error = %v", err)
+	}
+	if got := acme.cleaner.Interval(); got != cfg.Topology.CleanerInterval {
+		t.Errorf("tenant cleaner interval = %v, want %v", got, cfg.Topology.CleanerInterval)
+	}
+
+	// 按配置的间隔运行，过期的 Agent 很快被删除，而不是等待默认的 60 秒
+	s.db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: time.Now().Unix() - 10})
+	deadline := time.Now().Add(2 * time.Second)
+	for s.db.Exists("A") {
+		if time.Now().After(deadline) {
+			t.Fatal("stale agent not removed within 2s with cleaner_interval 20ms")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHandleAdminClean(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Admin.Token = "secret"
+
+	now := time.Now().Unix()
+	s.db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: now})
+	s.db.Store(&models.TelemetryRequest{AgentID: "B", Timestamp: now - 30})
+
+	clean := func(query string) (*httptest.ResponseRecorder, CleanResponse) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/clean"+query, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		s.router.ServeHTTP(w, req)
+		var resp CleanResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+		return w, resp
+	}
+
+	// 默认策略下两个 Agent 都未过期
+	if w, resp := clean(""); w.Code != http.StatusOK || len(resp.Removed) != 0 || resp.Scanned != 2 {
+		t.Fatalf("default clean = %d %+v, want nothing removed", w.Code, resp)
+	}
+	// 自定义阈值立即清除 B
+	w, resp := clean("?threshold=10s")
+	if w.Code != http.StatusOK || !reflect.DeepEqual(resp.Removed, []string{"B"}) || resp.Threshold != "10s" {
+		t.Fatalf("clean with threshold = %d %+v, want B removed", w.Code, resp)
+	}
+	if s.db.Exists("B") || !s.db.Exists("A") {
+		t.Error("wrong agents removed")
+	}
+	changes := s.tenants[models.DefaultTenantID].changes.Query("B", 0, 1)
+	if len(changes) != 1 || changes[0].Type != ChangeAgentRemoved || !strings.HasPrefix(changes[0].Actor, "admin@") {
+		t.Errorf("change log = %+v, want removal by admin", changes)
+	}
+
+	for _, q := range []string{"?threshold=abc", "?threshold=0s", "?threshold=-1m"} {
+		if w, _ := clean(q); w.Code != http.StatusBadRequest {
+			t.Errorf("clean%s status = %d, want 400", q, w.Code)
+		}
+	}
+}
+
+func TestHandlePaths(t *testing.T) {
+	s := newTestServer(t)
+
+	report := models.PathReport{
+		AgentID: "A",
+		Traceroutes: []models.Traceroute{{
+			Target:     "10.254.0.2",
+			Endpoint:   "203.0.113.2",
+			MeasuredAt: time.Now().Unix(),
+			Hops: []models.TracerouteHop{
+				{TTL: 1, Address: "192.168.1.1", RTTMs: ptrFloat64(0.5)},
+				{TTL: 2},
+				{TTL: 3, Address: "203.0.113.2", RTTMs: ptrFloat64(12)},
+			},
+		}},
+	}
+	postPaths := func(r models.PathReport) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(r)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/paths", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 未上报过遥测的 Agent 被拒绝
+	if w := postPaths(report); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown agent status = %d, want 404", w.Code)
+	}
+
+	postTelemetry(t, s, models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: time.Now().Unix() - 10,
+		Metrics:   []models.Metric{{TargetIP: "10.254.0.2", RTTMs: ptrFloat64(20)}},
+	})
+	if w := postPaths(report); w.Code != http.StatusOK {
+		t.Fatalf("report status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := postPaths(models.PathReport{AgentID: "A"}); w.Code != http.StatusBadRequest {
+		t.Errorf("empty report status = %d, want 400", w.Code)
+	}
+
+	w := doRequest(s, http.MethodGet, "/api/v1/paths?agent_id=A&target=10.254.0.2")
+	if w.Code != http.StatusOK {
+		t.Fatalf("query status = %d", w.Code)
+	}
+	var resp PathsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Paths) != 1 || len(resp.Paths[0].Traceroutes) != 1 || len(resp.Paths[0].Traceroutes[0].Hops) != 3 {
+		t.Fatalf("paths = %+v", resp.Paths)
+	}
+
+	// Agent 被清理后路径一并删除
+	s.cleaner.CleanNow(time.Second, ActorCleaner)
+	if paths := s.tenants[models.DefaultTenantID].paths.Query("", ""); len(paths) != 0 {
+		t.Errorf("paths after removal = %+v, want none", paths)
+	}
+}
+
+func TestHandleGetPeers(t *testing.T) {
+	s := newTestServer(t)
+
+	now := time.Now().Unix()
+	for _, req := range []models.TelemetryRequest{
+		{AgentID: "10.254.0.1", Timestamp: now},
+		{AgentID: "10.254.0.3", Timestamp: now},
+		// agent_id 不是 IP 时使用上报的隧道地址
+		{AgentID: "edge-2", Timestamp: now, Metadata: &models.AgentMetadata{TunnelIP: "10.254.0.2"}},
+		{AgentID: "edge-x", Timestamp: now},
+		// 已过期的 Agent 不再作为探测目标
+		{AgentID: "10.254.0.9", Timestamp: now - 600},
+	} {
+		req.Metrics = []models.Metric{{TargetIP: "10.254.0.1", RTTMs: ptrFloat64(10)}}
+		s.db.Store(&req)
+	}
+
+	w := doRequest(s, http.MethodGet, "/api/v1/peers?agent_id=10.254.0.1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp models.PeersResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if want := []string{"10.254.0.2", "10.254.0.3"}; !reflect.DeepEqual(resp.Peers, want) {
+		t.Errorf("peers = %v, want %v", resp.Peers, want)
+	}
+
+	// 尚未上报过遥测的新站点同样可以拉取
+	w = doRequest(s, http.MethodGet, "/api/v1/peers?agent_id=10.254.0.4")
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Peers) != 3 {
+		t.Errorf("peers for new agent = %v, want 3", resp.Peers)
+	}
+
+	if w := doRequest(s, http.MethodGet, "/api/v1/peers"); w.Code != http.StatusBadRequest {
+		t.Errorf("missing agent_id status = %d, want 400", w.Code)
+	}
+}
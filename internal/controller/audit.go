@@ -0,0 +1,253 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+)
+
+// 审计动作
+const (
+	AuditTelemetryAccepted = "telemetry.accepted"
+	AuditRoutesComputed    = "routes.computed"
+	AuditPinSet            = "admin.pin.set"
+	AuditPinRemoved        = "admin.pin.removed"
+	AuditPolicySet         = "admin.policy.set"
+	AuditPolicyRemoved     = "admin.policy.removed"
+	AuditConstraintSet     = "admin.constraint.set"
+	AuditConstraintRemoved = "admin.constraint.removed"
+	AuditLinkDisabled      = "admin.link.disabled"
+	AuditLinkEnabled       = "admin.link.enabled"
+	AuditAgentEvicted      = "agent.evicted"
+	AuditConfigReloaded    = "admin.config.reloaded"
+)
+
+// auditHTTPQueueSize HTTP 审计输出的队列长度
+const auditHTTPQueueSize = 1024
+
+// errAuditSinkClosed 审计输出关闭后仍有写入（如关闭期间仍在处理的请求），事件被丢弃
+var errAuditSinkClosed = errors.New("audit sink closed, event dropped")
+
+// AuditEvent 审计事件，一行一条 JSON 追加写入
+type AuditEvent struct {
+	Timestamp string                 `json:"timestamp"`
+	TenantID  string                 `json:"tenant_id,omitempty"` // 为空表示默认租户或全局操作
+	Action    string                 `json:"action"`
+	Actor     string                 `json:"actor"`
+	Target    string                 `json:"target,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// AuditSink 审计事件输出
+type AuditSink interface {
+	Write(event AuditEvent) error
+	Close() error
+}
+
+// FileAuditSink 以追加方式写入本地文件的审计输出
+type FileAuditSink struct {
+	mu     sync.Mutex
+	file   *os.File
+	closed bool
+}
+
+// NewFileAuditSink 打开（或创建）审计日志文件
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) // #nosec G304 -- audit path is trusted config
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &FileAuditSink{file: f}, nil
+}
+
+// Write 追加一条审计事件
+func (s *FileAuditSink) Write(event AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errAuditSinkClosed
+	}
+	_, err = s.file.Write(data)
+	return err
+}
+
+// Close 关闭审计日志文件，重复调用无副作用
+func (s *FileAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.file.Close()
+}
+
+// HTTPAuditSink 将审计事件 POST 到外部收集端的审计输出
+// 事件先进入队列，由后台协程发送，避免阻塞请求处理
+type HTTPAuditSink struct {
+	url    string
+	client *http.Client
+	logger logging.Logger
+	queue  chan AuditEvent
+	wg     sync.WaitGroup
+
+	// mu 保护 closed，保证关闭队列后不再有写入
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewHTTPAuditSink 创建 HTTP 审计输出
+func NewHTTPAuditSink(url string, timeout time.Duration, logger logging.Logger) *HTTPAuditSink {
+	if logger == nil {
+		logger = logging.NewNopLogger()
+	}
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	s := &HTTPAuditSink{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+		logger: logger,
+		queue:  make(chan AuditEvent, auditHTTPQueueSize),
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+// Write 将审计事件加入发送队列，队列已满或已关闭时返回错误
+func (s *HTTPAuditSink) Write(event AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errAuditSinkClosed
+	}
+	select {
+	case s.queue <- event:
+		return nil
+	default:
+		return fmt.Errorf("audit queue full, event dropped")
+	}
+}
+
+// Close 发送完队列中剩余事件后停止，之后的写入被丢弃
+func (s *HTTPAuditSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// run 后台发送循环
+func (s *HTTPAuditSink) run() {
+	defer s.wg.Done()
+	for event := range s.queue {
+		if err := s.send(event); err != nil {
+			s.logger.Error("Failed to deliver audit event",
+				logging.F("action", event.Action),
+				logging.F("error", err.Error()),
+			)
+		}
+	}
+}
+
+// send 发送单条审计事件
+func (s *HTTPAuditSink) send(event AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.client.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("audit sink returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// AuditLogger 控制平面审计日志，将事件分发到所有输出
+// 零值（没有输出）可安全使用，所有事件被丢弃
+type AuditLogger struct {
+	sinks  []AuditSink
+	logger logging.Logger
+}
+
+// NewAuditLogger 创建审计日志
+func NewAuditLogger(logger logging.Logger, sinks ...AuditSink) *AuditLogger {
+	if logger == nil {
+		logger = logging.NewNopLogger()
+	}
+	return &AuditLogger{sinks: sinks, logger: logger}
+}
+
+// Log 记录一条审计事件，tenantID 为事件所属租户
+func (a *AuditLogger) Log(tenantID, action, actor, target string, details map[string]interface{}) {
+	if a == nil || len(a.sinks) == 0 {
+		return
+	}
+
+	event := AuditEvent{
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		TenantID:  tenantID,
+		Action:    action,
+		Actor:     actor,
+		Target:    target,
+		Details:   details,
+	}
+
+	for _, sink := range a.sinks {
+		if err := sink.Write(event); err != nil {
+			a.logger.Error("Failed to write audit event",
+				logging.F("action", action),
+				logging.F("error", err.Error()),
+			)
+		}
+	}
+}
+
+// Close 关闭所有输出
+func (a *AuditLogger) Close() error {
+	if a == nil {
+		return nil
+	}
+	var firstErr error
+	for _, sink := range a.sinks {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
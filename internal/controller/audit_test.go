@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+func TestFileAuditSinkAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	for i := 0; i < 2; i++ {
+		sink, err := NewFileAuditSink(path)
+		if err != nil {
+			t.Fatalf("NewFileAuditSink() error = %v", err)
+		}
+		audit := NewAuditLogger(nil, sink)
+		audit.Log(models.DefaultTenantID, AuditAgentEvicted, "cleaner", "10.254.0.2", map[string]interface{}{"run": i})
+		if err := audit.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var events []AuditEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("Invalid audit line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Got %d events, want 2 (file must be appended, not truncated)", len(events))
+	}
+	if events[0].Action != AuditAgentEvicted || events[0].Actor != "cleaner" || events[0].Target != "10.254.0.2" {
+		t.Errorf("Unexpected event: %+v", events[0])
+	}
+	if _, err := time.Parse(time.RFC3339Nano, events[0].Timestamp); err != nil {
+		t.Errorf("Timestamp %q is not RFC3339: %v", events[0].Timestamp, err)
+	}
+}
+
+func TestHTTPAuditSinkDelivers(t *testing.T) {
+	received := make(chan AuditEvent, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var e AuditEvent
+		_ = json.Unmarshal(data, &e)
+		received <- e
+	}))
+	defer srv.Close()
+
+	audit := NewAuditLogger(nil, NewHTTPAuditSink(srv.URL, time.Second, nil))
+	audit.Log(models.DefaultTenantID, AuditPinSet, "admin@127.0.0.1", "A->B", nil)
+	_ = audit.Close()
+
+	select {
+	case e := <-received:
+		if e.Action != AuditPinSet || e.Target != "A->B" {
+			t.Errorf("Unexpected event: %+v", e)
+		}
+	default:
+		t.Fatal("Audit event was not delivered before Close returned")
+	}
+}
+
+func TestNilAuditLoggerIsSafe(t *testing.T) {
+	var audit *AuditLogger
+	audit.Log(models.DefaultTenantID, AuditTelemetryAccepted, "A", "A", nil)
+	if err := audit.Close(); err != nil {
+		t.Errorf("Close() on nil logger = %v", err)
+	}
+}
+
+func TestAuditSinkWriteAfterClose(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	fileSink, err := NewFileAuditSink(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("NewFileAuditSink() error = %v", err)
+	}
+	sinks := map[string]AuditSink{
+		"file": fileSink,
+		"http": NewHTTPAuditSink(srv.URL, time.Second, nil),
+	}
+
+	for name, sink := range sinks {
+		t.Run(name, func(t *testing.T) {
+			if err := sink.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			// 关闭期间仍在处理的请求继续写入：丢弃并返回错误，不能 panic
+			if err := sink.Write(AuditEvent{Action: AuditTelemetryAccepted}); !errors.Is(err, errAuditSinkClosed) {
+				t.Errorf("Write() after Close = %v, want errAuditSinkClosed", err)
+			}
+			if err := sink.Close(); err != nil {
+				t.Errorf("second Close() error = %v", err)
+			}
+		})
+	}
+
+	audit := NewAuditLogger(nil, NewHTTPAuditSink(srv.URL, time.Second, nil))
+	_ = audit.Close()
+	audit.Log(models.DefaultTenantID, AuditPinSet, "admin", "A->B", nil)
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"math"
+	"sort"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// SetTrafficClasses 设置流量类别，nil 表示不计算类别路由
+func (s *RouteSolver) SetTrafficClasses(classes []config.TrafficClassConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.classes = append([]config.TrafficClassConfig(nil), classes...)
+}
+
+// TrafficClasses 返回当前流量类别
+func (s *RouteSolver) TrafficClasses() []config.TrafficClassConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]config.TrafficClassConfig(nil), s.classes...)
+}
+
+// ComputeClassRoutes 为指定 Agent 按每个流量类别的权重计算完整路由表
+//
+// 与 ComputeRoutes 不同，类别路由每次返回完整快照，不经过迟滞，也不计算 ECMP 和备份下一跳；
+// 固定路由、路由策略、目的地约束、禁用链路和 max_hops 同样生效。
+// 不可达的目的地不出现在结果中，Agent 据此删除类别路由表中的旧条目，查找回落到主路由表。
+func (s *RouteSolver) ComputeClassRoutes(db *TopologyDB, sourceAgent string) []models.ClassRoutes {
+	classes := s.TrafficClasses()
+	if len(classes) == 0 {
+		return nil
+	}
+
+	result := make([]models.ClassRoutes, 0, len(classes))
+	for _, class := range classes {
+		w := s.weights()
+		w.penaltyFactor = class.PenaltyFactor
+		w.jitterWeight = class.JitterWeight
+		w.bandwidthPenalty = class.BandwidthPenalty
+
+		g, paths, maxEdges := s.routingGraph(db, sourceAgent, w)
+		if g == nil {
+			return nil
+		}
+		result = append(result, models.ClassRoutes{
+			Class:  class.Name,
+			Routes: s.fullRoutes(g, paths, sourceAgent, maxEdges),
+		})
+	}
+	return result
+}
+
+// fullRoutes 根据最短路径结果生成到所有可达目的地的路由，按 dst_cidr 排序
+func (s *RouteSolver) fullRoutes(g *Graph, paths *DijkstraResult, sourceAgent string, maxEdges int) []models.RouteConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	routes := make([]models.RouteConfig, 0, len(g.nodes))
+	for target := range g.nodes {
+		if target == sourceAgent {
+			continue
+		}
+
+		if pin, ok := s.pins[routeKey(sourceAgent, target)]; ok {
+			routes = append(routes, models.RouteConfig{
+				DstCIDR: models.HostCIDR(target),
+				NextHop: pin.NextHop,
+				Reason:  "pinned",
+			})
+			continue
+		}
+
+		path, cost := paths.GetPath(target), paths.Distances[target]
+		if constraint, ok := s.constraintForLocked(target); ok {
+			path, cost = constrainedPath(g, sourceAgent, target, constraint, maxEdges)
+		}
+		if len(path) < 2 || math.IsInf(cost, 1) {
+			continue
+		}
+
+		route := models.RouteConfig{
+			DstCIDR: models.HostCIDR(target),
+			NextHop: "direct",
+			Reason:  "default",
+			Path:    path,
+			CostMs:  cost,
+		}
+		if len(path) > 2 {
+			route.NextHop = path[1]
+			route.Reason = "optimized_path"
+		}
+		routes = append(routes, route)
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].DstCIDR < routes[j].DstCIDR
+	})
+	return routes
+}
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+func TestComputeClassRoutes(t *testing.T) {
+	db := NewTopologyDB()
+	db.Store(&models.TelemetryRequest{AgentID: nodeA, Timestamp: 1000, Metrics: []models.Metric{
+		{TargetIP: nodeB, RTTMs: ptrFloat64(10)},
+		{TargetIP: nodeC, RTTMs: ptrFloat64(15), JitterMs: 20},
+	}})
+	db.Store(&models.TelemetryRequest{AgentID: nodeB, Timestamp: 1000, Metrics: []models.Metric{
+		{TargetIP: nodeC, RTTMs: ptrFloat64(10)},
+	}})
+	db.Store(&models.TelemetryRequest{AgentID: nodeC, Timestamp: 1000, Metrics: []models.Metric{}})
+
+	solver := NewRouteSolver(100, 0.15)
+	if classes := solver.ComputeClassRoutes(db, nodeA); classes != nil {
+		t.Fatalf("ComputeClassRoutes() without classes = %+v, want nil", classes)
+	}
+
+	solver.SetTrafficClasses([]config.TrafficClassConfig{
+		{Name: "bulk", PenaltyFactor: 100},
+		{Name: "realtime", PenaltyFactor: 100, JitterWeight: 1},
+	})
+	classes := solver.ComputeClassRoutes(db, nodeA)
+	if len(classes) != 2 {
+		t.Fatalf("ComputeClassRoutes() returned %d classes, want 2", len(classes))
+	}
+
+	// bulk 不计抖动，直连 C (15) 优于经 B (20)；realtime 直连成本 35，改经 B
+	want := map[string]string{"bulk": "direct", "realtime": nodeB}
+	for _, class := range classes {
+		if len(class.Routes) != 2 {
+			t.Fatalf("class %s has %d routes, want full snapshot of 2", class.Class, len(class.Routes))
+		}
+		if r, _ := routeTo(class.Routes, nodeC); r.NextHop != want[class.Class] {
+			t.Errorf("class %s route to C = %+v, want %s", class.Class, r, want[class.Class])
+		}
+	}
+
+	// 类别路由不经过迟滞，也不影响默认路由表
+	if r, _ := routeTo(solver.ComputeRoutes(db, nodeA), nodeC); r.NextHop != "direct" {
+		t.Errorf("default route to C = %+v, want direct", r)
+	}
+	if classes := solver.ComputeClassRoutes(db, nodeA); len(classes[1].Routes) != 2 {
+		t.Errorf("second computation returned %d routes, want full snapshot", len(classes[1].Routes))
+	}
+}
@@ -2,31 +2,109 @@
 package controller
 
 import (
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/holygeek00/lite-sdwan/pkg/config"
 	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
 )
 
+// defaultCleanerInterval 未配置 topology.cleaner_interval 时清理器的运行间隔
+const defaultCleanerInterval = 60 * time.Second
+
+// StalePolicy 判断 Agent 数据何时过期
+type StalePolicy struct {
+	Threshold time.Duration // 未声明上报间隔的 Agent 使用的全局阈值
+	// IntervalMultiplier 声明了上报间隔的 Agent 连续 IntervalMultiplier 个间隔未上报后过期，0 表示所有 Agent 都使用全局阈值
+	IntervalMultiplier float64
+	// LinkThreshold 单条链路超过该时间未测量即过期，0 表示使用所属 Agent 的过期阈值
+	LinkThreshold time.Duration
+	// Quarantine 过期的 Agent 隔离该时间后才删除，隔离期间仍在拓扑中但不作为中继，0 表示过期即删除
+	Quarantine time.Duration
+}
+
+// For 返回 Agent 的过期阈值
+func (p StalePolicy) For(data *models.AgentData) time.Duration {
+	if p.IntervalMultiplier > 0 && data.ReportInterval > 0 {
+		return time.Duration(p.IntervalMultiplier * float64(data.ReportInterval))
+	}
+	return p.Threshold
+}
+
+// Degraded 判断 Agent 在 now 时是否已超过过期阈值，隔离期内的 Agent 保留在拓扑中但不再作为中继
+func (p StalePolicy) Degraded(data *models.AgentData, now time.Time) bool {
+	threshold := p.For(data)
+	return threshold > 0 && now.Sub(data.Timestamp) > threshold
+}
+
+// Expired 判断 Agent 在 now 时是否应被删除：超过过期阈值后又经过了隔离期
+func (p StalePolicy) Expired(data *models.AgentData, now time.Time) bool {
+	return now.Sub(data.Timestamp) > p.For(data)+p.Quarantine
+}
+
+// LinkStale 判断 Agent 的一条链路在 now 时是否已过期
+// 部分更新会保留未上报的链路，Agent 本身仍在上报时这些链路的测量也可能早已过时；阈值为 0 时不检查
+func (p StalePolicy) LinkStale(data *models.AgentData, m *models.MetricData, now time.Time) bool {
+	threshold := p.LinkThreshold
+	if threshold <= 0 {
+		threshold = p.For(data)
+	}
+	return threshold > 0 && !m.UpdatedAt.IsZero() && now.Sub(m.UpdatedAt) > threshold
+}
+
+// CleanerRun 单次清理的统计
+type CleanerRun struct {
+	StartedAt     time.Time
+	Duration      time.Duration // 包括应用保留策略和刷新路由的耗时
+	Scanned       int           // 清理前的 Agent 数
+	Removed       int           // 被删除的 Agent 数
+	RemovedAgents []string      // 被删除的 agent_id
+	Quarantined   int           // 清理后处于隔离期的 Agent 数
+}
+
 // StaleDataCleaner 陈旧数据清理器
 type StaleDataCleaner struct {
-	db        *TopologyDB
-	threshold time.Duration
-	interval  time.Duration
-	logger    logging.Logger
-	stopCh    chan struct{}
-	wg        sync.WaitGroup
+	db         *TopologyDB
+	tenantID   string // 审计日志和 Webhook 事件中标明的租户
+	mu         sync.RWMutex
+	threshold  time.Duration
+	intervalX  float64       // 按 Agent 声明的上报间隔计算过期阈值时的倍数，见 StalePolicy
+	linkStale  time.Duration // 单条链路的过期阈值，见 StalePolicy
+	quarantine time.Duration // 过期 Agent 的隔离期，见 StalePolicy
+	retention  config.RetentionConfig
+	routes     *RouteHistory // 按 retention.max_age 清理的路由变化记录，可为 nil
+	interval   time.Duration
+	logger     logging.Logger
+	audit      *AuditLogger
+	webhooks   *WebhookNotifier
+	onEvict    func(removed []string) // 清理掉 Agent 或 Agent 进入隔离期后调用，可为 nil
+	stopCh     chan struct{}
+	stopOnce   sync.Once
+	wg         sync.WaitGroup
+	runMu      sync.Mutex // 串行化清理，见 clean
+
+	running int32 // 清理循环是否在运行 (1=运行, 0=停止)
+
+	// quarantined 上一次清理时处于隔离期的 Agent，由 runMu 保护
+	quarantined map[string]struct{}
 
 	// Metrics
 	cleanupCount int64
+	runCount     int64
+	lastRun      CleanerRun // 由 mu 保护
 }
 
-// NewStaleDataCleaner 创建清理器
+// NewStaleDataCleaner 创建清理器，interval 不大于 0 时使用默认间隔
 func NewStaleDataCleaner(db *TopologyDB, threshold, interval time.Duration, logger logging.Logger) *StaleDataCleaner {
 	if logger == nil {
 		logger = logging.NewNopLogger()
 	}
+	if interval <= 0 {
+		interval = defaultCleanerInterval
+	}
 	return &StaleDataCleaner{
 		db:        db,
 		threshold: threshold,
@@ -36,20 +114,114 @@ func NewStaleDataCleaner(db *TopologyDB, threshold, interval time.Duration, logg
 	}
 }
 
+// SetTenantID 设置清理器所属的租户，需在 Start 之前调用
+func (c *StaleDataCleaner) SetTenantID(tenantID string) {
+	c.tenantID = tenantID
+}
+
+// SetAuditLogger 设置审计日志，需在 Start 之前调用
+func (c *StaleDataCleaner) SetAuditLogger(audit *AuditLogger) {
+	c.audit = audit
+}
+
+// SetRouteHistory 设置按保留策略清理的路由变化记录，需在 Start 之前调用
+func (c *StaleDataCleaner) SetRouteHistory(routes *RouteHistory) {
+	c.routes = routes
+}
+
+// SetRetention 更新历史数据保留策略，下一次清理时生效
+func (c *StaleDataCleaner) SetRetention(retention config.RetentionConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.retention = retention
+}
+
+// Retention 返回当前历史数据保留策略
+func (c *StaleDataCleaner) Retention() config.RetentionConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.retention
+}
+
+// SetWebhookNotifier 设置 Webhook 通知器，需在 Start 之前调用
+func (c *StaleDataCleaner) SetWebhookNotifier(webhooks *WebhookNotifier) {
+	c.webhooks = webhooks
+}
+
+// SetEvictHandler 设置清理掉 Agent 或 Agent 进入隔离期后的回调，需在 Start 之前调用
+// 回调在清理器的 goroutine 中、数据库锁释放后执行，参数为本次被清理或新进入隔离期的 agent_id
+func (c *StaleDataCleaner) SetEvictHandler(fn func(removed []string)) {
+	c.onEvict = fn
+}
+
+// SetThreshold 更新陈旧阈值，下一次清理时生效
+func (c *StaleDataCleaner) SetThreshold(threshold time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.threshold = threshold
+}
+
+// Threshold 返回当前陈旧阈值
+func (c *StaleDataCleaner) Threshold() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.threshold
+}
+
+// SetIntervalMultiplier 更新按上报间隔计算过期阈值的倍数，0 表示只使用全局阈值，下一次清理时生效
+func (c *StaleDataCleaner) SetIntervalMultiplier(multiplier float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.intervalX = multiplier
+}
+
+// SetLinkThreshold 更新单条链路的过期阈值，0 表示使用所属 Agent 的过期阈值，下一次清理时生效
+func (c *StaleDataCleaner) SetLinkThreshold(threshold time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.linkStale = threshold
+}
+
+// SetQuarantine 更新过期 Agent 的隔离期，0 表示过期即删除，下一次清理时生效
+func (c *StaleDataCleaner) SetQuarantine(period time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.quarantine = period
+}
+
+// Policy 返回当前过期策略
+func (c *StaleDataCleaner) Policy() StalePolicy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return StalePolicy{
+		Threshold:          c.threshold,
+		IntervalMultiplier: c.intervalX,
+		LinkThreshold:      c.linkStale,
+		Quarantine:         c.quarantine,
+	}
+}
+
+// Interval 返回清理循环的运行间隔
+func (c *StaleDataCleaner) Interval() time.Duration {
+	return c.interval
+}
+
 // Start 启动清理循环
 func (c *StaleDataCleaner) Start() {
+	atomic.StoreInt32(&c.running, 1)
 	c.wg.Add(1)
 	go c.run()
 	c.logger.Info("Stale data cleaner started",
-		logging.F("threshold", c.threshold.String()),
+		logging.F("threshold", c.Threshold().String()),
 		logging.F("interval", c.interval.String()),
 	)
 }
 
-// Stop 停止清理器
+// Stop 停止清理器，重复调用无副作用
 func (c *StaleDataCleaner) Stop() {
-	close(c.stopCh)
+	c.stopOnce.Do(func() { close(c.stopCh) })
 	c.wg.Wait()
+	atomic.StoreInt32(&c.running, 0)
 	c.logger.Info("Stale data cleaner stopped",
 		logging.F("total_cleanups", c.GetCleanupCount()),
 	)
@@ -72,14 +244,37 @@ func (c *StaleDataCleaner) run() {
 	}
 }
 
-// cleanOnce 执行单次清理
+// cleanOnce 按当前过期策略执行单次清理
 func (c *StaleDataCleaner) cleanOnce() {
+	c.clean(c.Policy(), ActorCleaner)
+}
+
+// CleanNow 立即执行一次清理，不等待下一次定时清理，返回本次清理的统计
+// threshold 大于 0 时对所有 Agent 使用该阈值（不按上报间隔计算），过期即删除、不经过隔离期；
+// 为 0 时使用当前过期策略。actor 记录在审计日志和拓扑变更日志中
+func (c *StaleDataCleaner) CleanNow(threshold time.Duration, actor string) CleanerRun {
+	policy := c.Policy()
+	if threshold > 0 {
+		policy.Threshold, policy.IntervalMultiplier, policy.Quarantine = threshold, 0, 0
+	}
+	return c.clean(policy, actor)
+}
+
+// clean 按 policy 执行一次清理并记录统计，定时清理和手动清理不会并发执行
+func (c *StaleDataCleaner) clean(policy StalePolicy, actor string) CleanerRun {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+
+	start := time.Now()
+	threshold := policy.Threshold
+
 	// 获取清理前的节点列表用于日志
 	beforeIDs := c.db.GetAllAgentIDs()
 
 	// 执行清理
-	removed := c.db.CleanStale(c.threshold)
+	removed := c.db.cleanExpired(policy, actor)
 
+	var removedNodes []string
 	if removed > 0 {
 		// 获取清理后的节点列表，计算被移除的节点
 		afterIDs := c.db.GetAllAgentIDs()
@@ -88,7 +283,7 @@ func (c *StaleDataCleaner) cleanOnce() {
 			afterSet[id] = struct{}{}
 		}
 
-		removedNodes := make([]string, 0, removed)
+		removedNodes = make([]string, 0, removed)
 		for _, id := range beforeIDs {
 			if _, exists := afterSet[id]; !exists {
 				removedNodes = append(removedNodes, id)
@@ -99,11 +294,102 @@ func (c *StaleDataCleaner) cleanOnce() {
 			logging.F("removed_count", removed),
 			logging.F("removed_nodes", removedNodes),
 			logging.F("remaining_nodes", len(afterIDs)),
+			logging.F("actor", actor),
 		)
+		for _, id := range removedNodes {
+			c.audit.Log(c.tenantID, AuditAgentEvicted, actor, id, map[string]interface{}{
+				"threshold": threshold.String(),
+			})
+			c.webhooks.Notify(config.WebhookEventAgentStale, c.tenantID, id, map[string]interface{}{
+				"threshold": threshold.String(),
+			})
+		}
 
 		// 更新清理计数
 		atomic.AddInt64(&c.cleanupCount, int64(removed))
 	}
+
+	// 隔离状态始终按当前过期策略跟踪，手动清理的临时阈值不影响
+	quarantined := c.updateQuarantine(c.Policy(), time.Now())
+	if c.onEvict != nil && (len(removedNodes) > 0 || len(quarantined) > 0) {
+		c.onEvict(append(removedNodes, quarantined...))
+	}
+
+	c.applyRetention(time.Now())
+
+	run := CleanerRun{
+		StartedAt:     start,
+		Duration:      time.Since(start),
+		Scanned:       len(beforeIDs),
+		Removed:       removed,
+		RemovedAgents: removedNodes,
+		Quarantined:   len(c.quarantined),
+	}
+	c.mu.Lock()
+	c.lastRun = run
+	c.mu.Unlock()
+	atomic.AddInt64(&c.runCount, 1)
+	return run
+}
+
+// updateQuarantine 记录当前处于隔离期的 Agent，返回本次新进入隔离期的 agent_id
+func (c *StaleDataCleaner) updateQuarantine(policy StalePolicy, now time.Time) []string {
+	current := make(map[string]struct{})
+	var entered []string
+	if policy.Quarantine > 0 {
+		for id, data := range c.db.GetAll() {
+			if !policy.Degraded(data, now) {
+				continue
+			}
+			current[id] = struct{}{}
+			if _, ok := c.quarantined[id]; !ok {
+				entered = append(entered, id)
+			}
+		}
+	}
+	c.quarantined = current
+
+	if len(entered) > 0 {
+		sort.Strings(entered)
+		c.logger.Info("Stale agents quarantined",
+			logging.F("agents", entered),
+			logging.F("quarantine", policy.Quarantine.String()),
+		)
+	}
+	return entered
+}
+
+// applyRetention 对链路 RTT 样本和路由变化记录应用保留策略
+func (c *StaleDataCleaner) applyRetention(now time.Time) {
+	retention := c.Retention()
+	samples := c.db.ApplyRetention(retention, now)
+	changes := 0
+	if c.routes != nil && retention.MaxAge > 0 {
+		changes = c.routes.PruneBefore(now.Add(-retention.MaxAge))
+	}
+	if samples > 0 || changes > 0 {
+		c.logger.Debug("Applied retention policy",
+			logging.F("rtt_samples", samples),
+			logging.F("route_changes", changes),
+		)
+	}
+}
+
+// IsRunning 检查清理循环是否在运行
+func (c *StaleDataCleaner) IsRunning() bool {
+	return atomic.LoadInt32(&c.running) == 1
+}
+
+// RunCount 返回清理执行的次数
+func (c *StaleDataCleaner) RunCount() int64 {
+	return atomic.LoadInt64(&c.runCount)
+}
+
+// LastRun 返回最近一次清理的统计，尚未执行过时返回 false
+func (c *StaleDataCleaner) LastRun() (CleanerRun, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastRun, !c.lastRun.StartedAt.IsZero()
 }
 
 // GetCleanupCount 获取清理计数
@@ -0,0 +1,103 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// defaultMaxBodyBytes 默认请求体大小上限（解压后）
+const defaultMaxBodyBytes = 1 << 20
+
+// bodyLimitMiddleware 限制请求体大小，并透明解压 gzip 请求体
+// 解压后的数据同样受大小限制，防止压缩炸弹
+func (s *Server) bodyLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := s.cfg.Server.MaxBodyBytes
+		if limit <= 0 {
+			limit = defaultMaxBodyBytes
+		}
+
+		if c.Request.Body == nil {
+			c.Next()
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+
+		if strings.EqualFold(c.GetHeader("Content-Encoding"), "gzip") {
+			gz, err := gzip.NewReader(c.Request.Body)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse{
+					Detail: "Invalid gzip body",
+				})
+				return
+			}
+			defer func() { _ = gz.Close() }()
+
+			c.Request.Body = http.MaxBytesReader(c.Writer, gz, limit)
+			c.Request.Header.Del("Content-Encoding")
+			c.Request.ContentLength = -1
+		}
+
+		c.Next()
+	}
+}
+
+// gzipResponseWriter 压缩响应体的 ResponseWriter
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	writer *gzip.Writer
+	wrote  bool
+}
+
+// Write 写入压缩数据
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	w.wrote = true
+	return w.writer.Write(data)
+}
+
+// WriteString 写入压缩字符串
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	w.wrote = true
+	return w.writer.Write([]byte(s))
+}
+
+// WriteHeader 写入状态码，移除已失效的 Content-Length
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// gzipMiddleware 在客户端支持时压缩响应
+func gzipMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+			c.Next()
+			return
+		}
+
+		gz := gzip.NewWriter(c.Writer)
+		gw := &gzipResponseWriter{ResponseWriter: c.Writer, writer: gz}
+		c.Header("Content-Encoding", "gzip")
+		c.Header("Vary", "Accept-Encoding")
+		c.Writer = gw
+
+		defer func() {
+			// 没有响应体时不写入 gzip 尾部
+			if !gw.wrote {
+				gw.Header().Del("Content-Encoding")
+				gz.Reset(io.Discard)
+			}
+			_ = gz.Close()
+		}()
+
+		c.Next()
+	}
+}
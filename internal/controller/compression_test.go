@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func gzipString(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTelemetryAcceptsGzipBody(t *testing.T) {
+	s := newTestServer(t)
+
+	body := `{"agent_id":"A","timestamp":` + strconv.FormatInt(time.Now().Unix(), 10) +
+		`,"metrics":[{"target_ip":"B","rtt_ms":10,"loss_rate":0}]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/telemetry", bytes.NewReader(gzipString(t, body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if !s.db.Exists("A") {
+		t.Error("Telemetry from gzip body was not stored")
+	}
+}
+
+func TestTelemetryRejectsOversizedBody(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Server.MaxBodyBytes = 64
+
+	// 压缩后很小，解压后超过上限
+	body := `{"agent_id":"` + strings.Repeat("A", 1024) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/telemetry", bytes.NewReader(gzipString(t, body)))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Status = %d, want 413", w.Code)
+	}
+}
+
+func TestTopologyGzipResponse(t *testing.T) {
+	s := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/topology", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", w.Header().Get("Content-Encoding"))
+	}
+
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Response is not valid gzip: %v", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("Failed to decompress: %v", err)
+	}
+	if !strings.Contains(string(data), `"node_count"`) {
+		t.Errorf("Unexpected body: %s", data)
+	}
+}
@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"math"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// normalizeCIDR 将前缀规范化为网络地址形式，例如 10.254.1.7/24 -> 10.254.1.0/24
+func normalizeCIDR(cidr string) string {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return cidr
+	}
+	return ipnet.String()
+}
+
+// SetConstraint 设置或替换目的前缀的路由约束
+// 落在该前缀内的目的地的迟滞状态被清空，下一次计算按新约束重新下发
+func (s *RouteSolver) SetConstraint(constraint models.RouteConstraint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	constraint.DstCIDR = normalizeCIDR(constraint.DstCIDR)
+	s.constraints[constraint.DstCIDR] = constraint
+	s.resetTargetCostsLocked(constraint)
+}
+
+// RemoveConstraint 删除目的前缀的路由约束，返回是否存在
+func (s *RouteSolver) RemoveConstraint(dstCIDR string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dstCIDR = normalizeCIDR(dstCIDR)
+	constraint, ok := s.constraints[dstCIDR]
+	if !ok {
+		return false
+	}
+	delete(s.constraints, dstCIDR)
+	s.resetTargetCostsLocked(constraint)
+	return true
+}
+
+// GetConstraints 获取所有路由约束，按 dst_cidr 排序
+func (s *RouteSolver) GetConstraints() []models.RouteConstraint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	constraints := make([]models.RouteConstraint, 0, len(s.constraints))
+	for _, c := range s.constraints {
+		constraints = append(constraints, c)
+	}
+	sort.Slice(constraints, func(i, j int) bool {
+		return constraints[i].DstCIDR < constraints[j].DstCIDR
+	})
+	return constraints
+}
+
+// constraintForLocked 返回对目的地生效的约束（最长前缀匹配），调用方需持有 s.mu
+func (s *RouteSolver) constraintForLocked(target string) (models.RouteConstraint, bool) {
+	var best models.RouteConstraint
+	bestLen := -1
+	for _, c := range s.constraints {
+		if n, ok := c.Matches(target); ok && n > bestLen {
+			best, bestLen = c, n
+		}
+	}
+	return best, bestLen >= 0
+}
+
+// resetTargetCostsLocked 清空所有源到约束前缀内目的地的迟滞基准成本，调用方需持有 s.mu
+func (s *RouteSolver) resetTargetCostsLocked(constraint models.RouteConstraint) {
+	for key := range s.previousCosts {
+		i := strings.Index(key, "->")
+		if i < 0 {
+			continue
+		}
+		if _, ok := constraint.Matches(key[i+2:]); ok {
+			delete(s.previousCosts, key)
+		}
+	}
+}
+
+// clone 复制图，约束计算在副本上删除节点，不影响其他目的地
+func (g *Graph) clone() *Graph {
+	c := NewGraph()
+	for node := range g.nodes {
+		c.nodes[node] = true
+	}
+	for from, edges := range g.edges {
+		c.edges[from] = make(map[string]float64, len(edges))
+		for to, cost := range edges {
+			c.edges[from][to] = cost
+		}
+	}
+	return c
+}
+
+// shortestPath 计算 from 到 to 的最短路径，maxEdges > 0 时限制边数
+func (g *Graph) shortestPath(from, to string, maxEdges int) ([]string, float64) {
+	var result *DijkstraResult
+	if maxEdges > 0 {
+		result = g.BoundedShortestPaths(from, maxEdges)
+	} else {
+		result = g.Dijkstra(from)
+	}
+	cost, ok := result.Distances[to]
+	if !ok || math.IsInf(cost, 1) {
+		return nil, math.Inf(1)
+	}
+	return result.GetPath(to), cost
+}
+
+// constrainedPath 在目的地约束下计算 source 到 target 的路径，无法满足约束时返回 nil
+// maxEdges 为策略等其他来源的边数上限，0 表示不限
+//
+// 约束对所有源使用同一张裁剪后的图，因此 avoid_nodes 在逐跳转发时也成立：
+// 中继节点为同一目的地计算时得到的是同一棵最短路径树的子路径。
+// 对于 via，位于 via -> target 段上的节点沿用 via 节点的路径，避免把流量送回 via 形成环路。
+func constrainedPath(g *Graph, source, target string, c models.RouteConstraint, maxEdges int) ([]string, float64) {
+	cg := g.clone()
+	cg.RemoveRelays(source, c.AvoidNodes)
+
+	if c.MaxHops != nil && (maxEdges == 0 || *c.MaxHops < maxEdges) {
+		maxEdges = *c.MaxHops
+	}
+
+	if c.Via == "" || c.Via == source || c.Via == target {
+		return cg.shortestPath(source, target, maxEdges)
+	}
+
+	tail, tailCost := cg.shortestPath(c.Via, target, 0)
+	if tail == nil {
+		return nil, math.Inf(1)
+	}
+
+	// source 已在 via 之后：沿用 via 节点的路径
+	for i, node := range tail {
+		if node != source {
+			continue
+		}
+		path := tail[i:]
+		if maxEdges > 0 && len(path)-1 > maxEdges {
+			return nil, math.Inf(1)
+		}
+		return path, tailCost - pathCost(cg, tail[:i+1])
+	}
+
+	head, headCost := cg.shortestPath(source, c.Via, 0)
+	if head == nil {
+		return nil, math.Inf(1)
+	}
+	path := append(append([]string{}, head...), tail[1:]...)
+	if HasLoop(path) || (maxEdges > 0 && len(path)-1 > maxEdges) {
+		return nil, math.Inf(1)
+	}
+	return path, headCost + tailCost
+}
+
+// pathCost 计算路径上各条边的成本之和，任一条边不存在时返回 +Inf
+func pathCost(g *Graph, path []string) float64 {
+	var cost float64
+	for i := 0; i+1 < len(path); i++ {
+		edge, ok := g.edges[path[i]][path[i+1]]
+		if !ok {
+			return math.Inf(1)
+		}
+		cost += edge
+	}
+	return cost
+}
@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// storeLinks 写入以 "from": {"to": rtt} 描述的拓扑
+func storeLinks(db *TopologyDB, links map[string]map[string]float64) {
+	for from, peers := range links {
+		metrics := make([]models.Metric, 0, len(peers))
+		for to, rtt := range peers {
+			metrics = append(metrics, models.Metric{TargetIP: to, RTTMs: ptrFloat64(rtt)})
+		}
+		db.Store(&models.TelemetryRequest{AgentID: from, Timestamp: time.Now().Unix(), Metrics: metrics})
+	}
+}
+
+const (
+	nodeA = "10.254.0.1"
+	nodeB = "10.254.0.2"
+	nodeC = "10.254.0.3"
+	nodeD = "10.254.1.4"
+)
+
+// storeIPChain 与 storeChain 相同的拓扑，节点使用 IP 以便前缀匹配
+func storeIPChain(db *TopologyDB) {
+	storeLinks(db, map[string]map[string]float64{
+		nodeA: {nodeB: 10, nodeC: 200, nodeD: 300},
+		nodeB: {nodeC: 10, nodeD: 100},
+		nodeC: {nodeD: 10},
+		nodeD: {},
+	})
+}
+
+func TestRouteConstraintValidate(t *testing.T) {
+	zero := 0
+	tests := []struct {
+		name       string
+		constraint models.RouteConstraint
+		wantErr    error
+	}{
+		{"valid", models.RouteConstraint{DstCIDR: "10.254.1.0/24", AvoidNodes: []string{nodeB}, Via: nodeC}, nil},
+		{"invalid cidr", models.RouteConstraint{DstCIDR: "10.254.1.0"}, models.ErrInvalidDstCIDR},
+		{"zero hops", models.RouteConstraint{DstCIDR: "10.254.1.0/24", MaxHops: &zero}, models.ErrInvalidMaxHops},
+		{"empty avoid", models.RouteConstraint{DstCIDR: "10.254.1.0/24", AvoidNodes: []string{""}}, models.ErrEmptyAvoidNode},
+		{"via avoided", models.RouteConstraint{DstCIDR: "10.254.1.0/24", AvoidNodes: []string{nodeB}, Via: nodeB}, models.ErrViaAvoided},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.constraint.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestComputeRoutesConstraintAvoidNodes(t *testing.T) {
+	db := NewTopologyDB()
+	storeIPChain(db)
+	solver := NewRouteSolver(100, 0.15)
+
+	solver.SetConstraint(models.RouteConstraint{DstCIDR: "10.254.1.0/24", AvoidNodes: []string{nodeB}})
+	routes := solver.ComputeRoutes(db, nodeA)
+
+	// 只有 D 在前缀内：A->D 不能经 B，经 C (210) 优于直连 (300)；A->C 仍经 B
+	want := map[string]string{nodeB: "direct", nodeC: nodeB, nodeD: nodeC}
+	for target, hop := range want {
+		r, ok := routeTo(routes, target)
+		if !ok {
+			t.Fatalf("no route to %s", target)
+		}
+		if r.NextHop != hop {
+			t.Errorf("route to %s = %s, want %s", target, r.NextHop, hop)
+		}
+	}
+}
+
+func TestComputeRoutesConstraintMaxHops(t *testing.T) {
+	db := NewTopologyDB()
+	storeIPChain(db)
+	solver := NewRouteSolver(100, 0.15)
+
+	one := 1
+	solver.SetConstraint(models.RouteConstraint{DstCIDR: nodeD + "/32", MaxHops: &one})
+	if r, _ := routeTo(solver.ComputeRoutes(db, nodeA), nodeD); r.NextHop != "direct" {
+		t.Errorf("route to D = %+v, want direct", r)
+	}
+}
+
+func TestComputeRoutesConstraintLongestPrefix(t *testing.T) {
+	db := NewTopologyDB()
+	storeIPChain(db)
+	solver := NewRouteSolver(100, 0.15)
+
+	// /32 比 /16 更具体，覆盖其 avoid_nodes
+	solver.SetConstraint(models.RouteConstraint{DstCIDR: "10.254.0.0/16", AvoidNodes: []string{nodeB}})
+	solver.SetConstraint(models.RouteConstraint{DstCIDR: nodeD + "/32"})
+	routes := solver.ComputeRoutes(db, nodeA)
+
+	if r, _ := routeTo(routes, nodeD); r.NextHop != nodeB {
+		t.Errorf("route to D = %+v, want via B", r)
+	}
+	if r, _ := routeTo(routes, nodeC); r.NextHop != "direct" {
+		t.Errorf("route to C = %+v, want direct", r)
+	}
+}
+
+func TestComputeRoutesConstraintVia(t *testing.T) {
+	db := NewTopologyDB()
+	storeLinks(db, map[string]map[string]float64{
+		nodeA: {nodeB: 10, nodeD: 10},
+		nodeB: {nodeC: 5, nodeD: 20},
+		nodeC: {nodeB: 1, nodeD: 5},
+		nodeD: {},
+	})
+	solver := NewRouteSolver(100, 0.15)
+	solver.SetConstraint(models.RouteConstraint{DstCIDR: nodeD + "/32", Via: nodeB})
+
+	// A 必须经 B：A->B->C->D
+	if r, _ := routeTo(solver.ComputeRoutes(db, nodeA), nodeD); r.NextHop != nodeB {
+		t.Errorf("A route to D = %+v, want via B", r)
+	}
+	// B 本身就是 via 节点，按最短路径经 C
+	if r, _ := routeTo(solver.ComputeRoutes(db, nodeB), nodeD); r.NextHop != nodeC {
+		t.Errorf("B route to D = %+v, want via C", r)
+	}
+	// C 位于 B 之后，沿用 B 的路径直连 D，不能送回 B 形成环路
+	if r, _ := routeTo(solver.ComputeRoutes(db, nodeC), nodeD); r.NextHop != "direct" {
+		t.Errorf("C route to D = %+v, want direct", r)
+	}
+}
+
+func TestConstraintResetsHysteresis(t *testing.T) {
+	db := NewTopologyDB()
+	storeIPChain(db)
+	solver := NewRouteSolver(100, 0.15)
+	solver.ComputeRoutes(db, nodeA)
+
+	// 约束让路径变差，仍需立即下发
+	solver.SetConstraint(models.RouteConstraint{DstCIDR: nodeD + "/32", AvoidNodes: []string{nodeB, nodeC}})
+	r, ok := routeTo(solver.ComputeRoutes(db, nodeA), nodeD)
+	if !ok || r.NextHop != "direct" {
+		t.Fatalf("route to D = %+v (ok=%v), want direct", r, ok)
+	}
+
+	if !solver.RemoveConstraint("10.254.1.4/32") {
+		t.Fatal("RemoveConstraint() = false, want true")
+	}
+	if r, _ := routeTo(solver.ComputeRoutes(db, nodeA), nodeD); r.NextHop != nodeB {
+		t.Errorf("route to D after removal = %+v, want via B", r)
+	}
+}
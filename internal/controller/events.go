@@ -0,0 +1,204 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// 拓扑事件类型
+const (
+	TopologyEventAgentJoined  = "agent.joined"
+	TopologyEventAgentUpdated = "agent.updated"
+	TopologyEventAgentRemoved = "agent.removed"
+)
+
+// topologyEventBuffer 每个订阅通道的缓冲大小
+const topologyEventBuffer = 64
+
+// TopologyEvent 拓扑变化事件
+type TopologyEvent struct {
+	Type      string            `json:"type"`
+	TenantID  string            `json:"tenant_id,omitempty"`
+	AgentID   string            `json:"agent_id"`
+	Timestamp string            `json:"timestamp"`
+	Peers     map[string]Metric `json:"peers,omitempty"`
+}
+
+// newTopologyEvent 创建拓扑事件，metrics 为 nil 时不携带链路信息
+func newTopologyEvent(eventType, tenantID, agentID string, metrics []models.Metric) TopologyEvent {
+	event := TopologyEvent{
+		Type:      eventType,
+		TenantID:  tenantID,
+		AgentID:   agentID,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	if metrics != nil {
+		event.Peers = make(map[string]Metric, len(metrics))
+		for _, m := range metrics {
+			rtt := 0.0
+			if m.RTTMs != nil {
+				rtt = *m.RTTMs
+			}
+			event.Peers[m.TargetIP] = Metric{RTT: rtt, Loss: m.LossRate, Jitter: m.JitterMs, Bandwidth: m.BandwidthMbps}
+		}
+	}
+	return event
+}
+
+// watchTopology 订阅租户拓扑数据库的变更，转换为拓扑事件广播给该租户在 /api/v1/events 的订阅者
+func (s *Server) watchTopology(db *TopologyDB, tenantID string) {
+	db.Subscribe(func(e DBEvent) {
+		switch e.Type {
+		case DBEventStored:
+			s.events.Publish(newTopologyEvent(TopologyEventAgentJoined, tenantID, e.AgentID, agentMetrics(e.Data)))
+		case DBEventUpdated:
+			s.events.Publish(newTopologyEvent(TopologyEventAgentUpdated, tenantID, e.AgentID, agentMetrics(e.Data)))
+		case DBEventRemoved:
+			s.events.Publish(newTopologyEvent(TopologyEventAgentRemoved, tenantID, e.AgentID, nil))
+		}
+	})
+}
+
+// TopologyEventHub 拓扑事件广播中心，每个订阅者只收到所订阅租户的事件
+// nil 值可安全使用，所有事件被丢弃
+type TopologyEventHub struct {
+	mu     sync.RWMutex
+	subs   map[chan TopologyEvent]string // 订阅通道 -> tenant_id
+	closed bool
+}
+
+// NewTopologyEventHub 创建拓扑事件广播中心
+func NewTopologyEventHub() *TopologyEventHub {
+	return &TopologyEventHub{
+		subs: make(map[chan TopologyEvent]string),
+	}
+}
+
+// Subscribe 为租户注册一个订阅通道，广播中心已关闭时返回 nil
+func (h *TopologyEventHub) Subscribe(tenantID string) chan TopologyEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil
+	}
+	ch := make(chan TopologyEvent, topologyEventBuffer)
+	h.subs[ch] = tenantID
+	return ch
+}
+
+// Unsubscribe 注销订阅通道并关闭它
+func (h *TopologyEventHub) Unsubscribe(ch chan TopologyEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[ch]; !ok {
+		return
+	}
+	delete(h.subs, ch)
+	close(ch)
+}
+
+// Publish 向订阅了事件所属租户的订阅者广播事件
+// 订阅者缓冲区已满时丢弃该事件，返回丢弃的数量
+func (h *TopologyEventHub) Publish(event TopologyEvent) int {
+	if h == nil {
+		return 0
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	dropped := 0
+	for ch, tenantID := range h.subs {
+		if tenantID != event.TenantID {
+			continue
+		}
+		select {
+		case ch <- event:
+		default:
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// SubscriberCount 返回订阅者数量
+func (h *TopologyEventHub) SubscriberCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs)
+}
+
+// Close 关闭所有订阅通道，之后的订阅请求返回 nil
+func (h *TopologyEventHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for ch := range h.subs {
+		close(ch)
+	}
+	h.subs = make(map[chan TopologyEvent]string)
+}
+
+// handleEvents 通过 Server-Sent Events 推送 tenant_id 指定租户的拓扑变化，可用 agent_id 过滤
+// 租户校验由 tenantAuthMiddleware 完成
+func (s *Server) handleEvents(c *gin.Context) {
+	tenantID := c.Query("tenant_id")
+	agentID := c.Query("agent_id")
+
+	ch := s.events.Subscribe(tenantID)
+	if ch == nil {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Detail: "Event stream is shutting down",
+		})
+		return
+	}
+	defer s.events.Unsubscribe(ch)
+
+	s.reqLogger(c).Info("Event stream opened",
+		logging.F("client_ip", c.ClientIP()),
+		logging.F("tenant_id", tenantID),
+		logging.F("agent_id", agentID),
+	)
+
+	// 立即写出响应头，客户端无需等到第一个事件
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	keepalive := time.NewTicker(routeStreamKeepalive)
+	defer keepalive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return false
+			}
+			if agentID == "" || event.AgentID == agentID {
+				c.SSEvent(event.Type, event)
+			}
+			return true
+		case <-keepalive.C:
+			c.SSEvent("ping", gin.H{"time": time.Now().Unix()})
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+
+	s.reqLogger(c).Info("Event stream closed", logging.F("client_ip", c.ClientIP()))
+}
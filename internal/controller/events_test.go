@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+func TestTopologyEventHubBroadcast(t *testing.T) {
+	hub := NewTopologyEventHub()
+
+	a := hub.Subscribe(models.DefaultTenantID)
+	b := hub.Subscribe(models.DefaultTenantID)
+	other := hub.Subscribe("acme")
+
+	event := newTopologyEvent(TopologyEventAgentRemoved, models.DefaultTenantID, "A", nil)
+	if dropped := hub.Publish(event); dropped != 0 {
+		t.Errorf("Publish dropped %d events, want 0", dropped)
+	}
+
+	for i, ch := range []chan TopologyEvent{a, b} {
+		select {
+		case got := <-ch:
+			if got.Type != TopologyEventAgentRemoved || got.AgentID != "A" {
+				t.Errorf("subscriber %d received %+v", i, got)
+			}
+		default:
+			t.Errorf("subscriber %d did not receive event", i)
+		}
+	}
+	select {
+	case got := <-other:
+		t.Errorf("subscriber of another tenant received %+v", got)
+	default:
+	}
+
+	hub.Close()
+	if _, ok := <-a; ok {
+		t.Error("Channel should be closed after Close")
+	}
+	if hub.Subscribe(models.DefaultTenantID) != nil {
+		t.Error("Subscribe after Close should return nil")
+	}
+}
+
+func TestHandleEventsAuth(t *testing.T) {
+	s := newTestServer(t)
+
+	get := func(target, token string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		s.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := get("/api/v1/events?tenant_id=", ""); code != http.StatusForbidden {
+		t.Errorf("no tokens configured: status = %d, want 403", code)
+	}
+
+	s.cfg.Admin.Token = "secret"
+	s.cfg.Tenants.Tokens = map[string]string{"acme": "acme-token"}
+
+	tests := []struct {
+		name   string
+		target string
+		token  string
+		want   int
+	}{
+		{"missing tenant_id", "/api/v1/events", "secret", http.StatusBadRequest},
+		{"invalid tenant_id", "/api/v1/events?tenant_id=a/b", "secret", http.StatusBadRequest},
+		{"missing token", "/api/v1/events?tenant_id=acme", "", http.StatusUnauthorized},
+		{"other tenant token", "/api/v1/events?tenant_id=", "acme-token", http.StatusUnauthorized},
+		{"tenant token for unknown tenant", "/api/v1/events?tenant_id=other", "acme-token", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := get(tt.target, tt.token); code != tt.want {
+				t.Errorf("status = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+// openEventStream 订阅租户的拓扑事件流
+func openEventStream(t *testing.T, ctx context.Context, url, tenantID, token string) *http.Response {
+	t.Helper()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url+"/api/v1/events?tenant_id="+tenantID, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /events error = %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /events status = %d, want 200", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	return resp
+}
+
+func TestHandleEventsStreamsTelemetry(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Tenants.Tokens = map[string]string{"acme": "acme-token", "other": "other-token"}
+	srv := httptest.NewServer(s.router)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp := openEventStream(t, ctx, srv.URL, "acme", "acme-token")
+	defer func() { _ = resp.Body.Close() }()
+
+	// 其他租户的遥测不应出现在 acme 的事件流中
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	for _, body := range []string{
+		`{"tenant_id":"other","agent_id":"X","timestamp":` + now + `,"metrics":[{"target_ip":"Y","rtt_ms":10,"loss_rate":0}]}`,
+		`{"tenant_id":"acme","agent_id":"A","timestamp":` + now + `,"metrics":[{"target_ip":"B","rtt_ms":10,"loss_rate":0}]}`,
+		`{"tenant_id":"acme","agent_id":"A","timestamp":` + now + `,"metrics":[{"target_ip":"B","rtt_ms":10,"loss_rate":0}]}`,
+	} {
+		postResp, err := http.Post(srv.URL+"/api/v1/telemetry", "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("POST /telemetry error = %v", err)
+		}
+		_ = postResp.Body.Close()
+	}
+
+	var events []TopologyEvent
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() && len(events) < 2 {
+		if line := scanner.Text(); strings.HasPrefix(line, "data:") {
+			var event TopologyEvent
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &event); err != nil {
+				t.Fatalf("decode event %q: %v", line, err)
+			}
+			events = append(events, event)
+		}
+	}
+
+	want := []string{TopologyEventAgentJoined, TopologyEventAgentUpdated}
+	if len(events) != 2 {
+		t.Fatalf("events = %+v, want %v", events, want)
+	}
+	for i, event := range events {
+		if event.Type != want[i] || event.TenantID != "acme" || event.AgentID != "A" {
+			t.Errorf("event %d = %+v, want %s for acme/A", i, event, want[i])
+		}
+	}
+}
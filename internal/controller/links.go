@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"sort"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// DisableLink 管理性禁用有向链路，常用于维护前把流量从链路上移走
+// 所有 Agent 的迟滞状态被清空：经该链路的路径变差时也要立即切走
+func (s *RouteSolver) DisableLink(link models.LinkDisable) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.disabledLinks[routeKey(link.Source, link.Target)] = link
+	s.previousCosts = make(map[string]float64)
+}
+
+// EnableLink 恢复被禁用的链路，返回是否存在
+func (s *RouteSolver) EnableLink(source, target string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := routeKey(source, target)
+	if _, ok := s.disabledLinks[key]; !ok {
+		return false
+	}
+	delete(s.disabledLinks, key)
+	s.previousCosts = make(map[string]float64)
+	return true
+}
+
+// GetDisabledLinks 获取所有被禁用的链路，按 source、target 排序
+func (s *RouteSolver) GetDisabledLinks() []models.LinkDisable {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	links := make([]models.LinkDisable, 0, len(s.disabledLinks))
+	for _, l := range s.disabledLinks {
+		links = append(links, l)
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Source != links[j].Source {
+			return links[i].Source < links[j].Source
+		}
+		return links[i].Target < links[j].Target
+	})
+	return links
+}
+
+// removeDisabledLinks 从图中删除被禁用的链路
+func (s *RouteSolver) removeDisabledLinks(g *Graph) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, l := range s.disabledLinks {
+		delete(g.edges[l.Source], l.Target)
+	}
+}
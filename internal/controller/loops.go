@@ -0,0 +1,40 @@
+package controller
+
+import "github.com/holygeek00/lite-sdwan/pkg/models"
+
+// forwardingLoopLocked 检查 source 经 nextHop 转发到 target 时，沿其他 Agent 已下发的路由逐跳转发是否会回到经过的节点
+// 没有下发过路由或已回退直连的节点直接送达 target，黑洞路由丢弃流量，都不会成环；调用方需持有 s.mu
+func (s *RouteSolver) forwardingLoopLocked(source, target, nextHop string) bool {
+	dstCIDR := models.HostCIDR(target)
+	visited := map[string]bool{source: true}
+	for hop := nextHop; hop != "direct" && hop != "blackhole" && hop != target; {
+		if visited[hop] {
+			return true
+		}
+		visited[hop] = true
+
+		vr, ok := s.currentRoutes[hop][dstCIDR]
+		if !ok {
+			return false
+		}
+		hop = vr.route.NextHop
+	}
+	return false
+}
+
+// loopFreeHopsLocked 过滤掉会形成转发环路的下一跳，用于等价下一跳和备份下一跳；调用方需持有 s.mu
+func (s *RouteSolver) loopFreeHopsLocked(source, target string, hops []string) []string {
+	if len(hops) == 0 {
+		return hops
+	}
+	result := make([]string, 0, len(hops))
+	for _, hop := range hops {
+		if hop == "direct" || !s.forwardingLoopLocked(source, target, hop) {
+			result = append(result, hop)
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
@@ -0,0 +1,44 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"math"
+	"sort"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// RTTSummary 链路在保留的 RTT 样本上的统计
+type RTTSummary struct {
+	Min     float64 `json:"min_ms"`
+	Max     float64 `json:"max_ms"`
+	P95     float64 `json:"p95_ms"`
+	Samples int     `json:"samples"`
+}
+
+// summarizeRTT 计算样本的 min/max/p95，没有样本时返回 nil
+func summarizeRTT(samples []models.RTTSample) *RTTSummary {
+	if len(samples) == 0 {
+		return nil
+	}
+	sorted := make([]float64, len(samples))
+	for i, sample := range samples {
+		sorted[i] = sample.RTTMs
+	}
+	sort.Float64s(sorted)
+	return &RTTSummary{
+		Min:     sorted[0],
+		Max:     sorted[len(sorted)-1],
+		P95:     percentile(sorted, 0.95),
+		Samples: len(sorted),
+	}
+}
+
+// percentile 按最近秩法返回已排序样本的 p 分位数（0 < p <= 1）
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,175 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// prometheusContentType Prometheus 文本格式的 Content-Type
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// prometheusLabelEscaper 按文本格式规范转义标签值中的反斜杠、双引号和换行
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// routeMetricLabels 生成单条路由指标的标签
+func routeMetricLabels(tenantID string, entry RouteStabilityEntry) string {
+	return fmt.Sprintf(`tenant_id="%s",source="%s",target="%s"`,
+		prometheusLabelEscaper.Replace(tenantID),
+		prometheusLabelEscaper.Replace(entry.Source),
+		prometheusLabelEscaper.Replace(entry.Target),
+	)
+}
+
+// writeRouteStabilityMetrics 输出所有租户按路由统计的下一跳变化次数
+func (s *Server) writeRouteStabilityMetrics(buf *bytes.Buffer) {
+	type tenantEntries struct {
+		id      string
+		entries []RouteStabilityEntry
+	}
+
+	now := time.Now()
+	var all []tenantEntries
+	for _, t := range s.allTenants() {
+		all = append(all, tenantEntries{id: t.id, entries: t.solver.GetStability().Snapshot(now)})
+	}
+
+	metrics := []struct {
+		name, help, kind string
+		value            func(RouteStabilityEntry) string
+	}{
+		{
+			name: "sdwan_route_changes_total",
+			help: "Next hop changes per route since the controller started.",
+			kind: "counter",
+			value: func(e RouteStabilityEntry) string {
+				return fmt.Sprint(e.TotalChanges)
+			},
+		},
+		{
+			name: "sdwan_route_changes_1h",
+			help: "Next hop changes per route over the last hour.",
+			kind: "gauge",
+			value: func(e RouteStabilityEntry) string {
+				return fmt.Sprint(e.Changes1h)
+			},
+		},
+		{
+			name: "sdwan_route_changes_24h",
+			help: "Next hop changes per route over the last 24 hours.",
+			kind: "gauge",
+			value: func(e RouteStabilityEntry) string {
+				return fmt.Sprint(e.Changes24h)
+			},
+		},
+	}
+
+	for _, m := range metrics {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, t := range all {
+			for _, e := range t.entries {
+				fmt.Fprintf(buf, "%s{%s} %s\n", m.name, routeMetricLabels(t.id, e), m.value(e))
+			}
+		}
+	}
+}
+
+// writeLinkRTTMetrics 按链路输出默认租户 up 链路的平均 RTT，按 source->target 排序
+func writeLinkRTTMetrics(buf *bytes.Buffer, avg map[string]float64) {
+	links := make([]string, 0, len(avg))
+	for link := range avg {
+		links = append(links, link)
+	}
+	sort.Strings(links)
+
+	const name = "sdwan_link_avg_rtt_ms"
+	fmt.Fprintf(buf, "# HELP %s Average RTT over the retained samples of each up link.\n# TYPE %s gauge\n", name, name)
+	for _, link := range links {
+		source, target, _ := strings.Cut(link, "->")
+		fmt.Fprintf(buf, "%s{source=\"%s\",target=\"%s\"} %g\n", name,
+			prometheusLabelEscaper.Replace(source), prometheusLabelEscaper.Replace(target), avg[link])
+	}
+}
+
+// writeCleanerMetrics 输出各租户清理器的运行统计，尚未执行过清理的租户只输出累计值
+func (s *Server) writeCleanerMetrics(buf *bytes.Buffer) {
+	tenants := s.allTenants()
+
+	totals := []struct {
+		name, help string
+		value      func(*StaleDataCleaner) int64
+	}{
+		{"sdwan_cleaner_runs_total", "Stale data cleaner runs.", (*StaleDataCleaner).RunCount},
+		{"sdwan_cleaner_removed_agents_total", "Agents removed by the stale data cleaner.", (*StaleDataCleaner).GetCleanupCount},
+	}
+	for _, m := range totals {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s counter\n", m.name, m.help, m.name)
+		for _, t := range tenants {
+			fmt.Fprintf(buf, "%s{tenant_id=\"%s\"} %d\n", m.name, prometheusLabelEscaper.Replace(t.id), m.value(t.cleaner))
+		}
+	}
+
+	gauges := []struct {
+		name, help string
+		value      func(CleanerRun) float64
+	}{
+		{"sdwan_cleaner_last_run_timestamp_seconds", "Unix time the last cleaner run started.", func(r CleanerRun) float64 {
+			return float64(r.StartedAt.UnixNano()) / 1e9
+		}},
+		{"sdwan_cleaner_last_run_duration_seconds", "Duration of the last cleaner run.", func(r CleanerRun) float64 {
+			return r.Duration.Seconds()
+		}},
+		{"sdwan_cleaner_last_run_scanned_agents", "Agents examined by the last cleaner run.", func(r CleanerRun) float64 {
+			return float64(r.Scanned)
+		}},
+		{"sdwan_cleaner_last_run_removed_agents", "Agents removed by the last cleaner run.", func(r CleanerRun) float64 {
+			return float64(r.Removed)
+		}},
+		{"sdwan_cleaner_quarantined_agents", "Stale agents in their quarantine period after the last cleaner run.", func(r CleanerRun) float64 {
+			return float64(r.Quarantined)
+		}},
+	}
+	for _, m := range gauges {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for _, t := range tenants {
+			if run, ok := t.cleaner.LastRun(); ok {
+				fmt.Fprintf(buf, "%s{tenant_id=\"%s\"} %g\n", m.name, prometheusLabelEscaper.Replace(t.id), m.value(run))
+			}
+		}
+	}
+}
+
+// handleMetrics 以 Prometheus 文本格式输出 Controller 指标
+func (s *Server) handleMetrics(c *gin.Context) {
+	t, _ := s.lookupTenant(models.DefaultTenantID)
+	stats := s.collectStats(t)
+
+	var buf bytes.Buffer
+	gauges := []struct {
+		name, help string
+		value      float64
+	}{
+		{"sdwan_agents", "Agents with telemetry in the default tenant.", float64(stats.AgentCount)},
+		{"sdwan_links_up", "Links with a measured RTT and less than 100% loss.", float64(stats.LinksUp)},
+		{"sdwan_links_down", "Links without RTT or with 100% loss.", float64(stats.LinksDown)},
+		{"sdwan_direct_routes", "Routes currently sent as direct.", float64(stats.DirectRoutes)},
+		{"sdwan_relayed_routes", "Routes currently sent through a relay.", float64(stats.RelayedRoutes)},
+		{"sdwan_route_stream_clients", "Connected route stream subscribers.", float64(stats.StreamClients)},
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", g.name, g.help, g.name, g.name, g.value)
+	}
+	writeLinkRTTMetrics(&buf, stats.AvgLinkRTTMs)
+	s.writeRouteStabilityMetrics(&buf)
+	s.writeCleanerMetrics(&buf)
+
+	c.Data(http.StatusOK, prometheusContentType, buf.Bytes())
+}
@@ -0,0 +1,58 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"io"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// 上下文键：API v2 的编码协商结果
+const (
+	ctxKeyProtoRequest  = "sdwan.proto_request"
+	ctxKeyProtoResponse = "sdwan.proto_response"
+)
+
+// protobufNegotiationMiddleware 根据 Content-Type / Accept 协商 protobuf 编码，仅用于 API v2
+// 请求体编码由 Content-Type 决定；响应编码优先看 Accept，未指定时与请求保持一致
+func protobufNegotiationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		protoRequest := strings.HasPrefix(c.ContentType(), models.ContentTypeProtobuf)
+		accept := c.GetHeader("Accept")
+
+		protoResponse := strings.Contains(accept, models.ContentTypeProtobuf) ||
+			(protoRequest && !strings.Contains(accept, "application/json"))
+
+		c.Set(ctxKeyProtoRequest, protoRequest)
+		c.Set(ctxKeyProtoResponse, protoResponse)
+		c.Next()
+	}
+}
+
+// render 按协商结果输出响应：protobuf 或 JSON
+// obj 需要传指针才能匹配 ProtoMarshaler
+func render(c *gin.Context, code int, obj interface{}) {
+	if c.GetBool(ctxKeyProtoResponse) {
+		if m, ok := obj.(models.ProtoMarshaler); ok {
+			c.Data(code, models.ContentTypeProtobuf, m.MarshalProto())
+			return
+		}
+	}
+	c.JSON(code, obj)
+}
+
+// bindTelemetry 按协商结果解码遥测请求体
+func bindTelemetry(c *gin.Context, req *models.TelemetryRequest) error {
+	if !c.GetBool(ctxKeyProtoRequest) {
+		return c.ShouldBindJSON(req)
+	}
+
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	return req.UnmarshalProto(data)
+}
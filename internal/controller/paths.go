@@ -0,0 +1,151 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// PathStore Agent 上报的底层路径，每个 Agent 到每个对等节点只保留最近一次 traceroute
+// Agent 从拓扑数据库中移除时一并删除
+type PathStore struct {
+	mu    sync.RWMutex
+	paths map[string]map[string]models.Traceroute // agent_id -> target -> traceroute
+}
+
+// NewPathStore 创建底层路径存储
+func NewPathStore() *PathStore {
+	return &PathStore{paths: make(map[string]map[string]models.Traceroute)}
+}
+
+// Watch 订阅 db 的变更事件，Agent 被移除时删除其路径
+func (p *PathStore) Watch(db *TopologyDB) {
+	db.Subscribe(func(e DBEvent) {
+		if e.Type == DBEventRemoved {
+			p.Remove(e.AgentID)
+		}
+	})
+}
+
+// Update 记录 Agent 上报的 traceroute，按 target 覆盖之前的结果
+func (p *PathStore) Update(agentID string, traceroutes []models.Traceroute) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	byTarget, ok := p.paths[agentID]
+	if !ok {
+		byTarget = make(map[string]models.Traceroute, len(traceroutes))
+		p.paths[agentID] = byTarget
+	}
+	for _, tr := range traceroutes {
+		byTarget[tr.Target] = tr
+	}
+}
+
+// Remove 删除 Agent 的全部路径
+func (p *PathStore) Remove(agentID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.paths, agentID)
+}
+
+// Query 返回路径，按 agent_id 和 target 排序；agentID、target 为空表示不过滤
+func (p *PathStore) Query(agentID, target string) []AgentPaths {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result := make([]AgentPaths, 0)
+	for id, byTarget := range p.paths {
+		if agentID != "" && id != agentID {
+			continue
+		}
+		entry := AgentPaths{AgentID: id, Traceroutes: make([]models.Traceroute, 0, len(byTarget))}
+		for t, tr := range byTarget {
+			if target == "" || t == target {
+				entry.Traceroutes = append(entry.Traceroutes, tr)
+			}
+		}
+		if len(entry.Traceroutes) == 0 {
+			continue
+		}
+		sort.Slice(entry.Traceroutes, func(i, j int) bool {
+			return entry.Traceroutes[i].Target < entry.Traceroutes[j].Target
+		})
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].AgentID < result[j].AgentID })
+	return result
+}
+
+// AgentPaths 单个 Agent 到各对等节点的底层路径
+type AgentPaths struct {
+	AgentID     string              `json:"agent_id"`
+	Traceroutes []models.Traceroute `json:"traceroutes"`
+}
+
+// PathsResponse 底层路径查询响应
+type PathsResponse struct {
+	Paths []AgentPaths `json:"paths"`
+}
+
+// handleReportPaths 接收 Agent 上报的底层路径
+// 只接受拓扑中已存在的 Agent，路径数据随 Agent 过期一并清理
+func (s *Server) handleReportPaths(c *gin.Context) {
+	var report models.PathReport
+	if err := c.ShouldBindJSON(&report); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, models.ErrorResponse{
+				Detail: fmt.Sprintf("Request body exceeds %d bytes", maxErr.Limit),
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+	if err := report.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Detail: err.Error()})
+		return
+	}
+
+	if !s.allowAgent(c, tenantAgentKey(report.TenantID, report.AgentID)) {
+		return
+	}
+	t, ok := s.lookupTenant(report.TenantID)
+	if ok {
+		_, ok = t.db.Get(report.AgentID)
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Detail: "Agent not found. Send telemetry before reporting paths.",
+		})
+		return
+	}
+
+	t.paths.Update(report.AgentID, report.Traceroutes)
+	s.reqLogger(c).Debug("Received path report",
+		logging.F("agent_id", report.AgentID),
+		logging.F("tenant_id", report.TenantID),
+		logging.F("traceroutes", len(report.Traceroutes)),
+	)
+	c.JSON(http.StatusOK, models.StatusResponse{Status: "ok"})
+}
+
+// handleGetPaths 查询 Agent 上报的底层路径，可按 agent_id 和 target 过滤
+func (s *Server) handleGetPaths(c *gin.Context) {
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, PathsResponse{Paths: t.paths.Query(c.Query("agent_id"), c.Query("target"))})
+}
@@ -0,0 +1,78 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// peerAddress 返回 Agent 的隧道地址：优先使用上报的 tunnel_ip，否则 agent_id 本身是 IP 时使用 agent_id
+func peerAddress(agentID string, data *models.AgentData) (string, bool) {
+	if data.Metadata != nil {
+		if ip := net.ParseIP(data.Metadata.TunnelIP); ip != nil {
+			return ip.String(), true
+		}
+	}
+	if ip := net.ParseIP(agentID); ip != nil {
+		return ip.String(), true
+	}
+	return "", false
+}
+
+// peersFor 返回租户内除 agentID 之外所有未过期 Agent 的隧道地址，已排序
+func peersFor(t *tenant, agentID string, now time.Time) []string {
+	allData := t.db.GetAll()
+	policy := t.cleaner.Policy()
+
+	// 调用方自己的隧道地址也要排除，agent_id 与 tunnel_ip 不同时两者都可能出现
+	self := map[string]bool{agentID: true}
+	if data, ok := allData[agentID]; ok {
+		if addr, ok := peerAddress(agentID, data); ok {
+			self[addr] = true
+		}
+	}
+
+	peers := make([]string, 0, len(allData))
+	seen := make(map[string]bool, len(allData))
+	for id, data := range allData {
+		if id == agentID || now.Sub(data.Timestamp) > policy.For(data) {
+			continue
+		}
+		addr, ok := peerAddress(id, data)
+		if !ok || self[addr] || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		peers = append(peers, addr)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// handleGetPeers 返回 Agent 应探测的对等节点列表
+// 不要求调用方已在拓扑中：新站点先拉取列表、探测之后才有遥测可以上报
+func (s *Server) handleGetPeers(c *gin.Context) {
+	agentID := c.Query("agent_id")
+	if agentID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: "agent_id query parameter is required",
+		})
+		return
+	}
+
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+	if !s.allowAgent(c, tenantAgentKey(t.id, agentID)) {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PeersResponse{Peers: peersFor(t, agentID, time.Now())})
+}
@@ -0,0 +1,328 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// PersistedState 状态文件内容：所有租户的拓扑数据和求解器状态
+type PersistedState struct {
+	SavedAt int64             `json:"saved_at"`
+	Tenants []PersistedTenant `json:"tenants"`
+}
+
+// PersistedTenant 单个租户的持久化状态
+type PersistedTenant struct {
+	TenantID  string           `json:"tenant_id,omitempty"`
+	AgentData []PersistedAgent `json:"agent_data"`
+	// Agents 旧版本以遥测请求形式保存的拓扑数据，不含样本计数和 RTT 历史，只在读取升级前写入的状态时使用
+	Agents []models.TelemetryRequest `json:"agents,omitempty"`
+	Solver SolverState               `json:"solver"`
+}
+
+// PersistedAgent 单个 Agent 的完整拓扑数据，包括各链路的样本计数、RTT 历史和接受时间
+// 恢复后 min_samples 门限、RTT 统计和 /stats 无需重新积累
+type PersistedAgent struct {
+	AgentID string `json:"agent_id"`
+	*models.AgentData
+}
+
+// stateStore 持久化状态的存储后端：file 写入单个 JSON 文件，bolt 和 sqlite 每个租户一条记录
+type stateStore interface {
+	// Load 读取保存的状态，尚未保存过时返回 nil
+	Load() (*PersistedState, error)
+	// Save 整体替换保存的状态
+	Save(state PersistedState) error
+	// Ping 检查存储是否可访问，供就绪探针使用
+	Ping() error
+	// Close 释放底层文件或数据库连接
+	Close() error
+}
+
+// openStateStore 按 storage.backend 打开存储后端
+func openStateStore(cfg config.StorageConfig) (stateStore, error) {
+	switch cfg.Backend {
+	case config.StorageBackendFile:
+		return &fileStateStore{path: cfg.Path}, nil
+	case config.StorageBackendBolt:
+		return openBoltStateStore(cfg.Path)
+	case config.StorageBackendSQLite:
+		return openSQLiteStateStore(cfg.Path)
+	default:
+		return nil, fmt.Errorf("storage backend %q does not persist state", cfg.Backend)
+	}
+}
+
+// StatePersister file、bolt、sqlite 后端：定期把状态写入存储，启动时从存储恢复
+//
+// 恢复后 Agent 无需重新上报即可拉取路由，迟滞基准和已下发下一跳也保持不变，
+// 不会在重启后集中重新下发路由。超过 stale_threshold 的数据照常由清理器移除。
+type StatePersister struct {
+	server   *Server
+	store    stateStore
+	backend  string
+	path     string
+	interval time.Duration
+	logger   logging.Logger
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+
+	mu        sync.Mutex
+	lastSaved []byte // 最近一次写入的内容（不含 saved_at），没有变化时跳过写入
+	lastErr   error  // 最近一次写入的错误，成功后清空
+}
+
+// NewStatePersister 创建状态持久化器并打开存储后端
+func NewStatePersister(server *Server, cfg config.StorageConfig, logger logging.Logger) (*StatePersister, error) {
+	if logger == nil {
+		logger = logging.NewNopLogger()
+	}
+	store, err := openStateStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &StatePersister{
+		server:   server,
+		store:    store,
+		backend:  cfg.Backend,
+		path:     cfg.Path,
+		interval: cfg.FlushInterval,
+		logger:   logger,
+		stopCh:   make(chan struct{}),
+	}, nil
+}
+
+// exportTenants 导出所有租户的拓扑数据和求解器状态，供持久化和副本同步使用
+func (s *Server) exportTenants() []PersistedTenant {
+	tenants := s.allTenants()
+	result := make([]PersistedTenant, 0, len(tenants))
+	for _, t := range tenants {
+		result = append(result, PersistedTenant{
+			TenantID:  t.id,
+			AgentData: t.db.Export(),
+			Solver:    t.solver.ExportState(),
+		})
+	}
+	return result
+}
+
+// importTenants 合并导出的租户状态：拓扑数据按时间取新并原样保留样本计数和 RTT 历史，求解器状态整体替换，不存在的租户按需创建
+// 返回实际更新的 Agent 数量
+func (s *Server) importTenants(tenants []PersistedTenant, actor string) int {
+	updated := 0
+	for _, ts := range tenants {
+		if !models.ValidTenantID(ts.TenantID) {
+			s.logger.Warn("Skipping tenant with invalid id", logging.F("tenant_id", ts.TenantID), logging.F("actor", actor))
+			continue
+		}
+		t, err := s.tenantFor(ts.TenantID)
+		if err != nil {
+			s.logger.Warn("Skipping tenant", logging.F("tenant_id", ts.TenantID), logging.F("actor", actor), logging.F("error", err.Error()))
+			continue
+		}
+		for _, a := range ts.AgentData {
+			if a.AgentData != nil && t.db.Restore(a.AgentID, a.AgentData, actor) {
+				updated++
+			}
+		}
+		for i := range ts.Agents {
+			if t.db.StoreIfNewer(&ts.Agents[i], actor) {
+				updated++
+			}
+		}
+		t.solver.ImportState(ts.Solver)
+	}
+	return updated
+}
+
+// state 收集所有租户的当前状态
+func (p *StatePersister) state() PersistedState {
+	return PersistedState{Tenants: p.server.exportTenants()}
+}
+
+// Load 从存储恢复，尚未保存过时视为首次启动
+// 返回恢复的 Agent 数量
+func (p *StatePersister) Load() (int, error) {
+	state, err := p.store.Load()
+	if err != nil || state == nil {
+		return 0, err
+	}
+
+	restored := p.server.importTenants(state.Tenants, ActorRestore)
+
+	p.logger.Info("State restored",
+		logging.F("backend", p.backend),
+		logging.F("path", p.path),
+		logging.F("tenants", len(state.Tenants)),
+		logging.F("agents", restored),
+		logging.F("saved_at", time.Unix(state.SavedAt, 0).UTC().Format(time.RFC3339)),
+	)
+	return restored, nil
+}
+
+// Save 写入当前状态，内容自上次写入后没有变化时跳过
+func (p *StatePersister) Save() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state := p.state()
+	content, err := json.Marshal(state.Tenants)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	if p.lastSaved != nil && bytes.Equal(content, p.lastSaved) {
+		return nil
+	}
+
+	state.SavedAt = time.Now().Unix()
+	if err := p.store.Save(state); err != nil {
+		p.lastErr = err
+		return err
+	}
+	p.lastSaved, p.lastErr = content, nil
+	return nil
+}
+
+// Check 检查存储是否可访问，以及最近一次写入是否成功
+func (p *StatePersister) Check() error {
+	p.mu.Lock()
+	lastErr := p.lastErr
+	p.mu.Unlock()
+
+	if err := p.store.Ping(); err != nil {
+		return err
+	}
+	return lastErr
+}
+
+// Start 启动定期写入
+func (p *StatePersister) Start() {
+	p.wg.Add(1)
+	go p.run()
+	p.logger.Info("State persister started",
+		logging.F("backend", p.backend),
+		logging.F("path", p.path),
+		logging.F("flush_interval", p.interval.String()),
+	)
+}
+
+// Stop 停止定期写入，最后写入一次并关闭存储
+func (p *StatePersister) Stop() {
+	close(p.stopCh)
+	p.wg.Wait()
+	p.saveLogged()
+	if err := p.store.Close(); err != nil {
+		p.logger.Error("Failed to close state store",
+			logging.F("path", p.path),
+			logging.F("error", err.Error()),
+		)
+	}
+	p.logger.Info("State persister stopped", logging.F("path", p.path))
+}
+
+// run 定期写入循环
+func (p *StatePersister) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.saveLogged()
+		case <-p.stopCh:
+			return
+		}
+	}
+}
+
+// saveLogged 写入一次并记录失败
+func (p *StatePersister) saveLogged() {
+	if err := p.Save(); err != nil {
+		p.logger.Error("Failed to persist state",
+			logging.F("path", p.path),
+			logging.F("error", err.Error()),
+		)
+	}
+}
+
+// fileStateStore file 后端：整个状态写入一个 JSON 文件
+type fileStateStore struct {
+	path string
+}
+
+// Load 读取状态文件，文件不存在时返回 nil
+func (f *fileStateStore) Load() (*PersistedState, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var state PersistedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode state file: %w", err)
+	}
+	return &state, nil
+}
+
+// Save 先写临时文件再重命名，进程中途退出时不会留下不完整的状态文件
+func (f *fileStateStore) Save(state PersistedState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
+
+// Ping 检查状态文件所在目录存在
+func (f *fileStateStore) Ping() error {
+	info, err := os.Stat(filepath.Dir(f.path))
+	if err != nil {
+		return fmt.Errorf("state directory unavailable: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("state directory unavailable: %s is not a directory", filepath.Dir(f.path))
+	}
+	return nil
+}
+
+// Close file 后端不持有打开的文件
+func (f *fileStateStore) Close() error {
+	return nil
+}
@@ -0,0 +1,116 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// bolt 后端的 bucket 和键
+var (
+	boltTenantsBucket = []byte("tenants") // boltTenantKey(tenant_id) -> PersistedTenant（JSON）
+	boltMetaBucket    = []byte("meta")
+	boltSavedAtKey    = []byte("saved_at") // 最近一次写入的 Unix 秒，大端 int64
+)
+
+// boltOpenTimeout 等待数据库文件锁的时间，另一个 Controller 进程持有同一文件时启动失败而不是一直阻塞
+const boltOpenTimeout = 5 * time.Second
+
+// boltTenantKey 返回租户记录的键；BoltDB 不接受空键，默认租户的 tenant_id 为空，因此统一加前缀
+func boltTenantKey(tenantID string) []byte {
+	return []byte("tenant/" + tenantID)
+}
+
+// boltStateStore bolt 后端：BoltDB 单文件数据库，每个租户一条记录，整体在一个事务内替换
+type boltStateStore struct {
+	db *bolt.DB
+}
+
+// openBoltStateStore 打开或创建 BoltDB 数据库文件
+func openBoltStateStore(path string) (*boltStateStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database: %w", err)
+	}
+	return &boltStateStore{db: db}, nil
+}
+
+// Load 读取所有租户，数据库中还没有写入过状态时返回 nil
+func (b *boltStateStore) Load() (*PersistedState, error) {
+	var state *PersistedState
+	err := b.db.View(func(tx *bolt.Tx) error {
+		tenants := tx.Bucket(boltTenantsBucket)
+		if tenants == nil {
+			return nil
+		}
+
+		state = &PersistedState{Tenants: []PersistedTenant{}}
+		if meta := tx.Bucket(boltMetaBucket); meta != nil {
+			if v := meta.Get(boltSavedAtKey); len(v) == 8 {
+				state.SavedAt = int64(binary.BigEndian.Uint64(v))
+			}
+		}
+		return tenants.ForEach(func(k, v []byte) error {
+			var t PersistedTenant
+			if err := json.Unmarshal(v, &t); err != nil {
+				return fmt.Errorf("tenant %q: %w", k, err)
+			}
+			state.Tenants = append(state.Tenants, t)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bolt database: %w", err)
+	}
+	return state, nil
+}
+
+// Save 在一个事务内替换全部租户，已被回收的租户随之删除
+func (b *boltStateStore) Save(state PersistedState) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltTenantsBucket) != nil {
+			if err := tx.DeleteBucket(boltTenantsBucket); err != nil {
+				return err
+			}
+		}
+		tenants, err := tx.CreateBucket(boltTenantsBucket)
+		if err != nil {
+			return err
+		}
+		for _, t := range state.Tenants {
+			data, err := json.Marshal(t)
+			if err != nil {
+				return err
+			}
+			if err := tenants.Put(boltTenantKey(t.TenantID), data); err != nil {
+				return err
+			}
+		}
+
+		meta, err := tx.CreateBucketIfNotExists(boltMetaBucket)
+		if err != nil {
+			return err
+		}
+		savedAt := make([]byte, 8)
+		binary.BigEndian.PutUint64(savedAt, uint64(state.SavedAt))
+		return meta.Put(boltSavedAtKey, savedAt)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write bolt database: %w", err)
+	}
+	return nil
+}
+
+// Ping 打开一个只读事务，数据库已关闭时返回错误
+func (b *boltStateStore) Ping() error {
+	return b.db.View(func(*bolt.Tx) error { return nil })
+}
+
+// Close 关闭数据库文件，释放文件锁
+func (b *boltStateStore) Close() error {
+	return b.db.Close()
+}
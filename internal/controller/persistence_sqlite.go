@@ -0,0 +1,117 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	// 纯 Go 实现的 SQLite 驱动，发布构建使用 CGO_ENABLED=0
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema sqlite 后端的表结构
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS tenants (
+	tenant_id TEXT PRIMARY KEY,
+	state     BLOB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);`
+
+// sqliteStateStore sqlite 后端：SQLite 数据库，每个租户一行，整体在一个事务内替换
+type sqliteStateStore struct {
+	db *sql.DB
+}
+
+// openSQLiteStateStore 打开或创建 SQLite 数据库文件并建表
+func openSQLiteStateStore(path string) (*sqliteStateStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	// 只有持久化器一个写入者，单连接避免 SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize sqlite database: %w", err)
+	}
+	return &sqliteStateStore{db: db}, nil
+}
+
+// Load 读取所有租户，数据库中还没有写入过状态时返回 nil
+func (s *sqliteStateStore) Load() (*PersistedState, error) {
+	state := &PersistedState{Tenants: []PersistedTenant{}}
+	err := s.db.QueryRow(`SELECT value FROM meta WHERE key = 'saved_at'`).Scan(&state.SavedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sqlite database: %w", err)
+	}
+
+	rows, err := s.db.Query(`SELECT tenant_id, state FROM tenants ORDER BY tenant_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sqlite database: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var id string
+		var data []byte
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, fmt.Errorf("failed to read sqlite database: %w", err)
+		}
+		var t PersistedTenant
+		if err := json.Unmarshal(data, &t); err != nil {
+			return nil, fmt.Errorf("failed to decode tenant %q: %w", id, err)
+		}
+		state.Tenants = append(state.Tenants, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read sqlite database: %w", err)
+	}
+	return state, nil
+}
+
+// Save 在一个事务内替换全部租户，已被回收的租户随之删除
+func (s *sqliteStateStore) Save(state PersistedState) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to write sqlite database: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(`DELETE FROM tenants`); err != nil {
+		return fmt.Errorf("failed to write sqlite database: %w", err)
+	}
+	for _, t := range state.Tenants {
+		data, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Errorf("failed to encode tenant %q: %w", t.TenantID, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO tenants (tenant_id, state) VALUES (?, ?)`, t.TenantID, data); err != nil {
+			return fmt.Errorf("failed to write sqlite database: %w", err)
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('saved_at', ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value`, state.SavedAt); err != nil {
+		return fmt.Errorf("failed to write sqlite database: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to write sqlite database: %w", err)
+	}
+	return nil
+}
+
+// Ping 检查数据库连接
+func (s *sqliteStateStore) Ping() error {
+	return s.db.Ping()
+}
+
+// Close 关闭数据库连接
+func (s *sqliteStateStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+func TestStatePersisterRestoresAfterRestart(t *testing.T) {
+	for _, backend := range []string{config.StorageBackendFile, config.StorageBackendBolt, config.StorageBackendSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			testStatePersisterRestoresAfterRestart(t, backend)
+		})
+	}
+}
+
+// testStatePersisterRestoresAfterRestart 写入状态、关闭后用同一配置重新启动，检查拓扑和求解器状态恢复
+func testStatePersisterRestoresAfterRestart(t *testing.T, backend string) {
+	path := filepath.Join(t.TempDir(), "state."+backend)
+	cfg := &config.ControllerConfig{
+		Server:    config.ServerConfig{ListenAddress: "127.0.0.1", Port: 8000},
+		Algorithm: config.AlgorithmConfig{PenaltyFactor: 100, Hysteresis: 0.15, DegradationThreshold: 0.5},
+		Topology:  config.TopologyConfig{StaleThreshold: 60 * time.Second},
+		Storage:   config.StorageConfig{Backend: backend, Path: path, FlushInterval: time.Hour},
+		Logging:   config.LoggingConfig{Level: "ERROR"},
+		Tenants:   config.TenantsConfig{MaxTenants: 100},
+	}
+
+	s, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	now := time.Now().Unix()
+	postTelemetry(t, s, models.TelemetryRequest{AgentID: "A", Timestamp: now, Metrics: []models.Metric{
+		{TargetIP: "B", RTTMs: ptrFloat64(10)},
+	}})
+	postTelemetry(t, s, models.TelemetryRequest{AgentID: "B", TenantID: "blue", Timestamp: now, Metrics: []models.Metric{
+		{TargetIP: "A", RTTMs: ptrFloat64(10)},
+	}})
+	s.solver.SetPin(models.RoutePin{Source: "A", Target: "B", NextHop: "direct"})
+	s.Shutdown()
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("state file not written on shutdown: %v", err)
+	}
+
+	restarted, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() after restart error = %v", err)
+	}
+	defer restarted.Shutdown()
+
+	data, ok := restarted.db.Get("A")
+	if !ok || data.Metrics["B"] == nil || *data.Metrics["B"].RTT != 10 {
+		t.Errorf("agent A not restored: %+v", data)
+	}
+	if pins := restarted.solver.GetPins(); len(pins) != 1 || pins[0].Target != "B" {
+		t.Errorf("pins = %+v, want pin A->B", pins)
+	}
+	blue, ok := restarted.lookupTenant("blue")
+	if !ok || blue.db.Count() != 1 {
+		t.Error("tenant blue not restored")
+	}
+}
+
+// storeWarmTriangle 上报 samples 轮 A、B、C 的遥测：A 到 B 直连很差，经 C 中继最优
+func storeWarmTriangle(db *TopologyDB, samples int) {
+	now := time.Now().Unix()
+	for i := 0; i < samples; i++ {
+		ts := now - int64(samples-1-i)
+		db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: ts, Metrics: []models.Metric{
+			{TargetIP: "B", RTTMs: ptrFloat64(100)},
+			{TargetIP: "C", RTTMs: ptrFloat64(10)},
+		}})
+		db.Store(&models.TelemetryRequest{AgentID: "C", Timestamp: ts, Metrics: []models.Metric{
+			{TargetIP: "B", RTTMs: ptrFloat64(10)},
+		}})
+		db.Store(&models.TelemetryRequest{AgentID: "B", Timestamp: ts, Metrics: []models.Metric{
+			{TargetIP: "A", RTTMs: ptrFloat64(100)},
+		}})
+	}
+}
+
+// TestStatePersisterRestoresSamples 恢复后链路的样本计数和 RTT 历史不变，min_samples 门限下中继路由不被撤回
+func TestStatePersisterRestoresSamples(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	cfg := &config.ControllerConfig{
+		Server:    config.ServerConfig{ListenAddress: "127.0.0.1", Port: 8000},
+		Algorithm: config.AlgorithmConfig{PenaltyFactor: 100, Hysteresis: 0.15, DegradationThreshold: 0.5, MinSamples: 3},
+		Topology:  config.TopologyConfig{StaleThreshold: 60 * time.Second, Retention: config.RetentionConfig{MaxPoints: 60}},
+		Storage:   config.StorageConfig{Backend: config.StorageBackendFile, Path: path, FlushInterval: time.Hour},
+		Logging:   config.LoggingConfig{Level: "ERROR"},
+		Tenants:   config.TenantsConfig{MaxTenants: 100},
+	}
+
+	s, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	storeWarmTriangle(s.db, 3)
+	route, ok := routeTo(s.solver.ComputeRoutes(s.db, "A"), "B")
+	if !ok || route.NextHop != "C" {
+		t.Fatalf("route to B before restart = %+v, want via C", route)
+	}
+	s.Shutdown()
+
+	restarted, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() after restart error = %v", err)
+	}
+	defer restarted.Shutdown()
+
+	data, ok := restarted.db.Get("A")
+	if !ok {
+		t.Fatal("agent A not restored")
+	}
+	if m := data.Metrics["C"]; m == nil || m.Samples != 3 || len(m.RTTHistory) != 3 || m.UpdatedAt.IsZero() {
+		t.Errorf("link A->C after restart = %+v, want 3 samples and history", m)
+	}
+	if data.ReceivedAt.IsZero() {
+		t.Error("received_at not restored")
+	}
+
+	// 已下发的中继路由不被撤回，新的求解器同样算出经 C 中继
+	if route, ok := routeTo(restarted.solver.ComputeRoutes(restarted.db, "A"), "B"); ok && route.NextHop != "C" {
+		t.Errorf("route to B after restart = %+v, want unchanged", route)
+	}
+	fresh := NewRouteSolver(100, 0.15)
+	fresh.SetMinSamples(3)
+	if route, ok := routeTo(fresh.ComputeRoutes(restarted.db, "A"), "B"); !ok || route.NextHop != "C" {
+		t.Errorf("route to B from restored topology = %+v, want via C", route)
+	}
+}
+
+func TestStatePersisterSkipsUnchangedState(t *testing.T) {
+	s := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "state.json")
+	p, err := NewStatePersister(s, config.StorageConfig{Backend: config.StorageBackendFile, Path: path, FlushInterval: time.Hour}, nil)
+	if err != nil {
+		t.Fatalf("NewStatePersister() error = %v", err)
+	}
+
+	if err := p.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// 状态没有变化：不重写文件
+	if err := p.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if info, _ := os.Stat(path); !info.ModTime().Equal(old) {
+		t.Error("unchanged state should not rewrite the file")
+	}
+
+	s.db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: time.Now().Unix()})
+	if err := p.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if info, _ := os.Stat(path); info.ModTime().Equal(old) {
+		t.Error("changed state should rewrite the file")
+	}
+}
+
+func TestServerStopPersistsState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	cfg := &config.ControllerConfig{
+		Server:    config.ServerConfig{ListenAddress: "127.0.0.1", Port: 0},
+		Algorithm: config.AlgorithmConfig{PenaltyFactor: 100, Hysteresis: 0.15, DegradationThreshold: 0.5},
+		Topology:  config.TopologyConfig{StaleThreshold: 60 * time.Second},
+		Storage:   config.StorageConfig{Backend: config.StorageBackendBolt, Path: path, FlushInterval: time.Hour},
+		Logging:   config.LoggingConfig{Level: "ERROR"},
+	}
+	s, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Run() }()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.httpMu.Lock()
+		started := s.httpServer != nil
+		s.httpMu.Unlock()
+		if started {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	s.db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: time.Now().Unix()})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Run() after Stop error = %v, want nil", err)
+	}
+
+	// 关闭时最后写入的状态可被重新打开
+	store, err := openBoltStateStore(path)
+	if err != nil {
+		t.Fatalf("openBoltStateStore() error = %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	state, err := store.Load()
+	if err != nil || state == nil || len(state.Tenants) != 1 || len(state.Tenants[0].AgentData) != 1 {
+		t.Fatalf("state after Stop = %+v (err %v), want agent A", state, err)
+	}
+}
@@ -0,0 +1,83 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// LivenessResponse 存活探针响应
+type LivenessResponse struct {
+	Status string `json:"status"`
+	Uptime string `json:"uptime"`
+}
+
+// handleHealthz 存活探针：进程能处理请求即返回 200
+func (s *Server) handleHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, LivenessResponse{
+		Status: "alive",
+		Uptime: time.Since(s.startedAt).Round(time.Second).String(),
+	})
+}
+
+// handleReadyz 就绪探针：拓扑数据库已初始化、清理器在运行、持久化存储可访问、备节点已完成首次同步
+// 且未进入关闭流程时返回 200
+// 未就绪时返回 503，负载均衡器不应把 Agent 流量导向该实例
+func (s *Server) handleReadyz(c *gin.Context) {
+	resp := models.NewDetailedHealthResponse()
+
+	dbHealth := models.NewComponentHealth(models.HealthStatusHealthy)
+	if s.db == nil {
+		dbHealth.Status = models.HealthStatusUnhealthy
+		dbHealth.Details["error"] = "topology db not initialized"
+	} else {
+		dbHealth.Details["node_count"] = s.db.Count()
+	}
+	resp.AddComponent("topology_db", dbHealth)
+
+	cleanerHealth := models.NewComponentHealth(models.HealthStatusHealthy)
+	if !s.cleaner.IsRunning() {
+		cleanerHealth.Status = models.HealthStatusUnhealthy
+		cleanerHealth.Details["error"] = "stale data cleaner is not running"
+	}
+	resp.AddComponent("cleaner", cleanerHealth)
+
+	serverHealth := models.NewComponentHealth(models.HealthStatusHealthy)
+	if atomic.LoadInt32(&s.shuttingDown) == 1 {
+		serverHealth.Status = models.HealthStatusUnhealthy
+		serverHealth.Details["error"] = "shutting down"
+	}
+	resp.AddComponent("server", serverHealth)
+
+	if s.cfg.Replication.Role != "" {
+		resp.AddComponent("replication", s.replicationHealth())
+	}
+	if s.shared != nil {
+		resp.AddComponent("shared_topology", s.sharedTopologyHealth())
+	}
+	if s.persister != nil {
+		resp.AddComponent("persistence", s.persistenceHealth())
+	}
+
+	if resp.IsHealthy() {
+		c.JSON(http.StatusOK, resp)
+	} else {
+		c.JSON(http.StatusServiceUnavailable, resp)
+	}
+}
+
+// persistenceHealth 持久化存储不可访问或最近一次写入失败时不健康
+func (s *Server) persistenceHealth() models.ComponentHealth {
+	health := models.NewComponentHealth(models.HealthStatusHealthy)
+	health.Details["backend"] = s.persister.backend
+	if err := s.persister.Check(); err != nil {
+		health.Status = models.HealthStatusUnhealthy
+		health.Details["error"] = err.Error()
+	}
+	return health
+}
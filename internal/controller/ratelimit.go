@@ -0,0 +1,146 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// rateLimiterIdleTTL 令牌桶闲置多久后被回收
+const rateLimiterIdleTTL = 10 * time.Minute
+
+// tokenBucket 单个 key 的令牌桶
+type tokenBucket struct {
+	tokens   float64
+	lastFill time.Time
+}
+
+// RateLimiter 按 key 划分的令牌桶限流器
+type RateLimiter struct {
+	rate  float64 // 每秒补充的令牌数
+	burst float64 // 桶容量
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// NewRateLimiter 创建限流器
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*tokenBucket),
+		lastPrune: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Allow 尝试为 key 消耗一个令牌
+// 返回是否允许，以及被拒绝时建议的重试等待时间
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.pruneLocked(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, lastFill: now}
+		l.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.lastFill).Seconds()
+	b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+	b.lastFill = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	if l.rate <= 0 {
+		return false, time.Second
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// pruneLocked 回收长时间闲置的令牌桶，避免伪造 key 导致内存增长
+func (l *RateLimiter) pruneLocked(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+	for key, b := range l.buckets {
+		if now.Sub(b.lastFill) > rateLimiterIdleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Len 返回当前跟踪的 key 数量
+func (l *RateLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// rateLimitMiddleware 按客户端 IP 限流
+func (s *Server) rateLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.ipLimiter == nil {
+			c.Next()
+			return
+		}
+		if ok, wait := s.ipLimiter.Allow(c.ClientIP()); !ok {
+			s.rejectRateLimited(c, "client_ip", c.ClientIP(), wait)
+			return
+		}
+		c.Next()
+	}
+}
+
+// allowAgent 按 agent_id 限流，被拒绝时已写入 429 响应
+func (s *Server) allowAgent(c *gin.Context, agentID string) bool {
+	if s.agentLimiter == nil {
+		return true
+	}
+	if ok, wait := s.agentLimiter.Allow(agentID); !ok {
+		s.rejectRateLimited(c, "agent_id", agentID, wait)
+		return false
+	}
+	return true
+}
+
+// rejectRateLimited 返回 429 响应
+func (s *Server) rejectRateLimited(c *gin.Context, keyType, key string, wait time.Duration) {
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	s.reqLogger(c).Warn("Rate limit exceeded",
+		logging.F(keyType, key),
+		logging.F("path", c.Request.URL.Path),
+	)
+
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	render(c, http.StatusTooManyRequests, &models.ErrorResponse{
+		Detail: "Rate limit exceeded",
+	})
+	c.Abort()
+}
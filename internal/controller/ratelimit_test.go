@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewRateLimiter(1, 2)
+	l.now = func() time.Time { return now }
+
+	// 初始可用 burst 个令牌
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("Request %d should be allowed", i)
+		}
+	}
+
+	ok, wait := l.Allow("a")
+	if ok {
+		t.Fatal("Third request should be rate limited")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("Retry wait = %v, want (0, 1s]", wait)
+	}
+
+	// 其他 key 不受影响
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("Different key should have its own bucket")
+	}
+
+	// 1 秒后补充 1 个令牌
+	now = now.Add(time.Second)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("Request should be allowed after refill")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("Bucket should be empty again")
+	}
+}
+
+func TestRateLimiterPrunesIdleBuckets(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewRateLimiter(1, 1)
+	l.now = func() time.Time { return now }
+	l.lastPrune = now
+
+	l.Allow("a")
+	l.Allow("b")
+
+	now = now.Add(rateLimiterIdleTTL + time.Minute)
+	l.Allow("c")
+
+	if l.Len() != 1 {
+		t.Errorf("Len = %d, want 1 after pruning idle buckets", l.Len())
+	}
+}
+
+func TestRoutesEndpointRateLimited(t *testing.T) {
+	s := newTestServer(t)
+	s.agentLimiter = NewRateLimiter(0.001, 1)
+
+	doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A")
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/routes?agent_id=A", nil)
+	s.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Status = %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After header should be set")
+	}
+}
+
+func TestZeroRateDisablesLimiter(t *testing.T) {
+	cfg := *newTestServer(t).cfg
+	cfg.RateLimit = config.RateLimitConfig{Enabled: true, PerIPRPS: 0, PerIPBurst: 40, PerAgentRPS: 2, PerAgentBurst: 5}
+
+	s, err := NewServer(&cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer s.Shutdown()
+
+	if s.ipLimiter != nil {
+		t.Error("per_ip_rps: 0 should disable the per-IP limiter")
+	}
+	if s.agentLimiter == nil {
+		t.Error("per-agent limiter should stay enabled")
+	}
+}
+
+func TestIPLimiterIgnoresSpoofedForwardedFor(t *testing.T) {
+	send := func(s *Server) (limited int) {
+		for i := 0; i < 20; i++ {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/peers?agent_id=A", nil)
+			req.RemoteAddr = "192.0.2.1:40000"
+			req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i+1))
+			s.router.ServeHTTP(w, req)
+			if w.Code == http.StatusTooManyRequests {
+				limited++
+			}
+		}
+		return limited
+	}
+
+	cfg := *newTestServer(t).cfg
+	cfg.RateLimit = config.RateLimitConfig{Enabled: true, PerIPRPS: 1, PerIPBurst: 2}
+	s, err := NewServer(&cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer s.Shutdown()
+
+	// 默认不信任任何代理：按连接的对端地址限流，轮换 X-Forwarded-For 不会得到新的令牌桶
+	if limited := send(s); limited < 17 {
+		t.Errorf("spoofed X-Forwarded-For: %d of 20 requests limited, want at least 17", limited)
+	}
+	if got := s.ipLimiter.Len(); got != 1 {
+		t.Errorf("buckets = %d, want 1", got)
+	}
+
+	// 来自可信代理的请求按 X-Forwarded-For 中的客户端限流
+	cfg.Server.TrustedProxies = []string{"192.0.2.0/24"}
+	proxied, err := NewServer(&cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer proxied.Shutdown()
+	if limited := send(proxied); limited != 0 {
+		t.Errorf("trusted proxy: %d of 20 requests limited, want 0", limited)
+	}
+	if got := proxied.ipLimiter.Len(); got != 20 {
+		t.Errorf("buckets behind trusted proxy = %d, want 20", got)
+	}
+}
+
+func TestNewServerInvalidTrustedProxy(t *testing.T) {
+	cfg := *newTestServer(t).cfg
+	cfg.Server.TrustedProxies = []string{"not-an-ip"}
+	if s, err := NewServer(&cfg); err == nil {
+		s.Shutdown()
+		t.Error("NewServer() should reject an invalid trusted proxy")
+	}
+}
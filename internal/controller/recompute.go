@@ -0,0 +1,171 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// RecomputeResponse 强制重算路由的响应
+type RecomputeResponse struct {
+	TenantID      string  `json:"tenant_id,omitempty"`
+	AgentCount    int     `json:"agent_count"`
+	ChangedRoutes int     `json:"changed_routes"`
+	DurationMs    float64 `json:"duration_ms"`
+}
+
+// routeCacheEnabled 是否使用缓存模式（on_telemetry / on_change）：查询路由时返回缓存结果
+func (s *Server) routeCacheEnabled() bool {
+	mode := s.cfg.Algorithm.RecomputeMode
+	return mode == config.RecomputeOnTelemetry || mode == config.RecomputeOnChange
+}
+
+// refreshCachedRoutes 按缓存模式在查询前刷新缓存
+func (s *Server) refreshCachedRoutes(t *tenant) {
+	if s.cfg.Algorithm.RecomputeMode == config.RecomputeOnChange {
+		s.refreshChangedRoutes(t)
+		return
+	}
+	s.refreshExpiredRoutes(t)
+}
+
+// recomputeRoutes 为租户内所有 Agent 重新计算路由和流量类别路由，推送给流订阅者并刷新缓存时间
+// 返回参与计算的 Agent 数和发生变化的路由数
+func (s *Server) recomputeRoutes(t *tenant, actor string) (agents, changed int) {
+	var classRoutes map[string][]models.ClassRoutes
+	if len(t.solver.TrafficClasses()) > 0 {
+		classRoutes = make(map[string][]models.ClassRoutes)
+	}
+	for _, agentID := range t.db.GetAllAgentIDs() {
+		agents++
+		if classRoutes != nil {
+			classRoutes[agentID] = t.solver.ComputeClassRoutes(t.db, agentID)
+		}
+		routes := t.solver.ComputeRoutes(t.db, agentID)
+		if len(routes) == 0 {
+			continue
+		}
+		changed += len(routes)
+
+		s.audit.Log(t.id, AuditRoutesComputed, actor, agentID, map[string]interface{}{
+			"route_count": len(routes),
+			"routes":      routes,
+		})
+		s.notifyRouteChanges(t.id, agentID, routes)
+
+		update := models.RouteResponse{Routes: routes, Version: t.solver.RouteVersion(agentID)}
+		if dropped := t.streams.Publish(agentID, update); dropped > 0 {
+			s.logger.Warn("Route stream subscriber too slow, update dropped",
+				logging.F("agent_id", agentID),
+				logging.F("dropped", dropped),
+			)
+		}
+	}
+	t.setClassRoutes(classRoutes)
+	atomic.StoreInt64(&t.lastRecompute, time.Now().UnixNano())
+	return agents, changed
+}
+
+// refreshExpiredRoutes 缓存超过 route_cache_ttl 时重算
+// 只按阈值触发时，缓慢变化的链路质量也能在有限时间内反映到路由上；
+// 缓存过期时多个 Agent 同时查询只有第一个执行计算，其余等待后直接读取结果
+func (s *Server) refreshExpiredRoutes(t *tenant) {
+	if !t.routeCacheExpired(s.cfg.Algorithm.RouteCacheTTL) {
+		return
+	}
+
+	t.computeMu.Lock()
+	defer t.computeMu.Unlock()
+	if !t.routeCacheExpired(s.cfg.Algorithm.RouteCacheTTL) {
+		return
+	}
+	s.recomputeRoutes(t, "route_cache")
+}
+
+// refreshChangedRoutes 拓扑数据自上次计算后有变化时为所有 Agent 重算一次
+// 多个 Agent 同时查询时只有第一个执行计算，其余等待后直接读取结果
+func (s *Server) refreshChangedRoutes(t *tenant) {
+	t.computeMu.Lock()
+	defer t.computeMu.Unlock()
+
+	version := t.db.Version()
+	if t.computed && version == t.computedVersion {
+		return
+	}
+	s.recomputeRoutes(t, "route_cache")
+	t.computedVersion, t.computed = version, true
+}
+
+// telemetryCrossedThreshold 判断新遥测是否让拓扑发生了需要立即重算的变化：
+// Agent 首次上报、链路增减，或链路在正常和劣化之间切换
+func (s *Server) telemetryCrossedThreshold(req *models.TelemetryRequest, prev *models.AgentData) bool {
+	if prev == nil || len(prev.Metrics) != len(req.Metrics) {
+		return true
+	}
+
+	lossRate, rttMs := s.cfg.Algorithm.RecomputeLossRate, s.cfg.Algorithm.RecomputeRTTMs
+	for _, m := range req.Metrics {
+		old, ok := prev.Metrics[m.TargetIP]
+		if !ok {
+			return true
+		}
+		current := &models.MetricData{RTT: m.RTTMs, Loss: m.LossRate, Jitter: m.JitterMs}
+		if metricDegraded(old, lossRate, rttMs) != metricDegraded(current, lossRate, rttMs) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleRecompute 立即为租户内所有 Agent 重新计算路由，属于管理 API
+func (s *Server) handleRecompute(c *gin.Context) {
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	start := time.Now()
+	agents, changed := s.recomputeRoutes(t, adminActor(c))
+	duration := time.Since(start)
+
+	s.reqLogger(c).Info("Routes recomputed",
+		logging.F("tenant_id", t.id),
+		logging.F("agent_count", agents),
+		logging.F("changed_routes", changed),
+		logging.F("duration_ms", float64(duration.Microseconds())/1000.0),
+	)
+
+	c.JSON(http.StatusOK, RecomputeResponse{
+		TenantID:      t.id,
+		AgentCount:    agents,
+		ChangedRoutes: changed,
+		DurationMs:    float64(duration.Microseconds()) / 1000.0,
+	})
+}
+
+// evictionHandler 返回租户清理器删除 Agent 或将其隔离后的回调：立即刷新路由并推送给流订阅者，
+// 其余 Agent 不必等到下一次查询触发重算才停止经由已失效的节点中继
+func (s *Server) evictionHandler(tenantID string) func(agents []string) {
+	return func(agents []string) {
+		t, ok := s.lookupTenant(tenantID)
+		if !ok {
+			return
+		}
+		s.logger.Info("Refreshing routes after stale agents removed or quarantined",
+			logging.F("tenant_id", tenantID),
+			logging.F("agents", agents),
+		)
+		s.refreshRoutes(t, ActorCleaner)
+		// 清理后可能只剩空租户；回收会停止该租户的清理器，不能在清理器自己的 goroutine 中同步执行
+		if tenantID != models.DefaultTenantID && t.db.Count() == 0 {
+			go s.reapIdleTenants()
+		}
+	}
+}
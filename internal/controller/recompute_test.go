@@ -0,0 +1,320 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+func TestHandleRecompute(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Admin.Token = "secret"
+	storeChain(s.db)
+
+	recompute := func(token string) (*httptest.ResponseRecorder, RecomputeResponse) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/routes/recompute", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		s.router.ServeHTTP(w, req)
+		var resp RecomputeResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+		return w, resp
+	}
+
+	if w, _ := recompute(""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("without admin token: status = %d, want 401", w.Code)
+	}
+	if w := doRequest(s, http.MethodPost, "/api/v1/routes/recompute"); w.Code != http.StatusNotFound {
+		t.Errorf("old public path: status = %d, want 404", w.Code)
+	}
+
+	w, resp := recompute("secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if resp.AgentCount != s.db.Count() || resp.ChangedRoutes == 0 {
+		t.Errorf("response = %+v, want all agents and some changed routes", resp)
+	}
+
+	// 拓扑没有变化时再次重算不产生新的路由变化
+	if _, resp = recompute("secret"); resp.ChangedRoutes != 0 {
+		t.Errorf("second recompute changed %d routes, want 0", resp.ChangedRoutes)
+	}
+}
+
+func TestRouteCacheOnTelemetry(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Algorithm.RecomputeMode = config.RecomputeOnTelemetry
+	s.cfg.Algorithm.RecomputeLossRate = 0.1
+	s.cfg.Algorithm.RouteCacheTTL = time.Hour
+
+	now := time.Now().Unix()
+	sendA := func(lossToB float64, rttToB float64) {
+		postTelemetry(t, s, models.TelemetryRequest{
+			AgentID:   "A",
+			Timestamp: now,
+			Metrics: []models.Metric{
+				{TargetIP: "B", RTTMs: ptrFloat64(rttToB), LossRate: lossToB},
+				{TargetIP: "C", RTTMs: ptrFloat64(300)},
+			},
+		})
+	}
+	postTelemetry(t, s, models.TelemetryRequest{
+		AgentID:   "B",
+		Timestamp: now,
+		Metrics:   []models.Metric{{TargetIP: "C", RTTMs: ptrFloat64(10)}},
+	})
+	// A->B 丢包严重，C 走直连
+	sendA(0.5, 500)
+
+	nextHopToC := func() string {
+		t.Helper()
+		var resp models.RouteResponse
+		w := doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A")
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		route, ok := routeTo(resp.Routes, "C")
+		if !ok {
+			t.Fatalf("no route to C in %+v", resp.Routes)
+		}
+		return route.NextHop
+	}
+
+	if hop := nextHopToC(); hop != "direct" {
+		t.Fatalf("initial next hop to C = %q, want direct", hop)
+	}
+	// 缓存的是完整路由集，重复查询结果不变
+	if hop := nextHopToC(); hop != "direct" {
+		t.Errorf("repeated query next hop to C = %q, want direct", hop)
+	}
+
+	// RTT 改善但链路仍处于劣化状态，不触发重算
+	sendA(0.5, 10)
+	if hop := nextHopToC(); hop != "direct" {
+		t.Errorf("without crossing next hop to C = %q, want cached direct", hop)
+	}
+
+	// 丢包恢复，越过阈值立即重算
+	sendA(0, 10)
+	if hop := nextHopToC(); hop != "B" {
+		t.Errorf("after crossing threshold next hop to C = %q, want B", hop)
+	}
+}
+
+func TestRouteCacheOnChange(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Algorithm.RecomputeMode = config.RecomputeOnChange
+	tn, _ := s.lookupTenant(models.DefaultTenantID)
+	storeChain(s.db)
+
+	getRoutes := func() []models.RouteConfig {
+		t.Helper()
+		var resp models.RouteResponse
+		w := doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A")
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.Routes
+	}
+
+	// 首次查询为所有 Agent 计算，其他 Agent 的路由也已就绪
+	if routes := getRoutes(); len(routes) != 3 {
+		t.Fatalf("routes = %+v, want 3", routes)
+	}
+	if routes, _ := s.solver.RoutesSince("B", 0); len(routes) != 2 {
+		t.Errorf("B routes = %+v, want computed together with A", routes)
+	}
+	version := s.db.Version()
+	if !tn.computed || tn.computedVersion != version {
+		t.Fatalf("cache version = %d (computed=%v), want %d", tn.computedVersion, tn.computed, version)
+	}
+
+	// 拓扑未变化：直接返回缓存
+	last := tn.lastRecompute
+	getRoutes()
+	if tn.lastRecompute != last {
+		t.Error("routes recomputed without topology change")
+	}
+
+	// 拓扑变化后下一次查询重算
+	s.db.Store(&models.TelemetryRequest{AgentID: "B", Timestamp: time.Now().Unix(), Metrics: []models.Metric{
+		{TargetIP: "C", RTTMs: ptrFloat64(500)},
+		{TargetIP: "D", RTTMs: ptrFloat64(500)},
+	}})
+	// A->B->... 不再划算，A->D 改为经 C (210)
+	if r, _ := routeTo(getRoutes(), "D"); r.NextHop != "C" {
+		t.Errorf("route to D after change = %+v, want via C", r)
+	}
+	if tn.computedVersion != s.db.Version() {
+		t.Errorf("cache version = %d, want %d", tn.computedVersion, s.db.Version())
+	}
+}
+
+func TestRouteCacheSingleFlight(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Algorithm.RecomputeMode = config.RecomputeOnTelemetry
+	s.cfg.Algorithm.RouteCacheTTL = time.Hour
+	tn, _ := s.lookupTenant(models.DefaultTenantID)
+	storeChain(s.db)
+
+	// 缓存过期时并发查询只重算一次
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	recomputes := make(map[int64]bool)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.refreshExpiredRoutes(tn)
+			mu.Lock()
+			recomputes[atomic.LoadInt64(&tn.lastRecompute)] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if len(recomputes) != 1 {
+		t.Errorf("concurrent refreshes recomputed %d times, want 1", len(recomputes))
+	}
+}
+
+func TestRouteCacheClassRoutes(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Algorithm.RecomputeMode = config.RecomputeOnChange
+	s.solver.SetTrafficClasses([]config.TrafficClassConfig{{Name: "bulk", PenaltyFactor: 100}})
+	tn, _ := s.lookupTenant(models.DefaultTenantID)
+	storeChain(s.db)
+
+	getClasses := func() []models.ClassRoutes {
+		t.Helper()
+		var resp models.RouteResponse
+		w := doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A")
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.Classes
+	}
+
+	want := s.solver.ComputeClassRoutes(s.db, "A")
+	if got := getClasses(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("classes = %+v, want %+v", got, want)
+	}
+
+	// 拓扑未变化时类别路由来自缓存，不随查询重新计算
+	s.solver.SetTrafficClasses(nil)
+	if got := getClasses(); !reflect.DeepEqual(got, want) {
+		t.Errorf("cached classes = %+v, want %+v", got, want)
+	}
+	if got := tn.cachedClassRoutes("B"); len(got) != 1 {
+		t.Errorf("B classes = %+v, want computed together with A", got)
+	}
+}
+
+func TestCleanerEvictionRefreshesRoutes(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Algorithm.RecomputeMode = config.RecomputeOnTelemetry
+	s.cfg.Algorithm.RouteCacheTTL = time.Hour
+	tn, _ := s.lookupTenant(models.DefaultTenantID)
+
+	now := time.Now().Unix()
+	s.db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: now, Metrics: []models.Metric{
+		{TargetIP: "B", RTTMs: ptrFloat64(10)},
+		{TargetIP: "C", RTTMs: ptrFloat64(300)},
+	}})
+	s.db.Store(&models.TelemetryRequest{AgentID: "B", Timestamp: now, Metrics: []models.Metric{
+		{TargetIP: "C", RTTMs: ptrFloat64(10)},
+	}})
+	s.db.Store(&models.TelemetryRequest{AgentID: "C", Timestamp: now})
+	s.recomputeRoutes(tn, "test")
+	if routes, _ := s.solver.RoutesSince("A", 0); len(routes) == 0 {
+		t.Fatal("no cached routes for A")
+	} else if r, _ := routeTo(routes, "C"); r.NextHop != "B" {
+		t.Fatalf("initial next hop to C = %q, want B", r.NextHop)
+	}
+
+	// B 停止上报，清理后 A 的缓存路由立即改为直连，不等缓存过期
+	s.db.Store(&models.TelemetryRequest{AgentID: "B", Timestamp: now - 600, Metrics: []models.Metric{
+		{TargetIP: "C", RTTMs: ptrFloat64(10)},
+	}})
+	s.cleaner.cleanOnce()
+
+	if s.db.Exists("B") {
+		t.Fatal("B was not cleaned")
+	}
+	routes, _ := s.solver.RoutesSince("A", 0)
+	if r, _ := routeTo(routes, "C"); r.NextHop != "direct" {
+		t.Errorf("next hop to C after eviction = %q, want direct", r.NextHop)
+	}
+}
+
+func TestCleanerQuarantine(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Algorithm.RecomputeMode = config.RecomputeOnTelemetry
+	s.cfg.Algorithm.RouteCacheTTL = time.Hour
+	s.cleaner.SetQuarantine(5 * time.Minute)
+	s.solver.SetStalePolicy(s.cleaner.Policy())
+	tn, _ := s.lookupTenant(models.DefaultTenantID)
+
+	now := time.Now().Unix()
+	storeB := func(ts int64) {
+		s.db.Store(&models.TelemetryRequest{AgentID: "B", Timestamp: ts, Metrics: []models.Metric{
+			{TargetIP: "C", RTTMs: ptrFloat64(10)},
+		}})
+	}
+	s.db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: now, Metrics: []models.Metric{
+		{TargetIP: "B", RTTMs: ptrFloat64(10)},
+		{TargetIP: "C", RTTMs: ptrFloat64(300)},
+	}})
+	storeB(now)
+	s.db.Store(&models.TelemetryRequest{AgentID: "C", Timestamp: now})
+	s.recomputeRoutes(tn, "test")
+
+	// B 超过过期阈值但仍在隔离期：保留在拓扑中，不再作为中继
+	storeB(now - 120)
+	s.cleaner.cleanOnce()
+	if !s.db.Exists("B") {
+		t.Fatal("quarantined agent was removed")
+	}
+	routes, _ := s.solver.RoutesSince("A", 0)
+	if r, _ := routeTo(routes, "C"); r.NextHop != "direct" {
+		t.Errorf("next hop to C via quarantined relay = %q, want direct", r.NextHop)
+	}
+	if w := doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=B"); w.Code != http.StatusOK {
+		t.Errorf("routes for quarantined agent status = %d, want 200", w.Code)
+	}
+	var agents AgentListResponse
+	w := doRequest(s, http.MethodGet, "/api/v1/agents")
+	if err := json.Unmarshal(w.Body.Bytes(), &agents); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for _, a := range agents.Agents {
+		if a.Quarantined != (a.AgentID == "B") {
+			t.Errorf("agent %s quarantined = %v", a.AgentID, a.Quarantined)
+		}
+	}
+	if data, _ := s.db.Get("B"); len(data.Metrics) != 1 {
+		t.Errorf("quarantined agent links = %v, want kept", data.Metrics)
+	}
+
+	// 隔离期结束后删除
+	storeB(now - 600)
+	s.cleaner.cleanOnce()
+	if s.db.Exists("B") {
+		t.Error("agent still present after quarantine period")
+	}
+}
@@ -0,0 +1,170 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// redisError Redis 返回的错误回复
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// redisClient 最小的 RESP2 客户端，只覆盖共享拓扑用到的命令
+// 单连接串行执行命令，连接出错后在下一次调用时重连
+type redisClient struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// newRedisClient 创建 Redis 客户端，首次执行命令时建立连接
+func newRedisClient(addr, password string, db int, timeout time.Duration) *redisClient {
+	return &redisClient{addr: addr, password: password, db: db, timeout: timeout}
+}
+
+// Do 执行一条命令并返回回复：string（状态）、int64、[]byte（nil 表示空）、[]interface{}，错误回复以 redisError 返回
+func (c *redisClient) Do(args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		if err := c.connectLocked(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.roundTripLocked(args)
+	var rerr redisError
+	if err != nil && !errors.As(err, &rerr) {
+		c.closeLocked()
+	}
+	return reply, err
+}
+
+// Close 关闭连接
+func (c *redisClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeLocked()
+	return nil
+}
+
+// connectLocked 建立连接并完成认证和选库，调用方需持有 c.mu
+func (c *redisClient) connectLocked() error {
+	conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to redis %s: %w", c.addr, err)
+	}
+	c.conn, c.rd = conn, bufio.NewReader(conn)
+
+	if c.password != "" {
+		if _, err := c.roundTripLocked([]string{"AUTH", c.password}); err != nil {
+			c.closeLocked()
+			return fmt.Errorf("redis AUTH failed: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := c.roundTripLocked([]string{"SELECT", strconv.Itoa(c.db)}); err != nil {
+			c.closeLocked()
+			return fmt.Errorf("redis SELECT failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// closeLocked 关闭连接，调用方需持有 c.mu
+func (c *redisClient) closeLocked() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+	c.conn, c.rd = nil, nil
+}
+
+// roundTripLocked 发送命令并读取一条回复，调用方需持有 c.mu
+func (c *redisClient) roundTripLocked(args []string) (interface{}, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readRESP(c.rd)
+}
+
+// readRESP 读取一条 RESP2 回复
+func readRESP(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed redis reply %q", line)
+	}
+	payload := line[1 : len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, redisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("malformed redis bulk length %q", payload)
+		}
+		if n < 0 {
+			return []byte(nil), nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("malformed redis array length %q", payload)
+		}
+		if n < 0 {
+			return []interface{}(nil), nil
+		}
+		items := make([]interface{}, 0, n)
+		for i := 0; i < n; i++ {
+			item, err := readRESP(rd)
+			var rerr redisError
+			if err != nil && !errors.As(err, &rerr) {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected redis reply type %q", line[0])
+	}
+}
@@ -0,0 +1,70 @@
+package controller
+
+// SetRelayLoadPenalty 设置中继负载惩罚：每有一个其他 Agent 以某节点为下一跳，经该节点中继的成本增加 penalty (ms)，0 表示关闭
+func (s *RouteSolver) SetRelayLoadPenalty(penalty float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.relayLoadPenalty = penalty
+}
+
+// RelayLoadPenalty 返回中继负载惩罚
+func (s *RouteSolver) RelayLoadPenalty() float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.relayLoadPenalty
+}
+
+// RelayLoads 统计每个节点被多少个 Agent 用作中继下一跳（按最近一次下发的路由）
+func (s *RouteSolver) RelayLoads() map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.relayLoadsLocked("")
+}
+
+// relayLoadsLocked 统计每个节点被多少个 Agent 用作中继下一跳，不计 exclude 自己，调用方需持有 s.mu
+func (s *RouteSolver) relayLoadsLocked(exclude string) map[string]int {
+	users := make(map[string]map[string]bool) // relay -> 以其为下一跳的 Agent
+	for source, routes := range s.currentRoutes {
+		if source == exclude {
+			continue
+		}
+		for _, vr := range routes {
+			hop := vr.route.NextHop
+			if hop == "" || hop == "direct" || hop == "blackhole" || hop == source {
+				continue
+			}
+			if users[hop] == nil {
+				users[hop] = make(map[string]bool)
+			}
+			users[hop][source] = true
+		}
+	}
+
+	loads := make(map[string]int, len(users))
+	for relay, sources := range users {
+		loads[relay] = len(sources)
+	}
+	return loads
+}
+
+// applyRelayLoad 按其他 Agent 的中继负载提高经各节点转发的成本
+//
+// 惩罚加在中继节点的出边上：以该节点为目的地的路径不经过其出边，不受影响，
+// 只有把它当作中继时才付出代价。这样连接最好的节点不会成为全网唯一的中继而压满上行带宽。
+// 负载来自上一轮下发的路由，迟滞保证负载小幅变化不会引起路由来回切换。
+func (s *RouteSolver) applyRelayLoad(g *Graph, sourceAgent string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.relayLoadPenalty <= 0 {
+		return
+	}
+	for relay, load := range s.relayLoadsLocked(sourceAgent) {
+		if relay == sourceAgent {
+			continue
+		}
+		for to, cost := range g.edges[relay] {
+			g.edges[relay][to] = cost + s.relayLoadPenalty*float64(load)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// ErrNoConfigPath 未设置配置文件路径，无法重载
+var ErrNoConfigPath = errors.New("config path is not set")
+
+// ConfigChange 一项被重载的配置
+type ConfigChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// ReloadResponse 配置重载响应
+type ReloadResponse struct {
+	Changes []ConfigChange `json:"changes"`
+}
+
+// SetConfigPath 设置配置文件路径，启用运行时重载
+func (s *Server) SetConfigPath(path string) {
+	s.configPath = path
+}
+
+// Reload 重新读取配置文件，将算法参数和陈旧阈值应用到运行中的组件
+// 其他配置项（监听地址、TLS、限流等）需要重启才能生效；actor 记录到审计日志
+func (s *Server) Reload(actor string) ([]ConfigChange, error) {
+	if s.configPath == "" {
+		return nil, ErrNoConfigPath
+	}
+
+	cfg, err := config.LoadControllerConfig(s.configPath)
+	if err != nil {
+		s.logger.Error("Config reload failed", logging.F("error", err.Error()))
+		return nil, err
+	}
+
+	changes := s.applyReloadable(cfg)
+	s.audit.Log(models.DefaultTenantID, AuditConfigReloaded, actor, s.configPath, map[string]interface{}{
+		"changes": changes,
+	})
+	return changes, nil
+}
+
+// applyReloadable 应用可热更新的配置，返回发生变化的项
+func (s *Server) applyReloadable(cfg *config.ControllerConfig) []ConfigChange {
+	changes := make([]ConfigChange, 0)
+
+	penaltyFactor, hysteresis := s.solver.Parameters()
+	if penaltyFactor != cfg.Algorithm.PenaltyFactor {
+		changes = append(changes, ConfigChange{
+			Field: "algorithm.penalty_factor",
+			Old:   fmt.Sprintf("%g", penaltyFactor),
+			New:   fmt.Sprintf("%g", cfg.Algorithm.PenaltyFactor),
+		})
+	}
+	if hysteresis != cfg.Algorithm.Hysteresis {
+		changes = append(changes, ConfigChange{
+			Field: "algorithm.hysteresis",
+			Old:   fmt.Sprintf("%g", hysteresis),
+			New:   fmt.Sprintf("%g", cfg.Algorithm.Hysteresis),
+		})
+	}
+	if degradation := s.solver.DegradationThreshold(); degradation != cfg.Algorithm.DegradationThreshold {
+		changes = append(changes, ConfigChange{
+			Field: "algorithm.degradation_threshold",
+			Old:   fmt.Sprintf("%g", degradation),
+			New:   fmt.Sprintf("%g", cfg.Algorithm.DegradationThreshold),
+		})
+	}
+	if jitterWeight := s.solver.JitterWeight(); jitterWeight != cfg.Algorithm.JitterWeight {
+		changes = append(changes, ConfigChange{
+			Field: "algorithm.jitter_weight",
+			Old:   fmt.Sprintf("%g", jitterWeight),
+			New:   fmt.Sprintf("%g", cfg.Algorithm.JitterWeight),
+		})
+	}
+	// 容量惩罚关闭时参考带宽不影响成本，不单独记为变更
+	if penalty, reference := s.solver.BandwidthPenalty(); penalty != cfg.Algorithm.BandwidthPenalty ||
+		(penalty > 0 && reference != cfg.Algorithm.BandwidthReferenceMbps) {
+		changes = append(changes, ConfigChange{
+			Field: "algorithm.bandwidth_penalty",
+			Old:   fmt.Sprintf("%g@%gMbps", penalty, reference),
+			New:   fmt.Sprintf("%g@%gMbps", cfg.Algorithm.BandwidthPenalty, cfg.Algorithm.BandwidthReferenceMbps),
+		})
+	}
+	if maxHops := s.solver.MaxHops(); maxHops != cfg.Algorithm.MaxHops {
+		changes = append(changes, ConfigChange{
+			Field: "algorithm.max_hops",
+			Old:   fmt.Sprintf("%d", maxHops),
+			New:   fmt.Sprintf("%d", cfg.Algorithm.MaxHops),
+		})
+	}
+	if mode := s.solver.LinkReconciliation(); mode != cfg.Algorithm.LinkReconciliation {
+		changes = append(changes, ConfigChange{
+			Field: "algorithm.link_reconciliation",
+			Old:   mode,
+			New:   cfg.Algorithm.LinkReconciliation,
+		})
+	}
+	if minSamples := s.solver.MinSamples(); minSamples != cfg.Algorithm.MinSamples {
+		changes = append(changes, ConfigChange{
+			Field: "algorithm.min_samples",
+			Old:   fmt.Sprintf("%d", minSamples),
+			New:   fmt.Sprintf("%d", cfg.Algorithm.MinSamples),
+		})
+	}
+	if penalty := s.solver.RelayLoadPenalty(); penalty != cfg.Algorithm.RelayLoadPenalty {
+		changes = append(changes, ConfigChange{
+			Field: "algorithm.relay_load_penalty",
+			Old:   fmt.Sprintf("%g", penalty),
+			New:   fmt.Sprintf("%g", cfg.Algorithm.RelayLoadPenalty),
+		})
+	}
+	if weights := s.solver.MetricWeights(); weights != cfg.Algorithm.Weights {
+		changes = append(changes, ConfigChange{
+			Field: "algorithm.weights",
+			Old:   formatMetricWeights(weights),
+			New:   formatMetricWeights(cfg.Algorithm.Weights),
+		})
+	}
+	if sla := s.solver.SLA(); sla != cfg.Algorithm.SLA {
+		changes = append(changes, ConfigChange{
+			Field: "algorithm.sla",
+			Old:   formatSLA(sla),
+			New:   formatSLA(cfg.Algorithm.SLA),
+		})
+	}
+	if classes := s.solver.TrafficClasses(); !reflect.DeepEqual(classes, cfg.Algorithm.TrafficClasses) &&
+		(len(classes) > 0 || len(cfg.Algorithm.TrafficClasses) > 0) {
+		changes = append(changes, ConfigChange{
+			Field: "algorithm.traffic_classes",
+			Old:   formatTrafficClasses(classes),
+			New:   formatTrafficClasses(cfg.Algorithm.TrafficClasses),
+		})
+	}
+	for _, t := range s.allTenants() {
+		t.solver.SetParameters(cfg.Algorithm.PenaltyFactor, cfg.Algorithm.Hysteresis)
+		t.solver.SetDegradationThreshold(cfg.Algorithm.DegradationThreshold)
+		t.solver.SetJitterWeight(cfg.Algorithm.JitterWeight)
+		t.solver.SetBandwidthPenalty(cfg.Algorithm.BandwidthPenalty, cfg.Algorithm.BandwidthReferenceMbps)
+		t.solver.SetMaxHops(cfg.Algorithm.MaxHops)
+		t.solver.SetLinkReconciliation(cfg.Algorithm.LinkReconciliation)
+		t.solver.SetMinSamples(cfg.Algorithm.MinSamples)
+		t.solver.SetRelayLoadPenalty(cfg.Algorithm.RelayLoadPenalty)
+		t.solver.SetMetricWeights(cfg.Algorithm.Weights)
+		t.solver.SetSLA(cfg.Algorithm.SLA)
+		t.solver.SetTrafficClasses(cfg.Algorithm.TrafficClasses)
+	}
+
+	threshold := s.cleaner.Threshold()
+	if threshold != cfg.Topology.StaleThreshold {
+		changes = append(changes, ConfigChange{
+			Field: "topology.stale_threshold",
+			Old:   threshold.String(),
+			New:   cfg.Topology.StaleThreshold.String(),
+		})
+	}
+	if multiplier := s.cleaner.Policy().IntervalMultiplier; multiplier != cfg.Topology.IntervalMultiplier {
+		changes = append(changes, ConfigChange{
+			Field: "topology.interval_multiplier",
+			Old:   fmt.Sprintf("%g", multiplier),
+			New:   fmt.Sprintf("%g", cfg.Topology.IntervalMultiplier),
+		})
+	}
+	if linkThreshold := s.cleaner.Policy().LinkThreshold; linkThreshold != cfg.Topology.LinkStaleThreshold {
+		changes = append(changes, ConfigChange{
+			Field: "topology.link_stale_threshold",
+			Old:   linkThreshold.String(),
+			New:   cfg.Topology.LinkStaleThreshold.String(),
+		})
+	}
+	if quarantine := s.cleaner.Policy().Quarantine; quarantine != cfg.Topology.QuarantinePeriod {
+		changes = append(changes, ConfigChange{
+			Field: "topology.quarantine_period",
+			Old:   quarantine.String(),
+			New:   cfg.Topology.QuarantinePeriod.String(),
+		})
+	}
+	if retention := s.cleaner.Retention(); retention != cfg.Topology.Retention {
+		changes = append(changes, ConfigChange{
+			Field: "topology.retention",
+			Old:   fmt.Sprintf("%+v", retention),
+			New:   fmt.Sprintf("%+v", cfg.Topology.Retention),
+		})
+	}
+	for _, t := range s.allTenants() {
+		t.db.SetHistorySize(cfg.Topology.Retention.MaxPoints)
+		t.cleaner.SetRetention(cfg.Topology.Retention)
+		t.cleaner.SetThreshold(cfg.Topology.StaleThreshold)
+		t.cleaner.SetIntervalMultiplier(cfg.Topology.IntervalMultiplier)
+		t.cleaner.SetLinkThreshold(cfg.Topology.LinkStaleThreshold)
+		t.cleaner.SetQuarantine(cfg.Topology.QuarantinePeriod)
+		t.solver.SetStalePolicy(t.cleaner.Policy())
+	}
+
+	for _, change := range changes {
+		s.logger.Info("Config reloaded",
+			logging.F("field", change.Field),
+			logging.F("old", change.Old),
+			logging.F("new", change.New),
+		)
+	}
+	return changes
+}
+
+// handleReload 重新加载配置文件
+func (s *Server) handleReload(c *gin.Context) {
+	changes, err := s.Reload(adminActor(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Detail: fmt.Sprintf("Failed to reload config: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ReloadResponse{Changes: changes})
+}
+
+// formatMetricWeights 将指标权重格式化为变更记录中的字符串
+func formatMetricWeights(w config.MetricWeights) string {
+	return fmt.Sprintf("rtt=%g,loss=%g,jitter=%g,bandwidth=%g", w.RTT, w.Loss, w.Jitter, w.Bandwidth)
+}
+
+// formatSLA 将 SLA 阈值格式化为变更记录中的字符串
+func formatSLA(sla config.SLAConfig) string {
+	return fmt.Sprintf("max_loss_rate=%g,max_rtt_ms=%g,max_jitter_ms=%g", sla.MaxLossRate, sla.MaxRTTMs, sla.MaxJitterMs)
+}
+
+// formatTrafficClasses 将流量类别格式化为变更记录中的字符串
+func formatTrafficClasses(classes []config.TrafficClassConfig) string {
+	parts := make([]string, 0, len(classes))
+	for _, c := range classes {
+		parts = append(parts, fmt.Sprintf("%s{penalty_factor=%g,jitter_weight=%g,bandwidth_penalty=%g}",
+			c.Name, c.PenaltyFactor, c.JitterWeight, c.BandwidthPenalty))
+	}
+	return strings.Join(parts, ",")
+}
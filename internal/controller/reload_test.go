@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReloadAppliesAlgorithmParameters(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Admin.Token = "secret"
+
+	path := filepath.Join(t.TempDir(), "controller_config.yaml")
+	content := `
+algorithm:
+  penalty_factor: 250
+  hysteresis: 0.15
+topology:
+  stale_threshold: 90s
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	s.SetConfigPath(path)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/reload", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	s.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	var resp ReloadResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	// hysteresis 未变化，不应出现在变更列表中
+	if len(resp.Changes) != 2 {
+		t.Fatalf("changes = %+v, want penalty_factor and stale_threshold", resp.Changes)
+	}
+
+	if penalty, hysteresis := s.solver.Parameters(); penalty != 250 || hysteresis != 0.15 {
+		t.Errorf("solver parameters = (%v, %v), want (250, 0.15)", penalty, hysteresis)
+	}
+	if got := s.cleaner.Threshold(); got != 90*time.Second {
+		t.Errorf("cleaner threshold = %v, want 90s", got)
+	}
+}
+
+func TestReloadInvalidConfigKeepsCurrentValues(t *testing.T) {
+	s := newTestServer(t)
+
+	path := filepath.Join(t.TempDir(), "controller_config.yaml")
+	if err := os.WriteFile(path, []byte("algorithm:\n  hysteresis: 2\n"), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	s.SetConfigPath(path)
+
+	if _, err := s.Reload("test"); err == nil {
+		t.Fatal("Reload() expected validation error")
+	}
+	if _, hysteresis := s.solver.Parameters(); hysteresis != 0.15 {
+		t.Errorf("hysteresis = %v, want unchanged 0.15", hysteresis)
+	}
+}
+
+func TestReloadWithoutConfigPath(t *testing.T) {
+	s := newTestServer(t)
+	if _, err := s.Reload("test"); err != ErrNoConfigPath {
+		t.Errorf("Reload() error = %v, want ErrNoConfigPath", err)
+	}
+}
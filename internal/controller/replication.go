@@ -0,0 +1,209 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// ReplicationSnapshotPath 主节点导出复制快照的路径
+const ReplicationSnapshotPath = "/api/v1/replication/snapshot"
+
+// ReplicationSnapshot 副本间同步的完整状态，包含所有租户
+type ReplicationSnapshot struct {
+	GeneratedAt int64             `json:"generated_at"`
+	Tenants     []PersistedTenant `json:"tenants"`
+}
+
+// snapshot 生成当前状态的复制快照
+func (s *Server) snapshot() ReplicationSnapshot {
+	return ReplicationSnapshot{
+		GeneratedAt: time.Now().Unix(),
+		Tenants:     s.exportTenants(),
+	}
+}
+
+// replicationAuthMiddleware 校验复制接口的 Bearer Token
+func (s *Server) replicationAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := s.cfg.Replication.Token
+		auth := c.GetHeader("Authorization")
+		provided := strings.TrimPrefix(auth, "Bearer ")
+		if provided == auth || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+				Detail: "Invalid or missing replication token",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// handleReplicationSnapshot 导出复制快照
+func (s *Server) handleReplicationSnapshot(c *gin.Context) {
+	c.JSON(http.StatusOK, s.snapshot())
+}
+
+// applySnapshot 合并复制快照：各租户的拓扑数据按时间取新，求解器状态整体替换
+// 返回实际更新的 Agent 数量
+func (s *Server) applySnapshot(snap *ReplicationSnapshot) int {
+	return s.importTenants(snap.Tenants, ActorReplication)
+}
+
+// Replicator 备节点的复制循环，定期从主节点拉取快照
+type Replicator struct {
+	server   *Server
+	url      string
+	token    string
+	interval time.Duration
+	client   *http.Client
+	logger   logging.Logger
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+
+	lastSync  int64 // 最近一次成功同步的 Unix 时间，0 表示从未同步
+	syncCount int64
+	failCount int64
+}
+
+// NewReplicator 创建备节点复制器
+func NewReplicator(server *Server, cfg config.ReplicationConfig, logger logging.Logger) *Replicator {
+	if logger == nil {
+		logger = logging.NewNopLogger()
+	}
+	return &Replicator{
+		server:   server,
+		url:      strings.TrimSuffix(cfg.PrimaryURL, "/") + ReplicationSnapshotPath,
+		token:    cfg.Token,
+		interval: cfg.Interval,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		logger:   logger,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start 启动复制循环，立即执行一次同步
+func (r *Replicator) Start() {
+	r.wg.Add(1)
+	go r.run()
+	r.logger.Info("Replicator started",
+		logging.F("primary", r.url),
+		logging.F("interval", r.interval.String()),
+	)
+}
+
+// Stop 停止复制循环
+func (r *Replicator) Stop() {
+	close(r.stopCh)
+	r.wg.Wait()
+	r.logger.Info("Replicator stopped",
+		logging.F("total_syncs", atomic.LoadInt64(&r.syncCount)),
+	)
+}
+
+// run 复制循环
+func (r *Replicator) run() {
+	defer r.wg.Done()
+
+	r.syncLogged()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.syncLogged()
+		case <-r.stopCh:
+			return
+		}
+	}
+}
+
+// syncLogged 执行一次同步并记录结果
+func (r *Replicator) syncLogged() {
+	if err := r.SyncOnce(); err != nil {
+		atomic.AddInt64(&r.failCount, 1)
+		r.logger.Warn("Replication sync failed",
+			logging.F("primary", r.url),
+			logging.F("error", err.Error()),
+		)
+	}
+}
+
+// SyncOnce 拉取并合并一次主节点快照
+func (r *Replicator) SyncOnce() error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.client.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+r.token)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("primary returned status %d", resp.StatusCode)
+	}
+
+	var snap ReplicationSnapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snap); err != nil {
+		return fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+
+	updated := r.server.applySnapshot(&snap)
+	atomic.StoreInt64(&r.lastSync, time.Now().Unix())
+	atomic.AddInt64(&r.syncCount, 1)
+	r.logger.Debug("Replication snapshot applied",
+		logging.F("tenants", len(snap.Tenants)),
+		logging.F("updated", updated),
+	)
+	return nil
+}
+
+// LastSync 返回最近一次成功同步的时间，从未同步时返回零值
+func (r *Replicator) LastSync() time.Time {
+	ts := atomic.LoadInt64(&r.lastSync)
+	if ts == 0 {
+		return time.Time{}
+	}
+	return time.Unix(ts, 0)
+}
+
+// replicationHealth 返回复制组件的就绪状态
+// 备节点从未成功同步时视为未就绪，避免在没有拓扑数据时接管
+func (s *Server) replicationHealth() models.ComponentHealth {
+	health := models.NewComponentHealth(models.HealthStatusHealthy)
+	health.Details["role"] = s.cfg.Replication.Role
+	if s.replicator == nil {
+		return health
+	}
+
+	last := s.replicator.LastSync()
+	if last.IsZero() {
+		health.Status = models.HealthStatusUnhealthy
+		health.Details["error"] = "no snapshot received from primary yet"
+		return health
+	}
+	health.Details["last_sync"] = last.UTC().Format(time.RFC3339)
+	health.Details["sync_failures"] = atomic.LoadInt64(&s.replicator.failCount)
+	return health
+}
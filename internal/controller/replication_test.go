@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// newReplicationPrimary 创建启用复制接口的主节点测试服务器
+func newReplicationPrimary(t *testing.T) *Server {
+	t.Helper()
+
+	cfg := &config.ControllerConfig{
+		Algorithm:   config.AlgorithmConfig{PenaltyFactor: 100, Hysteresis: 0.15, DegradationThreshold: 0.5},
+		Topology:    config.TopologyConfig{StaleThreshold: 60 * time.Second},
+		Replication: config.ReplicationConfig{Role: config.ReplicationRolePrimary, Token: "secret"},
+		Tenants:     config.TenantsConfig{MaxTenants: 100},
+		Logging:     config.LoggingConfig{Level: "ERROR"},
+	}
+	s, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+func TestReplicationSnapshotAuth(t *testing.T) {
+	if w := doRequest(newTestServer(t), http.MethodGet, ReplicationSnapshotPath); w.Code != http.StatusNotFound {
+		t.Errorf("without replication token: status = %d, want 404", w.Code)
+	}
+
+	s := newReplicationPrimary(t)
+	if w := doRequest(s, http.MethodGet, ReplicationSnapshotPath); w.Code != http.StatusUnauthorized {
+		t.Errorf("missing bearer token: status = %d, want 401", w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, ReplicationSnapshotPath, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	s.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("valid token: status = %d, want 200", w.Code)
+	}
+}
+
+func TestReplicatorSyncOnce(t *testing.T) {
+	primary := newReplicationPrimary(t)
+
+	storeChain(primary.db)
+	primary.solver.SetPolicy(models.RoutePolicy{AgentID: "A", AvoidRelays: []string{"C"}})
+	primary.solver.ComputeRoutes(primary.db, "A")
+	acme, _ := primary.tenantFor("acme")
+	storeChain(acme.db)
+	acme.solver.ComputeRoutes(acme.db, "A")
+
+	ts := httptest.NewServer(primary.router)
+	defer ts.Close()
+
+	standby := newTestServer(t)
+	// 备节点已有更新的 A 数据，不应被主节点的旧数据覆盖
+	newer := time.Now().Unix() + 60
+	standby.db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: newer})
+
+	r := NewReplicator(standby, config.ReplicationConfig{
+		PrimaryURL: ts.URL + "/",
+		Token:      "secret",
+		Interval:   time.Hour,
+		Timeout:    time.Second,
+	}, nil)
+	if !r.LastSync().IsZero() {
+		t.Fatal("LastSync() should be zero before first sync")
+	}
+	if err := r.SyncOnce(); err != nil {
+		t.Fatalf("SyncOnce() error = %v", err)
+	}
+	if r.LastSync().IsZero() {
+		t.Error("LastSync() should be set after sync")
+	}
+
+	if got, want := standby.db.Count(), primary.db.Count(); got != want {
+		t.Errorf("standby node count = %d, want %d", got, want)
+	}
+	a, _ := standby.db.Get("A")
+	if a.Timestamp.Unix() != newer || len(a.Metrics) != 0 {
+		t.Errorf("newer local data for A was overwritten: %+v", a)
+	}
+
+	primaryState := primary.solver.ExportState()
+	standbyState := standby.solver.ExportState()
+	if len(standbyState.PreviousCosts) == 0 || len(standbyState.PreviousCosts) != len(primaryState.PreviousCosts) {
+		t.Errorf("previous costs not replicated: got %d, want %d",
+			len(standbyState.PreviousCosts), len(primaryState.PreviousCosts))
+	}
+	for key, hop := range primaryState.PreviousHops {
+		if standbyState.PreviousHops[key] != hop {
+			t.Errorf("previous hop %s = %q, want %q", key, standbyState.PreviousHops[key], hop)
+		}
+	}
+	if _, ok := standby.solver.GetPolicy("A"); !ok {
+		t.Error("policy for A not replicated")
+	}
+
+	// 非默认租户同样复制，故障切换后不会丢失
+	standbyAcme, ok := standby.lookupTenant("acme")
+	if !ok {
+		t.Fatal("tenant acme not replicated")
+	}
+	if got, want := standbyAcme.db.Count(), acme.db.Count(); got != want {
+		t.Errorf("standby acme node count = %d, want %d", got, want)
+	}
+	if len(standbyAcme.solver.ExportState().PreviousHops) == 0 {
+		t.Error("acme solver state not replicated")
+	}
+}
+
+// TestReplicatorSyncKeepsSamples 备节点复制链路的样本计数和 RTT 历史，提升为主节点后 min_samples 门限不会撤回中继路由
+func TestReplicatorSyncKeepsSamples(t *testing.T) {
+	primary := newReplicationPrimary(t)
+	primary.db.SetHistorySize(60)
+	primary.solver.SetMinSamples(3)
+	storeWarmTriangle(primary.db, 3)
+	if route, ok := routeTo(primary.solver.ComputeRoutes(primary.db, "A"), "B"); !ok || route.NextHop != "C" {
+		t.Fatalf("primary route to B = %+v, want via C", route)
+	}
+
+	ts := httptest.NewServer(primary.router)
+	defer ts.Close()
+
+	standby := newTestServer(t)
+	standby.db.SetHistorySize(60)
+	standby.solver.SetMinSamples(3)
+	r := NewReplicator(standby, config.ReplicationConfig{
+		PrimaryURL: ts.URL,
+		Token:      "secret",
+		Interval:   time.Hour,
+		Timeout:    time.Second,
+	}, nil)
+	if err := r.SyncOnce(); err != nil {
+		t.Fatalf("SyncOnce() error = %v", err)
+	}
+
+	a, ok := standby.db.Get("A")
+	if !ok {
+		t.Fatal("agent A not replicated")
+	}
+	for _, target := range []string{"B", "C"} {
+		if m := a.Metrics[target]; m == nil || m.Samples != 3 || len(m.RTTHistory) != 3 {
+			t.Errorf("link A->%s on standby = %+v, want 3 samples and history", target, m)
+		}
+	}
+
+	// 备节点接管后按复制的状态继续计算，中继路由保持不变
+	if route, ok := routeTo(standby.solver.ComputeRoutes(standby.db, "A"), "B"); ok && route.NextHop != "C" {
+		t.Errorf("standby route to B = %+v, want unchanged", route)
+	}
+}
+
+func TestReplicatorSyncOnceBadToken(t *testing.T) {
+	primary := newReplicationPrimary(t)
+
+	ts := httptest.NewServer(primary.router)
+	defer ts.Close()
+
+	r := NewReplicator(newTestServer(t), config.ReplicationConfig{
+		PrimaryURL: ts.URL,
+		Token:      "wrong",
+		Timeout:    time.Second,
+	}, nil)
+	if err := r.SyncOnce(); err == nil {
+		t.Fatal("SyncOnce() with wrong token should fail")
+	}
+	if !r.LastSync().IsZero() {
+		t.Error("LastSync() should stay zero after failed sync")
+	}
+}
+
+func TestReadyzStandbyNotSynced(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Replication = config.ReplicationConfig{Role: config.ReplicationRoleStandby}
+	s.replicator = NewReplicator(s, config.ReplicationConfig{PrimaryURL: "http://127.0.0.1:1"}, nil)
+
+	if w := doRequest(s, http.MethodGet, "/readyz"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("standby before first sync: status = %d, want 503", w.Code)
+	}
+}
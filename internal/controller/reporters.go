@@ -0,0 +1,83 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// ReporterEntry 一个上报了到目标链路数据的 Agent
+type ReporterEntry struct {
+	AgentID string `json:"agent_id"`
+	// Reachable 测得 RTT 且未完全丢包
+	Reachable  bool   `json:"reachable"`
+	Stale      bool   `json:"stale"` // 该 Agent 的数据已过期
+	MeasuredAt string `json:"measured_at,omitempty"`
+	Link       Metric `json:"link"`
+}
+
+// ReportersResponse 反向查询响应
+type ReportersResponse struct {
+	TargetIP  string          `json:"target_ip"`
+	Count     int             `json:"count"`
+	Reporters []ReporterEntry `json:"reporters"`
+}
+
+// handleReporters 查询哪些 Agent 上报了到 target_ip 的链路及链路质量，用于排查部分可达的站点
+// 可达的排在前面，按 RTT 升序
+func (s *Server) handleReporters(c *gin.Context) {
+	targetIP := c.Query("target_ip")
+	if targetIP == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: "target_ip is required",
+		})
+		return
+	}
+
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	policy := t.cleaner.Policy()
+	reporters := t.db.GetReportersOf(targetIP)
+
+	entries := make([]ReporterEntry, 0, len(reporters))
+	for agentID, m := range reporters {
+		entry := ReporterEntry{
+			AgentID:   agentID,
+			Reachable: m.RTT != nil && m.Loss < 1,
+			Link:      topologyMetric(m),
+		}
+		if !m.UpdatedAt.IsZero() {
+			entry.MeasuredAt = m.UpdatedAt.Format(time.RFC3339)
+		}
+		if data, ok := t.db.Get(agentID); ok {
+			entry.Stale = now.Sub(data.Timestamp) > policy.For(data)
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Reachable != b.Reachable {
+			return a.Reachable
+		}
+		if a.Link.RTT != b.Link.RTT {
+			return a.Link.RTT < b.Link.RTT
+		}
+		return a.AgentID < b.AgentID
+	})
+
+	c.JSON(http.StatusOK, ReportersResponse{
+		TargetIP:  targetIP,
+		Count:     len(entries),
+		Reporters: entries,
+	})
+}
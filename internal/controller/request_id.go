@@ -0,0 +1,41 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// 上下文键：请求 ID 和携带请求 ID 的 logger
+const (
+	ctxKeyRequestID = "sdwan.request_id"
+	ctxKeyLogger    = "sdwan.logger"
+)
+
+// requestIDMiddleware 为每个请求分配 X-Request-ID（合法时沿用客户端传入的值）
+// 请求 ID 写入响应头，并附加到该请求的所有日志字段
+func (s *Server) requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(models.RequestIDHeader)
+		if !models.ValidRequestID(id) {
+			id = models.NewRequestID()
+		}
+
+		c.Set(ctxKeyRequestID, id)
+		c.Set(ctxKeyLogger, s.logger.WithFields(logging.F("request_id", id)))
+		c.Header(models.RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// reqLogger 返回当前请求的 logger，未经过 requestIDMiddleware 时返回全局 logger
+func (s *Server) reqLogger(c *gin.Context) logging.Logger {
+	if v, ok := c.Get(ctxKeyLogger); ok {
+		if logger, ok := v.(logging.Logger); ok {
+			return logger
+		}
+	}
+	return s.logger
+}
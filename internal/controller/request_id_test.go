@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		name     string
+		incoming string
+		wantSame bool
+	}{
+		{"generated when missing", "", false},
+		{"honors valid incoming id", "agent-10.254.0.1:abc_123", true},
+		{"replaces unsafe incoming id", "bad id\nwith newline", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+			if tt.incoming != "" {
+				req.Header.Set(models.RequestIDHeader, tt.incoming)
+			}
+			s.router.ServeHTTP(w, req)
+
+			got := w.Header().Get(models.RequestIDHeader)
+			if !models.ValidRequestID(got) {
+				t.Fatalf("response %s = %q is not a valid request id", models.RequestIDHeader, got)
+			}
+			if (got == tt.incoming) != tt.wantSame {
+				t.Errorf("response %s = %q, incoming %q, wantSame %v", models.RequestIDHeader, got, tt.incoming, tt.wantSame)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// defaultRouteHistorySize 默认保留的路由变化记录条数
+const defaultRouteHistorySize = 1000
+
+// RouteHistory 路由决策历史，固定容量的环形缓冲区
+type RouteHistory struct {
+	mu       sync.RWMutex
+	entries  []models.RouteChange
+	maxSize  int
+	position int
+	count    int
+}
+
+// NewRouteHistory 创建路由决策历史
+func NewRouteHistory(size int) *RouteHistory {
+	if size <= 0 {
+		size = defaultRouteHistorySize
+	}
+	return &RouteHistory{
+		entries: make([]models.RouteChange, size),
+		maxSize: size,
+	}
+}
+
+// Record 记录一次路由变化，容量已满时覆盖最旧的记录
+func (h *RouteHistory) Record(change models.RouteChange) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.entries[h.position] = change
+	h.position = (h.position + 1) % h.maxSize
+	if h.count < h.maxSize {
+		h.count++
+	}
+}
+
+// Query 按时间倒序返回路由变化记录
+// source 为空时返回所有 Agent 的记录，limit <= 0 表示不限制条数
+func (h *RouteHistory) Query(source string, limit int) []models.RouteChange {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	result := make([]models.RouteChange, 0)
+	for i := 0; i < h.count; i++ {
+		idx := (h.position - 1 - i + h.maxSize) % h.maxSize
+		entry := h.entries[idx]
+		if source != "" && entry.Source != source {
+			continue
+		}
+		result = append(result, entry)
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+	}
+	return result
+}
+
+// PruneBefore 删除早于 cutoff 的记录，返回删除的条数
+func (h *RouteHistory) PruneBefore(cutoff time.Time) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	pruned := 0
+	for h.count > 0 {
+		oldest := (h.position - h.count + h.maxSize) % h.maxSize
+		if h.entries[oldest].Timestamp >= cutoff.Unix() {
+			break
+		}
+		h.entries[oldest] = models.RouteChange{}
+		h.count--
+		pruned++
+	}
+	return pruned
+}
+
+// CountFlapsSince 统计指定时间之后下一跳真正发生变化的次数（不含首次下发）
+func (h *RouteHistory) CountFlapsSince(since time.Time) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	cutoff := since.Unix()
+	count := 0
+	for i := 0; i < h.count; i++ {
+		entry := h.entries[(h.position-1-i+h.maxSize)%h.maxSize]
+		if entry.Timestamp < cutoff {
+			continue
+		}
+		if entry.OldNextHop != "" && entry.OldNextHop != entry.NewNextHop {
+			count++
+		}
+	}
+	return count
+}
+
+// Len 返回当前记录数
+func (h *RouteHistory) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.count
+}
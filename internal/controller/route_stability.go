@@ -0,0 +1,109 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// stabilityWindow 按目的地统计路由变化的最长时间窗口
+	stabilityWindow = 24 * time.Hour
+
+	// maxStabilityEvents 每条路由最多保留的变化时间点，超出后丢弃最旧的，计数在该值处饱和
+	maxStabilityEvents = 1024
+)
+
+// RouteStabilityEntry 单条 source->target 路由的稳定性统计
+type RouteStabilityEntry struct {
+	Source       string `json:"source"`
+	Target       string `json:"target"`
+	Changes1h    int    `json:"changes_1h"`
+	Changes24h   int    `json:"changes_24h"`
+	TotalChanges uint64 `json:"total_changes"`
+	LastChange   int64  `json:"last_change"`
+}
+
+// routeStabilityState 单条路由的变化记录
+type routeStabilityState struct {
+	source string
+	target string
+	events []int64 // 最近 stabilityWindow 内的变化时间 (Unix 秒)，按时间递增
+	total  uint64
+}
+
+// RouteStability 按 source->target 统计下一跳变化次数
+//
+// 路由决策历史是全网共享的环形缓冲区，抖动频繁时很快被覆盖，无法覆盖一天的窗口；
+// 这里为每条路由单独保留最近一天的变化时间点，用于找出长期抖动的链路。
+type RouteStability struct {
+	mu     sync.Mutex
+	routes map[string]*routeStabilityState // "source->target" -> 变化记录
+}
+
+// NewRouteStability 创建路由稳定性统计
+func NewRouteStability() *RouteStability {
+	return &RouteStability{routes: make(map[string]*routeStabilityState)}
+}
+
+// Record 记录一次下一跳变化
+func (r *RouteStability) Record(source, target string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := routeKey(source, target)
+	state, ok := r.routes[key]
+	if !ok {
+		state = &routeStabilityState{source: source, target: target}
+		r.routes[key] = state
+	}
+	state.events = append(state.events, at.Unix())
+	if len(state.events) > maxStabilityEvents {
+		state.events = append(state.events[:0], state.events[len(state.events)-maxStabilityEvents:]...)
+	}
+	state.total++
+}
+
+// Snapshot 返回发生过变化的路由的统计，按最近一小时、最近一天的变化次数降序排列
+// 超出统计窗口的变化时间点在此时清理，total_changes 为 Controller 启动以来的累计值
+func (r *RouteStability) Snapshot(now time.Time) []RouteStabilityEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dayCutoff := now.Add(-stabilityWindow).Unix()
+	hourCutoff := now.Add(-flapWindow).Unix()
+
+	entries := make([]RouteStabilityEntry, 0, len(r.routes))
+	for _, state := range r.routes {
+		i := sort.Search(len(state.events), func(i int) bool { return state.events[i] >= dayCutoff })
+		state.events = state.events[i:]
+
+		entry := RouteStabilityEntry{
+			Source:       state.source,
+			Target:       state.target,
+			Changes24h:   len(state.events),
+			TotalChanges: state.total,
+		}
+		if n := len(state.events); n > 0 {
+			entry.LastChange = state.events[n-1]
+			entry.Changes1h = n - sort.Search(n, func(i int) bool { return state.events[i] >= hourCutoff })
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Changes1h != b.Changes1h {
+			return a.Changes1h > b.Changes1h
+		}
+		if a.Changes24h != b.Changes24h {
+			return a.Changes24h > b.Changes24h
+		}
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		return a.Target < b.Target
+	})
+	return entries
+}
@@ -0,0 +1,186 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// routeStreamBuffer 每个订阅通道的缓冲大小
+const routeStreamBuffer = 16
+
+// routePushDebounce 遥测触发路由推送的合并窗口，窗口内的多次触发只计算一次
+const routePushDebounce = 100 * time.Millisecond
+
+// RouteStreamHub 路由推送中心，管理通过流式连接订阅路由更新的 Agent
+type RouteStreamHub struct {
+	mu     sync.RWMutex
+	subs   map[string]map[chan models.RouteResponse]struct{} // agent_id -> subscribers
+	closed bool
+}
+
+// NewRouteStreamHub 创建路由推送中心
+func NewRouteStreamHub() *RouteStreamHub {
+	return &RouteStreamHub{
+		subs: make(map[string]map[chan models.RouteResponse]struct{}),
+	}
+}
+
+// Subscribe 为指定 Agent 注册一个订阅通道
+// 推送中心已关闭时返回 nil
+func (h *RouteStreamHub) Subscribe(agentID string) chan models.RouteResponse {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil
+	}
+
+	ch := make(chan models.RouteResponse, routeStreamBuffer)
+	if h.subs[agentID] == nil {
+		h.subs[agentID] = make(map[chan models.RouteResponse]struct{})
+	}
+	h.subs[agentID][ch] = struct{}{}
+	return ch
+}
+
+// Unsubscribe 注销订阅通道并关闭它
+func (h *RouteStreamHub) Unsubscribe(agentID string, ch chan models.RouteResponse) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subs, ok := h.subs[agentID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[ch]; !ok {
+		return
+	}
+	delete(subs, ch)
+	close(ch)
+	if len(subs) == 0 {
+		delete(h.subs, agentID)
+	}
+}
+
+// Publish 向指定 Agent 的所有订阅者推送路由更新，update 携带变化的路由和路由集版本
+// 订阅者缓冲区已满时丢弃本次推送（Agent 仍会通过轮询获取路由），返回丢弃的数量
+func (h *RouteStreamHub) Publish(agentID string, update models.RouteResponse) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	dropped := 0
+	for ch := range h.subs[agentID] {
+		select {
+		case ch <- update:
+		default:
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// SubscribedAgents 返回当前有订阅者的 Agent ID 列表
+func (h *RouteStreamHub) SubscribedAgents() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ids := make([]string, 0, len(h.subs))
+	for id := range h.subs {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// SubscriberCount 返回订阅者总数
+func (h *RouteStreamHub) SubscriberCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	count := 0
+	for _, subs := range h.subs {
+		count += len(subs)
+	}
+	return count
+}
+
+// Close 关闭所有订阅通道，之后的订阅请求将被拒绝
+func (h *RouteStreamHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for _, subs := range h.subs {
+		for ch := range subs {
+			close(ch)
+		}
+	}
+	h.subs = make(map[string]map[chan models.RouteResponse]struct{})
+}
+
+// routePushWorker 在后台执行路由推送，遥测请求只负责触发，不在请求路径上运行 Dijkstra
+// 合并窗口内的多次触发只执行一次 push；推送期间的新触发会在推送结束后再执行一次
+type routePushWorker struct {
+	push    func()
+	delay   time.Duration
+	trigger chan struct{}
+	stopCh  chan struct{}
+	stop    sync.Once
+	wg      sync.WaitGroup
+}
+
+// newRoutePushWorker 创建并启动路由推送任务
+func newRoutePushWorker(delay time.Duration, push func()) *routePushWorker {
+	w := &routePushWorker{
+		push:    push,
+		delay:   delay,
+		trigger: make(chan struct{}, 1),
+		stopCh:  make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w
+}
+
+// Trigger 请求一次推送，已有待执行的推送时合并，不会阻塞
+func (w *routePushWorker) Trigger() {
+	select {
+	case w.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Stop 停止推送任务，放弃尚未执行的推送
+func (w *routePushWorker) Stop() {
+	w.stop.Do(func() { close(w.stopCh) })
+	w.wg.Wait()
+}
+
+// run 推送循环
+func (w *routePushWorker) run() {
+	defer w.wg.Done()
+
+	timer := time.NewTimer(w.delay)
+	timer.Stop()
+	for {
+		select {
+		case <-w.trigger:
+		case <-w.stopCh:
+			return
+		}
+
+		timer.Reset(w.delay)
+		select {
+		case <-timer.C:
+		case <-w.stopCh:
+			timer.Stop()
+			return
+		}
+		w.push()
+	}
+}
@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+func TestRouteStreamHubPublish(t *testing.T) {
+	hub := NewRouteStreamHub()
+
+	ch := hub.Subscribe("A")
+	other := hub.Subscribe("B")
+
+	update := models.RouteResponse{Routes: []models.RouteConfig{{DstCIDR: "C/32", NextHop: "B", Reason: "optimized_path"}}, Version: 3}
+	if dropped := hub.Publish("A", update); dropped != 0 {
+		t.Errorf("Publish dropped %d updates, want 0", dropped)
+	}
+
+	select {
+	case got := <-ch:
+		if len(got.Routes) != 1 || got.Routes[0].NextHop != "B" || got.Version != 3 {
+			t.Errorf("Received %+v, want %+v", got, update)
+		}
+	default:
+		t.Fatal("Subscriber for A did not receive update")
+	}
+
+	select {
+	case got := <-other:
+		t.Errorf("Subscriber for B should not receive A's update, got %v", got)
+	default:
+	}
+}
+
+func TestRouteStreamHubDropsWhenFull(t *testing.T) {
+	hub := NewRouteStreamHub()
+	hub.Subscribe("A")
+
+	update := models.RouteResponse{Routes: []models.RouteConfig{{DstCIDR: "B/32", NextHop: "direct", Reason: "default"}}}
+	for i := 0; i < routeStreamBuffer; i++ {
+		hub.Publish("A", update)
+	}
+
+	if dropped := hub.Publish("A", update); dropped != 1 {
+		t.Errorf("Publish on full buffer dropped %d, want 1", dropped)
+	}
+}
+
+func TestRouteStreamHubUnsubscribeAndClose(t *testing.T) {
+	hub := NewRouteStreamHub()
+
+	ch := hub.Subscribe("A")
+	hub.Unsubscribe("A", ch)
+
+	if _, ok := <-ch; ok {
+		t.Error("Channel should be closed after Unsubscribe")
+	}
+	if hub.SubscriberCount() != 0 {
+		t.Errorf("SubscriberCount = %d, want 0", hub.SubscriberCount())
+	}
+
+	ch = hub.Subscribe("A")
+	hub.Close()
+
+	if _, ok := <-ch; ok {
+		t.Error("Channel should be closed after Close")
+	}
+	if hub.Subscribe("A") != nil {
+		t.Error("Subscribe after Close should return nil")
+	}
+
+	// 关闭后注销不应 panic
+	hub.Unsubscribe("A", ch)
+}
+
+func TestRoutePushWorkerDebounces(t *testing.T) {
+	var pushes int32
+	w := newRoutePushWorker(20*time.Millisecond, func() { atomic.AddInt32(&pushes, 1) })
+	defer w.Stop()
+
+	for i := 0; i < 10; i++ {
+		w.Trigger()
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&pushes) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if got := atomic.LoadInt32(&pushes); got != 1 {
+		t.Errorf("pushes = %d after burst of triggers, want 1", got)
+	}
+
+	w.Stop()
+	w.Trigger() // 停止后触发不应阻塞
+}
+
+// readRouteStream 读取 SSE 流中的 routes 事件，直到连接关闭
+func readRouteStream(t *testing.T, resp *http.Response) <-chan models.RouteResponse {
+	t.Helper()
+
+	events := make(chan models.RouteResponse, routeStreamBuffer)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		var event string
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			case strings.HasPrefix(line, "data:") && event == "routes":
+				var routes models.RouteResponse
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &routes); err == nil {
+					events <- routes
+				}
+			}
+		}
+	}()
+	return events
+}
+
+func TestHandleRouteStream(t *testing.T) {
+	s := newTestServer(t)
+	now := time.Now().Unix()
+
+	postTelemetry(t, s, models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: now,
+		Metrics: []models.Metric{
+			{TargetIP: "B", RTTMs: ptrFloat64(10)},
+			{TargetIP: "C", RTTMs: ptrFloat64(200)},
+		},
+	})
+	postTelemetry(t, s, models.TelemetryRequest{
+		AgentID:   "B",
+		Timestamp: now,
+		Metrics:   []models.Metric{{TargetIP: "C", RTTMs: ptrFloat64(10)}},
+	})
+
+	server := httptest.NewServer(s.router)
+	defer server.Close()
+
+	if resp, err := http.Get(server.URL + "/api/v1/routes/stream"); err != nil {
+		t.Fatalf("GET without agent_id: %v", err)
+	} else {
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("missing agent_id: status = %d, want 400", resp.StatusCode)
+		}
+	}
+	if resp, err := http.Get(server.URL + "/api/v1/routes/stream?agent_id=Z"); err != nil {
+		t.Fatalf("GET unknown agent: %v", err)
+	} else {
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("unknown agent: status = %d, want 404", resp.StatusCode)
+		}
+	}
+
+	open := func() (<-chan models.RouteResponse, context.CancelFunc) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v1/routes/stream?agent_id=A", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			cancel()
+			t.Fatalf("open route stream: %v", err)
+		}
+		t.Cleanup(func() { _ = resp.Body.Close() })
+		if resp.StatusCode != http.StatusOK {
+			cancel()
+			t.Fatalf("route stream status = %d, want 200", resp.StatusCode)
+		}
+		return readRouteStream(t, resp), cancel
+	}
+	events, cancel := open()
+
+	next := func() models.RouteResponse {
+		t.Helper()
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatal("route stream closed unexpectedly")
+			}
+			return ev
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for route event")
+		}
+		return models.RouteResponse{}
+	}
+
+	// 首个事件为当前完整路由：到 C 经由 B 中继
+	first := next()
+	if r, ok := routeTo(first.Routes, "C"); !ok || r.NextHop != "B" {
+		t.Fatalf("initial routes = %+v, want C via B", first.Routes)
+	}
+	if first.Version == 0 {
+		t.Error("initial event should carry the route set version")
+	}
+
+	// 直连链路变好后，后台任务推送新路由，遥测请求本身不等待计算
+	postTelemetry(t, s, models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: now + 1,
+		Metrics: []models.Metric{
+			{TargetIP: "B", RTTMs: ptrFloat64(10)},
+			{TargetIP: "C", RTTMs: ptrFloat64(5)},
+		},
+	})
+	update := next()
+	if r, ok := routeTo(update.Routes, "C"); !ok || r.NextHop != "direct" {
+		t.Errorf("pushed routes = %+v, want C direct", update.Routes)
+	}
+	if update.Version <= first.Version {
+		t.Errorf("pushed version = %d, want greater than %d", update.Version, first.Version)
+	}
+
+	// 重新连接时拓扑没有变化，首个事件仍是完整路由集而不是空的差异
+	cancel()
+	events, cancel = open()
+	defer cancel()
+	again := next()
+	if r, ok := routeTo(again.Routes, "C"); !ok || r.NextHop != "direct" {
+		t.Errorf("routes after reconnect = %+v, want full set with C direct", again.Routes)
+	}
+	if again.Version != update.Version {
+		t.Errorf("version after reconnect = %d, want %d", again.Version, update.Version)
+	}
+}
@@ -0,0 +1,314 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// TopologyBackend 多个 Controller 共享拓扑数据的外部存储
+type TopologyBackend interface {
+	// Put 写入 Agent 的最新遥测，ttl 到期后由存储自行删除
+	Put(req *models.TelemetryRequest, ttl time.Duration) error
+	// List 返回存储中所有未过期的遥测
+	List() ([]models.TelemetryRequest, error)
+	Close() error
+}
+
+// RedisTopologyBackend 基于 Redis 的共享拓扑存储
+// 每个 Agent 一个键（key_prefix + tenant_id/agent_id），值为 JSON 编码的遥测，过期由键的 TTL 完成
+type RedisTopologyBackend struct {
+	client *redisClient
+	prefix string
+}
+
+// redisScanCount 每次 SCAN 建议返回的键数量
+const redisScanCount = 200
+
+// redisGlobEscaper 转义 Redis glob 模式中的特殊字符，key_prefix 中的 * ? [ ] \ 按字面匹配
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// redisPrefixPattern 返回匹配 prefix 开头的所有键的 SCAN MATCH 模式
+func redisPrefixPattern(prefix string) string {
+	return redisGlobEscaper.Replace(prefix) + "*"
+}
+
+// NewRedisTopologyBackend 创建 Redis 共享拓扑存储
+func NewRedisTopologyBackend(cfg config.RedisConfig) *RedisTopologyBackend {
+	return &RedisTopologyBackend{
+		client: newRedisClient(cfg.Address, cfg.Password, cfg.DB, cfg.Timeout),
+		prefix: cfg.KeyPrefix,
+	}
+}
+
+// Put 写入 Agent 的最新遥测
+func (b *RedisTopologyBackend) Put(req *models.TelemetryRequest, ttl time.Duration) error {
+	value, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	ms := ttl.Milliseconds()
+	if ms <= 0 {
+		ms = 1
+	}
+	_, err = b.client.Do("SET", b.prefix+tenantAgentKey(req.TenantID, req.AgentID), string(value), "PX", strconv.FormatInt(ms, 10))
+	return err
+}
+
+// List 用 SCAN 遍历前缀下的所有键并批量读取
+// 遍历期间过期的键 MGET 返回空值，直接跳过
+func (b *RedisTopologyBackend) List() ([]models.TelemetryRequest, error) {
+	var result []models.TelemetryRequest
+	cursor := "0"
+	for {
+		reply, err := b.client.Do("SCAN", cursor, "MATCH", redisPrefixPattern(b.prefix), "COUNT", strconv.Itoa(redisScanCount))
+		if err != nil {
+			return nil, err
+		}
+		page, ok := reply.([]interface{})
+		if !ok || len(page) != 2 {
+			return nil, fmt.Errorf("unexpected SCAN reply %v", reply)
+		}
+		next, ok1 := page[0].([]byte)
+		keys, ok2 := page[1].([]interface{})
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("unexpected SCAN reply %v", reply)
+		}
+
+		if len(keys) > 0 {
+			args := make([]string, 0, len(keys)+1)
+			args = append(args, "MGET")
+			for _, k := range keys {
+				key, _ := k.([]byte) //nolint:errcheck
+				args = append(args, string(key))
+			}
+			values, err := b.client.Do(args...)
+			if err != nil {
+				return nil, err
+			}
+			items, _ := values.([]interface{}) //nolint:errcheck
+			for _, item := range items {
+				value, _ := item.([]byte) //nolint:errcheck
+				if value == nil {
+					continue
+				}
+				var req models.TelemetryRequest
+				if err := json.Unmarshal(value, &req); err != nil {
+					return nil, fmt.Errorf("failed to decode shared telemetry: %w", err)
+				}
+				result = append(result, req)
+			}
+		}
+
+		cursor = string(next)
+		if cursor == "0" {
+			return result, nil
+		}
+	}
+}
+
+// Close 关闭连接
+func (b *RedisTopologyBackend) Close() error {
+	return b.client.Close()
+}
+
+// sharedPublishQueueSize 等待写入共享存储的遥测队列长度，队列满时丢弃新的遥测
+const sharedPublishQueueSize = 1024
+
+// TopologySyncer 通过共享存储让多个无状态 Controller 副本看到同一份拓扑
+//
+// 本节点收到的遥测进入有界队列，由后台任务写入共享存储，遥测上报不等待 Redis；
+// TTL 为该 Agent 的过期阈值减去数据已有的年龄。
+// 同时定期拉取全部遥测，按时间戳合并到本地各租户的拓扑数据库。
+// 路由计算状态（迟滞基准等）不共享，各副本独立计算。
+type TopologySyncer struct {
+	server   *Server
+	backend  TopologyBackend
+	interval time.Duration
+	logger   logging.Logger
+	queue    chan models.TelemetryRequest
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+
+	lastSync  int64 // 最近一次成功拉取的 Unix 时间，0 表示从未拉取
+	failCount int64
+	dropped   int64 // 因队列已满未写入共享存储的遥测数
+}
+
+// NewTopologySyncer 创建共享拓扑同步器
+func NewTopologySyncer(server *Server, backend TopologyBackend, interval time.Duration, logger logging.Logger) *TopologySyncer {
+	if logger == nil {
+		logger = logging.NewNopLogger()
+	}
+	return &TopologySyncer{
+		server:   server,
+		backend:  backend,
+		interval: interval,
+		logger:   logger,
+		queue:    make(chan models.TelemetryRequest, sharedPublishQueueSize),
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Publish 把本节点收到的遥测放入写入队列，不阻塞调用方
+// 已停止或队列已满时丢弃，该 Agent 的下一次上报会再次写入
+func (y *TopologySyncer) Publish(req *models.TelemetryRequest) {
+	select {
+	case <-y.stopCh:
+		return
+	default:
+	}
+	select {
+	case y.queue <- *req:
+	default:
+		atomic.AddInt64(&y.dropped, 1)
+		y.logger.Warn("Shared telemetry queue full, update dropped",
+			logging.F("agent_id", req.AgentID),
+			logging.F("tenant_id", req.TenantID),
+		)
+	}
+}
+
+// put 写入共享存储，数据已经过期时不写入
+// 过期时间取所属租户的过期策略，租户无法创建时退回默认租户的策略
+func (y *TopologySyncer) put(req *models.TelemetryRequest) {
+	cleaner := y.server.cleaner
+	if t, err := y.server.tenantFor(req.TenantID); err == nil {
+		cleaner = t.cleaner
+	}
+	threshold := cleaner.Policy().For(&models.AgentData{
+		ReportInterval: time.Duration(req.ReportIntervalSec) * time.Second,
+	})
+	ttl := threshold - time.Since(time.Unix(req.Timestamp, 0))
+	if ttl > threshold {
+		ttl = threshold
+	}
+	if ttl <= 0 {
+		return
+	}
+	if err := y.backend.Put(req, ttl); err != nil {
+		atomic.AddInt64(&y.failCount, 1)
+		y.logger.Warn("Failed to share telemetry",
+			logging.F("agent_id", req.AgentID),
+			logging.F("tenant_id", req.TenantID),
+			logging.F("error", err.Error()),
+		)
+	}
+}
+
+// SyncOnce 拉取共享存储中的全部遥测并合并到本地，返回实际更新的 Agent 数量
+func (y *TopologySyncer) SyncOnce() (int, error) {
+	reqs, err := y.backend.List()
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for i := range reqs {
+		if !models.ValidTenantID(reqs[i].TenantID) || reqs[i].AgentID == "" {
+			continue
+		}
+		t, err := y.server.tenantFor(reqs[i].TenantID)
+		if err != nil {
+			continue
+		}
+		if t.db.StoreIfNewer(&reqs[i], ActorSharedSync) {
+			updated++
+		}
+	}
+	atomic.StoreInt64(&y.lastSync, time.Now().Unix())
+	return updated, nil
+}
+
+// Start 启动定期拉取（立即执行一次）和写入队列的后台任务
+func (y *TopologySyncer) Start() {
+	y.wg.Add(2)
+	go y.run()
+	go y.publishLoop()
+	y.logger.Info("Shared topology sync started", logging.F("interval", y.interval.String()))
+}
+
+// Stop 停止定期拉取，写出已排队的遥测后关闭共享存储连接
+func (y *TopologySyncer) Stop() {
+	close(y.stopCh)
+	y.wg.Wait()
+	if err := y.backend.Close(); err != nil {
+		y.logger.Warn("Failed to close shared topology backend", logging.F("error", err.Error()))
+	}
+	y.logger.Info("Shared topology sync stopped")
+}
+
+// run 定期拉取循环
+func (y *TopologySyncer) run() {
+	defer y.wg.Done()
+
+	y.syncLogged()
+	ticker := time.NewTicker(y.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			y.syncLogged()
+		case <-y.stopCh:
+			return
+		}
+	}
+}
+
+// publishLoop 依次写出队列中的遥测，停止时先写完已排队的部分
+func (y *TopologySyncer) publishLoop() {
+	defer y.wg.Done()
+
+	for {
+		select {
+		case req := <-y.queue:
+			y.put(&req)
+		case <-y.stopCh:
+			for {
+				select {
+				case req := <-y.queue:
+					y.put(&req)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// syncLogged 执行一次拉取并记录结果
+func (y *TopologySyncer) syncLogged() {
+	updated, err := y.SyncOnce()
+	if err != nil {
+		atomic.AddInt64(&y.failCount, 1)
+		y.logger.Warn("Shared topology sync failed", logging.F("error", err.Error()))
+		return
+	}
+	y.logger.Debug("Shared topology synced", logging.F("updated", updated))
+}
+
+// sharedTopologyHealth 返回共享拓扑的就绪状态
+// 从未成功拉取时视为未就绪，避免新副本在没有拓扑数据时接收 Agent 流量
+func (s *Server) sharedTopologyHealth() models.ComponentHealth {
+	health := models.NewComponentHealth(models.HealthStatusHealthy)
+	last := atomic.LoadInt64(&s.shared.lastSync)
+	if last == 0 {
+		health.Status = models.HealthStatusUnhealthy
+		health.Details["error"] = "shared topology not synced yet"
+		return health
+	}
+	health.Details["last_sync"] = time.Unix(last, 0).UTC().Format(time.RFC3339)
+	health.Details["failures"] = atomic.LoadInt64(&s.shared.failCount)
+	health.Details["dropped"] = atomic.LoadInt64(&s.shared.dropped)
+	return health
+}
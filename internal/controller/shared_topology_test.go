@@ -0,0 +1,305 @@
+package controller
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// fakeRedis 只实现 SET PX、SCAN、MGET 的内存 Redis，用于测试共享拓扑
+type fakeRedis struct {
+	ln      net.Listener
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	r := &fakeRedis{ln: ln, values: make(map[string]string), expires: make(map[string]time.Time)}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	rd := bufio.NewReader(conn)
+	for {
+		reply, err := readRESP(rd)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]interface{})
+		args := make([]string, len(items))
+		for i, item := range items {
+			b, _ := item.([]byte)
+			args[i] = string(b)
+		}
+		if _, err := conn.Write([]byte(r.exec(args))); err != nil {
+			return
+		}
+	}
+}
+
+func bulk(s string) string { return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n" }
+
+func (r *fakeRedis) exec(args []string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, exp := range r.expires {
+		if time.Now().After(exp) {
+			delete(r.values, key)
+			delete(r.expires, key)
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "SET":
+		ms, _ := strconv.Atoi(args[4])
+		r.values[args[1]] = args[2]
+		r.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return "+OK\r\n"
+	case "SCAN":
+		// 只支持 redisPrefixPattern 生成的“转义前缀 + *”模式
+		prefix := unescapeGlob(strings.TrimSuffix(args[3], "*"))
+		var keys []string
+		for key := range r.values {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, bulk(key))
+			}
+		}
+		return fmt.Sprintf("*2\r\n%s*%d\r\n%s", bulk("0"), len(keys), strings.Join(keys, ""))
+	case "MGET":
+		out := fmt.Sprintf("*%d\r\n", len(args)-1)
+		for _, key := range args[1:] {
+			if v, ok := r.values[key]; ok {
+				out += bulk(v)
+			} else {
+				out += "$-1\r\n"
+			}
+		}
+		return out
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+// unescapeGlob 去掉 glob 模式中的反斜杠转义
+func unescapeGlob(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			i++
+		}
+		b.WriteByte(pattern[i])
+	}
+	return b.String()
+}
+
+// waitForKey 等待后台写入任务把键写入
+func (r *fakeRedis) waitForKey(t *testing.T, key string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		_, ok := r.values[key]
+		r.mu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for key %q", key)
+}
+
+func (r *fakeRedis) ttl(key string) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Until(r.expires[key])
+}
+
+func TestSharedTopologyAcrossReplicas(t *testing.T) {
+	redis := newFakeRedis(t)
+
+	newReplica := func() *Server {
+		cfg := &config.ControllerConfig{
+			Server:    config.ServerConfig{ListenAddress: "127.0.0.1", Port: 8000},
+			Algorithm: config.AlgorithmConfig{PenaltyFactor: 100, Hysteresis: 0.15, DegradationThreshold: 0.5},
+			Topology:  config.TopologyConfig{StaleThreshold: 60 * time.Second},
+			Storage: config.StorageConfig{Backend: config.StorageBackendRedis, Redis: config.RedisConfig{
+				Address:      redis.ln.Addr().String(),
+				KeyPrefix:    "test:",
+				Timeout:      time.Second,
+				SyncInterval: time.Hour,
+			}},
+			Tenants: config.TenantsConfig{MaxTenants: 100},
+			Logging: config.LoggingConfig{Level: "ERROR"},
+		}
+		s, err := NewServer(cfg)
+		if err != nil {
+			t.Fatalf("NewServer() error = %v", err)
+		}
+		t.Cleanup(s.Shutdown)
+		return s
+	}
+	first, second := newReplica(), newReplica()
+
+	// 10 秒前的遥测：TTL 为 stale_threshold 减去已有的年龄
+	postTelemetry(t, first, models.TelemetryRequest{AgentID: "A", Timestamp: time.Now().Unix() - 10, Metrics: []models.Metric{
+		{TargetIP: "B", RTTMs: ptrFloat64(10)},
+	}})
+	postTelemetry(t, first, models.TelemetryRequest{AgentID: "A", TenantID: "blue", Timestamp: time.Now().Unix(), Metrics: []models.Metric{
+		{TargetIP: "C", RTTMs: ptrFloat64(20)},
+	}})
+	redis.waitForKey(t, "test:A")
+	redis.waitForKey(t, "test:blue/A")
+	if ttl := redis.ttl("test:A"); ttl > 51*time.Second || ttl < 45*time.Second {
+		t.Errorf("TTL = %v, want about 50s", ttl)
+	}
+
+	// 启动时的首次拉取可能已经合并了部分数据，这里只检查结果
+	if _, err := second.shared.SyncOnce(); err != nil {
+		t.Fatalf("SyncOnce() error = %v", err)
+	}
+	if data, ok := second.db.Get("A"); !ok || *data.Metrics["B"].RTT != 10 {
+		t.Errorf("default tenant agent A not shared: %+v", data)
+	}
+	if blue, ok := second.lookupTenant("blue"); !ok || !blue.db.Exists("A") {
+		t.Error("tenant blue agent A not shared")
+	}
+
+	// 已合并的数据再次拉取不重复计入
+	if updated, _ := second.shared.SyncOnce(); updated != 0 {
+		t.Errorf("second sync updated = %d, want 0", updated)
+	}
+	if w := doRequest(second, "GET", "/readyz"); w.Code != 200 {
+		t.Errorf("readyz = %d after sync, body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRedisPrefixPattern(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"lite-sdwan:", "lite-sdwan:*"},
+		{"", "*"},
+		{"net[1]*?:", `net\[1\]\*\?:*`},
+		{`a\b:`, `a\\b:*`},
+	}
+	for _, tt := range tests {
+		if got := redisPrefixPattern(tt.prefix); got != tt.want {
+			t.Errorf("redisPrefixPattern(%q) = %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+// blockingBackend Put 阻塞直到 release 被关闭的共享存储
+type blockingBackend struct {
+	release chan struct{}
+	mu      sync.Mutex
+	puts    int
+}
+
+func (b *blockingBackend) Put(*models.TelemetryRequest, time.Duration) error {
+	<-b.release
+	b.mu.Lock()
+	b.puts++
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *blockingBackend) List() ([]models.TelemetryRequest, error) { return nil, nil }
+func (b *blockingBackend) Close() error                             { return nil }
+
+func TestTopologySyncerPublishDoesNotBlock(t *testing.T) {
+	s := newTestServer(t)
+	backend := &blockingBackend{release: make(chan struct{})}
+	y := NewTopologySyncer(s, backend, time.Hour, nil)
+	y.Start()
+
+	// 共享存储卡住时 Publish 立即返回，超出队列长度的遥测被丢弃
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < sharedPublishQueueSize+10; i++ {
+			y.Publish(&models.TelemetryRequest{AgentID: "A", Timestamp: time.Now().Unix()})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Publish blocked on a stuck backend")
+	}
+	if dropped := atomic.LoadInt64(&y.dropped); dropped == 0 {
+		t.Error("dropped = 0, want updates beyond the queue length dropped")
+	}
+
+	// 停止时写完已排队的遥测
+	close(backend.release)
+	y.Stop()
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if want := sharedPublishQueueSize + 10 - int(atomic.LoadInt64(&y.dropped)); backend.puts != want {
+		t.Errorf("puts = %d, want %d", backend.puts, want)
+	}
+	y.Publish(&models.TelemetryRequest{AgentID: "A", Timestamp: time.Now().Unix()})
+}
+
+// ttlBackend 记录每次写入的过期时间
+type ttlBackend struct {
+	ttls map[string]time.Duration
+}
+
+func (b *ttlBackend) Put(req *models.TelemetryRequest, ttl time.Duration) error {
+	b.ttls[req.TenantID+"/"+req.AgentID] = ttl
+	return nil
+}
+func (b *ttlBackend) List() ([]models.TelemetryRequest, error) { return nil, nil }
+func (b *ttlBackend) Close() error                             { return nil }
+
+func TestTopologySyncerPutUsesTenantPolicy(t *testing.T) {
+	s := newTestServer(t)
+	backend := &ttlBackend{ttls: make(map[string]time.Duration)}
+	y := NewTopologySyncer(s, backend, time.Hour, nil)
+
+	tenant, err := s.tenantFor("acme")
+	if err != nil {
+		t.Fatalf("tenantFor(acme) error = %v", err)
+	}
+	tenant.cleaner.SetThreshold(10 * time.Minute)
+
+	now := time.Now().Unix()
+	y.put(&models.TelemetryRequest{AgentID: "A", Timestamp: now})
+	y.put(&models.TelemetryRequest{AgentID: "A", TenantID: "acme", Timestamp: now})
+
+	if got, want := backend.ttls["/A"], s.cleaner.Policy().Threshold; got > want || got < want-2*time.Second {
+		t.Errorf("default tenant ttl = %v, want about %v", got, want)
+	}
+	if got := backend.ttls["acme/A"]; got > 10*time.Minute || got < 10*time.Minute-2*time.Second {
+		t.Errorf("acme ttl = %v, want about 10m", got)
+	}
+}
@@ -0,0 +1,186 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// SimulatedRoutes 单个 Agent 在模拟拓扑上的路由
+type SimulatedRoutes struct {
+	AgentID string               `json:"agent_id"`
+	Routes  []models.RouteConfig `json:"routes"`  // 模拟拓扑上的完整路由
+	Changes []models.RouteConfig `json:"changes"` // 与当前拓扑相比发生变化的路由，变为不可达的目的地 reason 为 unreachable
+}
+
+// SimulationResponse what-if 模拟响应
+type SimulationResponse struct {
+	TenantID      string            `json:"tenant_id,omitempty"`
+	Agents        []SimulatedRoutes `json:"agents"`
+	ChangedRoutes int               `json:"changed_routes"`
+	DurationMs    float64           `json:"duration_ms"`
+}
+
+// ComputeFullRoutes 为指定 Agent 计算到所有可达目的地的完整路由，不读写迟滞等下发状态
+// 固定路由、路由策略、目的地约束、禁用链路和 max_hops 与 ComputeRoutes 一致；不计算 ECMP 和备份下一跳
+func (s *RouteSolver) ComputeFullRoutes(db *TopologyDB, sourceAgent string) []models.RouteConfig {
+	w := s.weights()
+	if policy, ok := s.GetPolicy(sourceAgent); ok && policy.PenaltyFactor != nil {
+		w.penaltyFactor = *policy.PenaltyFactor
+	}
+	g, paths, maxEdges := s.routingGraph(db, sourceAgent, w)
+	if g == nil {
+		return nil
+	}
+	return s.fullRoutes(g, paths, sourceAgent, maxEdges)
+}
+
+// applyMutation 在拓扑副本上应用一项假设的变更，链路或节点不存在时返回错误
+func (db *TopologyDB) applyMutation(m models.TopologyMutation) error {
+	db.lockAll()
+	defer db.unlockAll()
+
+	if m.Type == models.MutationNodeDown {
+		node := db.shardFor(m.Node)
+		if _, ok := node.data[m.Node]; !ok {
+			return fmt.Errorf("node %s not found", m.Node)
+		}
+		delete(node.data, m.Node)
+		atomic.AddInt64(&db.count, -1)
+		for i := range db.shards {
+			for agentID, data := range db.shards[i].data {
+				if _, ok := data.Metrics[m.Node]; ok {
+					copied := copyAgentData(data)
+					delete(copied.Metrics, m.Node)
+					db.shards[i].data[agentID] = copied
+				}
+			}
+		}
+		atomic.AddUint64(&db.version, 1)
+		return nil
+	}
+
+	source := db.shardFor(m.Source)
+	data, ok := source.data[m.Source]
+	if !ok {
+		return fmt.Errorf("link %s->%s not found", m.Source, m.Target)
+	}
+	metric, ok := data.Metrics[m.Target]
+	if !ok {
+		return fmt.Errorf("link %s->%s not found", m.Source, m.Target)
+	}
+
+	// 存储的数据不可变，修改前先复制
+	copied := copyAgentData(data)
+	switch m.Type {
+	case models.MutationLinkDown:
+		delete(copied.Metrics, m.Target)
+	case models.MutationLinkCost:
+		changed := *metric
+		if m.RTTMs != nil {
+			rtt := *m.RTTMs
+			changed.RTT = &rtt
+		}
+		if m.LossRate != nil {
+			changed.Loss = *m.LossRate
+		}
+		copied.Metrics[m.Target] = &changed
+	}
+	source.data[m.Source] = copied
+	atomic.AddUint64(&db.version, 1)
+	return nil
+}
+
+// diffRoutes 比较两组完整路由，返回 after 中下一跳变化的路由，以及 before 中有但 after 中没有（变为不可达）的目的地
+func diffRoutes(before, after []models.RouteConfig) []models.RouteConfig {
+	previous := make(map[string]string, len(before))
+	for _, r := range before {
+		previous[r.DstCIDR] = r.NextHop
+	}
+
+	changes := make([]models.RouteConfig, 0)
+	for _, r := range after {
+		if hop, ok := previous[r.DstCIDR]; !ok || hop != r.NextHop {
+			changes = append(changes, r)
+		}
+		delete(previous, r.DstCIDR)
+	}
+	for dst := range previous {
+		changes = append(changes, models.RouteConfig{DstCIDR: dst, NextHop: "direct", Reason: "unreachable"})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].DstCIDR < changes[j].DstCIDR
+	})
+	return changes
+}
+
+// handleSimulate 在当前拓扑的副本上应用假设的变更，返回求解器将会产生的路由，不修改任何实际状态
+func (s *Server) handleSimulate(c *gin.Context) {
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	var req models.SimulationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: fmt.Sprintf("Invalid JSON: %v", err),
+		})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Detail: err.Error(),
+		})
+		return
+	}
+
+	start := time.Now()
+	simulated := t.db.Clone()
+	for _, m := range req.Mutations {
+		if err := simulated.applyMutation(m); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Detail: err.Error(),
+			})
+			return
+		}
+	}
+
+	agentIDs := simulated.GetAllAgentIDs()
+	if req.AgentID != "" {
+		if !simulated.Exists(req.AgentID) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Detail: "Agent not found in simulated topology",
+			})
+			return
+		}
+		agentIDs = []string{req.AgentID}
+	}
+	sort.Strings(agentIDs)
+
+	resp := SimulationResponse{TenantID: t.id, Agents: make([]SimulatedRoutes, 0, len(agentIDs))}
+	for _, agentID := range agentIDs {
+		routes := t.solver.ComputeFullRoutes(simulated, agentID)
+		changes := diffRoutes(t.solver.ComputeFullRoutes(t.db, agentID), routes)
+		resp.Agents = append(resp.Agents, SimulatedRoutes{AgentID: agentID, Routes: routes, Changes: changes})
+		resp.ChangedRoutes += len(changes)
+	}
+	resp.DurationMs = float64(time.Since(start).Microseconds()) / 1000.0
+
+	s.reqLogger(c).Info("Routes simulated",
+		logging.F("tenant_id", t.id),
+		logging.F("mutation_count", len(req.Mutations)),
+		logging.F("agent_count", len(resp.Agents)),
+		logging.F("changed_routes", resp.ChangedRoutes),
+	)
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+func TestHandleSimulate(t *testing.T) {
+	s := newTestServer(t)
+	storeIPChain(s.db)
+	before := s.db.Version()
+
+	simulate := func(req models.SimulationRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/simulate", bytes.NewReader(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		s.router.ServeHTTP(w, httpReq)
+		return w
+	}
+
+	// B 下线：A 到 B 不可达，到 C 改为直连，到 D 改经 C
+	w := simulate(models.SimulationRequest{
+		AgentID:   nodeA,
+		Mutations: []models.TopologyMutation{{Type: models.MutationNodeDown, Node: nodeB}},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp SimulationResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if len(resp.Agents) != 1 || resp.ChangedRoutes != 3 {
+		t.Fatalf("response = %+v, want 3 changes for A", resp)
+	}
+	want := map[string]string{nodeB: "direct", nodeC: "direct", nodeD: nodeC}
+	for target, hop := range want {
+		r, ok := routeTo(resp.Agents[0].Changes, target)
+		if !ok || r.NextHop != hop {
+			t.Errorf("change for %s = %+v (ok=%v), want next_hop %s", target, r, ok, hop)
+		}
+	}
+	if r, _ := routeTo(resp.Agents[0].Changes, nodeB); r.Reason != "unreachable" {
+		t.Errorf("change for B reason = %q, want unreachable", r.Reason)
+	}
+
+	// 模拟不修改实际拓扑和求解器状态
+	if s.db.Version() != before || !s.db.Exists(nodeB) {
+		t.Error("simulation modified the live topology")
+	}
+	if r, _ := routeTo(s.solver.ComputeRoutes(s.db, nodeA), nodeD); r.NextHop != nodeB {
+		t.Errorf("live route to D = %+v, want via B", r)
+	}
+
+	tests := []struct {
+		name     string
+		mutation models.TopologyMutation
+		wantCode int
+	}{
+		{"unknown type", models.TopologyMutation{Type: "flap"}, http.StatusBadRequest},
+		{"unknown link", models.TopologyMutation{Type: models.MutationLinkDown, Source: nodeD, Target: nodeA}, http.StatusBadRequest},
+		{"cost without values", models.TopologyMutation{Type: models.MutationLinkCost, Source: nodeA, Target: nodeB}, http.StatusBadRequest},
+		{"link cost", models.TopologyMutation{Type: models.MutationLinkCost, Source: nodeA, Target: nodeB, RTTMs: ptrFloat64(500)}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := simulate(models.SimulationRequest{Mutations: []models.TopologyMutation{tt.mutation}})
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d, body = %s", w.Code, tt.wantCode, w.Body.String())
+			}
+		})
+	}
+}
@@ -3,25 +3,352 @@ package controller
 import (
 	"container/heap"
 	"math"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/holygeek00/lite-sdwan/pkg/config"
 	"github.com/holygeek00/lite-sdwan/pkg/models"
 )
 
 // RouteSolver 路径计算引擎
 type RouteSolver struct {
-	penaltyFactor float64
-	hysteresis    float64
-	mu            sync.RWMutex
-	previousCosts map[string]float64 // "source->target" -> cost
+	penaltyFactor      float64
+	hysteresis         float64
+	degradation        float64     // 已下发路径成本超过基准 (1+degradation) 倍时不受迟滞限制立即重选
+	jitterWeight       float64     // 抖动在链路成本中的权重
+	bandwidthPenalty   float64     // 可用带宽为 0 时的容量惩罚 (ms)
+	bandwidthReference float64     // 不再施加容量惩罚的参考带宽 (Mbps)
+	ecmpMargin         float64     // 成本在最优路径 (1+ecmpMargin) 倍以内的下一跳视为等价，0 表示关闭 ECMP
+	blackhole          bool        // 不可达的目的地下发 blackhole 而不是 direct
+	backupPaths        int         // 每个目的地附带的备份下一跳数量，0 表示不计算
+	maxHops            int         // 路径最多经过的链路数，0 表示不限
+	reconciliation     string      // 双向测量结果的合并方式，见 config.LinkReconcile*
+	minSamples         int         // 链路连续测得 RTT 的遥测次数达到该值后才参与计算，0 表示不限
+	relayLoadPenalty   float64     // 每有一个其他 Agent 以某节点为下一跳，经该节点中继增加的成本 (ms)，0 表示关闭
+	stale              StalePolicy // 链路过期策略，过期的链路不参与计算
+	mu                 sync.RWMutex
+	previousCosts      map[string]float64                // "source->target" -> cost
+	pins               map[string]models.RoutePin        // "source->target" -> 管理员固定的下一跳
+	policies           map[string]models.RoutePolicy     // agent_id -> 路由策略
+	constraints        map[string]models.RouteConstraint // dst_cidr -> 目的地路由约束
+	disabledLinks      map[string]models.LinkDisable     // "source->target" -> 管理员禁用的链路
+	emittedPins        map[string]string                 // "source->target" -> 已下发的固定下一跳
+	previousHops       map[string]string                 // "source->target" -> 上次下发的下一跳
+	previousECMP       map[string]string                 // "source->target" -> 上次下发的 ECMP 下一跳集合
+	previousBackups    map[string]string                 // "source->target" -> 上次下发的备份下一跳
+	previousPaths      map[string][]string               // "source->target" -> 上次下发时的完整路径，用于检测劣化
+	history            *RouteHistory
+	stability          *RouteStability
+
+	// 各指标在链路成本中的相对权重，全部为 0 时使用默认成本公式
+	metricWeights config.MetricWeights
+
+	// 链路可用性硬阈值，超过任一阈值的链路不参与路径计算
+	sla config.SLAConfig
+
+	// 流量类别，每个类别使用独立的链路成本权重单独计算一套完整路由表
+	classes []config.TrafficClassConfig
+
+	// 每个 Agent 的路由集版本，路由有变化时递增
+	versions      map[string]uint64
+	currentRoutes map[string]map[string]versionedRoute // source -> dst_cidr -> 路由
+}
+
+// versionedRoute 带版本号的已下发路由
+type versionedRoute struct {
+	route   models.RouteConfig
+	version uint64
 }
 
+// defaultDegradationThreshold 默认劣化阈值：已下发路径成本上涨 50% 以上时立即重选
+const defaultDegradationThreshold = 0.5
+
 // NewRouteSolver 创建新的路径计算引擎
 func NewRouteSolver(penaltyFactor, hysteresis float64) *RouteSolver {
 	return &RouteSolver{
-		penaltyFactor: penaltyFactor,
-		hysteresis:    hysteresis,
-		previousCosts: make(map[string]float64),
+		penaltyFactor:   penaltyFactor,
+		hysteresis:      hysteresis,
+		reconciliation:  config.LinkReconcileDirectional,
+		degradation:     defaultDegradationThreshold,
+		previousCosts:   make(map[string]float64),
+		pins:            make(map[string]models.RoutePin),
+		policies:        make(map[string]models.RoutePolicy),
+		constraints:     make(map[string]models.RouteConstraint),
+		disabledLinks:   make(map[string]models.LinkDisable),
+		emittedPins:     make(map[string]string),
+		previousHops:    make(map[string]string),
+		previousECMP:    make(map[string]string),
+		previousBackups: make(map[string]string),
+		previousPaths:   make(map[string][]string),
+		history:         NewRouteHistory(defaultRouteHistorySize),
+		stability:       NewRouteStability(),
+		versions:        make(map[string]uint64),
+		currentRoutes:   make(map[string]map[string]versionedRoute),
+	}
+}
+
+// GetHistory 获取路由决策历史
+func (s *RouteSolver) GetHistory() *RouteHistory {
+	return s.history
+}
+
+// GetStability 获取按路由统计的下一跳变化次数
+func (s *RouteSolver) GetStability() *RouteStability {
+	return s.stability
+}
+
+// RouteCounts 统计最近一次下发的路由中直连和中继的数量
+func (s *RouteSolver) RouteCounts() (direct, relayed int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, hop := range s.previousHops {
+		switch hop {
+		case "direct":
+			direct++
+		case "blackhole":
+		default:
+			relayed++
+		}
+	}
+	return direct, relayed
+}
+
+// recordChange 记录一次下发的路由变化，调用方需持有 s.mu
+func (s *RouteSolver) recordChange(source, target string, route models.RouteConfig, oldCost, newCost *float64) {
+	key := routeKey(source, target)
+	now := time.Now()
+	oldHop := s.previousHops[key]
+	s.history.Record(models.RouteChange{
+		Source:     source,
+		Target:     target,
+		DstCIDR:    route.DstCIDR,
+		OldNextHop: oldHop,
+		NewNextHop: route.NextHop,
+		OldCost:    oldCost,
+		NewCost:    newCost,
+		Reason:     route.Reason,
+		Timestamp:  now.Unix(),
+	})
+	if oldHop != "" && oldHop != route.NextHop {
+		s.stability.Record(source, target, now)
+	}
+	s.previousHops[key] = route.NextHop
+}
+
+// routeKey 生成 source->target 键
+func routeKey(source, target string) string {
+	return source + "->" + target
+}
+
+// SetPin 设置固定路由，覆盖计算出的路径
+func (s *RouteSolver) SetPin(pin models.RoutePin) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pins[routeKey(pin.Source, pin.Target)] = pin
+}
+
+// RemovePin 移除固定路由，返回是否存在
+// 移除后下一次计算会重新下发计算出的路径
+func (s *RouteSolver) RemovePin(source, target string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := routeKey(source, target)
+	if _, ok := s.pins[key]; !ok {
+		return false
+	}
+	delete(s.pins, key)
+	delete(s.emittedPins, key)
+	delete(s.previousCosts, key)
+	return true
+}
+
+// GetPins 获取所有固定路由，按 source、target 排序
+func (s *RouteSolver) GetPins() []models.RoutePin {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pins := make([]models.RoutePin, 0, len(s.pins))
+	for _, p := range s.pins {
+		pins = append(pins, p)
+	}
+	sort.Slice(pins, func(i, j int) bool {
+		if pins[i].Source != pins[j].Source {
+			return pins[i].Source < pins[j].Source
+		}
+		return pins[i].Target < pins[j].Target
+	})
+	return pins
+}
+
+// SetPolicy 设置或替换 Agent 的路由策略
+// 该 Agent 的迟滞状态被清空，下一次计算按新策略重新下发所有路由
+func (s *RouteSolver) SetPolicy(policy models.RoutePolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.policies[policy.AgentID] = policy
+	s.resetCostsLocked(policy.AgentID)
+}
+
+// RemovePolicy 删除 Agent 的路由策略，返回是否存在
+func (s *RouteSolver) RemovePolicy(agentID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.policies[agentID]; !ok {
+		return false
+	}
+	delete(s.policies, agentID)
+	s.resetCostsLocked(agentID)
+	return true
+}
+
+// GetPolicy 获取 Agent 的路由策略
+func (s *RouteSolver) GetPolicy(agentID string) (models.RoutePolicy, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	policy, ok := s.policies[agentID]
+	return policy, ok
+}
+
+// GetPolicies 获取所有路由策略，按 agent_id 排序
+func (s *RouteSolver) GetPolicies() []models.RoutePolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	policies := make([]models.RoutePolicy, 0, len(s.policies))
+	for _, p := range s.policies {
+		policies = append(policies, p)
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].AgentID < policies[j].AgentID
+	})
+	return policies
+}
+
+// SolverState 求解器中需要在副本间共享的状态
+type SolverState struct {
+	PreviousCosts   map[string]float64       `json:"previous_costs"`
+	PreviousHops    map[string]string        `json:"previous_hops"`
+	PreviousECMP    map[string]string        `json:"previous_ecmp,omitempty"`
+	PreviousBackups map[string]string        `json:"previous_backups,omitempty"`
+	PreviousPaths   map[string][]string      `json:"previous_paths,omitempty"`
+	EmittedPins     map[string]string        `json:"emitted_pins"`
+	Pins            []models.RoutePin        `json:"pins"`
+	Policies        []models.RoutePolicy     `json:"policies"`
+	Constraints     []models.RouteConstraint `json:"constraints,omitempty"`
+	DisabledLinks   []models.LinkDisable     `json:"disabled_links,omitempty"`
+}
+
+// ExportState 导出迟滞基准、已下发下一跳、固定路由、策略、约束和禁用链路
+func (s *RouteSolver) ExportState() SolverState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	state := SolverState{
+		PreviousCosts:   make(map[string]float64, len(s.previousCosts)),
+		PreviousHops:    make(map[string]string, len(s.previousHops)),
+		PreviousECMP:    make(map[string]string, len(s.previousECMP)),
+		PreviousBackups: make(map[string]string, len(s.previousBackups)),
+		PreviousPaths:   make(map[string][]string, len(s.previousPaths)),
+		EmittedPins:     make(map[string]string, len(s.emittedPins)),
+		Pins:            make([]models.RoutePin, 0, len(s.pins)),
+		Policies:        make([]models.RoutePolicy, 0, len(s.policies)),
+		Constraints:     make([]models.RouteConstraint, 0, len(s.constraints)),
+		DisabledLinks:   make([]models.LinkDisable, 0, len(s.disabledLinks)),
+	}
+	for k, v := range s.previousCosts {
+		state.PreviousCosts[k] = v
+	}
+	for k, v := range s.previousHops {
+		state.PreviousHops[k] = v
+	}
+	for k, v := range s.previousECMP {
+		state.PreviousECMP[k] = v
+	}
+	for k, v := range s.previousBackups {
+		state.PreviousBackups[k] = v
+	}
+	for k, v := range s.previousPaths {
+		state.PreviousPaths[k] = append([]string(nil), v...)
+	}
+	for k, v := range s.emittedPins {
+		state.EmittedPins[k] = v
+	}
+	for _, p := range s.pins {
+		state.Pins = append(state.Pins, p)
+	}
+	for _, p := range s.policies {
+		state.Policies = append(state.Policies, p)
+	}
+	for _, c := range s.constraints {
+		state.Constraints = append(state.Constraints, c)
+	}
+	for _, l := range s.disabledLinks {
+		state.DisabledLinks = append(state.DisabledLinks, l)
+	}
+	return state
+}
+
+// ImportState 用导出的状态整体替换当前状态
+// 接管后按相同的迟滞基准继续计算，避免路由集中重新下发
+func (s *RouteSolver) ImportState(state SolverState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.previousCosts = make(map[string]float64, len(state.PreviousCosts))
+	for k, v := range state.PreviousCosts {
+		s.previousCosts[k] = v
+	}
+	s.previousHops = make(map[string]string, len(state.PreviousHops))
+	for k, v := range state.PreviousHops {
+		s.previousHops[k] = v
+	}
+	s.previousECMP = make(map[string]string, len(state.PreviousECMP))
+	for k, v := range state.PreviousECMP {
+		s.previousECMP[k] = v
+	}
+	s.previousBackups = make(map[string]string, len(state.PreviousBackups))
+	for k, v := range state.PreviousBackups {
+		s.previousBackups[k] = v
+	}
+	s.previousPaths = make(map[string][]string, len(state.PreviousPaths))
+	for k, v := range state.PreviousPaths {
+		s.previousPaths[k] = append([]string(nil), v...)
+	}
+	s.emittedPins = make(map[string]string, len(state.EmittedPins))
+	for k, v := range state.EmittedPins {
+		s.emittedPins[k] = v
+	}
+	s.pins = make(map[string]models.RoutePin, len(state.Pins))
+	for _, p := range state.Pins {
+		s.pins[routeKey(p.Source, p.Target)] = p
+	}
+	s.policies = make(map[string]models.RoutePolicy, len(state.Policies))
+	for _, p := range state.Policies {
+		s.policies[p.AgentID] = p
+	}
+	s.constraints = make(map[string]models.RouteConstraint, len(state.Constraints))
+	for _, c := range state.Constraints {
+		s.constraints[c.DstCIDR] = c
+	}
+	s.disabledLinks = make(map[string]models.LinkDisable, len(state.DisabledLinks))
+	for _, l := range state.DisabledLinks {
+		s.disabledLinks[routeKey(l.Source, l.Target)] = l
+	}
+}
+
+// resetCostsLocked 清空 source 的迟滞基准成本，调用方需持有 s.mu
+func (s *RouteSolver) resetCostsLocked(source string) {
+	prefix := source + "->"
+	for key := range s.previousCosts {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.previousCosts, key)
+		}
 	}
 }
 
@@ -54,17 +381,280 @@ func (g *Graph) AddEdge(from, to string, cost float64) {
 	g.edges[from][to] = cost
 }
 
+// costWeights 链路成本公式中各项的权重
+type costWeights struct {
+	penaltyFactor float64 // 丢包率惩罚系数
+	jitterWeight  float64 // 抖动权重
+
+	bandwidthPenalty   float64 // 容量惩罚上限
+	bandwidthReference float64 // 参考带宽
+
+	mix config.MetricWeights // 归一化后的指标权重，未配置时按上述系数直接相加
+}
+
+// capacityPenalty 低容量链路的额外成本：可用带宽低于参考带宽时按比例线性增加
+// 带宽未知（未上报）的链路不惩罚
+func (w costWeights) capacityPenalty(bandwidth float64) float64 {
+	if bandwidth <= 0 || w.bandwidthPenalty <= 0 || w.bandwidthReference <= 0 ||
+		bandwidth >= w.bandwidthReference {
+		return 0
+	}
+	return w.bandwidthPenalty * (1 - bandwidth/w.bandwidthReference)
+}
+
 // CalculateCost 计算链路成本
 // Cost = RTT_ms + (Loss_rate × PenaltyFactor)
 func (s *RouteSolver) CalculateCost(rtt *float64, lossRate float64) float64 {
-	if rtt == nil {
+	return linkCost(&models.MetricData{RTT: rtt, Loss: lossRate}, s.weights())
+}
+
+// linkCost 按给定权重计算链路成本
+// Cost = RTT_ms + (Loss_rate × PenaltyFactor) + (Jitter_ms × JitterWeight) + CapacityPenalty
+func linkCost(m *models.MetricData, w costWeights) float64 {
+	if m.RTT == nil {
 		return math.Inf(1) // 链路不可达
 	}
-	return *rtt + (lossRate * s.penaltyFactor)
+	if w.mix.Enabled() {
+		// 加权模式：各项均为毫秒量纲，按归一化权重加权平均
+		return w.mix.RTT**m.RTT + w.mix.Loss*m.Loss*w.penaltyFactor +
+			w.mix.Jitter*m.Jitter + w.mix.Bandwidth*w.capacityPenalty(m.Bandwidth)
+	}
+	return *m.RTT + (m.Loss * w.penaltyFactor) + (m.Jitter * w.jitterWeight) + w.capacityPenalty(m.Bandwidth)
+}
+
+// SetParameters 更新算法参数，下一次计算时生效
+func (s *RouteSolver) SetParameters(penaltyFactor, hysteresis float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.penaltyFactor = penaltyFactor
+	s.hysteresis = hysteresis
+}
+
+// SetDegradationThreshold 设置劣化阈值：已下发路径成本超过下发时的 (1+threshold) 倍即立即重选
+func (s *RouteSolver) SetDegradationThreshold(threshold float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.degradation = threshold
+}
+
+// DegradationThreshold 返回当前劣化阈值
+func (s *RouteSolver) DegradationThreshold() float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.degradation
+}
+
+// forgetRouteLocked 清空 source->target 的下发状态，调用方需持有 s.mu
+func (s *RouteSolver) forgetRouteLocked(key string) {
+	delete(s.previousCosts, key)
+	delete(s.previousPaths, key)
+	delete(s.previousECMP, key)
+	delete(s.previousBackups, key)
+}
+
+// SetJitterWeight 设置抖动在链路成本中的权重，下一次计算时生效
+func (s *RouteSolver) SetJitterWeight(weight float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jitterWeight = weight
+}
+
+// JitterWeight 返回当前抖动权重
+func (s *RouteSolver) JitterWeight() float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.jitterWeight
+}
+
+// SetBandwidthPenalty 设置容量惩罚：可用带宽为 referenceMbps 时不惩罚，趋近 0 时惩罚趋近 penalty
+func (s *RouteSolver) SetBandwidthPenalty(penalty, referenceMbps float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bandwidthPenalty = penalty
+	s.bandwidthReference = referenceMbps
+}
+
+// BandwidthPenalty 返回当前容量惩罚上限和参考带宽
+func (s *RouteSolver) BandwidthPenalty() (penalty, referenceMbps float64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.bandwidthPenalty, s.bandwidthReference
+}
+
+// weights 返回当前链路成本权重
+func (s *RouteSolver) weights() costWeights {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return costWeights{
+		penaltyFactor:      s.penaltyFactor,
+		jitterWeight:       s.jitterWeight,
+		bandwidthPenalty:   s.bandwidthPenalty,
+		bandwidthReference: s.bandwidthReference,
+		mix:                s.metricWeights.Normalized(),
+	}
+}
+
+// SetMetricWeights 设置各指标在链路成本中的相对权重，全部为 0 时使用默认成本公式
+func (s *RouteSolver) SetMetricWeights(weights config.MetricWeights) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metricWeights = weights
+}
+
+// MetricWeights 返回当前指标权重（未归一化）
+func (s *RouteSolver) MetricWeights() config.MetricWeights {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.metricWeights
+}
+
+// SetECMPMargin 设置 ECMP 成本容差，0 表示关闭
+func (s *RouteSolver) SetECMPMargin(margin float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ecmpMargin = margin
+}
+
+// SetBlackholeUnreachable 设置不可达的目的地是否下发 blackhole
+func (s *RouteSolver) SetBlackholeUnreachable(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blackhole = enabled
+}
+
+// SetBackupPaths 设置每个目的地附带的备份下一跳数量，0 表示不计算
+func (s *RouteSolver) SetBackupPaths(k int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backupPaths = k
+}
+
+// SetMaxHops 设置路径最多经过的链路数，0 表示不限
+func (s *RouteSolver) SetMaxHops(maxHops int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxHops = maxHops
+}
+
+// SetLinkReconciliation 设置双向测量结果的合并方式，空字符串等同于 directional
+func (s *RouteSolver) SetLinkReconciliation(mode string) {
+	if mode == "" {
+		mode = config.LinkReconcileDirectional
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reconciliation = mode
+}
+
+// LinkReconciliation 返回当前双向测量结果的合并方式
+func (s *RouteSolver) LinkReconciliation() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.reconciliation
+}
+
+// SetMinSamples 设置链路参与计算所需的最少连续成功测量次数，0 表示不限
+func (s *RouteSolver) SetMinSamples(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.minSamples = n
+}
+
+// MinSamples 返回链路参与计算所需的最少连续成功测量次数
+func (s *RouteSolver) MinSamples() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.minSamples
+}
+
+// SetStalePolicy 设置链路过期策略，测量时间超过 StalePolicy.LinkStale 阈值的链路不参与计算
+func (s *RouteSolver) SetStalePolicy(policy StalePolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stale = policy
+}
+
+// StalePolicy 返回当前链路过期策略
+func (s *RouteSolver) StalePolicy() StalePolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stale
+}
+
+// SetSLA 设置链路可用性硬阈值，超过任一阈值的链路不参与路径计算
+func (s *RouteSolver) SetSLA(sla config.SLAConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sla = sla
+}
+
+// SLA 返回当前链路可用性硬阈值
+func (s *RouteSolver) SLA() config.SLAConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sla
+}
+
+// slaViolated 链路测量结果是否超过 SLA 阈值，阈值为 0 的项不检查
+func slaViolated(m *models.MetricData, sla config.SLAConfig) bool {
+	if sla.MaxLossRate > 0 && m.Loss > sla.MaxLossRate {
+		return true
+	}
+	if m.RTT != nil && sla.MaxRTTMs > 0 && *m.RTT > sla.MaxRTTMs {
+		return true
+	}
+	return sla.MaxJitterMs > 0 && m.Jitter > sla.MaxJitterMs
+}
+
+// MaxHops 返回路径最多经过的链路数
+func (s *RouteSolver) MaxHops() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.maxHops
+}
+
+// Parameters 返回当前算法参数
+func (s *RouteSolver) Parameters() (penaltyFactor, hysteresis float64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.penaltyFactor, s.hysteresis
 }
 
 // BuildGraph 从拓扑数据库构建图
 func (s *RouteSolver) BuildGraph(db *TopologyDB) *Graph {
+	g := buildGraph(db, s.weights(), s.graphOptions())
+	s.removeDisabledLinks(g)
+	return g
+}
+
+// graphOptions 与成本权重无关的建图选项
+type graphOptions struct {
+	reconciliation string           // 双向测量结果的合并方式
+	minSamples     int              // 链路参与计算所需的最少连续成功测量次数
+	sla            config.SLAConfig // 链路可用性硬阈值
+	stale          StalePolicy      // 链路过期策略
+	now            time.Time        // 判断链路是否过期的时间
+}
+
+// graphOptions 返回当前建图选项
+func (s *RouteSolver) graphOptions() graphOptions {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return graphOptions{
+		reconciliation: s.reconciliation,
+		minSamples:     s.minSamples,
+		sla:            s.sla,
+		stale:          s.stale,
+		now:            time.Now(),
+	}
+}
+
+// buildGraph 按给定权重从拓扑数据库构建图，opts.reconciliation 决定如何合并 A->B 和 B->A 两个方向的测量
+// 连续成功测量次数少于 minSamples 的链路不加入图，避免刚上线节点的一次偶然低延迟立即吸引流量；
+// 超过 SLA 阈值的链路同样不加入图，无论成本多低都不会承载中继流量；
+// 测量已过期的链路（Agent 仍在上报，但部分更新中很久没有包含它）不加入图，也不参与双向合并；
+// 隔离期内的 Agent 没有出边，不作为中继，但仍可作为目的地
+func buildGraph(db *TopologyDB, w costWeights, opts graphOptions) *Graph {
 	g := NewGraph()
 	allData := db.GetAll()
 
@@ -75,8 +665,23 @@ func (s *RouteSolver) BuildGraph(db *TopologyDB) *Graph {
 
 	// 添加边
 	for source, data := range allData {
+		if opts.stale.Degraded(data, opts.now) {
+			continue
+		}
 		for target, metrics := range data.Metrics {
-			cost := s.CalculateCost(metrics.RTT, metrics.Loss)
+			if metrics.RTT != nil && metrics.Samples < opts.minSamples {
+				continue
+			}
+			if slaViolated(metrics, opts.sla) {
+				continue
+			}
+			if opts.stale.LinkStale(data, metrics, opts.now) {
+				continue
+			}
+			cost := linkCost(metrics, w)
+			if reverse, ok := reverseMetric(allData, source, target, opts); ok {
+				cost = reconcileCost(cost, linkCost(reverse, w), opts.reconciliation)
+			}
 			g.AddEdge(source, target, cost)
 		}
 	}
@@ -84,6 +689,32 @@ func (s *RouteSolver) BuildGraph(db *TopologyDB) *Graph {
 	return g
 }
 
+// reverseMetric 返回 target 上报的 target->source 测量结果，已过期的测量视为没有
+func reverseMetric(allData map[string]*models.AgentData, source, target string, opts graphOptions) (*models.MetricData, bool) {
+	data, ok := allData[target]
+	if !ok {
+		return nil, false
+	}
+	m, ok := data.Metrics[source]
+	if !ok || opts.stale.LinkStale(data, m, opts.now) {
+		return nil, false
+	}
+	return m, true
+}
+
+// reconcileCost 合并同一链路两个方向的成本，反方向没有测量时调用方直接使用本方向成本
+// 任一方向超时（+Inf）时 max 和 average 都得到 +Inf
+func reconcileCost(forward, reverse float64, mode string) float64 {
+	switch mode {
+	case config.LinkReconcileMax:
+		return math.Max(forward, reverse)
+	case config.LinkReconcileAverage:
+		return (forward + reverse) / 2
+	default:
+		return forward
+	}
+}
+
 // priorityQueue 用于 Dijkstra 算法的优先队列
 type priorityQueue []*pqItem
 
@@ -96,7 +727,10 @@ type pqItem struct {
 func (pq priorityQueue) Len() int { return len(pq) }
 
 func (pq priorityQueue) Less(i, j int) bool {
-	return pq[i].priority < pq[j].priority
+	if pq[i].priority != pq[j].priority {
+		return pq[i].priority < pq[j].priority
+	}
+	return pq[i].node < pq[j].node
 }
 
 func (pq priorityQueue) Swap(i, j int) {
@@ -126,6 +760,64 @@ func (pq *priorityQueue) Pop() interface{} {
 type DijkstraResult struct {
 	Distances map[string]float64
 	Previous  map[string]string
+	// Paths 限制跳数时的完整路径（前驱表无法表达），为 nil 时由 Previous 回溯
+	Paths map[string][]string
+}
+
+// RemoveRelays 禁止经指定节点中继：删除其出边，节点仍可作为目的地
+func (g *Graph) RemoveRelays(source string, relays []string) {
+	for _, relay := range relays {
+		if relay != source {
+			delete(g.edges, relay)
+		}
+	}
+}
+
+// BoundedShortestPaths 计算边数不超过 maxEdges 的最短路径（按层 Bellman-Ford）
+func (g *Graph) BoundedShortestPaths(source string, maxEdges int) *DijkstraResult {
+	dist := make(map[string]float64)
+	for node := range g.nodes {
+		dist[node] = math.Inf(1)
+	}
+	dist[source] = 0
+	paths := map[string][]string{source: {source}}
+
+	for i := 0; i < maxEdges; i++ {
+		nextDist := make(map[string]float64, len(dist))
+		nextPaths := make(map[string][]string, len(paths))
+		for node, d := range dist {
+			nextDist[node] = d
+		}
+		for node, p := range paths {
+			nextPaths[node] = p
+		}
+
+		for u, du := range dist {
+			if math.IsInf(du, 1) {
+				continue
+			}
+			for v, cost := range g.edges[u] {
+				alt := du + cost
+				if alt > nextDist[v] {
+					continue
+				}
+				path := make([]string, len(paths[u]), len(paths[u])+1)
+				copy(path, paths[u])
+				path = append(path, v)
+				if alt < nextDist[v] || lessPath(path, nextPaths[v]) {
+					nextDist[v] = alt
+					nextPaths[v] = path
+				}
+			}
+		}
+		dist, paths = nextDist, nextPaths
+	}
+
+	return &DijkstraResult{
+		Distances: dist,
+		Previous:  make(map[string]string),
+		Paths:     paths,
+	}
 }
 
 // Dijkstra 执行 Dijkstra 最短路径算法
@@ -165,6 +857,10 @@ func (g *Graph) Dijkstra(source string) *DijkstraResult {
 				dist[v] = alt
 				prev[v] = u
 				heap.Push(&pq, &pqItem{node: v, priority: alt})
+			} else if alt == dist[v] && prev[v] != u &&
+				lessPath(append(tracePath(prev, u), v), tracePath(prev, v)) {
+				// 等价路径：选字典序较小的，使结果不依赖 map 遍历顺序
+				prev[v] = u
 			}
 		}
 	}
@@ -175,8 +871,42 @@ func (g *Graph) Dijkstra(source string) *DijkstraResult {
 	}
 }
 
+// tracePath 沿前驱表回溯 source 到 node 的路径
+func tracePath(prev map[string]string, node string) []string {
+	path := []string{node}
+	for {
+		p, ok := prev[node]
+		if !ok {
+			break
+		}
+		path = append(path, p)
+		node = p
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// lessPath 按节点逐个比较两条路径的字典序，用于在成本相同的路径间稳定地选择
+// 路径都从同一个源出发，因此首先比较的是下一跳；b 为空时 a 总是更优
+func lessPath(a, b []string) bool {
+	if len(b) == 0 {
+		return len(a) > 0
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
 // GetPath 从 Dijkstra 结果中获取路径
 func (r *DijkstraResult) GetPath(target string) []string {
+	if r.Paths != nil {
+		return r.Paths[target]
+	}
 	if _, ok := r.Previous[target]; !ok && r.Distances[target] == math.Inf(1) {
 		return nil // 不可达
 	}
@@ -196,38 +926,75 @@ func (r *DijkstraResult) GetPath(target string) []string {
 
 // ComputeRoutes 为指定 Agent 计算路由
 func (s *RouteSolver) ComputeRoutes(db *TopologyDB, sourceAgent string) []models.RouteConfig {
-	g := s.BuildGraph(db)
-
-	// 检查源节点是否存在
-	if !g.nodes[sourceAgent] {
+	w := s.weights()
+	policy, hasPolicy := s.GetPolicy(sourceAgent)
+	if hasPolicy && policy.PenaltyFactor != nil {
+		w.penaltyFactor = *policy.PenaltyFactor
+	}
+	g, result, maxEdges := s.routingGraph(db, sourceAgent, w)
+	if g == nil {
 		return nil
 	}
-
-	result := g.Dijkstra(sourceAgent)
 	routes := make([]models.RouteConfig, 0)
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// 跳数限制下备选路径可能超出限制，此时不计算 ECMP 和备份路由
+	var alternates *alternateFinder
+	if (s.ecmpMargin > 0 || s.backupPaths > 0) && maxEdges == 0 {
+		alternates = newAlternateFinder(g, sourceAgent)
+	}
+
 	for target := range g.nodes {
 		if target == sourceAgent {
 			continue
 		}
 
-		path := result.GetPath(target)
-		if len(path) < 2 {
-			continue // 不可达或就是自己
+		// 固定路由优先于计算结果，只在变化时下发
+		costKey := routeKey(sourceAgent, target)
+		if pin, ok := s.pins[costKey]; ok {
+			if s.emittedPins[costKey] != pin.NextHop {
+				s.emittedPins[costKey] = pin.NextHop
+				route := models.RouteConfig{
+					DstCIDR: models.HostCIDR(target),
+					NextHop: pin.NextHop,
+					Reason:  "pinned",
+				}
+				s.recordChange(sourceAgent, target, route, nil, nil)
+				routes = append(routes, route)
+			}
+			continue
 		}
 
-		newCost := result.Distances[target]
-		if math.IsInf(newCost, 1) {
-			continue // 不可达
+		// 目的地约束：在裁剪后的图上单独计算，备选路径可能违反约束，不计算 ECMP 和备份路由
+		path, newCost := result.GetPath(target), result.Distances[target]
+		constraint, constrained := s.constraintForLocked(target)
+		if constrained {
+			path, newCost = constrainedPath(g, sourceAgent, target, constraint, maxEdges)
 		}
-
 		// 应用迟滞逻辑
-		costKey := sourceAgent + "->" + target
 		oldCost, exists := s.previousCosts[costKey]
 
+		if len(path) < 2 || math.IsInf(newCost, 1) {
+			// 不可达：已下发的中继路由失效，回退为直连（或按配置丢弃），恢复可达后重新下发
+			fallback := "direct"
+			if s.blackhole {
+				fallback = "blackhole"
+			}
+			if (exists || s.blackhole) && s.previousHops[costKey] != fallback {
+				route := models.RouteConfig{
+					DstCIDR: models.HostCIDR(target),
+					NextHop: fallback,
+					Reason:  "unreachable",
+				}
+				s.recordChange(sourceAgent, target, route, &oldCost, nil)
+				routes = append(routes, route)
+			}
+			s.forgetRouteLocked(costKey)
+			continue
+		}
+
 		var nextHop string
 		var reason string
 
@@ -241,28 +1008,175 @@ func (s *RouteSolver) ComputeRoutes(db *TopologyDB, sourceAgent string) []models
 			reason = "optimized_path"
 		}
 
+		var nextHops, backups []string
+		if alternates != nil && !constrained {
+			cands := alternates.candidates(target, newCost)
+			if s.ecmpMargin > 0 {
+				nextHops = equalCostHops(cands, nextHop, newCost, s.ecmpMargin)
+			}
+			if s.backupPaths > 0 {
+				backups = backupHops(cands, nextHop, nextHops, s.backupPaths)
+			}
+		}
+
+		// 与其他 Agent 已下发的路由组合后成环的下一跳不能下发
+		if nextHop != "direct" && s.forwardingLoopLocked(sourceAgent, target, nextHop) {
+			nextHop, reason = "direct", "loop_prevented"
+			path = []string{sourceAgent, target}
+			newCost = pathCost(g, path)
+			nextHops = nil
+		}
+		nextHops = s.loopFreeHopsLocked(sourceAgent, target, nextHops)
+		if len(nextHops) < 2 {
+			nextHops = nil
+		}
+		backups = s.loopFreeHopsLocked(sourceAgent, target, backups)
+
+		ecmpSet := strings.Join(nextHops, ",")
+		backupSet := strings.Join(backups, ",")
+
+		// 已下发路径按当前拓扑的成本，任一链路消失即为 +Inf
+		currentCost := oldCost
+		if prev, ok := s.previousPaths[costKey]; ok {
+			currentCost = pathCost(g, prev)
+		}
+
 		// 检查是否需要更新路由
 		shouldUpdate := false
-		if !exists {
+		switch {
+		case !exists:
+			shouldUpdate = true
+		case nextHop == s.previousHops[costKey]:
+			// 下一跳未变，只刷新迟滞基准；等价下一跳或备份下一跳变化时重新下发
+			s.previousCosts[costKey] = newCost
+			s.previousPaths[costKey] = path
+			shouldUpdate = ecmpSet != s.previousECMP[costKey] || backupSet != s.previousBackups[costKey]
+		case math.IsInf(currentCost, 1) || currentCost > oldCost*(1+s.degradation):
+			// 已下发路径不可用或明显劣化，不受迟滞限制
 			shouldUpdate = true
-		} else if newCost < oldCost*(1-s.hysteresis) {
-			// 新成本比旧成本低 15% 以上
+			reason = "path_degraded"
+		case newCost < currentCost*(1-s.hysteresis):
+			// 新路径（包括回退直连）比已下发路径的当前成本低 15% 以上
+			shouldUpdate = true
+		case ecmpSet != s.previousECMP[costKey] || backupSet != s.previousBackups[costKey]:
+			// 等价下一跳或备份下一跳变化
 			shouldUpdate = true
 		}
 
 		if shouldUpdate {
 			s.previousCosts[costKey] = newCost
-			routes = append(routes, models.RouteConfig{
-				DstCIDR: target + "/32",
-				NextHop: nextHop,
-				Reason:  reason,
-			})
+			s.previousPaths[costKey] = path
+			if ecmpSet == "" {
+				delete(s.previousECMP, costKey)
+			} else {
+				s.previousECMP[costKey] = ecmpSet
+			}
+			if backupSet == "" {
+				delete(s.previousBackups, costKey)
+			} else {
+				s.previousBackups[costKey] = backupSet
+			}
+			route := models.RouteConfig{
+				DstCIDR:  models.HostCIDR(target),
+				NextHop:  nextHop,
+				Reason:   reason,
+				NextHops: nextHops,
+				Backups:  backups,
+				Path:     path,
+				CostMs:   newCost,
+			}
+			if math.IsInf(newCost, 1) {
+				// 回退直连但直连链路没有测量数据
+				route.Path, route.CostMs = nil, 0
+			}
+			var oldCostPtr *float64
+			if exists {
+				oldCostPtr = &oldCost
+			}
+			s.recordChange(sourceAgent, target, route, oldCostPtr, &newCost)
+			routes = append(routes, route)
 		}
 	}
 
+	s.bumpVersion(sourceAgent, routes)
 	return routes
 }
 
+// routingGraph 按给定权重构建图，应用禁用链路和源节点的路由策略后计算最短路径
+// 返回图、最短路径结果和路径边数上限（0 表示不限），源节点不存在时图为 nil
+func (s *RouteSolver) routingGraph(db *TopologyDB, sourceAgent string, w costWeights) (*Graph, *DijkstraResult, int) {
+	g := buildGraph(db, w, s.graphOptions())
+	s.removeDisabledLinks(g)
+	s.applyRelayLoad(g, sourceAgent)
+
+	// 检查源节点是否存在
+	if !g.nodes[sourceAgent] {
+		return nil, nil, 0
+	}
+
+	policy, hasPolicy := s.GetPolicy(sourceAgent)
+	maxEdges := s.MaxHops() // 0 表示不限
+	if hasPolicy {
+		g.RemoveRelays(sourceAgent, policy.AvoidRelays)
+	}
+	if hasPolicy && policy.MaxRelayHops != nil && (maxEdges == 0 || *policy.MaxRelayHops+1 < maxEdges) {
+		maxEdges = *policy.MaxRelayHops + 1
+	}
+	if maxEdges > 0 {
+		return g, g.BoundedShortestPaths(sourceAgent, maxEdges), maxEdges
+	}
+	return g, g.Dijkstra(sourceAgent), maxEdges
+}
+
+// bumpVersion 路由有变化时递增版本并记录当前路由集，调用方需持有 s.mu
+func (s *RouteSolver) bumpVersion(source string, changed []models.RouteConfig) {
+	if len(changed) == 0 {
+		return
+	}
+
+	s.versions[source]++
+	version := s.versions[source]
+
+	current, ok := s.currentRoutes[source]
+	if !ok {
+		current = make(map[string]versionedRoute)
+		s.currentRoutes[source] = current
+	}
+	for _, route := range changed {
+		current[route.DstCIDR] = versionedRoute{route: route, version: version}
+	}
+}
+
+// RouteVersion 返回 source 当前的路由集版本，随路由流推送供 Agent 记录
+func (s *RouteSolver) RouteVersion(source string) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.versions[source]
+}
+
+// RoutesSince 返回版本号大于 since 的路由以及当前版本
+// since 大于当前版本时（例如 Controller 重启过）返回完整路由集
+func (s *RouteSolver) RoutesSince(source string, since uint64) ([]models.RouteConfig, uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	version := s.versions[source]
+	if since > version {
+		since = 0
+	}
+
+	routes := make([]models.RouteConfig, 0)
+	for _, vr := range s.currentRoutes[source] {
+		if vr.version > since {
+			routes = append(routes, vr.route)
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].DstCIDR < routes[j].DstCIDR
+	})
+	return routes, version
+}
+
 // HasLoop 检查路径是否有环
 func HasLoop(path []string) bool {
 	seen := make(map[string]bool)
@@ -2,8 +2,11 @@ package controller
 
 import (
 	"math"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/holygeek00/lite-sdwan/pkg/config"
 	"github.com/holygeek00/lite-sdwan/pkg/models"
 )
 
@@ -81,6 +84,32 @@ func TestDijkstra(t *testing.T) {
 	}
 }
 
+func TestShortestPathsTieBreaking(t *testing.T) {
+	// A 到 E 有三条成本均为 30 的路径，应始终选下一跳字典序最小的 A-B-D-E
+	// 多次构建同一张图，覆盖不同的 map 遍历顺序
+	for i := 0; i < 50; i++ {
+		g := NewGraph()
+		g.AddEdge("A", "C", 10)
+		g.AddEdge("A", "B", 10)
+		g.AddEdge("A", "D", 20)
+		g.AddEdge("C", "E", 20)
+		g.AddEdge("B", "D", 10)
+		g.AddEdge("D", "E", 10)
+
+		want := []string{"A", "B", "D", "E"}
+		if got := g.Dijkstra("A").GetPath("E"); !reflect.DeepEqual(got, want) {
+			t.Fatalf("Dijkstra path to E = %v, want %v", got, want)
+		}
+		if got := g.BoundedShortestPaths("A", 3).GetPath("E"); !reflect.DeepEqual(got, want) {
+			t.Fatalf("BoundedShortestPaths path to E = %v, want %v", got, want)
+		}
+		// 两条边的限制下只剩 A-C-E 和 A-D-E，选下一跳较小的 C
+		if got := g.BoundedShortestPaths("A", 2).GetPath("E"); !reflect.DeepEqual(got, []string{"A", "C", "E"}) {
+			t.Fatalf("2-edge path to E = %v, want [A C E]", got)
+		}
+	}
+}
+
 func TestDijkstraNoPath(t *testing.T) {
 	g := NewGraph()
 	g.AddNode("A")
@@ -206,6 +235,906 @@ func TestHysteresis(t *testing.T) {
 	}
 }
 
+func TestComputeRoutesDegradedPath(t *testing.T) {
+	db := NewTopologyDB()
+	storeLinks(db, map[string]map[string]float64{
+		"A": {"B": 10, "C": 12},
+		"B": {"D": 10},
+		"C": {"D": 24},
+		"D": {},
+	})
+	solver := NewRouteSolver(100, 0.15)
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "D"); r.NextHop != "B" {
+		t.Fatalf("route to D = %+v, want via B", r)
+	}
+
+	// 经 B 的路径从 20 涨到 40：经 C (36) 未低于 40×0.85，但原路径劣化超过 50%，仍要切换
+	storeLinks(db, map[string]map[string]float64{"B": {"D": 30}})
+	r, ok := routeTo(solver.ComputeRoutes(db, "A"), "D")
+	if !ok || r.NextHop != "C" || r.Reason != "path_degraded" {
+		t.Errorf("route to D = %+v (ok=%v), want via C with reason path_degraded", r, ok)
+	}
+}
+
+func TestComputeRoutesUnreachable(t *testing.T) {
+	db := NewTopologyDB()
+	storeLinks(db, map[string]map[string]float64{
+		"A": {"B": 10},
+		"B": {"D": 10},
+		"D": {},
+	})
+	solver := NewRouteSolver(100, 0.15)
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "D"); r.NextHop != "B" {
+		t.Fatalf("route to D = %+v, want via B", r)
+	}
+
+	// B 不再能到达 D：同一次计算中撤销中继路由
+	storeLinks(db, map[string]map[string]float64{"B": {"A": 10}})
+	r, ok := routeTo(solver.ComputeRoutes(db, "A"), "D")
+	if !ok || r.NextHop != "direct" || r.Reason != "unreachable" {
+		t.Errorf("route to D = %+v (ok=%v), want direct with reason unreachable", r, ok)
+	}
+	if _, ok := routeTo(solver.ComputeRoutes(db, "A"), "D"); ok {
+		t.Error("unreachable route emitted twice")
+	}
+}
+
+func TestComputeRoutesBlackholeUnreachable(t *testing.T) {
+	db := NewTopologyDB()
+	storeLinks(db, map[string]map[string]float64{
+		"A": {"B": 10},
+		"B": {"D": 10},
+		"D": {},
+	})
+	solver := NewRouteSolver(100, 0.15)
+	solver.SetBlackholeUnreachable(true)
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "D"); r.NextHop != "B" {
+		t.Fatalf("route to D = %+v, want via B", r)
+	}
+
+	storeLinks(db, map[string]map[string]float64{"B": {"A": 10}})
+	r, ok := routeTo(solver.ComputeRoutes(db, "A"), "D")
+	if !ok || r.NextHop != "blackhole" || r.Reason != "unreachable" {
+		t.Errorf("route to D = %+v (ok=%v), want blackhole with reason unreachable", r, ok)
+	}
+	if _, ok := routeTo(solver.ComputeRoutes(db, "A"), "D"); ok {
+		t.Error("blackhole route emitted twice")
+	}
+	// A->B 直连，A->D 的黑洞路由既不算直连也不算中继
+	if direct, relayed := solver.RouteCounts(); direct != 1 || relayed != 0 {
+		t.Errorf("RouteCounts() = %d direct, %d relayed, want 1, 0", direct, relayed)
+	}
+
+	// 恢复可达后立即重新下发，替换黑洞路由
+	storeLinks(db, map[string]map[string]float64{"B": {"A": 10, "D": 10}})
+	if r, ok := routeTo(solver.ComputeRoutes(db, "A"), "D"); !ok || r.NextHop != "B" {
+		t.Errorf("route to D after recovery = %+v (ok=%v), want via B", r, ok)
+	}
+}
+
+func TestComputeRoutesHysteresisRevertToDirect(t *testing.T) {
+	db := NewTopologyDB()
+	storeLinks(db, map[string]map[string]float64{
+		"A": {"B": 10, "D": 25},
+		"B": {"D": 10},
+		"D": {},
+	})
+	solver := NewRouteSolver(100, 0.15)
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "D"); r.NextHop != "B" {
+		t.Fatalf("route to D = %+v, want via B", r)
+	}
+
+	// 直连 19 未低于中继 20×0.85，保持中继
+	storeLinks(db, map[string]map[string]float64{"A": {"B": 10, "D": 19}})
+	if r, ok := routeTo(solver.ComputeRoutes(db, "A"), "D"); ok {
+		t.Errorf("route to D = %+v, want no change", r)
+	}
+
+	// 直连 15 低于 17，回退直连
+	storeLinks(db, map[string]map[string]float64{"A": {"B": 10, "D": 15}})
+	if r, ok := routeTo(solver.ComputeRoutes(db, "A"), "D"); !ok || r.NextHop != "direct" {
+		t.Errorf("route to D = %+v (ok=%v), want direct", r, ok)
+	}
+}
+
+func TestComputeRoutesHonorsPin(t *testing.T) {
+	db := NewTopologyDB()
+	solver := NewRouteSolver(100, 0.15)
+
+	// A -> B 直连最优，但管理员固定经 C 中继
+	db.Store(&models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: 1000,
+		Metrics: []models.Metric{
+			{TargetIP: "B", RTTMs: ptrFloat64(10), LossRate: 0},
+			{TargetIP: "C", RTTMs: ptrFloat64(50), LossRate: 0},
+		},
+	})
+
+	solver.SetPin(models.RoutePin{Source: "A", Target: "B", NextHop: "C"})
+
+	routes := solver.ComputeRoutes(db, "A")
+	found := false
+	for _, r := range routes {
+		if r.DstCIDR == "B/32" {
+			found = true
+			if r.NextHop != "C" || r.Reason != "pinned" {
+				t.Errorf("Route to B = %+v, want pinned via C", r)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("Pinned route to B was not emitted")
+	}
+
+	// 固定路由未变化时不重复下发
+	for _, r := range solver.ComputeRoutes(db, "A") {
+		if r.DstCIDR == "B/32" {
+			t.Errorf("Unchanged pin should not be re-emitted, got %+v", r)
+		}
+	}
+
+	// 移除后恢复计算出的路径
+	if !solver.RemovePin("A", "B") {
+		t.Fatal("RemovePin returned false for existing pin")
+	}
+	found = false
+	for _, r := range solver.ComputeRoutes(db, "A") {
+		if r.DstCIDR == "B/32" {
+			found = true
+			if r.NextHop != "direct" {
+				t.Errorf("Route to B after unpin = %s, want direct", r.NextHop)
+			}
+		}
+	}
+	if !found {
+		t.Error("Computed route to B should be emitted after unpin")
+	}
+}
+
+func TestComputeRoutesRecordsHistory(t *testing.T) {
+	db := NewTopologyDB()
+	solver := NewRouteSolver(100, 0.15)
+
+	db.Store(&models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: 1000,
+		Metrics:   []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(100), LossRate: 0}},
+	})
+	solver.ComputeRoutes(db, "A")
+
+	// 新增中继节点 C 使 A->B 成本显著下降
+	db.Store(&models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: 1001,
+		Metrics: []models.Metric{
+			{TargetIP: "B", RTTMs: ptrFloat64(100), LossRate: 0},
+			{TargetIP: "C", RTTMs: ptrFloat64(10), LossRate: 0},
+		},
+	})
+	db.Store(&models.TelemetryRequest{
+		AgentID:   "C",
+		Timestamp: 1001,
+		Metrics:   []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(10), LossRate: 0}},
+	})
+	solver.ComputeRoutes(db, "A")
+
+	var toB []models.RouteChange
+	for _, c := range solver.GetHistory().Query("A", 0) {
+		if c.Target == "B" {
+			toB = append(toB, c)
+		}
+	}
+	if len(toB) != 2 {
+		t.Fatalf("Expected 2 recorded changes to B, got %d", len(toB))
+	}
+
+	// 最新记录在前
+	latest := toB[0]
+	if latest.OldNextHop != "direct" || latest.NewNextHop != "C" {
+		t.Errorf("Latest change = %s -> %s, want direct -> C", latest.OldNextHop, latest.NewNextHop)
+	}
+	if latest.OldCost == nil || *latest.OldCost != 100 || latest.NewCost == nil || *latest.NewCost != 20 {
+		t.Errorf("Latest change costs = %v -> %v, want 100 -> 20", latest.OldCost, latest.NewCost)
+	}
+	if toB[1].OldNextHop != "" || toB[1].OldCost != nil {
+		t.Errorf("First change should have no previous hop or cost, got %+v", toB[1])
+	}
+
+	if got := solver.GetHistory().Query("B", 0); len(got) != 0 {
+		t.Errorf("Query for other agent returned %d changes, want 0", len(got))
+	}
+}
+
+func TestRouteHistoryWraps(t *testing.T) {
+	h := NewRouteHistory(3)
+	for i := int64(1); i <= 5; i++ {
+		h.Record(models.RouteChange{Source: "A", Timestamp: i})
+	}
+
+	got := h.Query("", 0)
+	if len(got) != 3 {
+		t.Fatalf("Len = %d, want 3", len(got))
+	}
+	if got[0].Timestamp != 5 || got[2].Timestamp != 3 {
+		t.Errorf("Query order = %d..%d, want 5..3", got[0].Timestamp, got[2].Timestamp)
+	}
+	if limited := h.Query("A", 2); len(limited) != 2 {
+		t.Errorf("Limited query returned %d, want 2", len(limited))
+	}
+}
+
+func TestRouteHistoryPruneBefore(t *testing.T) {
+	h := NewRouteHistory(4)
+	for i := int64(1); i <= 6; i++ {
+		h.Record(models.RouteChange{Source: "A", Timestamp: i, OldNextHop: "B", NewNextHop: "C"})
+	}
+
+	if pruned := h.PruneBefore(time.Unix(5, 0)); pruned != 2 {
+		t.Errorf("PruneBefore() = %d, want 2", pruned)
+	}
+	got := h.Query("", 0)
+	if len(got) != 2 || got[0].Timestamp != 6 || got[1].Timestamp != 5 {
+		t.Errorf("remaining = %+v, want 6 and 5", got)
+	}
+	if flaps := h.CountFlapsSince(time.Unix(0, 0)); flaps != 2 {
+		t.Errorf("CountFlapsSince() = %d after pruning, want 2", flaps)
+	}
+
+	// 清理后继续写入，环形缓冲区保持正确顺序
+	h.Record(models.RouteChange{Source: "A", Timestamp: 7})
+	if got := h.Query("", 0); len(got) != 3 || got[0].Timestamp != 7 || got[2].Timestamp != 5 {
+		t.Errorf("after record = %+v, want 7..5", got)
+	}
+}
+
 func ptrFloat64(v float64) *float64 {
 	return &v
 }
+
+func ptrInt64(v int64) *int64 {
+	return &v
+}
+
+// routeTo 在路由列表中查找到 target 的路由
+func routeTo(routes []models.RouteConfig, target string) (models.RouteConfig, bool) {
+	for _, r := range routes {
+		if r.DstCIDR == target+"/32" {
+			return r, true
+		}
+	}
+	return models.RouteConfig{}, false
+}
+
+// storeChain 构建 A-B-C-D 链路：直连很差，逐跳中继最优
+func storeChain(db *TopologyDB) {
+	store := func(id string, metrics ...models.Metric) {
+		db.Store(&models.TelemetryRequest{AgentID: id, Timestamp: time.Now().Unix(), Metrics: metrics})
+	}
+	store("A",
+		models.Metric{TargetIP: "B", RTTMs: ptrFloat64(10)},
+		models.Metric{TargetIP: "C", RTTMs: ptrFloat64(200)},
+		models.Metric{TargetIP: "D", RTTMs: ptrFloat64(300)},
+	)
+	store("B",
+		models.Metric{TargetIP: "C", RTTMs: ptrFloat64(10)},
+		models.Metric{TargetIP: "D", RTTMs: ptrFloat64(100)},
+	)
+	store("C", models.Metric{TargetIP: "D", RTTMs: ptrFloat64(10)})
+	store("D")
+}
+
+func TestComputeRoutesPathAndCost(t *testing.T) {
+	db := NewTopologyDB()
+	storeChain(db)
+	solver := NewRouteSolver(100, 0.15)
+	routes := solver.ComputeRoutes(db, "A")
+
+	r, _ := routeTo(routes, "D")
+	if want := []string{"A", "B", "C", "D"}; !reflect.DeepEqual(r.Path, want) {
+		t.Errorf("route to D path = %v, want %v", r.Path, want)
+	}
+	if r.CostMs != 30 {
+		t.Errorf("route to D cost = %v, want 30", r.CostMs)
+	}
+	if r, _ := routeTo(routes, "B"); !reflect.DeepEqual(r.Path, []string{"A", "B"}) || r.CostMs != 10 {
+		t.Errorf("route to B = %+v, want direct path with cost 10", r)
+	}
+}
+
+func TestComputeRoutesMinSamples(t *testing.T) {
+	db := NewTopologyDB()
+	storeChain(db)
+	storeChain(db)
+	solver := NewRouteSolver(100, 0.15)
+	solver.SetMinSamples(2)
+
+	// E 刚上线：A->E->D 成本很低，但只测到一次，不能立即吸引流量
+	storeE := func() {
+		db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: 1000, Metrics: []models.Metric{
+			{TargetIP: "B", RTTMs: ptrFloat64(10)},
+			{TargetIP: "C", RTTMs: ptrFloat64(200)},
+			{TargetIP: "D", RTTMs: ptrFloat64(300)},
+			{TargetIP: "E", RTTMs: ptrFloat64(1)},
+		}})
+		db.Store(&models.TelemetryRequest{AgentID: "E", Timestamp: 1000, Metrics: []models.Metric{
+			{TargetIP: "D", RTTMs: ptrFloat64(1)},
+		}})
+	}
+	storeE()
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "D"); r.NextHop != "B" {
+		t.Fatalf("route to D after one sample = %+v, want via B", r)
+	}
+
+	storeE()
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "D"); r.NextHop != "E" {
+		t.Errorf("route to D after two samples = %+v, want via E", r)
+	}
+}
+
+func TestComputeRoutesPolicyAvoidRelays(t *testing.T) {
+	db := NewTopologyDB()
+	storeChain(db)
+	solver := NewRouteSolver(100, 0.15)
+
+	solver.SetPolicy(models.RoutePolicy{AgentID: "A", AvoidRelays: []string{"B"}})
+	routes := solver.ComputeRoutes(db, "A")
+
+	// 不能经 B：A->C 只能直连，A->D 经 C (210) 优于直连 (300)
+	want := map[string]string{"B": "direct", "C": "direct", "D": "C"}
+	for target, hop := range want {
+		r, ok := routeTo(routes, target)
+		if !ok {
+			t.Fatalf("no route to %s", target)
+		}
+		if r.NextHop != hop {
+			t.Errorf("route to %s = %s, want %s", target, r.NextHop, hop)
+		}
+	}
+}
+
+func TestComputeRoutesPolicyMaxRelayHops(t *testing.T) {
+	db := NewTopologyDB()
+	storeChain(db)
+	solver := NewRouteSolver(100, 0.15)
+
+	// 不限制时 A->D 走 A-B-C-D（两跳中继）
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "D"); r.NextHop != "B" {
+		t.Fatalf("unconstrained route to D = %+v, want via B", r)
+	}
+
+	// 最多一跳中继：A-B-D (110) 优于直连 (300)
+	one := 1
+	solver.SetPolicy(models.RoutePolicy{AgentID: "A", MaxRelayHops: &one})
+	routes := solver.ComputeRoutes(db, "A")
+	r, ok := routeTo(routes, "D")
+	if !ok {
+		t.Fatal("policy change should re-emit route to D")
+	}
+	if r.NextHop != "B" {
+		t.Errorf("route to D = %s, want B", r.NextHop)
+	}
+	for _, change := range solver.GetHistory().Query("A", 3) {
+		if change.Target == "D" && *change.NewCost != 110 {
+			t.Errorf("route to D cost = %v, want 110", *change.NewCost)
+		}
+	}
+
+	// 只允许直连
+	zero := 0
+	solver.SetPolicy(models.RoutePolicy{AgentID: "A", MaxRelayHops: &zero})
+	for _, r := range solver.ComputeRoutes(db, "A") {
+		if r.NextHop != "direct" {
+			t.Errorf("route %s = %s, want direct", r.DstCIDR, r.NextHop)
+		}
+	}
+
+	// A->C、A->D 的下一跳从 B 变为直连；A->D 在一跳限制下仍经 B，不计为变化
+	changes := make(map[string]int)
+	for _, e := range solver.GetStability().Snapshot(time.Now()) {
+		changes[routeKey(e.Source, e.Target)] = e.Changes1h
+	}
+	if want := map[string]int{"A->C": 1, "A->D": 1}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("route changes = %v, want %v", changes, want)
+	}
+
+	if !solver.RemovePolicy("A") {
+		t.Error("RemovePolicy returned false for existing policy")
+	}
+	if solver.RemovePolicy("A") {
+		t.Error("RemovePolicy returned true for missing policy")
+	}
+}
+
+func TestComputeRoutesMaxHops(t *testing.T) {
+	db := NewTopologyDB()
+	storeChain(db)
+	solver := NewRouteSolver(100, 0.15)
+	solver.SetMaxHops(2)
+
+	// A->B->C->D (30) 经过 3 条链路，超出限制；最多经一个中继时 A->B->D (110) 最优
+	want := map[string]string{"B": "direct", "C": "B", "D": "B"}
+	routes := solver.ComputeRoutes(db, "A")
+	for target, hop := range want {
+		r, ok := routeTo(routes, target)
+		if !ok {
+			t.Fatalf("no route to %s", target)
+		}
+		if r.NextHop != hop {
+			t.Errorf("route to %s = %s, want %s", target, r.NextHop, hop)
+		}
+	}
+
+	// 策略更严格时以策略为准
+	zero := 0
+	solver.SetPolicy(models.RoutePolicy{AgentID: "A", MaxRelayHops: &zero})
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "D"); r.NextHop != "direct" {
+		t.Errorf("route to D with policy = %+v, want direct", r)
+	}
+}
+
+func TestComputeRoutesDisabledLink(t *testing.T) {
+	db := NewTopologyDB()
+	storeChain(db)
+	solver := NewRouteSolver(100, 0.15)
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "D"); r.NextHop != "B" {
+		t.Fatalf("route to D = %+v, want via B", r)
+	}
+
+	// 禁用 B->C 后 A->D 只能 A->B->D (110)：虽然变差也要立即切换
+	solver.DisableLink(models.LinkDisable{Source: "B", Target: "C"})
+	routes := solver.ComputeRoutes(db, "A")
+	if r, ok := routeTo(routes, "D"); !ok || r.NextHop != "B" {
+		t.Errorf("route to D = %+v (ok=%v), want via B", r, ok)
+	}
+	if r, ok := routeTo(routes, "C"); !ok || r.NextHop != "direct" {
+		t.Errorf("route to C = %+v (ok=%v), want direct", r, ok)
+	}
+	if _, ok := solver.BuildGraph(db).edges["B"]["C"]; ok {
+		t.Error("disabled link B->C still in graph")
+	}
+
+	if !solver.EnableLink("B", "C") {
+		t.Fatal("EnableLink() = false, want true")
+	}
+	if solver.EnableLink("B", "C") {
+		t.Error("EnableLink() on enabled link = true, want false")
+	}
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "C"); r.NextHop != "B" {
+		t.Errorf("route to C after enable = %+v, want via B", r)
+	}
+}
+
+func TestBuildGraphLinkReconciliation(t *testing.T) {
+	db := NewTopologyDB()
+	storeLinks(db, map[string]map[string]float64{
+		"A": {"B": 10, "C": 30},
+		"B": {"A": 80},
+		"C": {},
+	})
+
+	tests := []struct {
+		mode   string
+		wantAB float64
+	}{
+		{config.LinkReconcileDirectional, 10},
+		{config.LinkReconcileMax, 80},
+		{config.LinkReconcileAverage, 45},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			solver := NewRouteSolver(100, 0.15)
+			solver.SetLinkReconciliation(tt.mode)
+			g := solver.BuildGraph(db)
+			if got := g.edges["A"]["B"]; got != tt.wantAB {
+				t.Errorf("A->B cost = %v, want %v", got, tt.wantAB)
+			}
+			// C 没有上报 C->A，沿用单向测量
+			if got := g.edges["A"]["C"]; got != 30 {
+				t.Errorf("A->C cost = %v, want 30", got)
+			}
+		})
+	}
+}
+
+func TestBuildGraphSkipsStaleLinks(t *testing.T) {
+	db := NewTopologyDB()
+	now := time.Now().Unix()
+	// A 一直在上报，但 A->C 的测量来自 10 分钟前的部分更新
+	db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: now - 600, Metrics: []models.Metric{
+		{TargetIP: "B", RTTMs: ptrFloat64(10)},
+		{TargetIP: "C", RTTMs: ptrFloat64(30)},
+	}})
+	db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: now, Partial: true, Metrics: []models.Metric{
+		{TargetIP: "B", RTTMs: ptrFloat64(12)},
+	}})
+	db.Store(&models.TelemetryRequest{AgentID: "B", Timestamp: now, Metrics: []models.Metric{
+		{TargetIP: "A", RTTMs: ptrFloat64(80), MeasuredAt: now - 600},
+	}})
+	db.Store(&models.TelemetryRequest{AgentID: "C", Timestamp: now})
+
+	solver := NewRouteSolver(100, 0.15)
+	solver.SetLinkReconciliation(config.LinkReconcileMax)
+	if g := solver.BuildGraph(db); g.edges["A"]["C"] != 30 {
+		t.Errorf("without stale policy A->C cost = %v, want 30", g.edges["A"]["C"])
+	}
+
+	solver.SetStalePolicy(StalePolicy{Threshold: time.Minute})
+	g := solver.BuildGraph(db)
+	if _, ok := g.edges["A"]["C"]; ok {
+		t.Error("stale link A->C should be skipped")
+	}
+	if _, ok := g.edges["B"]["A"]; ok {
+		t.Error("stale link B->A should be skipped")
+	}
+	// 过期的反方向测量不参与合并
+	if got := g.edges["A"]["B"]; got != 12 {
+		t.Errorf("A->B cost = %v, want 12", got)
+	}
+
+	// 单独的链路阈值优先于 Agent 的过期阈值
+	solver.SetStalePolicy(StalePolicy{Threshold: time.Minute, LinkThreshold: time.Hour})
+	if g := solver.BuildGraph(db); g.edges["A"]["C"] != 30 {
+		t.Errorf("with 1h link threshold A->C cost = %v, want 30", g.edges["A"]["C"])
+	}
+}
+
+func TestBuildGraphMetricWeights(t *testing.T) {
+	db := NewTopologyDB()
+	db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: 1000, Metrics: []models.Metric{
+		{TargetIP: "B", RTTMs: ptrFloat64(10), LossRate: 0.1, JitterMs: 30},
+	}})
+	db.Store(&models.TelemetryRequest{AgentID: "B", Timestamp: 1000})
+
+	tests := []struct {
+		name    string
+		weights config.MetricWeights
+		want    float64
+	}{
+		// 默认公式：10 + 0.1×100 + 30×0
+		{"default", config.MetricWeights{}, 20},
+		// (10 + 30) / 2
+		{"rtt and jitter", config.MetricWeights{RTT: 1, Jitter: 1}, 20},
+		// 0.75×10 + 0.25×(0.1×100)
+		{"rtt and loss", config.MetricWeights{RTT: 3, Loss: 1}, 10},
+		{"rtt only", config.MetricWeights{RTT: 5}, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			solver := NewRouteSolver(100, 0.15)
+			solver.SetMetricWeights(tt.weights)
+			if got := solver.BuildGraph(db).edges["A"]["B"]; math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("A->B cost = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeRoutesSLA(t *testing.T) {
+	db := NewTopologyDB()
+	db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: 1000, Metrics: []models.Metric{
+		{TargetIP: "B", RTTMs: ptrFloat64(10), LossRate: 0.3},
+		{TargetIP: "C", RTTMs: ptrFloat64(100)},
+	}})
+	db.Store(&models.TelemetryRequest{AgentID: "B", Timestamp: 1000, Metrics: []models.Metric{
+		{TargetIP: "C", RTTMs: ptrFloat64(10)},
+	}})
+	db.Store(&models.TelemetryRequest{AgentID: "C", Timestamp: 1000})
+
+	// 经 B 的成本 10+30+10=50 低于直连 100，但 A->B 丢包 30% 超过 SLA，不能承载中继流量
+	solver := NewRouteSolver(100, 0.15)
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "C"); r.NextHop != "B" {
+		t.Fatalf("route to C without SLA = %+v, want via B", r)
+	}
+
+	solver = NewRouteSolver(100, 0.15)
+	solver.SetSLA(config.SLAConfig{MaxLossRate: 0.2})
+	if _, ok := solver.BuildGraph(db).edges["A"]["B"]; ok {
+		t.Error("A->B edge present, want removed by SLA")
+	}
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "C"); r.NextHop != "direct" {
+		t.Errorf("route to C with SLA = %+v, want direct", r)
+	}
+}
+
+func TestComputeRoutesPolicyPenaltyFactor(t *testing.T) {
+	db := NewTopologyDB()
+	db.Store(&models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: 1000,
+		Metrics: []models.Metric{
+			{TargetIP: "B", RTTMs: ptrFloat64(10), LossRate: 0.2},
+			{TargetIP: "C", RTTMs: ptrFloat64(20), LossRate: 0},
+		},
+	})
+	db.Store(&models.TelemetryRequest{
+		AgentID:   "C",
+		Timestamp: 1000,
+		Metrics:   []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(20), LossRate: 0}},
+	})
+
+	// 全局系数 10：直连 10+2=12 < 中继 40
+	solver := NewRouteSolver(10, 0.15)
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "B"); r.NextHop != "direct" {
+		t.Fatalf("route to B = %+v, want direct", r)
+	}
+
+	// 该 Agent 更看重丢包：直连 10+200=210 > 中继 40
+	penalty := 1000.0
+	solver.SetPolicy(models.RoutePolicy{AgentID: "A", PenaltyFactor: &penalty})
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "B"); r.NextHop != "C" {
+		t.Errorf("route to B = %+v, want via C", r)
+	}
+}
+
+func TestComputeRoutesJitterWeight(t *testing.T) {
+	db := NewTopologyDB()
+	db.Store(&models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: 1000,
+		Metrics: []models.Metric{
+			{TargetIP: "B", RTTMs: ptrFloat64(10), JitterMs: 30},
+			{TargetIP: "C", RTTMs: ptrFloat64(10), JitterMs: 1},
+		},
+	})
+	db.Store(&models.TelemetryRequest{
+		AgentID:   "C",
+		Timestamp: 1000,
+		Metrics:   []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(10), JitterMs: 1}},
+	})
+
+	// 默认忽略抖动：直连 10 < 中继 20
+	solver := NewRouteSolver(100, 0.15)
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "B"); r.NextHop != "direct" {
+		t.Fatalf("route to B = %+v, want direct", r)
+	}
+
+	// 抖动权重 1：直连 10+30=40 > 中继 11+11=22
+	solver = NewRouteSolver(100, 0.15)
+	solver.SetJitterWeight(1)
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "B"); r.NextHop != "C" {
+		t.Errorf("route to B = %+v, want via C", r)
+	}
+}
+
+func TestComputeRoutesBandwidthPenalty(t *testing.T) {
+	db := NewTopologyDB()
+	db.Store(&models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: 1000,
+		Metrics: []models.Metric{
+			{TargetIP: "B", RTTMs: ptrFloat64(5), BandwidthMbps: 10},
+			{TargetIP: "C", RTTMs: ptrFloat64(10), BandwidthMbps: 1000},
+		},
+	})
+	db.Store(&models.TelemetryRequest{
+		AgentID:   "C",
+		Timestamp: 1000,
+		Metrics:   []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(10)}},
+	})
+
+	// 默认不惩罚：直连 5 < 中继 20
+	solver := NewRouteSolver(100, 0.15)
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "B"); r.NextHop != "direct" {
+		t.Fatalf("route to B = %+v, want direct", r)
+	}
+
+	// 直连 5+50×(1-10/100)=50 > 中继 20（C->B 带宽未知，不惩罚）
+	solver = NewRouteSolver(100, 0.15)
+	solver.SetBandwidthPenalty(50, 100)
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "B"); r.NextHop != "C" {
+		t.Errorf("route to B = %+v, want via C", r)
+	}
+}
+
+func TestRoutePolicyValidate(t *testing.T) {
+	neg := -1
+	negPenalty := -1.0
+	tests := []struct {
+		name    string
+		policy  models.RoutePolicy
+		wantErr error
+	}{
+		{"valid", models.RoutePolicy{AgentID: "A", AvoidRelays: []string{"C"}}, nil},
+		{"empty agent", models.RoutePolicy{}, models.ErrEmptyAgentID},
+		{"negative hops", models.RoutePolicy{AgentID: "A", MaxRelayHops: &neg}, models.ErrNegativeRelayHops},
+		{"negative penalty", models.RoutePolicy{AgentID: "A", PenaltyFactor: &negPenalty}, models.ErrNegativePenalty},
+		{"empty relay", models.RoutePolicy{AgentID: "A", AvoidRelays: []string{""}}, models.ErrEmptyAvoidRelay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestComputeRoutesECMP(t *testing.T) {
+	db := NewTopologyDB()
+	store := func(id string, metrics ...models.Metric) {
+		db.Store(&models.TelemetryRequest{AgentID: id, Timestamp: 1000, Metrics: metrics})
+	}
+	store("A",
+		models.Metric{TargetIP: "B", RTTMs: ptrFloat64(10)},
+		models.Metric{TargetIP: "C", RTTMs: ptrFloat64(10)},
+		models.Metric{TargetIP: "D", RTTMs: ptrFloat64(100)},
+	)
+	store("B", models.Metric{TargetIP: "D", RTTMs: ptrFloat64(10)})
+	store("C", models.Metric{TargetIP: "D", RTTMs: ptrFloat64(11)})
+	store("D")
+
+	// 未启用 ECMP 时只有单一下一跳
+	plain := NewRouteSolver(100, 0.15)
+	if route, _ := routeTo(plain.ComputeRoutes(db, "A"), "D"); route.NextHops != nil {
+		t.Errorf("NextHops without ECMP = %v, want nil", route.NextHops)
+	}
+
+	solver := NewRouteSolver(100, 0.15)
+	solver.SetECMPMargin(0.1)
+	route, ok := routeTo(solver.ComputeRoutes(db, "A"), "D")
+	if !ok {
+		t.Fatal("no route to D")
+	}
+	if route.NextHop != "B" || len(route.NextHops) != 2 || route.NextHops[0] != "B" || route.NextHops[1] != "C" {
+		t.Errorf("route to D = %+v, want next hops [B C]", route)
+	}
+
+	// C 路径变差超出容差，等价集合变化后重新下发单一下一跳
+	store("C", models.Metric{TargetIP: "D", RTTMs: ptrFloat64(50)})
+	route, ok = routeTo(solver.ComputeRoutes(db, "A"), "D")
+	if !ok {
+		t.Fatal("route to D not re-emitted after ECMP set changed")
+	}
+	if route.NextHop != "B" || route.NextHops != nil {
+		t.Errorf("route to D = %+v, want single next hop B", route)
+	}
+	if _, ok := routeTo(solver.ComputeRoutes(db, "A"), "D"); ok {
+		t.Error("unchanged ECMP set should not be re-emitted")
+	}
+}
+
+func TestComputeRoutesECMPExcludesDirect(t *testing.T) {
+	db := NewTopologyDB()
+	store := func(id string, metrics ...models.Metric) {
+		db.Store(&models.TelemetryRequest{AgentID: id, Timestamp: 1000, Metrics: metrics})
+	}
+	store("A",
+		models.Metric{TargetIP: "B", RTTMs: ptrFloat64(10)},
+		models.Metric{TargetIP: "D", RTTMs: ptrFloat64(20.5)},
+	)
+	store("B", models.Metric{TargetIP: "D", RTTMs: ptrFloat64(10)})
+	store("D")
+
+	// 经 B 中继最优，直连在容差内但不能作为多路径路由的下一跳
+	solver := NewRouteSolver(100, 0.15)
+	solver.SetECMPMargin(0.1)
+	route, ok := routeTo(solver.ComputeRoutes(db, "A"), "D")
+	if !ok {
+		t.Fatal("no route to D")
+	}
+	if route.NextHop != "B" || route.NextHops != nil {
+		t.Errorf("route to D = %+v, want single next hop B", route)
+	}
+
+	// 直连最优、中继在容差内时同样不使用 ECMP
+	store("A",
+		models.Metric{TargetIP: "B", RTTMs: ptrFloat64(10)},
+		models.Metric{TargetIP: "D", RTTMs: ptrFloat64(19.5)},
+	)
+	solver = NewRouteSolver(100, 0.15)
+	solver.SetECMPMargin(0.1)
+	for _, route := range solver.ComputeRoutes(db, "A") {
+		for _, hop := range route.NextHops {
+			if hop == "direct" {
+				t.Errorf("route %+v has direct in next_hops", route)
+			}
+		}
+	}
+}
+
+func TestComputeRoutesBackups(t *testing.T) {
+	db := NewTopologyDB()
+	store := func(id string, metrics ...models.Metric) {
+		db.Store(&models.TelemetryRequest{AgentID: id, Timestamp: 1000, Metrics: metrics})
+	}
+	store("A",
+		models.Metric{TargetIP: "B", RTTMs: ptrFloat64(10)},
+		models.Metric{TargetIP: "C", RTTMs: ptrFloat64(20)},
+		models.Metric{TargetIP: "D", RTTMs: ptrFloat64(100)},
+		models.Metric{TargetIP: "E", RTTMs: ptrFloat64(50)},
+	)
+	store("B",
+		models.Metric{TargetIP: "A", RTTMs: ptrFloat64(10)},
+		models.Metric{TargetIP: "D", RTTMs: ptrFloat64(10)},
+	)
+	store("C", models.Metric{TargetIP: "D", RTTMs: ptrFloat64(10)})
+	store("D")
+	store("E")
+
+	solver := NewRouteSolver(100, 0.15)
+	solver.SetBackupPaths(2)
+	routes := solver.ComputeRoutes(db, "A")
+
+	route, ok := routeTo(routes, "D")
+	if !ok {
+		t.Fatal("no route to D")
+	}
+	if route.NextHop != "B" || len(route.Backups) != 2 || route.Backups[0] != "C" || route.Backups[1] != "direct" {
+		t.Errorf("route to D = %+v, want next hop B with backups [C direct]", route)
+	}
+
+	// B 到 E 只能经过 A，作为备份会形成环路
+	route, ok = routeTo(routes, "E")
+	if !ok {
+		t.Fatal("no route to E")
+	}
+	if route.NextHop != "direct" || route.Backups != nil {
+		t.Errorf("route to E = %+v, want direct without loop-prone backups", route)
+	}
+
+	solver = NewRouteSolver(100, 0.15)
+	solver.SetBackupPaths(1)
+	if route, _ := routeTo(solver.ComputeRoutes(db, "A"), "D"); len(route.Backups) != 1 {
+		t.Errorf("backups with k=1 = %v, want one", route.Backups)
+	}
+}
+
+func TestComputeRoutesPreventsForwardingLoop(t *testing.T) {
+	db := NewTopologyDB()
+	storeLinks(db, map[string]map[string]float64{
+		"A": {"B": 1, "D": 50},
+		"B": {"A": 1, "D": 10},
+		"D": {},
+	})
+	solver := NewRouteSolver(100, 0.5)
+	solver.SetDegradationThreshold(10)
+
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "D"); r.NextHop != "B" {
+		t.Fatalf("A route to D = %+v, want via B", r)
+	}
+
+	// B->D 变差后 B 的最优路径经 A，而 A 受迟滞影响仍经 B：直接下发会形成 A <-> B 环路
+	storeLinks(db, map[string]map[string]float64{"B": {"A": 1, "D": 60}})
+	if r, _ := routeTo(solver.ComputeRoutes(db, "A"), "D"); r.NextHop != "" {
+		t.Fatalf("A route to D changed to %+v, want hysteresis to keep via B", r)
+	}
+	r, ok := routeTo(solver.ComputeRoutes(db, "B"), "D")
+	if !ok || r.NextHop != "direct" || r.Reason != "loop_prevented" {
+		t.Errorf("B route to D = %+v (ok=%v), want direct with reason loop_prevented", r, ok)
+	}
+}
+
+func TestComputeRoutesRelayLoadPenalty(t *testing.T) {
+	db := NewTopologyDB()
+	storeLinks(db, map[string]map[string]float64{
+		"S1": {"R1": 10, "R2": 12, "T": 100},
+		"S2": {"R1": 10, "R2": 12, "T": 100},
+		"R1": {"T": 10},
+		"R2": {"T": 10},
+		"T":  {},
+	})
+
+	// 不开启时两个源都经连接最好的 R1
+	solver := NewRouteSolver(100, 0.15)
+	for _, source := range []string{"S1", "S2"} {
+		if r, _ := routeTo(solver.ComputeRoutes(db, source), "T"); r.NextHop != "R1" {
+			t.Errorf("%s route to T = %s, want R1", source, r.NextHop)
+		}
+	}
+
+	// S1 已经以 R1 为下一跳：S2 经 R1 的成本为 10+10+5=25，高于经 R2 的 22
+	solver = NewRouteSolver(100, 0.15)
+	solver.SetRelayLoadPenalty(5)
+	if r, _ := routeTo(solver.ComputeRoutes(db, "S1"), "T"); r.NextHop != "R1" {
+		t.Errorf("S1 route to T = %s, want R1", r.NextHop)
+	}
+	r, _ := routeTo(solver.ComputeRoutes(db, "S2"), "T")
+	if r.NextHop != "R2" || r.CostMs != 22 {
+		t.Errorf("S2 route to T = %s (cost %v), want R2 (cost 22)", r.NextHop, r.CostMs)
+	}
+
+	if got, want := solver.RelayLoads(), map[string]int{"R1": 1, "R2": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RelayLoads = %v, want %v", got, want)
+	}
+}
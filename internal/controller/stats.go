@@ -0,0 +1,134 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// flapWindow 统计路由抖动的时间窗口
+const flapWindow = time.Hour
+
+// StatsResponse Controller 汇总统计，供 NOC 仪表盘使用
+type StatsResponse struct {
+	TenantID   string `json:"tenant_id,omitempty"`
+	AgentCount int    `json:"agent_count"`
+	LinksUp    int    `json:"links_up"`
+	LinksDown  int    `json:"links_down"`
+	// AvgLinkRTTMs 每条 up 链路保留的 RTT 样本均值，键为 source->target
+	AvgLinkRTTMs   map[string]float64 `json:"avg_link_rtt_ms"`
+	AvgLinkLoss    float64            `json:"avg_link_loss_rate"`
+	MinLinkRTTMs   float64            `json:"min_link_rtt_ms"` // min/max/p95 基于所有 up 链路保留的 RTT 样本
+	MaxLinkRTTMs   float64            `json:"max_link_rtt_ms"`
+	P95LinkRTTMs   float64            `json:"p95_link_rtt_ms"`
+	DirectRoutes   int                `json:"direct_routes"`
+	RelayedRoutes  int                `json:"relayed_routes"`
+	RouteFlaps1h   int                `json:"route_flaps_1h"`
+	StreamClients  int                `json:"stream_clients"`
+	GeneratedAtUTC string             `json:"generated_at"`
+}
+
+// collectStats 汇总租户当前的拓扑和路由状态
+func (s *Server) collectStats(t *tenant) StatsResponse {
+	stats := StatsResponse{TenantID: t.id, AvgLinkRTTMs: make(map[string]float64)}
+
+	allData := t.db.GetAll()
+	stats.AgentCount = len(allData)
+
+	var lossSum float64
+	var samples []models.RTTSample
+	for agentID, data := range allData {
+		for targetIP, metric := range data.Metrics {
+			// 链路 up：有 RTT 且未完全丢包
+			if metric.RTT == nil || metric.Loss >= 1 {
+				stats.LinksDown++
+				continue
+			}
+			stats.LinksUp++
+			lossSum += metric.Loss
+			stats.AvgLinkRTTMs[routeKey(agentID, targetIP)] = averageRTT(metric)
+			samples = append(samples, metric.RTTHistory...)
+		}
+	}
+	if summary := summarizeRTT(samples); summary != nil {
+		stats.MinLinkRTTMs = summary.Min
+		stats.MaxLinkRTTMs = summary.Max
+		stats.P95LinkRTTMs = summary.P95
+	}
+	if stats.LinksUp > 0 {
+		stats.AvgLinkLoss = lossSum / float64(stats.LinksUp)
+	}
+
+	stats.DirectRoutes, stats.RelayedRoutes = t.solver.RouteCounts()
+	stats.RouteFlaps1h = t.solver.GetHistory().CountFlapsSince(time.Now().Add(-flapWindow))
+	stats.StreamClients = t.streams.SubscriberCount()
+	stats.GeneratedAtUTC = time.Now().UTC().Format(time.RFC3339)
+
+	return stats
+}
+
+// averageRTT 返回链路保留的 RTT 样本均值，没有样本时使用最近一次测量值
+func averageRTT(metric *models.MetricData) float64 {
+	if len(metric.RTTHistory) == 0 {
+		return *metric.RTT
+	}
+	var sum float64
+	for _, sample := range metric.RTTHistory {
+		sum += sample.RTTMs
+	}
+	return sum / float64(len(metric.RTTHistory))
+}
+
+// handleStats 处理汇总统计查询
+func (s *Server) handleStats(c *gin.Context) {
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, s.collectStats(t))
+}
+
+// RouteStabilityResponse 按路由统计的下一跳变化次数
+type RouteStabilityResponse struct {
+	TenantID string                `json:"tenant_id,omitempty"`
+	Routes   []RouteStabilityEntry `json:"routes"`
+}
+
+// handleRouteStability 查询每条 source->target 路由最近一小时和一天内的变化次数
+// 按变化次数降序返回，可用 agent_id 只查看单个源，limit 限制条数
+func (s *Server) handleRouteStability(c *gin.Context) {
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Detail: "limit must be a non-negative integer",
+			})
+			return
+		}
+		limit = n
+	}
+
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	source := c.Query("agent_id")
+	routes := make([]RouteStabilityEntry, 0)
+	for _, entry := range t.solver.GetStability().Snapshot(time.Now()) {
+		if source != "" && entry.Source != source {
+			continue
+		}
+		routes = append(routes, entry)
+		if limit > 0 && len(routes) >= limit {
+			break
+		}
+	}
+	c.JSON(http.StatusOK, RouteStabilityResponse{TenantID: t.id, Routes: routes})
+}
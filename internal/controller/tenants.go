@@ -0,0 +1,266 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// tenant 单个租户的独立分区：拓扑数据、路径计算和路由推送互不影响
+// 默认租户（tenant_id 为空）复用 Server 上的 db、solver 等字段
+type tenant struct {
+	lastRecompute int64 // 最近一次全量重算的 UnixNano，用于路由缓存过期判断
+	lastActive    int64 // 最近一次通过 tenantFor 访问的 UnixNano，用于回收闲置租户
+
+	// on_change 模式下缓存对应的拓扑版本，computeMu 保证并发查询只触发一次全量计算
+	computeMu       sync.Mutex
+	computedVersion uint64
+	computed        bool
+
+	// classRoutes 缓存模式下最近一次重算得到的流量类别路由，agent_id -> 类别路由表
+	classMu     sync.RWMutex
+	classRoutes map[string][]models.ClassRoutes
+
+	id           string
+	db           *TopologyDB
+	solver       *RouteSolver
+	cleaner      *StaleDataCleaner
+	streams      *RouteStreamHub
+	routeFetches *routeFetchTracker
+	changes      *TopologyChangeLog
+	paths        *PathStore
+
+	// pusher 遥测触发的后台路由推送任务
+	pusher *routePushWorker
+}
+
+// routeCacheExpired 判断最近一次全量重算是否早于 ttl 之前，从未重算过时视为过期
+func (t *tenant) routeCacheExpired(ttl time.Duration) bool {
+	last := atomic.LoadInt64(&t.lastRecompute)
+	return last == 0 || time.Since(time.Unix(0, last)) >= ttl
+}
+
+// setClassRoutes 替换缓存的流量类别路由
+func (t *tenant) setClassRoutes(routes map[string][]models.ClassRoutes) {
+	t.classMu.Lock()
+	defer t.classMu.Unlock()
+	t.classRoutes = routes
+}
+
+// cachedClassRoutes 返回缓存的 Agent 流量类别路由，未配置流量类别时为 nil
+func (t *tenant) cachedClassRoutes(agentID string) []models.ClassRoutes {
+	t.classMu.RLock()
+	defer t.classMu.RUnlock()
+	return t.classRoutes[agentID]
+}
+
+// errTenantLimit 租户数量已达 tenants.max_tenants 且没有可回收的闲置租户
+var errTenantLimit = errors.New("tenant limit reached")
+
+// tenantAgentKey 返回限流等跨租户结构中使用的 Agent 键，不同租户的相同 agent_id 互不冲突
+func tenantAgentKey(tenantID, agentID string) string {
+	if tenantID == models.DefaultTenantID {
+		return agentID
+	}
+	return tenantID + "/" + agentID
+}
+
+// lookupTenant 查找已存在的租户
+func (s *Server) lookupTenant(id string) (*tenant, bool) {
+	s.tenantsMu.RLock()
+	defer s.tenantsMu.RUnlock()
+	t, ok := s.tenants[id]
+	return t, ok
+}
+
+// tenantFor 返回租户分区，首次上报时按当前参数创建
+// 非默认租户数量达到 tenants.max_tenants 时先回收闲置租户，仍无空位则返回 errTenantLimit
+func (s *Server) tenantFor(id string) (*tenant, error) {
+	now := time.Now().UnixNano()
+	if t, ok := s.lookupTenant(id); ok {
+		atomic.StoreInt64(&t.lastActive, now)
+		return t, nil
+	}
+
+	s.tenantsMu.Lock()
+	defer s.tenantsMu.Unlock()
+	if t, ok := s.tenants[id]; ok {
+		atomic.StoreInt64(&t.lastActive, now)
+		return t, nil
+	}
+	if len(s.tenants)-1 >= s.cfg.Tenants.MaxTenants {
+		s.reapIdleTenantsLocked()
+		if len(s.tenants)-1 >= s.cfg.Tenants.MaxTenants {
+			s.logger.Warn("Tenant limit reached, rejecting new tenant",
+				logging.F("tenant_id", id),
+				logging.F("max_tenants", s.cfg.Tenants.MaxTenants),
+			)
+			return nil, errTenantLimit
+		}
+	}
+
+	penaltyFactor, hysteresis := s.solver.Parameters()
+	t := &tenant{
+		lastActive:   now,
+		id:           id,
+		db:           NewTopologyDB(),
+		solver:       NewRouteSolver(penaltyFactor, hysteresis),
+		streams:      NewRouteStreamHub(),
+		routeFetches: newRouteFetchTracker(),
+		changes:      NewTopologyChangeLog(0),
+		paths:        NewPathStore(),
+	}
+	t.db.SetHistorySize(s.cleaner.Retention().MaxPoints)
+	t.db.SetLimits(s.cfg.Topology.MaxAgents, s.cfg.Topology.MaxMetricsPerAgent)
+	t.db.SetTombstoneTTL(s.cfg.Topology.TombstoneTTL)
+	t.solver.SetDegradationThreshold(s.solver.DegradationThreshold())
+	t.solver.SetJitterWeight(s.solver.JitterWeight())
+	t.solver.SetBandwidthPenalty(s.solver.BandwidthPenalty())
+	t.solver.SetECMPMargin(s.cfg.Algorithm.ECMPMargin)
+	t.solver.SetBlackholeUnreachable(s.cfg.Algorithm.BlackholeUnreachable)
+	t.solver.SetBackupPaths(s.cfg.Algorithm.BackupPaths)
+	t.solver.SetMaxHops(s.solver.MaxHops())
+	t.solver.SetLinkReconciliation(s.solver.LinkReconciliation())
+	t.solver.SetMinSamples(s.solver.MinSamples())
+	t.solver.SetRelayLoadPenalty(s.solver.RelayLoadPenalty())
+	t.solver.SetMetricWeights(s.solver.MetricWeights())
+	t.solver.SetSLA(s.solver.SLA())
+	t.solver.SetTrafficClasses(s.solver.TrafficClasses())
+	s.watchTopology(t.db, id)
+	t.changes.Watch(t.db)
+	t.paths.Watch(t.db)
+	t.cleaner = NewStaleDataCleaner(t.db, s.cleaner.Threshold(), s.cleaner.Interval(),
+		s.logger.WithFields(logging.F("tenant_id", id)))
+	t.cleaner.SetIntervalMultiplier(s.cleaner.Policy().IntervalMultiplier)
+	t.cleaner.SetLinkThreshold(s.cleaner.Policy().LinkThreshold)
+	t.cleaner.SetQuarantine(s.cleaner.Policy().Quarantine)
+	t.cleaner.SetRetention(s.cleaner.Retention())
+	t.cleaner.SetRouteHistory(t.solver.GetHistory())
+	t.solver.SetStalePolicy(t.cleaner.Policy())
+	t.cleaner.SetTenantID(id)
+	t.cleaner.SetAuditLogger(s.audit)
+	t.cleaner.SetWebhookNotifier(s.webhooks)
+	t.cleaner.SetEvictHandler(s.evictionHandler(id))
+	t.cleaner.Start()
+	t.pusher = s.newRoutePusher(t)
+	s.tenants[id] = t
+
+	s.logger.Info("Tenant created", logging.F("tenant_id", id))
+	return t, nil
+}
+
+// reapIdleTenants 回收闲置租户，见 reapIdleTenantsLocked
+func (s *Server) reapIdleTenants() {
+	s.tenantsMu.Lock()
+	defer s.tenantsMu.Unlock()
+	s.reapIdleTenantsLocked()
+}
+
+// reapIdleTenantsLocked 移除没有 Agent、没有路由流订阅者，且超过 stale_threshold 未被访问的非默认租户，
+// 停止其清理器和推送任务；调用方需持有 tenantsMu 写锁
+func (s *Server) reapIdleTenantsLocked() {
+	idleBefore := time.Now().Add(-s.cleaner.Threshold()).UnixNano()
+	for id, t := range s.tenants {
+		if id == models.DefaultTenantID || t.db.Count() > 0 || t.streams.SubscriberCount() > 0 {
+			continue
+		}
+		if atomic.LoadInt64(&t.lastActive) > idleBefore {
+			continue
+		}
+		delete(s.tenants, id)
+		t.cleaner.Stop()
+		t.pusher.Stop()
+		t.streams.Close()
+		s.logger.Info("Idle tenant removed", logging.F("tenant_id", id))
+	}
+}
+
+// allTenants 返回全部租户，按 tenant_id 排序，默认租户在最前
+func (s *Server) allTenants() []*tenant {
+	s.tenantsMu.RLock()
+	defer s.tenantsMu.RUnlock()
+
+	result := make([]*tenant, 0, len(s.tenants))
+	for _, t := range s.tenants {
+		result = append(result, t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].id < result[j].id
+	})
+	return result
+}
+
+// resolveTenant 根据 tenant_id 查询参数查找租户，失败时写入错误响应
+func (s *Server) resolveTenant(c *gin.Context) (*tenant, bool) {
+	id := c.Query("tenant_id")
+	if !models.ValidTenantID(id) {
+		render(c, http.StatusBadRequest, &models.ErrorResponse{
+			Detail: models.ErrInvalidTenantID.Error(),
+		})
+		return nil, false
+	}
+	t, ok := s.lookupTenant(id)
+	if !ok {
+		render(c, http.StatusNotFound, &models.ErrorResponse{
+			Detail: "Tenant not found. Has any of its agents sent telemetry?",
+		})
+		return nil, false
+	}
+	return t, true
+}
+
+// tenantAuthMiddleware 校验按租户订阅的接口：tenant_id 查询参数必须出现（空值表示默认租户），
+// Bearer Token 须为 admin.token 或 tenants.tokens 中该租户的 Token；两者都未配置时接口被禁用
+func (s *Server) tenantAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := c.GetQuery("tenant_id")
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse{
+				Detail: "Missing tenant_id parameter. Use tenant_id= for the default tenant.",
+			})
+			return
+		}
+		if !models.ValidTenantID(id) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse{
+				Detail: models.ErrInvalidTenantID.Error(),
+			})
+			return
+		}
+
+		adminToken := s.cfg.Admin.Token
+		tenantToken := s.cfg.Tenants.Tokens[id]
+		if adminToken == "" && tenantToken == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{
+				Detail: "Tenant API is disabled. Set admin.token or tenants.tokens to enable it.",
+			})
+			return
+		}
+
+		auth := c.GetHeader("Authorization")
+		provided := strings.TrimPrefix(auth, "Bearer ")
+		if provided == auth || !(tokenMatches(provided, adminToken) || tokenMatches(provided, tenantToken)) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+				Detail: "Invalid or missing tenant token",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// tokenMatches 以常量时间比较 Token，未配置的 Token 不匹配任何值
+func tokenMatches(provided, token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// postTelemetry 通过 API 上报一次遥测数据
+func postTelemetry(t *testing.T, s *Server, req models.TelemetryRequest) {
+	t.Helper()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	w := httptest.NewRecorder()
+	httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/telemetry", bytes.NewReader(body))
+	httpReq.Header.Set("Content-Type", "application/json")
+	s.router.ServeHTTP(w, httpReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("telemetry status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	s := newTestServer(t)
+	now := time.Now().Unix()
+
+	// 两个租户使用相同的 overlay 地址，拓扑互不影响
+	postTelemetry(t, s, models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: now,
+		Metrics:   []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(10)}},
+	})
+	postTelemetry(t, s, models.TelemetryRequest{
+		AgentID:   "A",
+		TenantID:  "acme",
+		Timestamp: now,
+		Metrics: []models.Metric{
+			{TargetIP: "C", RTTMs: ptrFloat64(10)},
+			{TargetIP: "D", RTTMs: ptrFloat64(10)},
+		},
+	})
+
+	if got := s.db.Count(); got != 1 {
+		t.Errorf("default tenant node count = %d, want 1", got)
+	}
+
+	var resp models.RouteResponse
+	w := doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A&tenant_id=acme")
+	if w.Code != http.StatusOK {
+		t.Fatalf("tenant routes status = %d, want 200", w.Code)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode routes: %v", err)
+	}
+	if _, ok := routeTo(resp.Routes, "B"); ok || len(resp.Routes) != 2 {
+		t.Errorf("acme routes = %+v, want routes to C and D only", resp.Routes)
+	}
+
+	w = doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A")
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode routes: %v", err)
+	}
+	if len(resp.Routes) != 1 || resp.Routes[0].DstCIDR != "B/32" {
+		t.Errorf("default routes = %+v, want one route to B", resp.Routes)
+	}
+
+	var topo TopologyResponse
+	w = doRequest(s, http.MethodGet, "/api/v1/topology?tenant_id=acme")
+	if err := json.Unmarshal(w.Body.Bytes(), &topo); err != nil {
+		t.Fatalf("decode topology: %v", err)
+	}
+	if topo.Total != 1 || len(topo.Nodes[0].Peers) != 2 {
+		t.Errorf("acme topology = %+v, want A with 2 peers", topo)
+	}
+}
+
+func TestTenantLookupErrors(t *testing.T) {
+	s := newTestServer(t)
+
+	if w := doRequest(s, http.MethodGet, "/api/v1/routes?agent_id=A&tenant_id=unknown"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown tenant: status = %d, want 404", w.Code)
+	}
+	if w := doRequest(s, http.MethodGet, "/api/v1/topology?tenant_id=bad%2Fid"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid tenant_id: status = %d, want 400", w.Code)
+	}
+}
+
+func TestReloadAppliesToAllTenants(t *testing.T) {
+	s := newTestServer(t)
+	acme, err := s.tenantFor("acme")
+	if err != nil {
+		t.Fatalf("tenantFor() error = %v", err)
+	}
+
+	cfg := *s.cfg
+	cfg.Algorithm.PenaltyFactor = 250
+	cfg.Topology.StaleThreshold = 2 * time.Minute
+	s.applyReloadable(&cfg)
+
+	if penalty, _ := acme.solver.Parameters(); penalty != 250 {
+		t.Errorf("tenant penalty factor = %g, want 250", penalty)
+	}
+	if got := acme.cleaner.Threshold(); got != 2*time.Minute {
+		t.Errorf("tenant stale threshold = %v, want 2m", got)
+	}
+}
+
+func TestTenantLimit(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Tenants.MaxTenants = 1
+
+	if _, err := s.tenantFor("acme"); err != nil {
+		t.Fatalf("tenantFor(acme) error = %v", err)
+	}
+	if _, err := s.tenantFor(models.DefaultTenantID); err != nil {
+		t.Errorf("default tenant should not count against the limit: %v", err)
+	}
+
+	body, _ := json.Marshal(models.TelemetryRequest{
+		AgentID:   "A",
+		TenantID:  "other",
+		Timestamp: time.Now().Unix(),
+		Metrics:   []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(10)}},
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/telemetry", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	s.router.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("telemetry for new tenant over the limit: status = %d, want 503", w.Code)
+	}
+	if _, ok := s.lookupTenant("other"); ok {
+		t.Error("tenant over the limit should not be created")
+	}
+}
+
+func TestReapIdleTenants(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.Tenants.MaxTenants = 1
+
+	acme, err := s.tenantFor("acme")
+	if err != nil {
+		t.Fatalf("tenantFor(acme) error = %v", err)
+	}
+	storeChain(acme.db)
+
+	// 仍有 Agent 的租户不会被回收
+	atomic.StoreInt64(&acme.lastActive, 0)
+	if _, err := s.tenantFor("other"); err != errTenantLimit {
+		t.Fatalf("tenantFor(other) error = %v, want errTenantLimit", err)
+	}
+
+	// Agent 全部过期后，闲置租户让出名额
+	acme.db.CleanStale(-time.Second)
+	if _, err := s.tenantFor("other"); err != nil {
+		t.Fatalf("tenantFor(other) after acme went idle error = %v", err)
+	}
+	if _, ok := s.lookupTenant("acme"); ok {
+		t.Error("idle tenant acme should have been removed")
+	}
+}
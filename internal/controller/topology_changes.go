@@ -0,0 +1,137 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// defaultChangeLogSize 默认保留的拓扑变更记录条数
+const defaultChangeLogSize = 1000
+
+// 拓扑变更记录类型
+const (
+	ChangeAgentJoined  = "agent_joined"  // Agent 首次写入或过期后重新出现
+	ChangeAgentRemoved = "agent_removed" // Agent 被清理或淘汰
+	ChangeLinksChanged = "links_changed" // Agent 的链路集合发生变化
+	ChangeLinkDisabled = "link_disabled" // 管理员禁用链路
+	ChangeLinkEnabled  = "link_enabled"  // 管理员恢复链路
+)
+
+// TopologyChangeLog 拓扑变更日志，固定容量的环形缓冲区
+// 只记录节点和链路的增减，链路指标的例行更新不记录，避免日志被遥测刷满
+type TopologyChangeLog struct {
+	mu       sync.RWMutex
+	entries  []models.TopologyChange
+	maxSize  int
+	position int
+	count    int
+}
+
+// NewTopologyChangeLog 创建拓扑变更日志
+func NewTopologyChangeLog(size int) *TopologyChangeLog {
+	if size <= 0 {
+		size = defaultChangeLogSize
+	}
+	return &TopologyChangeLog{
+		entries: make([]models.TopologyChange, size),
+		maxSize: size,
+	}
+}
+
+// Watch 订阅 db 的变更事件并记录
+func (l *TopologyChangeLog) Watch(db *TopologyDB) {
+	db.Subscribe(func(e DBEvent) {
+		if change, ok := topologyChange(e, time.Now()); ok {
+			l.Record(change)
+		}
+	})
+}
+
+// Record 记录一次变更，容量已满时覆盖最旧的记录
+func (l *TopologyChangeLog) Record(change models.TopologyChange) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[l.position] = change
+	l.position = (l.position + 1) % l.maxSize
+	if l.count < l.maxSize {
+		l.count++
+	}
+}
+
+// Query 按时间倒序返回变更记录
+// agentID 为空时返回所有 Agent 的记录，since > 0 时只返回该 Unix 时间及之后的记录，limit <= 0 表示不限制条数
+func (l *TopologyChangeLog) Query(agentID string, since int64, limit int) []models.TopologyChange {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	result := make([]models.TopologyChange, 0)
+	for i := 0; i < l.count; i++ {
+		idx := (l.position - 1 - i + l.maxSize) % l.maxSize
+		entry := l.entries[idx]
+		if since > 0 && entry.Timestamp < since {
+			break
+		}
+		if agentID != "" && entry.AgentID != agentID {
+			continue
+		}
+		result = append(result, entry)
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+	}
+	return result
+}
+
+// topologyChange 将数据库变更事件转换为变更记录，链路集合不变的更新返回 false
+func topologyChange(e DBEvent, now time.Time) (models.TopologyChange, bool) {
+	change := models.TopologyChange{
+		AgentID:   e.AgentID,
+		Actor:     e.Actor,
+		Version:   e.Version,
+		Timestamp: now.Unix(),
+	}
+	switch e.Type {
+	case DBEventStored:
+		change.Type = ChangeAgentJoined
+		change.AddedLinks = linkTargets(e.Data, nil)
+	case DBEventRemoved:
+		change.Type = ChangeAgentRemoved
+		change.RemovedLinks = linkTargets(e.Previous, nil)
+		if e.Previous != nil {
+			change.Reason = "last report at " + e.Previous.Timestamp.UTC().Format(time.RFC3339)
+		}
+	case DBEventUpdated:
+		change.Type = ChangeLinksChanged
+		change.AddedLinks = linkTargets(e.Data, e.Previous)
+		change.RemovedLinks = linkTargets(e.Previous, e.Data)
+		if len(change.AddedLinks) == 0 && len(change.RemovedLinks) == 0 {
+			return change, false
+		}
+	default:
+		return change, false
+	}
+	return change, true
+}
+
+// linkTargets 返回 data 中存在而 except 中不存在的链路目标，按 target_ip 排序
+func linkTargets(data, except *models.AgentData) []string {
+	if data == nil {
+		return nil
+	}
+	var targets []string
+	for target := range data.Metrics {
+		if except != nil {
+			if _, ok := except.Metrics[target]; ok {
+				continue
+			}
+		}
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
@@ -2,120 +2,539 @@
 package controller
 
 import (
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/holygeek00/lite-sdwan/pkg/models"
 )
 
 // TopologyDB 拓扑数据库，存储所有 Agent 的遥测数据
+//
+// 存储的 AgentData 和 MetricData 是不可变快照：写入总是创建新对象并替换 map 中的指针，
+// 从不修改已存储的对象。Get/GetAll 返回的数据因此可以在不持锁的情况下读取，
+// 路由计算与遥测写入并发进行时看到的始终是每个 Agent 某个时刻的完整数据；调用方不得修改返回的数据。
+//
+// 数据按 agent_id 分布在 topologyShardCount 个分片中，遥测写入只锁定 Agent 所在的分片，
+// 大量 Agent 并发上报时不会争用同一把锁，也不会阻塞路由计算的 GetAll。
+// 需要跨分片一致的操作（过期清理、容量淘汰、模拟变更）按分片顺序锁定全部分片。
 type TopologyDB struct {
+	shards  [topologyShardCount]topologyShard
+	count   int64  // Agent 数量，原子访问
+	version uint64 // 每次数据变化时递增，用于判断路由缓存是否失效，原子访问
+
+	// 以下设置和计数原子访问
+	history        int64 // 每条链路保留的 RTT 样本数
+	maxAgents      int64 // 容量上限和淘汰计数，见 SetLimits
+	maxMetrics     int64
+	evictedAgents  uint64
+	evictedMetrics uint64
+
+	// 因过期被清理的 Agent 的记录，见 Tombstone
+	tombMu       sync.Mutex
+	tombstones   map[string]Tombstone
+	tombstoneTTL time.Duration
+
+	// 变更回调，见 Subscribe
+	observerMu     sync.Mutex
+	notifyMu       sync.Mutex
+	observers      []dbObserver
+	nextObserverID uint64
+}
+
+// topologyShardCount 拓扑数据的分片数
+const topologyShardCount = 32
+
+// topologyShard 拓扑数据的一个分片
+type topologyShard struct {
 	mu   sync.RWMutex
 	data map[string]*models.AgentData // agent_id -> data
 }
 
+// defaultHistorySize 每条链路默认保留的 RTT 样本数
+const defaultHistorySize = 60
+
 // NewTopologyDB 创建新的拓扑数据库
 func NewTopologyDB() *TopologyDB {
-	return &TopologyDB{
-		data: make(map[string]*models.AgentData),
+	db := &TopologyDB{
+		history:      defaultHistorySize,
+		tombstoneTTL: defaultTombstoneTTL,
+	}
+	for i := range db.shards {
+		db.shards[i].data = make(map[string]*models.AgentData)
+	}
+	return db
+}
+
+// shardFor 返回 Agent 所在的分片（FNV-1a 哈希）
+func (db *TopologyDB) shardFor(agentID string) *topologyShard {
+	h := uint32(2166136261)
+	for i := 0; i < len(agentID); i++ {
+		h ^= uint32(agentID[i])
+		h *= 16777619
+	}
+	return &db.shards[h%topologyShardCount]
+}
+
+// lockAll 按顺序锁定全部分片
+func (db *TopologyDB) lockAll() {
+	for i := range db.shards {
+		db.shards[i].mu.Lock()
+	}
+}
+
+// unlockAll 释放全部分片的写锁
+func (db *TopologyDB) unlockAll() {
+	for i := range db.shards {
+		db.shards[i].mu.Unlock()
+	}
+}
+
+// forEach 依次在各分片的读锁下遍历全部数据
+// 不同分片在不同时刻读取，结果中每个 Agent 的数据是完整快照，但不保证是同一时刻的全局快照
+func (db *TopologyDB) forEach(fn func(agentID string, data *models.AgentData)) {
+	for i := range db.shards {
+		s := &db.shards[i]
+		s.mu.RLock()
+		for agentID, data := range s.data {
+			fn(agentID, data)
+		}
+		s.mu.RUnlock()
+	}
+}
+
+// SetHistorySize 设置每条链路保留的 RTT 样本数，0 表示不保留，新的遥测写入时生效
+func (db *TopologyDB) SetHistorySize(n int) {
+	atomic.StoreInt64(&db.history, int64(n))
+}
+
+// Store 存储 Agent 的遥测数据，返回是否存储
+// 部分更新（req.Partial）只覆盖上报的链路，其余链路保留已有数据；
+// 序号不大于已存储序号的遥测（延迟到达的重试请求）被忽略，不会覆盖较新的数据
+func (db *TopologyDB) Store(req *models.TelemetryRequest) bool {
+	return db.storeTelemetry(req, req.AgentID, nil)
+}
+
+// StoreAs 与 Store 相同，但变更事件的来源记为 actor 而不是上报的 Agent
+func (db *TopologyDB) StoreAs(req *models.TelemetryRequest, actor string) bool {
+	return db.storeTelemetry(req, actor, nil)
+}
+
+// StoreIfNewer 仅当遥测数据比已有数据新时才存储，返回是否存储
+// 用于合并来自其他 Controller 副本的数据，actor 为变更事件记录的来源
+// Agent 时间戳只精确到秒，同一秒内的数据按 Controller 接受时间（纳秒）比较
+func (db *TopologyDB) StoreIfNewer(req *models.TelemetryRequest, actor string) bool {
+	return db.storeTelemetry(req, actor, func(prev *models.AgentData) bool {
+		return newerThan(prev, time.Unix(req.Timestamp, 0), time.Unix(0, req.ReceivedAtNs))
+	})
+}
+
+// Restore 写入导出的 Agent 数据（见 Export），仅当比已有数据新时写入，返回是否写入
+// 用于从持久化状态恢复和合并其他副本的数据；与 StoreIfNewer 不同，链路的样本计数和 RTT 历史原样保留
+func (db *TopologyDB) Restore(agentID string, data *models.AgentData, actor string) bool {
+	accept := func(prev *models.AgentData) bool {
+		return newerThan(prev, data.Timestamp, data.ReceivedAt)
 	}
+	return db.storeIf(agentID, data.Sequence, actor, accept, func(*models.AgentData) *models.AgentData {
+		restored := copyAgentData(data)
+		size := int(atomic.LoadInt64(&db.history))
+		for target, m := range restored.Metrics {
+			if len(m.RTTHistory) > size {
+				trimmed := *m
+				trimmed.RTTHistory = append([]models.RTTSample(nil), m.RTTHistory[len(m.RTTHistory)-size:]...)
+				restored.Metrics[target] = &trimmed
+			}
+		}
+		db.trimMetricsLocked(restored.Metrics)
+		return restored
+	})
 }
 
-// Store 存储 Agent 的遥测数据
-func (db *TopologyDB) Store(req *models.TelemetryRequest) {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+// Export 导出全部 Agent 的完整数据，按 agent_id 排序，返回的 AgentData 是只读快照
+func (db *TopologyDB) Export() []PersistedAgent {
+	result := make([]PersistedAgent, 0, db.Count())
+	db.forEach(func(agentID string, data *models.AgentData) {
+		result = append(result, PersistedAgent{AgentID: agentID, AgentData: data})
+	})
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].AgentID < result[j].AgentID
+	})
+	return result
+}
+
+// newerThan 判断时间戳为 ts、接受时间为 receivedAt 的数据是否比 prev 新，prev 为 nil 时为 true
+func newerThan(prev *models.AgentData, ts, receivedAt time.Time) bool {
+	if prev == nil {
+		return true
+	}
+	if !ts.Equal(prev.Timestamp) {
+		return ts.After(prev.Timestamp)
+	}
+	return receivedAt.After(prev.ReceivedAt)
+}
+
+// storeTelemetry 在序号检查和 accept（可为 nil）都通过时存储遥测，返回是否存储
+func (db *TopologyDB) storeTelemetry(req *models.TelemetryRequest, actor string, accept func(prev *models.AgentData) bool) bool {
+	return db.storeIf(req.AgentID, req.Sequence, actor, accept, func(prev *models.AgentData) *models.AgentData {
+		return db.buildLocked(prev, req)
+	})
+}
+
+// storeIf 在序号检查和 accept（可为 nil）都通过时存储 build 生成的数据，返回是否存储
+// 通常只锁定 Agent 所在的分片；新 Agent 写入时已达容量上限，需要跨分片淘汰，改为锁定全部分片后重新检查
+func (db *TopologyDB) storeIf(agentID string, sequence uint64, actor string, accept func(prev *models.AgentData) bool, build func(prev *models.AgentData) *models.AgentData) bool {
+	acceptable := func(prev *models.AgentData) bool {
+		return !outOfOrder(prev, sequence) && (accept == nil || accept(prev))
+	}
+
+	s := db.shardFor(agentID)
+	s.mu.Lock()
+	prev := s.data[agentID]
+	if !acceptable(prev) {
+		s.mu.Unlock()
+		return false
+	}
+	if prev != nil || !db.full() {
+		event := db.putLocked(s, agentID, build(prev), actor)
+		db.unlockAndNotify([]DBEvent{event}, s.mu.Unlock)
+		return true
+	}
+	s.mu.Unlock()
+
+	db.lockAll()
+	prev = s.data[agentID]
+	if !acceptable(prev) {
+		db.unlockAll()
+		return false
+	}
+	var events []DBEvent
+	for prev == nil && db.full() {
+		event, ok := db.evictOldestAgentLocked()
+		if !ok {
+			break
+		}
+		events = append(events, event)
+	}
+	events = append(events, db.putLocked(s, agentID, build(prev), actor))
+	db.unlockAndNotify(events, db.unlockAll)
+	return true
+}
+
+// outOfOrder 判断遥测序号是否不大于该 Agent 已存储的序号，任一方未携带序号时不比较
+// Agent 重启后序号变小时，旧数据过期清理后即恢复接受
+func outOfOrder(prev *models.AgentData, sequence uint64) bool {
+	return prev != nil && sequence != 0 && prev.Sequence != 0 && sequence <= prev.Sequence
+}
+
+// putLocked 写入 Agent 数据并返回来源为 actor 的变更事件，调用方需持有分片 s 的写锁
+func (db *TopologyDB) putLocked(s *topologyShard, agentID string, data *models.AgentData, actor string) DBEvent {
+	version := atomic.AddUint64(&db.version, 1)
+	prev := s.data[agentID]
+	if prev == nil {
+		db.unbury(agentID)
+	}
+	s.data[agentID] = data
+
+	event := DBEvent{Type: DBEventUpdated, AgentID: agentID, Actor: actor, Data: data, Previous: prev, Version: version}
+	if prev == nil {
+		event.Type = DBEventStored
+		atomic.AddInt64(&db.count, 1)
+	}
+	return event
+}
 
+// buildLocked 由遥测和已存储的数据 prev（可为 nil）生成新的 Agent 数据，调用方需持有 Agent 所在分片的写锁
+// 已存储的 MetricData 不会被修改，合并时复用未上报链路的原有指针
+func (db *TopologyDB) buildLocked(prev *models.AgentData, req *models.TelemetryRequest) *models.AgentData {
+	merge := req.Partial && prev != nil
 	metrics := make(map[string]*models.MetricData)
+	if merge {
+		for target, m := range prev.Metrics {
+			metrics[target] = m
+		}
+	}
 	for _, m := range req.Metrics {
-		metrics[m.TargetIP] = &models.MetricData{
-			RTT:  m.RTTMs,
-			Loss: m.LossRate,
+		updatedAt := time.Unix(req.Timestamp, 0)
+		if m.MeasuredAt > 0 {
+			updatedAt = time.Unix(m.MeasuredAt, 0)
+		}
+		var old *models.MetricData
+		if prev != nil {
+			old = prev.Metrics[m.TargetIP]
+		}
+		// 合并时忽略比已有测量更早的数据，乱序到达的部分更新不会覆盖较新的结果
+		if merge && old != nil && updatedAt.Before(old.UpdatedAt) {
+			continue
+		}
+
+		data := &models.MetricData{
+			RTT:       m.RTTMs,
+			Loss:      m.LossRate,
+			Jitter:    m.JitterMs,
+			Bandwidth: m.BandwidthMbps,
+			P50:       m.RTTP50Ms,
+			P95:       m.RTTP95Ms,
+			P99:       m.RTTP99Ms,
+			UpdatedAt: updatedAt,
+
+			HandshakeAgeSec: m.HandshakeAgeSec,
+			HandshakeNever:  m.HandshakeNever,
+		}
+		if m.RTTMs != nil {
+			data.Samples = 1
+			if old != nil && old.Samples > 0 {
+				data.Samples = old.Samples + 1
+			}
 		}
+		data.RTTHistory = db.appendHistory(old, m.RTTMs, updatedAt)
+		metrics[m.TargetIP] = data
 	}
+	db.trimMetricsLocked(metrics)
 
-	db.data[req.AgentID] = &models.AgentData{
-		Timestamp: time.Unix(req.Timestamp, 0),
-		Metrics:   metrics,
+	data := &models.AgentData{
+		Timestamp:      time.Unix(req.Timestamp, 0),
+		Metrics:        metrics,
+		ReportInterval: time.Duration(req.ReportIntervalSec) * time.Second,
+		Metadata:       req.Metadata,
+		Sequence:       req.Sequence,
+		ReceivedAt:     time.Now(),
 	}
+	if req.ReceivedAtNs > 0 {
+		data.ReceivedAt = time.Unix(0, req.ReceivedAtNs)
+	}
+	if prev != nil && data.Metadata == nil {
+		data.Metadata = prev.Metadata
+	}
+	if merge {
+		if prev.Timestamp.After(data.Timestamp) {
+			data.Timestamp = prev.Timestamp
+		}
+		if data.ReportInterval == 0 {
+			data.ReportInterval = prev.ReportInterval
+		}
+		if data.Sequence == 0 {
+			data.Sequence = prev.Sequence
+		}
+	}
+	return data
 }
 
-// Get 获取指定 Agent 的数据
+// appendHistory 在 old 的 RTT 样本后追加测量时间为 at 的 rtt 并截断到 db.history，返回新切片，不修改 old
+// 超时（rtt 为 nil）不计入样本
+func (db *TopologyDB) appendHistory(old *models.MetricData, rtt *float64, at time.Time) []models.RTTSample {
+	var history []models.RTTSample
+	if old != nil {
+		history = append(history, old.RTTHistory...)
+	}
+	if rtt != nil {
+		history = append(history, models.RTTSample{At: at, RTTMs: *rtt})
+	}
+	if size := int(atomic.LoadInt64(&db.history)); len(history) > size {
+		history = history[len(history)-size:]
+	}
+	return history
+}
+
+// Clone 复制拓扑数据库，用于在副本上模拟拓扑变更
+// 存储的数据不可变，副本与原数据库共享 AgentData，修改副本时按写时复制替换
+func (db *TopologyDB) Clone() *TopologyDB {
+	clone := &TopologyDB{
+		history: atomic.LoadInt64(&db.history),
+	}
+	for i := range db.shards {
+		s := &db.shards[i]
+		s.mu.RLock()
+		clone.shards[i].data = make(map[string]*models.AgentData, len(s.data))
+		for agentID, data := range s.data {
+			clone.shards[i].data[agentID] = data
+		}
+		clone.count += int64(len(s.data))
+		s.mu.RUnlock()
+	}
+	clone.version = atomic.LoadUint64(&db.version)
+	return clone
+}
+
+// copyAgentData 复制 AgentData 及其 Metrics map，MetricData 仍与原数据共享
+func copyAgentData(data *models.AgentData) *models.AgentData {
+	copied := *data
+	copied.Metrics = make(map[string]*models.MetricData, len(data.Metrics))
+	for target, m := range data.Metrics {
+		copied.Metrics[target] = m
+	}
+	return &copied
+}
+
+// Snapshot 以遥测请求的形式导出全部数据，按 agent_id 排序
+func (db *TopologyDB) Snapshot() []models.TelemetryRequest {
+	result := make([]models.TelemetryRequest, 0, db.Count())
+	db.forEach(func(agentID string, data *models.AgentData) {
+		result = append(result, agentTelemetry(agentID, data))
+	})
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].AgentID < result[j].AgentID
+	})
+	return result
+}
+
+// AgentSnapshot 以完整遥测请求的形式导出单个 Agent 的数据（包含合并后的全部链路）
+func (db *TopologyDB) AgentSnapshot(agentID string) (models.TelemetryRequest, bool) {
+	data, ok := db.Get(agentID)
+	if !ok {
+		return models.TelemetryRequest{}, false
+	}
+	return agentTelemetry(agentID, data), true
+}
+
+// agentTelemetry 将存储的 Agent 数据转换为完整遥测请求
+func agentTelemetry(agentID string, data *models.AgentData) models.TelemetryRequest {
+	return models.TelemetryRequest{
+		AgentID:           agentID,
+		Timestamp:         data.Timestamp.Unix(),
+		Metrics:           agentMetrics(data),
+		ReportIntervalSec: int64(data.ReportInterval / time.Second),
+		Metadata:          data.Metadata,
+		Sequence:          data.Sequence,
+		ReceivedAtNs:      data.ReceivedAt.UnixNano(),
+	}
+}
+
+// Get 获取指定 Agent 的数据，返回只读快照
 func (db *TopologyDB) Get(agentID string) (*models.AgentData, bool) {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
+	s := db.shardFor(agentID)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	data, ok := db.data[agentID]
+	data, ok := s.data[agentID]
 	return data, ok
 }
 
 // GetAll 获取所有 Agent 的数据
+// 返回的 map 是副本，其中的 AgentData 是只读快照，之后的写入不会影响它们
 func (db *TopologyDB) GetAll() map[string]*models.AgentData {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
+	result := make(map[string]*models.AgentData, db.Count())
+	db.forEach(func(agentID string, data *models.AgentData) {
+		result[agentID] = data
+	})
+	return result
+}
 
-	// 返回副本
-	result := make(map[string]*models.AgentData)
-	for k, v := range db.data {
-		result[k] = v
-	}
+// GetReportersOf 返回上报了到 targetIP 链路数据的 Agent 及对应的链路数据（只读快照）
+func (db *TopologyDB) GetReportersOf(targetIP string) map[string]*models.MetricData {
+	result := make(map[string]*models.MetricData)
+	db.forEach(func(agentID string, data *models.AgentData) {
+		if m, ok := data.Metrics[targetIP]; ok {
+			result[agentID] = m
+		}
+	})
 	return result
 }
 
 // Count 返回 Agent 数量
 func (db *TopologyDB) Count() int {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
-	return len(db.data)
+	return int(atomic.LoadInt64(&db.count))
 }
 
 // Exists 检查 Agent 是否存在
 func (db *TopologyDB) Exists(agentID string) bool {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
-	_, ok := db.data[agentID]
+	_, ok := db.Get(agentID)
 	return ok
 }
 
 // GetAllAgentIDs 获取所有 Agent ID
 func (db *TopologyDB) GetAllAgentIDs() []string {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
-
-	ids := make([]string, 0, len(db.data))
-	for id := range db.data {
-		ids = append(ids, id)
-	}
+	ids := make([]string, 0, db.Count())
+	db.forEach(func(agentID string, _ *models.AgentData) {
+		ids = append(ids, agentID)
+	})
 	return ids
 }
 
-// CleanStale 清理过期数据
+// CleanStale 清理超过 threshold 未上报的数据
 func (db *TopologyDB) CleanStale(threshold time.Duration) int {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+	return db.CleanExpired(StalePolicy{Threshold: threshold})
+}
+
+// CleanExpired 按过期策略清理数据，每个 Agent 的过期阈值见 StalePolicy.For，返回被清理的 Agent 数
+// 被清理的 Agent 留下过期记录（见 Tombstone），在保留时间内仍可查询到它曾经存在；
+// 仍在上报的 Agent 中已过期的单条链路（见 StalePolicy.LinkStale）同样被删除，
+// 隔离期内的 Agent（见 StalePolicy.Degraded）保留全部链路，恢复上报后无需重新建立
+func (db *TopologyDB) CleanExpired(policy StalePolicy) int {
+	return db.cleanExpired(policy, ActorCleaner)
+}
+
+// cleanExpired 与 CleanExpired 相同，变更事件的来源记为 actor
+func (db *TopologyDB) cleanExpired(policy StalePolicy, actor string) int {
+	db.lockAll()
 
 	now := time.Now()
-	count := 0
-	for id, data := range db.data {
-		if now.Sub(data.Timestamp) > threshold {
-			delete(db.data, id)
-			count++
+	var removed, updated []DBEvent
+	for i := range db.shards {
+		s := &db.shards[i]
+		for id, data := range s.data {
+			if policy.Expired(data, now) {
+				delete(s.data, id)
+				removed = append(removed, DBEvent{Type: DBEventRemoved, AgentID: id, Actor: actor, Previous: data})
+				continue
+			}
+			if policy.Degraded(data, now) {
+				continue
+			}
+			if pruned := pruneStaleLinks(data, policy, now); pruned != data {
+				s.data[id] = pruned
+				updated = append(updated, DBEvent{Type: DBEventUpdated, AgentID: id, Actor: actor, Data: pruned, Previous: data})
+			}
+		}
+	}
+	events := make([]DBEvent, 0, len(removed)+len(updated))
+	events = append(append(events, removed...), updated...)
+	if len(events) > 0 {
+		atomic.AddInt64(&db.count, -int64(len(removed)))
+		version := atomic.AddUint64(&db.version, 1)
+		sort.SliceStable(events, func(i, j int) bool {
+			if events[i].Type != events[j].Type {
+				return events[i].Type == DBEventRemoved
+			}
+			return events[i].AgentID < events[j].AgentID
+		})
+		for i := range events {
+			events[i].Version = version
+		}
+	}
+	db.buryLocked(removed, now)
+	db.unlockAndNotify(events, db.unlockAll)
+	return len(removed)
+}
+
+// pruneStaleLinks 返回删除了过期链路的 Agent 数据副本，没有过期链路时返回 data 本身
+func pruneStaleLinks(data *models.AgentData, policy StalePolicy, now time.Time) *models.AgentData {
+	pruned := data
+	for target, m := range data.Metrics {
+		if !policy.LinkStale(data, m, now) {
+			continue
 		}
+		if pruned == data {
+			pruned = copyAgentData(data)
+		}
+		delete(pruned.Metrics, target)
 	}
-	return count
+	return pruned
+}
+
+// Version 返回数据版本，任何写入或清理都会使其递增
+func (db *TopologyDB) Version() uint64 {
+	return atomic.LoadUint64(&db.version)
 }
 
 // GetLastUpdateTime 获取最后更新时间
 func (db *TopologyDB) GetLastUpdateTime() *time.Time {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
-
 	var lastUpdate *time.Time
-	for _, data := range db.data {
+	db.forEach(func(_ string, data *models.AgentData) {
 		if lastUpdate == nil || data.Timestamp.After(*lastUpdate) {
 			t := data.Timestamp
 			lastUpdate = &t
 		}
-	}
+	})
 	return lastUpdate
 }
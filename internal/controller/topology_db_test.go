@@ -1,9 +1,13 @@
 package controller
 
 import (
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/holygeek00/lite-sdwan/pkg/config"
 	"github.com/holygeek00/lite-sdwan/pkg/models"
 )
 
@@ -147,6 +151,347 @@ func TestTopologyDBCleanStale(t *testing.T) {
 	}
 }
 
+func TestTopologyDBStoreSequence(t *testing.T) {
+	db := NewTopologyDB()
+	now := time.Now().Unix()
+	report := func(seq uint64, rtt float64) bool {
+		return db.Store(&models.TelemetryRequest{
+			AgentID:   "A",
+			Timestamp: now,
+			Sequence:  seq,
+			Metrics:   []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(rtt)}},
+		})
+	}
+
+	if !report(5, 10) || !report(7, 20) {
+		t.Fatal("increasing sequences should be stored")
+	}
+	version := db.Version()
+
+	// 延迟到达的重试请求（序号更小或重复）不覆盖较新的数据
+	if report(6, 99) || report(7, 99) {
+		t.Error("Store() should ignore out-of-order sequences")
+	}
+	data, _ := db.Get("A")
+	if *data.Metrics["B"].RTT != 20 || data.Sequence != 7 {
+		t.Errorf("stored = {RTT: %v, Sequence: %d}, want {20, 7}", *data.Metrics["B"].RTT, data.Sequence)
+	}
+	if db.Version() != version {
+		t.Error("ignored telemetry should not bump the version")
+	}
+
+	// 未携带序号的遥测不做检查
+	if !report(0, 30) {
+		t.Error("telemetry without sequence should be stored")
+	}
+	if !report(1, 40) {
+		t.Error("sequence should be accepted after an unsequenced report")
+	}
+
+	// 共享存储同步同样遵守序号
+	if db.StoreIfNewer(&models.TelemetryRequest{AgentID: "A", Timestamp: now + 10, Sequence: 1}, ActorReplication) {
+		t.Error("StoreIfNewer() should ignore out-of-order sequences")
+	}
+	if snapshot, _ := db.AgentSnapshot("A"); snapshot.Sequence != 1 {
+		t.Errorf("snapshot sequence = %d, want 1", snapshot.Sequence)
+	}
+}
+
+func TestTopologyDBStoreIfNewerSameSecond(t *testing.T) {
+	primary := NewTopologyDB()
+	replica := NewTopologyDB()
+	now := time.Now().Unix()
+
+	// 同一秒内的两次上报按接受时间区分新旧
+	primary.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: now, Metrics: []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(10)}}})
+	first, _ := primary.AgentSnapshot("A")
+	time.Sleep(time.Millisecond)
+	primary.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: now, Metrics: []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(50)}}})
+	second, _ := primary.AgentSnapshot("A")
+
+	if !replica.StoreIfNewer(&first, ActorReplication) {
+		t.Fatal("StoreIfNewer() rejected data for a new agent")
+	}
+	if !replica.StoreIfNewer(&second, ActorReplication) {
+		t.Error("StoreIfNewer() rejected a later report from the same second")
+	}
+	if replica.StoreIfNewer(&first, ActorReplication) {
+		t.Error("StoreIfNewer() accepted an earlier report from the same second")
+	}
+	if a, _ := replica.Get("A"); *a.Metrics["B"].RTT != 50 {
+		t.Errorf("RTT = %v, want 50 from the later report", *a.Metrics["B"].RTT)
+	}
+}
+
+func TestTopologyDBStorePartial(t *testing.T) {
+	db := NewTopologyDB()
+	now := time.Now().Unix()
+
+	db.Store(&models.TelemetryRequest{
+		AgentID:           "A",
+		Timestamp:         now - 20,
+		ReportIntervalSec: 10,
+		Metrics: []models.Metric{
+			{TargetIP: "B", RTTMs: ptrFloat64(10)},
+			{TargetIP: "C", RTTMs: ptrFloat64(20)},
+		},
+	})
+
+	// 部分更新只覆盖 B，C 保留；D 为新链路，按 measured_at 记录测量时间
+	db.Store(&models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: now,
+		Partial:   true,
+		Metrics: []models.Metric{
+			{TargetIP: "B", RTTMs: ptrFloat64(15)},
+			{TargetIP: "D", RTTMs: ptrFloat64(30), MeasuredAt: now - 5},
+		},
+	})
+
+	data, _ := db.Get("A")
+	if len(data.Metrics) != 3 {
+		t.Fatalf("metrics = %d, want 3", len(data.Metrics))
+	}
+	if b := data.Metrics["B"]; *b.RTT != 15 || b.Samples != 2 || b.UpdatedAt.Unix() != now {
+		t.Errorf("B = {RTT: %v, Samples: %d, UpdatedAt: %v}, want {15, 2, now}", *b.RTT, b.Samples, b.UpdatedAt)
+	}
+	if c := data.Metrics["C"]; *c.RTT != 20 || c.UpdatedAt.Unix() != now-20 {
+		t.Errorf("C = {RTT: %v, UpdatedAt: %v}, want kept from first report", *c.RTT, c.UpdatedAt)
+	}
+	if d := data.Metrics["D"]; d.UpdatedAt.Unix() != now-5 {
+		t.Errorf("D.UpdatedAt = %v, want measured_at", d.UpdatedAt)
+	}
+	if data.ReportInterval != 10*time.Second {
+		t.Errorf("ReportInterval = %v, want kept 10s", data.ReportInterval)
+	}
+
+	// 乱序到达的较早测量不覆盖较新的数据
+	db.Store(&models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: now - 10,
+		Partial:   true,
+		Metrics:   []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(99)}},
+	})
+	data, _ = db.Get("A")
+	if *data.Metrics["B"].RTT != 15 {
+		t.Errorf("B.RTT = %v after out-of-order update, want 15", *data.Metrics["B"].RTT)
+	}
+	if data.Timestamp.Unix() != now {
+		t.Errorf("Timestamp = %v, want latest report", data.Timestamp)
+	}
+
+	// 完整上报替换全部链路
+	db.Store(&models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: now + 1,
+		Metrics:   []models.Metric{{TargetIP: "C", RTTMs: ptrFloat64(25)}},
+	})
+	snapshot, _ := db.AgentSnapshot("A")
+	if len(snapshot.Metrics) != 1 || snapshot.Metrics[0].TargetIP != "C" || snapshot.Metrics[0].MeasuredAt != now+1 {
+		t.Errorf("snapshot metrics = %+v, want only C", snapshot.Metrics)
+	}
+}
+
+func TestTopologyDBRTTHistory(t *testing.T) {
+	db := NewTopologyDB()
+	db.SetHistorySize(20)
+
+	now := time.Now().Unix()
+	for i := 1; i <= 25; i++ {
+		rtt := ptrFloat64(float64(i))
+		if i == 10 {
+			rtt = nil // 超时不计入样本
+		}
+		db.Store(&models.TelemetryRequest{
+			AgentID:   "A",
+			Timestamp: now + int64(i),
+			Metrics:   []models.Metric{{TargetIP: "B", RTTMs: rtt}},
+		})
+	}
+
+	data, _ := db.Get("A")
+	history := data.Metrics["B"].RTTHistory
+	if len(history) != 20 || history[0].RTTMs != 5 || history[19].RTTMs != 25 || history[19].At.Unix() != now+25 {
+		t.Fatalf("history = %v, want the last 20 samples 5..25 without 10", history)
+	}
+
+	summary := summarizeRTT(history)
+	want := RTTSummary{Min: 5, Max: 25, P95: 24, Samples: 20}
+	if *summary != want {
+		t.Errorf("summary = %+v, want %+v", *summary, want)
+	}
+	if summarizeRTT(nil) != nil {
+		t.Error("summarizeRTT(nil) should be nil")
+	}
+}
+
+func TestTopologyDBLimits(t *testing.T) {
+	db := NewTopologyDB()
+	db.SetLimits(3, 2)
+
+	var removed []string
+	db.Subscribe(func(e DBEvent) {
+		if e.Type == DBEventRemoved {
+			removed = append(removed, e.AgentID)
+		}
+	})
+
+	now := time.Now().Unix()
+	for i, id := range []string{"B", "A", "C"} {
+		db.Store(&models.TelemetryRequest{
+			AgentID:   id,
+			Timestamp: now - int64(10*(3-i)),
+			Metrics:   []models.Metric{{TargetIP: "X", RTTMs: ptrFloat64(1)}},
+		})
+	}
+	if !db.NearCapacity() {
+		t.Error("NearCapacity() = false at 3/3 agents")
+	}
+
+	// 第 4 个 Agent 写入时淘汰最久未上报的 B；已有 Agent 的更新不触发淘汰
+	db.Store(&models.TelemetryRequest{AgentID: "D", Timestamp: now, Metrics: []models.Metric{{TargetIP: "X"}}})
+	db.Store(&models.TelemetryRequest{AgentID: "D", Timestamp: now + 1, Metrics: []models.Metric{{TargetIP: "X"}}})
+	if db.Count() != 3 || db.Exists("B") {
+		t.Errorf("agents = %v, want B evicted", db.GetAllAgentIDs())
+	}
+	if len(removed) != 1 || removed[0] != "B" {
+		t.Errorf("removed events = %v, want [B]", removed)
+	}
+
+	// 链路超过上限时淘汰测量时间最早的链路
+	db.Store(&models.TelemetryRequest{
+		AgentID:   "A",
+		Timestamp: now,
+		Metrics: []models.Metric{
+			{TargetIP: "X", MeasuredAt: now - 30},
+			{TargetIP: "Y", MeasuredAt: now - 10},
+			{TargetIP: "Z", MeasuredAt: now - 20},
+		},
+	})
+	data, _ := db.Get("A")
+	if _, ok := data.Metrics["X"]; ok || len(data.Metrics) != 2 {
+		t.Errorf("metrics = %v, want Y and Z", data.Metrics)
+	}
+
+	if agents, metrics := db.Evictions(); agents != 1 || metrics != 1 {
+		t.Errorf("Evictions() = (%d, %d), want (1, 1)", agents, metrics)
+	}
+}
+
+func TestTopologyDBCleanExpired(t *testing.T) {
+	db := NewTopologyDB()
+	age := time.Now().Add(-90 * time.Second).Unix()
+
+	// slow 每 60s 上报一次，90s 未上报仍在 3 个间隔内
+	db.Store(&models.TelemetryRequest{AgentID: "slow", Timestamp: age, ReportIntervalSec: 60})
+	// fast 每 10s 上报一次，90s 未上报已超过 3 个间隔
+	db.Store(&models.TelemetryRequest{AgentID: "fast", Timestamp: age, ReportIntervalSec: 10})
+	// legacy 未声明间隔，使用全局阈值
+	db.Store(&models.TelemetryRequest{AgentID: "legacy", Timestamp: age})
+
+	policy := StalePolicy{Threshold: 60 * time.Second, IntervalMultiplier: 3}
+	slow, _ := db.Get("slow")
+	if got := policy.For(slow); got != 180*time.Second {
+		t.Errorf("For(slow) = %v, want 3m0s", got)
+	}
+
+	if cleaned := db.CleanExpired(policy); cleaned != 2 {
+		t.Errorf("cleaned %d agents, want 2", cleaned)
+	}
+	if !db.Exists("slow") || db.Exists("fast") || db.Exists("legacy") {
+		t.Errorf("remaining agents = %v, want [slow]", db.GetAllAgentIDs())
+	}
+
+	// 倍数为 0 时所有 Agent 使用全局阈值
+	if cleaned := db.CleanExpired(StalePolicy{Threshold: 60 * time.Second}); cleaned != 1 {
+		t.Errorf("cleaned %d agents without multiplier, want 1", cleaned)
+	}
+}
+
+func TestTopologyDBApplyRetention(t *testing.T) {
+	db := NewTopologyDB()
+	db.SetHistorySize(100)
+
+	// 每 10 秒一个样本，共 30 分钟
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 180; i++ {
+		at := base.Add(time.Duration(i) * 10 * time.Second).Unix()
+		db.Store(&models.TelemetryRequest{
+			AgentID:   "A",
+			Timestamp: at,
+			Metrics:   []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(float64(i % 6))}},
+		})
+	}
+	before, _ := db.Get("A")
+	if n := len(before.Metrics["B"].RTTHistory); n != 100 {
+		t.Fatalf("history = %d samples, want 100", n)
+	}
+	version := db.Version()
+
+	// 保留的 100 个样本为 12:13:20~12:29:50；删除 12:20 之前的，12:29 之前已结束的分钟合并为平均值
+	now := base.Add(30 * time.Minute)
+	retention := config.RetentionConfig{MaxAge: 10 * time.Minute, DownsampleInterval: time.Minute}
+	dropped := db.ApplyRetention(retention, now)
+
+	data, _ := db.Get("A")
+	history := data.Metrics["B"].RTTHistory
+	// 12:20~12:29 的 9 个分钟各合并为 1 个点，12:29 之后的 6 个样本保留原始值
+	if len(history) != 15 || dropped != 85 {
+		t.Fatalf("history = %d samples, dropped = %d, want 15 and 85", len(history), dropped)
+	}
+	if first := history[0]; !first.At.Equal(base.Add(20*time.Minute)) || first.RTTMs != 2.5 {
+		t.Errorf("first point = %+v, want the 12:20 minute average 2.5", first)
+	}
+	if last := history[14]; !last.At.Equal(base.Add(29*time.Minute + 50*time.Second)) {
+		t.Errorf("last point = %+v, want the raw 12:29:50 sample", last)
+	}
+	if n := len(before.Metrics["B"].RTTHistory); n != 100 {
+		t.Error("retention modified the stored snapshot")
+	}
+	if db.Version() != version {
+		t.Error("retention should not change the data version")
+	}
+
+	// 再次整理时已合并的点不变
+	if dropped := db.ApplyRetention(retention, now); dropped != 0 {
+		t.Errorf("second pass dropped %d samples, want 0", dropped)
+	}
+}
+
+func TestTopologyDBCleanStaleLinks(t *testing.T) {
+	db := NewTopologyDB()
+	now := time.Now().Unix()
+	db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: now - 300, Metrics: []models.Metric{
+		{TargetIP: "B", RTTMs: ptrFloat64(10)},
+		{TargetIP: "C", RTTMs: ptrFloat64(20)},
+	}})
+	// 部分更新让 A 保持在线，但 C 的测量停留在 5 分钟前
+	db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: now, Partial: true, Metrics: []models.Metric{
+		{TargetIP: "B", RTTMs: ptrFloat64(11)},
+	}})
+	before, _ := db.Get("A")
+
+	var events []DBEvent
+	db.Subscribe(func(e DBEvent) { events = append(events, e) })
+
+	if cleaned := db.CleanExpired(StalePolicy{Threshold: time.Minute}); cleaned != 0 {
+		t.Errorf("cleaned %d agents, want 0", cleaned)
+	}
+	data, _ := db.Get("A")
+	if _, ok := data.Metrics["C"]; ok || len(data.Metrics) != 1 {
+		t.Errorf("metrics = %v, want only B", data.Metrics)
+	}
+	if _, ok := before.Metrics["C"]; !ok {
+		t.Error("pruning modified the stored snapshot")
+	}
+	if len(events) != 1 || events[0].Type != DBEventUpdated || events[0].AgentID != "A" {
+		t.Errorf("events = %+v, want one update for A", events)
+	}
+	if _, ok := db.Tombstone("A"); ok {
+		t.Error("pruning links should not tombstone the agent")
+	}
+}
+
 func TestTopologyDBGetAllAgentIDs(t *testing.T) {
 	db := NewTopologyDB()
 
@@ -182,3 +527,270 @@ func TestTopologyDBGetAllAgentIDs(t *testing.T) {
 		t.Errorf("Missing agent IDs: %v", ids)
 	}
 }
+
+func TestTopologyDBVersion(t *testing.T) {
+	db := NewTopologyDB()
+	if v := db.Version(); v != 0 {
+		t.Fatalf("initial version = %d, want 0", v)
+	}
+
+	db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: time.Now().Unix(), Metrics: []models.Metric{{TargetIP: "B"}}})
+	v := db.Version()
+	if v == 0 {
+		t.Fatal("version not bumped by Store")
+	}
+
+	if n := db.CleanStale(time.Hour); n != 0 || db.Version() != v {
+		t.Errorf("CleanStale removed %d, version %d; want 0 and unchanged %d", n, db.Version(), v)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := db.CleanStale(time.Millisecond); n != 1 || db.Version() == v {
+		t.Errorf("CleanStale removed %d, version %d; want 1 and bumped", n, db.Version())
+	}
+}
+
+func TestTopologyDBSamples(t *testing.T) {
+	db := NewTopologyDB()
+	store := func(rtt *float64) int {
+		db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: time.Now().Unix(), Metrics: []models.Metric{
+			{TargetIP: "B", RTTMs: rtt, LossRate: 0},
+		}})
+		data, _ := db.Get("A")
+		return data.Metrics["B"].Samples
+	}
+
+	for i, want := range []int{1, 2, 3} {
+		if got := store(ptrFloat64(10)); got != want {
+			t.Errorf("report %d: Samples = %d, want %d", i+1, got, want)
+		}
+	}
+	// 超时后归零，恢复后重新计数
+	if got := store(nil); got != 0 {
+		t.Errorf("Samples after timeout = %d, want 0", got)
+	}
+	if got := store(ptrFloat64(10)); got != 1 {
+		t.Errorf("Samples after recovery = %d, want 1", got)
+	}
+}
+
+func TestTopologyDBSubscribe(t *testing.T) {
+	db := NewTopologyDB()
+
+	var events []DBEvent
+	unsubscribe := db.Subscribe(func(e DBEvent) {
+		// 回调中可以读取数据库
+		_ = db.Count()
+		events = append(events, e)
+	})
+
+	now := time.Now().Unix()
+	db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: now - 300})
+	db.Store(&models.TelemetryRequest{AgentID: "A", Timestamp: now - 200})
+	db.Store(&models.TelemetryRequest{AgentID: "B", Timestamp: now})
+	if db.StoreIfNewer(&models.TelemetryRequest{AgentID: "B", Timestamp: now - 1}, ActorReplication) {
+		t.Fatal("StoreIfNewer accepted older data")
+	}
+	db.CleanStale(time.Minute)
+
+	want := []struct {
+		typ, agent string
+		hasPrev    bool
+	}{
+		{DBEventStored, "A", false},
+		{DBEventUpdated, "A", true},
+		{DBEventStored, "B", false},
+		{DBEventRemoved, "A", true},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, w := range want {
+		e := events[i]
+		if e.Type != w.typ || e.AgentID != w.agent || (e.Previous != nil) != w.hasPrev {
+			t.Errorf("events[%d] = %s %s (previous %v), want %s %s", i, e.Type, e.AgentID, e.Previous != nil, w.typ, w.agent)
+		}
+		if i > 0 && e.Version <= events[i-1].Version {
+			t.Errorf("events[%d].Version = %d, not after %d", i, e.Version, events[i-1].Version)
+		}
+	}
+
+	unsubscribe()
+	db.Store(&models.TelemetryRequest{AgentID: "C", Timestamp: now})
+	if len(events) != len(want) {
+		t.Error("callback invoked after unsubscribe")
+	}
+}
+
+// TestTopologyDBConcurrentStoreAndCompute 在 go test -race 下验证遥测写入与路由计算、
+// 拓扑读取和模拟并发进行时没有数据竞争
+func TestTopologyDBConcurrentStoreAndCompute(t *testing.T) {
+	db := NewTopologyDB()
+	solver := NewRouteSolver(100, 0.15)
+	agents := []string{"10.254.0.1", "10.254.0.2", "10.254.0.3", "10.254.0.4"}
+
+	store := func(i int, partial bool) {
+		source := agents[i%len(agents)]
+		var metrics []models.Metric
+		for j, target := range agents {
+			if target != source {
+				metrics = append(metrics, models.Metric{TargetIP: target, RTTMs: ptrFloat64(float64(10 + (i+j)%50))})
+			}
+		}
+		db.Store(&models.TelemetryRequest{
+			AgentID:   source,
+			Timestamp: time.Now().Unix(),
+			Metrics:   metrics,
+			Partial:   partial,
+		})
+	}
+	for i := range agents {
+		store(i, false)
+	}
+
+	const iterations = 200
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < iterations; i++ {
+			store(i, i%2 == 0)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < iterations; i++ {
+			solver.ComputeRoutes(db, agents[i%len(agents)])
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < iterations; i++ {
+			for _, data := range db.GetAll() {
+				for _, m := range data.Metrics {
+					_ = summarizeRTT(m.RTTHistory)
+				}
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < iterations; i++ {
+			clone := db.Clone()
+			err := clone.applyMutation(models.TopologyMutation{
+				Type:   models.MutationLinkCost,
+				Source: agents[0],
+				Target: agents[1],
+				RTTMs:  ptrFloat64(500),
+			})
+			if err != nil {
+				t.Errorf("applyMutation() error = %v", err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	// 模拟只修改副本
+	data, _ := db.Get(agents[0])
+	if rtt := *data.Metrics[agents[1]].RTT; rtt == 500 {
+		t.Error("mutation on clone leaked into the live database")
+	}
+	if db.Count() != len(agents) {
+		t.Errorf("Count() = %d, want %d", db.Count(), len(agents))
+	}
+}
+
+// TestTopologyDBConcurrentEviction 并发写入新 Agent 时跨分片淘汰仍遵守容量上限
+func TestTopologyDBConcurrentEviction(t *testing.T) {
+	db := NewTopologyDB()
+	db.SetLimits(50, 0)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				db.Store(&models.TelemetryRequest{
+					AgentID:   fmt.Sprintf("10.%d.%d.1", w, i),
+					Timestamp: time.Now().Unix(),
+				})
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if db.Count() != 50 || len(db.GetAll()) != 50 {
+		t.Errorf("Count() = %d, GetAll() = %d, want 50", db.Count(), len(db.GetAll()))
+	}
+	if agents, _ := db.Evictions(); agents != 8*100-50 {
+		t.Errorf("evicted agents = %d, want %d", agents, 8*100-50)
+	}
+}
+
+// benchmarkTelemetry 生成 n 个 Agent 的遥测，每个 Agent 上报到 peers 个对端的链路
+func benchmarkTelemetry(n, peers int) []models.TelemetryRequest {
+	reqs := make([]models.TelemetryRequest, n)
+	for i := range reqs {
+		metrics := make([]models.Metric, peers)
+		for j := range metrics {
+			metrics[j] = models.Metric{TargetIP: fmt.Sprintf("10.254.%d.%d", j/250, j%250+1), RTTMs: ptrFloat64(float64(10 + j))}
+		}
+		reqs[i] = models.TelemetryRequest{AgentID: fmt.Sprintf("10.%d.%d.1", i/250, i%250), Metrics: metrics}
+	}
+	return reqs
+}
+
+// BenchmarkTopologyDBStoreParallel 数千个 Agent 并发上报
+func BenchmarkTopologyDBStoreParallel(b *testing.B) {
+	db := NewTopologyDB()
+	reqs := benchmarkTelemetry(5000, 8)
+	now := time.Now().Unix()
+
+	var next int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req := reqs[int(atomic.AddInt64(&next, 1))%len(reqs)]
+			req.Timestamp = now
+			db.Store(&req)
+		}
+	})
+}
+
+// BenchmarkTopologyDBStoreWithGetAll 并发上报的同时持续执行路由计算使用的 GetAll
+func BenchmarkTopologyDBStoreWithGetAll(b *testing.B) {
+	db := NewTopologyDB()
+	reqs := benchmarkTelemetry(5000, 8)
+	now := time.Now().Unix()
+	for i := range reqs {
+		reqs[i].Timestamp = now
+		db.Store(&reqs[i])
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = db.GetAll()
+			}
+		}
+	}()
+
+	var next int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req := reqs[int(atomic.AddInt64(&next, 1))%len(reqs)]
+			db.Store(&req)
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	<-done
+}
@@ -0,0 +1,157 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// yamlContentType 拓扑导出的 Content-Type
+const yamlContentType = "application/yaml; charset=utf-8"
+
+// TopologyExport 便于手工编辑的拓扑描述，用于搭建实验环境和记录预期的网状拓扑
+type TopologyExport struct {
+	TenantID    string       `yaml:"tenant_id,omitempty"`
+	GeneratedAt string       `yaml:"generated_at,omitempty"`
+	Nodes       []ExportNode `yaml:"nodes"`
+}
+
+// ExportNode 拓扑描述中的节点及其出向链路
+type ExportNode struct {
+	AgentID  string                `yaml:"agent_id"`
+	Metadata *models.AgentMetadata `yaml:"metadata,omitempty"`
+	Links    []ExportLink          `yaml:"links"`
+}
+
+// ExportLink 拓扑描述中的单条链路，rtt_ms 缺省表示不可达
+type ExportLink struct {
+	Target        string   `yaml:"target"`
+	RTTMs         *float64 `yaml:"rtt_ms,omitempty"`
+	LossRate      float64  `yaml:"loss_rate"`
+	JitterMs      float64  `yaml:"jitter_ms,omitempty"`
+	BandwidthMbps float64  `yaml:"bandwidth_mbps,omitempty"`
+}
+
+// exportTopology 导出租户当前的拓扑，节点按 agent_id、链路按 target 排序
+func exportTopology(t *tenant) *TopologyExport {
+	exp := &TopologyExport{
+		TenantID:    t.id,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Nodes:       []ExportNode{},
+	}
+	for _, req := range t.db.Snapshot() {
+		node := ExportNode{AgentID: req.AgentID, Metadata: req.Metadata, Links: make([]ExportLink, 0, len(req.Metrics))}
+		for _, m := range req.Metrics {
+			node.Links = append(node.Links, ExportLink{
+				Target:        m.TargetIP,
+				RTTMs:         m.RTTMs,
+				LossRate:      m.LossRate,
+				JitterMs:      m.JitterMs,
+				BandwidthMbps: m.BandwidthMbps,
+			})
+		}
+		exp.Nodes = append(exp.Nodes, node)
+	}
+	return exp
+}
+
+// telemetry 将节点转换为以 now 为时间戳的遥测请求
+func (n *ExportNode) telemetry(tenantID string, now int64) models.TelemetryRequest {
+	req := models.TelemetryRequest{
+		AgentID:   n.AgentID,
+		TenantID:  tenantID,
+		Timestamp: now,
+		Metadata:  n.Metadata,
+		Metrics:   make([]models.Metric, 0, len(n.Links)),
+	}
+	for _, l := range n.Links {
+		req.Metrics = append(req.Metrics, models.Metric{
+			TargetIP:      l.Target,
+			RTTMs:         l.RTTMs,
+			LossRate:      l.LossRate,
+			JitterMs:      l.JitterMs,
+			BandwidthMbps: l.BandwidthMbps,
+		})
+	}
+	return req
+}
+
+// ImportTopology 将拓扑描述写入对应租户，时间戳为当前时间，之后与普通遥测一样按过期策略清理
+// 先校验全部节点，任一节点无效时不写入任何数据；返回写入的节点数
+func (s *Server) ImportTopology(exp *TopologyExport) (int, error) {
+	if !models.ValidTenantID(exp.TenantID) {
+		return 0, models.ErrInvalidTenantID
+	}
+
+	now := time.Now().Unix()
+	reqs := make([]models.TelemetryRequest, 0, len(exp.Nodes))
+	seen := make(map[string]bool, len(exp.Nodes))
+	for i := range exp.Nodes {
+		req := exp.Nodes[i].telemetry(exp.TenantID, now)
+		if err := req.Validate(); err != nil {
+			return 0, fmt.Errorf("nodes[%d] (%s): %w", i, req.AgentID, err)
+		}
+		if seen[req.AgentID] {
+			return 0, fmt.Errorf("nodes[%d]: duplicate agent_id %s", i, req.AgentID)
+		}
+		seen[req.AgentID] = true
+		reqs = append(reqs, req)
+	}
+
+	t, err := s.tenantFor(exp.TenantID)
+	if err != nil {
+		return 0, err
+	}
+	for i := range reqs {
+		t.db.StoreAs(&reqs[i], ActorImport)
+	}
+	s.refreshRoutes(t, ActorImport)
+
+	s.logger.Info("Topology imported",
+		logging.F("tenant_id", exp.TenantID),
+		logging.F("nodes", len(reqs)),
+	)
+	return len(reqs), nil
+}
+
+// ImportTopologyFile 从 YAML 文件导入拓扑，见 ImportTopology
+func (s *Server) ImportTopologyFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read topology file: %w", err)
+	}
+	// 文件通常是手工编辑的，拒绝未知字段以便发现拼写错误
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var exp TopologyExport
+	if err := dec.Decode(&exp); err != nil {
+		return 0, fmt.Errorf("failed to parse topology file: %w", err)
+	}
+	return s.ImportTopology(&exp)
+}
+
+// handleTopologyExport 以 YAML 导出租户当前的拓扑
+func (s *Server) handleTopologyExport(c *gin.Context) {
+	t, ok := s.resolveTenant(c)
+	if !ok {
+		return
+	}
+
+	out, err := yaml.Marshal(exportTopology(t))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Detail: fmt.Sprintf("Failed to encode topology: %v", err),
+		})
+		return
+	}
+	c.Data(http.StatusOK, yamlContentType, out)
+}
@@ -0,0 +1,90 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"sort"
+	"sync/atomic"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// topologyCapacityWarning Agent 数量达到上限的该比例时健康检查报告 degraded
+const topologyCapacityWarning = 0.9
+
+// SetLimits 设置拓扑数据库的容量上限，0 表示不限，新的遥测写入时生效
+//
+// Agent 数量达到 maxAgents 时，新 Agent 写入前淘汰最久未上报的 Agent；
+// 单个 Agent 的链路超过 maxMetrics 时淘汰测量时间最早的链路。
+// 伪造大量 agent_id 或 target_ip 的遥测因此只会挤掉旧数据，不会让内存无限增长。
+func (db *TopologyDB) SetLimits(maxAgents, maxMetrics int) {
+	atomic.StoreInt64(&db.maxAgents, int64(maxAgents))
+	atomic.StoreInt64(&db.maxMetrics, int64(maxMetrics))
+}
+
+// Capacity 返回当前 Agent 数量和上限，上限为 0 表示不限
+func (db *TopologyDB) Capacity() (count, maxAgents int) {
+	return db.Count(), int(atomic.LoadInt64(&db.maxAgents))
+}
+
+// full Agent 数量是否已达到上限，新 Agent 写入前需要淘汰
+func (db *TopologyDB) full() bool {
+	count, maxAgents := db.Capacity()
+	return maxAgents > 0 && count >= maxAgents
+}
+
+// NearCapacity Agent 数量是否已达到上限的 topologyCapacityWarning
+func (db *TopologyDB) NearCapacity() bool {
+	count, maxAgents := db.Capacity()
+	return maxAgents > 0 && float64(count) >= topologyCapacityWarning*float64(maxAgents)
+}
+
+// Evictions 返回因容量上限被淘汰的 Agent 和链路数量
+func (db *TopologyDB) Evictions() (agents, metrics uint64) {
+	return atomic.LoadUint64(&db.evictedAgents), atomic.LoadUint64(&db.evictedMetrics)
+}
+
+// evictOldestAgentLocked 淘汰最久未上报的 Agent（时间相同时按 agent_id），调用方需持有全部分片的写锁
+func (db *TopologyDB) evictOldestAgentLocked() (DBEvent, bool) {
+	var oldestID string
+	var oldest *models.AgentData
+	var shard *topologyShard
+	for i := range db.shards {
+		for id, data := range db.shards[i].data {
+			if oldest == nil || data.Timestamp.Before(oldest.Timestamp) ||
+				(data.Timestamp.Equal(oldest.Timestamp) && id < oldestID) {
+				oldestID, oldest, shard = id, data, &db.shards[i]
+			}
+		}
+	}
+	if oldest == nil {
+		return DBEvent{}, false
+	}
+	delete(shard.data, oldestID)
+	atomic.AddInt64(&db.count, -1)
+	atomic.AddUint64(&db.evictedAgents, 1)
+	version := atomic.AddUint64(&db.version, 1)
+	return DBEvent{Type: DBEventRemoved, AgentID: oldestID, Actor: ActorCapacity, Previous: oldest, Version: version}, true
+}
+
+// trimMetricsLocked 链路数超过上限时淘汰测量时间最早的链路（时间相同时按 target_ip），调用方需持有分片写锁
+func (db *TopologyDB) trimMetricsLocked(metrics map[string]*models.MetricData) {
+	maxMetrics := int(atomic.LoadInt64(&db.maxMetrics))
+	if maxMetrics <= 0 || len(metrics) <= maxMetrics {
+		return
+	}
+	targets := make([]string, 0, len(metrics))
+	for target := range metrics {
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		a, b := metrics[targets[i]].UpdatedAt, metrics[targets[j]].UpdatedAt
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return targets[i] < targets[j]
+	})
+	for _, target := range targets[:len(targets)-maxMetrics] {
+		delete(metrics, target)
+		atomic.AddUint64(&db.evictedMetrics, 1)
+	}
+}
@@ -0,0 +1,116 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"sort"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// 拓扑数据库变更类型
+const (
+	DBEventStored  = "stored"  // Agent 首次写入
+	DBEventUpdated = "updated" // 已有 Agent 的数据被新遥测替换
+	DBEventRemoved = "removed" // 陈旧数据被清理
+)
+
+// 拓扑数据库变更来源，Agent 上报引起的变更以 agent_id 为来源
+const (
+	ActorCleaner     = "cleaner"     // 过期清理
+	ActorCapacity    = "capacity"    // 达到容量上限时淘汰
+	ActorImport      = "import"      // 导入拓扑描述
+	ActorRestore     = "restore"     // 启动时从状态文件恢复
+	ActorReplication = "replication" // 备节点从主节点复制
+	ActorSharedSync  = "shared_sync" // 从共享存储同步
+)
+
+// DBEvent 拓扑数据库变更事件
+type DBEvent struct {
+	Type     string
+	AgentID  string
+	Actor    string            // 变更来源，见 Actor* 常量
+	Data     *models.AgentData // 变更后的数据，removed 时为 nil
+	Previous *models.AgentData // 变更前的数据，stored 时为 nil
+	Version  uint64            // 变更后的数据版本
+}
+
+// dbObserver 已注册的变更回调
+type dbObserver struct {
+	id uint64
+	fn func(DBEvent)
+}
+
+// Subscribe 注册变更回调，返回取消订阅的函数
+//
+// 回调在数据库写锁释放后同步调用，同一 Agent 的变更按顺序送达：回调中可以读取数据库，
+// 但不能写入数据库，也不应长时间阻塞，否则会拖慢遥测写入。
+func (db *TopologyDB) Subscribe(fn func(DBEvent)) (unsubscribe func()) {
+	db.observerMu.Lock()
+	defer db.observerMu.Unlock()
+
+	db.nextObserverID++
+	id := db.nextObserverID
+	db.observers = append(db.observers, dbObserver{id: id, fn: fn})
+
+	return func() {
+		db.observerMu.Lock()
+		defer db.observerMu.Unlock()
+		for i, o := range db.observers {
+			if o.id == id {
+				db.observers = append(db.observers[:i:i], db.observers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// unlockAndNotify 调用 unlock 释放写锁并把 events 依次通知给所有回调
+// 在释放写锁之前取得 notifyMu，保证同一 Agent 的事件按版本顺序送达
+func (db *TopologyDB) unlockAndNotify(events []DBEvent, unlock func()) {
+	if len(events) == 0 {
+		unlock()
+		return
+	}
+
+	db.notifyMu.Lock()
+	unlock()
+	defer db.notifyMu.Unlock()
+
+	db.observerMu.Lock()
+	observers := append([]dbObserver(nil), db.observers...)
+	db.observerMu.Unlock()
+
+	for _, event := range events {
+		for _, o := range observers {
+			o.fn(event)
+		}
+	}
+}
+
+// agentMetrics 将 Agent 的链路数据转换为遥测格式，按 target_ip 排序
+func agentMetrics(data *models.AgentData) []models.Metric {
+	metrics := make([]models.Metric, 0, len(data.Metrics))
+	for target, m := range data.Metrics {
+		metric := models.Metric{
+			TargetIP:      target,
+			RTTMs:         m.RTT,
+			LossRate:      m.Loss,
+			JitterMs:      m.Jitter,
+			BandwidthMbps: m.Bandwidth,
+			RTTP50Ms:      m.P50,
+			RTTP95Ms:      m.P95,
+			RTTP99Ms:      m.P99,
+
+			HandshakeAgeSec: m.HandshakeAgeSec,
+			HandshakeNever:  m.HandshakeNever,
+		}
+		if !m.UpdatedAt.IsZero() {
+			metric.MeasuredAt = m.UpdatedAt.Unix()
+		}
+		metrics = append(metrics, metric)
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].TargetIP < metrics[j].TargetIP
+	})
+	return metrics
+}
@@ -0,0 +1,89 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// ApplyRetention 按保留策略整理每条链路的 RTT 样本：删除早于 max_age 的样本，
+// 把早于 downsample_interval 的样本按区间合并为平均值，并截断到 SetHistorySize 设置的样本数。
+// 返回删除或合并掉的样本数。样本不参与路由计算，整理不改变数据版本，也不产生变更事件。
+func (db *TopologyDB) ApplyRetention(r config.RetentionConfig, now time.Time) int {
+	db.lockAll()
+	defer db.unlockAll()
+
+	maxPoints := int(atomic.LoadInt64(&db.history))
+	dropped := 0
+	for i := range db.shards {
+		s := &db.shards[i]
+		for agentID, data := range s.data {
+			var copied *models.AgentData
+			for target, m := range data.Metrics {
+				history, n := retainSamples(m.RTTHistory, r, maxPoints, now)
+				if n == 0 {
+					continue
+				}
+				// 存储的数据不可变，修改前先复制
+				if copied == nil {
+					copied = copyAgentData(data)
+				}
+				changed := *m
+				changed.RTTHistory = history
+				copied.Metrics[target] = &changed
+				dropped += n
+			}
+			if copied != nil {
+				s.data[agentID] = copied
+			}
+		}
+	}
+	return dropped
+}
+
+// retainSamples 对按时间排序的样本应用保留策略，返回新切片和减少的样本数，不修改 samples
+func retainSamples(samples []models.RTTSample, r config.RetentionConfig, maxPoints int, now time.Time) ([]models.RTTSample, int) {
+	result := samples
+	if r.MaxAge > 0 {
+		cutoff := now.Add(-r.MaxAge)
+		i := 0
+		for i < len(result) && result[i].At.Before(cutoff) {
+			i++
+		}
+		result = result[i:]
+	}
+	if r.DownsampleInterval > 0 {
+		result = downsample(result, r.DownsampleInterval, now)
+	}
+	if len(result) > maxPoints {
+		result = result[len(result)-maxPoints:]
+	}
+	if len(result) == len(samples) {
+		return samples, 0
+	}
+	return append([]models.RTTSample(nil), result...), len(samples) - len(result)
+}
+
+// downsample 把整个区间都早于 now-interval 的样本按 interval 对齐分桶，每桶合并为一个以区间起点为时间的平均值；
+// 只合并已经结束的区间，之后的整理不会再改变已合并的点
+func downsample(samples []models.RTTSample, interval time.Duration, now time.Time) []models.RTTSample {
+	cutoff := now.Add(-interval)
+	var result []models.RTTSample
+	for i := 0; i < len(samples); {
+		start := samples[i].At.Truncate(interval)
+		if start.Add(interval).After(cutoff) {
+			return append(result, samples[i:]...)
+		}
+		sum, j := 0.0, i
+		for j < len(samples) && samples[j].At.Truncate(interval).Equal(start) {
+			sum += samples[j].RTTMs
+			j++
+		}
+		result = append(result, models.RTTSample{At: start, RTTMs: sum / float64(j-i)})
+		i = j
+	}
+	return result
+}
@@ -0,0 +1,114 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// defaultTombstoneTTL 过期 Agent 的记录默认保留时间
+const defaultTombstoneTTL = 24 * time.Hour
+
+// Tombstone 因过期被清理的 Agent 的记录：拓扑数据已删除，只保留最后上报时间和机器信息
+type Tombstone struct {
+	AgentID   string
+	LastSeen  time.Time
+	RemovedAt time.Time
+	Metadata  *models.AgentMetadata
+}
+
+// SetTombstoneTTL 设置过期 Agent 记录的保留时间，0 表示不保留
+func (db *TopologyDB) SetTombstoneTTL(ttl time.Duration) {
+	db.tombMu.Lock()
+	defer db.tombMu.Unlock()
+	db.tombstoneTTL = ttl
+}
+
+// Tombstone 返回 Agent 的过期记录，Agent 仍在拓扑中或记录已超过保留时间时返回 false
+func (db *TopologyDB) Tombstone(agentID string) (Tombstone, bool) {
+	db.tombMu.Lock()
+	defer db.tombMu.Unlock()
+
+	t, ok := db.tombstones[agentID]
+	if !ok || time.Since(t.RemovedAt) > db.tombstoneTTL {
+		return Tombstone{}, false
+	}
+	return t, true
+}
+
+// Tombstones 返回保留时间内的全部过期记录，最近清理的在前
+func (db *TopologyDB) Tombstones() []Tombstone {
+	db.tombMu.Lock()
+	defer db.tombMu.Unlock()
+
+	now := time.Now()
+	result := make([]Tombstone, 0, len(db.tombstones))
+	for _, t := range db.tombstones {
+		if now.Sub(t.RemovedAt) <= db.tombstoneTTL {
+			result = append(result, t)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].RemovedAt.Equal(result[j].RemovedAt) {
+			return result[i].RemovedAt.After(result[j].RemovedAt)
+		}
+		return result[i].AgentID < result[j].AgentID
+	})
+	return result
+}
+
+// unbury 删除 Agent 的过期记录，Agent 重新上报时调用
+func (db *TopologyDB) unbury(agentID string) {
+	db.tombMu.Lock()
+	defer db.tombMu.Unlock()
+	delete(db.tombstones, agentID)
+}
+
+// buryLocked 为被清理的 Agent 记录过期信息，并移除超过保留时间或超出容量上限的旧记录，调用方需持有全部分片的写锁
+func (db *TopologyDB) buryLocked(removed []DBEvent, now time.Time) {
+	db.tombMu.Lock()
+	defer db.tombMu.Unlock()
+
+	if db.tombstoneTTL <= 0 {
+		db.tombstones = nil
+		return
+	}
+	if db.tombstones == nil {
+		db.tombstones = make(map[string]Tombstone)
+	}
+	for _, e := range removed {
+		db.tombstones[e.AgentID] = Tombstone{
+			AgentID:   e.AgentID,
+			LastSeen:  e.Previous.Timestamp,
+			RemovedAt: now,
+			Metadata:  e.Previous.Metadata,
+		}
+	}
+
+	for id, t := range db.tombstones {
+		if now.Sub(t.RemovedAt) > db.tombstoneTTL {
+			delete(db.tombstones, id)
+		}
+	}
+	// 记录数与 Agent 共用容量上限，超出时先移除最早的记录
+	maxAgents := int(atomic.LoadInt64(&db.maxAgents))
+	if maxAgents > 0 && len(db.tombstones) > maxAgents {
+		ids := make([]string, 0, len(db.tombstones))
+		for id := range db.tombstones {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			a, b := db.tombstones[ids[i]].RemovedAt, db.tombstones[ids[j]].RemovedAt
+			if !a.Equal(b) {
+				return a.Before(b)
+			}
+			return ids[i] < ids[j]
+		})
+		for _, id := range ids[:len(ids)-maxAgents] {
+			delete(db.tombstones, id)
+		}
+	}
+}
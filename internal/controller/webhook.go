@@ -0,0 +1,315 @@
+// Package controller 实现 SD-WAN Controller 功能
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/logging"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// Webhook 请求头
+const (
+	WebhookEventHeader     = "X-SDWAN-Event"
+	WebhookSignatureHeader = "X-SDWAN-Signature"
+)
+
+// webhookQueueSize 每个接收端的事件队列长度
+const webhookQueueSize = 256
+
+// webhookInitialBackoff 首次重试前的等待时间，之后每次翻倍
+const webhookInitialBackoff = time.Second
+
+// WebhookEvent 推送给 Webhook 接收端的事件
+type WebhookEvent struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	Timestamp string                 `json:"timestamp"`
+	TenantID  string                 `json:"tenant_id,omitempty"` // 为空表示默认租户
+	AgentID   string                 `json:"agent_id,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// webhookEndpoint 单个接收端及其投递队列
+type webhookEndpoint struct {
+	url    string
+	secret string
+	events map[string]bool // 为空表示订阅全部事件
+	queue  chan WebhookEvent
+}
+
+// wants 检查接收端是否订阅了该事件
+func (e *webhookEndpoint) wants(eventType string) bool {
+	return len(e.events) == 0 || e.events[eventType]
+}
+
+// WebhookNotifier 拓扑事件 Webhook 通知器
+// 每个接收端有独立的队列和投递协程，慢速接收端不会影响其他接收端
+// nil 值可安全使用，所有事件被丢弃
+type WebhookNotifier struct {
+	endpoints  []*webhookEndpoint
+	client     *http.Client
+	maxRetries int
+	backoff    time.Duration
+	logger     logging.Logger
+
+	seq    uint64
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+
+	// mu 保护 closed：Notify 持读锁入队，Close 持写锁关闭队列，关闭后的事件被丢弃
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewWebhookNotifier 根据配置创建通知器，未配置接收端时返回 nil
+func NewWebhookNotifier(cfg config.WebhookConfig, logger logging.Logger) *WebhookNotifier {
+	if len(cfg.Endpoints) == 0 {
+		return nil
+	}
+	if logger == nil {
+		logger = logging.NewNopLogger()
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	n := &WebhookNotifier{
+		client:     &http.Client{Timeout: timeout},
+		maxRetries: cfg.MaxRetries,
+		backoff:    webhookInitialBackoff,
+		logger:     logger,
+		stopCh:     make(chan struct{}),
+	}
+	for _, ep := range cfg.Endpoints {
+		endpoint := &webhookEndpoint{
+			url:    ep.URL,
+			secret: ep.Secret,
+			events: make(map[string]bool, len(ep.Events)),
+			queue:  make(chan WebhookEvent, webhookQueueSize),
+		}
+		for _, event := range ep.Events {
+			endpoint.events[event] = true
+		}
+		n.endpoints = append(n.endpoints, endpoint)
+
+		n.wg.Add(1)
+		go n.run(endpoint)
+	}
+	return n
+}
+
+// Notify 发送一条事件到所有订阅了该类型的接收端，不阻塞调用方
+func (n *WebhookNotifier) Notify(eventType, tenantID, agentID string, data map[string]interface{}) {
+	if n == nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	event := WebhookEvent{
+		ID:        fmt.Sprintf("%d-%d", now.UnixNano(), atomic.AddUint64(&n.seq, 1)),
+		Type:      eventType,
+		Timestamp: now.Format(time.RFC3339Nano),
+		TenantID:  tenantID,
+		AgentID:   agentID,
+		Data:      data,
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		n.logger.Debug("Webhook notifier closed, event dropped", logging.F("event", eventType))
+		return
+	}
+	for _, ep := range n.endpoints {
+		if !ep.wants(eventType) {
+			continue
+		}
+		select {
+		case ep.queue <- event:
+		default:
+			n.logger.Warn("Webhook queue full, event dropped",
+				logging.F("url", ep.url),
+				logging.F("event", eventType),
+			)
+		}
+	}
+}
+
+// Close 停止所有投递协程；队列中剩余事件各尝试投递一次
+func (n *WebhookNotifier) Close() {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.stopCh)
+		for _, ep := range n.endpoints {
+			close(ep.queue)
+		}
+	}
+	n.mu.Unlock()
+	n.wg.Wait()
+}
+
+// run 单个接收端的投递循环
+func (n *WebhookNotifier) run(ep *webhookEndpoint) {
+	defer n.wg.Done()
+	for event := range ep.queue {
+		n.deliver(ep, event)
+	}
+}
+
+// deliver 投递单条事件，失败时按指数退避重试
+func (n *WebhookNotifier) deliver(ep *webhookEndpoint, event WebhookEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		n.logger.Error("Failed to encode webhook event",
+			logging.F("event", event.Type),
+			logging.F("error", err.Error()),
+		)
+		return
+	}
+
+	backoff := n.backoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := n.send(ep, event.Type, body)
+		if err == nil {
+			return
+		}
+		if !retryable || attempt >= n.maxRetries {
+			n.logger.Error("Failed to deliver webhook event",
+				logging.F("url", ep.url),
+				logging.F("event", event.Type),
+				logging.F("attempts", attempt+1),
+				logging.F("error", err.Error()),
+			)
+			return
+		}
+
+		n.logger.Warn("Webhook delivery failed, retrying",
+			logging.F("url", ep.url),
+			logging.F("event", event.Type),
+			logging.F("attempt", attempt+1),
+			logging.F("error", err.Error()),
+		)
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-n.stopCh:
+			return
+		}
+	}
+}
+
+// send 发送一次请求，返回失败是否值得重试
+func (n *WebhookNotifier) send(ep *webhookEndpoint, eventType string, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), n.client.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, eventType)
+	if ep.secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(ep.secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	// 4xx 表示请求本身被拒绝，重试无意义（429 除外）
+	retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retryable, err
+}
+
+// SignWebhookPayload 计算请求体的 HMAC-SHA256 签名，格式为 "sha256=<hex>"
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// linkDegraded 判断链路是否处于 Webhook 配置定义的劣化状态
+func linkDegraded(cfg config.WebhookConfig, m *models.MetricData) bool {
+	return metricDegraded(m, cfg.DegradedLossRate, cfg.DegradedRTTMs)
+}
+
+// metricDegraded 判断链路是否劣化：不可达，或丢包率 / RTT 达到阈值（阈值为 0 表示不检查）
+func metricDegraded(m *models.MetricData, lossRate, rttMs float64) bool {
+	if m.RTT == nil {
+		return true
+	}
+	if lossRate > 0 && m.Loss >= lossRate {
+		return true
+	}
+	return rttMs > 0 && *m.RTT >= rttMs
+}
+
+// notifyTelemetryEvents 根据新旧遥测数据发出 agent.joined 和 link.degraded 事件
+// prev 为存储前的数据，Agent 首次上报时为 nil
+func (s *Server) notifyTelemetryEvents(req *models.TelemetryRequest, prev *models.AgentData) {
+	if s.webhooks == nil {
+		return
+	}
+
+	if prev == nil {
+		s.webhooks.Notify(config.WebhookEventAgentJoined, req.TenantID, req.AgentID, map[string]interface{}{
+			"metric_count": len(req.Metrics),
+		})
+	}
+
+	for _, m := range req.Metrics {
+		current := &models.MetricData{RTT: m.RTTMs, Loss: m.LossRate}
+		if !linkDegraded(s.cfg.Webhook, current) {
+			continue
+		}
+		// 只在从正常变为劣化时通知，避免每次上报重复告警
+		if prev != nil {
+			if old, ok := prev.Metrics[m.TargetIP]; ok && linkDegraded(s.cfg.Webhook, old) {
+				continue
+			}
+		}
+		s.webhooks.Notify(config.WebhookEventLinkDegraded, req.TenantID, req.AgentID, map[string]interface{}{
+			"target":    m.TargetIP,
+			"rtt_ms":    m.RTTMs,
+			"loss_rate": m.LossRate,
+		})
+	}
+}
+
+// notifyRouteChanges 为下发的每条路由变化发出 route.changed 事件
+func (s *Server) notifyRouteChanges(tenantID, agentID string, routes []models.RouteConfig) {
+	if s.webhooks == nil {
+		return
+	}
+	for _, route := range routes {
+		s.webhooks.Notify(config.WebhookEventRouteChanged, tenantID, agentID, map[string]interface{}{
+			"dst_cidr": route.DstCIDR,
+			"next_hop": route.NextHop,
+			"reason":   route.Reason,
+		})
+	}
+}
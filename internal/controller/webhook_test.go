@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/config"
+	"github.com/holygeek00/lite-sdwan/pkg/models"
+)
+
+// webhookRecorder 记录收到的 Webhook 请求
+type webhookRecorder struct {
+	mu        sync.Mutex
+	events    []WebhookEvent
+	failFirst int // 前 N 次请求返回 500
+	calls     int
+	signature string
+	body      []byte
+}
+
+func (r *webhookRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls++
+	if r.calls <= r.failFirst {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body, _ := io.ReadAll(req.Body)
+	var event WebhookEvent
+	_ = json.Unmarshal(body, &event)
+	r.events = append(r.events, event)
+	r.signature = req.Header.Get(WebhookSignatureHeader)
+	r.body = body
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r *webhookRecorder) snapshot() (int, []WebhookEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls, append([]WebhookEvent(nil), r.events...)
+}
+
+// waitForCalls 等待接收端收到至少 want 次请求
+func (r *webhookRecorder) waitForCalls(t *testing.T, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if calls, _ := r.snapshot(); calls >= want {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	calls, _ := r.snapshot()
+	t.Fatalf("timed out waiting for %d webhook calls, got %d", want, calls)
+}
+
+func TestWebhookNotifierSignsAndRetries(t *testing.T) {
+	rec := &webhookRecorder{failFirst: 2}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	n := NewWebhookNotifier(config.WebhookConfig{
+		Endpoints:  []config.WebhookEndpoint{{URL: srv.URL, Secret: "s3cret"}},
+		Timeout:    time.Second,
+		MaxRetries: 3,
+	}, nil)
+	n.backoff = time.Millisecond
+
+	n.Notify(config.WebhookEventAgentStale, "acme", "A", map[string]interface{}{"threshold": "60s"})
+	rec.waitForCalls(t, 3)
+	n.Close()
+
+	calls, events := rec.snapshot()
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3 (2 failures + 1 success)", calls)
+	}
+	if len(events) != 1 || events[0].Type != config.WebhookEventAgentStale || events[0].TenantID != "acme" || events[0].AgentID != "A" {
+		t.Fatalf("events = %+v", events)
+	}
+	if want := SignWebhookPayload("s3cret", rec.body); rec.signature != want {
+		t.Errorf("signature = %q, want %q", rec.signature, want)
+	}
+}
+
+func TestWebhookNotifierGivesUpAfterMaxRetries(t *testing.T) {
+	rec := &webhookRecorder{failFirst: 100}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	n := NewWebhookNotifier(config.WebhookConfig{
+		Endpoints:  []config.WebhookEndpoint{{URL: srv.URL}},
+		Timeout:    time.Second,
+		MaxRetries: 2,
+	}, nil)
+	n.backoff = time.Millisecond
+
+	n.Notify(config.WebhookEventRouteChanged, models.DefaultTenantID, "A", nil)
+	rec.waitForCalls(t, 3)
+	n.Close()
+
+	if calls, _ := rec.snapshot(); calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+}
+
+func TestWebhookNotifyAfterClose(t *testing.T) {
+	rec := &webhookRecorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	n := NewWebhookNotifier(config.WebhookConfig{
+		Endpoints: []config.WebhookEndpoint{{URL: srv.URL}},
+		Timeout:   time.Second,
+	}, nil)
+	n.Close()
+
+	// 关闭期间仍在处理的请求继续通知：丢弃事件，不能 panic
+	n.Notify(config.WebhookEventRouteChanged, models.DefaultTenantID, "A", nil)
+	n.Close()
+
+	if calls, _ := rec.snapshot(); calls != 0 {
+		t.Errorf("calls = %d after Close, want 0", calls)
+	}
+}
+
+func TestWebhookTelemetryEvents(t *testing.T) {
+	rec := &webhookRecorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	s := newTestServer(t)
+	s.cfg.Webhook = config.WebhookConfig{
+		Endpoints: []config.WebhookEndpoint{{
+			URL:    srv.URL,
+			Events: []string{config.WebhookEventAgentJoined, config.WebhookEventLinkDegraded},
+		}},
+		Timeout:          time.Second,
+		DegradedLossRate: 0.1,
+	}
+	s.webhooks = NewWebhookNotifier(s.cfg.Webhook, nil)
+
+	now := time.Now().Unix()
+	send := func(loss float64) {
+		req := &models.TelemetryRequest{
+			AgentID:   "A",
+			Timestamp: now,
+			Metrics:   []models.Metric{{TargetIP: "B", RTTMs: ptrFloat64(10), LossRate: loss}},
+		}
+		prev, _ := s.db.Get(req.AgentID)
+		s.db.Store(req)
+		s.notifyTelemetryEvents(req, prev)
+	}
+
+	send(0)   // agent.joined
+	send(0.5) // link.degraded
+	send(0.6) // 仍然劣化，不重复通知
+	// 未订阅
+	s.notifyRouteChanges(models.DefaultTenantID, "A", []models.RouteConfig{{DstCIDR: "B/32", NextHop: "direct"}})
+	s.webhooks.Close()
+
+	_, events := rec.snapshot()
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(events), events)
+	}
+	if events[0].Type != config.WebhookEventAgentJoined {
+		t.Errorf("events[0].Type = %s, want %s", events[0].Type, config.WebhookEventAgentJoined)
+	}
+	if events[1].Type != config.WebhookEventLinkDegraded || events[1].Data["target"] != "B" {
+		t.Errorf("events[1] = %+v, want link.degraded for B", events[1])
+	}
+}
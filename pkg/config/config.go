@@ -3,7 +3,10 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -12,63 +15,544 @@ import (
 // AgentConfig Agent 配置
 type AgentConfig struct {
 	AgentID    string           `yaml:"agent_id"`
+	TenantID   string           `yaml:"tenant_id"` // 为空表示默认租户
 	Controller ControllerClient `yaml:"controller"`
 	Probe      ProbeConfig      `yaml:"probe"`
 	Sync       SyncConfig       `yaml:"sync"`
 	Network    NetworkConfig    `yaml:"network"`
+	Health     AgentHealth      `yaml:"health"`
+	Traceroute TracerouteConfig `yaml:"traceroute"`
+	TWAMP      TWAMPConfig      `yaml:"twamp"`
+	Steering   SteeringConfig   `yaml:"steering"`
+	Shaping    ShapingConfig    `yaml:"shaping"`
+	RouteAudit RouteAuditConfig `yaml:"route_audit"`
 	Logging    LoggingConfig    `yaml:"logging"`
 }
 
+// TracerouteConfig 底层路径采集配置
+// 定期对每个对等节点的 WireGuard 端点执行 traceroute 并上报 Controller，便于把链路劣化对应到具体的运营商节点
+type TracerouteConfig struct {
+	Interval time.Duration `yaml:"interval"` // 采集周期，0 表示不采集
+	MaxHops  int           `yaml:"max_hops"`
+	Timeout  time.Duration `yaml:"timeout"` // 每跳的等待时间
+}
+
+// TWAMPConfig TWAMP-light 反射方配置
+// 对端以 twamp 方式探测本机，或需要与支持 TWAMP 的第三方路由器互测时启动反射方
+type TWAMPConfig struct {
+	ReflectorPort int `yaml:"reflector_port"` // 反射方监听的 UDP 端口，0 表示不启动
+}
+
+// SteeringConfig 按应用引导流量：防火墙给匹配端口、协议或 DSCP 的流量打标记，
+// fwmark ip rule 把标记的流量引向流量类别路由表（network.class_tables），而不是只按目的地选路
+type SteeringConfig struct {
+	Backend      string         `yaml:"backend"`       // 打标记的方式，见 Steering* 常量
+	RulePriority int            `yaml:"rule_priority"` // fwmark ip rule 的优先级，需小于 network.rule_priority 才能先于按目的地的规则匹配
+	Rules        []SteeringRule `yaml:"rules"`         // 为空表示不引导
+}
+
+// SteeringRule 一条流量引导规则，各条件同时满足才匹配；标记值为类别的路由表编号
+type SteeringRule struct {
+	Class    string   `yaml:"class"`    // 流量类别，必须在 network.class_tables 中配置
+	Protocol string   `yaml:"protocol"` // tcp 或 udp，为空表示不限；指定 ports 时必须设置
+	Ports    []string `yaml:"ports"`    // 目的端口或端口范围，例如 "5060"、"10000-20000"
+	DSCP     int      `yaml:"dscp"`     // 0-63，0 表示不按 DSCP 匹配
+}
+
+// 流量引导打标记的方式
+const (
+	SteeringNftables = "nftables" // nft 命令，规则放在 inet lite_sdwan 表中
+	SteeringIPTables = "iptables" // iptables/ip6tables 的 mangle 表，规则放在 LITE_SDWAN 链中
+)
+
+// ShapingConfig 出口整形配置，限速和优先级来自 Controller 上本 Agent 的路由策略（shaping 字段）
+type ShapingConfig struct {
+	LinkRateMbps float64 `yaml:"link_rate_mbps"` // WireGuard 接口可用的上行带宽，作为 tc 根类别的速率
+}
+
+// RouteAuditConfig 路由变更审计配置，记录由健康检查服务的 /debug/route-changes 查询
+type RouteAuditConfig struct {
+	Size int    `yaml:"size"` // 内存中保留的最近变更条数
+	File string `yaml:"file"` // 同时追加写入的 JSON Lines 文件，重启后从中恢复；为空时只保存在内存中
+}
+
+// ParsePortRange 解析端口（"5060"）或端口范围（"10000-20000"）
+func ParsePortRange(s string) (lo, hi int, err error) {
+	first, last, isRange := strings.Cut(s, "-")
+	if lo, err = strconv.Atoi(strings.TrimSpace(first)); err != nil || !ValidatePort(lo) {
+		return 0, 0, fmt.Errorf("invalid port %q", s)
+	}
+	hi = lo
+	if isRange {
+		if hi, err = strconv.Atoi(strings.TrimSpace(last)); err != nil || !ValidatePort(hi) || hi < lo {
+			return 0, 0, fmt.Errorf("invalid port range %q", s)
+		}
+	}
+	return lo, hi, nil
+}
+
+// AgentHealth Agent 健康检查服务配置，http 探测访问的就是对端的这个服务
+type AgentHealth struct {
+	Port    int    `yaml:"port"`     // 监听端口，0 表示不启动
+	TLSCert string `yaml:"tls_cert"` // 证书文件，与 tls_key 同时设置时以 HTTPS 提供服务
+	TLSKey  string `yaml:"tls_key"`
+}
+
 // ControllerClient Controller 客户端配置
 type ControllerClient struct {
-	URL     string        `yaml:"url"`
-	Timeout time.Duration `yaml:"timeout"`
+	URL      string        `yaml:"url"`
+	Timeout  time.Duration `yaml:"timeout"`
+	Gzip     bool          `yaml:"gzip"`     // 使用 gzip 压缩遥测数据
+	Encoding string        `yaml:"encoding"` // "json"（API v1）或 "protobuf"（API v2）
 }
 
+// Controller API 编码
+const (
+	EncodingJSON     = "json"
+	EncodingProtobuf = "protobuf"
+)
+
 // ProbeConfig 探测配置
 type ProbeConfig struct {
 	Interval   time.Duration `yaml:"interval"`
 	Timeout    time.Duration `yaml:"timeout"`
 	WindowSize int           `yaml:"window_size"`
+	// MinInterval/MaxInterval 自适应探测周期的上下限，默认都等于 interval（不自适应）
+	MinInterval time.Duration `yaml:"min_interval"`
+	MaxInterval time.Duration `yaml:"max_interval"`
+	// Type 探测方式，站点之间完全屏蔽 ICMP 时使用 tcp
+	Type     string `yaml:"type"`
+	TCPPort  int    `yaml:"tcp_port"`  // tcp 探测连接的对端端口
+	HTTPPort int    `yaml:"http_port"` // http 探测访问的对端健康检查端口，默认与本机 health.port 相同
+	HTTPS    bool   `yaml:"https"`     // http 探测使用 HTTPS
+	// TWAMPPort twamp 探测发往的对端 TWAMP-light 反射端口
+	TWAMPPort int `yaml:"twamp_port"`
+	// ICMPMode icmp 探测使用原始套接字、无特权的 UDP ICMP 套接字还是系统 API，见 ICMPMode* 常量
+	ICMPMode string `yaml:"icmp_mode"`
+	// Count 每轮对每个对端发送的探测包数，丢包率按本轮实际丢失的比例计算
+	Count          int           `yaml:"count"`
+	PacketInterval time.Duration `yaml:"packet_interval"` // 同一轮内相邻探测包的间隔
+	// Smoothing 上报的 RTT、丢包率在滑动窗口内的平滑方式，见 Smoothing* 常量
+	Smoothing string  `yaml:"smoothing"`
+	EWMAAlpha float64 `yaml:"ewma_alpha"` // ewma 中最新样本的权重，(0, 1]
+	// Jitter 每个探测节拍额外等待 [0, jitter) 的随机时间，避免大量 Agent 同步探测
+	Jitter time.Duration `yaml:"jitter"`
+	// MaxPacketsPerSec/MaxBytesPerSec 所有对端合计的探测流量上限（按估算值，两个方向合计），
+	// 超出时自动拉长探测周期，0 表示不限
+	MaxPacketsPerSec float64 `yaml:"max_packets_per_sec"`
+	MaxBytesPerSec   float64 `yaml:"max_bytes_per_sec"`
+	// SourceIP/Interface 探测包使用的源地址，或使用该网卡上的地址，二者最多设置一个；
+	// 用于让探测经过 WireGuard 隧道或多出口主机上指定的 WAN 出口，而不是默认路由
+	SourceIP  string `yaml:"source_ip"`
+	Interface string `yaml:"interface"`
+	// DownAfter 对端连续失败该轮数后立即上报为不可达，不等窗口平均的丢包率慢慢上升，0 表示不启用
+	DownAfter int `yaml:"down_after"`
 }
 
+// 链路探测方式
+const (
+	ProbeTypeICMP  = "icmp"  // ICMP Echo
+	ProbeTypeTCP   = "tcp"   // TCP 连接建立耗时
+	ProbeTypeHTTP  = "http"  // 对端健康检查服务的首字节时间
+	ProbeTypeTWAMP = "twamp" // TWAMP-light 测试包往返时间，扣除反射方处理时间
+)
+
+// 滑动窗口平滑方式
+const (
+	SmoothingSMA  = "sma"  // 简单移动平均，窗口内样本权重相同
+	SmoothingEWMA = "ewma" // 指数加权移动平均，最近的样本权重更大
+)
+
+// ICMP 探测套接字模式
+const (
+	ICMPModeAuto         = "auto"         // 启动时检测，Windows 上使用系统 API，其他平台优先使用原始套接字
+	ICMPModePrivileged   = "privileged"   // 原始套接字，需要 root 或 CAP_NET_RAW
+	ICMPModeUnprivileged = "unprivileged" // UDP ICMP 套接字，需要 net.ipv4.ping_group_range 包含运行用户的组
+	ICMPModeSystem       = "system"       // 系统的 ICMP Echo API（IcmpSendEcho，与 ping.exe 相同），不需要管理员权限，仅 Windows
+)
+
 // SyncConfig 同步配置
 type SyncConfig struct {
 	Interval      time.Duration `yaml:"interval"`
 	RetryAttempts int           `yaml:"retry_attempts"`
 	RetryBackoff  []int         `yaml:"retry_backoff"` // 秒
+	Mode          string        `yaml:"mode"`          // "poll" 或 "stream"
 }
 
+// 路由同步模式
+const (
+	SyncModePoll   = "poll"
+	SyncModeStream = "stream"
+)
+
 // NetworkConfig 网络配置
 type NetworkConfig struct {
-	WGInterface string   `yaml:"wg_interface"`
-	Subnet      string   `yaml:"subnet"`
-	PeerIPs     []string `yaml:"peer_ips"`
+	WGInterface string       `yaml:"wg_interface"`
+	Subnet      string       `yaml:"subnet"`
+	Subnet6     string       `yaml:"subnet6"` // 双栈部署时的 IPv6 隧道子网，subnet 为 IPv4 子网，为空表示单栈
+	PeerIPs     []PeerConfig `yaml:"peer_ips"`
+	Endpoint    string       `yaml:"endpoint"` // 本机 WireGuard 的公网 host:port，随遥测上报，为空表示不上报
+
+	// RoutedPrefixes 隧道子网之外允许 Controller 下发路由的目的地前缀，例如各 Agent 后方的分支子网
+	RoutedPrefixes []string `yaml:"routed_prefixes"`
+
+	// DiscoverPeers 定期从 Controller 拉取同租户其他 Agent 的隧道地址，与 peer_ips 合并后作为探测目标
+	DiscoverPeers bool          `yaml:"discover_peers"`
+	PeerRefresh   time.Duration `yaml:"peer_refresh"` // 拉取周期
+
+	// ReportHandshake 随遥测上报到各对等节点的 WireGuard 握手间隔，作为独立于探测的存活信号
+	ReportHandshake bool `yaml:"report_handshake"`
+	// HandshakeTimeout 握手间隔超过该值时即使探测成功也上报为不可达（探测可能绕过了已失效的隧道），0 表示只上报不判定
+	HandshakeTimeout time.Duration `yaml:"handshake_timeout"`
+
+	// 各对等节点链路的可用带宽 (Mbps)，随遥测上报供 Controller 计算容量惩罚，未配置表示未知
+	LinkBandwidth map[string]float64 `yaml:"link_bandwidth"`
+
+	// 允许安装的最大中继层数：本机只安装到第一个中继的路由，更深的路径依赖后续中继的路由逐跳转发
+	// 超过该层数的路由被拒绝并记录错误，0 表示不限
+	MaxRelayDepth int `yaml:"max_relay_depth"`
+
+	// 流量类别 -> 内核路由表编号，Controller 下发的类别路由安装到对应路由表，未配置的类别忽略
+	ClassTables map[string]int `yaml:"class_tables"`
+
+	// RouteBackend 安装路由的方式，见 RouteBackend* 常量
+	RouteBackend string `yaml:"route_backend"`
+
+	// RouteTable 中继路由安装到的内核路由表编号，0 表示主路由表
+	// 非 0 时 Agent 添加 "to <subnet> lookup <table>" 的 ip rule，表中没有的目的地回落到主路由表
+	RouteTable int `yaml:"route_table"`
+	// RulePriority 上述 ip rule 的优先级，数值越小越先匹配
+	RulePriority int `yaml:"rule_priority"`
+
+	// RouteMetric 中继路由的默认 metric，Controller 下发的路由指定 metric 时以其为准，0 表示由内核决定
+	// 同一目的地的静态路由或 DHCP 路由 metric 不同时不会被替换，内核选择 metric 较小的路由
+	RouteMetric uint32 `yaml:"route_metric"`
+
+	// RouteProtocol 安装路由时标记的协议号（ip route 的 proto），内核中带有该协议号的路由都视为由 Agent 安装
+	// 进程异常退出后重启时据此清理上次遗留的路由；默认 DefaultRouteProtocol，应避开 /etc/iproute2/rt_protos 中已命名的协议
+	RouteProtocol int `yaml:"route_protocol"`
+}
+
+// DefaultRouteProtocol network.route_protocol 的默认值，rt_protos 中未分配
+const DefaultRouteProtocol = 157
+
+// 路由安装方式
+const (
+	RouteBackendAuto     = "auto"     // Linux 优先使用 netlink、无法打开 netlink 套接字时使用 ip 命令，macOS 和 FreeBSD 使用 route 命令，Windows 使用 netsh
+	RouteBackendNetlink  = "netlink"  // 直接通过 rtnetlink 套接字操作内核路由表，仅 Linux
+	RouteBackendIPRoute2 = "iproute2" // 执行 ip route 命令，需要安装 iproute2
+	RouteBackendBSDRoute = "route"    // 执行 BSD 的 route 命令，仅 macOS 和 FreeBSD
+	RouteBackendNetsh    = "netsh"    // 执行 netsh interface ipv4|ipv6 route 命令，仅 Windows
+)
+
+// PeerConfig 对等节点及其探测参数，未设置的参数使用 probe 中的全局配置
+// 配置文件中可以直接写 IP 字符串，也可以写成对象，用于为卫星、LTE 等链路单独调整探测
+type PeerConfig struct {
+	IP       string        `yaml:"ip"`
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+	Type     string        `yaml:"type"`
+}
+
+// UnmarshalYAML 支持字符串和对象两种写法
+func (p *PeerConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&p.IP)
+	}
+	type plain PeerConfig
+	return value.Decode((*plain)(p))
+}
+
+// PeerAddrs 返回所有对等节点的 IP
+func (n *NetworkConfig) PeerAddrs() []string {
+	addrs := make([]string, 0, len(n.PeerIPs))
+	for _, peer := range n.PeerIPs {
+		addrs = append(addrs, peer.IP)
+	}
+	return addrs
 }
 
 // ControllerConfig Controller 配置
 type ControllerConfig struct {
-	Server    ServerConfig    `yaml:"server"`
-	Algorithm AlgorithmConfig `yaml:"algorithm"`
-	Topology  TopologyConfig  `yaml:"topology"`
-	Logging   LoggingConfig   `yaml:"logging"`
+	Server      ServerConfig      `yaml:"server"`
+	Algorithm   AlgorithmConfig   `yaml:"algorithm"`
+	Topology    TopologyConfig    `yaml:"topology"`
+	Admin       AdminConfig       `yaml:"admin"`
+	Tenants     TenantsConfig     `yaml:"tenants"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
+	Audit       AuditConfig       `yaml:"audit"`
+	Webhook     WebhookConfig     `yaml:"webhook"`
+	CORS        CORSConfig        `yaml:"cors"`
+	Replication ReplicationConfig `yaml:"replication"`
+	Storage     StorageConfig     `yaml:"storage"`
+	Logging     LoggingConfig     `yaml:"logging"`
+}
+
+// StorageConfig 拓扑数据和求解器状态的持久化配置
+// memory 后端只保存在内存中，重启后所有 Agent 需要重新上报；file、bolt、sqlite 后端定期把状态写入
+// JSON 文件、BoltDB 或 SQLite 数据库并在启动时恢复；redis 后端让多个 Controller 副本共享同一份拓扑数据
+type StorageConfig struct {
+	Backend       string        `yaml:"backend"`        // memory（默认）、file、bolt、sqlite 或 redis
+	Path          string        `yaml:"path"`           // file、bolt、sqlite 后端的状态文件或数据库文件路径
+	FlushInterval time.Duration `yaml:"flush_interval"` // 状态有变化时写入的间隔
+	Redis         RedisConfig   `yaml:"redis"`
+}
+
+// RedisConfig redis 后端配置
+type RedisConfig struct {
+	Address      string        `yaml:"address"` // host:port
+	Password     string        `yaml:"password"`
+	DB           int           `yaml:"db"`
+	KeyPrefix    string        `yaml:"key_prefix"`    // 所有键的前缀，多套网络共用一个 Redis 时区分
+	Timeout      time.Duration `yaml:"timeout"`       // 连接和单条命令的超时
+	SyncInterval time.Duration `yaml:"sync_interval"` // 从 Redis 拉取其他副本写入的遥测的间隔
+}
+
+// 持久化后端
+const (
+	StorageBackendMemory = "memory"
+	StorageBackendFile   = "file"
+	StorageBackendBolt   = "bolt"
+	StorageBackendSQLite = "sqlite"
+	StorageBackendRedis  = "redis"
+)
+
+// ReplicationConfig 主备复制配置
+// primary 通过快照接口导出拓扑和求解器状态，standby 定期拉取并合并
+type ReplicationConfig struct {
+	Role       string        `yaml:"role"`        // 为空表示不复制，或 primary / standby
+	PrimaryURL string        `yaml:"primary_url"` // standby 拉取快照的主节点地址
+	Token      string        `yaml:"token"`       // 快照接口的 Bearer Token
+	Interval   time.Duration `yaml:"interval"`    // standby 拉取间隔
+	Timeout    time.Duration `yaml:"timeout"`
+}
+
+// 复制角色
+const (
+	ReplicationRolePrimary = "primary"
+	ReplicationRoleStandby = "standby"
+)
+
+// CORSConfig 跨域访问配置，allowed_origins 为空时不启用 CORS
+type CORSConfig struct {
+	AllowedOrigins []string      `yaml:"allowed_origins"` // 允许的来源，"*" 表示任意来源
+	AllowedMethods []string      `yaml:"allowed_methods"`
+	AllowedHeaders []string      `yaml:"allowed_headers"`
+	MaxAge         time.Duration `yaml:"max_age"` // 预检结果缓存时间
+}
+
+// Enabled 检查是否启用 CORS
+func (c CORSConfig) Enabled() bool {
+	return len(c.AllowedOrigins) > 0
+}
+
+// WebhookConfig 拓扑事件 Webhook 通知配置
+type WebhookConfig struct {
+	Endpoints        []WebhookEndpoint `yaml:"endpoints"`
+	Timeout          time.Duration     `yaml:"timeout"`            // 单次投递超时
+	MaxRetries       int               `yaml:"max_retries"`        // 投递失败后的重试次数
+	DegradedLossRate float64           `yaml:"degraded_loss_rate"` // 丢包率达到该值视为链路劣化
+	DegradedRTTMs    float64           `yaml:"degraded_rtt_ms"`    // RTT 达到该值视为链路劣化，0 表示不按 RTT 判断
+}
+
+// WebhookEndpoint 单个 Webhook 接收端
+type WebhookEndpoint struct {
+	URL    string   `yaml:"url"`
+	Secret string   `yaml:"secret"` // HMAC-SHA256 签名密钥，为空时不签名
+	Events []string `yaml:"events"` // 订阅的事件类型，为空表示全部
+}
+
+// Webhook 事件类型
+const (
+	WebhookEventAgentJoined  = "agent.joined"
+	WebhookEventAgentStale   = "agent.stale"
+	WebhookEventLinkDegraded = "link.degraded"
+	WebhookEventRouteChanged = "route.changed"
+)
+
+// AuditConfig 审计日志配置，file 和 url 可同时设置
+type AuditConfig struct {
+	File    string        `yaml:"file"`    // 追加写入的 JSON Lines 文件
+	URL     string        `yaml:"url"`     // 接收审计事件的 HTTP 端点
+	Timeout time.Duration `yaml:"timeout"` // HTTP 发送超时
+}
+
+// RateLimitConfig 限流配置（令牌桶）
+// 未配置的字段使用默认值；per_ip_rps 或 per_agent_rps 显式设为 0 表示关闭对应维度的限流
+type RateLimitConfig struct {
+	Enabled       bool    `yaml:"enabled"`
+	PerIPRPS      float64 `yaml:"per_ip_rps"`
+	PerIPBurst    int     `yaml:"per_ip_burst"`
+	PerAgentRPS   float64 `yaml:"per_agent_rps"`
+	PerAgentBurst int     `yaml:"per_agent_burst"`
+}
+
+// AdminConfig 管理 API 配置
+type AdminConfig struct {
+	Token string `yaml:"token"` // Bearer Token，为空时禁用管理 API
+}
+
+// TenantsConfig 多租户配置
+type TenantsConfig struct {
+	// MaxTenants 默认租户以外的租户数量上限，达到上限后新租户的遥测被拒绝，0 表示只允许默认租户
+	MaxTenants int `yaml:"max_tenants"`
+	// Tokens tenant_id -> Bearer Token，持有者可以订阅该租户的拓扑事件流；默认租户使用 admin.token
+	Tokens map[string]string `yaml:"tokens"`
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	ListenAddress string `yaml:"listen_address"`
-	Port          int    `yaml:"port"`
+	ListenAddress string    `yaml:"listen_address"`
+	Port          int       `yaml:"port"`
+	MaxBodyBytes  int64     `yaml:"max_body_bytes"` // 请求体大小上限（解压后）
+	TLS           TLSConfig `yaml:"tls"`
+	// ShutdownDelay 收到 SIGINT/SIGTERM 后 /readyz 先返回 503，经过该时间再停止接受新连接，
+	// 让负载均衡器在连接被拒绝前摘除本实例；0 表示立即关闭
+	ShutdownDelay time.Duration `yaml:"shutdown_delay"`
+	// TrustedProxies 可信反向代理的地址或 CIDR，只有来自这些地址的请求才按 X-Forwarded-For 识别客户端 IP；
+	// 为空表示不信任任何代理，按 TCP 对端地址识别（用于按 IP 限流和审计日志）
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// TLSConfig TLS 配置，cert_file 和 key_file 同时设置时启用 HTTPS
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// Enabled 检查是否启用 TLS
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
 }
 
 // AlgorithmConfig 算法配置
 type AlgorithmConfig struct {
 	PenaltyFactor float64 `yaml:"penalty_factor"`
 	Hysteresis    float64 `yaml:"hysteresis"`
+	// 已下发路径成本超过下发时的 (1+DegradationThreshold) 倍或不可达时，不受迟滞限制立即重选
+	DegradationThreshold float64 `yaml:"degradation_threshold"`
+	JitterWeight         float64 `yaml:"jitter_weight"` // 抖动在链路成本中的权重：Cost = RTT + Loss×PenaltyFactor + Jitter×JitterWeight
+	ECMPMargin           float64 `yaml:"ecmp_margin"`   // 成本在最优路径 (1+ecmp_margin) 倍以内的下一跳一并下发，0 表示关闭
+	BackupPaths          int     `yaml:"backup_paths"`  // 每个目的地附带的无环备份下一跳数量，0 表示不计算
+	MaxHops              int     `yaml:"max_hops"`      // 路径最多经过的链路数（1 表示只允许直连），0 表示不限
+
+	// BlackholeUnreachable 目的地失去所有可用路径时下发 blackhole 而不是 direct，Agent 安装黑洞路由立即丢弃发往它的流量，
+	// 避免流量走已失效的直连路径、等到超时才失败；恢复可达后照常下发
+	BlackholeUnreachable bool `yaml:"blackhole_unreachable"`
+
+	// 双向测量结果的合并方式，见 LinkReconcileDirectional / LinkReconcileMax / LinkReconcileAverage
+	LinkReconciliation string `yaml:"link_reconciliation"`
+
+	// 链路连续测得 RTT 的遥测次数达到 MinSamples 后才参与路径计算，0 表示不限
+	MinSamples int `yaml:"min_samples"`
+
+	// 中继负载惩罚：每有一个其他 Agent 以某节点为下一跳，经该节点中继的成本增加 RelayLoadPenalty (ms)，0 表示关闭
+	RelayLoadPenalty float64 `yaml:"relay_load_penalty"`
+
+	// 链路可用性硬阈值：超过任一阈值的链路不参与路径计算，而不只是提高成本
+	SLA SLAConfig `yaml:"sla"`
+
+	// 各指标在链路成本中的相对权重，全部为 0 时使用 RTT + Loss×PenaltyFactor + Jitter×JitterWeight + 容量惩罚
+	Weights MetricWeights `yaml:"weights"`
+
+	// 容量惩罚：可用带宽低于 BandwidthReferenceMbps 的链路按比例增加成本，带宽为 0 时增加 BandwidthPenalty (ms)
+	BandwidthPenalty       float64 `yaml:"bandwidth_penalty"`
+	BandwidthReferenceMbps float64 `yaml:"bandwidth_reference_mbps"`
+
+	// 路由重算模式，见 RecomputeOnRequest / RecomputeOnTelemetry / RecomputeOnChange
+	RecomputeMode     string        `yaml:"recompute_mode"`
+	RecomputeLossRate float64       `yaml:"recompute_loss_rate"` // on_telemetry 模式下触发重算的丢包率阈值
+	RecomputeRTTMs    float64       `yaml:"recompute_rtt_ms"`    // on_telemetry 模式下触发重算的 RTT 阈值，0 表示不按 RTT 触发
+	RouteCacheTTL     time.Duration `yaml:"route_cache_ttl"`     // on_telemetry 模式下缓存路由的最长有效期
+
+	// 流量类别：每个类别使用独立的链路成本权重计算一套完整路由表，随路由查询一并返回
+	TrafficClasses []TrafficClassConfig `yaml:"traffic_classes"`
+}
+
+// SLAConfig 链路可用性硬阈值，0 表示不检查该项
+type SLAConfig struct {
+	MaxLossRate float64 `yaml:"max_loss_rate"` // 丢包率超过该值的链路不可用，例如 0.2
+	MaxRTTMs    float64 `yaml:"max_rtt_ms"`    // RTT 超过该值的链路不可用，例如 500
+	MaxJitterMs float64 `yaml:"max_jitter_ms"` // 抖动超过该值的链路不可用
+}
+
+// MetricWeights 链路成本中各指标的相对权重，按总和归一化后对各项加权平均：
+// RTT (ms)、Loss×PenaltyFactor、Jitter (ms)、容量惩罚 (ms)
+type MetricWeights struct {
+	RTT       float64 `yaml:"rtt"`
+	Loss      float64 `yaml:"loss"`
+	Jitter    float64 `yaml:"jitter"`
+	Bandwidth float64 `yaml:"bandwidth"`
+}
+
+// Enabled 是否配置了权重
+func (w MetricWeights) Enabled() bool {
+	return w.RTT+w.Loss+w.Jitter+w.Bandwidth > 0
+}
+
+// Normalized 返回总和为 1 的权重，未配置时原样返回
+func (w MetricWeights) Normalized() MetricWeights {
+	sum := w.RTT + w.Loss + w.Jitter + w.Bandwidth
+	if sum <= 0 {
+		return w
+	}
+	return MetricWeights{RTT: w.RTT / sum, Loss: w.Loss / sum, Jitter: w.Jitter / sum, Bandwidth: w.Bandwidth / sum}
+}
+
+// TrafficClassConfig 流量类别的链路成本权重，带宽参考值沿用 algorithm.bandwidth_reference_mbps
+// 例如 realtime 提高丢包和抖动权重，bulk 提高容量惩罚
+type TrafficClassConfig struct {
+	Name             string  `yaml:"name"`
+	PenaltyFactor    float64 `yaml:"penalty_factor"`
+	JitterWeight     float64 `yaml:"jitter_weight"`
+	BandwidthPenalty float64 `yaml:"bandwidth_penalty"`
 }
 
+// 路由重算模式
+const (
+	// LinkReconcileDirectional 只使用本方向的测量（默认）
+	LinkReconcileDirectional = "directional"
+	// LinkReconcileMax 取两个方向中较差的成本
+	LinkReconcileMax = "max"
+	// LinkReconcileAverage 取两个方向成本的平均值
+	LinkReconcileAverage = "average"
+
+	// RecomputeOnRequest 每次查询路由时计算（默认）
+	RecomputeOnRequest = "on_request"
+	// RecomputeOnTelemetry 遥测数据越过劣化阈值时重算并缓存，查询直接返回缓存
+	RecomputeOnTelemetry = "on_telemetry"
+	// RecomputeOnChange 拓扑数据变化后的第一次查询为所有 Agent 统一重算并缓存，其余查询直接返回缓存
+	RecomputeOnChange = "on_change"
+)
+
 // TopologyConfig 拓扑配置
 type TopologyConfig struct {
-	StaleThreshold time.Duration `yaml:"stale_threshold"`
+	StaleThreshold time.Duration `yaml:"stale_threshold"` // 未声明上报间隔的 Agent 超过该时间未上报即过期
+	// CleanerInterval 清理器的运行间隔，决定过期数据最晚多久被删除
+	CleanerInterval time.Duration `yaml:"cleaner_interval"`
+	// 声明了上报间隔的 Agent 连续 IntervalMultiplier 个间隔未上报后过期，取代全局 stale_threshold
+	IntervalMultiplier float64 `yaml:"interval_multiplier"`
+	// HistorySize 兼容旧配置：未设置 retention.max_points 时作为每条链路保留的 RTT 样本数
+	HistorySize int `yaml:"history_size"`
+	// 每个租户的容量上限，超过时淘汰最久未上报的 Agent / 测量时间最早的链路，0 表示不限
+	MaxAgents          int `yaml:"max_agents"`
+	MaxMetricsPerAgent int `yaml:"max_metrics_per_agent"`
+	// TombstoneTTL 过期被清理的 Agent 保留记录（最后上报时间、机器信息）的时间
+	TombstoneTTL time.Duration `yaml:"tombstone_ttl"`
+	// LinkStaleThreshold 单条链路超过该时间未测量即过期，路由计算跳过、清理器删除；0 表示使用所属 Agent 的过期阈值
+	LinkStaleThreshold time.Duration `yaml:"link_stale_threshold"`
+	// QuarantinePeriod 过期的 Agent 先隔离（仍在拓扑中、不再作为中继）该时间后才删除，0 表示过期即删除
+	QuarantinePeriod time.Duration `yaml:"quarantine_period"`
+	// Retention 历史数据（链路 RTT 样本、路由变化记录）的保留策略
+	Retention RetentionConfig `yaml:"retention"`
+}
+
+// RetentionConfig 历史数据保留策略，由清理器定期应用，0 表示不限制该项
+type RetentionConfig struct {
+	MaxAge    time.Duration `yaml:"max_age"`    // 早于该时间的 RTT 样本和路由变化记录被删除
+	MaxPoints int           `yaml:"max_points"` // 每条链路最多保留的 RTT 样本数，用于计算 min/max/p95
+	// DownsampleInterval 早于该时间的 RTT 样本按该间隔对齐分桶，每桶合并为一个平均值
+	DownsampleInterval time.Duration `yaml:"downsample_interval"`
 }
 
 // LoggingConfig 日志配置
@@ -99,6 +583,66 @@ func LoadAgentConfig(path string) (*AgentConfig, error) {
 	if cfg.Probe.WindowSize == 0 {
 		cfg.Probe.WindowSize = 10
 	}
+	if cfg.Probe.Type == "" {
+		cfg.Probe.Type = ProbeTypeICMP
+	}
+	if cfg.Probe.MinInterval == 0 {
+		cfg.Probe.MinInterval = cfg.Probe.Interval
+	}
+	if cfg.Probe.MaxInterval == 0 {
+		cfg.Probe.MaxInterval = cfg.Probe.Interval
+	}
+	if cfg.Probe.ICMPMode == "" {
+		cfg.Probe.ICMPMode = ICMPModeAuto
+	}
+	if cfg.Probe.Count == 0 {
+		cfg.Probe.Count = 1
+	}
+	if cfg.Probe.PacketInterval == 0 {
+		cfg.Probe.PacketInterval = 200 * time.Millisecond
+	}
+	if cfg.Probe.TWAMPPort == 0 {
+		cfg.Probe.TWAMPPort = 862
+	}
+	if cfg.Probe.Smoothing == "" {
+		cfg.Probe.Smoothing = SmoothingSMA
+	}
+	if cfg.Probe.EWMAAlpha == 0 {
+		cfg.Probe.EWMAAlpha = 0.3
+	}
+	if cfg.Probe.HTTPPort == 0 {
+		cfg.Probe.HTTPPort = cfg.Health.Port
+	}
+	if cfg.Network.PeerRefresh == 0 {
+		cfg.Network.PeerRefresh = time.Minute
+	}
+	if cfg.Network.RouteBackend == "" {
+		cfg.Network.RouteBackend = RouteBackendAuto
+	}
+	if cfg.Network.RulePriority == 0 {
+		cfg.Network.RulePriority = 1000
+	}
+	if cfg.Network.RouteProtocol == 0 {
+		cfg.Network.RouteProtocol = DefaultRouteProtocol
+	}
+	if cfg.Steering.Backend == "" {
+		cfg.Steering.Backend = SteeringNftables
+	}
+	if cfg.Steering.RulePriority == 0 {
+		cfg.Steering.RulePriority = 900
+	}
+	if cfg.Shaping.LinkRateMbps == 0 {
+		cfg.Shaping.LinkRateMbps = 1000
+	}
+	if cfg.RouteAudit.Size == 0 {
+		cfg.RouteAudit.Size = 1000
+	}
+	if cfg.Traceroute.MaxHops == 0 {
+		cfg.Traceroute.MaxHops = 20
+	}
+	if cfg.Traceroute.Timeout == 0 {
+		cfg.Traceroute.Timeout = time.Second
+	}
 	if cfg.Sync.Interval == 0 {
 		cfg.Sync.Interval = 10 * time.Second
 	}
@@ -108,6 +652,9 @@ func LoadAgentConfig(path string) (*AgentConfig, error) {
 	if len(cfg.Sync.RetryBackoff) == 0 {
 		cfg.Sync.RetryBackoff = []int{1, 2, 4}
 	}
+	if cfg.Sync.Mode == "" {
+		cfg.Sync.Mode = SyncModePoll
+	}
 	if cfg.Network.WGInterface == "" {
 		cfg.Network.WGInterface = "wg0"
 	}
@@ -117,8 +664,17 @@ func LoadAgentConfig(path string) (*AgentConfig, error) {
 	if cfg.Controller.Timeout == 0 {
 		cfg.Controller.Timeout = 5 * time.Second
 	}
+	if cfg.Controller.Encoding == "" {
+		cfg.Controller.Encoding = EncodingJSON
+	}
 	if cfg.Network.PeerIPs == nil {
-		cfg.Network.PeerIPs = []string{}
+		cfg.Network.PeerIPs = []PeerConfig{}
+	}
+	// IPv6 地址有多种写法，统一为规范形式，保证与 Controller 中的 agent_id 一致
+	for i := range cfg.Network.PeerIPs {
+		if ip := net.ParseIP(cfg.Network.PeerIPs[i].IP); ip != nil {
+			cfg.Network.PeerIPs[i].IP = ip.String()
+		}
 	}
 	if cfg.Logging.Level == "" {
 		cfg.Logging.Level = "INFO"
@@ -140,7 +696,16 @@ func LoadControllerConfig(path string) (*ControllerConfig, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var cfg ControllerConfig
+	// 限流参数和 max_tenants 的 0 有含义，默认值须在解析前填入，才能区分未配置和显式的 0
+	cfg := ControllerConfig{
+		RateLimit: RateLimitConfig{
+			PerIPRPS:      20,
+			PerIPBurst:    40,
+			PerAgentRPS:   2,
+			PerAgentBurst: 5,
+		},
+		Tenants: TenantsConfig{MaxTenants: 100},
+	}
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
@@ -152,15 +717,99 @@ func LoadControllerConfig(path string) (*ControllerConfig, error) {
 	if cfg.Server.Port == 0 {
 		cfg.Server.Port = 8000
 	}
+	if cfg.Server.MaxBodyBytes == 0 {
+		cfg.Server.MaxBodyBytes = 1 << 20
+	}
 	if cfg.Algorithm.PenaltyFactor == 0 {
 		cfg.Algorithm.PenaltyFactor = 100
 	}
 	if cfg.Algorithm.Hysteresis == 0 {
 		cfg.Algorithm.Hysteresis = 0.15
 	}
+	if cfg.Algorithm.DegradationThreshold == 0 {
+		cfg.Algorithm.DegradationThreshold = 0.5
+	}
+	if cfg.Algorithm.BandwidthReferenceMbps == 0 {
+		cfg.Algorithm.BandwidthReferenceMbps = 100
+	}
+	if cfg.Algorithm.LinkReconciliation == "" {
+		cfg.Algorithm.LinkReconciliation = LinkReconcileDirectional
+	}
+	if cfg.Algorithm.RecomputeMode == "" {
+		cfg.Algorithm.RecomputeMode = RecomputeOnRequest
+	}
+	if cfg.Algorithm.RecomputeLossRate == 0 {
+		cfg.Algorithm.RecomputeLossRate = 0.1
+	}
+	if cfg.Algorithm.RouteCacheTTL == 0 {
+		cfg.Algorithm.RouteCacheTTL = 30 * time.Second
+	}
 	if cfg.Topology.StaleThreshold == 0 {
 		cfg.Topology.StaleThreshold = 60 * time.Second
 	}
+	if cfg.Topology.CleanerInterval == 0 {
+		cfg.Topology.CleanerInterval = 60 * time.Second
+	}
+	if cfg.Topology.IntervalMultiplier == 0 {
+		cfg.Topology.IntervalMultiplier = 3
+	}
+	if cfg.Topology.HistorySize == 0 {
+		cfg.Topology.HistorySize = 60
+	}
+	if cfg.Topology.Retention.MaxPoints == 0 {
+		cfg.Topology.Retention.MaxPoints = cfg.Topology.HistorySize
+	}
+	if cfg.Topology.MaxAgents == 0 {
+		cfg.Topology.MaxAgents = 10000
+	}
+	if cfg.Topology.MaxMetricsPerAgent == 0 {
+		cfg.Topology.MaxMetricsPerAgent = 1000
+	}
+	if cfg.Topology.TombstoneTTL == 0 {
+		cfg.Topology.TombstoneTTL = 24 * time.Hour
+	}
+	if cfg.Audit.Timeout == 0 {
+		cfg.Audit.Timeout = 5 * time.Second
+	}
+	if cfg.Webhook.Timeout == 0 {
+		cfg.Webhook.Timeout = 5 * time.Second
+	}
+	if cfg.Webhook.MaxRetries == 0 {
+		cfg.Webhook.MaxRetries = 3
+	}
+	if cfg.Webhook.DegradedLossRate == 0 {
+		cfg.Webhook.DegradedLossRate = 0.1
+	}
+	if len(cfg.CORS.AllowedMethods) == 0 {
+		cfg.CORS.AllowedMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	}
+	if len(cfg.CORS.AllowedHeaders) == 0 {
+		cfg.CORS.AllowedHeaders = []string{"Content-Type", "Authorization"}
+	}
+	if cfg.CORS.MaxAge == 0 {
+		cfg.CORS.MaxAge = 10 * time.Minute
+	}
+	if cfg.Replication.Interval == 0 {
+		cfg.Replication.Interval = 5 * time.Second
+	}
+	if cfg.Replication.Timeout == 0 {
+		cfg.Replication.Timeout = 5 * time.Second
+	}
+	if cfg.Storage.Backend == "" {
+		cfg.Storage.Backend = StorageBackendMemory
+	}
+	if cfg.Storage.FlushInterval == 0 {
+		cfg.Storage.FlushInterval = 10 * time.Second
+	}
+	if cfg.Storage.Redis.KeyPrefix == "" {
+		cfg.Storage.Redis.KeyPrefix = "lite-sdwan:"
+	}
+	if cfg.Storage.Redis.Timeout == 0 {
+		cfg.Storage.Redis.Timeout = 2 * time.Second
+	}
+	if cfg.Storage.Redis.SyncInterval == 0 {
+		cfg.Storage.Redis.SyncInterval = 2 * time.Second
+	}
 	if cfg.Logging.Level == "" {
 		cfg.Logging.Level = "INFO"
 	}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig 将 YAML 写入临时文件并返回路径
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func TestLoadControllerConfigRateLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    RateLimitConfig
+		wantErr string
+	}{
+		{
+			name: "defaults when unset",
+			yaml: "rate_limit:\n  enabled: true\n",
+			want: RateLimitConfig{Enabled: true, PerIPRPS: 20, PerIPBurst: 40, PerAgentRPS: 2, PerAgentBurst: 5},
+		},
+		{
+			name: "explicit zero disables per-agent limit",
+			yaml: "rate_limit:\n  enabled: true\n  per_agent_rps: 0\n",
+			want: RateLimitConfig{Enabled: true, PerIPRPS: 20, PerIPBurst: 40, PerAgentRPS: 0, PerAgentBurst: 5},
+		},
+		{
+			name:    "zero burst with positive rate",
+			yaml:    "rate_limit:\n  enabled: true\n  per_ip_burst: 0\n",
+			wantErr: "rate_limit.per_ip_burst",
+		},
+		{
+			name:    "negative rate",
+			yaml:    "rate_limit:\n  per_agent_rps: -1\n",
+			wantErr: "rate_limit.per_agent_rps",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadControllerConfig(writeConfig(t, tt.yaml))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadControllerConfig() error = %v, want error mentioning %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadControllerConfig() error = %v", err)
+			}
+			if cfg.RateLimit != tt.want {
+				t.Errorf("RateLimit = %+v, want %+v", cfg.RateLimit, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadControllerConfigTenants(t *testing.T) {
+	tests := []struct {
+		name           string
+		yaml           string
+		wantMaxTenants int
+		wantErr        string
+	}{
+		{name: "default limit", yaml: "tenants: {}\n", wantMaxTenants: 100},
+		{name: "explicit zero allows only the default tenant", yaml: "tenants:\n  max_tenants: 0\n", wantMaxTenants: 0},
+		{name: "negative limit", yaml: "tenants:\n  max_tenants: -1\n", wantErr: "tenants.max_tenants"},
+		{name: "token for default tenant", yaml: "tenants:\n  tokens:\n    \"\": secret\n", wantErr: "tenants.tokens"},
+		{name: "empty token", yaml: "tenants:\n  tokens:\n    acme: \"\"\n", wantErr: "tenants.tokens.acme"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadControllerConfig(writeConfig(t, tt.yaml))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadControllerConfig() error = %v, want error mentioning %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadControllerConfig() error = %v", err)
+			}
+			if cfg.Tenants.MaxTenants != tt.wantMaxTenants {
+				t.Errorf("MaxTenants = %d, want %d", cfg.Tenants.MaxTenants, tt.wantMaxTenants)
+			}
+		})
+	}
+}
+
+func TestLoadControllerConfigCleanerInterval(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    time.Duration
+		wantErr string
+	}{
+		{name: "default", yaml: "topology: {}\n", want: 60 * time.Second},
+		{name: "explicit", yaml: "topology:\n  cleaner_interval: 5s\n", want: 5 * time.Second},
+		{name: "negative", yaml: "topology:\n  cleaner_interval: -1s\n", wantErr: "topology.cleaner_interval"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadControllerConfig(writeConfig(t, tt.yaml))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadControllerConfig() error = %v, want error mentioning %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadControllerConfig() error = %v", err)
+			}
+			if cfg.Topology.CleanerInterval != tt.want {
+				t.Errorf("CleanerInterval = %v, want %v", cfg.Topology.CleanerInterval, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadAgentConfigICMPMode(t *testing.T) {
+	const base = "agent_id: node-a\ncontroller:\n  url: http://controller:8000\nnetwork:\n  peer_ips:\n    - \"10.254.0.2\"\n"
+
+	tests := []struct {
+		name    string
+		probe   string
+		want    string
+		wantErr bool
+	}{
+		{"default", "", ICMPModeAuto, false},
+		{"privileged", "probe:\n  icmp_mode: privileged\n", ICMPModePrivileged, false},
+		{"unprivileged", "probe:\n  icmp_mode: unprivileged\n", ICMPModeUnprivileged, false},
+		{"system", "probe:\n  icmp_mode: system\n", ICMPModeSystem, false},
+		{"invalid", "probe:\n  icmp_mode: raw\n", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadAgentConfig(writeConfig(t, base+tt.probe))
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "probe.icmp_mode") {
+					t.Fatalf("LoadAgentConfig() error = %v, want probe.icmp_mode error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadAgentConfig() error = %v", err)
+			}
+			if cfg.Probe.ICMPMode != tt.want {
+				t.Errorf("ICMPMode = %q, want %q", cfg.Probe.ICMPMode, tt.want)
+			}
+		})
+	}
+}
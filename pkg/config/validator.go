@@ -5,9 +5,16 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	"os"
 	"strings"
+	"time"
+
+	"github.com/holygeek00/lite-sdwan/pkg/models"
 )
 
+// maxBackupPaths 每个目的地最多附带的备份下一跳数量
+const maxBackupPaths = 8
+
 // ValidationError 配置验证错误
 type ValidationError struct {
 	Field   string `json:"field"`
@@ -27,17 +34,12 @@ type ValidationResult struct {
 }
 
 // ValidateIPAddress 验证 IP 地址格式
-// 返回 true 如果字符串是有效的 IPv4 地址（四个 0-255 的八位组，用点分隔）
+// 返回 true 如果字符串是有效的 IPv4 或 IPv6 地址，双栈网络中两种地址的对等节点都可以探测
 func ValidateIPAddress(ip string) bool {
 	if ip == "" {
 		return false
 	}
-	parsed := net.ParseIP(ip)
-	if parsed == nil {
-		return false
-	}
-	// 确保是 IPv4 地址
-	return parsed.To4() != nil
+	return net.ParseIP(ip) != nil
 }
 
 // ValidateURL 验证 URL 格式
@@ -78,7 +80,7 @@ func ValidateSubnet(subnet string) bool {
 }
 
 // ValidateListenAddress 验证监听地址格式
-// 支持 IP 地址或 0.0.0.0 格式
+// 支持 IP 地址、0.0.0.0 或 ::
 func ValidateListenAddress(addr string) bool {
 	if addr == "" {
 		return false
@@ -126,6 +128,15 @@ func ValidateAgentConfig(cfg *AgentConfig) []ValidationError {
 		})
 	}
 
+	// 验证 tenant_id
+	if !models.ValidTenantID(cfg.TenantID) {
+		errors = append(errors, ValidationError{
+			Field:   "tenant_id",
+			Value:   cfg.TenantID,
+			Message: "may only contain letters, digits, '-' and '_' (max 64 characters)",
+		})
+	}
+
 	// 验证 controller.url
 	if cfg.Controller.URL == "" {
 		errors = append(errors, ValidationError{
@@ -141,25 +152,447 @@ func ValidateAgentConfig(cfg *AgentConfig) []ValidationError {
 		})
 	}
 
-	// 验证 network.peer_ips
-	if len(cfg.Network.PeerIPs) == 0 {
+	// 验证 network.peer_ips，从 Controller 拉取对等节点时可以为空
+	if len(cfg.Network.PeerIPs) == 0 && !cfg.Network.DiscoverPeers {
 		errors = append(errors, ValidationError{
 			Field:   "network.peer_ips",
 			Value:   "[]",
-			Message: "network.peer_ips cannot be empty, at least one peer IP is required",
+			Message: "network.peer_ips cannot be empty unless network.discover_peers is enabled",
 		})
 	} else {
-		for i, ip := range cfg.Network.PeerIPs {
-			if !ValidateIPAddress(ip) {
+		for i, peer := range cfg.Network.PeerIPs {
+			if !ValidateIPAddress(peer.IP) {
 				errors = append(errors, ValidationError{
 					Field:   fmt.Sprintf("network.peer_ips[%d]", i),
-					Value:   ip,
-					Message: "must be a valid IPv4 address (e.g., 10.254.0.1)",
+					Value:   peer.IP,
+					Message: "must be a valid IPv4 or IPv6 address (e.g., 10.254.0.1 or fd00:254::1)",
 				})
 			}
+			if peer.Interval < 0 {
+				errors = append(errors, ValidationError{
+					Field:   fmt.Sprintf("network.peer_ips[%d].interval", i),
+					Value:   peer.Interval.String(),
+					Message: "must be positive",
+				})
+			}
+			if peer.Timeout < 0 {
+				errors = append(errors, ValidationError{
+					Field:   fmt.Sprintf("network.peer_ips[%d].timeout", i),
+					Value:   peer.Timeout.String(),
+					Message: "must be positive",
+				})
+			}
+			if peer.Type != "" && !validProbeType(peer.Type) {
+				errors = append(errors, ValidationError{
+					Field:   fmt.Sprintf("network.peer_ips[%d].type", i),
+					Value:   peer.Type,
+					Message: "must be one of: icmp, tcp, http, twamp",
+				})
+			}
+		}
+	}
+
+	if cfg.Network.HandshakeTimeout < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "network.handshake_timeout",
+			Value:   cfg.Network.HandshakeTimeout.String(),
+			Message: "must be positive",
+		})
+	}
+	if cfg.Network.PeerRefresh < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "network.peer_refresh",
+			Value:   cfg.Network.PeerRefresh.String(),
+			Message: "must be positive",
+		})
+	}
+
+	// 验证 network.link_bandwidth
+	for ip, mbps := range cfg.Network.LinkBandwidth {
+		if mbps <= 0 {
+			errors = append(errors, ValidationError{
+				Field:   fmt.Sprintf("network.link_bandwidth[%s]", ip),
+				Value:   fmt.Sprintf("%f", mbps),
+				Message: "must be positive",
+			})
+		}
+	}
+
+	// 验证 network.max_relay_depth
+	if cfg.Network.MaxRelayDepth < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "network.max_relay_depth",
+			Value:   fmt.Sprintf("%d", cfg.Network.MaxRelayDepth),
+			Message: "must be non-negative (0 means unlimited)",
+		})
+	}
+
+	// 验证 network.routed_prefixes
+	for i, prefix := range cfg.Network.RoutedPrefixes {
+		if !ValidateSubnet(prefix) {
+			errors = append(errors, ValidationError{
+				Field:   fmt.Sprintf("network.routed_prefixes[%d]", i),
+				Value:   prefix,
+				Message: "must be a valid CIDR prefix (e.g., 10.20.0.0/24)",
+			})
+		}
+	}
+
+	// 验证 network.class_tables：main (254)、local (255)、default (253) 保留给系统
+	for class, table := range cfg.Network.ClassTables {
+		if table <= 0 || table >= 253 && table <= 255 {
+			errors = append(errors, ValidationError{
+				Field:   fmt.Sprintf("network.class_tables[%s]", class),
+				Value:   fmt.Sprintf("%d", table),
+				Message: "must be a positive table id other than 253, 254 and 255",
+			})
 		}
 	}
 
+	// 验证 network.route_table / network.rule_priority
+	if cfg.Network.RouteTable < 0 || cfg.Network.RouteTable >= 253 && cfg.Network.RouteTable <= 255 {
+		errors = append(errors, ValidationError{
+			Field:   "network.route_table",
+			Value:   fmt.Sprintf("%d", cfg.Network.RouteTable),
+			Message: "must be 0 (main table) or a positive table id other than 253, 254 and 255",
+		})
+	}
+	for class, table := range cfg.Network.ClassTables {
+		if cfg.Network.RouteTable != 0 && table == cfg.Network.RouteTable {
+			errors = append(errors, ValidationError{
+				Field:   "network.route_table",
+				Value:   fmt.Sprintf("%d", cfg.Network.RouteTable),
+				Message: fmt.Sprintf("must differ from network.class_tables[%s]", class),
+			})
+		}
+	}
+	// 0 为 local 表的规则，32766、32767 为 main、default 表的规则
+	if cfg.Network.RouteTable != 0 && (cfg.Network.RulePriority < 1 || cfg.Network.RulePriority > 32765) {
+		errors = append(errors, ValidationError{
+			Field:   "network.rule_priority",
+			Value:   fmt.Sprintf("%d", cfg.Network.RulePriority),
+			Message: "must be in range [1, 32765]",
+		})
+	}
+
+	// 验证 network.route_protocol：0-4 为内核保留（unspec、redirect、kernel、boot、static），不能区分 Agent 安装的路由
+	if cfg.Network.RouteProtocol != 0 && (cfg.Network.RouteProtocol < 5 || cfg.Network.RouteProtocol > 255) {
+		errors = append(errors, ValidationError{
+			Field:   "network.route_protocol",
+			Value:   fmt.Sprintf("%d", cfg.Network.RouteProtocol),
+			Message: "must be in range [5, 255]",
+		})
+	}
+
+	// 验证 network.route_backend
+	switch cfg.Network.RouteBackend {
+	case "", RouteBackendAuto, RouteBackendNetlink, RouteBackendIPRoute2, RouteBackendBSDRoute, RouteBackendNetsh:
+	default:
+		errors = append(errors, ValidationError{
+			Field:   "network.route_backend",
+			Value:   cfg.Network.RouteBackend,
+			Message: "must be one of: auto, netlink, iproute2, route, netsh",
+		})
+	}
+
+	// 验证 controller.encoding
+	if cfg.Controller.Encoding != "" && cfg.Controller.Encoding != EncodingJSON && cfg.Controller.Encoding != EncodingProtobuf {
+		errors = append(errors, ValidationError{
+			Field:   "controller.encoding",
+			Value:   cfg.Controller.Encoding,
+			Message: "must be one of: json, protobuf",
+		})
+	}
+
+	// 验证自适应探测周期
+	if cfg.Probe.MinInterval < 0 || cfg.Probe.MinInterval > cfg.Probe.Interval {
+		errors = append(errors, ValidationError{
+			Field:   "probe.min_interval",
+			Value:   cfg.Probe.MinInterval.String(),
+			Message: "must be positive and not greater than probe.interval",
+		})
+	}
+	if cfg.Probe.MaxInterval != 0 && cfg.Probe.MaxInterval < cfg.Probe.Interval {
+		errors = append(errors, ValidationError{
+			Field:   "probe.max_interval",
+			Value:   cfg.Probe.MaxInterval.String(),
+			Message: "must not be less than probe.interval",
+		})
+	}
+
+	// 验证 probe.count
+	if cfg.Probe.Count < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "probe.count",
+			Value:   fmt.Sprintf("%d", cfg.Probe.Count),
+			Message: "must be positive",
+		})
+	}
+	if cfg.Probe.PacketInterval < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "probe.packet_interval",
+			Value:   cfg.Probe.PacketInterval.String(),
+			Message: "must be positive",
+		})
+	}
+	shortest := cfg.Probe.Interval
+	if cfg.Probe.MinInterval > 0 {
+		shortest = cfg.Probe.MinInterval
+	}
+	if cfg.Probe.MaxPacketsPerSec < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "probe.max_packets_per_sec",
+			Value:   fmt.Sprintf("%g", cfg.Probe.MaxPacketsPerSec),
+			Message: "must not be negative",
+		})
+	}
+	if cfg.Probe.MaxBytesPerSec < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "probe.max_bytes_per_sec",
+			Value:   fmt.Sprintf("%g", cfg.Probe.MaxBytesPerSec),
+			Message: "must not be negative",
+		})
+	}
+	if cfg.Probe.DownAfter < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "probe.down_after",
+			Value:   fmt.Sprintf("%d", cfg.Probe.DownAfter),
+			Message: "must not be negative",
+		})
+	}
+	if cfg.Probe.Jitter < 0 || cfg.Probe.Jitter > shortest {
+		errors = append(errors, ValidationError{
+			Field:   "probe.jitter",
+			Value:   cfg.Probe.Jitter.String(),
+			Message: "must be between 0 and probe.min_interval",
+		})
+	}
+	if cfg.Probe.Count > 1 && time.Duration(cfg.Probe.Count-1)*cfg.Probe.PacketInterval+cfg.Probe.Timeout > shortest {
+		errors = append(errors, ValidationError{
+			Field:   "probe.count",
+			Value:   fmt.Sprintf("%d", cfg.Probe.Count),
+			Message: "(count-1)*packet_interval+timeout must not exceed probe.min_interval",
+		})
+	}
+
+	// 验证 probe.type，全局或任一对等节点使用 tcp/http 探测时需要对应端口
+	if cfg.Probe.Type != "" && !validProbeType(cfg.Probe.Type) {
+		errors = append(errors, ValidationError{
+			Field:   "probe.type",
+			Value:   cfg.Probe.Type,
+			Message: "must be one of: icmp, tcp, http, twamp",
+		})
+	}
+	usedTypes := map[string]bool{cfg.Probe.Type: true}
+	for _, peer := range cfg.Network.PeerIPs {
+		usedTypes[peer.Type] = true
+	}
+	if usedTypes[ProbeTypeTCP] && !ValidatePort(cfg.Probe.TCPPort) {
+		errors = append(errors, ValidationError{
+			Field:   "probe.tcp_port",
+			Value:   fmt.Sprintf("%d", cfg.Probe.TCPPort),
+			Message: "must be in range [1, 65535] when tcp probing is used",
+		})
+	}
+	if usedTypes[ProbeTypeHTTP] && !ValidatePort(cfg.Probe.HTTPPort) {
+		errors = append(errors, ValidationError{
+			Field:   "probe.http_port",
+			Value:   fmt.Sprintf("%d", cfg.Probe.HTTPPort),
+			Message: "must be in range [1, 65535] when http probing is used",
+		})
+	}
+	if usedTypes[ProbeTypeTWAMP] && !ValidatePort(cfg.Probe.TWAMPPort) {
+		errors = append(errors, ValidationError{
+			Field:   "probe.twamp_port",
+			Value:   fmt.Sprintf("%d", cfg.Probe.TWAMPPort),
+			Message: "must be in range [1, 65535] when twamp probing is used",
+		})
+	}
+	if cfg.TWAMP.ReflectorPort != 0 && !ValidatePort(cfg.TWAMP.ReflectorPort) {
+		errors = append(errors, ValidationError{
+			Field:   "twamp.reflector_port",
+			Value:   fmt.Sprintf("%d", cfg.TWAMP.ReflectorPort),
+			Message: "must be in range [1, 65535]",
+		})
+	}
+
+	// 验证 probe.source_ip / probe.interface
+	if cfg.Probe.SourceIP != "" && !ValidateIPAddress(cfg.Probe.SourceIP) {
+		errors = append(errors, ValidationError{
+			Field:   "probe.source_ip",
+			Value:   cfg.Probe.SourceIP,
+			Message: "must be a valid IP address",
+		})
+	}
+	if cfg.Probe.SourceIP != "" && cfg.Probe.Interface != "" {
+		errors = append(errors, ValidationError{
+			Field:   "probe.interface",
+			Value:   cfg.Probe.Interface,
+			Message: "cannot be set together with probe.source_ip",
+		})
+	}
+
+	// 验证 probe.icmp_mode
+	switch cfg.Probe.ICMPMode {
+	case "", ICMPModeAuto, ICMPModePrivileged, ICMPModeUnprivileged, ICMPModeSystem:
+	default:
+		errors = append(errors, ValidationError{
+			Field:   "probe.icmp_mode",
+			Value:   cfg.Probe.ICMPMode,
+			Message: "must be one of: auto, privileged, unprivileged, system",
+		})
+	}
+
+	// 验证 probe.smoothing
+	switch cfg.Probe.Smoothing {
+	case "", SmoothingSMA, SmoothingEWMA:
+	default:
+		errors = append(errors, ValidationError{
+			Field:   "probe.smoothing",
+			Value:   cfg.Probe.Smoothing,
+			Message: "must be one of: sma, ewma",
+		})
+	}
+	if cfg.Probe.EWMAAlpha < 0 || cfg.Probe.EWMAAlpha > 1 {
+		errors = append(errors, ValidationError{
+			Field:   "probe.ewma_alpha",
+			Value:   fmt.Sprintf("%g", cfg.Probe.EWMAAlpha),
+			Message: "must be in range (0, 1]",
+		})
+	}
+
+	// 验证 steering
+	switch cfg.Steering.Backend {
+	case "", SteeringNftables, SteeringIPTables:
+	default:
+		errors = append(errors, ValidationError{
+			Field:   "steering.backend",
+			Value:   cfg.Steering.Backend,
+			Message: "must be one of: nftables, iptables",
+		})
+	}
+	if len(cfg.Steering.Rules) > 0 && (cfg.Steering.RulePriority < 1 || cfg.Steering.RulePriority > 32765) {
+		errors = append(errors, ValidationError{
+			Field:   "steering.rule_priority",
+			Value:   fmt.Sprintf("%d", cfg.Steering.RulePriority),
+			Message: "must be in range [1, 32765]",
+		})
+	}
+	for i, rule := range cfg.Steering.Rules {
+		field := fmt.Sprintf("steering.rules[%d]", i)
+		if _, ok := cfg.Network.ClassTables[rule.Class]; !ok {
+			errors = append(errors, ValidationError{
+				Field:   field + ".class",
+				Value:   rule.Class,
+				Message: "must be a class configured in network.class_tables",
+			})
+		}
+		if rule.Protocol != "" && rule.Protocol != "tcp" && rule.Protocol != "udp" {
+			errors = append(errors, ValidationError{
+				Field:   field + ".protocol",
+				Value:   rule.Protocol,
+				Message: "must be one of: tcp, udp",
+			})
+		}
+		if len(rule.Ports) > 0 && rule.Protocol == "" {
+			errors = append(errors, ValidationError{
+				Field:   field + ".protocol",
+				Value:   rule.Protocol,
+				Message: "is required when ports are set",
+			})
+		}
+		for _, port := range rule.Ports {
+			if _, _, err := ParsePortRange(port); err != nil {
+				errors = append(errors, ValidationError{
+					Field:   field + ".ports",
+					Value:   port,
+					Message: "must be a port or a range like 10000-20000",
+				})
+			}
+		}
+		if rule.DSCP < 0 || rule.DSCP > 63 {
+			errors = append(errors, ValidationError{
+				Field:   field + ".dscp",
+				Value:   fmt.Sprintf("%d", rule.DSCP),
+				Message: "must be in range [0, 63]",
+			})
+		}
+		// 没有任何条件的规则会把所有流量引入类别路由表
+		if rule.Protocol == "" && rule.DSCP == 0 {
+			errors = append(errors, ValidationError{
+				Field:   field,
+				Value:   rule.Class,
+				Message: "must match on protocol, ports or dscp",
+			})
+		}
+	}
+
+	// 验证 shaping
+	if cfg.Shaping.LinkRateMbps < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "shaping.link_rate_mbps",
+			Value:   fmt.Sprintf("%g", cfg.Shaping.LinkRateMbps),
+			Message: "must be positive",
+		})
+	}
+
+	// 验证 route_audit
+	if cfg.RouteAudit.Size < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "route_audit.size",
+			Value:   fmt.Sprintf("%d", cfg.RouteAudit.Size),
+			Message: "must be positive",
+		})
+	}
+
+	// 验证 traceroute
+	if cfg.Traceroute.Interval < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "traceroute.interval",
+			Value:   cfg.Traceroute.Interval.String(),
+			Message: "must be positive, or 0 to disable",
+		})
+	}
+	if cfg.Traceroute.MaxHops < 0 || cfg.Traceroute.MaxHops > 255 {
+		errors = append(errors, ValidationError{
+			Field:   "traceroute.max_hops",
+			Value:   fmt.Sprintf("%d", cfg.Traceroute.MaxHops),
+			Message: "must be in range [1, 255]",
+		})
+	}
+	if cfg.Traceroute.Timeout < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "traceroute.timeout",
+			Value:   cfg.Traceroute.Timeout.String(),
+			Message: "must be positive",
+		})
+	}
+
+	// 验证 health
+	if cfg.Health.Port != 0 && !ValidatePort(cfg.Health.Port) {
+		errors = append(errors, ValidationError{
+			Field:   "health.port",
+			Value:   fmt.Sprintf("%d", cfg.Health.Port),
+			Message: "must be 0 (disabled) or in range [1, 65535]",
+		})
+	}
+	if (cfg.Health.TLSCert == "") != (cfg.Health.TLSKey == "") {
+		errors = append(errors, ValidationError{
+			Field:   "health.tls_cert",
+			Value:   cfg.Health.TLSCert,
+			Message: "tls_cert and tls_key must be set together",
+		})
+	}
+
+	// 验证 sync.mode
+	if cfg.Sync.Mode != "" && cfg.Sync.Mode != SyncModePoll && cfg.Sync.Mode != SyncModeStream {
+		errors = append(errors, ValidationError{
+			Field:   "sync.mode",
+			Value:   cfg.Sync.Mode,
+			Message: "must be one of: poll, stream",
+		})
+	}
+
 	// 验证 network.subnet
 	if cfg.Network.Subnet != "" && !ValidateSubnet(cfg.Network.Subnet) {
 		errors = append(errors, ValidationError{
@@ -169,6 +602,35 @@ func ValidateAgentConfig(cfg *AgentConfig) []ValidationError {
 		})
 	}
 
+	// 验证 network.subnet6
+	if cfg.Network.Subnet6 != "" {
+		ip, _, err := net.ParseCIDR(cfg.Network.Subnet6)
+		if err != nil || ip.To4() != nil {
+			errors = append(errors, ValidationError{
+				Field:   "network.subnet6",
+				Value:   cfg.Network.Subnet6,
+				Message: "must be a valid IPv6 CIDR subnet (e.g., fd00:254::/64)",
+			})
+		} else if subnetIP, _, err := net.ParseCIDR(cfg.Network.Subnet); err == nil && subnetIP.To4() == nil {
+			errors = append(errors, ValidationError{
+				Field:   "network.subnet6",
+				Value:   cfg.Network.Subnet6,
+				Message: "network.subnet is already IPv6; subnet6 is only for dual-stack with an IPv4 subnet",
+			})
+		}
+	}
+
+	// 验证 network.endpoint
+	if cfg.Network.Endpoint != "" {
+		if _, _, err := net.SplitHostPort(cfg.Network.Endpoint); err != nil {
+			errors = append(errors, ValidationError{
+				Field:   "network.endpoint",
+				Value:   cfg.Network.Endpoint,
+				Message: "must be in host:port form (e.g., 203.0.113.5:51820)",
+			})
+		}
+	}
+
 	return errors
 }
 
@@ -195,6 +657,38 @@ func ValidateControllerConfig(cfg *ControllerConfig) []ValidationError {
 		})
 	}
 
+	// 验证 server.max_body_bytes
+	if cfg.Server.MaxBodyBytes < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "server.max_body_bytes",
+			Value:   fmt.Sprintf("%d", cfg.Server.MaxBodyBytes),
+			Message: "must be non-negative",
+		})
+	}
+
+	// 验证 server.shutdown_delay
+	if cfg.Server.ShutdownDelay < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "server.shutdown_delay",
+			Value:   cfg.Server.ShutdownDelay.String(),
+			Message: "must be non-negative",
+		})
+	}
+
+	// 验证 server.trusted_proxies
+	for i, proxy := range cfg.Server.TrustedProxies {
+		if !ValidateIPAddress(proxy) && !ValidateSubnet(proxy) {
+			errors = append(errors, ValidationError{
+				Field:   fmt.Sprintf("server.trusted_proxies[%d]", i),
+				Value:   proxy,
+				Message: "must be an IP address or CIDR (e.g., 10.0.0.1 or 10.0.0.0/8)",
+			})
+		}
+	}
+
+	// 验证 server.tls
+	errors = append(errors, validateTLSConfig(cfg.Server.TLS)...)
+
 	// 验证 algorithm.penalty_factor
 	if cfg.Algorithm.PenaltyFactor < 0 {
 		errors = append(errors, ValidationError{
@@ -213,6 +707,394 @@ func ValidateControllerConfig(cfg *ControllerConfig) []ValidationError {
 		})
 	}
 
+	// 验证 algorithm.degradation_threshold
+	if cfg.Algorithm.DegradationThreshold < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.degradation_threshold",
+			Value:   fmt.Sprintf("%f", cfg.Algorithm.DegradationThreshold),
+			Message: "must be non-negative",
+		})
+	}
+
+	// 验证 algorithm.jitter_weight
+	if cfg.Algorithm.JitterWeight < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.jitter_weight",
+			Value:   fmt.Sprintf("%f", cfg.Algorithm.JitterWeight),
+			Message: "must be non-negative",
+		})
+	}
+
+	// 验证 algorithm.bandwidth_penalty / bandwidth_reference_mbps
+	if cfg.Algorithm.BandwidthPenalty < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.bandwidth_penalty",
+			Value:   fmt.Sprintf("%f", cfg.Algorithm.BandwidthPenalty),
+			Message: "must be non-negative",
+		})
+	}
+	if cfg.Algorithm.BandwidthReferenceMbps < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.bandwidth_reference_mbps",
+			Value:   fmt.Sprintf("%f", cfg.Algorithm.BandwidthReferenceMbps),
+			Message: "must be positive",
+		})
+	}
+
+	// 验证 algorithm.max_hops
+	if cfg.Algorithm.MaxHops < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.max_hops",
+			Value:   fmt.Sprintf("%d", cfg.Algorithm.MaxHops),
+			Message: "must be non-negative (0 means unlimited)",
+		})
+	}
+
+	// 验证 algorithm.sla
+	sla := cfg.Algorithm.SLA
+	if sla.MaxLossRate < 0 || sla.MaxLossRate > 1 {
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.sla.max_loss_rate",
+			Value:   fmt.Sprintf("%f", sla.MaxLossRate),
+			Message: "must be in range [0, 1] (0 means no limit)",
+		})
+	}
+	if sla.MaxRTTMs < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.sla.max_rtt_ms",
+			Value:   fmt.Sprintf("%f", sla.MaxRTTMs),
+			Message: "must be non-negative (0 means no limit)",
+		})
+	}
+	if sla.MaxJitterMs < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.sla.max_jitter_ms",
+			Value:   fmt.Sprintf("%f", sla.MaxJitterMs),
+			Message: "must be non-negative (0 means no limit)",
+		})
+	}
+
+	// 验证 algorithm.weights
+	weights := cfg.Algorithm.Weights
+	if weights.RTT < 0 || weights.Loss < 0 || weights.Jitter < 0 || weights.Bandwidth < 0 {
+		errors = append(errors, ValidationError{
+			Field: "algorithm.weights",
+			Value: fmt.Sprintf("rtt=%g loss=%g jitter=%g bandwidth=%g",
+				weights.RTT, weights.Loss, weights.Jitter, weights.Bandwidth),
+			Message: "must be non-negative",
+		})
+	} else if weights.Enabled() && weights.RTT == 0 {
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.weights.rtt",
+			Value:   "0",
+			Message: "must be positive when weights are set, otherwise lossless links have zero cost",
+		})
+	}
+	if weights.Bandwidth > 0 && cfg.Algorithm.BandwidthPenalty <= 0 {
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.weights.bandwidth",
+			Value:   fmt.Sprintf("%f", weights.Bandwidth),
+			Message: "requires algorithm.bandwidth_penalty > 0",
+		})
+	}
+
+	// 验证 algorithm.min_samples
+	if cfg.Algorithm.MinSamples < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.min_samples",
+			Value:   fmt.Sprintf("%d", cfg.Algorithm.MinSamples),
+			Message: "must be non-negative (0 means no minimum)",
+		})
+	}
+
+	// 验证 algorithm.relay_load_penalty
+	if cfg.Algorithm.RelayLoadPenalty < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.relay_load_penalty",
+			Value:   fmt.Sprintf("%f", cfg.Algorithm.RelayLoadPenalty),
+			Message: "must be non-negative (0 disables relay load balancing)",
+		})
+	}
+
+	// 验证 algorithm.link_reconciliation
+	switch cfg.Algorithm.LinkReconciliation {
+	case "", LinkReconcileDirectional, LinkReconcileMax, LinkReconcileAverage:
+	default:
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.link_reconciliation",
+			Value:   cfg.Algorithm.LinkReconciliation,
+			Message: "must be one of: directional, max, average",
+		})
+	}
+
+	// 验证 algorithm.traffic_classes
+	classNames := make(map[string]bool)
+	for i, class := range cfg.Algorithm.TrafficClasses {
+		field := fmt.Sprintf("algorithm.traffic_classes[%d]", i)
+		if class.Name == "" {
+			errors = append(errors, ValidationError{
+				Field:   field + ".name",
+				Value:   "",
+				Message: "name is required",
+			})
+		} else if classNames[class.Name] {
+			errors = append(errors, ValidationError{
+				Field:   field + ".name",
+				Value:   class.Name,
+				Message: "name must be unique",
+			})
+		}
+		classNames[class.Name] = true
+		if class.PenaltyFactor < 0 || class.JitterWeight < 0 || class.BandwidthPenalty < 0 {
+			errors = append(errors, ValidationError{
+				Field: field,
+				Value: fmt.Sprintf("penalty_factor=%g jitter_weight=%g bandwidth_penalty=%g",
+					class.PenaltyFactor, class.JitterWeight, class.BandwidthPenalty),
+				Message: "weights must be non-negative",
+			})
+		}
+	}
+
+	// 验证 algorithm.ecmp_margin
+	if cfg.Algorithm.ECMPMargin < 0 || cfg.Algorithm.ECMPMargin > 1 {
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.ecmp_margin",
+			Value:   fmt.Sprintf("%f", cfg.Algorithm.ECMPMargin),
+			Message: "must be in range [0, 1]",
+		})
+	}
+
+	// 验证 algorithm.backup_paths
+	if cfg.Algorithm.BackupPaths < 0 || cfg.Algorithm.BackupPaths > maxBackupPaths {
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.backup_paths",
+			Value:   fmt.Sprintf("%d", cfg.Algorithm.BackupPaths),
+			Message: fmt.Sprintf("must be in range [0, %d]", maxBackupPaths),
+		})
+	}
+
+	// 验证 algorithm 重算模式
+	if cfg.Algorithm.RecomputeMode != "" &&
+		cfg.Algorithm.RecomputeMode != RecomputeOnRequest &&
+		cfg.Algorithm.RecomputeMode != RecomputeOnTelemetry &&
+		cfg.Algorithm.RecomputeMode != RecomputeOnChange {
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.recompute_mode",
+			Value:   cfg.Algorithm.RecomputeMode,
+			Message: "must be one of: on_request, on_telemetry, on_change",
+		})
+	}
+	if cfg.Algorithm.RecomputeLossRate < 0 || cfg.Algorithm.RecomputeLossRate > 1 {
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.recompute_loss_rate",
+			Value:   fmt.Sprintf("%f", cfg.Algorithm.RecomputeLossRate),
+			Message: "must be in range [0, 1]",
+		})
+	}
+	if cfg.Algorithm.RecomputeRTTMs < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.recompute_rtt_ms",
+			Value:   fmt.Sprintf("%f", cfg.Algorithm.RecomputeRTTMs),
+			Message: "must be non-negative",
+		})
+	}
+	if cfg.Algorithm.RouteCacheTTL < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "algorithm.route_cache_ttl",
+			Value:   cfg.Algorithm.RouteCacheTTL.String(),
+			Message: "must be non-negative",
+		})
+	}
+
+	// 验证 topology.interval_multiplier
+	if cfg.Topology.IntervalMultiplier != 0 && cfg.Topology.IntervalMultiplier < 1 {
+		errors = append(errors, ValidationError{
+			Field:   "topology.interval_multiplier",
+			Value:   fmt.Sprintf("%f", cfg.Topology.IntervalMultiplier),
+			Message: "must be at least 1",
+		})
+	}
+
+	// 验证 topology 容量
+	if cfg.Topology.HistorySize < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "topology.history_size",
+			Value:   fmt.Sprintf("%d", cfg.Topology.HistorySize),
+			Message: "must be non-negative",
+		})
+	}
+	if cfg.Topology.MaxAgents < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "topology.max_agents",
+			Value:   fmt.Sprintf("%d", cfg.Topology.MaxAgents),
+			Message: "must be non-negative",
+		})
+	}
+	if cfg.Topology.MaxMetricsPerAgent < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "topology.max_metrics_per_agent",
+			Value:   fmt.Sprintf("%d", cfg.Topology.MaxMetricsPerAgent),
+			Message: "must be non-negative",
+		})
+	}
+	if cfg.Topology.TombstoneTTL < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "topology.tombstone_ttl",
+			Value:   cfg.Topology.TombstoneTTL.String(),
+			Message: "must be non-negative",
+		})
+	}
+	if cfg.Topology.Retention.MaxAge < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "topology.retention.max_age",
+			Value:   cfg.Topology.Retention.MaxAge.String(),
+			Message: "must be non-negative",
+		})
+	}
+	if cfg.Topology.Retention.MaxPoints < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "topology.retention.max_points",
+			Value:   fmt.Sprintf("%d", cfg.Topology.Retention.MaxPoints),
+			Message: "must be non-negative",
+		})
+	}
+	if r := cfg.Topology.Retention; r.DownsampleInterval < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "topology.retention.downsample_interval",
+			Value:   r.DownsampleInterval.String(),
+			Message: "must be non-negative",
+		})
+	} else if r.MaxAge > 0 && r.DownsampleInterval >= r.MaxAge {
+		errors = append(errors, ValidationError{
+			Field:   "topology.retention.downsample_interval",
+			Value:   r.DownsampleInterval.String(),
+			Message: "must be less than topology.retention.max_age",
+		})
+	}
+	if cfg.Topology.LinkStaleThreshold < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "topology.link_stale_threshold",
+			Value:   cfg.Topology.LinkStaleThreshold.String(),
+			Message: "must be non-negative",
+		})
+	}
+	if cfg.Topology.QuarantinePeriod < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "topology.quarantine_period",
+			Value:   cfg.Topology.QuarantinePeriod.String(),
+			Message: "must be non-negative",
+		})
+	}
+	if cfg.Topology.CleanerInterval <= 0 {
+		errors = append(errors, ValidationError{
+			Field:   "topology.cleaner_interval",
+			Value:   cfg.Topology.CleanerInterval.String(),
+			Message: "must be positive",
+		})
+	}
+
+	// 验证 rate_limit
+	if cfg.RateLimit.PerIPRPS < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "rate_limit.per_ip_rps",
+			Value:   fmt.Sprintf("%f", cfg.RateLimit.PerIPRPS),
+			Message: "must be non-negative",
+		})
+	}
+	if cfg.RateLimit.PerIPBurst < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "rate_limit.per_ip_burst",
+			Value:   fmt.Sprintf("%d", cfg.RateLimit.PerIPBurst),
+			Message: "must be non-negative",
+		})
+	} else if cfg.RateLimit.PerIPRPS > 0 && cfg.RateLimit.PerIPBurst == 0 {
+		errors = append(errors, ValidationError{
+			Field:   "rate_limit.per_ip_burst",
+			Value:   "0",
+			Message: "must be at least 1 when per_ip_rps is set (use per_ip_rps: 0 to disable)",
+		})
+	}
+	if cfg.RateLimit.PerAgentRPS < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "rate_limit.per_agent_rps",
+			Value:   fmt.Sprintf("%f", cfg.RateLimit.PerAgentRPS),
+			Message: "must be non-negative",
+		})
+	}
+	if cfg.RateLimit.PerAgentBurst < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "rate_limit.per_agent_burst",
+			Value:   fmt.Sprintf("%d", cfg.RateLimit.PerAgentBurst),
+			Message: "must be non-negative",
+		})
+	} else if cfg.RateLimit.PerAgentRPS > 0 && cfg.RateLimit.PerAgentBurst == 0 {
+		errors = append(errors, ValidationError{
+			Field:   "rate_limit.per_agent_burst",
+			Value:   "0",
+			Message: "must be at least 1 when per_agent_rps is set (use per_agent_rps: 0 to disable)",
+		})
+	}
+
+	// 验证 tenants
+	if cfg.Tenants.MaxTenants < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "tenants.max_tenants",
+			Value:   fmt.Sprintf("%d", cfg.Tenants.MaxTenants),
+			Message: "must be non-negative",
+		})
+	}
+	for id, token := range cfg.Tenants.Tokens {
+		if id == models.DefaultTenantID || !models.ValidTenantID(id) {
+			errors = append(errors, ValidationError{
+				Field:   "tenants.tokens",
+				Value:   id,
+				Message: "must be a non-empty tenant_id of letters, digits, - and _",
+			})
+		} else if token == "" {
+			errors = append(errors, ValidationError{
+				Field:   "tenants.tokens." + id,
+				Value:   "",
+				Message: "token must not be empty",
+			})
+		}
+	}
+
+	// 验证 audit.url
+	if cfg.Audit.URL != "" && !ValidateURL(cfg.Audit.URL) {
+		errors = append(errors, ValidationError{
+			Field:   "audit.url",
+			Value:   cfg.Audit.URL,
+			Message: "must be a valid HTTP or HTTPS URL",
+		})
+	}
+
+	// 验证 webhook
+	errors = append(errors, validateWebhookConfig(cfg.Webhook)...)
+
+	// 验证 cors.allowed_origins
+	for i, origin := range cfg.CORS.AllowedOrigins {
+		if origin != "*" && !ValidateURL(origin) {
+			errors = append(errors, ValidationError{
+				Field:   fmt.Sprintf("cors.allowed_origins[%d]", i),
+				Value:   origin,
+				Message: "must be \"*\" or a valid HTTP or HTTPS origin",
+			})
+		}
+	}
+	if cfg.CORS.MaxAge < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "cors.max_age",
+			Value:   cfg.CORS.MaxAge.String(),
+			Message: "must be non-negative",
+		})
+	}
+
+	// 验证 replication
+	errors = append(errors, validateReplicationConfig(cfg.Replication)...)
+
+	// 验证 storage
+	errors = append(errors, validateStorageConfig(cfg.Storage)...)
+
 	// 验证 logging.level
 	validLevels := map[string]bool{
 		"DEBUG": true,
@@ -231,6 +1113,202 @@ func ValidateControllerConfig(cfg *ControllerConfig) []ValidationError {
 	return errors
 }
 
+// validateStorageConfig 验证持久化配置
+func validateStorageConfig(st StorageConfig) []ValidationError {
+	var errors []ValidationError
+
+	switch st.Backend {
+	case "", StorageBackendMemory:
+		return nil
+	case StorageBackendFile, StorageBackendBolt, StorageBackendSQLite:
+	case StorageBackendRedis:
+		return validateRedisConfig(st.Redis)
+	default:
+		return append(errors, ValidationError{
+			Field:   "storage.backend",
+			Value:   st.Backend,
+			Message: "must be one of: memory, file, bolt, sqlite, redis",
+		})
+	}
+
+	if st.Path == "" {
+		errors = append(errors, ValidationError{
+			Field:   "storage.path",
+			Value:   "",
+			Message: "is required for the " + st.Backend + " backend",
+		})
+	}
+	if st.FlushInterval < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "storage.flush_interval",
+			Value:   st.FlushInterval.String(),
+			Message: "must be non-negative",
+		})
+	}
+	return errors
+}
+
+// validateRedisConfig 验证 redis 后端配置
+func validateRedisConfig(r RedisConfig) []ValidationError {
+	var errors []ValidationError
+
+	if _, _, err := net.SplitHostPort(r.Address); err != nil {
+		errors = append(errors, ValidationError{
+			Field:   "storage.redis.address",
+			Value:   r.Address,
+			Message: "must be host:port",
+		})
+	}
+	if r.DB < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "storage.redis.db",
+			Value:   fmt.Sprintf("%d", r.DB),
+			Message: "must be non-negative",
+		})
+	}
+	if r.Timeout < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "storage.redis.timeout",
+			Value:   r.Timeout.String(),
+			Message: "must be non-negative",
+		})
+	}
+	if r.SyncInterval < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "storage.redis.sync_interval",
+			Value:   r.SyncInterval.String(),
+			Message: "must be non-negative",
+		})
+	}
+	return errors
+}
+
+// validateReplicationConfig 验证主备复制配置
+func validateReplicationConfig(r ReplicationConfig) []ValidationError {
+	var errors []ValidationError
+
+	switch r.Role {
+	case "":
+		return nil
+	case ReplicationRolePrimary, ReplicationRoleStandby:
+	default:
+		return append(errors, ValidationError{
+			Field:   "replication.role",
+			Value:   r.Role,
+			Message: "must be one of: primary, standby (or empty to disable)",
+		})
+	}
+
+	if r.Token == "" {
+		errors = append(errors, ValidationError{
+			Field:   "replication.token",
+			Value:   "",
+			Message: "is required when replication is enabled",
+		})
+	}
+	if r.Role == ReplicationRoleStandby && !ValidateURL(r.PrimaryURL) {
+		errors = append(errors, ValidationError{
+			Field:   "replication.primary_url",
+			Value:   r.PrimaryURL,
+			Message: "must be a valid HTTP or HTTPS URL for standby role",
+		})
+	}
+	if r.Interval < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "replication.interval",
+			Value:   r.Interval.String(),
+			Message: "must be non-negative",
+		})
+	}
+	return errors
+}
+
+// validateWebhookConfig 验证 Webhook 配置
+func validateWebhookConfig(w WebhookConfig) []ValidationError {
+	var errors []ValidationError
+
+	validEvents := map[string]bool{
+		WebhookEventAgentJoined:  true,
+		WebhookEventAgentStale:   true,
+		WebhookEventLinkDegraded: true,
+		WebhookEventRouteChanged: true,
+	}
+
+	for i, ep := range w.Endpoints {
+		if !ValidateURL(ep.URL) {
+			errors = append(errors, ValidationError{
+				Field:   fmt.Sprintf("webhook.endpoints[%d].url", i),
+				Value:   ep.URL,
+				Message: "must be a valid HTTP or HTTPS URL",
+			})
+		}
+		for _, event := range ep.Events {
+			if !validEvents[event] {
+				errors = append(errors, ValidationError{
+					Field:   fmt.Sprintf("webhook.endpoints[%d].events", i),
+					Value:   event,
+					Message: "must be one of: agent.joined, agent.stale, link.degraded, route.changed",
+				})
+			}
+		}
+	}
+
+	if w.MaxRetries < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "webhook.max_retries",
+			Value:   fmt.Sprintf("%d", w.MaxRetries),
+			Message: "must be non-negative",
+		})
+	}
+	if w.DegradedLossRate < 0 || w.DegradedLossRate > 1 {
+		errors = append(errors, ValidationError{
+			Field:   "webhook.degraded_loss_rate",
+			Value:   fmt.Sprintf("%f", w.DegradedLossRate),
+			Message: "must be in range [0, 1]",
+		})
+	}
+	if w.DegradedRTTMs < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "webhook.degraded_rtt_ms",
+			Value:   fmt.Sprintf("%f", w.DegradedRTTMs),
+			Message: "must be non-negative",
+		})
+	}
+	return errors
+}
+
+// validateTLSConfig 验证 TLS 配置：证书和私钥必须同时设置且可读
+func validateTLSConfig(t TLSConfig) []ValidationError {
+	var errors []ValidationError
+
+	if t.CertFile == "" && t.KeyFile == "" {
+		return nil
+	}
+	if t.CertFile == "" || t.KeyFile == "" {
+		return append(errors, ValidationError{
+			Field:   "server.tls",
+			Value:   fmt.Sprintf("cert_file=%s key_file=%s", t.CertFile, t.KeyFile),
+			Message: "cert_file and key_file must be set together",
+		})
+	}
+
+	if _, err := os.Stat(t.CertFile); err != nil {
+		errors = append(errors, ValidationError{
+			Field:   "server.tls.cert_file",
+			Value:   t.CertFile,
+			Message: "file is not readable",
+		})
+	}
+	if _, err := os.Stat(t.KeyFile); err != nil {
+		errors = append(errors, ValidationError{
+			Field:   "server.tls.key_file",
+			Value:   t.KeyFile,
+			Message: "file is not readable",
+		})
+	}
+	return errors
+}
+
 // FormatValidationErrors 格式化验证错误为可读字符串
 func FormatValidationErrors(errors []ValidationError) string {
 	if len(errors) == 0 {
@@ -243,3 +1321,13 @@ func FormatValidationErrors(errors []ValidationError) string {
 	}
 	return sb.String()
 }
+
+// validProbeType 检查探测方式是否受支持
+func validProbeType(probeType string) bool {
+	switch probeType {
+	case ProbeTypeICMP, ProbeTypeTCP, ProbeTypeHTTP, ProbeTypeTWAMP:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "server.crt")
+	key := filepath.Join(dir, "server.key")
+	for _, path := range []string{cert, key} {
+		if err := os.WriteFile(path, []byte("pem"), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+	missing := filepath.Join(dir, "missing.pem")
+
+	tests := []struct {
+		name        string
+		tls         TLSConfig
+		wantEnabled bool
+		wantFields  []string
+	}{
+		{"disabled", TLSConfig{}, false, nil},
+		{"cert and key", TLSConfig{CertFile: cert, KeyFile: key}, true, nil},
+		{"cert only", TLSConfig{CertFile: cert}, false, []string{"server.tls"}},
+		{"key only", TLSConfig{KeyFile: key}, false, []string{"server.tls"}},
+		{"missing cert", TLSConfig{CertFile: missing, KeyFile: key}, true, []string{"server.tls.cert_file"}},
+		{"missing both", TLSConfig{CertFile: missing, KeyFile: missing}, true, []string{"server.tls.cert_file", "server.tls.key_file"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.tls.Enabled(); got != tt.wantEnabled {
+				t.Errorf("Enabled() = %v, want %v", got, tt.wantEnabled)
+			}
+			errs := validateTLSConfig(tt.tls)
+			if len(errs) != len(tt.wantFields) {
+				t.Fatalf("validateTLSConfig() = %v, want errors for %v", errs, tt.wantFields)
+			}
+			for i, field := range tt.wantFields {
+				if errs[i].Field != field {
+					t.Errorf("error %d field = %s, want %s", i, errs[i].Field, field)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadControllerConfigTLS(t *testing.T) {
+	path := writeConfig(t, "server:\n  tls:\n    cert_file: /nonexistent/server.crt\n    key_file: /nonexistent/server.key\n")
+	if _, err := LoadControllerConfig(path); err == nil {
+		t.Error("LoadControllerConfig() should reject unreadable TLS files")
+	}
+}
+
+func TestValidateStorageConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		storage    StorageConfig
+		wantFields []string
+	}{
+		{"memory", StorageConfig{Backend: StorageBackendMemory}, nil},
+		{"bolt", StorageConfig{Backend: StorageBackendBolt, Path: "/var/lib/state.db"}, nil},
+		{"sqlite", StorageConfig{Backend: StorageBackendSQLite, Path: "/var/lib/state.db"}, nil},
+		{"bolt without path", StorageConfig{Backend: StorageBackendBolt}, []string{"storage.path"}},
+		{"sqlite without path", StorageConfig{Backend: StorageBackendSQLite}, []string{"storage.path"}},
+		{"unknown backend", StorageConfig{Backend: "leveldb"}, []string{"storage.backend"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateStorageConfig(tt.storage)
+			if len(errs) != len(tt.wantFields) {
+				t.Fatalf("validateStorageConfig() = %v, want errors for %v", errs, tt.wantFields)
+			}
+			for i, field := range tt.wantFields {
+				if errs[i].Field != field {
+					t.Errorf("error %d field = %s, want %s", i, errs[i].Field, field)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadControllerConfigTrustedProxies(t *testing.T) {
+	cfg, err := LoadControllerConfig(writeConfig(t, "server:\n  trusted_proxies: [\"10.0.0.1\", \"172.16.0.0/12\"]\n"))
+	if err != nil {
+		t.Fatalf("LoadControllerConfig() error = %v", err)
+	}
+	if len(cfg.Server.TrustedProxies) != 2 {
+		t.Errorf("TrustedProxies = %v, want 2 entries", cfg.Server.TrustedProxies)
+	}
+
+	_, err = LoadControllerConfig(writeConfig(t, "server:\n  trusted_proxies: [\"proxy.local\"]\n"))
+	if err == nil || !strings.Contains(err.Error(), "server.trusted_proxies[0]") {
+		t.Errorf("LoadControllerConfig() error = %v, want server.trusted_proxies[0] error", err)
+	}
+}
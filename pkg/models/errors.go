@@ -4,14 +4,46 @@ import "errors"
 
 var (
 	// 验证错误
-	ErrEmptyAgentID     = errors.New("agent_id cannot be empty")
-	ErrInvalidTimestamp = errors.New("timestamp must be positive")
-	ErrEmptyMetrics     = errors.New("metrics cannot be empty")
-	ErrEmptyTargetIP    = errors.New("target_ip cannot be empty")
-	ErrNegativeRTT      = errors.New("rtt_ms cannot be negative")
-	ErrInvalidLossRate  = errors.New("loss_rate must be between 0.0 and 1.0")
+	ErrEmptyAgentID         = errors.New("agent_id cannot be empty")
+	ErrInvalidTimestamp     = errors.New("timestamp must be positive")
+	ErrEmptyMetrics         = errors.New("metrics cannot be empty")
+	ErrEmptyTargetIP        = errors.New("target_ip cannot be empty")
+	ErrNegativeRTT          = errors.New("rtt_ms cannot be negative")
+	ErrNegativeJitter       = errors.New("jitter_ms cannot be negative")
+	ErrNegativeBandwidth    = errors.New("bandwidth_mbps cannot be negative")
+	ErrNegativeHandshakeAge = errors.New("handshake_age_sec cannot be negative")
+	ErrInvalidLossRate      = errors.New("loss_rate must be between 0.0 and 1.0")
+	ErrEmptyPinEndpoint     = errors.New("source and target cannot be empty")
+	ErrEmptyNextHop         = errors.New("next_hop cannot be empty")
+	ErrSelfPin              = errors.New("source and target must differ")
+	ErrInvalidPinHop        = errors.New("next_hop must differ from source and target")
+	ErrEmptyLinkEndpoint    = errors.New("link source and target cannot be empty")
+	ErrSelfLink             = errors.New("link source and target must differ")
+	ErrNegativeRelayHops    = errors.New("max_relay_hops cannot be negative")
+	ErrNegativePenalty      = errors.New("penalty_factor cannot be negative")
+	ErrEmptyAvoidRelay      = errors.New("avoid_relays cannot contain empty agent_id")
+	ErrInvalidShapingHop    = errors.New("shaping next_hop must be a valid IP address")
+	ErrDuplicateShapingHop  = errors.New("shaping cannot list the same next_hop twice")
+	ErrNegativeShapingRate  = errors.New("shaping rate_mbps cannot be negative")
+	ErrInvalidPriority      = errors.New("shaping priority must be one of: high, normal, low")
+	ErrInvalidDstCIDR       = errors.New("dst_cidr must be a valid CIDR (e.g., 10.254.1.0/24)")
+	ErrInvalidMaxHops       = errors.New("max_hops must be at least 1")
+	ErrEmptyAvoidNode       = errors.New("avoid_nodes cannot contain empty agent_id")
+	ErrViaAvoided           = errors.New("via cannot also appear in avoid_nodes")
+	ErrInvalidTenantID      = errors.New("tenant_id may only contain letters, digits, '-' and '_' (max 64 characters)")
+	ErrEmptyMutations       = errors.New("mutations cannot be empty")
+	ErrInvalidMutation      = errors.New("mutation type must be one of: link_down, link_cost, node_down")
+	ErrEmptyMutationNode    = errors.New("node_down requires node")
+	ErrEmptyLinkCost        = errors.New("link_cost requires rtt_ms or loss_rate")
+
+	ErrInvalidReportInterval = errors.New("report_interval_sec cannot be negative")
+	ErrInvalidTunnelIP       = errors.New("metadata.tunnel_ip must be a valid IP address")
+	ErrInvalidEndpoint       = errors.New("metadata.endpoint must be in host:port form")
+	ErrEmptyTraceroutes      = errors.New("traceroutes cannot be empty")
+	ErrInvalidHopTTL         = errors.New("hop ttl must be positive")
 
 	// 业务错误
 	ErrAgentNotFound = errors.New("agent not found")
+	ErrAgentStale    = errors.New("agent known but stale")
 	ErrNoPath        = errors.New("no path available")
 )
@@ -3,14 +3,30 @@ package models
 
 import (
 	"encoding/json"
+	"net"
+	"strings"
 	"time"
 )
 
 // Metric 表示单个目标节点的探测指标
 type Metric struct {
-	TargetIP string   `json:"target_ip" yaml:"target_ip"`
-	RTTMs    *float64 `json:"rtt_ms" yaml:"rtt_ms"`       // nil 表示超时
-	LossRate float64  `json:"loss_rate" yaml:"loss_rate"` // 0.0 - 1.0
+	TargetIP string   `json:"target_ip" yaml:"target_ip"`                     // 对等节点的隧道地址，IPv4 或规范形式的 IPv6
+	RTTMs    *float64 `json:"rtt_ms" yaml:"rtt_ms"`                           // nil 表示超时
+	LossRate float64  `json:"loss_rate" yaml:"loss_rate"`                     // 0.0 - 1.0
+	JitterMs float64  `json:"jitter_ms,omitempty" yaml:"jitter_ms,omitempty"` // 滑动窗口内 RTT 的标准差
+	// 链路可用带宽 (Mbps)，0 表示未知
+	BandwidthMbps float64 `json:"bandwidth_mbps,omitempty" yaml:"bandwidth_mbps,omitempty"`
+	// MeasuredAt 测量时间（Unix 秒），0 表示与请求的 timestamp 相同
+	MeasuredAt int64 `json:"measured_at,omitempty" yaml:"measured_at,omitempty"`
+	// 滑动窗口内 RTT 的分位数，平均值会掩盖交互流量最在意的尾部延迟；0 表示未上报
+	RTTP50Ms float64 `json:"rtt_p50_ms,omitempty" yaml:"rtt_p50_ms,omitempty"`
+	RTTP95Ms float64 `json:"rtt_p95_ms,omitempty" yaml:"rtt_p95_ms,omitempty"`
+	RTTP99Ms float64 `json:"rtt_p99_ms,omitempty" yaml:"rtt_p99_ms,omitempty"`
+	// HandshakeAgeSec 到该对等节点的 WireGuard 隧道距最近一次握手的秒数，与探测结果相互独立；
+	// nil 表示未采集或从未握手
+	HandshakeAgeSec *int64 `json:"handshake_age_sec,omitempty" yaml:"handshake_age_sec,omitempty"`
+	// HandshakeNever 为 true 表示到该对等节点的隧道从未握手，此时 HandshakeAgeSec 为 nil
+	HandshakeNever bool `json:"handshake_never,omitempty" yaml:"handshake_never,omitempty"`
 }
 
 // TelemetryRequest 表示 Agent 上报的遥测数据
@@ -18,17 +34,353 @@ type TelemetryRequest struct {
 	AgentID   string   `json:"agent_id" yaml:"agent_id"`
 	Timestamp int64    `json:"timestamp" yaml:"timestamp"`
 	Metrics   []Metric `json:"metrics" yaml:"metrics"`
+	TenantID  string   `json:"tenant_id,omitempty" yaml:"tenant_id,omitempty"` // 为空表示默认租户
+	// ReportIntervalSec Agent 声明的上报间隔（秒），Controller 据此计算该 Agent 的过期时间，0 表示使用全局 stale_threshold
+	ReportIntervalSec int64 `json:"report_interval_sec,omitempty" yaml:"report_interval_sec,omitempty"`
+	// Partial 为 true 时 Metrics 只包含部分链路，与已有数据按链路合并；否则替换该 Agent 的全部链路
+	Partial bool `json:"partial,omitempty" yaml:"partial,omitempty"`
+	// Metadata Agent 所在机器的信息，为空时保留之前上报的信息
+	Metadata *AgentMetadata `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	// Sequence Agent 每次上报递增的序号，Controller 忽略不大于已存储序号的遥测，0 表示不检查
+	Sequence uint64 `json:"sequence,omitempty" yaml:"sequence,omitempty"`
+	// ReceivedAtNs Controller 接受该遥测的 UnixNano，只出现在副本同步、持久化等导出的快照中，
+	// 同一秒内的两次上报据此区分新旧；Agent 上报时忽略
+	ReceivedAtNs int64 `json:"received_at_ns,omitempty" yaml:"received_at_ns,omitempty"`
+}
+
+// AgentMetadata 表示 Agent 所在机器的信息，供运维人员将 agent_id 对应到实际机器
+type AgentMetadata struct {
+	Hostname  string `json:"hostname,omitempty" yaml:"hostname,omitempty"`
+	Version   string `json:"version,omitempty" yaml:"version,omitempty"`       // Agent 软件版本
+	PublicKey string `json:"public_key,omitempty" yaml:"public_key,omitempty"` // WireGuard 公钥
+	TunnelIP  string `json:"tunnel_ip,omitempty" yaml:"tunnel_ip,omitempty"`   // WireGuard 接口地址
+	Endpoint  string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`     // 公网 host:port
+}
+
+// PathReport Agent 上报的底层（underlay）路径数据，用于把隧道链路劣化对应到具体的运营商节点
+type PathReport struct {
+	AgentID     string       `json:"agent_id"`
+	TenantID    string       `json:"tenant_id,omitempty"`
+	Traceroutes []Traceroute `json:"traceroutes"`
+}
+
+// Traceroute 到对等节点底层端点的一次 traceroute
+type Traceroute struct {
+	Target     string          `json:"target"`   // 对等节点的隧道 IP，与 Metric.TargetIP 对应
+	Endpoint   string          `json:"endpoint"` // 对等节点的底层地址
+	Hops       []TracerouteHop `json:"hops"`
+	MeasuredAt int64           `json:"measured_at"` // Unix 秒
+}
+
+// TracerouteHop traceroute 的一跳
+type TracerouteHop struct {
+	TTL     int      `json:"ttl"`
+	Address string   `json:"address,omitempty"` // 该跳未回复时为空
+	RTTMs   *float64 `json:"rtt_ms,omitempty"`
+}
+
+// HostCIDR 返回目的地址对应的主机路由前缀：IPv4 为 /32，IPv6 为 /128
+func HostCIDR(ip string) string {
+	if strings.Contains(ip, ":") {
+		return ip + "/128"
+	}
+	return ip + "/32"
 }
 
 // RouteConfig 表示单条路由配置
 type RouteConfig struct {
 	DstCIDR string `json:"dst_cidr" yaml:"dst_cidr"`
-	NextHop string `json:"next_hop" yaml:"next_hop"` // IP 地址或 "direct"
+	NextHop string `json:"next_hop" yaml:"next_hop"` // IP 地址、"direct" 或 "blackhole"（丢弃发往该目的地的流量）
 	Reason  string `json:"reason" yaml:"reason"`     // "optimized_path" 或 "default"
+	// NextHops 启用 ECMP 时成本相近的全部下一跳，第一个与 NextHop 相同；只有一条路径时为空
+	NextHops []string `json:"next_hops,omitempty" yaml:"next_hops,omitempty"`
+	// Weights 与 NextHops 一一对应的分流权重（1-256），为空表示等权
+	Weights []int `json:"weights,omitempty" yaml:"weights,omitempty"`
+	// Backups 按成本排序的无环备份下一跳，主下一跳失效时 Agent 可立即本地切换
+	Backups []string `json:"backups,omitempty" yaml:"backups,omitempty"`
+	// Path 下发时计算出的完整路径（含源和目的地），CostMs 为该路径的端到端成本；固定路由和不可达路由为空
+	Path   []string `json:"path,omitempty" yaml:"path,omitempty"`
+	CostMs float64  `json:"cost_ms,omitempty" yaml:"cost_ms,omitempty"`
+	// Metric 安装路由时使用的内核 metric，数值越小越优先，与静态路由、DHCP 路由按该值共存；0 表示使用 Agent 的 network.route_metric
+	Metric uint32 `json:"metric,omitempty" yaml:"metric,omitempty"`
+}
+
+// Relays 返回路径中间按转发顺序排列的中继节点，直连或没有路径信息时为空
+// 本机只安装到第一个中继的路由，后续中继按各自从 Controller 获取的路由逐跳转发
+func (r *RouteConfig) Relays() []string {
+	if len(r.Path) < 3 {
+		return nil
+	}
+	return r.Path[1 : len(r.Path)-1]
+}
+
+// RoutePin 表示管理员固定的 source->target 下一跳，优先于计算结果
+type RoutePin struct {
+	Source    string `json:"source" yaml:"source"`
+	Target    string `json:"target" yaml:"target"`
+	NextHop   string `json:"next_hop" yaml:"next_hop"` // 中继节点、"direct" 或 "blackhole"
+	Comment   string `json:"comment,omitempty" yaml:"comment,omitempty"`
+	CreatedAt int64  `json:"created_at" yaml:"created_at"`
+}
+
+// Validate 验证 RoutePin 的有效性
+func (p *RoutePin) Validate() error {
+	if p.Source == "" || p.Target == "" {
+		return ErrEmptyPinEndpoint
+	}
+	if p.Source == p.Target {
+		return ErrSelfPin
+	}
+	if p.NextHop == "" {
+		return ErrEmptyNextHop
+	}
+	if p.NextHop == p.Source || p.NextHop == p.Target {
+		return ErrInvalidPinHop
+	}
+	return nil
+}
+
+// LinkDisable 表示被管理员禁用的有向链路 source->target，构建拓扑图时排除，与测量结果无关
+type LinkDisable struct {
+	Source    string `json:"source" yaml:"source"`
+	Target    string `json:"target" yaml:"target"`
+	Comment   string `json:"comment,omitempty" yaml:"comment,omitempty"`
+	CreatedAt int64  `json:"created_at" yaml:"created_at"`
+}
+
+// Validate 验证 LinkDisable 的有效性
+func (l *LinkDisable) Validate() error {
+	if l.Source == "" || l.Target == "" {
+		return ErrEmptyLinkEndpoint
+	}
+	if l.Source == l.Target {
+		return ErrSelfLink
+	}
+	return nil
+}
+
+// 拓扑变更类型
+const (
+	// MutationLinkDown 有向链路 source->target 断开
+	MutationLinkDown = "link_down"
+	// MutationLinkCost 修改有向链路 source->target 的测量值
+	MutationLinkCost = "link_cost"
+	// MutationNodeDown 节点下线：删除它上报的数据以及所有到它的链路
+	MutationNodeDown = "node_down"
+)
+
+// TopologyMutation 假设的拓扑变更，只用于模拟，不修改实际拓扑
+type TopologyMutation struct {
+	Type     string   `json:"type"`
+	Source   string   `json:"source,omitempty"`
+	Target   string   `json:"target,omitempty"`
+	Node     string   `json:"node,omitempty"`
+	RTTMs    *float64 `json:"rtt_ms,omitempty"`    // link_cost：新的 RTT，未设置时保持不变
+	LossRate *float64 `json:"loss_rate,omitempty"` // link_cost：新的丢包率，未设置时保持不变
+}
+
+// Validate 验证 TopologyMutation 的有效性
+func (m *TopologyMutation) Validate() error {
+	switch m.Type {
+	case MutationLinkDown, MutationLinkCost:
+		link := LinkDisable{Source: m.Source, Target: m.Target}
+		if err := link.Validate(); err != nil {
+			return err
+		}
+	case MutationNodeDown:
+		if m.Node == "" {
+			return ErrEmptyMutationNode
+		}
+		return nil
+	default:
+		return ErrInvalidMutation
+	}
+	if m.Type != MutationLinkCost {
+		return nil
+	}
+	if m.RTTMs == nil && m.LossRate == nil {
+		return ErrEmptyLinkCost
+	}
+	if m.RTTMs != nil && *m.RTTMs < 0 {
+		return ErrNegativeRTT
+	}
+	if m.LossRate != nil && (*m.LossRate < 0 || *m.LossRate > 1) {
+		return ErrInvalidLossRate
+	}
+	return nil
+}
+
+// SimulationRequest what-if 模拟请求：在当前拓扑上应用变更后计算路由
+type SimulationRequest struct {
+	Mutations []TopologyMutation `json:"mutations"`
+	AgentID   string             `json:"agent_id,omitempty"` // 只返回该 Agent 的结果，为空时返回所有 Agent
+}
+
+// Validate 验证 SimulationRequest 的有效性
+func (r *SimulationRequest) Validate() error {
+	if len(r.Mutations) == 0 {
+		return ErrEmptyMutations
+	}
+	for i := range r.Mutations {
+		if err := r.Mutations[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RoutePolicy 单个 Agent 的路由策略，由 Controller 在计算该 Agent 的路由时强制执行
+type RoutePolicy struct {
+	AgentID       string   `json:"agent_id" yaml:"agent_id"`
+	AvoidRelays   []string `json:"avoid_relays,omitempty" yaml:"avoid_relays,omitempty"`     // 不经这些 Agent 中继
+	MaxRelayHops  *int     `json:"max_relay_hops,omitempty" yaml:"max_relay_hops,omitempty"` // 最多中继跳数，0 表示只允许直连
+	PenaltyFactor *float64 `json:"penalty_factor,omitempty" yaml:"penalty_factor,omitempty"` // 覆盖全局丢包惩罚系数，调大即更看重丢包
+	// Shaping 该 Agent 发往各下一跳的流量的出口整形参数，随路由下发，由 Agent 用 tc 实施
+	Shaping   []NextHopShaping `json:"shaping,omitempty" yaml:"shaping,omitempty"`
+	Comment   string           `json:"comment,omitempty" yaml:"comment,omitempty"`
+	UpdatedAt int64            `json:"updated_at" yaml:"updated_at"`
+}
+
+// NextHopShaping 发往某个下一跳（包括经它中继的目的地）的流量的整形参数
+type NextHopShaping struct {
+	NextHop  string  `json:"next_hop" yaml:"next_hop"`                       // 下一跳的隧道地址
+	RateMbps float64 `json:"rate_mbps,omitempty" yaml:"rate_mbps,omitempty"` // 速率上限，0 表示不限速
+	Priority string  `json:"priority,omitempty" yaml:"priority,omitempty"`   // 争用带宽时的优先级，见 ShapingPriority* 常量，为空表示 normal
+}
+
+// 流量整形的优先级，未整形的流量按 normal 调度
+const (
+	ShapingPriorityHigh   = "high"
+	ShapingPriorityNormal = "normal"
+	ShapingPriorityLow    = "low"
+)
+
+// Validate 验证 RoutePolicy 的有效性
+func (p *RoutePolicy) Validate() error {
+	if p.AgentID == "" {
+		return ErrEmptyAgentID
+	}
+	if p.MaxRelayHops != nil && *p.MaxRelayHops < 0 {
+		return ErrNegativeRelayHops
+	}
+	if p.PenaltyFactor != nil && *p.PenaltyFactor < 0 {
+		return ErrNegativePenalty
+	}
+	for _, relay := range p.AvoidRelays {
+		if relay == "" {
+			return ErrEmptyAvoidRelay
+		}
+	}
+	seen := make(map[string]bool, len(p.Shaping))
+	for _, shaping := range p.Shaping {
+		ip := net.ParseIP(shaping.NextHop)
+		if ip == nil {
+			return ErrInvalidShapingHop
+		}
+		if seen[ip.String()] {
+			return ErrDuplicateShapingHop
+		}
+		seen[ip.String()] = true
+		if shaping.RateMbps < 0 {
+			return ErrNegativeShapingRate
+		}
+		switch shaping.Priority {
+		case "", ShapingPriorityHigh, ShapingPriorityNormal, ShapingPriorityLow:
+		default:
+			return ErrInvalidPriority
+		}
+	}
+	return nil
+}
+
+// RouteConstraint 针对目的前缀的路由约束，所有 Agent 计算到该前缀内目的地的路径时强制执行
+// 多条约束同时匹配时按最长前缀生效
+type RouteConstraint struct {
+	DstCIDR    string   `json:"dst_cidr" yaml:"dst_cidr"`
+	AvoidNodes []string `json:"avoid_nodes,omitempty" yaml:"avoid_nodes,omitempty"` // 路径不得经这些节点中继
+	MaxHops    *int     `json:"max_hops,omitempty" yaml:"max_hops,omitempty"`       // 路径最多经过的链路数，1 表示只允许直连
+	Via        string   `json:"via,omitempty" yaml:"via,omitempty"`                 // 路径必须经过的节点
+	Comment    string   `json:"comment,omitempty" yaml:"comment,omitempty"`
+	UpdatedAt  int64    `json:"updated_at" yaml:"updated_at"`
+}
+
+// Validate 验证 RouteConstraint 的有效性
+func (c *RouteConstraint) Validate() error {
+	if _, _, err := net.ParseCIDR(c.DstCIDR); err != nil {
+		return ErrInvalidDstCIDR
+	}
+	if c.MaxHops != nil && *c.MaxHops < 1 {
+		return ErrInvalidMaxHops
+	}
+	for _, node := range c.AvoidNodes {
+		if node == "" {
+			return ErrEmptyAvoidNode
+		}
+		if node == c.Via {
+			return ErrViaAvoided
+		}
+	}
+	return nil
+}
+
+// Matches 判断目的地址是否落在约束的前缀内，返回前缀长度
+func (c *RouteConstraint) Matches(target string) (prefixLen int, ok bool) {
+	_, ipnet, err := net.ParseCIDR(c.DstCIDR)
+	if err != nil {
+		return 0, false
+	}
+	ip := net.ParseIP(target)
+	if ip == nil || !ipnet.Contains(ip) {
+		return 0, false
+	}
+	ones, _ := ipnet.Mask.Size()
+	return ones, true
+}
+
+// RouteChange 表示一次路由决策变化，用于事后分析
+type RouteChange struct {
+	Source     string   `json:"source"`
+	Target     string   `json:"target"`
+	DstCIDR    string   `json:"dst_cidr"`
+	OldNextHop string   `json:"old_next_hop,omitempty"` // 为空表示首次下发
+	NewNextHop string   `json:"new_next_hop"`
+	OldCost    *float64 `json:"old_cost,omitempty"`
+	NewCost    *float64 `json:"new_cost,omitempty"` // 固定路由没有计算成本
+	Reason     string   `json:"reason"`
+	Timestamp  int64    `json:"timestamp"`
+}
+
+// TopologyChange 表示一次拓扑状态变更及其来源，用于事后追查节点或链路消失的原因
+type TopologyChange struct {
+	Type         string   `json:"type"`
+	AgentID      string   `json:"agent_id"`
+	Target       string   `json:"target,omitempty"` // 管理性启用/禁用的链路目标
+	Actor        string   `json:"actor"`            // 上报的 agent_id、cleaner、admin@<ip> 等
+	Reason       string   `json:"reason,omitempty"`
+	AddedLinks   []string `json:"added_links,omitempty"`   // 新出现的链路目标
+	RemovedLinks []string `json:"removed_links,omitempty"` // 消失的链路目标
+	Version      uint64   `json:"version,omitempty"`       // 变更后的拓扑数据版本
+	Timestamp    int64    `json:"timestamp"`
 }
 
 // RouteResponse 表示路由查询响应
 type RouteResponse struct {
+	Routes  []RouteConfig `json:"routes"`
+	Version uint64        `json:"version,omitempty"` // 路由集版本，在请求带 since 时和路由流的每个事件中返回
+	// Classes 各流量类别的完整路由表，仅在 Controller 配置了 traffic_classes 时返回
+	Classes []ClassRoutes `json:"classes,omitempty"`
+	// Shaping 该 Agent 路由策略中的出口整形参数，每次返回完整快照，为空表示不整形
+	Shaping []NextHopShaping `json:"shaping,omitempty"`
+}
+
+// PeersResponse 表示对等节点列表响应，Agent 据此更新探测目标
+type PeersResponse struct {
+	Peers []string `json:"peers"` // 其他 Agent 的隧道地址，已排序
+}
+
+// ClassRoutes 单个流量类别的完整路由表，Agent 将其安装到该类别对应的内核路由表
+type ClassRoutes struct {
+	Class  string        `json:"class"`
 	Routes []RouteConfig `json:"routes"`
 }
 
@@ -38,21 +390,50 @@ type HealthResponse struct {
 	AgentCount int    `json:"agent_count"`
 }
 
+// StatusResponse 表示简单状态响应
+type StatusResponse struct {
+	Status string `json:"status"`
+}
+
 // ErrorResponse 表示错误响应
 type ErrorResponse struct {
 	Detail string `json:"detail"`
 }
 
 // AgentData 表示存储在拓扑数据库中的 Agent 数据
+// 存入拓扑数据库后不再修改，更新时整体替换；JSON 形式用于 Controller 的状态持久化和副本同步
 type AgentData struct {
-	Timestamp time.Time
-	Metrics   map[string]*MetricData // target_ip -> metrics
+	Timestamp      time.Time              `json:"timestamp"`
+	Metrics        map[string]*MetricData `json:"metrics"`                   // target_ip -> metrics
+	ReportInterval time.Duration          `json:"report_interval,omitempty"` // Agent 声明的上报间隔，0 表示未声明
+	Metadata       *AgentMetadata         `json:"metadata,omitempty"`        // 最近一次上报的机器信息，未上报过时为 nil
+	Sequence       uint64                 `json:"sequence,omitempty"`        // 最近一次接受的遥测序号，0 表示未携带
+	ReceivedAt     time.Time              `json:"received_at"`               // Controller 接受遥测的时间（纳秒精度），导入的快照保留原值
 }
 
 // MetricData 表示存储的指标数据
 type MetricData struct {
-	RTT  *float64
-	Loss float64
+	RTT       *float64  `json:"rtt_ms"`
+	Loss      float64   `json:"loss_rate"`
+	Jitter    float64   `json:"jitter_ms,omitempty"`
+	Bandwidth float64   `json:"bandwidth_mbps,omitempty"` // 可用带宽 (Mbps)，0 表示未知
+	P50       float64   `json:"rtt_p50_ms,omitempty"`     // Agent 滑动窗口内 RTT 的 p50，0 表示未上报
+	P95       float64   `json:"rtt_p95_ms,omitempty"`     // 同上，p95
+	P99       float64   `json:"rtt_p99_ms,omitempty"`     // 同上，p99
+	Samples   int       `json:"samples,omitempty"`        // 连续测得 RTT 的遥测次数，链路超时后归零
+	UpdatedAt time.Time `json:"updated_at"`               // 测量时间
+	// HandshakeAgeSec Agent 上报的距最近一次 WireGuard 握手的秒数，nil 表示未上报或从未握手
+	HandshakeAgeSec *int64 `json:"handshake_age_sec,omitempty"`
+	HandshakeNever  bool   `json:"handshake_never,omitempty"` // Agent 上报隧道从未握手
+	// RTTHistory 最近若干次测得的 RTT（按时间先后，不含超时），用于计算 min/max/p95；
+	// 较早的样本可能已按保留策略降采样为区间平均值
+	RTTHistory []RTTSample `json:"rtt_history,omitempty"`
+}
+
+// RTTSample 链路的一个 RTT 样本
+type RTTSample struct {
+	At    time.Time `json:"at"` // 测量时间，降采样后为区间起点
+	RTTMs float64   `json:"rtt_ms"`
 }
 
 // ToJSON 将 TelemetryRequest 序列化为 JSON
@@ -70,9 +451,20 @@ func (t *TelemetryRequest) Validate() error {
 	if t.AgentID == "" {
 		return ErrEmptyAgentID
 	}
+	if !ValidTenantID(t.TenantID) {
+		return ErrInvalidTenantID
+	}
 	if t.Timestamp <= 0 {
 		return ErrInvalidTimestamp
 	}
+	if t.ReportIntervalSec < 0 {
+		return ErrInvalidReportInterval
+	}
+	if t.Metadata != nil {
+		if err := t.Metadata.Validate(); err != nil {
+			return err
+		}
+	}
 	if len(t.Metrics) == 0 {
 		return ErrEmptyMetrics
 	}
@@ -84,6 +476,19 @@ func (t *TelemetryRequest) Validate() error {
 	return nil
 }
 
+// Validate 验证 AgentMetadata 的有效性
+func (m *AgentMetadata) Validate() error {
+	if m.TunnelIP != "" && net.ParseIP(m.TunnelIP) == nil {
+		return ErrInvalidTunnelIP
+	}
+	if m.Endpoint != "" {
+		if _, _, err := net.SplitHostPort(m.Endpoint); err != nil {
+			return ErrInvalidEndpoint
+		}
+	}
+	return nil
+}
+
 // Validate 验证 Metric 的有效性
 func (m *Metric) Validate() error {
 	if m.TargetIP == "" {
@@ -92,12 +497,57 @@ func (m *Metric) Validate() error {
 	if m.RTTMs != nil && *m.RTTMs < 0 {
 		return ErrNegativeRTT
 	}
+	if m.RTTP50Ms < 0 || m.RTTP95Ms < 0 || m.RTTP99Ms < 0 {
+		return ErrNegativeRTT
+	}
+	if m.JitterMs < 0 {
+		return ErrNegativeJitter
+	}
+	if m.BandwidthMbps < 0 {
+		return ErrNegativeBandwidth
+	}
+	if m.MeasuredAt < 0 {
+		return ErrInvalidTimestamp
+	}
+	if m.HandshakeAgeSec != nil && *m.HandshakeAgeSec < 0 {
+		return ErrNegativeHandshakeAge
+	}
 	if m.LossRate < 0 || m.LossRate > 1 {
 		return ErrInvalidLossRate
 	}
 	return nil
 }
 
+// Validate 验证 PathReport 的有效性
+func (r *PathReport) Validate() error {
+	if r.AgentID == "" {
+		return ErrEmptyAgentID
+	}
+	if !ValidTenantID(r.TenantID) {
+		return ErrInvalidTenantID
+	}
+	if len(r.Traceroutes) == 0 {
+		return ErrEmptyTraceroutes
+	}
+	for _, tr := range r.Traceroutes {
+		if tr.Target == "" {
+			return ErrEmptyTargetIP
+		}
+		if tr.MeasuredAt < 0 {
+			return ErrInvalidTimestamp
+		}
+		for _, hop := range tr.Hops {
+			if hop.TTL <= 0 {
+				return ErrInvalidHopTTL
+			}
+			if hop.RTTMs != nil && *hop.RTTMs < 0 {
+				return ErrNegativeRTT
+			}
+		}
+	}
+	return nil
+}
+
 // HealthStatus 健康状态常量
 const (
 	HealthStatusHealthy   = "healthy"
@@ -67,6 +67,35 @@ func TestTelemetryRequestValidation(t *testing.T) {
 			},
 			wantErr: ErrInvalidLossRate,
 		},
+		{
+			name: "negative jitter",
+			req: TelemetryRequest{
+				AgentID:   "10.254.0.1",
+				Timestamp: 1234567890,
+				Metrics:   []Metric{{TargetIP: "10.254.0.2", RTTMs: ptrFloat64(10.0), JitterMs: -1.0}},
+			},
+			wantErr: ErrNegativeJitter,
+		},
+		{
+			name: "valid tenant_id",
+			req: TelemetryRequest{
+				AgentID:   "10.254.0.1",
+				TenantID:  "acme-corp_1",
+				Timestamp: 1234567890,
+				Metrics:   []Metric{{TargetIP: "10.254.0.2", LossRate: 0.0}},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "invalid tenant_id",
+			req: TelemetryRequest{
+				AgentID:   "10.254.0.1",
+				TenantID:  "acme/corp",
+				Timestamp: 1234567890,
+				Metrics:   []Metric{{TargetIP: "10.254.0.2", LossRate: 0.0}},
+			},
+			wantErr: ErrInvalidTenantID,
+		},
 	}
 
 	for _, tt := range tests {
@@ -144,3 +173,60 @@ func TestMetricJSONSerialization(t *testing.T) {
 func ptrFloat64(v float64) *float64 {
 	return &v
 }
+
+func ptrInt64(v int64) *int64 {
+	return &v
+}
+
+func TestRouteConfigRelays(t *testing.T) {
+	tests := []struct {
+		path []string
+		want int
+	}{
+		{nil, 0},
+		{[]string{"A", "D"}, 0},
+		{[]string{"A", "B", "D"}, 1},
+		{[]string{"A", "B", "C", "D"}, 2},
+	}
+	for _, tt := range tests {
+		r := RouteConfig{Path: tt.path}
+		if got := r.Relays(); len(got) != tt.want {
+			t.Errorf("Relays() for path %v = %v, want %d relays", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRoutePolicyShapingValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		shaping []NextHopShaping
+		wantErr error
+	}{
+		{"valid", []NextHopShaping{{NextHop: "10.254.0.2", RateMbps: 20}, {NextHop: "fd00::2", Priority: ShapingPriorityHigh}}, nil},
+		{"invalid next hop", []NextHopShaping{{NextHop: "agent-2", RateMbps: 20}}, ErrInvalidShapingHop},
+		{"duplicate next hop", []NextHopShaping{{NextHop: "10.254.0.2"}, {NextHop: "10.254.0.2", RateMbps: 5}}, ErrDuplicateShapingHop},
+		{"negative rate", []NextHopShaping{{NextHop: "10.254.0.2", RateMbps: -1}}, ErrNegativeShapingRate},
+		{"invalid priority", []NextHopShaping{{NextHop: "10.254.0.2", Priority: "urgent"}}, ErrInvalidPriority},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := RoutePolicy{AgentID: "10.254.0.1", Shaping: tt.shaping}
+			if err := p.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHostCIDR(t *testing.T) {
+	tests := map[string]string{
+		"10.254.0.2":  "10.254.0.2/32",
+		"fd00:254::2": "fd00:254::2/128",
+		"agent-b":     "agent-b/32",
+	}
+	for ip, want := range tests {
+		if got := HostCIDR(ip); got != want {
+			t.Errorf("HostCIDR(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
@@ -0,0 +1,561 @@
+// Package models 定义 SD-WAN 系统的核心数据模型
+package models
+
+import (
+	"errors"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ContentTypeProtobuf API v2 使用的 protobuf 内容类型
+const ContentTypeProtobuf = "application/x-protobuf"
+
+// ErrInvalidProto protobuf 数据格式错误
+var ErrInvalidProto = errors.New("invalid protobuf payload")
+
+// 本文件手工实现 api/proto/sdwan.proto 中消息的编解码，字段编号必须与 schema 保持一致
+
+// ProtoMarshaler 可编码为 protobuf 的消息
+type ProtoMarshaler interface {
+	MarshalProto() []byte
+}
+
+// consumeFields 遍历 protobuf 消息的字段，对每个字段调用 fn
+// fn 返回已消费的字节数，返回负数表示解码失败
+func consumeFields(b []byte, fn func(num protowire.Number, typ protowire.Type, b []byte) int) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return ErrInvalidProto
+		}
+		b = b[n:]
+
+		m := fn(num, typ, b)
+		if m == 0 {
+			// 未知字段，按类型跳过以保持向前兼容
+			m = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if m < 0 {
+			return ErrInvalidProto
+		}
+		b = b[m:]
+	}
+	return nil
+}
+
+// MarshalProto 编码 Metric
+func (m *Metric) MarshalProto() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, m.TargetIP)
+	if m.RTTMs != nil {
+		b = protowire.AppendTag(b, 2, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(*m.RTTMs))
+	}
+	b = protowire.AppendTag(b, 3, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(m.LossRate))
+	if m.JitterMs != 0 {
+		b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(m.JitterMs))
+	}
+	if m.BandwidthMbps != 0 {
+		b = protowire.AppendTag(b, 5, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(m.BandwidthMbps))
+	}
+	if m.MeasuredAt != 0 {
+		b = protowire.AppendTag(b, 6, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(m.MeasuredAt))
+	}
+	if m.RTTP50Ms != 0 {
+		b = protowire.AppendTag(b, 7, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(m.RTTP50Ms))
+	}
+	if m.RTTP95Ms != 0 {
+		b = protowire.AppendTag(b, 8, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(m.RTTP95Ms))
+	}
+	if m.RTTP99Ms != 0 {
+		b = protowire.AppendTag(b, 9, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(m.RTTP99Ms))
+	}
+	if m.HandshakeAgeSec != nil {
+		b = protowire.AppendTag(b, 10, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(*m.HandshakeAgeSec))
+	}
+	if m.HandshakeNever {
+		b = protowire.AppendTag(b, 11, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(true))
+	}
+	return b
+}
+
+// UnmarshalProto 解码 Metric
+func (m *Metric) UnmarshalProto(data []byte) error {
+	*m = Metric{}
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			m.TargetIP = v
+			return n
+		case num == 2 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			rtt := math.Float64frombits(v)
+			m.RTTMs = &rtt
+			return n
+		case num == 3 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			m.LossRate = math.Float64frombits(v)
+			return n
+		case num == 4 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			m.JitterMs = math.Float64frombits(v)
+			return n
+		case num == 5 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			m.BandwidthMbps = math.Float64frombits(v)
+			return n
+		case num == 6 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			m.MeasuredAt = int64(v)
+			return n
+		case num == 7 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			m.RTTP50Ms = math.Float64frombits(v)
+			return n
+		case num == 8 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			m.RTTP95Ms = math.Float64frombits(v)
+			return n
+		case num == 9 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			m.RTTP99Ms = math.Float64frombits(v)
+			return n
+		case num == 10 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			age := int64(v)
+			m.HandshakeAgeSec = &age
+			return n
+		case num == 11 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			m.HandshakeNever = protowire.DecodeBool(v)
+			return n
+		}
+		return 0
+	})
+}
+
+// MarshalProto 编码 TelemetryRequest
+func (t *TelemetryRequest) MarshalProto() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, t.AgentID)
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(t.Timestamp))
+	for i := range t.Metrics {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, t.Metrics[i].MarshalProto())
+	}
+	if t.TenantID != "" {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendString(b, t.TenantID)
+	}
+	if t.ReportIntervalSec != 0 {
+		b = protowire.AppendTag(b, 5, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(t.ReportIntervalSec))
+	}
+	if t.Partial {
+		b = protowire.AppendTag(b, 6, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(true))
+	}
+	if t.Metadata != nil {
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendBytes(b, t.Metadata.MarshalProto())
+	}
+	if t.Sequence != 0 {
+		b = protowire.AppendTag(b, 8, protowire.VarintType)
+		b = protowire.AppendVarint(b, t.Sequence)
+	}
+	return b
+}
+
+// UnmarshalProto 解码 TelemetryRequest
+func (t *TelemetryRequest) UnmarshalProto(data []byte) error {
+	*t = TelemetryRequest{}
+	var nested error
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			t.AgentID = v
+			return n
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			t.Timestamp = int64(v)
+			return n
+		case num == 3 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			var m Metric
+			if err := m.UnmarshalProto(v); err != nil {
+				nested = err
+				return -1
+			}
+			t.Metrics = append(t.Metrics, m)
+			return n
+		case num == 4 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			t.TenantID = v
+			return n
+		case num == 5 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			t.ReportIntervalSec = int64(v)
+			return n
+		case num == 6 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			t.Partial = protowire.DecodeBool(v)
+			return n
+		case num == 7 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			t.Metadata = &AgentMetadata{}
+			if err := t.Metadata.UnmarshalProto(v); err != nil {
+				nested = err
+				return -1
+			}
+			return n
+		case num == 8 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			t.Sequence = v
+			return n
+		}
+		return 0
+	})
+	if nested != nil {
+		return nested
+	}
+	return err
+}
+
+// MarshalProto 编码 AgentMetadata
+func (m *AgentMetadata) MarshalProto() []byte {
+	var b []byte
+	for _, f := range []struct {
+		num   protowire.Number
+		value string
+	}{
+		{1, m.Hostname},
+		{2, m.Version},
+		{3, m.PublicKey},
+		{4, m.TunnelIP},
+		{5, m.Endpoint},
+	} {
+		if f.value != "" {
+			b = protowire.AppendTag(b, f.num, protowire.BytesType)
+			b = protowire.AppendString(b, f.value)
+		}
+	}
+	return b
+}
+
+// UnmarshalProto 解码 AgentMetadata
+func (m *AgentMetadata) UnmarshalProto(data []byte) error {
+	*m = AgentMetadata{}
+	fields := map[protowire.Number]*string{
+		1: &m.Hostname,
+		2: &m.Version,
+		3: &m.PublicKey,
+		4: &m.TunnelIP,
+		5: &m.Endpoint,
+	}
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		field, ok := fields[num]
+		if !ok || typ != protowire.BytesType {
+			return 0
+		}
+		v, n := protowire.ConsumeString(b)
+		*field = v
+		return n
+	})
+}
+
+// MarshalProto 编码 RouteConfig
+func (r *RouteConfig) MarshalProto() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, r.DstCIDR)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, r.NextHop)
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendString(b, r.Reason)
+	for _, hop := range r.NextHops {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendString(b, hop)
+	}
+	for _, hop := range r.Backups {
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendString(b, hop)
+	}
+	for _, node := range r.Path {
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendString(b, node)
+	}
+	if r.CostMs != 0 {
+		b = protowire.AppendTag(b, 7, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(r.CostMs))
+	}
+	if r.Metric != 0 {
+		b = protowire.AppendTag(b, 8, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(r.Metric))
+	}
+	if len(r.Weights) > 0 {
+		var packed []byte
+		for _, w := range r.Weights {
+			packed = protowire.AppendVarint(packed, uint64(w))
+		}
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendBytes(b, packed)
+	}
+	return b
+}
+
+// UnmarshalProto 解码 RouteConfig
+func (r *RouteConfig) UnmarshalProto(data []byte) error {
+	*r = RouteConfig{}
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if num == 7 && typ == protowire.Fixed64Type {
+			v, n := protowire.ConsumeFixed64(b)
+			r.CostMs = math.Float64frombits(v)
+			return n
+		}
+		if num == 8 && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			r.Metric = uint32(v)
+			return n
+		}
+		// repeated 标量字段默认打包编码，也接受逐个编码
+		if num == 9 && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			r.Weights = append(r.Weights, int(v))
+			return n
+		}
+		if num == 9 && typ == protowire.BytesType {
+			packed, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			for len(packed) > 0 {
+				v, m := protowire.ConsumeVarint(packed)
+				if m < 0 {
+					return m
+				}
+				r.Weights = append(r.Weights, int(v))
+				packed = packed[m:]
+			}
+			return n
+		}
+		if typ != protowire.BytesType {
+			return 0
+		}
+		v, n := protowire.ConsumeString(b)
+		switch num {
+		case 1:
+			r.DstCIDR = v
+		case 2:
+			r.NextHop = v
+		case 3:
+			r.Reason = v
+		case 4:
+			r.NextHops = append(r.NextHops, v)
+		case 5:
+			r.Backups = append(r.Backups, v)
+		case 6:
+			r.Path = append(r.Path, v)
+		default:
+			return 0
+		}
+		return n
+	})
+}
+
+// MarshalProto 编码 RouteResponse
+func (r *RouteResponse) MarshalProto() []byte {
+	var b []byte
+	for i := range r.Routes {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, r.Routes[i].MarshalProto())
+	}
+	if r.Version != 0 {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, r.Version)
+	}
+	for i := range r.Classes {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, r.Classes[i].MarshalProto())
+	}
+	for i := range r.Shaping {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, r.Shaping[i].MarshalProto())
+	}
+	return b
+}
+
+// UnmarshalProto 解码 RouteResponse
+func (r *RouteResponse) UnmarshalProto(data []byte) error {
+	r.Routes = []RouteConfig{}
+	r.Version = 0
+	r.Classes = nil
+	r.Shaping = nil
+	var nested error
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if num == 2 && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			r.Version = v
+			return n
+		}
+		if (num != 1 && num != 3 && num != 4) || typ != protowire.BytesType {
+			return 0
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n
+		}
+		if num == 4 {
+			var shaping NextHopShaping
+			if err := shaping.UnmarshalProto(v); err != nil {
+				nested = err
+				return -1
+			}
+			r.Shaping = append(r.Shaping, shaping)
+			return n
+		}
+		if num == 3 {
+			var class ClassRoutes
+			if err := class.UnmarshalProto(v); err != nil {
+				nested = err
+				return -1
+			}
+			r.Classes = append(r.Classes, class)
+			return n
+		}
+		var route RouteConfig
+		if err := route.UnmarshalProto(v); err != nil {
+			nested = err
+			return -1
+		}
+		r.Routes = append(r.Routes, route)
+		return n
+	})
+	if nested != nil {
+		return nested
+	}
+	return err
+}
+
+// MarshalProto 编码 NextHopShaping
+func (s *NextHopShaping) MarshalProto() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, s.NextHop)
+	if s.RateMbps != 0 {
+		b = protowire.AppendTag(b, 2, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(s.RateMbps))
+	}
+	if s.Priority != "" {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, s.Priority)
+	}
+	return b
+}
+
+// UnmarshalProto 解码 NextHopShaping
+func (s *NextHopShaping) UnmarshalProto(data []byte) error {
+	*s = NextHopShaping{}
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if num == 2 && typ == protowire.Fixed64Type {
+			v, n := protowire.ConsumeFixed64(b)
+			s.RateMbps = math.Float64frombits(v)
+			return n
+		}
+		if typ != protowire.BytesType {
+			return 0
+		}
+		v, n := protowire.ConsumeString(b)
+		switch num {
+		case 1:
+			s.NextHop = v
+		case 3:
+			s.Priority = v
+		default:
+			return 0
+		}
+		return n
+	})
+}
+
+// MarshalProto 编码 ClassRoutes
+func (c *ClassRoutes) MarshalProto() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, c.Class)
+	for i := range c.Routes {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, c.Routes[i].MarshalProto())
+	}
+	return b
+}
+
+// UnmarshalProto 解码 ClassRoutes
+func (c *ClassRoutes) UnmarshalProto(data []byte) error {
+	*c = ClassRoutes{Routes: []RouteConfig{}}
+	var nested error
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if typ != protowire.BytesType {
+			return 0
+		}
+		switch num {
+		case 1:
+			v, n := protowire.ConsumeString(b)
+			c.Class = v
+			return n
+		case 2:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			var route RouteConfig
+			if err := route.UnmarshalProto(v); err != nil {
+				nested = err
+				return -1
+			}
+			c.Routes = append(c.Routes, route)
+			return n
+		}
+		return 0
+	})
+	if nested != nil {
+		return nested
+	}
+	return err
+}
+
+// MarshalProto 编码 ErrorResponse
+func (e *ErrorResponse) MarshalProto() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, e.Detail)
+	return b
+}
+
+// MarshalProto 编码 StatusResponse
+func (s *StatusResponse) MarshalProto() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, s.Status)
+	return b
+}
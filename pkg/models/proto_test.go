@@ -0,0 +1,71 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTelemetryRequestProtoRoundTrip(t *testing.T) {
+	orig := TelemetryRequest{
+		AgentID:           "10.254.0.1",
+		TenantID:          "acme",
+		Timestamp:         1703830000,
+		ReportIntervalSec: 60,
+		Partial:           true,
+		Sequence:          42,
+		Metadata:          &AgentMetadata{Hostname: "edge-1", Version: "1.2.0", TunnelIP: "10.254.0.1", Endpoint: "203.0.113.5:51820"},
+		Metrics: []Metric{
+			{TargetIP: "10.254.0.2", RTTMs: ptrFloat64(35.5), LossRate: 0.1, JitterMs: 4.2, BandwidthMbps: 50, MeasuredAt: 1703829990,
+				RTTP50Ms: 34, RTTP95Ms: 41.5, RTTP99Ms: 48, HandshakeAgeSec: ptrInt64(75)},
+			{TargetIP: "10.254.0.3", RTTMs: nil, LossRate: 1.0, HandshakeNever: true},
+		},
+	}
+
+	var decoded TelemetryRequest
+	if err := decoded.UnmarshalProto(orig.MarshalProto()); err != nil {
+		t.Fatalf("UnmarshalProto() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(orig, decoded) {
+		t.Errorf("Round trip mismatch:\n got  %+v\n want %+v", decoded, orig)
+	}
+}
+
+func TestRouteResponseProtoRoundTrip(t *testing.T) {
+	orig := RouteResponse{Routes: []RouteConfig{
+		{DstCIDR: "10.254.0.3/32", NextHop: "10.254.0.2", Reason: "optimized_path"},
+		{DstCIDR: "10.254.0.4/32", NextHop: "direct", Reason: "default"},
+		{DstCIDR: "10.254.0.5/32", NextHop: "10.254.0.2", Reason: "optimized_path",
+			NextHops: []string{"10.254.0.2", "10.254.0.3"}, Weights: []int{3, 1}, Backups: []string{"direct"},
+			Path: []string{"10.254.0.1", "10.254.0.2", "10.254.0.4"}, CostMs: 23.5, Metric: 50},
+	}, Version: 42, Classes: []ClassRoutes{
+		{Class: "realtime", Routes: []RouteConfig{
+			{DstCIDR: "10.254.0.3/32", NextHop: "direct", Reason: "default"},
+		}},
+	}, Shaping: []NextHopShaping{
+		{NextHop: "10.254.0.2", RateMbps: 12.5, Priority: ShapingPriorityLow},
+		{NextHop: "10.254.0.3", Priority: ShapingPriorityHigh},
+	}}
+
+	var decoded RouteResponse
+	if err := decoded.UnmarshalProto(orig.MarshalProto()); err != nil {
+		t.Fatalf("UnmarshalProto() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(orig, decoded) {
+		t.Errorf("Round trip mismatch:\n got  %+v\n want %+v", decoded, orig)
+	}
+}
+
+func TestUnmarshalProtoRejectsTruncated(t *testing.T) {
+	data := (&TelemetryRequest{
+		AgentID:   "10.254.0.1",
+		Timestamp: 1,
+		Metrics:   []Metric{{TargetIP: "10.254.0.2"}},
+	}).MarshalProto()
+
+	var decoded TelemetryRequest
+	if err := decoded.UnmarshalProto(data[:len(data)-3]); err == nil {
+		t.Error("UnmarshalProto() on truncated data should fail")
+	}
+}
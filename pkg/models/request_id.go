@@ -0,0 +1,42 @@
+// Package models 定义 SD-WAN 系统的核心数据模型
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// RequestIDHeader Agent 与 Controller 之间传递关联 ID 的请求头
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength 接受的外部请求 ID 最大长度
+const maxRequestIDLength = 128
+
+// NewRequestID 生成随机请求 ID（32 位十六进制）
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// 随机源不可用时退化为时间戳，仍能用于关联日志
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// ValidRequestID 检查外部传入的请求 ID 是否可以直接使用
+// 只接受字母、数字和 - _ . :，避免日志注入
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,25 @@
+// Package models 定义 SD-WAN 系统的核心数据模型
+package models
+
+// DefaultTenantID 默认租户，未指定 tenant_id 的 Agent 都属于该租户
+const DefaultTenantID = ""
+
+// maxTenantIDLength tenant_id 最大长度
+const maxTenantIDLength = 64
+
+// ValidTenantID 检查 tenant_id 是否合法
+// 空字符串表示默认租户；其余只接受字母、数字和 - _
+func ValidTenantID(id string) bool {
+	if len(id) > maxTenantIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
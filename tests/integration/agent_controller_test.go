@@ -14,10 +14,13 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/holygeek00/lite-sdwan/internal/agent"
 	"github.com/holygeek00/lite-sdwan/pkg/models"
 )
 
-// MockExecutor is a mock implementation of route executor for testing
+var _ agent.RouteExecutor = (*MockExecutor)(nil)
+
+// MockExecutor is a mock implementation of agent.RouteExecutor for testing
 type MockExecutor struct {
 	mu            sync.Mutex
 	appliedRoutes []models.RouteConfig
@@ -59,6 +62,53 @@ func (m *MockExecutor) FlushRoutes() error {
 	return nil
 }
 
+// InstallRule does nothing
+func (m *MockExecutor) InstallRule() error { return nil }
+
+// ApplyRoute records a single route
+func (m *MockExecutor) ApplyRoute(route models.RouteConfig) error {
+	return m.SyncRoutes([]models.RouteConfig{route})
+}
+
+// SyncClassRoutes ignores class routes
+func (m *MockExecutor) SyncClassRoutes(int, []models.RouteConfig) error { return nil }
+
+// GetCurrentRoutes returns the applied relay routes
+func (m *MockExecutor) GetCurrentRoutes() ([]agent.CurrentRoute, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var routes []agent.CurrentRoute
+	for _, r := range m.appliedRoutes {
+		if r.NextHop != "direct" {
+			routes = append(routes, agent.CurrentRoute{Destination: r.DstCIDR, NextHop: r.NextHop})
+		}
+	}
+	return routes, nil
+}
+
+// ManagedRouteCount returns the number of applied routes
+func (m *MockExecutor) ManagedRouteCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.appliedRoutes)
+}
+
+// PurgeStaleRoutes has nothing to purge
+func (m *MockExecutor) PurgeStaleRoutes([]int) (int, []error) { return 0, nil }
+
+// CleanupManagedRoutes clears the applied routes
+func (m *MockExecutor) CleanupManagedRoutes() (int, []error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cleaned := len(m.appliedRoutes)
+	m.appliedRoutes = nil
+	return cleaned, nil
+}
+
+// Close does nothing
+func (m *MockExecutor) Close() {}
+
 // GetAppliedRoutes returns the routes that were applied
 func (m *MockExecutor) GetAppliedRoutes() []models.RouteConfig {
 	m.mu.Lock()